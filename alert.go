@@ -0,0 +1,38 @@
+package logadapter
+
+import "github.com/sirupsen/logrus"
+
+// KeyAlert holds the alert metadata set by Alert
+const KeyAlert = "alert"
+
+// Labels promoted from the alert metadata set by Alert
+const (
+	LabelAlertName = "alert_name"
+	LabelRunbook   = "runbook"
+)
+
+type alert struct {
+	name       string
+	runbookURL string
+}
+
+// Alert marks an entry as an alert, for log-based metrics backing Cloud
+// Monitoring alerting policies. The entry is logged at ALERT severity
+// whichever level it is logged at, with the alert name and runbook URL as the
+// alert_name and runbook labels.
+func Alert(entry *logrus.Entry, name, runbookURL string) *logrus.Entry {
+	return entry.WithField(KeyAlert, alert{name: name, runbookURL: runbookURL})
+}
+
+// labels returns the labels of an alert, over the defaults
+func (a alert) labels(defaults map[string]string) map[string]string {
+	labels := make(map[string]string, len(defaults)+2)
+	for k, v := range defaults {
+		labels[k] = v
+	}
+	labels[LabelAlertName] = a.name
+	if a.runbookURL != "" {
+		labels[LabelRunbook] = a.runbookURL
+	}
+	return labels
+}
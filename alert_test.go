@@ -0,0 +1,69 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlert(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithService("test"),
+		logadapter.WithSkipTimestamp(),
+		logadapter.WithAlertDefaults(map[string]string{
+			"team":   "payments",
+			"oncall": "payments-primary",
+		}),
+	)
+
+	entry := logrus.NewEntry(logger)
+	logadapter.Alert(entry, "ledger-imbalance", "https://runbooks.example.com/ledger").
+		Info("ledger is out of balance")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+	assert.Equal(t, "ALERT", got["severity"], "alerts are logged as ALERT whatever the level")
+	assert.Equal(t, map[string]interface{}{
+		"alert_name": "ledger-imbalance",
+		"runbook":    "https://runbooks.example.com/ledger",
+		"team":       "payments",
+		"oncall":     "payments-primary",
+	}, got["logging.googleapis.com/labels"])
+	assert.NotContains(t, got["context"], "data", "alert metadata is not repeated in data")
+}
+
+func TestAlertDefaults(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+		logadapter.WithAlertDefaults(map[string]string{"team": "payments"}),
+	)
+
+	dec := json.NewDecoder(&out)
+
+	logger.Error("not an alert")
+	var got map[string]interface{}
+	require.NoError(t, dec.Decode(&got))
+	assert.NotContains(t, got, "logging.googleapis.com/labels")
+
+	logger.Log(logrus.FatalLevel, "critical")
+	got = nil
+	require.NoError(t, dec.Decode(&got))
+	assert.Equal(t, "CRITICAL", got["severity"])
+	assert.Equal(t,
+		map[string]interface{}{"team": "payments"},
+		got["logging.googleapis.com/labels"])
+}
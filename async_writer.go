@@ -0,0 +1,240 @@
+package logadapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KeyDroppedEntries is the number of entries dropped by an AsyncWriter, in
+// the context of its summary entry.
+const KeyDroppedEntries = "droppedEntries"
+
+// ErrAsyncWriterClosed is returned by writes to a closed AsyncWriter
+var ErrAsyncWriterClosed = errors.New("logadapter: write to closed AsyncWriter")
+
+// AsyncWriter writes formatted entries to an underlying writer from a single
+// background goroutine, so that logging does not block on a slow writer, such
+// as stdout under container runtime backpressure.
+//
+// Each Write is queued as one entry, as written by logrus. When the queue is
+// full, entries are dropped and counted, and a summary of the dropped entries
+// is written once the queue has drained.
+//
+// AsyncWriters register themselves to be flushed by FlushAll until closed.
+type AsyncWriter struct {
+	// counters are accessed atomically, first for 64-bit alignment
+	dropped      uint64
+	totalDropped uint64
+
+	w               io.Writer
+	entries         chan asyncEntry
+	blockOnFull     bool
+	flushTimeout    time.Duration
+	summaryInterval time.Duration
+
+	mu         sync.RWMutex
+	closed     bool
+	done       chan struct{}
+	unregister func()
+}
+
+// asyncEntry is an entry queued to be written, or a flush request to be
+// acknowledged once the entries queued before it are written
+type asyncEntry struct {
+	b       []byte
+	flushed chan struct{}
+}
+
+// AsyncWriterOption lets you configure the AsyncWriter.
+type AsyncWriterOption func(*AsyncWriter)
+
+// WithBlockOnFull blocks writes while the queue is full, instead of dropping
+// entries.
+func WithBlockOnFull() AsyncWriterOption {
+	return func(a *AsyncWriter) {
+		a.blockOnFull = true
+	}
+}
+
+// WithFlushTimeout limits how long Close waits for queued entries to be
+// written. Defaults to 5 seconds.
+func WithFlushTimeout(d time.Duration) AsyncWriterOption {
+	return func(a *AsyncWriter) {
+		a.flushTimeout = d
+	}
+}
+
+// WithDropSummaryInterval configures how often a summary of dropped entries
+// may be written. Defaults to 1 second.
+func WithDropSummaryInterval(d time.Duration) AsyncWriterOption {
+	return func(a *AsyncWriter) {
+		a.summaryInterval = d
+	}
+}
+
+// NewAsyncWriter returns an AsyncWriter queuing up to bufferEntries entries
+// for w, at least 1. It must be closed to flush the queued entries.
+func NewAsyncWriter(w io.Writer, bufferEntries int, opts ...AsyncWriterOption) *AsyncWriter {
+	if bufferEntries < 1 {
+		bufferEntries = 1
+	}
+	a := &AsyncWriter{
+		w:               w,
+		entries:         make(chan asyncEntry, bufferEntries),
+		flushTimeout:    5 * time.Second,
+		summaryInterval: time.Second,
+		done:            make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	go a.run()
+	a.unregister = RegisterFlusher(a)
+	return a
+}
+
+// Write queues a copy of p to be written, dropping it if the queue is full
+// unless configured WithBlockOnFull.
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return 0, ErrAsyncWriterClosed
+	}
+
+	// logrus reuses the buffer once written
+	entry := asyncEntry{b: append([]byte(nil), p...)}
+	if a.blockOnFull {
+		a.entries <- entry
+		return len(p), nil
+	}
+
+	select {
+	case a.entries <- entry:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+		atomic.AddUint64(&a.totalDropped, 1)
+	}
+	return len(p), nil
+}
+
+// Flush waits until the entries queued before it are written, along with a
+// summary of those dropped, or until ctx is done.
+func (a *AsyncWriter) Flush(ctx context.Context) error {
+	a.mu.RLock()
+	if a.closed {
+		a.mu.RUnlock()
+		select {
+		case <-a.done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	flushed := make(chan struct{})
+	select {
+	case a.entries <- asyncEntry{flushed: flushed}:
+		a.mu.RUnlock()
+	case <-ctx.Done():
+		a.mu.RUnlock()
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Dropped returns the number of entries dropped since the writer was created.
+func (a *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.totalDropped)
+}
+
+// Queued returns the number of entries queued to be written.
+func (a *AsyncWriter) Queued() int {
+	return len(a.entries)
+}
+
+// Close stops accepting entries, and waits for those queued to be written
+// until the flush timeout. The underlying writer is not closed.
+func (a *AsyncWriter) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.entries)
+	a.mu.Unlock()
+	a.unregister()
+
+	select {
+	case <-a.done:
+		return nil
+	case <-time.After(a.flushTimeout):
+		return fmt.Errorf("logadapter: timed out flushing AsyncWriter after %v, %d entries queued",
+			a.flushTimeout, len(a.entries))
+	}
+}
+
+// run writes the queued entries, and summarizes those dropped at most every
+// summary interval
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(a.summaryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case entry, ok := <-a.entries:
+			if !ok {
+				a.writeDropSummary()
+				return
+			}
+			if entry.flushed != nil {
+				a.writeDropSummary()
+				close(entry.flushed)
+				continue
+			}
+			_, _ = a.w.Write(entry.b)
+		case <-ticker.C:
+			// summarize once there is capacity for entries again
+			if len(a.entries) < cap(a.entries) {
+				a.writeDropSummary()
+			}
+		}
+	}
+}
+
+// writeDropSummary writes an entry counting the entries dropped since the
+// last summary, if any
+func (a *AsyncWriter) writeDropSummary() {
+	n := atomic.SwapUint64(&a.dropped, 0)
+	if n == 0 {
+		return
+	}
+
+	summary, err := json.Marshal(Entry{
+		Severity: SeverityWarning,
+		Message:  fmt.Sprintf("dropped %d log entries due to backpressure", n),
+		Context: &Context{
+			Data: map[string]interface{}{KeyDroppedEntries: n},
+		},
+	})
+	if err != nil {
+		return
+	}
+	_, _ = a.w.Write(append(summary, '\n'))
+}
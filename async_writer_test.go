@@ -0,0 +1,209 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedWriter blocks writes until released, signalling the first write
+type gatedWriter struct {
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func newGatedWriter() *gatedWriter {
+	return &gatedWriter{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+}
+
+func (g *gatedWriter) Write(p []byte) (int, error) {
+	g.once.Do(func() { close(g.started) })
+	<-g.release
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.buf.Write(p)
+}
+
+func (g *gatedWriter) lines() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return strings.Split(strings.TrimSuffix(g.buf.String(), "\n"), "\n")
+}
+
+func TestAsyncWriterDropsWhenFull(t *testing.T) {
+	w := newGatedWriter()
+	a := logadapter.NewAsyncWriter(w, 2, logadapter.WithDropSummaryInterval(10*time.Millisecond))
+
+	_, err := a.Write([]byte("0\n"))
+	require.NoError(t, err)
+	<-w.started
+	for i := 1; i < 5; i++ {
+		_, err := fmt.Fprintf(a, "%d\n", i)
+		require.NoError(t, err, "writes never block")
+	}
+	assert.Equal(t, uint64(2), a.Dropped())
+
+	close(w.release)
+	require.Eventually(t, func() bool {
+		return len(w.lines()) == 4
+	}, time.Second, 5*time.Millisecond, "dropped entries are summarized once drained")
+	require.NoError(t, a.Close())
+
+	lines := w.lines()
+	assert.Equal(t, []string{"0", "1", "2"}, lines[:3], "queued entries are written in order")
+	var summary map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[3]), &summary))
+	assert.Equal(t, "WARNING", summary["severity"])
+	assert.Equal(t, "dropped 2 log entries due to backpressure", summary["message"])
+	data := summary["context"].(map[string]interface{})["data"].(map[string]interface{})
+	assert.Equal(t, float64(2), data[logadapter.KeyDroppedEntries])
+}
+
+func TestAsyncWriterQueuesAtLeastOne(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		w := newGatedWriter()
+		a := logadapter.NewAsyncWriter(w, size)
+
+		_, err := a.Write([]byte("0\n"))
+		require.NoError(t, err)
+		<-w.started
+		for i := 1; i < 3; i++ {
+			_, err := fmt.Fprintf(a, "%d\n", i)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, uint64(1), a.Dropped(), "one entry is queued with size %d", size)
+
+		close(w.release)
+		require.NoError(t, a.Close())
+		assert.Equal(t, []string{"0", "1"}, w.lines()[:2])
+	}
+}
+
+func TestAsyncWriterBlockOnFull(t *testing.T) {
+	w := newGatedWriter()
+	a := logadapter.NewAsyncWriter(w, 1, logadapter.WithBlockOnFull())
+
+	_, err := a.Write([]byte("0\n"))
+	require.NoError(t, err)
+	<-w.started
+	_, err = a.Write([]byte("1\n"))
+	require.NoError(t, err)
+
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		_, _ = a.Write([]byte("2\n"))
+	}()
+	select {
+	case <-written:
+		t.Fatal("write to a full queue did not block")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(w.release)
+	<-written
+	require.NoError(t, a.Close())
+	assert.Equal(t, []string{"0", "1", "2"}, w.lines())
+	assert.Zero(t, a.Dropped())
+}
+
+func TestAsyncWriterCloseTimeout(t *testing.T) {
+	w := newGatedWriter()
+	defer close(w.release)
+	a := logadapter.NewAsyncWriter(w, 2, logadapter.WithFlushTimeout(10*time.Millisecond))
+
+	_, err := a.Write([]byte("0\n"))
+	require.NoError(t, err)
+	<-w.started
+	_, err = a.Write([]byte("1\n"))
+	require.NoError(t, err)
+
+	assert.Error(t, a.Close(), "flushing a stuck writer times out")
+	_, err = a.Write([]byte("2\n"))
+	assert.Equal(t, logadapter.ErrAsyncWriterClosed, err)
+}
+
+func TestAsyncWriterConcurrentLogging(t *testing.T) {
+	var out bytes.Buffer
+	a := logadapter.NewAsyncWriter(&out, 16, logadapter.WithBlockOnFull())
+	logger := logrus.New()
+	logger.Out = a
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.WithField("goroutine", i).Infof("entry %d", j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.NoError(t, a.Close())
+
+	n := 0
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var msg map[string]interface{}
+		require.NoError(t, dec.Decode(&msg))
+		n++
+	}
+	assert.Equal(t, 1000, n, "every entry is written whole")
+}
+
+// slowWriter simulates stdout under backpressure
+type slowWriter struct{}
+
+func (slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(100 * time.Microsecond)
+	return len(p), nil
+}
+
+func BenchmarkAsyncWriter(b *testing.B) {
+	newLogger := func(w interface{ Write([]byte) (int, error) }) *logrus.Logger {
+		logger := logrus.New()
+		logger.Out = w
+		logger.Formatter = logadapter.NewFormatter(logadapter.WithProjectID("test-project"))
+		return logger
+	}
+
+	b.Run("direct", func(b *testing.B) {
+		logger := newLogger(slowWriter{})
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			logger.Info("benchmark")
+		}
+	})
+
+	b.Run("async", func(b *testing.B) {
+		a := logadapter.NewAsyncWriter(slowWriter{}, 1024)
+		defer a.Close()
+		logger := newLogger(a)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			logger.Info("benchmark")
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package logadapter
+
+import (
+	"runtime/debug"
+)
+
+// readBuildInfo reads the build information embedded in the binary, and is
+// replaced in tests
+var readBuildInfo = debug.ReadBuildInfo
+
+// buildSettingKeys are the build settings added to the context of errors
+// WithBuildInfoInErrors
+var buildSettingKeys = []string{
+	"vcs", "vcs.revision", "vcs.time", "vcs.modified", "GOOS", "GOARCH", "CGO_ENABLED",
+}
+
+// buildInfo holds the details of the build of the binary
+type buildInfo struct {
+	// modulePath is the path of the main module
+	modulePath string
+	// revision is the VCS revision, suffixed with "-dirty" when modified
+	revision  string
+	goVersion string
+	settings  map[string]string
+}
+
+// readBuild returns the details of the build of the binary, or nil when
+// they are unavailable, such as in tests or binaries built without modules
+func readBuild() *buildInfo {
+	info, ok := readBuildInfo()
+	if !ok || info == nil {
+		return nil
+	}
+	b := &buildInfo{modulePath: info.Main.Path}
+	readBuildSettings(b, info)
+	return b
+}
+
+// applyBuildInfo configures the formatter from the build information of
+// the binary, as requested WithAutoSourceReference and
+// WithBuildInfoInErrors
+func (f *Formatter) applyBuildInfo() {
+	if !f.AutoSourceReference && !f.BuildInfoInErrors {
+		return
+	}
+	b := readBuild()
+	if b == nil {
+		return
+	}
+	if f.AutoSourceReference && b.revision != "" {
+		f.SourceReference = append(f.SourceReference, SourceReference{
+			Repository: b.modulePath,
+			RevisionID: b.revision,
+		})
+		if f.Version == "" {
+			f.Version = b.revision
+		}
+	}
+	if f.BuildInfoInErrors {
+		f.build = b
+	}
+}
@@ -0,0 +1,26 @@
+//go:build go1.18
+// +build go1.18
+
+package logadapter
+
+import "runtime/debug"
+
+func readBuildSettings(b *buildInfo, info *debug.BuildInfo) {
+	b.goVersion = info.GoVersion
+	settings := make(map[string]string, len(info.Settings))
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+	b.revision = settings["vcs.revision"]
+	if b.revision != "" && settings["vcs.modified"] == "true" {
+		b.revision += "-dirty"
+	}
+	for _, k := range buildSettingKeys {
+		if v, ok := settings[k]; ok {
+			if b.settings == nil {
+				b.settings = make(map[string]string, len(buildSettingKeys))
+			}
+			b.settings[k] = v
+		}
+	}
+}
@@ -0,0 +1,108 @@
+//go:build go1.18
+// +build go1.18
+
+package logadapter_test
+
+import (
+	"errors"
+	"runtime/debug"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoSourceReference(t *testing.T) {
+	for _, tcase := range []struct {
+		name        string
+		modified    string
+		opts        []logadapter.Option
+		wantVersion string
+		wantRev     string
+	}{
+		{
+			name:        "clean",
+			modified:    "false",
+			wantVersion: "5a4f1c0e",
+			wantRev:     "5a4f1c0e",
+		},
+		{
+			name:        "dirty",
+			modified:    "true",
+			wantVersion: "5a4f1c0e-dirty",
+			wantRev:     "5a4f1c0e-dirty",
+		},
+		{
+			name:        "configured version",
+			modified:    "false",
+			opts:        []logadapter.Option{logadapter.WithVersion("1.4.0")},
+			wantVersion: "1.4.0",
+			wantRev:     "5a4f1c0e",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			defer logadapter.SetReadBuildInfo(func() (*debug.BuildInfo, bool) {
+				return &debug.BuildInfo{
+					GoVersion: "go1.21.5",
+					Main:      debug.Module{Path: "example.com/checkout"},
+					Settings: []debug.BuildSetting{
+						{Key: "vcs", Value: "git"},
+						{Key: "vcs.revision", Value: "5a4f1c0e"},
+						{Key: "vcs.time", Value: "2021-06-01T14:03:07Z"},
+						{Key: "vcs.modified", Value: tcase.modified},
+						{Key: "GOOS", Value: "linux"},
+						{Key: "-ldflags", Value: "-s -w"},
+					},
+				}, true
+			})()
+
+			opts := append([]logadapter.Option{
+				logadapter.WithService("checkout"),
+				logadapter.WithAutoSourceReference(),
+				logadapter.WithBuildInfoInErrors(),
+			}, tcase.opts...)
+			logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(opts...))
+			logger.WithError(errors.New("connection refused")).Error("payment failed")
+
+			entry, ok := rec.LastEntry()
+			require.True(t, ok)
+			assert.Equal(t, tcase.wantVersion, entry.ServiceContext.Version)
+			assert.Equal(t, []logadapter.SourceReference{{
+				Repository: "example.com/checkout",
+				RevisionID: tcase.wantRev,
+			}}, entry.Context.SourceReferences)
+			assert.Equal(t, "go1.21.5", entry.Context.GoVersion)
+			assert.Equal(t, map[string]string{
+				"vcs":          "git",
+				"vcs.revision": "5a4f1c0e",
+				"vcs.time":     "2021-06-01T14:03:07Z",
+				"vcs.modified": tcase.modified,
+				"GOOS":         "linux",
+			}, entry.Context.BuildSettings)
+		})
+	}
+}
+
+func TestBuildInfoUnavailable(t *testing.T) {
+	defer logadapter.SetReadBuildInfo(func() (*debug.BuildInfo, bool) {
+		return nil, false
+	})()
+
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithService("checkout"),
+		logadapter.WithAutoSourceReference(),
+		logadapter.WithBuildInfoInErrors(),
+	))
+	logger.WithError(errors.New("connection refused")).Error("payment failed")
+
+	entry, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Empty(t, entry.ServiceContext.Version)
+	if entry.Context != nil {
+		assert.Empty(t, entry.Context.SourceReferences)
+		assert.Empty(t, entry.Context.GoVersion)
+		assert.Empty(t, entry.Context.BuildSettings)
+	}
+}
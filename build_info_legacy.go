@@ -0,0 +1,9 @@
+//go:build !go1.18
+// +build !go1.18
+
+package logadapter
+
+import "runtime/debug"
+
+// build settings and the Go version are not embedded before go1.18
+func readBuildSettings(b *buildInfo, info *debug.BuildInfo) {}
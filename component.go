@@ -0,0 +1,51 @@
+package logadapter
+
+import (
+	"io"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Component returns a logger for a component of the application, such as
+// to write its entries to a file of its own. It has the formatter, level,
+// hooks and caller reporting of the logger, writes to w, and adds the name
+// of the component to entries as the component field, which the Formatter
+// also adds as the component label.
+//
+// The level and hooks are copied, so setting the level of either logger, or
+// adding hooks to it, later is not shared.
+func Component(logger *logrus.Logger, name string, w io.Writer) *logrus.Logger {
+	child := logrus.New()
+	child.Out = w
+	child.Formatter = logger.Formatter
+	child.Level = logger.GetLevel()
+	child.ReportCaller = logger.ReportCaller
+	child.ExitFunc = logger.ExitFunc
+
+	child.AddHook(componentHook(name))
+	for level, hooks := range logger.Hooks {
+		// copied to a new backing array, so appending to either is not shared
+		child.Hooks[level] = append(child.Hooks[level], hooks...)
+	}
+	return child
+}
+
+// WithComponentField returns the component field with the name of a
+// component of the application, for loggers shared by components.
+func WithComponentField(name string) logrus.Fields {
+	return logrus.Fields{KeyComponent: name}
+}
+
+// componentHook adds the name of a component to entries without one
+type componentHook string
+
+func (c componentHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (c componentHook) Fire(e *logrus.Entry) error {
+	if _, ok := e.Data[KeyComponent]; !ok {
+		e.Data[KeyComponent] = string(c)
+	}
+	return nil
+}
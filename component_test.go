@@ -0,0 +1,68 @@
+package logadapter_test
+
+import (
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingHook counts the entries it fires for
+type countingHook struct{ fired int }
+
+func (h *countingHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h *countingHook) Fire(*logrus.Entry) error {
+	h.fired++
+	return nil
+}
+
+func TestComponent(t *testing.T) {
+	logger, parent := logtest.NewRecorder()
+	logger.SetLevel(logrus.DebugLevel)
+	shared := &countingHook{}
+	logger.AddHook(shared)
+
+	child := &logtest.Recorder{}
+	auth := logadapter.Component(logger, "auth", child)
+	assert.Same(t, logger.Formatter, auth.Formatter)
+	assert.Equal(t, logrus.DebugLevel, auth.GetLevel())
+
+	// hooks added later are not shared
+	own := &countingHook{}
+	auth.AddHook(own)
+	parentOnly := &countingHook{}
+	logger.AddHook(parentOnly)
+
+	auth.WithField("userID", "u-42").Debug("signed in")
+	entries := child.Entries()
+	require.Len(t, entries, 1)
+	logtest.AssertField(t, entries[0], "context.data.component", "auth")
+	logtest.AssertField(t, entries[0], "logging.googleapis.com/labels.component", "auth")
+	logtest.AssertField(t, entries[0], "context.data.userID", "u-42")
+	assert.Empty(t, parent.Entries(), "the child only writes to its own output")
+	assert.Equal(t, 1, shared.fired)
+	assert.Equal(t, 1, own.fired)
+	assert.Equal(t, 0, parentOnly.fired)
+
+	logger.Info("order placed")
+	entries = parent.Entries()
+	require.Len(t, entries, 1)
+	_, ok := logtest.Field(entries[0], "context.data.component")
+	assert.False(t, ok, "the parent is unaffected")
+	assert.Len(t, child.Entries(), 1)
+	assert.Equal(t, 1, own.fired)
+
+	auth.WithFields(logadapter.WithComponentField("auth.oauth")).Info("token refreshed")
+	last, ok := child.LastEntry()
+	require.True(t, ok)
+	logtest.AssertField(t, last, "context.data.component", "auth.oauth")
+	logtest.AssertField(t, last, "logging.googleapis.com/labels.component", "auth.oauth")
+
+	// the level is copied once
+	logger.SetLevel(logrus.WarnLevel)
+	assert.Equal(t, logrus.DebugLevel, auth.GetLevel())
+}
@@ -0,0 +1,316 @@
+package logadapter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FormatterOptions is a snapshot of the effective configuration of a
+// Formatter, as returned by its Options method.
+type FormatterOptions struct {
+	ProjectID           string            `json:"projectId,omitempty"`
+	Service             string            `json:"service,omitempty"`
+	Version             string            `json:"version,omitempty"`
+	SourceReference     []SourceReference `json:"sourceReference,omitempty"`
+	Platform            string            `json:"platform"`
+	StackStyle          string            `json:"stackStyle"`
+	StackSkip           []string          `json:"stackSkip,omitempty"`
+	StackSkipPrefixes   []string          `json:"stackSkipPrefixes,omitempty"`
+	StackSkipFunctions  []string          `json:"stackSkipFunctions,omitempty"`
+	ErrorKey            string            `json:"errorKey"`
+	ForceTraceSampled   bool              `json:"forceTraceSampledOnError,omitempty"`
+	SourceLocation      string            `json:"sourceLocationStrategy"`
+	SourceLocationDebug bool              `json:"sourceLocationDebug,omitempty"`
+	StackFrameLimit     int               `json:"stackFrameLimit,omitempty"`
+	StackTrimPackages   []string          `json:"stackTrimPackages,omitempty"`
+	CapturedLocals      bool              `json:"capturedLocals,omitempty"`
+	ReservedKeyPolicy   string            `json:"reservedKeyPolicy"`
+	ReservedKeyPrefix   string            `json:"reservedKeyPrefix,omitempty"`
+	SchemaVersion       string            `json:"schemaVersion,omitempty"`
+	RegexSkip           string            `json:"regexSkip,omitempty"`
+	SkipTimestamp       bool              `json:"skipTimestamp,omitempty"`
+	MonotonicTimestamps bool              `json:"monotonicTimestamps,omitempty"`
+	TimestampPrecision  string            `json:"timestampPrecision,omitempty"`
+	PrettyPrint         bool              `json:"prettyPrint,omitempty"`
+	MaxAdditionalErrors int               `json:"maxAdditionalErrors,omitempty"`
+	ErrorChain          bool              `json:"errorChain,omitempty"`
+	ErrorTitleFromError bool              `json:"errorTitleFromError,omitempty"`
+	ErrorFingerprint    bool              `json:"errorFingerprint,omitempty"`
+	AlertLabels         map[string]string `json:"alertLabels,omitempty"`
+	KubernetesLabels    map[string]string `json:"kubernetesLabels,omitempty"`
+	DurationFormat      string            `json:"durationFormat"`
+	DurationMillis      bool              `json:"durationMillis,omitempty"`
+	FieldTypes          map[string]string `json:"fieldTypes,omitempty"`
+	StringifyAll        bool              `json:"stringifyAll,omitempty"`
+	NoProtoJSON         bool              `json:"noProtoJSON,omitempty"`
+	ProtoJSONMaxBytes   int               `json:"protoJSONMaxBytes,omitempty"`
+	BuildInfoInErrors   bool              `json:"buildInfoInErrors,omitempty"`
+	LegacyFieldNames    bool              `json:"legacyFieldNames,omitempty"`
+	StripANSI           bool              `json:"stripANSI,omitempty"`
+	SamplingEscalation  bool              `json:"samplingEscalation,omitempty"`
+	// the functions configured are only reported as present
+	StackPolicy     bool    `json:"stackPolicy,omitempty"`
+	ProjectResolver bool    `json:"projectResolver,omitempty"`
+	MessageComposer bool    `json:"messageComposer,omitempty"`
+	CustomEncoder   bool    `json:"customEncoder,omitempty"`
+	EntryMutators   int     `json:"entryMutators,omitempty"`
+	Validation      bool    `json:"validation,omitempty"`
+	SizeSampleRate  float64 `json:"sizeSampleRate,omitempty"`
+}
+
+// Clone returns a copy of the formatter, which can be configured without
+// affecting the formatter.
+func (f *Formatter) Clone() *Formatter {
+	return &Formatter{
+		Service:             f.Service,
+		Version:             f.Version,
+		SourceReference:     append([]SourceReference(nil), f.SourceReference...),
+		ProjectID:           f.ProjectID,
+		StackSkip:           append([]string(nil), f.StackSkip...),
+		StackStyle:          f.StackStyle,
+		SkipTimestamp:       f.SkipTimestamp,
+		RegexSkip:           f.RegexSkip,
+		PrettyPrint:         f.PrettyPrint,
+		GlobalTraceID:       f.GlobalTraceID,
+		StackPolicy:         f.StackPolicy,
+		MaxAdditionalErrors: f.MaxAdditionalErrors,
+		Metrics:             f.Metrics,
+		ErrorChain:          f.ErrorChain,
+		AlertLabels:         copyLabels(f.AlertLabels),
+		MessageSeparator:    f.MessageSeparator,
+		MessageComposer:     f.MessageComposer,
+		ErrorTitleFromError: f.ErrorTitleFromError,
+		Platform:            f.Platform,
+		Resource:            copyResource(f.Resource),
+		Encoder:             f.Encoder,
+		DurationFormat:      f.DurationFormat,
+		DurationMillis:      f.DurationMillis,
+		NoProtoJSON:         f.NoProtoJSON,
+		ProtoJSONMaxBytes:   f.ProtoJSONMaxBytes,
+		AutoSourceReference: f.AutoSourceReference,
+		BuildInfoInErrors:   f.BuildInfoInErrors,
+		ProjectResolver:     f.ProjectResolver,
+		ErrorFingerprint:    f.ErrorFingerprint,
+		EntryMutators:       append([]EntryMutator(nil), f.EntryMutators...),
+		ValidationHandler:   f.ValidationHandler,
+		SizeReporter:        f.SizeReporter,
+		SizeSampleRate:      f.SizeSampleRate,
+		KubernetesLabels:    copyLabels(f.KubernetesLabels),
+		MonotonicTimestamps: f.MonotonicTimestamps,
+		TimestampPrecision:  f.TimestampPrecision,
+		FieldTypes:          copyFieldTypes(f.FieldTypes),
+		StringifyAll:        f.StringifyAll,
+		StackSkipPrefixes:   append([]string(nil), f.StackSkipPrefixes...),
+		StackSkipFunctions:  append([]string(nil), f.StackSkipFunctions...),
+		ErrorKey:            f.ErrorKey,
+		SourceLocationDebug: f.SourceLocationDebug,
+		StackFrameLimit:     f.StackFrameLimit,
+		StackTrimPackages:   copyPackages(f.StackTrimPackages),
+		CapturedLocals:      f.CapturedLocals,
+		ReservedKeyPolicy:   f.ReservedKeyPolicy,
+		ReservedKeyPrefix:   f.ReservedKeyPrefix,
+		SchemaVersion:       f.SchemaVersion,
+		LegacyFieldNames:    f.LegacyFieldNames,
+		StripANSI:           f.StripANSI,
+		// the escalation callback is shared, as are the other functions
+		ForceTraceSampledOnError: f.ForceTraceSampledOnError,
+		SamplingEscalation:       f.SamplingEscalation,
+		SourceLocationStrategy:   f.SourceLocationStrategy,
+		// the build information is read once and never modified
+		build:       f.build,
+		globalTrace: f.globalTrace,
+	}
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	c := make(map[string]string, len(labels))
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
+
+// copyPackages copies a list of packages, keeping an empty list distinct from
+// nil
+func copyPackages(packages []string) []string {
+	if packages == nil {
+		return nil
+	}
+	return append([]string{}, packages...)
+}
+
+func copyFieldTypes(types map[string]FieldType) map[string]FieldType {
+	if types == nil {
+		return nil
+	}
+	c := make(map[string]FieldType, len(types))
+	for k, t := range types {
+		c[k] = t
+	}
+	return c
+}
+
+func copyResource(r *MonitoredResource) *MonitoredResource {
+	if r == nil {
+		return nil
+	}
+	return &MonitoredResource{Type: r.Type, Labels: copyLabels(r.Labels)}
+}
+
+// Options returns a snapshot of the effective configuration of the
+// formatter.
+func (f *Formatter) Options() FormatterOptions {
+	sizeSampleRate := 0.0
+	if f.SizeReporter != nil {
+		sizeSampleRate = f.SizeSampleRate
+		if sizeSampleRate <= 0 || sizeSampleRate > 1 {
+			sizeSampleRate = DefaultSizeSampleRate
+		}
+	}
+	var fieldTypes map[string]string
+	if len(f.FieldTypes) > 0 {
+		fieldTypes = make(map[string]string, len(f.FieldTypes))
+		for k, t := range f.FieldTypes {
+			fieldTypes[k] = t.String()
+		}
+	}
+	var reservedKeyPrefix string
+	if f.ReservedKeyPolicy == RenameReservedKeys {
+		reservedKeyPrefix = f.reservedKeyPrefix()
+	}
+	var timestampPrecision string
+	if f.TimestampPrecision > 0 {
+		timestampPrecision = f.TimestampPrecision.String()
+	}
+	return FormatterOptions{
+		ProjectID:           f.ProjectID,
+		Service:             f.Service,
+		Version:             f.Version,
+		SourceReference:     append([]SourceReference(nil), f.SourceReference...),
+		Platform:            platformName(f.Platform),
+		StackStyle:          stackStyleName(f.StackStyle),
+		StackSkip:           append([]string(nil), f.StackSkip...),
+		StackSkipPrefixes:   append([]string(nil), f.StackSkipPrefixes...),
+		StackSkipFunctions:  append([]string(nil), f.StackSkipFunctions...),
+		ErrorKey:            f.errorKey(),
+		ForceTraceSampled:   f.ForceTraceSampledOnError,
+		SourceLocation:      sourceLocationStrategyName(f.SourceLocationStrategy),
+		SourceLocationDebug: f.SourceLocationDebug,
+		StackFrameLimit:     f.StackFrameLimit,
+		StackTrimPackages:   f.stackTrimPackages(),
+		CapturedLocals:      f.CapturedLocals,
+		ReservedKeyPolicy:   reservedKeyPolicyName(f.ReservedKeyPolicy),
+		ReservedKeyPrefix:   reservedKeyPrefix,
+		SchemaVersion:       f.SchemaVersion,
+		RegexSkip:           f.RegexSkip,
+		SkipTimestamp:       f.SkipTimestamp,
+		MonotonicTimestamps: f.MonotonicTimestamps,
+		TimestampPrecision:  timestampPrecision,
+		PrettyPrint:         f.PrettyPrint,
+		MaxAdditionalErrors: f.MaxAdditionalErrors,
+		ErrorChain:          f.ErrorChain,
+		ErrorTitleFromError: f.ErrorTitleFromError,
+		ErrorFingerprint:    f.ErrorFingerprint,
+		AlertLabels:         copyLabels(f.AlertLabels),
+		KubernetesLabels:    copyLabels(f.KubernetesLabels),
+		DurationFormat:      durationFormatName(f.DurationFormat),
+		DurationMillis:      f.DurationMillis,
+		FieldTypes:          fieldTypes,
+		StringifyAll:        f.StringifyAll,
+		NoProtoJSON:         f.NoProtoJSON,
+		ProtoJSONMaxBytes:   f.ProtoJSONMaxBytes,
+		BuildInfoInErrors:   f.BuildInfoInErrors,
+		LegacyFieldNames:    f.LegacyFieldNames,
+		StripANSI:           f.StripANSI,
+		SamplingEscalation:  f.SamplingEscalation != nil,
+		StackPolicy:         f.StackPolicy != nil,
+		ProjectResolver:     f.ProjectResolver != nil,
+		MessageComposer:     f.MessageComposer != nil,
+		CustomEncoder:       f.Encoder != nil,
+		EntryMutators:       len(f.EntryMutators),
+		Validation:          f.ValidationHandler != nil,
+		SizeSampleRate:      sizeSampleRate,
+	}
+}
+
+// String summarizes the configuration of the formatter on a single line,
+// to log at startup.
+func (f *Formatter) String() string {
+	return fmt.Sprintf(
+		"stackdriver formatter: project=%s service=%s version=%s platform=%s "+
+			"stackStyle=%s skip=[%s]",
+		f.ProjectID, f.Service, f.Version, platformName(f.Platform),
+		stackStyleName(f.StackStyle), strings.Join(f.StackSkip, " "),
+	)
+}
+
+// LogConfiguration logs the configuration of the formatter of the logger at
+// INFO, so that the boot logs of a service record how it logs.
+func LogConfiguration(logger *logrus.Logger) {
+	f := loggerFormatter(logger)
+	if f == nil {
+		logger.WithField("formatter", fmt.Sprintf("%T", logger.Formatter)).
+			Info("logging configuration")
+		return
+	}
+	logger.WithField("formatter", f.Options()).Info("logging configuration")
+}
+
+// loggerFormatter returns the Formatter of logger, if it has one
+func loggerFormatter(logger *logrus.Logger) *Formatter {
+	switch t := logger.Formatter.(type) {
+	case *Formatter:
+		return t
+	case *DevelopmentFormatter:
+		return t.Formatter
+	}
+	return nil
+}
+
+func platformName(p Platform) string {
+	switch p {
+	case PlatformGKE:
+		return "gke"
+	case PlatformCloudRun:
+		return "cloudrun"
+	case PlatformGCE:
+		return "gce"
+	case PlatformAgentless:
+		return "agentless"
+	default:
+		return "auto"
+	}
+}
+
+func stackStyleName(s StackTraceStyle) string {
+	switch s {
+	case TraceInMessage:
+		return "message"
+	case TraceInPayload:
+		return "payload"
+	case TraceInBoth:
+		return "both"
+	case TraceNone:
+		return "none"
+	default:
+		return fmt.Sprintf("StackTraceStyle(%d)", int(s))
+	}
+}
+
+func durationFormatName(d DurationFormat) string {
+	switch d {
+	case DurationSeconds:
+		return "seconds"
+	case DurationMillisString:
+		return "millis"
+	case DurationNanosInt:
+		return "nanos"
+	default:
+		return fmt.Sprintf("DurationFormat(%d)", int(d))
+	}
+}
@@ -0,0 +1,76 @@
+package logadapter_test
+
+import (
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatterClone(t *testing.T) {
+	f := logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSourceReference("github.com/example/checkout", "v1.2.0"),
+		logadapter.WithAlertDefaults(map[string]string{"team": "payments"}),
+	)
+	skip := append([]string(nil), f.StackSkip...)
+
+	c := f.Clone()
+	assert.Equal(t, f.Options(), c.Options())
+
+	c.StackSkip[0] = "github.com/example/checkout"
+	c.StackSkip = append(c.StackSkip, "github.com/example/vendor")
+	c.SourceReference[0].RevisionID = "v2.0.0"
+	c.AlertLabels["team"] = "orders"
+	c.ProjectID = "other-project"
+
+	assert.Equal(t, skip, f.StackSkip, "the skipped packages are copied")
+	assert.Equal(t, "v1.2.0", f.SourceReference[0].RevisionID)
+	assert.Equal(t, "payments", f.AlertLabels["team"])
+	assert.Equal(t, "test-project", f.ProjectID)
+}
+
+func TestFormatterOptions(t *testing.T) {
+	f := logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithService("checkout"),
+		logadapter.WithVersion("1.2"),
+		logadapter.WithStackTraceStyle(logadapter.TraceInPayload),
+		logadapter.WithTargetPlatform(logadapter.PlatformCloudRun),
+		logadapter.WithErrorChain(),
+		logadapter.WithSizeAttribution(0, func(logadapter.SizeReport) {}),
+	)
+
+	o := f.Options()
+	assert.Equal(t, "test-project", o.ProjectID)
+	assert.Equal(t, "checkout", o.Service)
+	assert.Equal(t, "1.2", o.Version)
+	assert.Equal(t, "payload", o.StackStyle)
+	assert.Equal(t, "cloudrun", o.Platform)
+	assert.Equal(t, "seconds", o.DurationFormat)
+	assert.True(t, o.ErrorChain)
+	assert.Equal(t, logadapter.DefaultSizeSampleRate, o.SizeSampleRate,
+		"the effective sample rate")
+	assert.Equal(t, f.StackSkip, o.StackSkip)
+
+	assert.Equal(t, "stackdriver formatter: project=test-project service=checkout "+
+		"version=1.2 platform=cloudrun stackStyle=payload "+
+		"skip=[github.com/sirupsen/logrus github.com/StevenACoffman/logrus-stackdriver-formatter "+
+		"github.com/grpc-ecosystem/go-grpc-middleware go.opentelemetry.io]", f.String())
+}
+
+func TestLogConfiguration(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithService("checkout"),
+	))
+	logadapter.LogConfiguration(logger)
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, logadapter.SeverityInfo, e.Severity)
+	assert.Equal(t, "logging configuration", e.Message)
+	logtest.AssertField(t, e, "context.data.formatter.service", "checkout")
+	logtest.AssertField(t, e, "context.data.formatter.stackStyle", "message")
+}
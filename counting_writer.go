@@ -0,0 +1,100 @@
+package logadapter
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CountingWriter counts the entries written to an underlying writer, and
+// records when it last succeeded and how it last failed, for Diagnostics to
+// tell whether entries still reach their destination. Install it as the Out
+// of a logger:
+//
+//	logger.Out = logadapter.NewCountingWriter(os.Stdout)
+//
+// As the output of an AsyncWriter, it counts the entries written rather than
+// those queued.
+type CountingWriter struct {
+	// counters are accessed atomically, first for 64-bit alignment
+	writes uint64
+	bytes  uint64
+	errors uint64
+
+	w   io.Writer
+	wmu sync.Mutex
+
+	mu          sync.Mutex
+	lastWrite   time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// WriterStats is a snapshot of the writes of a CountingWriter.
+type WriterStats struct {
+	Writes      uint64     `json:"writes"`
+	Bytes       uint64     `json:"bytes"`
+	Errors      uint64     `json:"errors"`
+	LastWrite   *time.Time `json:"lastWrite,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// NewCountingWriter returns a CountingWriter writing to w.
+func NewCountingWriter(w io.Writer) *CountingWriter {
+	return &CountingWriter{w: w}
+}
+
+// Write writes p to the underlying writer, counting it as written if it
+// succeeds. Writes are serialized, so the underlying writer needn't be safe
+// for concurrent writes.
+func (c *CountingWriter) Write(p []byte) (int, error) {
+	c.wmu.Lock()
+	n, err := c.w.Write(p)
+	c.wmu.Unlock()
+	now := time.Now()
+	if err != nil {
+		atomic.AddUint64(&c.errors, 1)
+		c.mu.Lock()
+		c.lastError, c.lastErrorAt = err.Error(), now
+		c.mu.Unlock()
+		return n, err
+	}
+	atomic.AddUint64(&c.writes, 1)
+	atomic.AddUint64(&c.bytes, uint64(n))
+	c.mu.Lock()
+	c.lastWrite = now
+	c.mu.Unlock()
+	return n, nil
+}
+
+// Flush flushes the underlying writer, if it is a Flusher such as an
+// AsyncWriter.
+func (c *CountingWriter) Flush(ctx context.Context) error {
+	if f, ok := c.w.(Flusher); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
+// Stats returns a snapshot of the writes since the writer was created.
+func (c *CountingWriter) Stats() WriterStats {
+	s := WriterStats{
+		Writes: atomic.LoadUint64(&c.writes),
+		Bytes:  atomic.LoadUint64(&c.bytes),
+		Errors: atomic.LoadUint64(&c.errors),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.lastWrite.IsZero() {
+		t := c.lastWrite
+		s.LastWrite = &t
+	}
+	if c.lastError != "" {
+		t := c.lastErrorAt
+		s.LastError, s.LastErrorAt = c.lastError, &t
+	}
+	return s
+}
@@ -1,21 +1,246 @@
-// Package ctxlogrus wraps the go-grpc-middleware ctxlogrus, extracts a trace
-// context to correlate logs emitted to the correct trace and span
+// Package ctxlogrus provides a request-scoped log entry in context, and
+// extracts a trace context to correlate logs emitted to the correct trace and
+// span. It mirrors the go-grpc-middleware ctxlogrus without depending on gRPC.
+//
+// It no longer wraps the go-grpc-middleware ctxlogrus, and stores its entry
+// under a key of its own, so it is not compatible with it: an entry added by
+// the grpc_logrus interceptors isn't extracted by this package, nor the
+// reverse, and Extract returns a no-op entry instead. Services migrating use
+// the interceptors of the grpcmw package, and import this package everywhere.
 package ctxlogrus
 
 import (
 	"context"
+	"io/ioutil"
+	"sync"
 
-	"github.com/grpc-ecosystem/go-grpc-middleware/logging/logrus/ctxlogrus"
 	"github.com/sirupsen/logrus"
 )
 
+// FieldsFunc provides fields to every entry extracted from a context, such as
+// the gRPC tags of a request.
+type FieldsFunc func(ctx context.Context) logrus.Fields
+
+type ctxLoggerMarker struct{}
+
+// ctxLogger is a layer of fields of the log entry in context, on top of the
+// layers of its parent contexts
+type ctxLogger struct {
+	logger *logrus.Entry
+	parent *ctxLogger
+
+	mu         sync.Mutex
+	fields     logrus.Fields
+	fieldFuncs []FieldsFunc
+	// deferred scopes add fields to their parent until first released
+	deferred bool
+}
+
+// target returns the layer fields are added to, passing over deferred scopes
+func (l *ctxLogger) target() *ctxLogger {
+	for {
+		l.mu.Lock()
+		deferred := l.deferred
+		l.mu.Unlock()
+		if !deferred {
+			return l
+		}
+		l = l.parent
+	}
+}
+
 var (
-	AddFields = ctxlogrus.AddFields
-	ToContext = ctxlogrus.ToContext
+	ctxLoggerKey = &ctxLoggerMarker{}
+
+	nullLogger = &logrus.Logger{
+		Out:       ioutil.Discard,
+		Formatter: new(logrus.TextFormatter),
+		Hooks:     make(logrus.LevelHooks),
+		Level:     logrus.PanicLevel,
+	}
 )
 
+// AddFields adds logrus fields to the request-scoped log entry.
+func AddFields(ctx context.Context, fields logrus.Fields) {
+	l, ok := ctx.Value(ctxLoggerKey).(*ctxLogger)
+	if !ok || l == nil {
+		return
+	}
+	l = l.target()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k, v := range fields {
+		l.fields[k] = v
+	}
+}
+
+// AddFieldsFunc adds fields provided by f to the request-scoped log entry each
+// time it is extracted. Fields added with AddFields take precedence.
+func AddFieldsFunc(ctx context.Context, f FieldsFunc) {
+	l, ok := ctx.Value(ctxLoggerKey).(*ctxLogger)
+	if !ok || l == nil {
+		return
+	}
+	l = l.target()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fieldFuncs = append(l.fieldFuncs, f)
+}
+
+// WithFields returns a child context whose entry is a copy of that of ctx,
+// with the fields added. Unlike AddFields, the entry of ctx is not modified,
+// and fields added to either context later are not seen in the other, so that
+// contexts derived from a shared parent concurrently don't see each other's
+// fields.
+//
+// Without a log entry in ctx, ctx is returned.
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	parent, ok := ctx.Value(ctxLoggerKey).(*ctxLogger)
+	if !ok || parent == nil {
+		return ctx
+	}
+	l := &ctxLogger{
+		logger: parent.logger,
+		fields: logrus.Fields{},
+	}
+	// the layers of the parent are flattened into the copy, the fields of
+	// inner layers overriding those of outer layers
+	var layers []*ctxLogger
+	for p := parent; p != nil; p = p.parent {
+		layers = append(layers, p)
+	}
+	for i := len(layers) - 1; i >= 0; i-- {
+		layer := layers[i]
+		layer.mu.Lock()
+		l.fieldFuncs = append(l.fieldFuncs, layer.fieldFuncs...)
+		for k, v := range layer.fields {
+			l.fields[k] = v
+		}
+		layer.mu.Unlock()
+	}
+	for k, v := range fields {
+		l.fields[k] = v
+	}
+	return context.WithValue(ctx, ctxLoggerKey, l)
+}
+
+// WithLogger returns a child context whose entry is replaced by entry,
+// without the fields added to the entry of ctx.
+func WithLogger(ctx context.Context, entry *logrus.Entry) context.Context {
+	return ToContext(ctx, entry)
+}
+
+// Has reports whether a log entry was added to the context, without
+// allocating the no-op entry Extract returns otherwise.
+func Has(ctx context.Context) bool {
+	l, ok := ctx.Value(ctxLoggerKey).(*ctxLogger)
+	return ok && l != nil
+}
+
+// WithScope returns a child context whose entry has the fields of ctx, and
+// keeps the fields added to the child context apart from them, so that they
+// are discarded along with the child context, or when release is called.
+// The child context may be used again after release, without the fields
+// added before.
+//
+// Without a log entry in ctx, ctx is returned.
+func WithScope(ctx context.Context) (scoped context.Context, release func()) {
+	parent, ok := ctx.Value(ctxLoggerKey).(*ctxLogger)
+	if !ok || parent == nil {
+		return ctx, func() {}
+	}
+	l := &ctxLogger{
+		logger: parent.logger,
+		parent: parent,
+		fields: logrus.Fields{},
+	}
+	release = func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.fields = logrus.Fields{}
+		l.fieldFuncs = nil
+	}
+	return context.WithValue(ctx, ctxLoggerKey, l), release
+}
+
+// WithDeferredScope is WithScope, except that the fields added to the child
+// context are added to the entry of ctx until release is first called, such
+// as those added to a stream by interceptors before it receives its first
+// message.
+//
+// Without a log entry in ctx, ctx is returned.
+func WithDeferredScope(ctx context.Context) (scoped context.Context, release func()) {
+	scoped, discard := WithScope(ctx)
+	l, ok := scoped.Value(ctxLoggerKey).(*ctxLogger)
+	if !ok || scoped == ctx {
+		return scoped, discard
+	}
+	l.deferred = true
+	return scoped, func() {
+		l.mu.Lock()
+		l.deferred = false
+		l.mu.Unlock()
+		discard()
+	}
+}
+
 // Extract provides a request-scoped log entry with details of the current
 // trace in place.
+//
+// If no log entry was added to the context, a no-op entry is returned. This
+// makes it safe to use regardless.
 func Extract(ctx context.Context) *logrus.Entry {
-	return ctxlogrus.Extract(ctx).WithContext(ctx)
+	l, ok := ctx.Value(ctxLoggerKey).(*ctxLogger)
+	if !ok || l == nil {
+		return logrus.NewEntry(nullLogger).WithContext(ctx)
+	}
+
+	// the fields of outer layers are overridden by those of inner layers
+	var layers []*ctxLogger
+	for ; l != nil; l = l.parent {
+		layers = append(layers, l)
+	}
+	var funcs []FieldsFunc
+	added := logrus.Fields{}
+	for i := len(layers) - 1; i >= 0; i-- {
+		layer := layers[i]
+		layer.mu.Lock()
+		funcs = append(funcs, layer.fieldFuncs...)
+		for k, v := range layer.fields {
+			added[k] = v
+		}
+		layer.mu.Unlock()
+	}
+
+	// fields added with AddFields take precedence over those of functions
+	fields := logrus.Fields{}
+	for _, f := range funcs {
+		for k, v := range f(ctx) {
+			fields[k] = v
+		}
+	}
+	for k, v := range added {
+		fields[k] = v
+	}
+
+	return layers[0].logger.WithFields(fields).WithContext(ctx)
+}
+
+// ExtractOr provides the request-scoped log entry like Extract, or an entry of
+// logger when no log entry was added to the context.
+func ExtractOr(ctx context.Context, logger *logrus.Logger) *logrus.Entry {
+	if l, ok := ctx.Value(ctxLoggerKey).(*ctxLogger); !ok || l == nil {
+		return logrus.NewEntry(logger).WithContext(ctx)
+	}
+	return Extract(ctx)
+}
+
+// ToContext adds the logrus.Entry to the context for extraction later.
+// Returning the new context that has been created.
+func ToContext(ctx context.Context, entry *logrus.Entry) context.Context {
+	l := &ctxLogger{
+		logger: entry,
+		fields: logrus.Fields{},
+	}
+	return context.WithValue(ctx, ctxLoggerKey, l)
 }
@@ -0,0 +1,97 @@
+package ctxlogrus_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+)
+
+func TestWithFields(t *testing.T) {
+	ctx := ctxlogrus.ToContext(context.Background(), logrus.NewEntry(logrus.New()))
+	ctxlogrus.AddFields(ctx, logrus.Fields{"requestID": "r-1", "attempt": 1})
+	ctxlogrus.AddFieldsFunc(ctx, func(context.Context) logrus.Fields {
+		return logrus.Fields{"region": "eu"}
+	})
+
+	child := ctxlogrus.WithFields(ctx, logrus.Fields{"attempt": 2})
+	assert.Equal(t, logrus.Fields{"requestID": "r-1", "attempt": 2, "region": "eu"},
+		ctxlogrus.Extract(child).Data, "the fields are added to a copy of the entry")
+	assert.Equal(t, logrus.Fields{"requestID": "r-1", "attempt": 1, "region": "eu"},
+		ctxlogrus.Extract(ctx).Data, "the entry of ctx is unchanged")
+
+	ctxlogrus.AddFields(child, logrus.Fields{"step": "done"})
+	ctxlogrus.AddFields(ctx, logrus.Fields{"user": "u-1"})
+	assert.NotContains(t, ctxlogrus.Extract(ctx).Data, "step")
+	assert.NotContains(t, ctxlogrus.Extract(child).Data, "user")
+}
+
+func TestWithFieldsConcurrent(t *testing.T) {
+	ctx := ctxlogrus.ToContext(context.Background(), logrus.NewEntry(logrus.New()))
+	ctxlogrus.AddFields(ctx, logrus.Fields{"connection": "c-1"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("r-%d", i)
+			child := ctxlogrus.WithFields(ctx, logrus.Fields{"requestID": id})
+			for j := 0; j < 100; j++ {
+				ctxlogrus.AddFields(child, logrus.Fields{"step": j, "owner": id})
+				data := ctxlogrus.Extract(child).Data
+				assert.Equal(t, id, data["requestID"])
+				assert.Equal(t, id, data["owner"], "the fields of siblings don't bleed")
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, logrus.Fields{"connection": "c-1"}, ctxlogrus.Extract(ctx).Data,
+		"the parent is unchanged")
+}
+
+func TestWithFieldsWithoutEntry(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, ctx, ctxlogrus.WithFields(ctx, logrus.Fields{"k": "v"}))
+}
+
+func TestWithLogger(t *testing.T) {
+	ctx := ctxlogrus.ToContext(context.Background(), logrus.NewEntry(logrus.New()))
+	ctxlogrus.AddFields(ctx, logrus.Fields{"requestID": "r-1"})
+
+	logger := logrus.New()
+	child := ctxlogrus.WithLogger(ctx, logrus.NewEntry(logger).WithField("job", "sync"))
+	entry := ctxlogrus.Extract(child)
+	assert.Same(t, logger, entry.Logger)
+	assert.Equal(t, logrus.Fields{"job": "sync"}, entry.Data, "the entry is replaced")
+	assert.Equal(t, "r-1", ctxlogrus.Extract(ctx).Data["requestID"])
+}
+
+func TestHas(t *testing.T) {
+	assert.False(t, ctxlogrus.Has(context.Background()))
+	assert.True(t, ctxlogrus.Has(
+		ctxlogrus.ToContext(context.Background(), logrus.NewEntry(logrus.New()))))
+}
+
+func TestWithDeferredScope(t *testing.T) {
+	ctx := ctxlogrus.ToContext(context.Background(), logrus.NewEntry(logrus.New()))
+	scoped, release := ctxlogrus.WithDeferredScope(ctx)
+
+	ctxlogrus.AddFields(scoped, logrus.Fields{"user": "u-1"})
+	assert.Equal(t, "u-1", ctxlogrus.Extract(ctx).Data["user"],
+		"fields are added to the parent until released")
+
+	release()
+	ctxlogrus.AddFields(scoped, logrus.Fields{"message": 1})
+	assert.Equal(t, logrus.Fields{"user": "u-1", "message": 1}, ctxlogrus.Extract(scoped).Data)
+	assert.NotContains(t, ctxlogrus.Extract(ctx).Data, "message")
+
+	release()
+	assert.Equal(t, logrus.Fields{"user": "u-1"}, ctxlogrus.Extract(scoped).Data,
+		"fields of the scope are discarded once released again")
+}
@@ -0,0 +1,35 @@
+package logadapter
+
+import (
+	"context"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+)
+
+// KeyDependencies lists the calls to dependencies started with
+// StartDependencyCall in the summary of a request, as objects with a name,
+// startedAtMs, duration, error and detail
+const KeyDependencies = middleware.KeyDependencies
+
+// DepCall is a call to a dependency of a request. Its methods do nothing on a
+// nil DepCall.
+type DepCall = middleware.DepCall
+
+// StartDependencyCall records a call to a dependency of the request of ctx,
+// such as a database or another service, to be listed in the summary logged by
+// the logging middleware at the end of the request: a poor man's list of
+// spans for services without tracing. The names of the dependencies whose
+// calls ended with an error are appended to the message of the summary.
+//
+//	call := logadapter.StartDependencyCall(ctx, "payments")
+//	resp, err := payments.Charge(ctx, req)
+//	call.SetDetail("status", status.Code(err).String())
+//	call.End(err)
+//
+// It is safe to call from the goroutines of a request, such as for parallel
+// calls. Only the first 50 calls of a request are listed, and the others
+// counted as dependenciesDropped. Outside of the middleware, and beyond the
+// limit, it returns nil.
+func StartDependencyCall(ctx context.Context, name string) *DepCall {
+	return middleware.StartDependencyCall(ctx, name)
+}
@@ -0,0 +1,28 @@
+package logadapter_test
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNoGRPCDependency guards that the root package, and the packages it
+// imports such as httpmw, leave gRPC to the grpcmw package.
+func TestNoGRPCDependency(t *testing.T) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("the go command is not available")
+	}
+	out, err := exec.Command(goTool, "list", "-deps", ".").Output()
+	require.NoError(t, err)
+
+	deps := strings.Fields(string(out))
+	require.NotEmpty(t, deps)
+	for _, dep := range deps {
+		assert.False(t, strings.HasPrefix(dep, "google.golang.org/grpc"),
+			"the root package depends on %s", dep)
+	}
+}
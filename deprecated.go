@@ -0,0 +1,210 @@
+package logadapter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/gokit"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/httpmw"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// The HTTP middleware and go-kit adapter have moved to the httpmw and gokit
+// packages, and the gRPC interceptors to the grpcmw package, so that the
+// formatter may be imported without their dependencies. The names below are
+// kept for one release, and link go-kit, httpsnoop, chi and gorilla/mux into
+// the root package until they are removed.
+
+// MiddlewareOption configures the logging middleware.
+//
+// Deprecated: use httpmw.MiddlewareOption or grpcmw.MiddlewareOption.
+type MiddlewareOption = middleware.Option
+
+// Logging filters
+type (
+	// Deprecated: use grpcmw.FilterRPC.
+	FilterRPC = middleware.FilterRPC
+	// Deprecated: use httpmw.FilterHTTP.
+	FilterHTTP = middleware.FilterHTTP
+
+	// ErrorHandler should return true if the error provided has already been logged
+	//
+	// Deprecated: use grpcmw.ErrorHandler.
+	ErrorHandler = middleware.ErrorHandler
+)
+
+// RoutePattern extracts the route template matched for a request.
+//
+// Deprecated: use httpmw.RoutePattern.
+type RoutePattern = httpmw.RoutePattern
+
+// RemoteIPStrategy determines the client IP of an HTTP request.
+//
+// Deprecated: use httpmw.RemoteIPStrategy.
+type RemoteIPStrategy = httpmw.RemoteIPStrategy
+
+// LogrusGoKitLogger is a gokit-compatible wrapper for logrus.LogrusGoKitLogger
+//
+// Deprecated: use gokit.Logger.
+type LogrusGoKitLogger = gokit.Logger
+
+// WithRPCFilter provides a filter to the logging middleware that determines
+// whether or not to log individual messages
+//
+// Deprecated: use grpcmw.WithRPCFilter.
+func WithRPCFilter(f FilterRPC) MiddlewareOption {
+	return middleware.WithRPCFilter(f)
+}
+
+// WithHTTPFilter provides a filter to the logging middleware that determines
+// whether or not to log individual messages
+//
+// Deprecated: use httpmw.WithHTTPFilter.
+func WithHTTPFilter(f FilterHTTP) MiddlewareOption {
+	return middleware.WithHTTPFilter(f)
+}
+
+// WithErrorHandler provides an opportunity to log or transform RPC errors.
+//
+// Deprecated: use grpcmw.WithErrorHandler.
+func WithErrorHandler(h ErrorHandler) MiddlewareOption {
+	return middleware.WithErrorHandler(h)
+}
+
+// WithHealthCheckSummary counts gRPC health checks dropped by the RPC filter
+// and logs a single summary of them every interval.
+//
+// Deprecated: use grpcmw.WithHealthCheckSummary.
+func WithHealthCheckSummary(interval time.Duration) MiddlewareOption {
+	return middleware.WithHealthCheckSummary(interval)
+}
+
+// WithRoutePattern records the route template matched for an HTTP request.
+//
+// Deprecated: use httpmw.WithRoutePattern.
+func WithRoutePattern(f RoutePattern) MiddlewareOption {
+	return middleware.WithRoutePattern(f)
+}
+
+// WithRemoteIPStrategy configures how the client IP of an HTTP request is
+// determined.
+//
+// Deprecated: use httpmw.WithRemoteIPStrategy.
+func WithRemoteIPStrategy(strategy RemoteIPStrategy) MiddlewareOption {
+	return middleware.WithRemoteIPStrategy(strategy)
+}
+
+// WithRequestMetrics records counts of the requests logged by status class.
+//
+// Deprecated: use httpmw.WithRequestMetrics or grpcmw.WithRequestMetrics.
+func WithRequestMetrics(m RequestMetricsRecorder) MiddlewareOption {
+	return middleware.WithRequestMetrics(m)
+}
+
+// DefaultFilterRPC filters gRPC standard health check and gRPC reflection requests.
+//
+// Deprecated: use grpcmw.DefaultFilterRPC.
+func DefaultFilterRPC(ctx context.Context, fullMethod string, err error) bool {
+	return middleware.DefaultFilterRPC(ctx, fullMethod, err)
+}
+
+// DefaultFilterHTTP filters health checks and monitoring canaries.
+//
+// Deprecated: use httpmw.DefaultFilterHTTP.
+func DefaultFilterHTTP(r *http.Request) bool {
+	return middleware.DefaultFilterHTTP(r)
+}
+
+// DefaultErrorHandler does nothing.
+//
+// Deprecated: use grpcmw.DefaultErrorHandler.
+func DefaultErrorHandler(ctx context.Context, err error, method string) (handled bool) {
+	return middleware.DefaultErrorHandler(ctx, err, method)
+}
+
+// LoggingMiddleware proivdes a request-scoped log entry into context for HTTP
+// requests, writes request logs in a structured format to stackdriver.
+//
+// Deprecated: use httpmw.LoggingMiddleware.
+func LoggingMiddleware(
+	log *logrus.Logger,
+	opts ...MiddlewareOption,
+) func(http.Handler) http.Handler {
+	return httpmw.LoggingMiddleware(log, opts...)
+}
+
+// RecoveryMiddleware recovers from panics in the HTTP handler chain, logging
+// an error for Error Reporting.
+//
+// Deprecated: use httpmw.RecoveryMiddleware.
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return httpmw.RecoveryMiddleware(next)
+}
+
+// ChiRoutePattern extracts the route pattern matched by a chi router.
+//
+// Deprecated: use httpmw.ChiRoutePattern.
+func ChiRoutePattern(r *http.Request) string {
+	return httpmw.ChiRoutePattern(r)
+}
+
+// GorillaMuxRoutePattern extracts the path template matched by a gorilla/mux
+// router.
+//
+// Deprecated: use httpmw.GorillaMuxRoutePattern.
+func GorillaMuxRoutePattern(r *http.Request) string {
+	return httpmw.GorillaMuxRoutePattern(r)
+}
+
+// ServeMuxRoutePattern extracts the path of the pattern matched by a Go 1.22+
+// http.ServeMux.
+//
+// Deprecated: use httpmw.ServeMuxRoutePattern.
+func ServeMuxRoutePattern(r *http.Request) string {
+	return httpmw.ServeMuxRoutePattern(r)
+}
+
+// GCPLoadBalancer picks the client IP as appended to X-Forwarded-For by a GCP
+// HTTP(S) load balancer, falling back to the peer IP.
+//
+// Deprecated: use httpmw.GCPLoadBalancer.
+func GCPLoadBalancer(r *http.Request) string {
+	return httpmw.GCPLoadBalancer(r)
+}
+
+// PeerOnly ignores X-Forwarded-For, and uses the peer IP of the connection.
+//
+// Deprecated: use httpmw.PeerOnly.
+func PeerOnly(r *http.Request) string {
+	return httpmw.PeerOnly(r)
+}
+
+// RightmostTrusted walks X-Forwarded-For from the right, skipping addresses
+// within the trusted proxy ranges, and picks the first untrusted address.
+//
+// Deprecated: use httpmw.RightmostTrusted.
+func RightmostTrusted(trustedCIDRs []netip.Prefix) RemoteIPStrategy {
+	return httpmw.RightmostTrusted(trustedCIDRs)
+}
+
+// NewLogrusGoKitLogger creates a gokit-compatible logger
+//
+// Deprecated: use gokit.NewLogger.
+func NewLogrusGoKitLogger(
+	logger interface {
+		WithFields(fields logrus.Fields) *logrus.Entry
+	},
+) *LogrusGoKitLogger {
+	return gokit.NewLogger(logger)
+}
+
+// InitLogrusGoKitLogger initializes a go kit logger to send things to stackdriver.
+//
+// Deprecated: use gokit.NewLogger with InitLogging.
+func InitLogrusGoKitLogger(w io.Writer, opts ...Option) *LogrusGoKitLogger {
+	return gokit.NewLogger(InitLogging(w, opts...))
+}
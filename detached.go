@@ -0,0 +1,48 @@
+package logadapter
+
+import (
+	"context"
+	"time"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+)
+
+// detachedContext keeps the values of its parent, but is never cancelled
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}                   { return nil }
+func (detachedContext) Err() error                              { return nil }
+
+func (d detachedContext) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
+
+// DetachedContext returns a context for background work spawned from a
+// request, which outlives the request. It keeps the values of ctx, such as the
+// span context, and a copy of the request-scoped log entry with the fields
+// added so far, but drops its deadline and cancellation.
+func DetachedContext(ctx context.Context) context.Context {
+	// panics in background work are not the failure of the request
+	detached := middleware.WithoutPanicRecord(detachedContext{ctx})
+	// copy the log entry, so fields added by either side are not shared
+	return ctxlogrus.ToContext(detached, ctxlogrus.Extract(ctx))
+}
+
+// Go runs f in a goroutine with a detached context of ctx. A panic in f is
+// logged as an error with its stack trace, rather than crashing the program.
+func Go(ctx context.Context, f func(ctx context.Context)) {
+	ctx = DetachedContext(ctx)
+	go func() {
+		defer func() {
+			if e := recover(); e != nil {
+				middleware.LogPanic(ctx, middleware.PanicError(e), nil)
+			}
+		}()
+
+		f(ctx)
+	}()
+}
@@ -0,0 +1,59 @@
+package logadapter_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chanWriter sends each write on a channel
+type chanWriter chan []byte
+
+func (c chanWriter) Write(p []byte) (int, error) {
+	c <- append([]byte(nil), p...)
+	return len(p), nil
+}
+
+func TestGoRecoversPanic(t *testing.T) {
+	out := make(chanWriter, 1)
+	logger := logrus.New()
+	logger.Out = out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	ctx, cancel := context.WithCancel(logadapter.WithLogger(context.Background(), logger))
+	cancel()
+
+	var ctxErr error
+	logadapter.Go(ctx, func(ctx context.Context) {
+		ctxErr = ctx.Err()
+		panic("background panic")
+	})
+
+	var b []byte
+	select {
+	case b = <-out:
+	case <-time.After(5 * time.Second):
+		t.Fatal("panic was not logged")
+	}
+
+	assert.NoError(t, ctxErr, "detached context is not cancelled")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, "ERROR", got["severity"])
+	assert.True(t,
+		strings.HasPrefix(got["message"].(string),
+			"panic handling request: background panic\nbackground panic\n"+
+				"panic: background panic\n\ngoroutine "),
+		"panic is logged with its stack trace")
+}
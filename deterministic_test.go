@@ -0,0 +1,78 @@
+package logadapter_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/fastjson"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// shuffledFields returns fields with keys inserted in an order varying
+// with the seed, nested maps included
+func shuffledFields(seed int64) logrus.Fields {
+	r := rand.New(rand.NewSource(seed))
+	nested := make(map[string]interface{})
+	for _, i := range r.Perm(8) {
+		nested[fmt.Sprintf("nested%d", i)] = i
+	}
+	data := logrus.Fields{}
+	for _, i := range r.Perm(16) {
+		data[fmt.Sprintf("key%02d", i)] = fmt.Sprintf("value%d", i)
+	}
+	data["nested"] = nested
+	data["fields"] = logrus.Fields{"b": 2, "a": 1, "c": []interface{}{nested}}
+	return data
+}
+
+// shuffledLabels returns labels inserted in an order varying with the seed
+func shuffledLabels(seed int64) map[string]string {
+	r := rand.New(rand.NewSource(seed))
+	labels := make(map[string]string)
+	for _, i := range r.Perm(8) {
+		labels[fmt.Sprintf("label%d", i)] = fmt.Sprint(i)
+	}
+	return labels
+}
+
+func TestDeterministicOutput(t *testing.T) {
+	for _, tcase := range []struct {
+		name string
+		opts []logadapter.Option
+	}{
+		{name: "encoding/json"},
+		{name: "fastjson", opts: []logadapter.Option{logadapter.WithEncoder(fastjson.New())}},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var want string
+			for seed := int64(0); seed < 100; seed++ {
+				opts := append([]logadapter.Option{
+					logadapter.WithProjectID(logtest.ProjectID),
+					logadapter.WithService(logtest.Service),
+					logadapter.WithSkipTimestamp(),
+					logadapter.WithGlobalTraceID(logtest.GlobalTraceID),
+					logadapter.WithTargetPlatform(logadapter.PlatformAgentless),
+					logadapter.WithResource("k8s_container", shuffledLabels(seed)),
+					logadapter.WithAlertDefaults(shuffledLabels(seed + 1)),
+				}, tcase.opts...)
+				f := logadapter.NewFormatter(opts...)
+
+				e := logrus.NewEntry(logrus.New()).WithFields(shuffledFields(seed))
+				e.Level = logrus.FatalLevel
+				e.Message = "payment failed"
+				b, err := f.Format(e)
+				require.NoError(t, err)
+				require.NoError(t, logadapter.ValidateEntry(b))
+				if seed == 0 {
+					want = string(b)
+					continue
+				}
+				require.Equal(t, want, string(b), "seed %d", seed)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package logadapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/requestlog"
+	"github.com/sirupsen/logrus"
+)
+
+// EnvLogFormat is the environment variable read by AutoFormatter, either
+// "development" or "json".
+const EnvLogFormat = "LOG_FORMAT"
+
+// devTimeFormat is the layout of the time of entries in development
+const devTimeFormat = "15:04:05.000"
+
+// devTraceLength is the number of characters of trace IDs in development
+const devTraceLength = 8
+
+// ANSI colors of severities
+const (
+	colorRed    = 31
+	colorYellow = 33
+	colorCyan   = 36
+	colorGray   = 37
+)
+
+// DevelopmentFormatter renders entries on a single line for reading logs
+// locally, with the time, severity, message and fields of entries, and
+// their stack traces indented below. Entries are built by the same pipeline
+// as the Formatter, so its enrichment runs in development too.
+type DevelopmentFormatter struct {
+	*Formatter
+	// DisableColors renders entries without ANSI colors
+	DisableColors bool
+}
+
+// NewDevelopmentFormatter returns a new DevelopmentFormatter.
+func NewDevelopmentFormatter(options ...Option) *DevelopmentFormatter {
+	return &DevelopmentFormatter{Formatter: NewFormatter(options...)}
+}
+
+// AutoFormatter returns a DevelopmentFormatter when LOG_FORMAT is
+// "development", or when it is unset and stdout is a terminal, and
+// otherwise a Formatter.
+func AutoFormatter(options ...Option) logrus.Formatter {
+	switch os.Getenv(EnvLogFormat) {
+	case "development", "dev", "text":
+		return NewDevelopmentFormatter(options...)
+	case "":
+		if isTerminal(os.Stdout) {
+			return NewDevelopmentFormatter(options...)
+		}
+	}
+	return NewFormatter(options...)
+}
+
+// isTerminal reports whether the file is a terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Format renders a log entry for development.
+func (f *DevelopmentFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	ee, _ := f.ToEntry(e)
+	color := severityColor(ee.Severity)
+
+	var b bytes.Buffer
+	if !f.SkipTimestamp {
+		t := e.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+		b.WriteString(t.Format(devTimeFormat))
+		b.WriteByte(' ')
+	}
+	b.WriteString(f.colorize(color, fmt.Sprintf("%-7s", ee.Severity)))
+
+	lines := strings.Split(ee.Message, "\n")
+	b.WriteByte(' ')
+	b.WriteString(lines[0])
+
+	if ee.Context != nil {
+		keys := make([]string, 0, len(ee.Context.Data))
+		for k := range ee.Context.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			f.writeField(&b, color, k, devValue(ee.Context.Data[k]))
+		}
+		if ee.Context.User != "" {
+			f.writeField(&b, color, KeyUser, devValue(ee.Context.User))
+		}
+		if req := ee.Context.GRPCRequest; req != nil {
+			f.writeField(&b, color, KeyGRPCRequest, devValue(req.Method))
+		}
+		// the context has the request trimmed for Error Reporting
+		if req := entryHTTPRequest(e); req != nil && ee.HTTPRequest == nil {
+			f.writeField(&b, color, KeyHTTPRequest, devValue(httpSummary(req)))
+		}
+	}
+	if ee.HTTPRequest != nil {
+		f.writeField(&b, color, KeyHTTPRequest, devValue(httpSummary(ee.HTTPRequest)))
+	}
+	if ee.Trace != "" {
+		f.writeField(&b, color, KeyTrace, shortTrace(ee.Trace))
+	}
+	b.WriteByte('\n')
+
+	// the stack trace in the payload repeats the message
+	more := lines[1:]
+	if stack := strings.TrimPrefix(ee.StackTrace, ee.Message); stack != "" {
+		more = append(more, strings.Split(strings.TrimPrefix(stack, "\n"), "\n")...)
+	}
+	for _, line := range more {
+		b.WriteString("    ")
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), nil
+}
+
+// writeField renders a field of an entry
+func (f *DevelopmentFormatter) writeField(b *bytes.Buffer, color int, key, value string) {
+	b.WriteByte(' ')
+	b.WriteString(f.colorize(color, key))
+	b.WriteByte('=')
+	b.WriteString(value)
+}
+
+// colorize wraps s in an ANSI color, unless colors are disabled
+func (f *DevelopmentFormatter) colorize(color int, s string) string {
+	if f.DisableColors {
+		return s
+	}
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, s)
+}
+
+// severityColor returns the ANSI color of a severity
+func severityColor(s Severity) int {
+	switch s {
+	case SeverityDebug:
+		return colorGray
+	case SeverityInfo:
+		return colorCyan
+	case SeverityWarning:
+		return colorYellow
+	default:
+		return colorRed
+	}
+}
+
+// devValue renders the value of a field, quoting strings only as needed
+func devValue(v interface{}) string {
+	s, ok := v.(string)
+	if !ok {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	}
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// entryHTTPRequest returns the request details of the fields of an entry,
+// those of the logging middleware taking precedence
+func entryHTTPRequest(e *logrus.Entry) *HTTPRequest {
+	if req, ok := e.Data[requestlog.KeyHTTPRequest].(*HTTPRequest); ok {
+		return req
+	}
+	req, _ := e.Data[KeyHTTPRequest].(*HTTPRequest)
+	return req
+}
+
+// httpSummary summarizes a request like "GET /path 200 12ms"
+func httpSummary(req *HTTPRequest) string {
+	path := req.RequestURL
+	if u, err := url.Parse(path); err == nil && u.Path != "" {
+		path = u.Path
+	}
+	parts := []string{req.RequestMethod, path, req.Status}
+	if d, err := time.ParseDuration(req.Latency); err == nil {
+		if d >= time.Millisecond {
+			d = d.Round(time.Millisecond)
+		} else {
+			d = d.Round(time.Microsecond)
+		}
+		parts = append(parts, d.String())
+	}
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
+
+// shortTrace returns the leading characters of the ID of a trace name
+func shortTrace(trace string) string {
+	id := trace[strings.LastIndex(trace, "/")+1:]
+	if len(id) > devTraceLength {
+		id = id[:devTraceLength]
+	}
+	return id
+}
@@ -0,0 +1,108 @@
+package logadapter_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevelopmentFormatter(t *testing.T) {
+	at := time.Date(2021, 6, 1, 14, 3, 7, 250e6, time.Local)
+	for _, tcase := range []struct {
+		name  string
+		opts  []logadapter.Option
+		level logrus.Level
+		data  logrus.Fields
+		msg   string
+		want  string
+	}{
+		{
+			name:  "fields",
+			level: logrus.InfoLevel,
+			data: logrus.Fields{
+				"orderID":  "ord-42",
+				"items":    3,
+				"customer": "Jane Doe",
+				"tags":     []string{"gift"},
+			},
+			msg: "order placed",
+			want: "14:03:07.250 INFO    order placed customer=\"Jane Doe\" items=3 " +
+				"orderID=ord-42 tags=[\"gift\"]\n",
+		},
+		{
+			name:  "trace",
+			opts:  []logadapter.Option{logadapter.WithProjectID("test-project")},
+			level: logrus.WarnLevel,
+			data:  logrus.Fields{logadapter.KeySpanContext: SpanContext},
+			msg:   "retrying payment",
+			want:  "14:03:07.250 WARNING retrying payment trace=105445aa\n",
+		},
+		{
+			name:  "httpRequest",
+			level: logrus.InfoLevel,
+			data: logrus.Fields{logadapter.KeyHTTPRequest: &logadapter.HTTPRequest{
+				RequestMethod: "GET",
+				RequestURL:    "/orders/42?full=true",
+				Status:        "200",
+				Latency:       "0.012345s",
+			}},
+			msg:  "served order",
+			want: "14:03:07.250 INFO    served order httpRequest=\"GET /orders/42 200 12ms\"\n",
+		},
+		{
+			name:  "stack trace",
+			opts:  []logadapter.Option{logadapter.WithSkipTimestamp()},
+			level: logrus.ErrorLevel,
+			data: logrus.Fields{
+				logrus.ErrorKey:          errors.New("connection refused"),
+				logadapter.KeyStackTrace: "goroutine 1 [running]:\nmain.main()",
+			},
+			msg: "payment failed",
+			want: "ERROR   payment failed error=\"connection refused\"\n" +
+				"    connection refused\n" +
+				"    goroutine 1 [running]:\n" +
+				"    main.main()\n",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			f := logadapter.NewDevelopmentFormatter(tcase.opts...)
+			f.DisableColors = true
+
+			e := logrus.NewEntry(logrus.New()).WithFields(tcase.data).WithTime(at)
+			e.Level = tcase.level
+			e.Message = tcase.msg
+			got, err := f.Format(e)
+			require.NoError(t, err)
+			assert.Equal(t, tcase.want, string(got))
+		})
+	}
+}
+
+func TestDevelopmentFormatterColors(t *testing.T) {
+	f := logadapter.NewDevelopmentFormatter(logadapter.WithSkipTimestamp())
+
+	e := logrus.NewEntry(logrus.New()).WithField("orderID", "ord-42")
+	e.Level = logrus.WarnLevel
+	e.Message = "retrying payment"
+	got, err := f.Format(e)
+	require.NoError(t, err)
+	assert.Equal(t,
+		"\x1b[33mWARNING\x1b[0m retrying payment \x1b[33morderID\x1b[0m=ord-42\n",
+		string(got))
+}
+
+func TestAutoFormatter(t *testing.T) {
+	defer os.Unsetenv(logadapter.EnvLogFormat)
+
+	os.Setenv(logadapter.EnvLogFormat, "development")
+	assert.IsType(t, &logadapter.DevelopmentFormatter{}, logadapter.AutoFormatter())
+
+	os.Setenv(logadapter.EnvLogFormat, "json")
+	assert.IsType(t, &logadapter.Formatter{}, logadapter.AutoFormatter())
+}
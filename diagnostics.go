@@ -0,0 +1,233 @@
+package logadapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// PingMessage is the message of the DEBUG entry written by
+// DiagnosticsHandler.Ping
+const PingMessage = "logging pipeline ping"
+
+// KeyPing marks the entries written by DiagnosticsHandler.Ping.
+const KeyPing = "ping"
+
+// pingTimeout bounds the flush of the entry written by a ping from the
+// diagnostics endpoint
+const pingTimeout = 5 * time.Second
+
+// formatError records the last error formatting an entry
+type formatError struct {
+	sync.Mutex
+	err string
+	at  time.Time
+}
+
+// countFormatted counts an entry formatted, or the error formatting it
+func (f *Formatter) countFormatted(err error) {
+	if err == nil {
+		atomic.AddUint64(&f.formatted, 1)
+		return
+	}
+	atomic.AddUint64(&f.formatErrors, 1)
+	f.lastFormatError.Lock()
+	f.lastFormatError.err, f.lastFormatError.at = err.Error(), time.Now()
+	f.lastFormatError.Unlock()
+}
+
+// DiagnosticsReport describes the state of the logging pipeline of a logger,
+// to tell whether entries fail to be formatted, fail to be written, or are
+// dropped before reaching the logging agent.
+type DiagnosticsReport struct {
+	// EntriesFormatted and FormatErrors are counted since the Formatter of
+	// the logger was created, if it is one
+	EntriesFormatted  uint64     `json:"entriesFormatted"`
+	FormatErrors      uint64     `json:"formatErrors"`
+	LastFormatError   string     `json:"lastFormatError,omitempty"`
+	LastFormatErrorAt *time.Time `json:"lastFormatErrorAt,omitempty"`
+	// Writer is reported if the logger writes to a CountingWriter
+	Writer *WriterStats `json:"writer,omitempty"`
+	// Async is reported if the logger writes to an AsyncWriter
+	Async *AsyncStats `json:"async,omitempty"`
+	// Configuration is that of the Formatter of the logger, if it is one
+	Configuration *FormatterOptions `json:"configuration,omitempty"`
+	// Ping is the outcome of a ping, if requested
+	Ping *PingResult `json:"ping,omitempty"`
+}
+
+// AsyncStats is a snapshot of the queue of an AsyncWriter.
+type AsyncStats struct {
+	Queued  int    `json:"queued"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// PingResult is the outcome of DiagnosticsHandler.Ping.
+type PingResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// DiagnosticsHandler serves a DiagnosticsReport of a logger as JSON.
+type DiagnosticsHandler struct {
+	logger *logrus.Logger
+}
+
+// Diagnostics returns a handler serving a DiagnosticsReport of the logger as
+// JSON, such as on an internal health endpoint. With the ping query
+// parameter, such as /debug/logging?ping=1, it also pings the logger.
+func Diagnostics(logger *logrus.Logger) *DiagnosticsHandler {
+	return &DiagnosticsHandler{logger: logger}
+}
+
+// Report returns the current state of the logging pipeline of the logger.
+func (d *DiagnosticsHandler) Report() DiagnosticsReport {
+	var r DiagnosticsReport
+	if f, ok := d.logger.Formatter.(*Formatter); ok {
+		r.EntriesFormatted = atomic.LoadUint64(&f.formatted)
+		r.FormatErrors = atomic.LoadUint64(&f.formatErrors)
+		f.lastFormatError.Lock()
+		if f.lastFormatError.err != "" {
+			at := f.lastFormatError.at
+			r.LastFormatError, r.LastFormatErrorAt = f.lastFormatError.err, &at
+		}
+		f.lastFormatError.Unlock()
+		options := f.Options()
+		r.Configuration = &options
+	}
+
+	// the writers may wrap one another, in either order
+	for w, i := d.logger.Out, 0; w != nil && i < 2; i++ {
+		switch v := w.(type) {
+		case *CountingWriter:
+			stats := v.Stats()
+			r.Writer = &stats
+			w = v.w
+		case *AsyncWriter:
+			r.Async = &AsyncStats{Queued: v.Queued(), Dropped: v.Dropped()}
+			w = v.w
+		default:
+			w = nil
+		}
+	}
+	return r
+}
+
+// asyncWriterOf returns the AsyncWriter an output is or writes to, if any
+func asyncWriterOf(w io.Writer) *AsyncWriter {
+	if c, ok := w.(*CountingWriter); ok {
+		w = c.w
+	}
+	a, _ := w.(*AsyncWriter)
+	return a
+}
+
+// Ping formats a DEBUG entry with PingMessage and writes it to the output of
+// the logger, whatever its level, then flushes the output if it can be, such
+// as an AsyncWriter. It returns the error formatting, writing or flushing the
+// entry, if any, or if an AsyncWriter dropped entries meanwhile.
+//
+// The entry is written without the lock of the logger, so only to an output
+// safe for concurrent writes: an *os.File, AsyncWriter, CountingWriter or
+// ResilientWriter. Any other output is written through the logger instead,
+// at INFO if DEBUG isn't enabled, and errors writing to it aren't returned.
+func (d *DiagnosticsHandler) Ping(ctx context.Context) error {
+	if !concurrencySafe(d.logger.Out) {
+		return d.pingThroughLogger(ctx)
+	}
+	e := logrus.NewEntry(d.logger)
+	e.Time = time.Now()
+	e.Level = logrus.DebugLevel
+	e.Message = PingMessage
+	e.Data[KeyPing] = true
+	e.Context = ctx
+
+	b, err := d.logger.Formatter.Format(e)
+	if err != nil {
+		return fmt.Errorf("logadapter: formatting ping: %w", err)
+	}
+	async := asyncWriterOf(d.logger.Out)
+	var dropped uint64
+	if async != nil {
+		dropped = async.Dropped()
+	}
+	if _, err := d.logger.Out.Write(b); err != nil {
+		return fmt.Errorf("logadapter: writing ping: %w", err)
+	}
+	if async != nil && async.Dropped() > dropped {
+		return errors.New("logadapter: ping dropped by a full AsyncWriter")
+	}
+	if f, ok := d.logger.Out.(Flusher); ok {
+		if err := f.Flush(ctx); err != nil {
+			return fmt.Errorf("logadapter: flushing ping: %w", err)
+		}
+	}
+	return nil
+}
+
+// pingThroughLogger logs the ping, holding the lock of the logger, to an
+// output that may not be safe for concurrent writes
+func (d *DiagnosticsHandler) pingThroughLogger(ctx context.Context) error {
+	level := logrus.DebugLevel
+	if !d.logger.IsLevelEnabled(level) {
+		level = logrus.InfoLevel
+	}
+	if !d.logger.IsLevelEnabled(level) {
+		return fmt.Errorf(
+			"logadapter: can't ping an output unsafe for concurrent writes at level %s",
+			d.logger.GetLevel())
+	}
+	d.logger.WithContext(ctx).WithField(KeyPing, true).Log(level, PingMessage)
+	if f, ok := d.logger.Out.(Flusher); ok {
+		if err := f.Flush(ctx); err != nil {
+			return fmt.Errorf("logadapter: flushing ping: %w", err)
+		}
+	}
+	return nil
+}
+
+// concurrencySafe reports whether an output is known to be safe for
+// concurrent writes
+func concurrencySafe(w io.Writer) bool {
+	switch w.(type) {
+	case *os.File, *AsyncWriter, *CountingWriter, *ResilientWriter:
+		return true
+	}
+	return w == ioutil.Discard
+}
+
+// ServeHTTP serves the report of the logger as JSON.
+func (d *DiagnosticsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var ping *PingResult
+	if r.URL.Query().Get("ping") != "" {
+		ctx, cancel := context.WithTimeout(r.Context(), pingTimeout)
+		ping = &PingResult{OK: true}
+		if err := d.Ping(ctx); err != nil {
+			ping = &PingResult{Error: err.Error()}
+		}
+		cancel()
+	}
+
+	report := d.Report()
+	report.Ping = ping
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if ping != nil && !ping.OK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_, _ = w.Write(append(b, '\n'))
+}
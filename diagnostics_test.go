@@ -0,0 +1,178 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingEncoder fails to encode entries with a message
+type failingEncoder struct {
+	message string
+}
+
+func (f failingEncoder) Encode(e *logadapter.Entry, buf []byte) ([]byte, error) {
+	if e.Message == f.message {
+		return nil, errors.New("unsupported value")
+	}
+	return logadapter.JSONEncoder{}.Encode(e, buf)
+}
+
+func diagnose(t *testing.T, h http.Handler, target string) (int, logadapter.DiagnosticsReport) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var report logadapter.DiagnosticsReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	return rec.Code, report
+}
+
+func TestDiagnostics(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = logadapter.NewCountingWriter(&out)
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithService("checkout"),
+		logadapter.WithEncoder(failingEncoder{message: "unencodable"}),
+	)
+	before := time.Now()
+
+	logger.Info("order placed")
+	logger.Warn("stock low")
+	logger.Info("unencodable")
+	logger.Info("order shipped")
+
+	h := logadapter.Diagnostics(logger)
+	code, report := diagnose(t, h, "/debug/logging")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, uint64(3), report.EntriesFormatted)
+	assert.Equal(t, uint64(1), report.FormatErrors)
+	assert.Equal(t, "unsupported value", report.LastFormatError)
+	require.NotNil(t, report.LastFormatErrorAt)
+	assert.False(t, report.LastFormatErrorAt.Before(before))
+
+	require.NotNil(t, report.Writer)
+	assert.Equal(t, uint64(3), report.Writer.Writes, "entries failing to format aren't written")
+	assert.Equal(t, uint64(out.Len()), report.Writer.Bytes)
+	assert.Zero(t, report.Writer.Errors)
+	require.NotNil(t, report.Writer.LastWrite)
+	assert.False(t, report.Writer.LastWrite.Before(before))
+	assert.Nil(t, report.Async)
+	require.NotNil(t, report.Configuration)
+	assert.Equal(t, "checkout", report.Configuration.Service)
+	assert.Nil(t, report.Ping)
+
+	out.Reset()
+	code, report = diagnose(t, h, "/debug/logging?ping=1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, &logadapter.PingResult{OK: true}, report.Ping)
+	assert.Equal(t, uint64(4), report.Writer.Writes, "pings are written whatever the level")
+	assert.Contains(t, out.String(), `"severity":"DEBUG"`)
+	assert.Contains(t, out.String(), logadapter.PingMessage)
+}
+
+func TestDiagnosticsPingFailure(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = logadapter.NewCountingWriter(failingWriter{})
+	logger.Formatter = logadapter.NewFormatter(logadapter.WithProjectID("test-project"))
+	logger.Info("order placed")
+
+	h := logadapter.Diagnostics(logger)
+	err := h.Ping(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "disk full")
+
+	code, report := diagnose(t, h, "/debug/logging?ping=1")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	require.NotNil(t, report.Ping)
+	assert.False(t, report.Ping.OK)
+	assert.Contains(t, report.Ping.Error, "disk full")
+	assert.Equal(t, uint64(3), report.Writer.Errors)
+	assert.Zero(t, report.Writer.Writes)
+	assert.Nil(t, report.Writer.LastWrite)
+	assert.Equal(t, "disk full", report.Writer.LastError)
+}
+
+func TestDiagnosticsPingUnsafeOutput(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(logadapter.WithProjectID("test-project"))
+	h := logadapter.Diagnostics(logger)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logger.Info("order placed")
+		}()
+	}
+	require.NoError(t, h.Ping(context.Background()))
+	wg.Wait()
+
+	var pings int
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), "entries aren't interleaved")
+		if entry["message"] != logadapter.PingMessage {
+			continue
+		}
+		pings++
+		assert.Equal(t, "INFO", entry["severity"], "written through the logger below DEBUG")
+		assert.Equal(t, map[string]interface{}{logadapter.KeyPing: true},
+			entry["context"].(map[string]interface{})["data"])
+	}
+	assert.Equal(t, 1, pings)
+
+	logger.SetLevel(logrus.WarnLevel)
+	require.Error(t, h.Ping(context.Background()), "not written below INFO")
+}
+
+func TestDiagnosticsAsyncWriter(t *testing.T) {
+	gated := newGatedWriter()
+	async := logadapter.NewAsyncWriter(logadapter.NewCountingWriter(gated), 2)
+	defer async.Close()
+
+	logger := logrus.New()
+	logger.Out = async
+	logger.Formatter = logadapter.NewFormatter(logadapter.WithProjectID("test-project"))
+
+	logger.Info("order placed")
+	<-gated.started
+	for i := 0; i < 4; i++ {
+		logger.Info("order shipped")
+	}
+
+	_, report := diagnose(t, logadapter.Diagnostics(logger), "/")
+	assert.Equal(t, &logadapter.AsyncStats{Queued: 2, Dropped: 2}, report.Async)
+	require.NotNil(t, report.Writer, "the output of the AsyncWriter is reported")
+	assert.Zero(t, report.Writer.Writes, "the first entry is still being written")
+
+	err := logadapter.Diagnostics(logger).Ping(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ping dropped", "pings dropped by a full queue fail")
+
+	close(gated.release)
+	require.NoError(t, async.Flush(context.Background()))
+	require.NoError(t, logadapter.Diagnostics(logger).Ping(context.Background()))
+	_, report = diagnose(t, logadapter.Diagnostics(logger), "/")
+	assert.Equal(t, 0, report.Async.Queued)
+	assert.Equal(t, uint64(5), report.Writer.Writes,
+		"the entries queued, a summary of those dropped and the ping are written")
+	assert.Contains(t, strings.Join(gated.lines(), "\n"), logadapter.PingMessage)
+}
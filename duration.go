@@ -0,0 +1,110 @@
+package logadapter
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Known keys of durations
+const (
+	KeyDuration   = "duration"
+	KeyDurationMs = "durationMs"
+)
+
+// DurationFormat is how durations in the data of entries are rendered
+type DurationFormat int
+
+const (
+	// DurationSeconds renders durations as seconds strings, such as
+	// "0.123456789s", as GCP renders them
+	DurationSeconds DurationFormat = iota
+	// DurationMillisString renders durations as milliseconds strings, such
+	// as "123.456789ms"
+	DurationMillisString
+	// DurationNanosInt renders durations as integer nanoseconds, as
+	// encoding/json does
+	DurationNanosInt
+)
+
+// formatDurations renders the durations of data and of its nested maps and
+// slices, which must already be copied from the entry, and adds the duration
+// in milliseconds if configured.
+func (f *Formatter) formatDurations(data logrus.Fields) {
+	if f.DurationMillis {
+		if ms, ok := durationMillis(data[KeyDuration]); ok {
+			data[KeyDurationMs] = ms
+		}
+	}
+	if f.DurationFormat == DurationNanosInt {
+		return
+	}
+	for k, v := range data {
+		data[k] = f.formatDuration(v)
+	}
+}
+
+// formatDuration renders v if it is a duration, or the durations within it if
+// it is a map or slice
+func (f *Formatter) formatDuration(v interface{}) interface{} {
+	switch v := v.(type) {
+	case time.Duration:
+		if f.DurationFormat == DurationMillisString {
+			return strconv.FormatFloat(float64(v)/float64(time.Millisecond), 'f', -1, 64) + "ms"
+		}
+		return durationSeconds(v)
+	case logrus.Fields:
+		for k, e := range v {
+			v[k] = f.formatDuration(e)
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = f.formatDuration(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = f.formatDuration(e)
+		}
+	}
+	return v
+}
+
+// durationSeconds renders d in seconds with up to nanosecond precision, without
+// the rounding of float seconds
+func durationSeconds(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+	}
+	secs, nanos := d/time.Second, d%time.Second
+	if secs < 0 {
+		secs = -secs
+	}
+	if nanos < 0 {
+		nanos = -nanos
+	}
+	if nanos == 0 {
+		return sign + strconv.FormatInt(int64(secs), 10) + "s"
+	}
+
+	frac := strconv.FormatInt(int64(nanos)+int64(time.Second), 10)[1:]
+	return sign + strconv.FormatInt(int64(secs), 10) + "." + strings.TrimRight(frac, "0") + "s"
+}
+
+// durationMillis provides the milliseconds of a duration, or of a string
+// parsed as one, such as "1.2s"
+func durationMillis(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case time.Duration:
+		return float64(v) / float64(time.Millisecond), true
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, false
+		}
+		return float64(d) / float64(time.Millisecond), true
+	}
+	return 0, false
+}
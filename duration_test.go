@@ -0,0 +1,95 @@
+package logadapter_test
+
+import (
+	"testing"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDurationFormat(t *testing.T) {
+	durations := []time.Duration{
+		0,
+		123 * time.Nanosecond,
+		123456789 * time.Nanosecond,
+		1500 * time.Millisecond,
+		-2 * time.Second,
+		90 * time.Minute,
+	}
+
+	for _, tcase := range []struct {
+		name   string
+		format logadapter.DurationFormat
+		want   []interface{}
+	}{
+		{
+			name:   "seconds",
+			format: logadapter.DurationSeconds,
+			want:   []interface{}{"0s", "0.000000123s", "0.123456789s", "1.5s", "-2s", "5400s"},
+		},
+		{
+			name:   "millis string",
+			format: logadapter.DurationMillisString,
+			want: []interface{}{
+				"0ms", "0.000123ms", "123.456789ms", "1500ms", "-2000ms", "5400000ms",
+			},
+		},
+		{
+			name:   "nanos int",
+			format: logadapter.DurationNanosInt,
+			want:   []interface{}{0, 123, 123456789, 1500000000, -2000000000, 5400000000000},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+				logadapter.WithDurationFormat(tcase.format),
+			))
+
+			for i, d := range durations {
+				logger.WithFields(logrus.Fields{
+					"duration": d,
+					"nested":   map[string]interface{}{"timings": []interface{}{d}},
+					"fields":   logrus.Fields{"elapsed": d},
+				}).Info("done")
+
+				e, ok := rec.LastEntry()
+				require.True(t, ok)
+				logtest.AssertField(t, e, "context.data.duration", tcase.want[i])
+				logtest.AssertField(t, e, "context.data.nested.timings.0", tcase.want[i])
+				logtest.AssertField(t, e, "context.data.fields.elapsed", tcase.want[i])
+				_, ok = logtest.Field(e, "context.data.durationMs")
+				require.False(t, ok)
+			}
+		})
+	}
+}
+
+func TestDurationMillis(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithDurationMillis(),
+	))
+	fields := logrus.Fields{"duration": 1234567 * time.Nanosecond}
+
+	logger.WithFields(fields).Info("done")
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	logtest.AssertField(t, e, "context.data.duration", "0.001234567s")
+	logtest.AssertField(t, e, "context.data.durationMs", 1.234567)
+
+	logger.WithField("duration", "1.2s").Info("done")
+	e, ok = rec.LastEntry()
+	require.True(t, ok)
+	logtest.AssertField(t, e, "context.data.durationMs", 1200)
+
+	logger.WithField("duration", "soon").Info("done")
+	e, ok = rec.LastEntry()
+	require.True(t, ok)
+	_, ok = logtest.Field(e, "context.data.durationMs")
+	require.False(t, ok)
+
+	// the logged entry is unchanged
+	require.Equal(t, 1234567*time.Nanosecond, fields["duration"])
+}
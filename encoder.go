@@ -0,0 +1,37 @@
+package logadapter
+
+import "encoding/json"
+
+// EntryEncoder encodes formatted entries, appending the encoding of e to buf
+// without a trailing newline. Encoders must be safe for concurrent use, and
+// write the keys of maps sorted, as encoding/json does, so that the same entry
+// is always encoded the same.
+type EntryEncoder interface {
+	Encode(e *Entry, buf []byte) ([]byte, error)
+}
+
+// JSONEncoder encodes entries with encoding/json. It is the default encoder,
+// indenting entries when the formatter is configured to PrettyPrint.
+type JSONEncoder struct {
+	PrettyPrint bool
+}
+
+// Encode appends the JSON encoding of e to buf
+func (j JSONEncoder) Encode(e *Entry, buf []byte) ([]byte, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if j.PrettyPrint {
+		b, err = json.MarshalIndent(e, "", "\t")
+	} else {
+		b, err = json.Marshal(e)
+	}
+	if err != nil {
+		return buf, err
+	}
+	if len(buf) == 0 {
+		return b, nil
+	}
+	return append(buf, b...), nil
+}
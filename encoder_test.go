@@ -0,0 +1,157 @@
+package logadapter_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/fastjson"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// comparingEncoder encodes entries with fastjson, asserting the encoding is
+// that of encoding/json
+type comparingEncoder struct {
+	t    *testing.T
+	fast *fastjson.Encoder
+}
+
+func (c comparingEncoder) Encode(e *logadapter.Entry, buf []byte) ([]byte, error) {
+	want, wantErr := logadapter.JSONEncoder{}.Encode(e, nil)
+	got, err := c.fast.Encode(e, buf)
+	assert.Equal(c.t, wantErr != nil, err != nil, "error: %v, want %v", err, wantErr)
+	assert.Equal(c.t, string(want), string(got))
+	return got, err
+}
+
+func TestFastJSONEquivalence(t *testing.T) {
+	for i := range formatterTests {
+		tt := formatterTests[i]
+		t.Run(tt.name, func(t *testing.T) {
+			logger, rec := logtest.NewRecorder(
+				logtest.WithFormatterOptions(
+					logadapter.WithVersion("0.1"),
+					logadapter.WithSourceReference(
+						"https://github.com/StevenACoffman/test.git",
+						"v1.2.3",
+					),
+					logadapter.WithBuildInfoInErrors(),
+					logadapter.WithEncoder(comparingEncoder{t: t, fast: fastjson.New()}),
+				),
+			)
+			tt.run(logger)
+
+			_, ok := rec.LastEntry()
+			require.True(t, ok)
+			assert.Empty(t, rec.ValidationErrors(), "entries are valid")
+		})
+	}
+}
+
+func TestFastJSONEquivalenceFields(t *testing.T) {
+	enc := comparingEncoder{t: t, fast: fastjson.New()}
+	formatter := logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithService("test"),
+		logadapter.WithTargetPlatform(logadapter.PlatformAgentless),
+		logadapter.WithResource("k8s_container", map[string]string{
+			"namespace_name": "default",
+			"cluster_name":   "<prod>",
+		}),
+		logadapter.WithAlertDefaults(map[string]string{"team": "a&b", "page": "true"}),
+		logadapter.WithLegacyFieldNames(),
+		logadapter.WithEncoder(enc),
+	)
+	rec := &logtest.Recorder{}
+	logger := logrus.New()
+	logger.Out = rec
+	logger.Formatter = formatter
+
+	entry := logger.
+		WithField("escapes", "quote \" backslash \\ <html> & \n\r\t\b\f\x01 \xff").
+		WithField("unicode", "\u2028 \u2029 é 世界").
+		WithField("number", 1.5).
+		WithField(logadapter.KeyHTTPRequest, &logadapter.HTTPRequest{
+			RequestMethod: "GET",
+			RequestURL:    "/foo?a=1&b=<2>",
+			Status:        "500",
+			RemoteIP:      "192.0.2.1",
+			Referer:       "https://example.com/",
+			CacheHit:      true,
+		}).
+		WithField("grpcRequest", &logadapter.GRPCRequest{
+			Method:            "/foo.Bar/Baz",
+			Attempt:           2,
+			PeerAuthType:      "tls",
+			PeerIdentity:      "spiffe://example.org/sa/client",
+			PeerCertificateCN: "client",
+			PeerMTLS:          true,
+			Phases:            map[string]string{"handler": "0.00200s", "auth_done": "0.00100s"},
+		}).
+		WithField(logadapter.KeyPubSubRequest, map[string]interface{}{"subscription": "sub"}).
+		WithField("grpcStatus", json.RawMessage(`{ "code": 13, "message": "<internal>" }`)).
+		WithField(logadapter.KeyUser, "user@example.com").
+		WithField(logadapter.KeyOperation, &logadapter.Operation{
+			ID:       "nightly-export-x2k8p",
+			Producer: "nightly-export",
+			Last:     true,
+		})
+	assert.Panics(t, func() { entry.Panic("alert") })
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.NotNil(t, e.Resource)
+	assert.NotEmpty(t, e.Labels)
+	assert.NotEmpty(t, e.Context.GRPCStatus)
+	assert.NotNil(t, e.Context.GRPCRequest)
+	assert.Equal(t, 500, e.Context.HTTPRequest.ResponseStatusCode)
+	assert.NotNil(t, e.Operation)
+}
+
+func TestFastJSONEquivalenceEscapes(t *testing.T) {
+	// control characters are removed by the formatter, but not by encoders
+	e := &logadapter.Entry{
+		Message: "quote \" backslash \\ <html> & \n\r\t\b\f\x00\x01\x1b \xff",
+		Context: &logadapter.Context{Data: map[string]interface{}{"k\x1f": "\x7f\u2028"}},
+	}
+	comparingEncoder{t: t, fast: fastjson.New()}.Encode(e, nil)
+}
+
+func TestFastJSONEquivalenceStructuredStatus(t *testing.T) {
+	e := &logadapter.Entry{
+		Message: "order not found",
+		Context: &logadapter.Context{
+			GRPCStatus: json.RawMessage(`{"code":5}`),
+			GRPCStatusDetails: &logadapter.GRPCStatusDetails{
+				Code:     5,
+				CodeName: "NOT_FOUND",
+				Message:  "order <42> not found",
+				Details: []map[string]interface{}{
+					{"@type": "type.googleapis.com/google.rpc.ErrorInfo", "reason": "MISSING"},
+				},
+				Raw: json.RawMessage(`{ "code": 5 }`),
+			},
+			GoVersion: "go1.16",
+		},
+	}
+	got, err := comparingEncoder{t: t, fast: fastjson.New()}.Encode(e, nil)
+	require.NoError(t, err)
+	assert.Contains(t, string(got), `"grpcStatus":{"code":5,"codeName":"NOT_FOUND"`)
+}
+
+func TestFastJSONEncodeError(t *testing.T) {
+	enc := fastjson.New()
+	e := &logadapter.Entry{
+		Message: "unsupported",
+		Context: &logadapter.Context{Data: map[string]interface{}{"ch": make(chan int)}},
+	}
+
+	_, wantErr := logadapter.JSONEncoder{}.Encode(e, nil)
+	require.Error(t, wantErr)
+	b, err := enc.Encode(e, []byte("prefix"))
+	assert.Error(t, err)
+	assert.Equal(t, "prefix", string(b))
+}
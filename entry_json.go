@@ -0,0 +1,95 @@
+package logadapter
+
+import "encoding/json"
+
+// orderedEntry declares the fields of an Entry in the order they are encoded,
+// so that raw logs read severity and message first, and the context last
+type orderedEntry struct {
+	Severity             Severity           `json:"severity,omitempty"`
+	Message              string             `json:"message,omitempty"`
+	Timestamp            string             `json:"timestamp,omitempty"`
+	Time                 string             `json:"time,omitempty"`
+	Trace                string             `json:"logging.googleapis.com/trace,omitempty"`
+	SpanID               string             `json:"logging.googleapis.com/spanId,omitempty"`
+	TraceSampled         bool               `json:"logging.googleapis.com/trace_sampled,omitempty"`
+	SourceLocation       *SourceLocation    `json:"logging.googleapis.com/sourceLocation,omitempty"`
+	Labels               map[string]string  `json:"logging.googleapis.com/labels,omitempty"`
+	Operation            *Operation         `json:"logging.googleapis.com/operation,omitempty"`
+	HTTPRequest          *HTTPRequest       `json:"httpRequest,omitempty"`
+	Type                 string             `json:"@type,omitempty"`
+	LogName              string             `json:"logName,omitempty"`
+	Resource             *MonitoredResource `json:"resource,omitempty"`
+	ServiceContext       *ServiceContext    `json:"serviceContext,omitempty"`
+	StackTrace           string             `json:"stack_trace,omitempty"`
+	LegacySourceLocation *SourceLocation    `json:"sourceLocation,omitempty"`
+	LegacyMessage        string             `json:"msg,omitempty"`
+	LogSchema            string             `json:"logSchema,omitempty"`
+	Context              *orderedContext    `json:"context,omitempty"`
+}
+
+// orderedContext declares the fields of a Context as they are encoded, with
+// its GRPCStatusDetails, if any, as its grpcStatus
+type orderedContext struct {
+	Data             map[string]interface{} `json:"data,omitempty"`
+	User             string                 `json:"user,omitempty"`
+	ReportLocation   *ReportLocation        `json:"reportLocation,omitempty"`
+	HTTPRequest      *HTTPRequestContext    `json:"httpRequest,omitempty"`
+	PubSubRequest    map[string]interface{} `json:"pubSubRequest,omitempty"`
+	GRPCRequest      *GRPCRequest           `json:"grpcRequest,omitempty"`
+	GRPCStatus       interface{}            `json:"grpcStatus,omitempty"`
+	SourceReferences []SourceReference      `json:"sourceReferences,omitempty"`
+	GoVersion        string                 `json:"goVersion,omitempty"`
+	BuildSettings    map[string]string      `json:"buildSettings,omitempty"`
+}
+
+func newOrderedContext(c *Context) *orderedContext {
+	if c == nil {
+		return nil
+	}
+	oc := &orderedContext{
+		Data:             c.Data,
+		User:             c.User,
+		ReportLocation:   c.ReportLocation,
+		HTTPRequest:      c.HTTPRequest,
+		PubSubRequest:    c.PubSubRequest,
+		GRPCRequest:      c.GRPCRequest,
+		SourceReferences: c.SourceReferences,
+		GoVersion:        c.GoVersion,
+		BuildSettings:    c.BuildSettings,
+	}
+	// a nil interface is omitted, unlike a typed nil
+	if c.GRPCStatusDetails != nil {
+		oc.GRPCStatus = c.GRPCStatusDetails
+	} else if len(c.GRPCStatus) > 0 {
+		oc.GRPCStatus = c.GRPCStatus
+	}
+	return oc
+}
+
+// MarshalJSON encodes the entry with its keys in a fixed order, whatever the
+// order its fields are declared in: severity, message and timestamp, then the
+// logging.googleapis.com keys and httpRequest, with the context last.
+func (ee Entry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(orderedEntry{
+		Severity:             ee.Severity,
+		Message:              ee.Message,
+		Timestamp:            ee.Timestamp,
+		Time:                 ee.Time,
+		Trace:                ee.Trace,
+		SpanID:               ee.SpanID,
+		TraceSampled:         ee.TraceSampled,
+		SourceLocation:       ee.SourceLocation,
+		Labels:               ee.Labels,
+		Operation:            ee.Operation,
+		HTTPRequest:          ee.HTTPRequest,
+		Type:                 ee.Type,
+		LogName:              ee.LogName,
+		Resource:             ee.Resource,
+		ServiceContext:       ee.ServiceContext,
+		StackTrace:           ee.StackTrace,
+		LegacySourceLocation: ee.LegacySourceLocation,
+		LegacyMessage:        ee.LegacyMessage,
+		LogSchema:            ee.LogSchema,
+		Context:              newOrderedContext(ee.Context),
+	})
+}
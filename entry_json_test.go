@@ -0,0 +1,104 @@
+package logadapter_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/fastjson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntryKeyOrder(t *testing.T) {
+	const reportedErrorEvent = "type.googleapis.com/" +
+		"google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+	entry := logadapter.Entry{
+		Type:           reportedErrorEvent,
+		LogName:        "projects/test-project/logs/test",
+		Timestamp:      "2021-06-01T12:00:00.5Z",
+		Resource:       &logadapter.MonitoredResource{Type: "k8s_container"},
+		ServiceContext: &logadapter.ServiceContext{Service: "test", Version: "0.1"},
+		Message:        "payment failed",
+		Severity:       logadapter.SeverityError,
+		Context: &logadapter.Context{
+			Data: map[string]interface{}{"orderId": "A-1234"},
+			User: "user@example.com",
+		},
+		SourceLocation: &logadapter.SourceLocation{FilePath: "main.go", LineNumber: 12},
+		StackTrace:     "goroutine 1 [running]:",
+		Trace:          "projects/test-project/traces/105445aa7843bc8bf206b12000100000",
+		SpanID:         "0000000000000001",
+		TraceSampled:   true,
+		HTTPRequest:    &logadapter.HTTPRequest{RequestMethod: "GET", Status: "500"},
+		Labels:         map[string]string{"env": "prod"},
+		Operation:      &logadapter.Operation{ID: "job-1", First: true},
+	}
+	wantOrder := []string{
+		`"severity"`,
+		`"message"`,
+		`"timestamp"`,
+		`"logging.googleapis.com/trace"`,
+		`"logging.googleapis.com/spanId"`,
+		`"logging.googleapis.com/trace_sampled"`,
+		`"logging.googleapis.com/sourceLocation"`,
+		`"logging.googleapis.com/labels"`,
+		`"logging.googleapis.com/operation"`,
+		`"httpRequest"`,
+		`"@type"`,
+		`"context"`,
+	}
+
+	encoders := map[string]logadapter.EntryEncoder{
+		"encoding/json": logadapter.JSONEncoder{},
+		"fastjson":      fastjson.New(),
+	}
+	for name, enc := range encoders {
+		t.Run(name, func(t *testing.T) {
+			b, err := enc.Encode(&entry, nil)
+			require.NoError(t, err)
+			out := string(b)
+			assert.True(t, strings.HasPrefix(out, `{"severity":"ERROR","message":"payment failed"`),
+				out)
+
+			last := -1
+			for _, key := range wantOrder {
+				i := strings.Index(out, key+":")
+				require.NotEqual(t, -1, i, key)
+				assert.Greater(t, i, last, "%s is out of order", key)
+				last = i
+			}
+			assert.True(t, strings.HasSuffix(out, `"user":"user@example.com"}}`),
+				"the context is last")
+
+			var decoded logadapter.Entry
+			require.NoError(t, json.Unmarshal(b, &decoded))
+			assert.Equal(t, entry, decoded, "the entry is decoded as encoded")
+		})
+	}
+}
+
+// jsonKeys returns the keys of the exported fields of the struct v encoded
+// as JSON
+func jsonKeys(v interface{}) []string {
+	var keys []string
+	typ := reflect.TypeOf(v)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		key := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.PkgPath == "" && key != "-" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// TestOrderedEntryFields guards that the fields added to an Entry are
+// encoded by encoding/json too.
+func TestOrderedEntryFields(t *testing.T) {
+	assert.ElementsMatch(t, jsonKeys(logadapter.Entry{}), jsonKeys(logadapter.OrderedEntry{}))
+	assert.ElementsMatch(t, jsonKeys(logadapter.Context{}),
+		jsonKeys(logadapter.OrderedContext{}))
+}
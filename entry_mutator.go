@@ -0,0 +1,98 @@
+package logadapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// KeyMutatorError is added to the context data of an entry an EntryMutator
+// failed on, which is logged as it was before the mutators ran
+const KeyMutatorError = "mutatorError"
+
+// EntryMutator transforms an entry composed by the Formatter from a logrus
+// entry, before it is encoded. It may modify the entry and its Context, Data
+// and Labels, but should replace, rather than modify, the request details and
+// other values it points to, which are shared with the entry logged should a
+// mutator fail.
+type EntryMutator func(e *logrus.Entry, out *Entry) error
+
+// mutate runs the EntryMutators on a copy of an entry, returning the entry
+// unmodified, with the error as a field, if any of them fails
+func (f *Formatter) mutate(e *logrus.Entry, ee Entry) (Entry, error) {
+	out := cloneEntry(ee)
+	for _, m := range f.EntryMutators {
+		if err := m(e, &out); err != nil {
+			if ee.context().Data == nil {
+				ee.Context.Data = make(map[string]interface{}, 1)
+			}
+			ee.Context.Data[KeyMutatorError] = err.Error()
+			return ee, err
+		}
+	}
+	return out, nil
+}
+
+// cloneEntry copies an entry, with its labels, context and data, for them to
+// be modified
+func cloneEntry(ee Entry) Entry {
+	if ee.Labels != nil {
+		labels := make(map[string]string, len(ee.Labels))
+		for k, v := range ee.Labels {
+			labels[k] = v
+		}
+		ee.Labels = labels
+	}
+	if ee.Context != nil {
+		c := *ee.Context
+		if c.Data != nil {
+			c.Data = copyValue(c.Data).(map[string]interface{})
+		}
+		ee.Context = &c
+	}
+	if ee.ServiceContext != nil {
+		sc := *ee.ServiceContext
+		ee.ServiceContext = &sc
+	}
+	if ee.SourceLocation != nil {
+		loc := *ee.SourceLocation
+		ee.SourceLocation = &loc
+	}
+	if ee.Operation != nil {
+		op := *ee.Operation
+		ee.Operation = &op
+	}
+	return ee
+}
+
+// UppercaseLabel is an EntryMutator writing the value of a label in upper
+// case, such as for an environment label matched by case sensitive filters.
+func UppercaseLabel(key string) EntryMutator {
+	return func(_ *logrus.Entry, out *Entry) error {
+		if v, ok := out.Labels[key]; ok {
+			out.Labels[key] = strings.ToUpper(v)
+		}
+		return nil
+	}
+}
+
+// DropDataAbove is an EntryMutator dropping the context data of entries
+// whose JSON encoding is longer than maxBytes, keeping the message and other
+// fields of entries too large for the logging agent.
+func DropDataAbove(maxBytes int) EntryMutator {
+	return func(_ *logrus.Entry, out *Entry) error {
+		if out.Context == nil || len(out.Context.Data) == 0 {
+			return nil
+		}
+		b, err := json.Marshal(out.Context.Data)
+		if err != nil {
+			return fmt.Errorf("logadapter: measuring context data: %w", err)
+		}
+		if len(b) > maxBytes {
+			out.Context.Data = nil
+		}
+		return nil
+	}
+}
@@ -0,0 +1,81 @@
+package logadapter_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntryMutators(t *testing.T) {
+	setEnv := func(_ *logrus.Entry, out *logadapter.Entry) error {
+		out.Labels = map[string]string{"env": "prod"}
+		return nil
+	}
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithEntryMutator(setEnv),
+		logadapter.WithEntryMutator(logadapter.UppercaseLabel("env")),
+		logadapter.WithEntryMutator(func(e *logrus.Entry, out *logadapter.Entry) error {
+			out.Message = strings.TrimSuffix(out.Message, "\n"+e.Data["error"].(error).Error())
+			out.StackTrace = ""
+			return nil
+		}),
+	))
+
+	logger.WithError(errors.New("connection refused")).
+		WithField(logadapter.KeyTrace, "105445aa7843bc8bf206b12000100000").
+		Error("payment failed")
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"env": "PROD"}, e.Labels, "mutators run in order")
+	assert.Equal(t, "payment failed", e.Message)
+	assert.Equal(t, "projects/test-project/traces/105445aa7843bc8bf206b12000100000", e.Trace,
+		"mutators see the composed entry")
+	logtest.AssertField(t, e, "context.data.error", "connection refused")
+}
+
+func TestEntryMutatorError(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithEntryMutator(func(_ *logrus.Entry, out *logadapter.Entry) error {
+			out.Message = "half mutated"
+			out.Context.Data["orderID"] = "redacted"
+			return errors.New("redaction failed")
+		}),
+		logadapter.WithEntryMutator(func(_ *logrus.Entry, out *logadapter.Entry) error {
+			t.Error("mutators after a failed one do not run")
+			return nil
+		}),
+	))
+
+	logger.WithField("orderID", "ord-42").Info("order placed")
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok, "the entry is still logged")
+	assert.Equal(t, "order placed", e.Message)
+	logtest.AssertField(t, e, "context.data.orderID", "ord-42")
+	logtest.AssertField(t, e, "context.data."+logadapter.KeyMutatorError, "redaction failed")
+}
+
+func TestDropDataAbove(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithEntryMutator(logadapter.DropDataAbove(64)),
+	))
+
+	logger.WithField("orderID", "ord-42").Info("order placed")
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	logtest.AssertField(t, e, "context.data.orderID", "ord-42")
+
+	logger.WithField("cart", strings.Repeat("x", 64)).Info("order placed")
+	e, ok = rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, "order placed", e.Message)
+	_, found := logtest.Field(e, "context.data")
+	assert.False(t, found, "large data is dropped")
+}
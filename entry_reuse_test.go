@@ -0,0 +1,104 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestEntryReuse(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.AddHook(&logadapter.SpanHook{})
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithService("test"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x10, 0x54, 0x45, 0xaa, 0x78, 0x43, 0xbc, 0x8b},
+		SpanID:     trace.SpanID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), spanCtx)
+
+	entry := logger.WithContext(ctx).WithFields(logrus.Fields{
+		"user": map[string]interface{}{"id": "123", "roles": []interface{}{"admin"}},
+		logadapter.KeyPubSubRequest: map[string]interface{}{
+			"subscription": "projects/test-project/subscriptions/orders",
+		},
+		logadapter.KeyStackTrace: "goroutine 1 [running]:\nmain.main()",
+	}).WithError(errors.New("boom"))
+
+	entry.Warn("first")
+	entry.Error("second")
+
+	var msgs []map[string]interface{}
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var msg map[string]interface{}
+		require.NoError(t, dec.Decode(&msg))
+		msgs = append(msgs, msg)
+	}
+	require.Len(t, msgs, 2)
+	first, second := msgs[0], msgs[1]
+
+	assert.Equal(t, "WARNING", first["severity"])
+	assert.Equal(t, "ERROR", second["severity"])
+	for _, key := range []string{
+		"logging.googleapis.com/trace",
+		"logging.googleapis.com/spanId",
+		"logging.googleapis.com/trace_sampled",
+	} {
+		assert.NotEmpty(t, first[key], key)
+		assert.Equal(t, first[key], second[key], key)
+	}
+
+	firstCtx := first["context"].(map[string]interface{})
+	secondCtx := second["context"].(map[string]interface{})
+	assert.NotEmpty(t, firstCtx["pubSubRequest"])
+	assert.Equal(t, firstCtx["pubSubRequest"], secondCtx["pubSubRequest"])
+	firstData := firstCtx["data"].(map[string]interface{})
+	secondData := secondCtx["data"].(map[string]interface{})
+	assert.NotEmpty(t, firstData["user"])
+	assert.Equal(t, firstData["user"], secondData["user"])
+	assert.Equal(t, "boom", secondData["error"])
+	assert.Contains(t, second["message"], "goroutine 1 [running]:",
+		"stack trace is still reported by the second call")
+}
+
+func TestToEntryDoesNotModifyEntry(t *testing.T) {
+	f := logadapter.NewFormatter(logadapter.WithService("test"))
+
+	user := map[string]interface{}{"id": "123"}
+	e := logrus.NewEntry(logrus.New()).WithFields(logrus.Fields{
+		"user":                      user,
+		logadapter.KeyStackTrace:    "goroutine 1 [running]:\nmain.main()",
+		logadapter.KeyPubSubRequest: map[string]interface{}{"subscription": "orders"},
+	})
+	e.Level = logrus.ErrorLevel
+	e.Message = "failed"
+
+	first, err := f.ToEntry(e)
+	require.NoError(t, err)
+	first.Context.Data["user"].(map[string]interface{})["id"] = "456"
+
+	second, err := f.ToEntry(e)
+	require.NoError(t, err)
+
+	assert.Len(t, e.Data, 3, "fields of the logrus entry are kept")
+	assert.Equal(t, "123", user["id"], "nested maps are copied")
+	assert.Equal(t, first.Message, second.Message)
+	assert.Equal(t, first.Context.PubSubRequest, second.Context.PubSubRequest)
+	assert.Equal(t, "123", second.Context.Data["user"].(map[string]interface{})["id"])
+}
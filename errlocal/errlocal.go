@@ -0,0 +1,99 @@
+// Package errlocal attaches the values of variables at the site of an error
+// to it, for the formatter to report them as locals WithCapturedLocals:
+//
+//	if err := charge(ctx, orderID); err != nil {
+//		return errlocal.Wrap(err, map[string]interface{}{"orderID": orderID, "attempt": n})
+//	}
+package errlocal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+
+	pkgErrors "github.com/pkg/errors"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+)
+
+// maxDepth bounds the frames of the stacks captured
+const maxDepth = 32
+
+type stackTracer interface {
+	StackTrace() pkgErrors.StackTrace
+}
+
+type withLocals struct {
+	error
+	locals map[string]interface{}
+	// stack is nil if the error wrapped already carries a stack
+	stack pkgErrors.StackTrace
+}
+
+var _ logadapter.LocalsProvider = (*withLocals)(nil)
+
+// Wrap attaches locals to err, along with the stack of the call, unless err
+// already carries a stack, which is kept as the more precise. The locals of
+// errors it wraps are kept, and take precedence over those with the same
+// names. Wrap returns nil if err is nil.
+func Wrap(err error, locals map[string]interface{}) error {
+	if err == nil {
+		return nil
+	}
+	w := &withLocals{error: err, locals: make(map[string]interface{}, len(locals))}
+	for k, v := range locals {
+		w.locals[k] = v
+	}
+
+	var st stackTracer
+	if !errors.As(err, &st) {
+		var pcs [maxDepth]uintptr
+		n := runtime.Callers(2, pcs[:])
+		w.stack = make(pkgErrors.StackTrace, n)
+		for i, pc := range pcs[:n] {
+			w.stack[i] = pkgErrors.Frame(pc)
+		}
+	}
+	return w
+}
+
+// Locals returns the locals attached to the error, without those of the
+// errors it wraps.
+func (w *withLocals) Locals() map[string]interface{} {
+	return w.locals
+}
+
+// StackTrace returns the stack of the call to Wrap, or that of the error it
+// wraps if it carried one.
+func (w *withLocals) StackTrace() pkgErrors.StackTrace {
+	if w.stack != nil {
+		return w.stack
+	}
+	var st stackTracer
+	if errors.As(w.error, &st) {
+		return st.StackTrace()
+	}
+	return nil
+}
+
+func (w *withLocals) Unwrap() error {
+	return w.error
+}
+
+// Format formats the error as pkg/errors does, with its stack for %+v.
+func (w *withLocals) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			fmt.Fprintf(s, "%+v", w.error)
+			w.stack.Format(s, verb)
+			return
+		}
+		fallthrough
+	case 's':
+		_, _ = io.WriteString(s, w.Error())
+	case 'q':
+		fmt.Fprintf(s, "%q", w.Error())
+	}
+}
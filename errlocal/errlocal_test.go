@@ -0,0 +1,109 @@
+package errlocal_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	pkgErrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/errlocal"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+)
+
+var errDeclined = errors.New("card declined")
+
+func TestWrap(t *testing.T) {
+	assert.Nil(t, errlocal.Wrap(nil, map[string]interface{}{"orderID": "ord-42"}))
+
+	locals := map[string]interface{}{"orderID": "ord-42", "attempt": 2}
+	err := errlocal.Wrap(errDeclined, locals)
+	locals["attempt"] = 3
+
+	assert.Equal(t, "card declined", err.Error())
+	assert.True(t, errors.Is(err, errDeclined))
+	var p logadapter.LocalsProvider
+	require.True(t, errors.As(err, &p))
+	assert.Equal(t, map[string]interface{}{"orderID": "ord-42", "attempt": 2}, p.Locals(),
+		"locals are copied")
+
+	st, ok := err.(interface{ StackTrace() pkgErrors.StackTrace })
+	require.True(t, ok)
+	require.NotEmpty(t, st.StackTrace())
+	assert.Equal(t, "TestWrap", fmt.Sprintf("%n", st.StackTrace()[0]),
+		"the stack starts at the call to Wrap")
+	assert.True(t, strings.HasPrefix(fmt.Sprintf("%+v", err), "card declined\n"))
+
+	inner := pkgErrors.New("card declined")
+	err = errlocal.Wrap(inner, locals)
+	st, _ = err.(interface{ StackTrace() pkgErrors.StackTrace })
+	assert.Equal(t, inner.(interface{ StackTrace() pkgErrors.StackTrace }).StackTrace(),
+		st.StackTrace(), "the stack of the error wrapped is kept")
+}
+
+func TestCapturedLocals(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithCapturedLocals(),
+	))
+
+	err := errlocal.Wrap(errDeclined, map[string]interface{}{"orderID": "ord-42", "attempt": 2})
+	err = fmt.Errorf("placing order: %w", err)
+	err = errlocal.Wrap(err, map[string]interface{}{"attempt": 3, "cart": []string{"sku-1"}})
+	logger.WithError(err).Error("checkout failed")
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	logtest.AssertField(t, e, "context.data.locals", map[string]interface{}{
+		"orderID": "ord-42",
+		"attempt": float64(2),
+		"cart":    []interface{}{"sku-1"},
+	})
+
+	logger.WithError(err).Warn("retrying checkout")
+	e, ok = rec.LastEntry()
+	require.True(t, ok)
+	_, found := logtest.Field(e, "context.data.locals")
+	assert.False(t, found, "locals are only reported with errors")
+}
+
+func TestCapturedLocalsDisabled(t *testing.T) {
+	logger, rec := logtest.NewRecorder()
+	logger.WithError(errlocal.Wrap(errDeclined, map[string]interface{}{"orderID": "ord-42"})).
+		Error("checkout failed")
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	_, found := logtest.Field(e, "context.data.locals")
+	assert.False(t, found)
+}
+
+func TestCapturedLocalsRedacted(t *testing.T) {
+	redact := func(_ *logrus.Entry, out *logadapter.Entry) error {
+		if locals, ok := out.Context.Data[logadapter.KeyLocals].(map[string]interface{}); ok {
+			if _, ok := locals["cardNumber"]; ok {
+				locals["cardNumber"] = "[REDACTED]"
+			}
+		}
+		return nil
+	}
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithCapturedLocals(),
+		logadapter.WithEntryMutator(redact),
+	))
+
+	logger.WithError(errlocal.Wrap(errDeclined, map[string]interface{}{
+		"cardNumber": "4242424242424242",
+		"note":       "first\x1b[31m attempt",
+	})).Error("checkout failed")
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	logtest.AssertField(t, e, "context.data.locals.cardNumber", "[REDACTED]")
+	note, _ := logtest.Field(e, "context.data.locals.note")
+	assert.NotContains(t, note, "\x1b", "locals are sanitized as other data")
+}
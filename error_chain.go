@@ -0,0 +1,39 @@
+package logadapter
+
+import (
+	"errors"
+	"fmt"
+)
+
+// KeyErrorChain is added to the context data of an entry when WithErrorChain
+// is enabled and the logged error wraps other errors
+const KeyErrorChain = "errorChain"
+
+// maxErrorChain bounds the links of an error chain reported, in case of cycles
+const maxErrorChain = 20
+
+// ErrorChainLink describes an error in a wrap chain.
+type ErrorChainLink struct {
+	Message  string `json:"message"`
+	Type     string `json:"type"`
+	HasStack bool   `json:"hasStack,omitempty"`
+}
+
+// errorChain walks the errors wrapped by err with errors.Unwrap, or returns
+// nil if err does not wrap another error
+func errorChain(err error) []ErrorChainLink {
+	if errors.Unwrap(err) == nil {
+		return nil
+	}
+
+	var chain []ErrorChainLink
+	for ; err != nil && len(chain) < maxErrorChain; err = errors.Unwrap(err) {
+		_, hasStack := err.(stackTracer)
+		chain = append(chain, ErrorChainLink{
+			Message:  err.Error(),
+			Type:     fmt.Sprintf("%T", err),
+			HasStack: hasStack,
+		})
+	}
+	return chain
+}
@@ -0,0 +1,70 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorChain(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithService("test"),
+		logadapter.WithSkipTimestamp(),
+		logadapter.WithErrorChain(),
+	)
+
+	root := pkgerrors.New("connection refused")
+	err := fmt.Errorf("load user: %w", fmt.Errorf("query: %w", root))
+	logger.WithError(err).Error("my log entry")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+	assert.Equal(t, "my log entry\nload user: query: connection refused", got["message"],
+		"the error in the message is unchanged")
+
+	data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{
+			"message": "load user: query: connection refused",
+			"type":    "*fmt.wrapError",
+		},
+		map[string]interface{}{
+			"message": "query: connection refused",
+			"type":    "*fmt.wrapError",
+		},
+		map[string]interface{}{
+			"message":  "connection refused",
+			"type":     "*errors.fundamental",
+			"hasStack": true,
+		},
+	}, data["errorChain"])
+}
+
+func TestErrorChainUnwrapped(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithErrorChain(),
+	)
+
+	logger.WithError(fmt.Errorf("no cause")).Error("my log entry")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+	assert.NotContains(t, data, "errorChain")
+}
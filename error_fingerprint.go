@@ -0,0 +1,69 @@
+package logadapter
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"runtime"
+	"strings"
+)
+
+// KeyErrorFingerprint is added to the context data of ERROR and more severe
+// entries with a stack trace when WithErrorFingerprint is enabled
+const KeyErrorFingerprint = "errorFingerprint"
+
+// LabelErrorFingerprint is the label the fingerprint of an error is added as
+const LabelErrorFingerprint = "error_fingerprint"
+
+// errorFunctions returns the functions of the stack trace of an error, from
+// the innermost call
+func errorFunctions(err error) []string {
+	var st stackTracer
+	if !errors.As(err, &st) {
+		return nil
+	}
+	var funcs []string
+	for _, frame := range st.StackTrace() {
+		if fn := runtime.FuncForPC(uintptr(frame) - 1); fn != nil {
+			funcs = append(funcs, fn.Name())
+		}
+	}
+	return funcs
+}
+
+// stackFunctions returns the functions of a stack trace formatted by
+// debug.Stack(), from the innermost call. Each function is followed by an
+// indented line with its file and line, which are ignored, as are the
+// arguments of calls.
+func stackFunctions(stack string) []string {
+	lines := strings.Split(stack, "\n")
+	var funcs []string
+	for i := 0; i+1 < len(lines); i++ {
+		if !strings.HasPrefix(lines[i+1], "\t") || strings.HasPrefix(lines[i], "\t") {
+			continue
+		}
+		funcs = append(funcs, frameFunction(lines[i]))
+	}
+	return funcs
+}
+
+// errorFingerprint hashes the functions of a stack trace, other than those
+// of the packages skipped when locating errors, so that an error keeps its
+// fingerprint when lines move between releases. It returns "" if no function
+// remains.
+func (f *Formatter) errorFingerprint(funcs []string) string {
+	h := fnv.New64a()
+	n := 0
+	for _, fn := range funcs {
+		if f.skipFunction(fn) {
+			continue
+		}
+		h.Write([]byte(fn))
+		h.Write([]byte{'\n'})
+		n++
+	}
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
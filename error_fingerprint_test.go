@@ -0,0 +1,116 @@
+package logadapter_test
+
+import (
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const placeOrderStack = `panic: out of stock
+
+goroutine 12 [running]:
+example.com/shop/inventory.(*Store).Reserve(0xc000128000, {0xc00001e0f0, 0x6})
+	/src/shop/inventory/store.go:88 +0x1a5
+example.com/shop/orders.(*Service).Place(0xc00010c000, {0x7f1a2c, 0xc000124000})
+	/src/shop/orders/service.go:42 +0x8b
+github.com/grpc-ecosystem/go-grpc-middleware.ChainUnaryServer.func1(...)
+	/go/pkg/mod/github.com/grpc-ecosystem/go-grpc-middleware/chain.go:25 +0x3a
+created by example.com/shop/server.(*Server).Serve in goroutine 1
+	/src/shop/server/server.go:120 +0x2d1
+`
+
+// the same call path, a release later, through another version of middleware
+const placeOrderStackMoved = `panic: out of stock
+
+goroutine 7 [running]:
+example.com/shop/inventory.(*Store).Reserve(0xc000a28000, {0xc00011e0f0, 0x9})
+	/src/shop/inventory/store.go:97 +0x2b1
+example.com/shop/orders.(*Service).Place(0xc000b0c000, {0x7f1a2c, 0xc000924000})
+	/src/shop/orders/service.go:45 +0x8b
+github.com/grpc-ecosystem/go-grpc-middleware.ChainUnaryServer.func1.1(...)
+	/go/pkg/mod/github.com/grpc-ecosystem/go-grpc-middleware/chain.go:31 +0x3a
+created by example.com/shop/server.(*Server).Serve
+	/src/shop/server/server.go:131 +0x2d1
+`
+
+const cancelOrderStack = `goroutine 12 [running]:
+example.com/shop/inventory.(*Store).Reserve(0xc000128000, {0xc00001e0f0, 0x6})
+	/src/shop/inventory/store.go:88 +0x1a5
+example.com/shop/orders.(*Service).Cancel(0xc00010c000, {0x7f1a2c, 0xc000124000})
+	/src/shop/orders/service.go:71 +0x8b
+created by example.com/shop/server.(*Server).Serve in goroutine 1
+	/src/shop/server/server.go:120 +0x2d1
+`
+
+func fingerprint(
+	t *testing.T,
+	f *logadapter.Formatter,
+	level logrus.Level,
+	data logrus.Fields,
+) string {
+	t.Helper()
+	e := logrus.NewEntry(logrus.New()).WithFields(data)
+	e.Level = level
+	e.Message = "placing order"
+	ee, err := f.ToEntry(e)
+	require.NoError(t, err)
+
+	if ee.Context == nil {
+		assert.Empty(t, ee.Labels[logadapter.LabelErrorFingerprint])
+		return ""
+	}
+	fp, _ := ee.Context.Data[logadapter.KeyErrorFingerprint].(string)
+	assert.Equal(t, fp, ee.Labels[logadapter.LabelErrorFingerprint],
+		"the fingerprint is both a field and a label")
+	return fp
+}
+
+func TestErrorFingerprintStackField(t *testing.T) {
+	f := logadapter.NewFormatter(logadapter.WithErrorFingerprint())
+	stack := func(s string) logrus.Fields { return logrus.Fields{logadapter.KeyStackTrace: s} }
+
+	placed := fingerprint(t, f, logrus.ErrorLevel, stack(placeOrderStack))
+	assert.Len(t, placed, 16)
+	assert.Equal(t, placed, fingerprint(t, f, logrus.ErrorLevel, stack(placeOrderStackMoved)),
+		"lines, arguments and skipped packages are ignored")
+	assert.NotEqual(t, placed, fingerprint(t, f, logrus.ErrorLevel, stack(cancelOrderStack)),
+		"another call path has another fingerprint")
+
+	assert.Empty(t, fingerprint(t, f, logrus.WarnLevel, stack(placeOrderStack)),
+		"only errors are fingerprinted")
+	assert.Empty(t, fingerprint(t, logadapter.NewFormatter(), logrus.ErrorLevel,
+		stack(placeOrderStack)), "fingerprints are disabled by default")
+}
+
+//go:noinline
+func reserve() error { return pkgerrors.New("out of stock") }
+
+//go:noinline
+func placeOrder(padding int) error {
+	for i := 0; i < padding; i++ {
+		_ = i
+	}
+	return reserve()
+}
+
+//go:noinline
+func cancelOrder() error { return reserve() }
+
+func TestErrorFingerprintError(t *testing.T) {
+	f := logadapter.NewFormatter(logadapter.WithErrorFingerprint())
+	// errors raised in this package would otherwise be skipped
+	f.StackSkip = []string{"github.com/sirupsen/logrus"}
+	withError := func(err error) logrus.Fields { return logrus.Fields{logrus.ErrorKey: err} }
+
+	placed := fingerprint(t, f, logrus.ErrorLevel, withError(placeOrder(1)))
+	assert.NotEmpty(t, placed)
+	assert.Equal(t, placed, fingerprint(t, f, logrus.ErrorLevel, withError(placeOrder(3))))
+	assert.NotEqual(t, placed, fingerprint(t, f, logrus.ErrorLevel, withError(cancelOrder())))
+
+	assert.Empty(t, fingerprint(t, f, logrus.ErrorLevel,
+		withError(assert.AnError)), "errors without a stack have no fingerprint")
+}
@@ -0,0 +1,28 @@
+package logadapter
+
+import "github.com/sirupsen/logrus"
+
+// errorKey returns the field of the error of entries
+func (f *Formatter) errorKey() string {
+	if f.ErrorKey != "" {
+		return f.ErrorKey
+	}
+	return logrus.ErrorKey
+}
+
+// loggedError returns the error of an entry, if logged under the error key as
+// an error or a non-empty string. Other values, such as structs, are only
+// logged in the data of the entry, rather than dumped in its message.
+func (f *Formatter) loggedError(e *logrus.Entry) (interface{}, bool) {
+	switch v := e.Data[f.errorKey()].(type) {
+	case error:
+		// an error whose Error panics is appended as the placeholder
+		if msg, ok := safeError(v); !ok {
+			return msg, true
+		}
+		return v, true
+	case string:
+		return v, v != ""
+	}
+	return nil, false
+}
@@ -0,0 +1,63 @@
+package logadapter_test
+
+import (
+	"errors"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type declinedCard struct {
+	Code   string `json:"code"`
+	Amount int    `json:"amount"`
+}
+
+func TestErrorKey(t *testing.T) {
+	const reportedErrorEvent = "type.googleapis.com/" +
+		"google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+
+	tests := []struct {
+		name    string
+		value   interface{}
+		message string
+		data    interface{}
+	}{
+		{"error", errors.New("card declined"), "payment failed\ncard declined", "card declined"},
+		{"string", "card declined", "payment failed\ncard declined", "card declined"},
+		{
+			"struct", declinedCard{Code: "do_not_honor", Amount: 1200}, "payment failed",
+			map[string]interface{}{"code": "do_not_honor", "amount": 1200},
+		},
+		{"nil", nil, "payment failed", nil},
+	}
+	for _, key := range []string{"error", "err"} {
+		logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+			logadapter.WithErrorKey(key),
+		))
+		for _, tt := range tests {
+			t.Run(key+"/"+tt.name, func(t *testing.T) {
+				logger.WithField(key, tt.value).Error("payment failed")
+				e, ok := rec.LastEntry()
+				require.True(t, ok)
+				assert.Equal(t, tt.message, e.Message)
+				assert.Equal(t, reportedErrorEvent, e.Type)
+				logtest.AssertField(t, e, "context.data."+key, tt.data)
+			})
+		}
+
+		t.Run(key+"/other key", func(t *testing.T) {
+			other := "err"
+			if key == other {
+				other = "error"
+			}
+			logger.WithField(other, errors.New("card declined")).Error("payment failed")
+			e, ok := rec.LastEntry()
+			require.True(t, ok)
+			assert.Equal(t, "payment failed", e.Message, "only the error key is appended")
+			logtest.AssertField(t, e, "context.data."+other, "card declined")
+		})
+	}
+}
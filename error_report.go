@@ -0,0 +1,27 @@
+package logadapter
+
+import (
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrorReport describes a failed request to the error handlers of the
+// logging middleware, so that it may be forwarded to other sinks.
+type ErrorReport = middleware.ErrorReport
+
+// ReportEntry holds the fields of the formatted log entry of an ErrorReport.
+type ReportEntry = middleware.ReportEntry
+
+var _ middleware.ReportEntryComposer = (*Formatter)(nil)
+
+// ReportEntry formats the log entry of an error report as it would be logged.
+func (f *Formatter) ReportEntry(e *logrus.Entry) (ReportEntry, error) {
+	// entries are logged without their mutations should a mutator fail
+	ee, _ := f.ToEntry(e)
+	return ReportEntry{
+		Message:  ee.Message,
+		Severity: string(ee.Severity),
+		Trace:    ee.Trace,
+		SpanID:   ee.SpanID,
+	}, nil
+}
@@ -0,0 +1,44 @@
+package logadapter
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// KeyErrorTitle promotes its value to the first line of the message of an
+// ERROR or more severe entry, which Error Reporting groups errors by
+const KeyErrorTitle = "errorTitle"
+
+// errorTitle provides the first line of an error report, and what remains of
+// err to compose after it. The title is "" if the message is composed as is.
+func (f *Formatter) errorTitle(data logrus.Fields, err error) (string, error) {
+	if title, ok := data[KeyErrorTitle].(string); ok && title != "" {
+		delete(data, KeyErrorTitle)
+		return title, err
+	}
+	if !f.ErrorTitleFromError || err == nil {
+		return "", err
+	}
+
+	lines := strings.SplitN(err.Error(), "\n", 2)
+	if len(lines) == 1 {
+		return lines[0], nil
+	}
+	return lines[0], errors.New(lines[1])
+}
+
+// titled composes messages with title on their first line, and rest in place
+// of the error it was taken from
+func titled(compose MessageComposer, title string, rest error) MessageComposer {
+	return func(msg string, err error, stack string) string {
+		if err != nil {
+			err = rest
+		}
+		if message := compose(msg, err, stack); message != "" {
+			return title + "\n" + message
+		}
+		return title
+	}
+}
@@ -0,0 +1,93 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorTitle(t *testing.T) {
+	const stack = "goroutine 1 [running]:\nmain.main()\n\t/src/main.go:12 +0x1d"
+
+	errs := []error{
+		errors.New("card declined"),
+		errors.New("gateway timeout\nafter 3 attempts"),
+	}
+
+	for _, tcase := range []struct {
+		name        string
+		opts        []logadapter.Option
+		fields      logrus.Fields
+		wantTitles  []string
+		wantMessage string
+	}{
+		{
+			name:        "default",
+			wantTitles:  []string{"payment failed", "payment failed"},
+			wantMessage: "payment failed\ngateway timeout\nafter 3 attempts\n" + stack,
+		},
+		{
+			name:        "title from error",
+			opts:        []logadapter.Option{logadapter.WithErrorTitleFromError()},
+			wantTitles:  []string{"card declined", "gateway timeout"},
+			wantMessage: "gateway timeout\npayment failed\nafter 3 attempts\n" + stack,
+		},
+		{
+			name: "title from error with payload stack",
+			opts: []logadapter.Option{
+				logadapter.WithErrorTitleFromError(),
+				logadapter.WithStackTraceStyle(logadapter.TraceInPayload),
+			},
+			wantTitles:  []string{"card declined", "gateway timeout"},
+			wantMessage: "gateway timeout\npayment failed\nafter 3 attempts",
+		},
+		{
+			name:       "title field",
+			fields:     logrus.Fields{logadapter.KeyErrorTitle: "payment provider unavailable"},
+			wantTitles: []string{"payment provider unavailable", "payment provider unavailable"},
+			wantMessage: "payment provider unavailable\npayment failed\ngateway timeout\n" +
+				"after 3 attempts\n" + stack,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(append([]logadapter.Option{
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithService("checkout"),
+				logadapter.WithSkipTimestamp(),
+			}, tcase.opts...)...)
+
+			var got map[string]interface{}
+			for i, err := range errs {
+				out.Reset()
+				logger.WithFields(tcase.fields).
+					WithField(logadapter.KeyStackTrace, stack).
+					WithError(err).
+					Error("payment failed")
+				got = nil
+				require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+				message := got["message"].(string)
+				assert.Equal(t, tcase.wantTitles[i], strings.SplitN(message, "\n", 2)[0])
+				if stackTrace, ok := got["stack_trace"].(string); ok {
+					assert.Equal(t, tcase.wantTitles[i], strings.SplitN(stackTrace, "\n", 2)[0],
+						"the reported stack trace has the same title")
+				}
+				assert.Contains(t, got["@type"], "ReportedErrorEvent",
+					"still reported to Error Reporting")
+			}
+			assert.Equal(t, tcase.wantMessage, got["message"])
+			data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+			assert.NotContains(t, data, logadapter.KeyErrorTitle, "the title is not repeated")
+		})
+	}
+}
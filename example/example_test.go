@@ -30,6 +30,7 @@ func ExampleWithError() {
 	foo := bufio.NewWriter(&b)
 	logger.Out = foo
 	logger.Formatter = stackdriver.NewFormatter(
+		stackdriver.WithProjectID("test-project"),
 		stackdriver.WithService("test-service"),
 		stackdriver.WithVersion("v0.1.0"),
 		stackdriver.WithSkipTimestamp(),
@@ -49,28 +50,35 @@ func ExampleWithError() {
 
 	// Output:
 	// {
-	//     "logName": "projects//logs/test-service",
-	//     "message": "application up and running",
 	//     "severity": "INFO",
-	//     "context": {},
+	//     "message": "application up and running",
+	//     "logging.googleapis.com/trace": "projects/test-project/traces/105445aa7843bc8bf206b12000100000",
+	//     "logging.googleapis.com/spanId": "0000000000000001",
+	//     "logging.googleapis.com/trace_sampled": true,
 	//     "logging.googleapis.com/sourceLocation": {
 	//         "file": "testing/run_example.go",
 	//         "line": 63,
 	//         "function": "runExample"
 	//     },
-	//     "logging.googleapis.com/trace": "projects//traces/105445aa7843bc8bf206b12000100000",
-	//     "logging.googleapis.com/spanId": "0000000000000001",
-	//     "logging.googleapis.com/trace_sampled": true
+	//     "logName": "projects/test-project/logs/test-service"
 	// }
 	// {
+	//     "severity": "ERROR",
+	//     "message": "unable to parse integer\nstrconv.ParseInt: parsing \"text\": invalid syntax",
+	//     "logging.googleapis.com/trace": "projects/test-project/traces/105445aa7843bc8bf206b12000100000",
+	//     "logging.googleapis.com/spanId": "0000000000000001",
+	//     "logging.googleapis.com/trace_sampled": true,
+	//     "logging.googleapis.com/sourceLocation": {
+	//         "file": "testing/run_example.go",
+	//         "line": 63,
+	//         "function": "runExample"
+	//     },
 	//     "@type": "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent",
-	//     "logName": "projects//logs/test-service",
+	//     "logName": "projects/test-project/logs/test-service",
 	//     "serviceContext": {
 	//         "service": "test-service",
 	//         "version": "v0.1.0"
 	//     },
-	//     "message": "unable to parse integer\nstrconv.ParseInt: parsing \"text\": invalid syntax",
-	//     "severity": "ERROR",
 	//     "context": {
 	//         "data": {
 	//             "error": "strconv.ParseInt: parsing \"text\": invalid syntax"
@@ -80,15 +88,7 @@ func ExampleWithError() {
 	//             "lineNumber": 63,
 	//             "functionName": "runExample"
 	//         }
-	//     },
-	//     "logging.googleapis.com/sourceLocation": {
-	//         "file": "testing/run_example.go",
-	//         "line": 63,
-	//         "function": "runExample"
-	//     },
-	//     "logging.googleapis.com/trace": "projects//traces/105445aa7843bc8bf206b12000100000",
-	//     "logging.googleapis.com/spanId": "0000000000000001",
-	//     "logging.googleapis.com/trace_sampled": true
+	//     }
 	// }
 }
 
@@ -0,0 +1,65 @@
+package logadapter
+
+import (
+	"runtime/debug"
+	"time"
+)
+
+// SetReadBuildInfo replaces the reader of the build information of the
+// binary, and returns a func restoring it.
+func SetReadBuildInfo(read func() (*debug.BuildInfo, bool)) (restore func()) {
+	previous := readBuildInfo
+	readBuildInfo = read
+	return func() { readBuildInfo = previous }
+}
+
+// ExtractFromCallStack returns the source location of a call.
+var ExtractFromCallStack = extractFromCallStack
+
+// Sanitize removes control characters from s.
+var Sanitize = sanitize
+
+// SetLogOnceClock replaces the clock of Every, and its keys and those of
+// Once with an empty cache of limit keys. It returns a func restoring them.
+func SetLogOnceClock(clock func() time.Time, limit int) (restore func()) {
+	previousOnce, previousEvery, previousNow := onceKeys, everyKeys, logOnceClock
+	onceKeys, everyKeys, logOnceClock = newKeyCache(limit), newKeyCache(limit), clock
+	return func() { onceKeys, everyKeys, logOnceClock = previousOnce, previousEvery, previousNow }
+}
+
+// SetPodInfo replaces the downward API volume and the environment read
+// WithKubernetesMetadata, and returns a func restoring them.
+func SetPodInfo(dir string, env func(string) string) (restore func()) {
+	previousDir, previousEnv := podInfoDir, getenv
+	podInfoDir, getenv = dir, env
+	return func() { podInfoDir, getenv = previousDir, previousEnv }
+}
+
+// SetGetenv replaces the environment read by the formatter and RunJob, and
+// returns a func restoring it.
+func SetGetenv(env func(string) string) (restore func()) {
+	previous := getenv
+	getenv = env
+	return func() { getenv = previous }
+}
+
+// SkipFrame reports whether a frame of the function fn of the package pkg is
+// skipped when locating errors.
+func (f *Formatter) SkipFrame(pkg, fn string) bool {
+	return f.skipFrame(pkg, fn)
+}
+
+// SelfPackage is the import path of this package.
+var SelfPackage = selfPackage
+
+// SetClock replaces the clock of the ResilientWriter.
+func (w *ResilientWriter) SetClock(now func() time.Time) {
+	w.now = now
+}
+
+// OrderedEntry and OrderedContext are the fields of an Entry and its Context
+// as encoding/json encodes them.
+type (
+	OrderedEntry   = orderedEntry
+	OrderedContext = orderedContext
+)
@@ -0,0 +1,109 @@
+package logadapter
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var _ logrus.Hook = (*FanoutHook)(nil)
+
+// Destination is where a FanoutHook writes entries, formatted with its own
+// Formatter.
+type Destination struct {
+	Formatter logrus.Formatter
+	Writer    io.Writer
+	// MinLevel is the least severe level written, such as logrus.InfoLevel
+	// to write entries at INFO and above
+	MinLevel logrus.Level
+}
+
+// FanoutHook writes each entry to several destinations, each formatted with
+// its own formatter, such as Stackdriver JSON to stdout and generic JSON to a
+// local file, for a single log call. The logger's own output can be discarded:
+//
+//	log.Out = ioutil.Discard
+//	log.AddHook(logadapter.NewFanoutHook(
+//		logadapter.Destination{Formatter: logadapter.NewFormatter(), Writer: os.Stdout,
+//			MinLevel: logrus.InfoLevel},
+//		logadapter.Destination{Formatter: &logrus.JSONFormatter{}, Writer: file,
+//			MinLevel: logrus.DebugLevel},
+//	))
+//
+// Each destination formats a copy of the entry, so that formatters modifying
+// its data don't affect one another, and a destination failing to format or
+// write an entry doesn't keep it from the others.
+type FanoutHook struct {
+	destinations []fanoutDestination
+	levels       []logrus.Level
+}
+
+// fanoutDestination serializes the writes to a destination, as hooks are
+// fired outside of the lock of the logger
+type fanoutDestination struct {
+	Destination
+	mu *sync.Mutex
+}
+
+// NewFanoutHook returns a FanoutHook writing entries to destinations.
+func NewFanoutHook(destinations ...Destination) *FanoutHook {
+	h := &FanoutHook{}
+	maxLevel := logrus.PanicLevel
+	for _, d := range destinations {
+		h.destinations = append(h.destinations,
+			fanoutDestination{Destination: d, mu: &sync.Mutex{}})
+		if d.MinLevel > maxLevel {
+			maxLevel = d.MinLevel
+		}
+	}
+	for _, level := range logrus.AllLevels {
+		if level <= maxLevel {
+			h.levels = append(h.levels, level)
+		}
+	}
+	return h
+}
+
+func (h *FanoutHook) Levels() []logrus.Level {
+	return h.levels
+}
+
+// Fire writes the entry to each destination of its level. It returns an
+// error if any destination failed, once the entry was written to the others.
+func (h *FanoutHook) Fire(e *logrus.Entry) error {
+	var failed int
+	var firstErr error
+	for _, d := range h.destinations {
+		if e.Level > d.MinLevel {
+			continue
+		}
+		if err := d.write(e); err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if firstErr != nil {
+		return fmt.Errorf("logadapter: %d fanout destinations failed: %w", failed, firstErr)
+	}
+	return nil
+}
+
+func (d fanoutDestination) write(e *logrus.Entry) error {
+	// formatters may modify the data of the entry, and reuse its buffer
+	c := *e
+	c.Data = copyValue(e.Data).(logrus.Fields)
+	c.Buffer = nil
+
+	b, err := d.Formatter.Format(&c)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, err = d.Writer.Write(b)
+	return err
+}
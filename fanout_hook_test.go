@@ -0,0 +1,106 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+// redactingFormatter deletes a field of the entries it formats
+type redactingFormatter struct {
+	logrus.JSONFormatter
+}
+
+func (f *redactingFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	delete(e.Data, "card")
+	return f.JSONFormatter.Format(e)
+}
+
+func TestFanoutHook(t *testing.T) {
+	var stdout, file bytes.Buffer
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.SetLevel(logrus.DebugLevel)
+	logger.AddHook(logadapter.NewFanoutHook(
+		logadapter.Destination{
+			Formatter: &redactingFormatter{},
+			Writer:    &file,
+			MinLevel:  logrus.DebugLevel,
+		},
+		logadapter.Destination{
+			Formatter: logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			),
+			Writer:   &stdout,
+			MinLevel: logrus.InfoLevel,
+		},
+	))
+
+	logger.WithField("card", "4242").Info("payment authorized")
+	logger.Debug("cache refreshed")
+
+	var generic []map[string]interface{}
+	dec := json.NewDecoder(&file)
+	for dec.More() {
+		var m map[string]interface{}
+		require.NoError(t, dec.Decode(&m))
+		generic = append(generic, m)
+	}
+	require.Len(t, generic, 2)
+	assert.Equal(t, "payment authorized", generic[0]["msg"])
+	assert.Equal(t, "info", generic[0]["level"])
+	assert.NotContains(t, generic[0], "card")
+	assert.Equal(t, "cache refreshed", generic[1]["msg"])
+
+	var stackdriver []logadapter.Entry
+	dec = json.NewDecoder(&stdout)
+	for dec.More() {
+		var e logadapter.Entry
+		require.NoError(t, dec.Decode(&e))
+		stackdriver = append(stackdriver, e)
+	}
+	require.Len(t, stackdriver, 1, "DEBUG entries are below the level of the destination")
+	assert.Equal(t, logadapter.SeverityInfo, stackdriver[0].Severity)
+	assert.Equal(t, "payment authorized", stackdriver[0].Message)
+	require.NotNil(t, stackdriver[0].Context)
+	assert.Equal(t, "4242", stackdriver[0].Context.Data["card"],
+		"formatters format their own copy of the entry")
+}
+
+func TestFanoutHookIsolation(t *testing.T) {
+	var out bytes.Buffer
+	hook := logadapter.NewFanoutHook(
+		logadapter.Destination{
+			Formatter: &logrus.JSONFormatter{},
+			Writer:    failingWriter{},
+			MinLevel:  logrus.InfoLevel,
+		},
+		logadapter.Destination{
+			Formatter: &logrus.TextFormatter{DisableColors: true},
+			Writer:    &out,
+			MinLevel:  logrus.InfoLevel,
+		},
+	)
+
+	err := hook.Fire(logrus.NewEntry(logrus.New()).WithField("orderId", "A-1234"))
+	assert.EqualError(t, err, "logadapter: 1 fanout destinations failed: disk full")
+	assert.Contains(t, out.String(), "orderId=A-1234",
+		"the other destinations are written")
+	assert.Equal(t, []logrus.Level{
+		logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel, logrus.InfoLevel,
+	}, hook.Levels())
+}
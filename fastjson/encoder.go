@@ -0,0 +1,413 @@
+// Package fastjson encodes formatted entries by appending their fixed fields
+// to a buffer, rather than with reflection, only using encoding/json for
+// free-form fields such as the data of the context.
+//
+// Its output is identical to that of encoding/json, without indentation:
+//
+//	formatter := logadapter.NewFormatter(
+//		logadapter.WithEncoder(fastjson.New()),
+//	)
+package fastjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+)
+
+// Encoder appends the JSON encoding of entries to a buffer. It is safe for
+// concurrent use.
+type Encoder struct {
+	pool sync.Pool
+}
+
+// New returns an Encoder, which should be shared by a formatter to reuse
+// buffers between entries.
+func New() *Encoder {
+	return &Encoder{
+		pool: sync.Pool{New: func() interface{} { return new(bytes.Buffer) }},
+	}
+}
+
+// Encode appends the JSON encoding of e to buf
+func (enc *Encoder) Encode(e *logadapter.Entry, buf []byte) ([]byte, error) {
+	start := len(buf)
+	b, err := enc.appendEntry(buf, e)
+	if err != nil {
+		return buf[:start], err
+	}
+	return b, nil
+}
+
+func (enc *Encoder) appendEntry(b []byte, e *logadapter.Entry) ([]byte, error) {
+	var err error
+	o := len(b)
+	b = append(b, '{')
+	// in the order of Entry.MarshalJSON
+	b = appendStringField(b, o, "severity", string(e.Severity))
+	b = appendStringField(b, o, "message", e.Message)
+	b = appendStringField(b, o, "timestamp", e.Timestamp)
+	b = appendStringField(b, o, "time", e.Time)
+	b = appendStringField(b, o, "logging.googleapis.com/trace", e.Trace)
+	b = appendStringField(b, o, "logging.googleapis.com/spanId", e.SpanID)
+	b = appendBoolField(b, o, "logging.googleapis.com/trace_sampled", e.TraceSampled)
+	if e.SourceLocation != nil {
+		b = appendKey(b, o, "logging.googleapis.com/sourceLocation")
+		b = appendSourceLocation(b, e.SourceLocation)
+	}
+	if len(e.Labels) > 0 {
+		b = appendKey(b, o, "logging.googleapis.com/labels")
+		b = appendLabels(b, e.Labels)
+	}
+	if op := e.Operation; op != nil {
+		b = appendKey(b, o, "logging.googleapis.com/operation")
+		oo := len(b)
+		b = append(b, '{')
+		b = appendStringField(b, oo, "id", op.ID)
+		b = appendStringField(b, oo, "producer", op.Producer)
+		b = appendBoolField(b, oo, "first", op.First)
+		b = appendBoolField(b, oo, "last", op.Last)
+		b = append(b, '}')
+	}
+	if e.HTTPRequest != nil {
+		b = appendKey(b, o, "httpRequest")
+		b = appendHTTPRequest(b, e.HTTPRequest)
+	}
+	b = appendStringField(b, o, "@type", e.Type)
+	b = appendStringField(b, o, "logName", e.LogName)
+	if r := e.Resource; r != nil {
+		b = appendKey(b, o, "resource")
+		ro := len(b)
+		b = append(b, '{')
+		b = appendStringField(b, ro, "type", r.Type)
+		if len(r.Labels) > 0 {
+			b = appendKey(b, ro, "labels")
+			b = appendLabels(b, r.Labels)
+		}
+		b = append(b, '}')
+	}
+	if s := e.ServiceContext; s != nil {
+		b = appendKey(b, o, "serviceContext")
+		so := len(b)
+		b = append(b, '{')
+		b = appendStringField(b, so, "service", s.Service)
+		b = appendStringField(b, so, "version", s.Version)
+		b = append(b, '}')
+	}
+	b = appendStringField(b, o, "stack_trace", e.StackTrace)
+	if e.LegacySourceLocation != nil {
+		b = appendKey(b, o, "sourceLocation")
+		b = appendSourceLocation(b, e.LegacySourceLocation)
+	}
+	b = appendStringField(b, o, "msg", e.LegacyMessage)
+	b = appendStringField(b, o, "logSchema", e.LogSchema)
+	if e.Context != nil {
+		b = appendKey(b, o, "context")
+		if b, err = enc.appendContext(b, e.Context); err != nil {
+			return b, err
+		}
+	}
+	return append(b, '}'), nil
+}
+
+func (enc *Encoder) appendContext(b []byte, c *logadapter.Context) ([]byte, error) {
+	var err error
+	o := len(b)
+	b = append(b, '{')
+	if len(c.Data) > 0 {
+		b = appendKey(b, o, "data")
+		if b, err = enc.appendData(b, c.Data); err != nil {
+			return b, err
+		}
+	}
+	b = appendStringField(b, o, "user", c.User)
+	if l := c.ReportLocation; l != nil {
+		b = appendKey(b, o, "reportLocation")
+		lo := len(b)
+		b = append(b, '{')
+		b = appendStringField(b, lo, "filePath", l.FilePath)
+		b = appendIntField(b, lo, "lineNumber", l.LineNumber)
+		b = appendStringField(b, lo, "functionName", l.FunctionName)
+		b = append(b, '}')
+	}
+	if c.HTTPRequest != nil {
+		b = appendKey(b, o, "httpRequest")
+		b = appendHTTPRequestContext(b, c.HTTPRequest)
+	}
+	if len(c.PubSubRequest) > 0 {
+		b = appendKey(b, o, "pubSubRequest")
+		if b, err = enc.appendJSON(b, c.PubSubRequest); err != nil {
+			return b, err
+		}
+	}
+	if r := c.GRPCRequest; r != nil {
+		b = appendKey(b, o, "grpcRequest")
+		ro := len(b)
+		b = append(b, '{')
+		b = appendStringField(b, ro, "method", r.Method)
+		b = appendStringField(b, ro, "userAgent", r.UserAgent)
+		b = appendStringField(b, ro, "peer", r.PeerAddr)
+		b = appendStringField(b, ro, "deadline", r.Deadline)
+		b = appendStringField(b, ro, "duration", r.Duration)
+		b = appendStringField(b, ro, "timeout", r.Timeout)
+		b = appendStringField(b, ro, "timeoutBudget", r.TimeoutBudget)
+		b = appendStringField(b, ro, "budgetRemaining", r.BudgetRemaining)
+		b = appendIntField(b, ro, "attempt", r.Attempt)
+		b = appendStringField(b, ro, "peerAuthType", r.PeerAuthType)
+		b = appendStringField(b, ro, "peerIdentity", r.PeerIdentity)
+		b = appendStringField(b, ro, "peerCertificateCN", r.PeerCertificateCN)
+		b = appendBoolField(b, ro, "peerMTLS", r.PeerMTLS)
+		if len(r.Phases) > 0 {
+			b = appendKey(b, ro, "phases")
+			b = appendLabels(b, r.Phases)
+		}
+		b = append(b, '}')
+	}
+	if c.GRPCStatusDetails != nil {
+		b = appendKey(b, o, "grpcStatus")
+		if b, err = enc.appendJSON(b, c.GRPCStatusDetails); err != nil {
+			return b, err
+		}
+	} else if len(c.GRPCStatus) > 0 {
+		b = appendKey(b, o, "grpcStatus")
+		// validated and compacted as encoding/json does
+		if b, err = enc.appendJSON(b, c.GRPCStatus); err != nil {
+			return b, err
+		}
+	}
+	if len(c.SourceReferences) > 0 {
+		b = appendKey(b, o, "sourceReferences")
+		b = append(b, '[')
+		for i, r := range c.SourceReferences {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			ro := len(b)
+			b = append(b, '{')
+			b = appendStringField(b, ro, "repository", r.Repository)
+			b = appendStringField(b, ro, "revisionId", r.RevisionID)
+			b = append(b, '}')
+		}
+		b = append(b, ']')
+	}
+	b = appendStringField(b, o, "goVersion", c.GoVersion)
+	if len(c.BuildSettings) > 0 {
+		b = appendKey(b, o, "buildSettings")
+		b = appendLabels(b, c.BuildSettings)
+	}
+	return append(b, '}'), nil
+}
+
+func appendSourceLocation(b []byte, l *logadapter.SourceLocation) []byte {
+	o := len(b)
+	b = append(b, '{')
+	b = appendStringField(b, o, "file", l.FilePath)
+	b = appendIntField(b, o, "line", l.LineNumber)
+	b = appendStringField(b, o, "function", l.FunctionName)
+	return append(b, '}')
+}
+
+func appendHTTPRequest(b []byte, r *logadapter.HTTPRequest) []byte {
+	o := len(b)
+	b = append(b, '{')
+	b = appendStringField(b, o, "requestMethod", r.RequestMethod)
+	b = appendStringField(b, o, "requestUrl", r.RequestURL)
+	b = appendStringField(b, o, "requestSize", r.RequestSize)
+	b = appendStringField(b, o, "status", r.Status)
+	b = appendStringField(b, o, "responseSize", r.ResponseSize)
+	b = appendStringField(b, o, "userAgent", r.UserAgent)
+	b = appendStringField(b, o, "remoteIp", r.RemoteIP)
+	b = appendStringField(b, o, "serverIp", r.ServerIP)
+	b = appendStringField(b, o, "referer", r.Referer)
+	b = appendStringField(b, o, "latency", r.Latency)
+	b = appendBoolField(b, o, "cacheLookup", r.CacheLookup)
+	b = appendBoolField(b, o, "cacheHit", r.CacheHit)
+	b = appendBoolField(b, o, "cacheValidatedWithOriginServer", r.CacheValidatedWithOriginServer)
+	b = appendStringField(b, o, "cacheFillBytes", r.CacheFillBytes)
+	b = appendStringField(b, o, "protocol", r.Protocol)
+	return append(b, '}')
+}
+
+func appendHTTPRequestContext(b []byte, r *logadapter.HTTPRequestContext) []byte {
+	o := len(b)
+	b = append(b, '{')
+	b = appendStringField(b, o, "method", r.Method)
+	b = appendStringField(b, o, "url", r.URL)
+	b = appendStringField(b, o, "userAgent", r.UserAgent)
+	b = appendStringField(b, o, "referrer", r.Referrer)
+	b = appendIntField(b, o, "responseStatusCode", r.ResponseStatusCode)
+	b = appendStringField(b, o, "remoteIp", r.RemoteIP)
+	return append(b, '}')
+}
+
+// appendData appends data with sorted keys, as encoding/json does, appending
+// common values directly
+func (enc *Encoder) appendData(b []byte, data map[string]interface{}) ([]byte, error) {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var err error
+	b = append(b, '{')
+	for i, k := range keys {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendString(b, k)
+		b = append(b, ':')
+		switch v := data[k].(type) {
+		case string:
+			b = appendString(b, v)
+		case bool:
+			b = strconv.AppendBool(b, v)
+		case int:
+			b = strconv.AppendInt(b, int64(v), 10)
+		case int64:
+			b = strconv.AppendInt(b, v, 10)
+		case nil:
+			b = append(b, "null"...)
+		default:
+			if b, err = enc.appendJSON(b, v); err != nil {
+				return b, err
+			}
+		}
+	}
+	return append(b, '}'), nil
+}
+
+// appendJSON appends the encoding/json encoding of v, through a pooled buffer
+func (enc *Encoder) appendJSON(b []byte, v interface{}) ([]byte, error) {
+	w := enc.pool.Get().(*bytes.Buffer)
+	defer func() {
+		w.Reset()
+		enc.pool.Put(w)
+	}()
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		return b, err
+	}
+	// trim the newline of the json.Encoder
+	return append(b, bytes.TrimSuffix(w.Bytes(), []byte{'\n'})...), nil
+}
+
+// appendLabels appends labels, or another map of strings, with sorted keys, as
+// encoding/json does
+func appendLabels(b []byte, labels map[string]string) []byte {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b = append(b, '{')
+	for i, k := range keys {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendString(b, k)
+		b = append(b, ':')
+		b = appendString(b, labels[k])
+	}
+	return append(b, '}')
+}
+
+// appendKey appends the key of a field to the object starting at offset o,
+// preceded by a comma unless it is the first field
+func appendKey(b []byte, o int, key string) []byte {
+	if len(b) > o+1 {
+		b = append(b, ',')
+	}
+	b = append(b, '"')
+	b = append(b, key...)
+	return append(b, '"', ':')
+}
+
+func appendStringField(b []byte, o int, key, s string) []byte {
+	if s == "" {
+		return b
+	}
+	return appendString(appendKey(b, o, key), s)
+}
+
+func appendIntField(b []byte, o int, key string, n int) []byte {
+	if n == 0 {
+		return b
+	}
+	return strconv.AppendInt(appendKey(b, o, key), int64(n), 10)
+}
+
+func appendBoolField(b []byte, o int, key string, v bool) []byte {
+	if !v {
+		return b
+	}
+	return append(appendKey(b, o, key), "true"...)
+}
+
+const hex = "0123456789abcdef"
+
+// shortEscapes is whether encoding/json escapes \b and \f as such, which it
+// does since Go 1.22, rather than as \u0008 and \u000c
+var shortEscapes = func() bool {
+	b, _ := json.Marshal("\b")
+	return string(b) == `"\b"`
+}()
+
+// appendString appends s as a JSON string, escaped as encoding/json does with
+// HTML escaping
+func appendString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch {
+			case c == '"' || c == '\\':
+				b = append(b, '\\', c)
+			case c == '\n':
+				b = append(b, '\\', 'n')
+			case c == '\r':
+				b = append(b, '\\', 'r')
+			case c == '\t':
+				b = append(b, '\\', 't')
+			case c == '\b' && shortEscapes:
+				b = append(b, '\\', 'b')
+			case c == '\f' && shortEscapes:
+				b = append(b, '\\', 'f')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		// line and paragraph separators break JSONP
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hex[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
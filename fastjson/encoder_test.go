@@ -0,0 +1,81 @@
+package fastjson_test
+
+import (
+	"io/ioutil"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/fastjson"
+	"github.com/sirupsen/logrus"
+)
+
+func BenchmarkFormat(b *testing.B) {
+	encoders := []struct {
+		name string
+		enc  logadapter.EntryEncoder
+	}{
+		{name: "encoding/json", enc: logadapter.JSONEncoder{}},
+		{name: "fastjson", enc: fastjson.New()},
+	}
+	for _, tt := range encoders {
+		b.Run(tt.name, func(b *testing.B) {
+			logger := logrus.New()
+			logger.Out = ioutil.Discard
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithService("test"),
+				logadapter.WithVersion("0.1"),
+				logadapter.WithEncoder(tt.enc),
+			)
+			entry := logger.
+				WithField("foo", "bar").
+				WithField("count", 42).
+				WithField(logadapter.KeyHTTPRequest, &logadapter.HTTPRequest{
+					RequestMethod: "GET",
+					RequestURL:    "/foo",
+					Status:        "500",
+				})
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				entry.Info("my log entry")
+			}
+		})
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	e := &logadapter.Entry{
+		LogName:        "projects/test-project/logs/test",
+		Timestamp:      "2021-01-01T00:00:00Z",
+		ServiceContext: &logadapter.ServiceContext{Service: "test", Version: "0.1"},
+		Message:        "my log entry",
+		Context: &logadapter.Context{
+			Data: map[string]interface{}{"foo": "bar", "count": 42},
+		},
+		SourceLocation: &logadapter.SourceLocation{
+			FilePath:     "github.com/StevenACoffman/test/main.go",
+			LineNumber:   42,
+			FunctionName: "main",
+		},
+		Trace:        "projects/test-project/traces/105445aa7843bc8bf206b12000100000",
+		SpanID:       "0000000000000001",
+		TraceSampled: true,
+	}
+	fast := fastjson.New()
+	buf := make([]byte, 0, 1024)
+
+	b.Run("encoding/json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = logadapter.JSONEncoder{}.Encode(e, buf)
+		}
+	})
+	b.Run("fastjson", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = fast.Encode(e, buf)
+		}
+	})
+}
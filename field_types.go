@@ -0,0 +1,286 @@
+package logadapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FieldType is the type a field of the data of entries is coerced to
+// WithFieldTypes, such as for sinks to BigQuery, which infers the type of a
+// column from the first value it ingests.
+type FieldType int
+
+const (
+	// FieldString coerces numbers and booleans to strings
+	FieldString FieldType = iota + 1
+	// FieldInt coerces integral floats and strings to integers
+	FieldInt
+	// FieldFloat coerces integers and numeric strings to floats
+	FieldFloat
+	// FieldBool coerces strings, such as "true" or "0", to booleans
+	FieldBool
+	// FieldJSONString encodes any value as a string of its JSON
+	FieldJSONString
+)
+
+// invalidFieldSuffix is appended to the key of a field that cannot be
+// coerced to its type, under which it is logged as a string
+const invalidFieldSuffix = "__invalid"
+
+func (t FieldType) String() string {
+	switch t {
+	case FieldString:
+		return "string"
+	case FieldInt:
+		return "int"
+	case FieldFloat:
+		return "float"
+	case FieldBool:
+		return "bool"
+	case FieldJSONString:
+		return "json"
+	default:
+		return fmt.Sprintf("FieldType(%d)", int(t))
+	}
+}
+
+// coerceFields coerces the fields of data, which must already be copied from
+// the entry, to their configured types, and stringifies the others if
+// configured. Fields that cannot be coerced are moved under their key with
+// the invalid suffix.
+func (f *Formatter) coerceFields(data logrus.Fields) {
+	if len(f.FieldTypes) == 0 && !f.StringifyAll {
+		return
+	}
+	for k, v := range data {
+		t, typed := f.FieldTypes[k]
+		if !typed {
+			if f.StringifyAll {
+				data[k] = stringifyScalars(v)
+			}
+			continue
+		}
+		if v == nil {
+			continue
+		}
+		if c, ok := coerceField(t, v); ok {
+			data[k] = c
+			continue
+		}
+		delete(data, k)
+		data[k+invalidFieldSuffix] = invalidField(v)
+	}
+}
+
+// coerceField converts v to t, if compatible
+func coerceField(t FieldType, v interface{}) (interface{}, bool) {
+	if raw, ok := v.(json.RawMessage); ok {
+		if t == FieldJSONString {
+			return string(raw), true
+		}
+		var decoded interface{}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&decoded); err != nil {
+			return nil, false
+		}
+		v = decoded
+	}
+
+	switch t {
+	case FieldString:
+		return scalarString(v)
+	case FieldInt:
+		return coerceInt(v)
+	case FieldFloat:
+		return coerceFloat(v)
+	case FieldBool:
+		switch v := v.(type) {
+		case bool:
+			return v, true
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			return b, err == nil
+		}
+		return nil, false
+	case FieldJSONString:
+		b, err := safeMarshal(v)
+		if err != nil {
+			return nil, false
+		}
+		return string(b), true
+	default:
+		return v, true
+	}
+}
+
+// scalarString formats v as a string if it is a scalar
+func scalarString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, json.Number:
+		return fmt.Sprint(v), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	case time.Time:
+		return v.Format(time.RFC3339Nano), true
+	case fmt.Stringer:
+		return safeString(v), true
+	}
+	return "", false
+}
+
+func coerceInt(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case int:
+		return v, true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return v, uint64(v) <= math.MaxInt64
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return v, v <= math.MaxInt64
+	case float32:
+		return integral(float64(v))
+	case float64:
+		return integral(v)
+	case json.Number:
+		return parseInt(string(v))
+	case string:
+		return parseInt(strings.TrimSpace(v))
+	}
+	return nil, false
+}
+
+// parseInt parses an integer, or a float with an integral value such as "3.0"
+func parseInt(s string) (interface{}, bool) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, true
+	}
+	if x, err := strconv.ParseFloat(s, 64); err == nil {
+		return integral(x)
+	}
+	return nil, false
+}
+
+func integral(x float64) (interface{}, bool) {
+	if x != math.Trunc(x) || x < math.MinInt64 || x >= math.MaxInt64 {
+		return nil, false
+	}
+	return int64(x), true
+}
+
+func coerceFloat(v interface{}) (interface{}, bool) {
+	var x float64
+	switch v := v.(type) {
+	case int:
+		x = float64(v)
+	case int8:
+		x = float64(v)
+	case int16:
+		x = float64(v)
+	case int32:
+		x = float64(v)
+	case int64:
+		x = float64(v)
+	case uint:
+		x = float64(v)
+	case uint8:
+		x = float64(v)
+	case uint16:
+		x = float64(v)
+	case uint32:
+		x = float64(v)
+	case uint64:
+		x = float64(v)
+	case float32:
+		x = float64(v)
+	case float64:
+		x = v
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return nil, false
+		}
+		x = f
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, false
+		}
+		x = f
+	default:
+		return nil, false
+	}
+	// NaN and infinities cannot be encoded in JSON
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return nil, false
+	}
+	return x, true
+}
+
+// invalidField renders a value that cannot be coerced to its type as a
+// string, its JSON if it has one
+func invalidField(v interface{}) string {
+	if s, ok := scalarString(v); ok {
+		return s
+	}
+	if b, err := safeMarshal(v); err == nil {
+		return string(b)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// stringifyScalars formats v as a string if it is a scalar, or the scalars
+// within it if it is a map or slice copied from the entry
+func stringifyScalars(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, string:
+		return v
+	case logrus.Fields:
+		for k, e := range v {
+			v[k] = stringifyScalars(e)
+		}
+		return v
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = stringifyScalars(e)
+		}
+		return v
+	case []interface{}:
+		for i, e := range v {
+			v[i] = stringifyScalars(e)
+		}
+		return v
+	case json.RawMessage:
+		return v
+	}
+	if s, ok := scalarString(v); ok {
+		return s
+	}
+	return v
+}
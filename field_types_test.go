@@ -0,0 +1,106 @@
+package logadapter_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldTypes(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithFieldTypes(map[string]logadapter.FieldType{
+			"orderId": logadapter.FieldString,
+			"retries": logadapter.FieldInt,
+			"amount":  logadapter.FieldFloat,
+			"express": logadapter.FieldBool,
+			"items":   logadapter.FieldJSONString,
+		}),
+	))
+
+	tests := []struct {
+		name  string
+		key   string
+		value interface{}
+		want  interface{}
+	}{
+		{"int to string", "orderId", 1234, "1234"},
+		{"float to string", "orderId", 12.5, "12.5"},
+		{"bool to string", "orderId", true, "true"},
+		{"string", "orderId", "A-1234", "A-1234"},
+		{"int", "retries", 3, 3.0},
+		{"string to int", "retries", "3", 3.0},
+		{"integral float to int", "retries", 3.0, 3.0},
+		{"int to float", "amount", 12, 12.0},
+		{"string to float", "amount", "12.5", 12.5},
+		{"string to bool", "express", "true", true},
+		{"bool", "express", false, false},
+		{"slice to JSON", "items", []string{"a", "b"}, `["a","b"]`},
+		{"string to JSON", "items", "a", `"a"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger.WithField(tt.key, tt.value).Info("order placed")
+			e, ok := rec.LastEntry()
+			require.True(t, ok)
+			logtest.AssertField(t, e, "context.data."+tt.key, tt.want)
+		})
+	}
+
+	invalid := []struct {
+		name  string
+		key   string
+		value interface{}
+		want  string
+	}{
+		{"string to int", "retries", "three", "three"},
+		{"fraction to int", "retries", 2.5, "2.5"},
+		{"bool to float", "amount", true, "true"},
+		{"string to bool", "express", "yes", "yes"},
+		{"map to string", "orderId", map[string]interface{}{"id": 1}, `{"id":1}`},
+	}
+	for _, tt := range invalid {
+		t.Run("invalid "+tt.name, func(t *testing.T) {
+			logger.WithField(tt.key, tt.value).Info("order placed")
+			e, ok := rec.LastEntry()
+			require.True(t, ok)
+			_, ok = logtest.Field(e, "context.data."+tt.key)
+			assert.False(t, ok, "the invalid value is moved")
+			logtest.AssertField(t, e, "context.data."+tt.key+"__invalid", tt.want)
+		})
+	}
+}
+
+func TestStringifyAll(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithStringifyAll(),
+		logadapter.WithFieldTypes(map[string]logadapter.FieldType{
+			"retries": logadapter.FieldInt,
+		}),
+	))
+
+	logger.WithFields(logrus.Fields{
+		"retries":  "3",
+		"amount":   12.5,
+		"express":  true,
+		"orderId":  "A-1234",
+		"duration": 1500 * time.Millisecond,
+		"order":    map[string]interface{}{"items": []interface{}{1, "b"}},
+		"raw":      json.RawMessage(`{"id":1}`),
+	}).Info("order placed")
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	logtest.AssertField(t, e, "context.data.retries", 3.0)
+	logtest.AssertField(t, e, "context.data.amount", "12.5")
+	logtest.AssertField(t, e, "context.data.express", "true")
+	logtest.AssertField(t, e, "context.data.orderId", "A-1234")
+	logtest.AssertField(t, e, "context.data.duration", "1.5s")
+	logtest.AssertField(t, e, "context.data.order.items", []interface{}{"1", "b"})
+	logtest.AssertField(t, e, "context.data.raw.id", 1.0)
+}
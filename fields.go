@@ -0,0 +1,133 @@
+package logadapter
+
+import (
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// FieldsBuilder builds the fields of an entry the formatter promotes to its
+// fields, such as its HTTP request or user, so that their keys can't be
+// misspelled:
+//
+//	log.WithFields(logadapter.Fields().
+//		HTTPRequest(req).
+//		User("u123").
+//		Label("team", "payments").
+//		Build()).Info("order placed")
+type FieldsBuilder struct {
+	fields logrus.Fields
+	labels map[string]string
+}
+
+// Fields returns an empty FieldsBuilder.
+func Fields() *FieldsBuilder {
+	return &FieldsBuilder{fields: logrus.Fields{}}
+}
+
+// HTTPRequest sets the HTTP request of the entry.
+func (b *FieldsBuilder) HTTPRequest(req *HTTPRequest) *FieldsBuilder {
+	return b.set(FieldHTTPRequest(req))
+}
+
+// GRPCRequest sets the gRPC request of the entry.
+func (b *FieldsBuilder) GRPCRequest(req *GRPCRequest) *FieldsBuilder {
+	return b.set(FieldGRPCRequest(req))
+}
+
+// Span sets the span the entry is correlated with, over that of its context.
+func (b *FieldsBuilder) Span(sc trace.SpanContext) *FieldsBuilder {
+	return b.set(FieldSpan(sc))
+}
+
+// User sets the user of the entry, reported with errors.
+func (b *FieldsBuilder) User(user string) *FieldsBuilder {
+	return b.set(FieldUser(user))
+}
+
+// StackTrace sets the stack trace of an error, as formatted by
+// runtime/debug.Stack.
+func (b *FieldsBuilder) StackTrace(stack string) *FieldsBuilder {
+	return b.set(FieldStackTrace(stack))
+}
+
+// LogID sets the log of the entry, appended to the name of the service.
+func (b *FieldsBuilder) LogID(id string) *FieldsBuilder {
+	return b.set(FieldLogID(id))
+}
+
+// Project sets the project of the entry, over that of the formatter.
+func (b *FieldsBuilder) Project(id string) *FieldsBuilder {
+	return b.set(FieldProject(id))
+}
+
+// Label adds a label to those of the entry.
+func (b *FieldsBuilder) Label(k, v string) *FieldsBuilder {
+	if b.labels == nil {
+		b.labels = map[string]string{}
+	}
+	b.labels[k] = v
+	return b
+}
+
+// Build returns the fields, which are copied so that the builder may be
+// reused.
+func (b *FieldsBuilder) Build() logrus.Fields {
+	fields := make(logrus.Fields, len(b.fields)+1)
+	for k, v := range b.fields {
+		fields[k] = v
+	}
+	if len(b.labels) > 0 {
+		k, v := FieldLabels(b.labels)
+		fields[k] = v
+	}
+	return fields
+}
+
+func (b *FieldsBuilder) set(k string, v interface{}) *FieldsBuilder {
+	b.fields[k] = v
+	return b
+}
+
+// FieldHTTPRequest returns the field of the HTTP request of an entry, to be
+// logged with WithField:
+//
+//	log.WithField(logadapter.FieldHTTPRequest(req)).Info("order placed")
+func FieldHTTPRequest(req *HTTPRequest) (string, interface{}) {
+	return KeyHTTPRequest, req
+}
+
+// FieldGRPCRequest returns the field of the gRPC request of an entry.
+func FieldGRPCRequest(req *GRPCRequest) (string, interface{}) {
+	return KeyGRPCRequest, req
+}
+
+// FieldSpan returns the field of the span an entry is correlated with.
+func FieldSpan(sc trace.SpanContext) (string, interface{}) {
+	return KeySpanContext, sc
+}
+
+// FieldUser returns the field of the user of an entry.
+func FieldUser(user string) (string, interface{}) {
+	return KeyUser, user
+}
+
+// FieldStackTrace returns the field of the stack trace of an error.
+func FieldStackTrace(stack string) (string, interface{}) {
+	return KeyStackTrace, stack
+}
+
+// FieldLogID returns the field of the log of an entry.
+func FieldLogID(id string) (string, interface{}) {
+	return KeyLogID, id
+}
+
+// FieldProject returns the field of the project of an entry.
+func FieldProject(id string) (string, interface{}) {
+	return KeyGCPProject, id
+}
+
+// FieldLabels returns the field of labels added to those of an entry. The
+// labels are copied.
+func FieldLabels(labels map[string]string) (string, interface{}) {
+	return KeyLabels, copyLabels(labels)
+}
@@ -0,0 +1,70 @@
+package logadapter_test
+
+import (
+	"testing"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldsBuilder(t *testing.T) {
+	f := logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithService("test"),
+	)
+	req := &logadapter.HTTPRequest{RequestMethod: "POST", RequestURL: "/orders"}
+	fields := logadapter.Fields().
+		HTTPRequest(req).
+		GRPCRequest(&logadapter.GRPCRequest{Method: "/orders.Orders/Place"}).
+		Span(SpanContext).
+		User("u123").
+		Label("team", "payments").
+		Label("env", "prod").
+		LogID("audit").
+		Project("other-project").
+		StackTrace("goroutine 1 [running]:\nmain.main()").
+		Build()
+
+	ee, err := f.ToEntry(logrus.NewEntry(logrus.New()).
+		WithFields(fields).
+		WithField("orderId", "A-1234").
+		WithTime(time.Now()))
+	require.NoError(t, err)
+
+	assert.Equal(t, "projects/other-project/logs/test%2Faudit", ee.LogName)
+	assert.Equal(t, "projects/other-project/traces/"+SpanContext.TraceID().String(), ee.Trace)
+	assert.Equal(t, SpanContext.SpanID().String(), ee.SpanID)
+	assert.Equal(t, map[string]string{"team": "payments", "env": "prod"}, ee.Labels)
+	require.NotNil(t, ee.Context)
+	assert.Equal(t, "u123", ee.Context.User)
+	require.NotNil(t, ee.Context.HTTPRequest)
+	assert.Equal(t, "POST", ee.Context.HTTPRequest.Method)
+	assert.Equal(t, "/orders.Orders/Place", ee.Context.GRPCRequest.Method)
+	assert.Equal(t, map[string]interface{}{"orderId": "A-1234", logadapter.KeyLogID: "audit"},
+		ee.Context.Data, "the other fields are logged as data, and the log ID kept")
+}
+
+func TestFieldPairs(t *testing.T) {
+	f := logadapter.NewFormatter(logadapter.WithProjectID("test-project"))
+	entry := logrus.NewEntry(logrus.New()).
+		WithField(logadapter.FieldUser("u123")).
+		WithField(logadapter.FieldLabels(map[string]string{"team": "payments"})).
+		WithField(logadapter.FieldSpan(SpanContext)).
+		WithField(logadapter.FieldLogID("audit"))
+	entry.Level = logrus.InfoLevel
+
+	ee, err := f.ToEntry(entry)
+	require.NoError(t, err)
+	assert.Equal(t, "u123", ee.Context.User)
+	assert.Equal(t, map[string]string{"team": "payments"}, ee.Labels)
+	assert.Equal(t, SpanContext.SpanID().String(), ee.SpanID)
+	assert.Contains(t, ee.LogName, "%2Faudit")
+	assert.Equal(t, map[string]interface{}{logadapter.KeyLogID: "audit"}, ee.Context.Data)
+
+	k, v := logadapter.FieldHTTPRequest(&logadapter.HTTPRequest{})
+	assert.Equal(t, logadapter.KeyHTTPRequest, k)
+	assert.IsType(t, &logadapter.HTTPRequest{}, v)
+}
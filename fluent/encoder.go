@@ -0,0 +1,47 @@
+package fluent
+
+import (
+	"reflect"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+)
+
+// eventHeader starts the encoding of entries by an Encoder, as an array of
+// their time and record, which a ForwardWriter tells apart from JSON
+const eventHeader = 0x92
+
+var _ logadapter.EntryEncoder = Encoder{}
+
+// Encoder encodes formatted entries as msgpack, for a ForwardWriter to
+// forward them without decoding their JSON:
+//
+//	formatter := logadapter.NewFormatter(
+//		logadapter.WithEncoder(fluent.Encoder{}),
+//	)
+//
+// Its output is only understood by a ForwardWriter, so it can't be validated
+// WithValidation.
+type Encoder struct{}
+
+// Encode appends the time of e and its fields, named as in JSON, to buf
+func (Encoder) Encode(e *logadapter.Entry, buf []byte) ([]byte, error) {
+	start := len(buf)
+	b := appendEventTime(append(buf, eventHeader), entryTime(e))
+	// the MarshalJSON of entries only orders their fields
+	b, err := appendReflect(b, reflect.ValueOf(e).Elem(), false)
+	if err != nil {
+		return buf[:start], err
+	}
+	return b, nil
+}
+
+// entryTime returns the time of an entry, or now if it has none
+func entryTime(e *logadapter.Entry) time.Time {
+	for _, s := range []string{e.Timestamp, e.Time} {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t
+		}
+	}
+	return time.Now()
+}
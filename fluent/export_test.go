@@ -0,0 +1,5 @@
+package fluent
+
+// Decode decodes the msgpack value at the start of b, returning it and its
+// length.
+var Decode = decode
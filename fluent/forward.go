@@ -0,0 +1,395 @@
+// Package fluent forwards formatted entries to Fluentd or Fluent Bit with the
+// forward protocol, rather than having them parse the JSON written to stdout.
+//
+//	w := fluent.NewForwardWriter("localhost:24224", "app.logs")
+//	defer w.Close()
+//	log.SetOutput(w)
+//
+// Entries are decoded from JSON once, or not at all when they are formatted
+// with the Encoder of this package.
+package fluent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+)
+
+var (
+	// ErrBufferFull is returned when writing entries to a ForwardWriter whose
+	// buffer is full, which are dropped
+	ErrBufferFull = errors.New("fluent: forward buffer full, entries dropped")
+	// ErrClosed is returned when writing to or flushing a closed ForwardWriter
+	ErrClosed = errors.New("fluent: write to closed ForwardWriter")
+)
+
+// maxRetryInterval bounds the interval between reconnections, which doubles
+// after each failure
+const maxRetryInterval = 30 * time.Second
+
+var _ io.WriteCloser = (*ForwardWriter)(nil)
+
+// ForwardWriter writes formatted entries as events of the Fluentd forward
+// protocol, [tag, time, record], over TCP, TLS or a unix socket.
+//
+// Events are sent from a background goroutine, so that an unavailable
+// forwarder can't slow logging: they are buffered up to a bound, beyond which
+// they are dropped, and sent again once reconnected.
+//
+// ForwardWriters register themselves to be flushed by logadapter.FlushAll
+// until closed.
+type ForwardWriter struct {
+	// counted atomically, first for 64-bit alignment
+	dropped uint64
+
+	network, addr string
+	tag           string
+	tlsConfig     *tls.Config
+	requireAck    bool
+	timeout       time.Duration
+	retryInterval time.Duration
+	bufferSize    int
+
+	// the connection, used by run only
+	conn   net.Conn
+	reader *bufio.Reader
+
+	events     chan forwardEvent
+	mu         sync.RWMutex
+	closed     bool
+	closing    chan struct{}
+	done       chan struct{}
+	unregister func()
+}
+
+// forwardEvent is the time and record of an event, or a flush request to be
+// acknowledged once the events buffered before it are sent
+type forwardEvent struct {
+	b       []byte
+	flushed chan struct{}
+}
+
+// ForwardOption lets you configure the ForwardWriter.
+type ForwardOption func(*ForwardWriter)
+
+// WithTLS connects to the forwarder with TLS.
+func WithTLS(config *tls.Config) ForwardOption {
+	return func(w *ForwardWriter) {
+		w.tlsConfig = config
+	}
+}
+
+// WithRequireAck waits for the forwarder to acknowledge each event, as with
+// require_ack_response, sending it again otherwise.
+func WithRequireAck() ForwardOption {
+	return func(w *ForwardWriter) {
+		w.requireAck = true
+	}
+}
+
+// WithTimeout limits connecting, writing each event and waiting for its
+// acknowledgment. Defaults to 5 seconds.
+func WithTimeout(d time.Duration) ForwardOption {
+	return func(w *ForwardWriter) {
+		w.timeout = d
+	}
+}
+
+// WithRetryInterval waits d before reconnecting after a failure, doubling up
+// to 30 seconds after each consecutive failure. Defaults to 500 milliseconds.
+func WithRetryInterval(d time.Duration) ForwardOption {
+	return func(w *ForwardWriter) {
+		w.retryInterval = d
+	}
+}
+
+// WithBufferSize buffers up to n events to be sent. Defaults to 1024.
+func WithBufferSize(n int) ForwardOption {
+	return func(w *ForwardWriter) {
+		w.bufferSize = n
+	}
+}
+
+// NewForwardWriter returns a ForwardWriter sending events tagged tag to the
+// forwarder at addr, as host:port, or unix:///path/to/socket. It connects
+// once the first event is written, and must be closed to send the buffered
+// events.
+func NewForwardWriter(addr, tag string, opts ...ForwardOption) *ForwardWriter {
+	w := &ForwardWriter{
+		network:       "tcp",
+		addr:          strings.TrimPrefix(addr, "tcp://"),
+		tag:           tag,
+		timeout:       5 * time.Second,
+		retryInterval: 500 * time.Millisecond,
+		bufferSize:    1024,
+		closing:       make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	if path := strings.TrimPrefix(addr, "unix://"); path != addr {
+		w.network, w.addr = "unix", path
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.events = make(chan forwardEvent, w.bufferSize)
+
+	go w.run()
+	w.unregister = logadapter.RegisterFlusher(w)
+	return w
+}
+
+// Write buffers the entries formatted in p to be sent, as JSON lines, or as
+// encoded by the Encoder. Entries are dropped, and ErrBufferFull returned,
+// when the buffer is full.
+func (w *ForwardWriter) Write(p []byte) (int, error) {
+	var events [][]byte
+	for rest := p; ; {
+		rest = bytes.TrimLeft(rest, " \t\r\n")
+		if len(rest) == 0 {
+			break
+		}
+		b, n, err := event(rest)
+		if err != nil {
+			return len(p) - len(rest), err
+		}
+		events = append(events, b)
+		rest = rest[n:]
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	var err error
+	for _, b := range events {
+		select {
+		case w.events <- forwardEvent{b: b}:
+		default:
+			atomic.AddUint64(&w.dropped, 1)
+			err = ErrBufferFull
+		}
+	}
+	return len(p), err
+}
+
+// event returns the encoding of the time and record of the entry at the start
+// of p, and its length
+func event(p []byte) ([]byte, int, error) {
+	if p[0] == eventHeader {
+		_, n, err := decode(p)
+		if err != nil {
+			return nil, 0, err
+		}
+		return append([]byte(nil), p[1:n]...), n, nil
+	}
+
+	n := bytes.IndexByte(p, '\n')
+	if n < 0 {
+		n = len(p)
+	}
+	v, err := decodeJSON(p[:n])
+	if err != nil {
+		return nil, 0, err
+	}
+	record, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, 0, fmt.Errorf("fluent: entry is not a JSON object")
+	}
+	t := time.Now()
+	for _, k := range []string{"timestamp", "time"} {
+		if s, ok := record[k].(string); ok {
+			if parsed, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				t = parsed
+				break
+			}
+		}
+	}
+	b, err := appendValue(appendEventTime(nil, t), record)
+	return b, n, err
+}
+
+// Flush waits until the events buffered before it are sent, or until ctx is
+// done.
+func (w *ForwardWriter) Flush(ctx context.Context) error {
+	w.mu.RLock()
+	if w.closed {
+		w.mu.RUnlock()
+		return ErrClosed
+	}
+	flushed := make(chan struct{})
+	select {
+	case w.events <- forwardEvent{flushed: flushed}:
+		w.mu.RUnlock()
+	case <-ctx.Done():
+		w.mu.RUnlock()
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Dropped returns the number of events dropped since the writer was created,
+// as the buffer was full, or the forwarder unavailable when closing.
+func (w *ForwardWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Close stops accepting entries, and tries to send the buffered events once
+// each, until the timeout.
+func (w *ForwardWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.closing)
+	close(w.events)
+	w.mu.Unlock()
+	w.unregister()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-time.After(w.timeout):
+		return fmt.Errorf("fluent: timed out closing ForwardWriter, %d events buffered",
+			len(w.events))
+	}
+}
+
+// run sends the buffered events
+func (w *ForwardWriter) run() {
+	defer close(w.done)
+	defer w.disconnect()
+	for ev := range w.events {
+		if ev.flushed != nil {
+			close(ev.flushed)
+			continue
+		}
+		w.deliver(ev.b)
+	}
+}
+
+// deliver sends an event until it succeeds, reconnecting after failures, or
+// once the writer is closing
+func (w *ForwardWriter) deliver(b []byte) {
+	interval := w.retryInterval
+	for {
+		if err := w.send(b); err == nil {
+			return
+		}
+		w.disconnect()
+		select {
+		case <-w.closing:
+			atomic.AddUint64(&w.dropped, 1)
+			return
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > maxRetryInterval {
+			interval = maxRetryInterval
+		}
+	}
+}
+
+// send writes an event as a message, and waits for its acknowledgment
+func (w *ForwardWriter) send(b []byte) error {
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return err
+		}
+	}
+
+	n := 3
+	var chunk string
+	if w.requireAck {
+		n = 4
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		chunk = base64.StdEncoding.EncodeToString(id)
+	}
+	msg := appendString(appendArrayHeader(make([]byte, 0, len(b)+64), n), w.tag)
+	msg = append(msg, b...)
+	if w.requireAck {
+		msg = appendString(appendMapHeader(msg, 1), "chunk")
+		msg = appendString(msg, chunk)
+	}
+
+	if err := w.conn.SetDeadline(time.Now().Add(w.timeout)); err != nil {
+		return err
+	}
+	if _, err := w.conn.Write(msg); err != nil {
+		return err
+	}
+	if !w.requireAck {
+		return nil
+	}
+	return w.readAck(chunk)
+}
+
+// readAck reads the response to a message, which must acknowledge chunk
+func (w *ForwardWriter) readAck(chunk string) error {
+	var buf []byte
+	for {
+		c, err := w.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		buf = append(buf, c)
+		v, _, err := decode(buf)
+		if err == errTruncated {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		resp, _ := v.(map[string]interface{})
+		if ack, _ := resp["ack"].(string); ack != chunk {
+			return fmt.Errorf("fluent: unexpected response to chunk %s: %v", chunk, v)
+		}
+		return nil
+	}
+}
+
+func (w *ForwardWriter) connect() error {
+	dialer := &net.Dialer{Timeout: w.timeout}
+	var conn net.Conn
+	var err error
+	if w.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, w.network, w.addr, w.tlsConfig)
+	} else {
+		conn, err = dialer.Dial(w.network, w.addr)
+	}
+	if err != nil {
+		return err
+	}
+	w.conn, w.reader = conn, bufio.NewReader(conn)
+	return nil
+}
+
+func (w *ForwardWriter) disconnect() {
+	if w.conn != nil {
+		_ = w.conn.Close()
+		w.conn, w.reader = nil, nil
+	}
+}
@@ -0,0 +1,259 @@
+package fluent_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/fluent"
+)
+
+// fakeForwarder accepts connections and decodes the messages sent to it
+type fakeForwarder struct {
+	net.Listener
+	messages chan []interface{}
+	// respond acknowledges the nth message received, or closes its
+	// connection if it returns false
+	respond func(n int) bool
+}
+
+func newFakeForwarder(t *testing.T, l net.Listener) *fakeForwarder {
+	f := &fakeForwarder{
+		Listener: l,
+		messages: make(chan []interface{}, 16),
+		respond:  func(int) bool { return true },
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go f.serve()
+	return f
+}
+
+func (f *fakeForwarder) serve() {
+	n := 0
+	for {
+		conn, err := f.Accept()
+		if err != nil {
+			return
+		}
+		var buf []byte
+		chunk := make([]byte, 4096)
+		for {
+			v, l, err := fluent.Decode(buf)
+			if err != nil {
+				r, rerr := conn.Read(chunk)
+				if rerr != nil {
+					break
+				}
+				buf = append(buf, chunk[:r]...)
+				continue
+			}
+			buf = buf[l:]
+			msg := v.([]interface{})
+			f.messages <- msg
+			n++
+			if !f.respond(n) {
+				break
+			}
+			if len(msg) == 4 {
+				ack := msg[3].(map[string]interface{})["chunk"].(string)
+				// {"ack": chunk}
+				resp := append([]byte{0x81, 0xa3, 'a', 'c', 'k', 0xa0 | byte(len(ack))}, ack...)
+				if _, err := conn.Write(resp); err != nil {
+					break
+				}
+			}
+		}
+		_ = conn.Close()
+	}
+}
+
+func (f *fakeForwarder) next(t *testing.T) []interface{} {
+	t.Helper()
+	select {
+	case msg := <-f.messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return nil
+	}
+}
+
+func listen(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return l
+}
+
+func newLogger(w io.Writer, opts ...logadapter.Option) *logrus.Logger {
+	logger := logrus.New()
+	logger.Formatter = logadapter.NewFormatter(
+		append([]logadapter.Option{logadapter.WithProjectID("test-project")}, opts...)...)
+	logger.SetOutput(w)
+	return logger
+}
+
+func assertMessage(t *testing.T, msg []interface{}, before time.Time) map[string]interface{} {
+	t.Helper()
+	require.Len(t, msg, 3)
+	assert.Equal(t, "app.logs", msg[0])
+	ts, ok := msg[1].(time.Time)
+	require.True(t, ok, "the time is an EventTime")
+	assert.False(t, ts.Before(before.Truncate(time.Second)))
+	record, ok := msg[2].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "INFO", record["severity"])
+	assert.Equal(t, "order placed", record["message"])
+	assert.Equal(t, map[string]interface{}{
+		"data": map[string]interface{}{"orderID": "ord-42", "items": int64(3)},
+	}, record["context"])
+	return record
+}
+
+func TestForwardWriter(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []logadapter.Option
+	}{
+		{name: "json"},
+		{name: "encoder", opts: []logadapter.Option{logadapter.WithEncoder(fluent.Encoder{})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeForwarder(t, listen(t))
+			w := fluent.NewForwardWriter(f.Addr().String(), "app.logs")
+			defer w.Close()
+
+			before := time.Now()
+			newLogger(w, tt.opts...).
+				WithFields(logrus.Fields{"orderID": "ord-42", "items": 3}).
+				Info("order placed")
+			assertMessage(t, f.next(t), before)
+		})
+	}
+}
+
+func TestForwardWriterEncoderEquivalence(t *testing.T) {
+	e := logrus.NewEntry(logrus.New())
+	e.Time = time.Date(2021, 3, 4, 5, 6, 7, 8, time.UTC)
+	e.Level = logrus.WarnLevel
+	e.Message = "slow"
+	e.Data = logrus.Fields{
+		"latency": 1.5,
+		"tags":    []string{"a", "b"},
+		"nested":  map[string]interface{}{"n": -7, "ok": true, "nil": nil},
+		"httpRequest": &logadapter.HTTPRequest{
+			RequestMethod: "GET",
+			Status:        "200",
+		},
+	}
+
+	f := newFakeForwarder(t, listen(t))
+	w := fluent.NewForwardWriter(f.Addr().String(), "app.logs")
+	defer w.Close()
+
+	// the same formatter, as entries without a span share its trace
+	formatter := logadapter.NewFormatter(logadapter.WithProjectID("test-project"))
+	for _, enc := range []logadapter.EntryEncoder{nil, fluent.Encoder{}} {
+		formatter.Encoder = enc
+		b, err := formatter.Format(e)
+		require.NoError(t, err)
+		_, err = w.Write(b)
+		require.NoError(t, err)
+	}
+	fromJSON, fromEncoder := f.next(t), f.next(t)
+	assert.Equal(t, e.Time, fromJSON[1].(time.Time).UTC())
+	assert.Equal(t, fromJSON, fromEncoder, "both encodings are forwarded the same")
+}
+
+func TestForwardWriterRequireAck(t *testing.T) {
+	f := newFakeForwarder(t, listen(t))
+	// the first message is not acknowledged, and is sent again
+	f.respond = func(n int) bool { return n > 1 }
+	w := fluent.NewForwardWriter(f.Addr().String(), "app.logs",
+		fluent.WithRequireAck(),
+		fluent.WithRetryInterval(time.Millisecond),
+	)
+	defer w.Close()
+
+	newLogger(w).Info("acknowledged")
+	first, second := f.next(t), f.next(t)
+	require.Len(t, first, 4)
+	assert.Contains(t, first[3], "chunk")
+	assert.Equal(t, first[2], second[2], "the event is sent again after reconnecting")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, w.Flush(ctx), "the event is acknowledged")
+	assert.Zero(t, w.Dropped())
+}
+
+func TestForwardWriterUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fluent.sock")
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	f := newFakeForwarder(t, l)
+	w := fluent.NewForwardWriter("unix://"+path, "app.logs")
+	defer w.Close()
+
+	before := time.Now()
+	newLogger(w).WithFields(logrus.Fields{"orderID": "ord-42", "items": 3}).Info("order placed")
+	assertMessage(t, f.next(t), before)
+}
+
+func TestForwardWriterTLS(t *testing.T) {
+	// borrows the certificate of a test HTTP server
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	clientConfig := srv.Client().Transport.(*http.Transport).TLSClientConfig
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: srv.TLS.Certificates,
+	})
+	srv.Close()
+	require.NoError(t, err)
+	f := newFakeForwarder(t, l)
+	w := fluent.NewForwardWriter(f.Addr().String(), "app.logs", fluent.WithTLS(clientConfig))
+	defer w.Close()
+
+	before := time.Now()
+	newLogger(w).WithFields(logrus.Fields{"orderID": "ord-42", "items": 3}).Info("order placed")
+	assertMessage(t, f.next(t), before)
+}
+
+func TestForwardWriterBufferFull(t *testing.T) {
+	// nothing listens on the address of a closed listener
+	l := listen(t)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+	w := fluent.NewForwardWriter(addr, "app.logs",
+		fluent.WithBufferSize(1),
+		fluent.WithRetryInterval(time.Hour),
+	)
+
+	logger := logrus.New()
+	logger.Formatter = logadapter.NewFormatter(logadapter.WithProjectID("test-project"))
+	var full bool
+	for i := 0; i < 3; i++ {
+		b, err := logger.Formatter.Format(logrus.NewEntry(logger))
+		require.NoError(t, err)
+		if _, err := w.Write(b); errors.Is(err, fluent.ErrBufferFull) {
+			full = true
+		}
+	}
+	assert.True(t, full, "entries are dropped once the buffer is full")
+
+	require.NoError(t, w.Close())
+	assert.Equal(t, uint64(3), w.Dropped(), "undelivered events are dropped on close")
+	_, err := w.Write([]byte("{}\n"))
+	assert.Equal(t, fluent.ErrClosed, err)
+}
@@ -0,0 +1,505 @@
+package fluent
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errTruncated is returned when decoding a value that is not fully buffered
+var errTruncated = errors.New("fluent: truncated msgpack value")
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonNumberType    = reflect.TypeOf(json.Number(""))
+)
+
+// appendNil and the following functions append the msgpack encoding of a
+// value to b, in its most compact form
+func appendNil(b []byte) []byte {
+	return append(b, 0xc0)
+}
+
+func appendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xc3)
+	}
+	return append(b, 0xc2)
+}
+
+func appendInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return appendUint(b, uint64(v))
+	case v >= -32:
+		return append(b, byte(v))
+	case v >= math.MinInt8:
+		return append(b, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return append(b, 0xd1, byte(v>>8), byte(v))
+	case v >= math.MinInt32:
+		return appendUint32(append(b, 0xd2), uint32(v))
+	default:
+		return appendUint64(append(b, 0xd3), uint64(v))
+	}
+}
+
+func appendUint(b []byte, v uint64) []byte {
+	switch {
+	case v <= math.MaxInt8:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return append(b, 0xcd, byte(v>>8), byte(v))
+	case v <= math.MaxUint32:
+		return appendUint32(append(b, 0xce), uint32(v))
+	default:
+		return appendUint64(append(b, 0xcf), v)
+	}
+}
+
+func appendFloat(b []byte, v float64) []byte {
+	return appendUint64(append(b, 0xcb), math.Float64bits(v))
+}
+
+func appendString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n <= 31:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xda, byte(n>>8), byte(n))
+	default:
+		b = appendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, 0xdc, byte(n>>8), byte(n))
+	default:
+		return appendUint32(append(b, 0xdd), uint32(n))
+	}
+}
+
+func appendMapHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return append(b, 0xde, byte(n>>8), byte(n))
+	default:
+		return appendUint32(append(b, 0xdf), uint32(n))
+	}
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v>>32)), uint32(v))
+}
+
+// appendEventTime appends t as the EventTime extension of the forward
+// protocol, with nanoseconds
+func appendEventTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xd7, 0x00)
+	b = appendUint32(b, uint32(t.Unix()))
+	return appendUint32(b, uint32(t.Nanosecond()))
+}
+
+// appendValue appends the msgpack encoding of v, encoding the same values as
+// encoding/json would: structs by the names of their json tags, and values
+// implementing json.Marshaler as what their JSON decodes to
+func appendValue(b []byte, v interface{}) ([]byte, error) {
+	return appendReflect(b, reflect.ValueOf(v), true)
+}
+
+// appendReflect appends the encoding of v. The json.Marshaler of a value is
+// skipped when marshaler is false, such as for entries, whose MarshalJSON only
+// orders their fields.
+func appendReflect(b []byte, v reflect.Value, marshaler bool) ([]byte, error) {
+	if !v.IsValid() {
+		return appendNil(b), nil
+	}
+	t := v.Type()
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return appendNil(b), nil
+	}
+	if t == jsonNumberType {
+		return appendNumber(b, json.Number(v.String()))
+	}
+	if marshaler && t.Implements(jsonMarshalerType) {
+		raw, err := v.Interface().(json.Marshaler).MarshalJSON()
+		if err != nil {
+			return b, err
+		}
+		return appendJSON(b, raw)
+	}
+	if t.Implements(textMarshalerType) && v.Kind() != reflect.Ptr {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return b, err
+		}
+		return appendString(b, string(text)), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return appendReflect(b, v.Elem(), true)
+	case reflect.Bool:
+		return appendBool(b, v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendInt(b, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Uintptr:
+		return appendUint(b, v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return b, fmt.Errorf("fluent: unsupported value: %v", f)
+		}
+		return appendFloat(b, f), nil
+	case reflect.String:
+		return appendString(b, v.String()), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return appendNil(b), nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			// as encoding/json does
+			return appendString(b, base64.StdEncoding.EncodeToString(v.Bytes())), nil
+		}
+		return appendArray(b, v)
+	case reflect.Array:
+		return appendArray(b, v)
+	case reflect.Map:
+		if v.IsNil() {
+			return appendNil(b), nil
+		}
+		return appendMap(b, v)
+	case reflect.Struct:
+		return appendStruct(b, v)
+	}
+	return b, fmt.Errorf("fluent: unsupported type: %s", t)
+}
+
+func appendArray(b []byte, v reflect.Value) ([]byte, error) {
+	b = appendArrayHeader(b, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		var err error
+		if b, err = appendReflect(b, v.Index(i), true); err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+// appendMap appends a map with its keys sorted, as encoding/json writes them
+func appendMap(b []byte, v reflect.Value) ([]byte, error) {
+	type kv struct {
+		k string
+		v reflect.Value
+	}
+	pairs := make([]kv, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		k, err := mapKey(iter.Key())
+		if err != nil {
+			return b, err
+		}
+		pairs = append(pairs, kv{k, iter.Value()})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].k < pairs[j].k })
+
+	b = appendMapHeader(b, len(pairs))
+	for _, p := range pairs {
+		b = appendString(b, p.k)
+		var err error
+		if b, err = appendReflect(b, p.v, true); err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+func mapKey(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		text, err := tm.MarshalText()
+		return string(text), err
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("fluent: unsupported map key type: %s", k.Type())
+}
+
+// appendStruct appends the exported fields of a struct as a map, named and
+// omitted as their json tags tell, in the order they are declared
+func appendStruct(b []byte, v reflect.Value) ([]byte, error) {
+	fields := structFields(v)
+	b = appendMapHeader(b, len(fields))
+	for _, f := range fields {
+		b = appendString(b, f.name)
+		var err error
+		if b, err = appendReflect(b, f.v, true); err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+type structField struct {
+	name string
+	v    reflect.Value
+}
+
+func structFields(v reflect.Value) []structField {
+	t := v.Type()
+	fields := make([]structField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+		fv := v.Field(i)
+		// the fields of embedded structs are promoted
+		if sf.Anonymous && name == "" {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				fields = append(fields, structFields(fv)...)
+				continue
+			}
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if strings.Contains(","+opts+",", ",omitempty,") && isEmpty(fv) {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, structField{name, fv})
+	}
+	return fields
+}
+
+// isEmpty reports whether v is omitted by omitempty
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+func appendNumber(b []byte, n json.Number) ([]byte, error) {
+	if i, err := n.Int64(); err == nil {
+		return appendInt(b, i), nil
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		return appendUint(b, u), nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return b, err
+	}
+	return appendFloat(b, f), nil
+}
+
+// appendJSON appends the value encoded as JSON by raw
+func appendJSON(b []byte, raw []byte) ([]byte, error) {
+	v, err := decodeJSON(raw)
+	if err != nil {
+		return b, err
+	}
+	return appendValue(b, v)
+}
+
+// decodeJSON decodes raw, keeping numbers as they are written
+func decodeJSON(raw []byte) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	return v, err
+}
+
+// decode decodes the msgpack value at the start of b, returning it and its
+// length, or errTruncated if b ends before it does. Maps are decoded as
+// map[string]interface{}, integers as int64 or uint64, and the EventTime
+// extension as a time.Time.
+func decode(b []byte) (interface{}, int, error) {
+	if len(b) == 0 {
+		return nil, 0, errTruncated
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), 1, nil
+	case c >= 0xe0:
+		return int64(int8(c)), 1, nil
+	case c&0xe0 == 0xa0:
+		return decodeString(b, 1, int(c&0x1f))
+	case c&0xf0 == 0x90:
+		return decodeArray(b, 1, int(c&0x0f))
+	case c&0xf0 == 0x80:
+		return decodeMap(b, 1, int(c&0x0f))
+	}
+	switch c {
+	case 0xc0:
+		return nil, 1, nil
+	case 0xc2:
+		return false, 1, nil
+	case 0xc3:
+		return true, 1, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n := 1 << (c - 0xcc)
+		if len(b) < 1+n {
+			return nil, 0, errTruncated
+		}
+		return readUint(b[1 : 1+n]), 1 + n, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		n := 1 << (c - 0xd0)
+		if len(b) < 1+n {
+			return nil, 0, errTruncated
+		}
+		u := readUint(b[1 : 1+n])
+		shift := 64 - 8*uint(n)
+		return int64(u<<shift) >> shift, 1 + n, nil
+	case 0xca:
+		if len(b) < 5 {
+			return nil, 0, errTruncated
+		}
+		return float64(math.Float32frombits(uint32(readUint(b[1:5])))), 5, nil
+	case 0xcb:
+		if len(b) < 9 {
+			return nil, 0, errTruncated
+		}
+		return math.Float64frombits(readUint(b[1:9])), 9, nil
+	case 0xd9, 0xda, 0xdb:
+		return decodeLength(b, 1<<(c-0xd9), decodeString)
+	case 0xc4, 0xc5, 0xc6:
+		v, n, err := decodeLength(b, 1<<(c-0xc4), decodeString)
+		if s, ok := v.(string); ok {
+			v = []byte(s)
+		}
+		return v, n, err
+	case 0xdc, 0xdd:
+		return decodeLength(b, 2<<(c-0xdc), decodeArray)
+	case 0xde, 0xdf:
+		return decodeLength(b, 2<<(c-0xde), decodeMap)
+	case 0xd7:
+		if len(b) < 10 {
+			return nil, 0, errTruncated
+		}
+		if b[1] != 0x00 {
+			return nil, 0, fmt.Errorf("fluent: unsupported msgpack extension %d", b[1])
+		}
+		sec, nsec := readUint(b[2:6]), readUint(b[6:10])
+		return time.Unix(int64(sec), int64(nsec)), 10, nil
+	}
+	return nil, 0, fmt.Errorf("fluent: unsupported msgpack type 0x%x", c)
+}
+
+func readUint(b []byte) uint64 {
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u
+}
+
+// decodeLength decodes a value whose length is written on size bytes
+func decodeLength(
+	b []byte, size int, fn func(b []byte, off, n int) (interface{}, int, error),
+) (interface{}, int, error) {
+	if len(b) < 1+size {
+		return nil, 0, errTruncated
+	}
+	return fn(b, 1+size, int(readUint(b[1:1+size])))
+}
+
+func decodeString(b []byte, off, n int) (interface{}, int, error) {
+	if len(b) < off+n {
+		return nil, 0, errTruncated
+	}
+	return string(b[off : off+n]), off + n, nil
+}
+
+func decodeArray(b []byte, off, n int) (interface{}, int, error) {
+	a := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, l, err := decode(b[off:])
+		if err != nil {
+			return nil, 0, err
+		}
+		a = append(a, v)
+		off += l
+	}
+	return a, off, nil
+}
+
+func decodeMap(b []byte, off, n int) (interface{}, int, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, l, err := decode(b[off:])
+		if err != nil {
+			return nil, 0, err
+		}
+		off += l
+		v, l, err := decode(b[off:])
+		if err != nil {
+			return nil, 0, err
+		}
+		off += l
+		m[fmt.Sprint(k)] = v
+	}
+	return m, off, nil
+}
@@ -0,0 +1,86 @@
+package logadapter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/flushers"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultShutdownTimeout limits how long flushing waits on exit
+const defaultShutdownTimeout = 5 * time.Second
+
+// Flusher writes the entries it buffers.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// RegisterFlusher adds f to the flushers of FlushAll, until unregistered.
+func RegisterFlusher(f Flusher) (unregister func()) {
+	return flushers.Register(f)
+}
+
+// FlushAll flushes every registered Flusher concurrently, returning once
+// they are done or ctx is, so that hanging flushers do not delay exit past
+// its deadline. It returns the first error of a flusher, or of ctx.
+func FlushAll(ctx context.Context) error {
+	fs := flushers.Registered()
+
+	// buffered so that hanging flushers don't leak blocked sends
+	errs := make(chan error, len(fs))
+	for _, f := range fs {
+		go func(f flushers.Flusher) {
+			errs <- f.Flush(ctx)
+		}(f)
+	}
+
+	var first error
+	for range fs {
+		select {
+		case err := <-errs:
+			if first == nil {
+				first = err
+			}
+		case <-ctx.Done():
+			if first == nil {
+				first = ctx.Err()
+			}
+			return first
+		}
+	}
+	return first
+}
+
+var registerExitFlush sync.Once
+
+// InitLoggingWithShutdown initializes a logger as InitLogging does, and has
+// logrus flush the registered flushers, such as an AsyncWriter, before
+// exiting on Fatal. The returned shutdown flushes them too, and is meant to
+// be deferred in main.
+func InitLoggingWithShutdown(w io.Writer, opts ...Option) (*logrus.Logger, func()) {
+	registerExitFlush.Do(func() {
+		logrus.RegisterExitHandler(func() {
+			_ = flushWithTimeout()
+		})
+	})
+
+	shutdown := func() {
+		if err := flushWithTimeout(); err != nil {
+			fmt.Fprintf(os.Stderr, "logadapter: flushing logs on shutdown: %v\n", err)
+		}
+	}
+	return InitLogging(w, opts...), shutdown
+}
+
+// flushWithTimeout flushes the registered flushers for at most
+// defaultShutdownTimeout
+func flushWithTimeout() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultShutdownTimeout)
+	defer cancel()
+	return FlushAll(ctx)
+}
@@ -0,0 +1,103 @@
+package logadapter_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flusherFunc adapts a function to a Flusher
+type flusherFunc func(ctx context.Context) error
+
+func (f flusherFunc) Flush(ctx context.Context) error { return f(ctx) }
+
+func TestFlushAllDrainsAsyncWriter(t *testing.T) {
+	w := newGatedWriter()
+	a := logadapter.NewAsyncWriter(w, 8)
+	defer a.Close()
+
+	_, err := a.Write([]byte("0\n"))
+	require.NoError(t, err)
+	<-w.started
+	for _, entry := range []string{"1\n", "2\n"} {
+		_, err := a.Write([]byte(entry))
+		require.NoError(t, err)
+	}
+
+	close(w.release)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, logadapter.FlushAll(ctx))
+	assert.Equal(t, []string{"0", "1", "2"}, w.lines())
+
+	require.NoError(t, logadapter.FlushAll(ctx), "flushing again is a no-op")
+	assert.Equal(t, []string{"0", "1", "2"}, w.lines())
+}
+
+func TestFlushAllHangingFlusher(t *testing.T) {
+	hang := make(chan struct{})
+	defer close(hang)
+	unregister := logadapter.RegisterFlusher(flusherFunc(func(context.Context) error {
+		<-hang
+		return nil
+	}))
+	defer unregister()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := logadapter.FlushAll(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second), "the deadline is respected")
+}
+
+func TestFlushAllError(t *testing.T) {
+	errFlush := errors.New("flush failed")
+	flushed := 0
+	defer logadapter.RegisterFlusher(flusherFunc(func(context.Context) error {
+		return errFlush
+	}))()
+	defer logadapter.RegisterFlusher(flusherFunc(func(context.Context) error {
+		flushed++
+		return nil
+	}))()
+
+	assert.Equal(t, errFlush, logadapter.FlushAll(context.Background()))
+	assert.Equal(t, 1, flushed, "other flushers are still flushed")
+}
+
+func TestAsyncWriterFlushAfterClose(t *testing.T) {
+	flushed := 0
+	defer logadapter.RegisterFlusher(flusherFunc(func(context.Context) error {
+		flushed++
+		return nil
+	}))()
+
+	a := logadapter.NewAsyncWriter(newGatedWriter(), 2)
+	require.NoError(t, a.Close())
+	assert.NoError(t, a.Flush(context.Background()))
+	assert.NoError(t, logadapter.FlushAll(context.Background()))
+	assert.Equal(t, 1, flushed)
+}
+
+func TestInitLoggingWithShutdown(t *testing.T) {
+	w := newGatedWriter()
+	close(w.release)
+	a := logadapter.NewAsyncWriter(w, 8)
+	defer a.Close()
+
+	logger, shutdown := logadapter.InitLoggingWithShutdown(a,
+		logadapter.WithProjectID("test-project"))
+	logger.Info("stopping")
+	shutdown()
+
+	lines := w.lines()
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "Logger successfully initialized!")
+	assert.Contains(t, lines[1], "stopping")
+}
@@ -1,42 +1,23 @@
 package logadapter
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/requestlog"
 	"github.com/go-stack/stack"
 	"github.com/gofrs/uuid"
 	"github.com/sirupsen/logrus"
 	"go.opentelemetry.io/otel/trace"
 )
 
-type severity string
-
-// LogSeverity as understood by GCP
-// https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#logseverity
-const (
-	severityDebug    severity = "DEBUG"
-	severityInfo     severity = "INFO"
-	severityWarning  severity = "WARNING"
-	severityError    severity = "ERROR"
-	severityCritical severity = "CRITICAL"
-	severityAlert    severity = "ALERT"
-)
-
-var levelsToSeverity = map[logrus.Level]severity{
-	logrus.DebugLevel: severityDebug,
-	logrus.InfoLevel:  severityInfo,
-	logrus.WarnLevel:  severityWarning,
-	logrus.ErrorLevel: severityError,
-	logrus.FatalLevel: severityCritical,
-	logrus.PanicLevel: severityAlert,
-	logrus.TraceLevel: severityDebug,
-}
-
 // log entries containing this type are evaluated as long entries as though all
 // required fields are present, and captures the error event
 const reportedErrorEventType = "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
@@ -44,13 +25,25 @@ const reportedErrorEventType = "type.googleapis.com/google.devtools.clouderrorre
 // Known keys
 const (
 	KeyLogID         = "logID"
-	KeySpanContext   = "span_context"
+	KeySpanContext   = requestlog.KeySpanContext
 	KeySpanID        = "spanID"
-	KeyStackTrace    = "stackTrace"
+	KeyStackTrace    = requestlog.KeyStackTrace
 	KeyTrace         = "trace"
-	KeyUser          = "user"
+	KeyUser          = requestlog.KeyUser
 	KeyHTTPRequest   = "httpRequest"
+	KeyGRPCRequest   = "grpcRequest"
+	KeyGRPCStatus    = "grpcStatus"
 	KeyPubSubRequest = "pubSubRequest"
+	KeyGCPProject    = "gcpProject"
+	KeyComponent     = "component"
+	KeyOperation     = "operation"
+	// KeyLabels holds labels, a map[string]string, added to those of the
+	// entry. Its name is reserved, so that it doesn't clash with fields.
+	KeyLabels = requestlog.KeyLabels
+	// KeyBareSpanID and KeyTraceSampled are the span and sampling decision
+	// of the trace field, as propagated individually, such as from Cloud Run
+	KeyBareSpanID   = "spanId"
+	KeyTraceSampled = "traceSampled"
 )
 
 // ServiceContext provides the data about the service we are sending to Google.
@@ -80,48 +73,76 @@ type Context struct {
 	Data             map[string]interface{} `json:"data,omitempty"`
 	User             string                 `json:"user,omitempty"`
 	ReportLocation   *ReportLocation        `json:"reportLocation,omitempty"`
-	HTTPRequest      *HTTPRequest           `json:"httpRequest,omitempty"`
+	HTTPRequest      *HTTPRequestContext    `json:"httpRequest,omitempty"`
 	PubSubRequest    map[string]interface{} `json:"pubSubRequest,omitempty"`
 	GRPCRequest      *GRPCRequest           `json:"grpcRequest,omitempty"`
 	GRPCStatus       json.RawMessage        `json:"grpcStatus,omitempty"`
 	SourceReferences []SourceReference      `json:"sourceReferences,omitempty"`
+	GoVersion        string                 `json:"goVersion,omitempty"`
+	BuildSettings    map[string]string      `json:"buildSettings,omitempty"`
+
+	// GRPCStatusDetails is logged as the grpcStatus, in place of GRPCStatus
+	GRPCStatusDetails *GRPCStatusDetails `json:"-"`
 }
 
 // HTTPRequest defines details of a request and response to append to a log.
 // https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#httprequest
-type HTTPRequest struct {
-	RequestMethod                  string `json:"requestMethod,omitempty"`
-	RequestURL                     string `json:"requestUrl,omitempty"`
-	RequestSize                    string `json:"requestSize,omitempty"`
-	Status                         string `json:"status,omitempty"`
-	ResponseSize                   string `json:"responseSize,omitempty"`
-	UserAgent                      string `json:"userAgent,omitempty"`
-	RemoteIP                       string `json:"remoteIp,omitempty"`
-	ServerIP                       string `json:"serverIp,omitempty"`
-	Referer                        string `json:"referer,omitempty"`
-	Latency                        string `json:"latency,omitempty"`
-	CacheLookup                    bool   `json:"cacheLookup,omitempty"`
-	CacheHit                       bool   `json:"cacheHit,omitempty"`
-	CacheValidatedWithOriginServer bool   `json:"cacheValidatedWithOriginServer,omitempty"`
-	CacheFillBytes                 string `json:"cacheFillBytes,omitempty"`
-	Protocol                       string `json:"protocol,omitempty"`
+type HTTPRequest = requestlog.HTTPRequest
+
+// HTTPRequestContext is the request of an error, as Error Reporting reads it
+// from the context of entries, which names its fields otherwise than
+// HTTPRequest.
+// https://cloud.google.com/error-reporting/reference/rest/v1beta1/ErrorContext#httprequestcontext
+type HTTPRequestContext struct {
+	Method             string `json:"method,omitempty"`
+	URL                string `json:"url,omitempty"`
+	UserAgent          string `json:"userAgent,omitempty"`
+	Referrer           string `json:"referrer,omitempty"`
+	ResponseStatusCode int    `json:"responseStatusCode,omitempty"`
+	RemoteIP           string `json:"remoteIp,omitempty"`
+}
+
+// newHTTPRequestContext trims the details of a request to those Error
+// Reporting accepts. The status is absent until the request is served.
+func newHTTPRequestContext(r *HTTPRequest) *HTTPRequestContext {
+	if r == nil {
+		return nil
+	}
+	status, _ := strconv.Atoi(r.Status)
+	return &HTTPRequestContext{
+		Method:             r.RequestMethod,
+		URL:                r.RequestURL,
+		UserAgent:          r.UserAgent,
+		Referrer:           r.Referer,
+		ResponseStatusCode: status,
+		RemoteIP:           r.RemoteIP,
+	}
 }
 
+// GRPCRequest represents details of a gRPC request and response appended to a log.
+type GRPCRequest = requestlog.GRPCRequest
+
+// GRPCStatusDetails is the status of a failed RPC logged as fields, in place
+// of its raw JSON, with grpcmw.WithStructuredGRPCStatus.
+type GRPCStatusDetails = requestlog.GRPCStatusDetails
+
 // Entry stores a log entry for JSON serialization.
 // Note: Disregard LogEntry for API
 // https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry
 // As it has different keys than the required JSON for the Logging Agent:
 // https://cloud.google.com/logging/docs/structured-logging#special-payload-fields
 type Entry struct {
-	Type           string          `json:"@type,omitempty"`
-	LogName        string          `json:"logName,omitempty"`
-	Timestamp      string          `json:"timestamp,omitempty"`
-	ServiceContext *ServiceContext `json:"serviceContext,omitempty"`
-	Message        string          `json:"message,omitempty"`
-	Severity       severity        `json:"severity,omitempty"`
-	Context        *Context        `json:"context,omitempty"`
-	SourceLocation *SourceLocation `json:"logging.googleapis.com/sourceLocation,omitempty"`
-	StackTrace     string          `json:"stack_trace,omitempty"`
+	Type           string             `json:"@type,omitempty"`
+	LogName        string             `json:"logName,omitempty"`
+	Timestamp      string             `json:"timestamp,omitempty"`
+	Time           string             `json:"time,omitempty"`
+	Resource       *MonitoredResource `json:"resource,omitempty"`
+	ServiceContext *ServiceContext    `json:"serviceContext,omitempty"`
+	Message        string             `json:"message,omitempty"`
+	Severity       Severity           `json:"severity,omitempty"`
+	Context        *Context           `json:"context,omitempty"`
+	SourceLocation *SourceLocation    `json:"logging.googleapis.com/sourceLocation,omitempty"`
+	StackTrace     string             `json:"stack_trace,omitempty"`
 	// Trace string
 	// Optional. Resource name of the trace associated with the log entry, if any.
 	// If it contains a relative resource name, the name is assumed to be relative to
@@ -135,9 +156,59 @@ type Entry struct {
 	// hexadecimal encoding of an 8-byte array.
 	// Example:
 	// 000000000000004a
-	SpanID       string       `json:"logging.googleapis.com/spanId,omitempty"`
-	TraceSampled bool         `json:"logging.googleapis.com/trace_sampled,omitempty"`
-	HTTPRequest  *HTTPRequest `json:"httpRequest,omitempty"`
+	SpanID       string            `json:"logging.googleapis.com/spanId,omitempty"`
+	TraceSampled bool              `json:"logging.googleapis.com/trace_sampled,omitempty"`
+	HTTPRequest  *HTTPRequest      `json:"httpRequest,omitempty"`
+	Labels       map[string]string `json:"logging.googleapis.com/labels,omitempty"`
+	Operation    *Operation        `json:"logging.googleapis.com/operation,omitempty"`
+	// LegacySourceLocation and LegacyMessage duplicate the SourceLocation
+	// and Message under their keys in earlier forks, WithLegacyFieldNames
+	LegacySourceLocation *SourceLocation `json:"sourceLocation,omitempty"`
+	LegacyMessage        string          `json:"msg,omitempty"`
+	// LogSchema is the version of the shape of the entry, WithSchemaVersion
+	LogSchema string `json:"logSchema,omitempty"`
+
+	// project is the ID of the project of the entry, if any
+	project string
+	// collisions are the fields of the entry whose names clash with request
+	// details added by the logging middleware
+	collisions []string
+	// foreignSpan is the type of the span_context of the entry, if it was
+	// converted to a trace.SpanContext by reflection
+	foreignSpan string
+}
+
+// context returns the context of the entry, allocating it if needed
+func (ee *Entry) context() *Context {
+	if ee.Context == nil {
+		ee.Context = &Context{}
+	}
+	return ee.Context
+}
+
+// Operation groups the entries of a long-running operation, such as the
+// execution of a job.
+// https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#LogEntryOperation
+type Operation struct {
+	ID       string `json:"id,omitempty"`
+	Producer string `json:"producer,omitempty"`
+	First    bool   `json:"first,omitempty"`
+	Last     bool   `json:"last,omitempty"`
+}
+
+// addLabels adds the labels to the labels of an entry, keeping those it has
+func (ee *Entry) addLabels(labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	if ee.Labels == nil {
+		ee.Labels = make(map[string]string, len(labels))
+	}
+	for k, v := range labels {
+		if _, ok := ee.Labels[k]; !ok {
+			ee.Labels[k] = v
+		}
+	}
 }
 
 // SourceReference is a reference to a particular snapshot of the source tree
@@ -149,6 +220,11 @@ type SourceReference struct {
 
 // Formatter implements Stackdriver formatting for logrus.
 type Formatter struct {
+	// the counters of Diagnostics are accessed atomically, first for 64-bit
+	// alignment
+	formatted    uint64
+	formatErrors uint64
+
 	Service         string
 	Version         string
 	SourceReference []SourceReference
@@ -158,7 +234,159 @@ type Formatter struct {
 	SkipTimestamp   bool
 	RegexSkip       string
 	PrettyPrint     bool
-	GlobalTraceID   string
+	// GlobalTraceID is the trace of entries logged outside of a span, as 32
+	// lowercase hexadecimal characters
+	GlobalTraceID string
+	// StackPolicy selects the StackStyle of each entry, if configured
+	StackPolicy StackPolicy
+	// MaxAdditionalErrors enables reporting the errors of a multi-error
+	// separately, listing at most this many besides the primary error
+	MaxAdditionalErrors int
+	// Metrics is notified of every entry formatted
+	Metrics MetricsRecorder
+	// ErrorChain lists the errors wrapped by the logged error in context
+	ErrorChain bool
+	// AlertLabels are added to the labels of every ALERT and CRITICAL entry
+	AlertLabels map[string]string
+	// MessageSeparator joins the message and error of an entry, "\n" if empty
+	MessageSeparator string
+	// MessageComposer builds the message of an entry, replacing the default
+	// composition with MessageSeparator
+	MessageComposer MessageComposer
+	// ErrorTitleFromError moves the first line of the logged error to the
+	// first line of the message of ERROR and more severe entries
+	ErrorTitleFromError bool
+	// Platform selects the fields of entries expected by the logging agent,
+	// detected from the environment if not configured
+	Platform Platform
+	// Resource is the monitored resource of entries on PlatformAgentless
+	Resource *MonitoredResource
+	// Encoder encodes formatted entries, with encoding/json if nil
+	Encoder EntryEncoder
+	// DurationFormat is how durations in the data of entries are rendered
+	DurationFormat DurationFormat
+	// DurationMillis adds the duration field of entries in milliseconds
+	DurationMillis bool
+	// NoProtoJSON marshals proto messages in the data of entries with
+	// encoding/json, rather than protojson limited to ProtoJSONMaxBytes
+	NoProtoJSON       bool
+	ProtoJSONMaxBytes int
+	// AutoSourceReference adds the VCS revision embedded in the binary to
+	// the SourceReference, and uses it as the Version if unset
+	AutoSourceReference bool
+	// BuildInfoInErrors adds the Go version and build settings embedded in
+	// the binary to the context of ERROR and more severe entries
+	BuildInfoInErrors bool
+	// ProjectResolver selects the project of each entry without a
+	// gcpProject field, in place of the ProjectID when it returns one
+	ProjectResolver func(e *logrus.Entry) string
+	// ErrorFingerprint adds a hash of the functions of the stack trace of
+	// ERROR and more severe entries, ignoring their lines
+	ErrorFingerprint bool
+	// EntryMutators transform each entry, in order, before it is encoded
+	EntryMutators []EntryMutator
+	// ValidationHandler is called with the violations of each entry found by
+	// ValidateEntry, if configured
+	ValidationHandler func(error)
+	// SizeReporter is called with the size of the fields of a share of the
+	// entries, SizeSampleRate, if configured
+	SizeReporter   func(SizeReport)
+	SizeSampleRate float64
+	// KubernetesLabels identify the pod logging the entries, and are added
+	// to the labels of every entry
+	KubernetesLabels map[string]string
+	// MonotonicTimestamps keeps the timestamps of entries strictly
+	// increasing, within a few microseconds of the wall clock
+	MonotonicTimestamps bool
+	// TimestampPrecision truncates the timestamps of entries, if positive
+	TimestampPrecision time.Duration
+	// FieldTypes coerces the fields of the data of entries to a type, and
+	// StringifyAll the scalars of the other fields to strings
+	FieldTypes   map[string]FieldType
+	StringifyAll bool
+	// StackSkipPrefixes skips the packages under the paths, and
+	// StackSkipFunctions the functions of these full names, when locating
+	// errors
+	StackSkipPrefixes  []string
+	StackSkipFunctions []string
+	// ErrorKey is the field of the error of entries, appended to the message
+	// of errors if an error or a string. Defaults to logrus.ErrorKey.
+	ErrorKey string
+	// ForceTraceSampledOnError marks the trace of entries of ERROR or above
+	// with a span or a trace field as sampled, whether or not their span or
+	// traceSampled field was, and
+	// SamplingEscalation is called with the unsampled spans of these entries
+	ForceTraceSampledOnError bool
+	SamplingEscalation       func(trace.SpanContext)
+	// SourceLocationStrategy selects how the source location of entries is
+	// resolved, and SourceLocationDebug logs how as sourceLocationOrigin
+	SourceLocationStrategy SourceLocationStrategy
+	SourceLocationDebug    bool
+	// StackFrameLimit keeps at most this many frames of stack traces, and
+	// StackTrimPackages drops the frames of these packages, or of
+	// DefaultStackTrimPackages if nil and StackFrameLimit is positive
+	StackFrameLimit   int
+	StackTrimPackages []string
+	// CapturedLocals adds the locals of the errors of ERROR and more severe
+	// entries implementing LocalsProvider to their context
+	CapturedLocals bool
+	// ReservedKeyPolicy selects how fields named like the ReservedKeys are
+	// logged, renamed with the ReservedKeyPrefix by default
+	ReservedKeyPolicy ReservedKeyPolicy
+	ReservedKeyPrefix string
+	// SchemaVersion is logged as the logSchema of every entry, if set, such
+	// as CurrentSchemaVersion
+	SchemaVersion string
+	// LegacyFieldNames duplicates fields renamed since earlier forks under
+	// their legacy keys, sourceLocation and msg
+	LegacyFieldNames bool
+	// StripANSI removes ANSI escape sequences from the strings of entries,
+	// rather than only their escape characters
+	StripANSI bool
+
+	build            *buildInfo
+	globalTrace      traceName
+	clock            monotonicClock
+	projectIDWarning sync.Once
+	collisionWarning sync.Once
+	spanContextNote  sync.Once
+
+	lastFormatError formatError
+}
+
+// MessageComposer builds the message of an entry from the logged message, the
+// logged error and a stack trace, any of which may be empty.
+//
+// Error Reporting expects the first line of a stack trace to explain the
+// error, and the stack trace to follow on its own lines.
+type MessageComposer func(msg string, err error, stack string) string
+
+// composer provides the MessageComposer configured for the formatter
+func (f *Formatter) composer() MessageComposer {
+	if f.MessageComposer != nil {
+		return f.MessageComposer
+	}
+	sep := f.MessageSeparator
+	if sep == "" {
+		sep = "\n"
+	}
+	return func(msg string, err error, stack string) string {
+		parts := make([]string, 0, 2)
+		if msg != "" {
+			parts = append(parts, msg)
+		}
+		if err != nil {
+			parts = append(parts, err.Error())
+		}
+		message := strings.Join(parts, sep)
+		if stack == "" {
+			return message
+		}
+		if message == "" {
+			return stack
+		}
+		return message + "\n" + stack
+	}
 }
 
 // NewFormatter returns a new Formatter.
@@ -166,37 +394,36 @@ func NewFormatter(options ...Option) *Formatter {
 	fmtr := Formatter{
 		StackSkip: []string{
 			"github.com/sirupsen/logrus",
-			"github.com/StevenACoffman/logrus-stackdriver-formatter",
+			selfPackage,
 			"github.com/grpc-ecosystem/go-grpc-middleware",
 			"go.opentelemetry.io",
 		},
 		StackStyle: TraceInMessage,
+		Metrics:    noopMetrics{},
 	}
 	for _, option := range options {
 		option(&fmtr)
 	}
 
+	if fmtr.Platform == 0 {
+		fmtr.Platform = detectPlatform()
+	}
+	fmtr.applyBuildInfo()
+
 	// GlobalTraceID groups logs from runtime log entry
 	if fmtr.GlobalTraceID == "" {
 		id := uuid.Must(uuid.NewV4())
 		opt := WithGlobalTraceID(id)
 		opt(&fmtr)
 	}
+	if fmtr.ProjectID != "" {
+		fmtr.globalTrace = newTraceName(fmtr.ProjectID, fmtr.GlobalTraceID)
+	}
 	return &fmtr
 }
 
 // errorOrigin Extracts the report location from call stack.
 func (f *Formatter) errorOrigin() stack.Call {
-	// skip will skip packages and sub-packages from a list
-	skip := func(pkg string) bool {
-		for _, skip := range f.StackSkip {
-			if strings.Contains(pkg, skip) {
-				return true
-			}
-		}
-		return false
-	}
-
 	var r *regexp.Regexp
 	if f.RegexSkip != "" {
 		r = regexp.MustCompile(f.RegexSkip)
@@ -208,16 +435,17 @@ func (f *Formatter) errorOrigin() stack.Call {
 		if _, err := c.MarshalText(); err != nil {
 			return stack.Call{}
 		}
-		pkg := fmt.Sprintf("%+k", c)
-		// Remove vendoring from package path.
-		parts := strings.SplitN(pkg, "/vendor/", 2)
-		pkg = parts[len(parts)-1]
-		if !skip(pkg) && (r == nil || !r.MatchString(c.Frame().Function)) {
+		pkg := unvendor(fmt.Sprintf("%+k", c))
+		fn := c.Frame().Function
+		if !f.skipFrame(pkg, unvendor(fn)) && (r == nil || !r.MatchString(fn)) {
 			return c
 		}
 	}
 }
 
+// replaceErrors copies the fields of an entry, so that an entry may be logged
+// again unchanged, and formats errors as strings. Nested maps and slices are
+// copied too.
 // taken from https://github.com/sirupsen/logrus/blob/master/json_formatter.go#L51
 func replaceErrors(source logrus.Fields) logrus.Fields {
 	data := make(logrus.Fields, len(source))
@@ -226,73 +454,148 @@ func replaceErrors(source logrus.Fields) logrus.Fields {
 		case error:
 			// Otherwise errors are ignored by `encoding/json`
 			// https://github.com/sirupsen/logrus/issues/137
-			data[k] = v.Error()
+			data[k], _ = safeError(v)
 		default:
-			data[k] = v
+			data[k] = copyValue(v)
 		}
 	}
 	return data
 }
 
-// ToEntry formats a logrus entry to a stackdriver entry.
+// copyValue copies the maps and slices of generic values within a field
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case logrus.Fields:
+		c := make(logrus.Fields, len(v))
+		for k, e := range v {
+			c[k] = copyValue(e)
+		}
+		return c
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			c[k] = copyValue(e)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = copyValue(e)
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// ToEntry formats a logrus entry to a stackdriver entry. The logrus entry is
+// not modified, so that it may be logged again. The error is that of an
+// EntryMutator, in which case the entry is returned as composed before the
+// mutators ran.
 func (f *Formatter) ToEntry(e *logrus.Entry) (Entry, error) {
 	severity := levelsToSeverity[e.Level]
 
-	message := []string{}
+	// alerts are logged as such whichever level they were logged at
+	a, isAlert := e.Data[KeyAlert].(alert)
+	if isAlert {
+		severity = SeverityAlert
+	}
+
+	compose := f.composer()
 
 	ee := Entry{
 		Severity: severity,
-		Context: &Context{
-			Data: replaceErrors(e.Data),
-		},
 	}
-
-	// If provided, format the current active trace and span id's to correlate logs to traces
-	if tc, ok := e.Data[KeySpanContext]; ok {
-		if spanCtx, ok := tc.(trace.SpanContext); ok && spanCtx.IsValid() {
-			ee.Trace = fmt.Sprintf("projects/%s/traces/%s", f.ProjectID, spanCtx.TraceID())
-			ee.SpanID = spanCtx.SpanID().String()
-			ee.TraceSampled = spanCtx.IsSampled()
+	// context is only allocated once there is something to store in it, so
+	// that entries without fields omit it
+	data := replaceErrors(e.Data)
+	f.formatDurations(data)
+	f.formatProtos(data)
+	f.sanitizeData(data)
+
+	if isAlert {
+		ee.Labels = a.labels(f.AlertLabels)
+		delete(data, KeyAlert)
+	} else if len(f.AlertLabels) > 0 && (severity == SeverityAlert || severity == SeverityCritical) {
+		ee.Labels = make(map[string]string, len(f.AlertLabels))
+		for k, v := range f.AlertLabels {
+			ee.Labels[k] = v
 		}
-
-		delete(ee.Context.Data, KeySpanContext)
 	}
+	// labels added by the logging middleware, or with FieldLabels
+	if labels, ok := data[KeyLabels].(map[string]string); ok {
+		ee.addLabels(labels)
+		delete(data, KeyLabels)
+	}
+	// the component is a label too, to filter on without indexing the data
+	if component, ok := data[KeyComponent].(string); ok && component != "" {
+		ee.addLabels(map[string]string{KeyComponent: component})
+	}
+	ee.addLabels(f.KubernetesLabels)
 
-	if ee.Trace == "" {
-		ee.Trace = fmt.Sprintf("projects/%s/traces/%s", f.ProjectID, f.GlobalTraceID)
+	project := f.projectID(e)
+	ee.project = project
+	if _, ok := data[KeyGCPProject].(string); ok {
+		delete(data, KeyGCPProject)
 	}
 
-	if val, ok := e.Data[KeyLogID]; ok {
-		ee.LogName = "projects/" + f.ProjectID + "/logs/" + f.Service + "%2F" + val.(string)
-	} else {
-		ee.LogName = "projects/" + f.ProjectID + "/logs/" + f.Service
+	// If provided, format the current active trace and span id's to correlate logs to traces.
+	// The span_context field takes precedence over the span of the context of the entry,
+	// which is read without the SpanHook.
+	var spanCtx trace.SpanContext
+	if tc, ok := e.Data[KeySpanContext]; ok {
+		var foreign bool
+		if spanCtx, foreign = spanContextOf(tc); foreign {
+			ee.foreignSpan = fmt.Sprintf("%T", tc)
+		}
+		delete(data, KeySpanContext)
+	} else if e.Context != nil {
+		spanCtx = trace.SpanContextFromContext(e.Context)
+	}
+	if spanCtx.IsValid() {
+		if project != "" {
+			ee.Trace = fmt.Sprintf("projects/%s/traces/%s", project, spanCtx.TraceID())
+		}
+		ee.SpanID = spanCtx.SpanID().String()
+		ee.TraceSampled = spanCtx.IsSampled()
 	}
 
-	if len(e.Message) > 0 {
-		message = append(message, e.Message)
+	// Ideally, the Trace is set from a full SpanContext,
+	// sometimes we *only* have a Trace ID and/or Span ID
+	// and shouldn't throw those away
+	if traced := traceFields(&ee, data, project); traced || spanCtx.IsValid() {
+		// after the traceSampled field, which can't unmark errors
+		f.sampleErrorTrace(&ee, spanCtx)
 	}
 
-	if !f.SkipTimestamp {
-		if !e.Time.IsZero() {
-			ee.Timestamp = e.Time.UTC().Format(time.RFC3339Nano)
+	// resource names without a project are dropped by GCP, so are omitted
+	if project != "" {
+		if ee.Trace == "" {
+			ee.Trace = f.globalTraceName(project)
+		}
+
+		if logID, ok := e.Data[KeyLogID].(string); ok {
+			ee.LogName = "projects/" + project + "/logs/" + f.Service + "%2F" + logID
 		} else {
-			ee.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+			ee.LogName = "projects/" + project + "/logs/" + f.Service
 		}
 	}
 
+	ee.Message = compose(e.Message, nil, "")
+
+	if !f.SkipTimestamp {
+		ee.Timestamp = f.timestamp(e.Time)
+	}
+
 	// annotate where the log entry was produced
-	if e.Caller != nil {
-		// attempt first to read from logrus if SetReportCaller was configured
-		ee.SourceLocation = extractFromCaller(e)
-	} else {
-		// Extract report location from call stack.
-		c := f.errorOrigin()
-		lineNumber, _ := strconv.ParseInt(fmt.Sprintf("%d", c), 10, 64)
-		ee.SourceLocation = extractFromCallStack(c, lineNumber)
+	var origin string
+	ee.SourceLocation, origin = f.sourceLocation(e)
+	if f.SourceLocationDebug {
+		data[KeySourceLocationOrigin] = origin
 	}
 
 	switch severity {
-	case severityError, severityCritical, severityAlert:
+	case SeverityError, SeverityCritical, SeverityAlert:
 		ee.ServiceContext = &ServiceContext{
 			Service: f.Service,
 			Version: f.Version,
@@ -300,7 +603,11 @@ func (f *Formatter) ToEntry(e *logrus.Entry) (Entry, error) {
 
 		// annotate build information
 		if f.SourceReference != nil {
-			ee.Context.SourceReferences = f.SourceReference
+			ee.context().SourceReferences = f.SourceReference
+		}
+		if f.build != nil {
+			ee.context().GoVersion = f.build.goVersion
+			ee.context().BuildSettings = f.build.settings
 		}
 
 		// LogEntry.LogEntrySourceLocation is a different structure than ErrorContext.SourceLocation
@@ -308,7 +615,7 @@ func (f *Formatter) ToEntry(e *logrus.Entry) (Entry, error) {
 		// https://cloud.google.com/error-reporting/reference/rest/v1beta1/ErrorContext#SourceLocation
 		// https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#LogEntrySourceLocation
 		if ee.SourceLocation != nil {
-			ee.Context.ReportLocation = &ReportLocation{
+			ee.context().ReportLocation = &ReportLocation{
 				FilePath:     ee.SourceLocation.FilePath,
 				LineNumber:   ee.SourceLocation.LineNumber,
 				FunctionName: ee.SourceLocation.FunctionName,
@@ -319,86 +626,124 @@ func (f *Formatter) ToEntry(e *logrus.Entry) (Entry, error) {
 		// When using WithError(), the error is sent separately, but Error
 		// Reporting expects it to be a part of the message so we append it
 		// also.
-		if err, ok := e.Data[logrus.ErrorKey]; ok {
-			payloadTrace := f.StackStyle == TraceInPayload || f.StackStyle == TraceInBoth
+		var logErr error
+		var messageStack, errStack string
+		var stackFuncs []string
+		err, hasErr := f.loggedError(e)
+		loggedErr, _ := err.(error)
+		style := f.stackStyle(e, loggedErr)
+		if hasErr {
+			// report the primary error of a multi-error, so unrelated failures
+			// aren't grouped together, and list the others in context
+			if verr, ok := err.(error); ok && f.MaxAdditionalErrors > 0 {
+				if errs := unwrapMultiError(verr); errs != nil {
+					primary, rest := expandMultiError(errs)
+					if len(rest) > f.MaxAdditionalErrors {
+						rest = rest[:f.MaxAdditionalErrors]
+					}
+					additional := make([]string, 0, len(rest))
+					for _, r := range rest {
+						additional = append(additional, r.Error())
+					}
+					data[KeyAdditionalErrors] = additional
+					data[KeyErrorCount] = len(errs)
+					err = primary
+				}
+			}
+
+			if verr, ok := err.(error); ok && f.ErrorChain {
+				if chain := errorChain(verr); chain != nil {
+					data[KeyErrorChain] = chain
+				}
+			}
+
+			if verr, ok := err.(error); ok && f.CapturedLocals {
+				if locals := f.errorLocals(verr); locals != nil {
+					data[KeyLocals] = map[string]interface{}(locals)
+				}
+			}
+
+			if verr, ok := err.(error); ok && f.ErrorFingerprint {
+				stackFuncs = errorFunctions(verr)
+			}
+
+			payloadTrace := style == TraceInPayload || style == TraceInBoth
 			if verr, ok := err.(error); ok && payloadTrace {
 				if stackTrace := extractStackFromError(verr); stackTrace != nil {
-					stack := append(message, fmt.Sprintf("%s", stackTrace))
-					ee.StackTrace = strings.Join(stack, "\n")
+					errStack = f.trimStack(string(stackTrace))
 				}
 			}
 
 			// errors.WithStack formats the call stack to append to the message with %+v
 			// but this is not correctly formatted to be parsed by GCP Error Reporting
-			message = append(message, fmt.Sprintf("%v", err))
+			logErr = asError(err)
+		}
+
+		// Error Reporting groups errors by the first line of their report
+		if title, rest := f.errorTitle(data, logErr); title != "" {
+			compose = titled(compose, title, rest)
+		}
+		if errStack != "" {
+			ee.StackTrace = compose(e.Message, nil, errStack)
 		}
 
 		// If we supplied a stack trace, we can append it to the message.
 		// Stacktrace is assumed to be formatted by debug.Stack()
 		// Deliberately overwrites any stacktrace provided from the error
-		if st, ok := ee.Context.Data[KeyStackTrace]; ok {
+		if stack, ok := stackField(data); ok {
 			// Error Reporting assumes the first line of a stacktrace explains the error encountered
 			// Even if it's not in the message itself
-			stack := append(message, fmt.Sprintf("%+v", st))
 
-			if f.StackStyle == TraceInMessage || f.StackStyle == TraceInBoth {
-				message = stack
+			if f.ErrorFingerprint {
+				stackFuncs = stackFunctions(stack)
 			}
-			if f.StackStyle == TraceInPayload || f.StackStyle == TraceInBoth {
-				ee.StackTrace = strings.Join(stack, "\n")
+			stack = f.trimStack(stack)
+			if style == TraceInMessage || style == TraceInBoth {
+				messageStack = stack
+			}
+			if style == TraceInPayload || style == TraceInBoth {
+				ee.StackTrace = compose(e.Message, logErr, stack)
 			}
 
-			delete(ee.Context.Data, KeyStackTrace)
+			delete(data, KeyStackTrace)
+		}
+
+		ee.Message = compose(e.Message, logErr, messageStack)
+
+		// group errors by their call path, whichever lines it goes through
+		if fingerprint := f.errorFingerprint(stackFuncs); fingerprint != "" {
+			data[KeyErrorFingerprint] = fingerprint
+			if ee.Labels == nil {
+				ee.Labels = make(map[string]string, 1)
+			}
+			ee.Labels[LabelErrorFingerprint] = fingerprint
 		}
 
 		// @type as ReportedErrorEvent if all required fields may be provided
 		// https://cloud.google.com/error-reporting/docs/formatting-error-messages#json_representation
-		if len(message) > 0 && ee.ServiceContext.Service != "" &&
+		if style != TraceNone && ee.Message != "" && ee.ServiceContext.Service != "" &&
 			(ee.StackTrace != "" || ee.SourceLocation != nil) {
 			ee.Type = reportedErrorEventType
 		}
 	}
-	// Ideally, the Trace is set from a full SpanContext,
-	// sometimes we *only* have a Trace ID and/or Span ID
-	// and shouldn't throw those away
-	if val, ok := e.Data[KeyTrace]; ok {
-		if str, ok := val.(string); ok {
-			if f.ProjectID != "" {
-				ee.Trace = str
-				prefix := fmt.Sprintf("projects/%s/traces/", f.ProjectID)
-				if !strings.HasPrefix(str, prefix) {
-					str = prefix + str
-				}
-			}
-			ee.Trace = str
-			delete(ee.Context.Data, KeyTrace)
-		}
-	}
-
-	if val, ok := e.Data[KeySpanID]; ok {
-		if str, ok := val.(string); ok {
-			ee.SpanID = str
-			delete(ee.Context.Data, KeySpanID)
-		}
-	}
-
 	// UserID, email, or arbitrary token identifying a user can be provided to an error report
-	if userData, ok := ee.Context.Data[KeyUser]; ok {
-		if user, ok := userData.(string); ok {
-			ee.Context.User = user
-			delete(ee.Context.Data, KeyUser)
-		}
-		if user, ok := userData.(fmt.Stringer); ok {
-			ee.Context.User = user.String()
-			delete(ee.Context.Data, KeyUser)
-		}
+	switch user := data[KeyUser].(type) {
+	case string:
+		ee.context().User = user
+		delete(data, KeyUser)
+	case fmt.Stringer:
+		ee.context().User = safeString(user)
+		delete(data, KeyUser)
 	}
 
 	// As a convenience, when supplying the httpRequest field, it
 	// gets special care.
-	if req, ok := ee.Context.Data[KeyHTTPRequest].(*HTTPRequest); ok {
-		ee.Context.HTTPRequest = req
-		delete(ee.Context.Data, KeyHTTPRequest)
+	httpReq, reserved := ee.requestField(data, requestlog.KeyHTTPRequest, KeyHTTPRequest)
+	if req, ok := httpReq.(*HTTPRequest); ok {
+		ee.context().HTTPRequest = newHTTPRequestContext(req)
+		if !reserved {
+			delete(data, KeyHTTPRequest)
+		}
 	}
 
 	// Promote the httpRequest details to parent entry so logs may be presented with HTTP request
@@ -406,34 +751,79 @@ func (f *Formatter) ToEntry(e *logrus.Entry) (Entry, error) {
 	// Only do this when the logging middleware provides special instructions in log entry
 	// context to do so, as the resulting log message summary line is specially formatted to ignore
 	// the payload message
-	if req, ok := ee.Context.Data[KeyHTTPRequest].(requestDetails); ok {
+	if req, ok := httpReq.(requestlog.Details); ok {
 		ee.HTTPRequest = req.HTTPRequest
-		delete(ee.Context.Data, KeyHTTPRequest)
+		// Error Reporting reads the request of an error event from its context
+		if req.ReportError && ee.Type == reportedErrorEventType {
+			ee.context().HTTPRequest = newHTTPRequestContext(req.HTTPRequest)
+		}
+		if !reserved {
+			delete(data, KeyHTTPRequest)
+		}
 	}
 
 	// As a convenience, when supplying the grpcRequest field, it
 	// gets special care.
-	if req, ok := ee.Context.Data["grpcRequest"].(*GRPCRequest); ok {
-		ee.Context.GRPCRequest = req
-		delete(ee.Context.Data, "grpcRequest")
+	grpcReq, reserved := ee.requestField(data, requestlog.KeyGRPCRequest, KeyGRPCRequest)
+	if req, ok := grpcReq.(*GRPCRequest); ok {
+		ee.context().GRPCRequest = req
+		if !reserved {
+			delete(data, KeyGRPCRequest)
+		}
 	}
 
 	// As a convenience, when supplying the grpcStatus field, it
 	// gets special care.
-	if req, ok := ee.Context.Data["grpcStatus"].(json.RawMessage); ok {
-		ee.Context.GRPCStatus = req
-		delete(ee.Context.Data, "grpcStatus")
+	grpcStatus, reserved := ee.requestField(data, requestlog.KeyGRPCStatus, KeyGRPCStatus)
+	switch st := grpcStatus.(type) {
+	case json.RawMessage:
+		ee.context().GRPCStatus = st
+		if !reserved {
+			delete(data, KeyGRPCStatus)
+		}
+	case *GRPCStatusDetails:
+		ee.context().GRPCStatusDetails = st
+		if !reserved {
+			delete(data, KeyGRPCStatus)
+		}
 	}
 
 	// As a convenience, when supplying the pubSubRequest field, it
 	// gets special care.
-	if req, ok := ee.Context.Data[KeyPubSubRequest].(map[string]interface{}); ok {
-		ee.Context.PubSubRequest = req
-		delete(ee.Context.Data, KeyPubSubRequest)
+	if req, ok := data[KeyPubSubRequest].(map[string]interface{}); ok {
+		ee.context().PubSubRequest = req
+		delete(data, KeyPubSubRequest)
+	}
+
+	// the operation of the entry is promoted to its root
+	if op, ok := data[KeyOperation].(*Operation); ok {
+		ee.Operation = op
+		delete(data, KeyOperation)
+	}
+
+	f.reserveKeys(data)
+	f.coerceFields(data)
+	if len(data) > 0 {
+		ee.context().Data = data
+	}
+
+	f.adjustForPlatform(&ee)
+
+	ee.Message = sanitize(ee.Message, f.StripANSI)
+	ee.StackTrace = sanitize(ee.StackTrace, f.StripANSI)
+
+	var err error
+	if len(f.EntryMutators) > 0 {
+		ee, err = f.mutate(e, ee)
 	}
 
-	ee.Message = strings.Join(message, "\n")
-	return ee, nil
+	if f.LegacyFieldNames {
+		ee.LegacySourceLocation = ee.SourceLocation
+		ee.LegacyMessage = ee.Message
+	}
+	ee.LogSchema = f.SchemaVersion
+
+	return ee, err
 }
 
 func extractFromCaller(e *logrus.Entry) *SourceLocation {
@@ -444,25 +834,94 @@ func extractFromCaller(e *logrus.Entry) *SourceLocation {
 	}
 }
 
-func extractFromCallStack(c stack.Call, lineNumber int64) *SourceLocation {
+// extractFromCallStack returns the source location of a call, or nil if its
+// frame is unknown, such as at the end of a truncated stack
+func extractFromCallStack(c stack.Call) *SourceLocation {
+	frame := c.Frame()
+	if frame.File == "" || frame.Line <= 0 {
+		return nil
+	}
 	return &SourceLocation{
-		FilePath:     fmt.Sprintf("%+s", c),
-		LineNumber:   int(lineNumber),
-		FunctionName: fmt.Sprintf("%n", c),
+		FilePath:     pkgFilePath(frame),
+		LineNumber:   frame.Line,
+		FunctionName: funcName(frame.Function),
+	}
+}
+
+// pkgFilePath returns the path of the file of a frame from the import path
+// of its package, as go-stack formats it with %+s
+func pkgFilePath(frame runtime.Frame) string {
+	file := frame.File
+	if i := strings.LastIndex(file, "/"); i != -1 {
+		file = file[strings.LastIndex(file[:i], "/")+1:]
+	}
+	if i := strings.LastIndex(frame.Function, "/"); i != -1 {
+		return frame.Function[:i] + "/" + file
 	}
+	return file
+}
+
+// funcName strips the package from the name of a function, as go-stack
+// formats it with %n
+func funcName(name string) string {
+	if i := strings.LastIndex(name, "/"); i != -1 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i != -1 {
+		name = name[i+1:]
+	}
+	return name
 }
 
 // Format formats a logrus entry according to the Stackdriver specifications.
 func (f *Formatter) Format(e *logrus.Entry) (b []byte, err error) {
 	ee, _ := f.ToEntry(e)
 
-	if f.PrettyPrint {
-		b, err = json.MarshalIndent(ee, "", "\t")
-	} else {
-		b, err = json.Marshal(ee)
+	enc := f.Encoder
+	reuse := enc != nil && e.Buffer != nil
+	var buf []byte
+	if enc == nil {
+		enc = JSONEncoder{PrettyPrint: f.PrettyPrint}
+	} else if reuse {
+		// logrus writes the formatted entry before reusing its buffer
+		buf = e.Buffer.Bytes()[:0]
+	}
+	b, err = f.encode(enc, &ee, buf)
+	if err == nil && f.SizeReporter != nil && f.sampleSize() {
+		f.reportSize(b, ee.Severity)
+	}
+	if err == nil && f.ValidationHandler != nil {
+		if verr := ValidateEntry(b); verr != nil {
+			f.ValidationHandler(verr)
+		}
 	}
-
 	b = append(b, '\n')
+	if reuse && cap(b) > e.Buffer.Cap() {
+		// keep the grown buffer for the next entry logged
+		*e.Buffer = *bytes.NewBuffer(b[:0])
+	}
+
+	if ee.project == "" {
+		b = prependNotice(&f.projectIDWarning, b, SeverityWarning, projectIDUnsetMessage)
+	}
+	if len(ee.collisions) > 0 {
+		b = prependNotice(&f.collisionWarning, b, SeverityWarning,
+			keyCollisionMessage+strings.Join(ee.collisions, ", "))
+	}
+	if ee.foreignSpan != "" && e.Logger != nil && e.Logger.IsLevelEnabled(logrus.DebugLevel) {
+		b = prependNotice(&f.spanContextNote, b, SeverityDebug,
+			fmt.Sprintf(foreignSpanContextMessage, ee.foreignSpan))
+	}
+
+	f.countFormatted(err)
+	if f.Metrics != nil {
+		if err != nil {
+			f.Metrics.IncFormatErrors()
+		} else {
+			f.Metrics.IncEntries(string(ee.Severity))
+			f.Metrics.ObserveEntryBytes(string(ee.Severity), len(b))
+		}
+	}
 
 	return
 }
@@ -4,14 +4,15 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"runtime"
 	"testing"
 
 	"github.com/gofrs/uuid"
 
 	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -19,28 +20,26 @@ func TestFormatter(t *testing.T) {
 	for i := range formatterTests {
 		tt := formatterTests[i]
 		t.Run(tt.name, func(t *testing.T) {
-			var out bytes.Buffer
-
-			logger := logrus.New()
-			logger.Out = &out
-			logger.Formatter = logadapter.NewFormatter(
-				logadapter.WithProjectID("test-project"),
-				logadapter.WithService("test"),
-				logadapter.WithVersion("0.1"),
-				logadapter.WithSkipTimestamp(),
-				logadapter.WithSourceReference(
-					"https://github.com/StevenACoffman/test.git",
-					"v1.2.3",
+			logger, rec := logtest.NewRecorder(
+				logtest.WithFormatterOptions(
+					logadapter.WithVersion("0.1"),
+					logadapter.WithSourceReference(
+						"https://github.com/StevenACoffman/test.git",
+						"v1.2.3",
+					),
 				),
-				logadapter.WithGlobalTraceID(TraceID),
+				logtest.WithStableSourceLocation(),
 			)
 			tt.run(logger)
 
-			got, err := json.Marshal(tt.out)
-			if err != nil {
-				t.Error(err)
-			}
-			assert.JSONEq(t, string(got), out.String())
+			entry, ok := rec.LastEntry()
+			require.True(t, ok)
+			assert.Empty(t, rec.ValidationErrors(), "entries are valid")
+			got, err := json.Marshal(entry)
+			require.NoError(t, err)
+			want, err := json.Marshal(tt.out)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(want), string(got))
 		})
 	}
 }
@@ -52,7 +51,6 @@ var (
 	SpanContext = trace.SpanContext{}.WithSpanID(SpanID).
 			WithTraceID(trace.TraceID(TraceID)).
 			WithTraceFlags(TraceFlags)
-	LineNumber = platformLine()
 )
 
 var formatterTests = []struct {
@@ -82,9 +80,9 @@ var formatterTests = []struct {
 				},
 			},
 			"logging.googleapis.com/sourceLocation": map[string]interface{}{
-				"file":     "testing/testing.go",
-				"function": "tRunner",
-				"line":     LineNumber,
+				"file":     logtest.StableFile,
+				"function": logtest.StableFunction,
+				"line":     logtest.StableLine,
 			},
 		},
 	},
@@ -120,15 +118,15 @@ var formatterTests = []struct {
 					},
 				},
 				"reportLocation": map[string]interface{}{
-					"filePath":     "testing/testing.go",
-					"lineNumber":   LineNumber,
-					"functionName": "tRunner",
+					"filePath":     logtest.StableFile,
+					"lineNumber":   logtest.StableLine,
+					"functionName": logtest.StableFunction,
 				},
 			},
 			"logging.googleapis.com/sourceLocation": map[string]interface{}{
-				"file":     "testing/testing.go",
-				"line":     LineNumber,
-				"function": "tRunner",
+				"file":     logtest.StableFile,
+				"line":     logtest.StableLine,
+				"function": logtest.StableFunction,
 			},
 		},
 	},
@@ -166,15 +164,15 @@ var formatterTests = []struct {
 					},
 				},
 				"reportLocation": map[string]interface{}{
-					"filePath":     "testing/testing.go",
-					"lineNumber":   LineNumber,
-					"functionName": "tRunner",
+					"filePath":     logtest.StableFile,
+					"lineNumber":   logtest.StableLine,
+					"functionName": logtest.StableFunction,
 				},
 			},
 			"logging.googleapis.com/sourceLocation": map[string]interface{}{
-				"file":     "testing/testing.go",
-				"line":     LineNumber,
-				"function": "tRunner",
+				"file":     logtest.StableFile,
+				"line":     logtest.StableLine,
+				"function": logtest.StableFunction,
 			},
 		},
 	},
@@ -207,14 +205,15 @@ var formatterTests = []struct {
 			"context": map[string]interface{}{
 				"data": map[string]interface{}{
 					"foo": "bar",
-					"httpRequest": map[string]interface{}{
+					// named like the httpRequest of the entry
+					"data_httpRequest": map[string]interface{}{
 						"requestMethod": "GET",
 					},
 				},
 				"reportLocation": map[string]interface{}{
-					"filePath":     "testing/testing.go",
-					"lineNumber":   LineNumber,
-					"functionName": "tRunner",
+					"filePath":     logtest.StableFile,
+					"lineNumber":   logtest.StableLine,
+					"functionName": logtest.StableFunction,
 				},
 				"sourceReferences": []map[string]interface{}{
 					{
@@ -224,21 +223,34 @@ var formatterTests = []struct {
 				},
 			},
 			"logging.googleapis.com/sourceLocation": map[string]interface{}{
-				"file":     "testing/testing.go",
-				"line":     LineNumber,
-				"function": "tRunner",
+				"file":     logtest.StableFile,
+				"line":     logtest.StableLine,
+				"function": logtest.StableFunction,
 			},
 		},
 	},
 }
 
-func platformLine() float64 {
-	switch runtime.GOOS {
-	case "darwin":
-		return 1193.0
-	case "linux":
-		return 1439.0
-	default: // does anyone really use windows?
-		return 0.0
+func TestOmitEmptyContext(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	logger.Info("application up and running")
+	assert.NotContains(t, out.String(), `"context"`, "a bare line has no context")
+
+	out.Reset()
+	logger.WithField(logadapter.KeySpanContext, SpanContext).Info("handled trace")
+	logger.WithField("user", "alice").Info("signed in")
+
+	dec := json.NewDecoder(&out)
+	for _, want := range []interface{}{nil, map[string]interface{}{"user": "alice"}} {
+		var got map[string]interface{}
+		assert.NoError(t, dec.Decode(&got))
+		assert.Equal(t, want, got["context"])
 	}
 }
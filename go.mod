@@ -4,17 +4,23 @@ go 1.16
 
 require (
 	github.com/felixge/httpsnoop v1.0.2
+	github.com/go-chi/chi/v5 v5.0.8
 	github.com/go-kit/kit v0.10.0
+	github.com/go-logr/logr v1.2.3
 	github.com/go-stack/stack v1.8.0
 	github.com/gofrs/uuid v4.0.0+incompatible
 	github.com/google/go-cmp v0.5.5
+	github.com/gorilla/mux v1.8.0
 	github.com/grpc-ecosystem/go-grpc-middleware v1.3.0
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.9.0
 	github.com/sirupsen/logrus v1.8.1
 	github.com/stretchr/testify v1.7.0
+	go.opentelemetry.io/otel v0.20.0
 	go.opentelemetry.io/otel/trace v0.20.0
 	golang.org/x/sys v0.0.0-20210220050731-9a76102bfb43 // indirect
 	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013
 	google.golang.org/grpc v1.37.0
 	google.golang.org/protobuf v1.26.0
+	k8s.io/klog/v2 v2.80.1
 )
@@ -0,0 +1,153 @@
+// Package gokit provides an adapter to the
+// go-kit log.Logger interface.
+package gokit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	gokitlog "github.com/go-kit/kit/log"
+	"github.com/sirupsen/logrus"
+)
+
+// Logger is a gokit-compatible wrapper for a logrus.Logger
+type Logger struct {
+	logrusLogger
+}
+
+type logrusLogger interface {
+	WithFields(fields logrus.Fields) *logrus.Entry
+}
+
+// NewLogger creates a gokit-compatible logger
+func NewLogger(logger logrusLogger) *Logger {
+	return &Logger{logger}
+}
+
+const (
+	msgKey      = "msg"
+	messageKey  = "message"
+	errKey      = "err"
+	errorKey    = "error"
+	severityKey = "severity"
+	levelKey    = "level"
+)
+
+// Log implements the fundamental Logger interface.
+//
+// Entries are never logged at logrus' PanicLevel without recovering from its
+// panic, so that logging at ALERT severity does not unwind the caller.
+func (l Logger) Log(keyvals ...interface{}) error {
+	fields, level, msg := l.extractLogElements(keyvals...)
+
+	entry := l.WithFields(fields)
+	if level == logrus.PanicLevel {
+		defer func() {
+			_ = recover()
+		}()
+	}
+	entry.Log(level, msg)
+
+	return nil
+}
+
+// extractLogElements iterates through the keyvals to form well
+// structured key:value pairs that Logrus expects. It also checks for keys with
+// special meaning like "msg" and "level" to format the log entry
+func (l Logger) extractLogElements(
+	keyVals ...interface{},
+) (logrus.Fields, logrus.Level, string) {
+	msg, errMsg := "", ""
+	hasMsg := false
+	fields := logrus.Fields{}
+	level := logrus.DebugLevel
+	var explicit []logrus.Level
+
+	for i := 0; i < len(keyVals); i += 2 {
+		fieldKey := fmt.Sprint(keyVals[i])
+		if i+1 >= len(keyVals) {
+			// odd pair key, with no matching value
+			fields[fieldKey] = gokitlog.ErrMissingValue
+			continue
+		}
+
+		fieldValue := fmt.Sprint(keyVals[i+1])
+		switch fieldKey {
+		case msgKey, messageKey:
+			// if this is a "msg" key, store it separately so we can use it as the
+			// main log message
+			if hasMsg {
+				fields[fieldKey] = keyVals[i+1]
+				continue
+			}
+			msg, hasMsg = fieldValue, true
+		case errKey, errorKey:
+			// if this is a "err" key, we should use the error message as
+			// the main message and promote the level to Error
+			if fieldValue != "" {
+				errMsg = fieldValue
+				explicit = append(explicit, logrus.ErrorLevel)
+			}
+		case levelKey, severityKey:
+			// if this is a "level" key, it means GoKit logger is giving us
+			// a hint to the logging level
+			if parsed, ok := parseLevel(fieldValue); ok {
+				explicit = append(explicit, parsed)
+			} else {
+				// keep what we could not make sense of, and draw attention to it
+				explicit = append(explicit, logrus.ErrorLevel)
+				fields[fieldKey] = fieldValue
+			}
+		default:
+			// this is just regular log data, add it as a key:value pair
+			fields[fieldKey] = keyVals[i+1]
+		}
+	}
+
+	// the most severe level wins, logrus levels being ordered from Panic = 0
+	for i, l := range explicit {
+		if i == 0 || l < level {
+			level = l
+		}
+	}
+
+	if errMsg != "" {
+		// the error is the main message, keeping any message alongside
+		if hasMsg {
+			fields[msgKey] = msg
+		}
+		msg = errMsg
+	}
+	return fields, level, msg
+}
+
+// levelAliases maps level names, case-insensitively, to logrus levels. It
+// includes the names of logrus and go-kit levels, and of GCP severities.
+var levelAliases = map[string]logrus.Level{
+	"trace":     logrus.TraceLevel,
+	"debug":     logrus.DebugLevel,
+	"info":      logrus.InfoLevel,
+	"notice":    logrus.InfoLevel,
+	"warn":      logrus.WarnLevel,
+	"warning":   logrus.WarnLevel,
+	"error":     logrus.ErrorLevel,
+	"dpanic":    logrus.FatalLevel,
+	"critical":  logrus.FatalLevel,
+	"fatal":     logrus.FatalLevel,
+	"alert":     logrus.PanicLevel,
+	"emergency": logrus.PanicLevel,
+	"panic":     logrus.PanicLevel,
+}
+
+// parseLevel resolves a level by name or logrus level number
+func parseLevel(s string) (logrus.Level, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if l, ok := levelAliases[s]; ok {
+		return l, true
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n <= int(logrus.TraceLevel) {
+		return logrus.Level(n), true
+	}
+	return 0, false
+}
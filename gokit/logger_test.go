@@ -0,0 +1,209 @@
+package gokit
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockLogrusLogger struct{}
+
+func (l *mockLogrusLogger) GetLevel() logrus.Level {
+	return logrus.DebugLevel
+}
+
+func (l *mockLogrusLogger) WithFields(fields logrus.Fields) *logrus.Entry {
+	return &logrus.Entry{}
+}
+
+func TestLogger_extractLogElements_basic(t *testing.T) {
+	mockLogrus := &mockLogrusLogger{}
+	logger := &Logger{mockLogrus}
+
+	fields, level, msg := logger.extractLogElements(
+		"msg", "testy mctestface",
+		"level", "error",
+		"foo", "bar",
+		"number", 42,
+		"flag", true)
+
+	expectedFields := logrus.Fields{}
+	expectedFields["foo"] = "bar"
+	expectedFields["number"] = 42
+	expectedFields["flag"] = true
+
+	assert.Equal(t, expectedFields, fields)
+	assert.Equal(t, logrus.ErrorLevel, level)
+	assert.Equal(t, "testy mctestface", msg)
+}
+
+func TestLogger_extractLogElements_defaultLevel(t *testing.T) {
+	mockLogrus := &mockLogrusLogger{}
+	logger := &Logger{mockLogrus}
+
+	fields, level, msg := logger.extractLogElements("msg", "testy mctestface")
+
+	expectedFields := logrus.Fields{}
+
+	assert.Equal(t, expectedFields, fields)
+	assert.Equal(t, logrus.DebugLevel, level)
+	assert.Equal(t, "testy mctestface", msg)
+}
+
+func TestLogger_extractLogElements_errorOverride(t *testing.T) {
+	mockLogrus := &mockLogrusLogger{}
+	logger := &Logger{mockLogrus}
+
+	fields, level, msg := logger.extractLogElements(
+		"err", "test error",
+		"msg", "some message",
+		"level", "debug",
+		"number", 42,
+		"flag", true,
+	)
+
+	expectedFields := logrus.Fields{}
+	expectedFields["msg"] = "some message"
+	expectedFields["number"] = 42
+	expectedFields["flag"] = true
+
+	assert.Equal(t, expectedFields, fields)
+	assert.Equal(t, logrus.ErrorLevel, level)
+	assert.Equal(t, "test error", msg)
+}
+
+func TestLogger_extractLogElements_levels(t *testing.T) {
+	logger := &Logger{&mockLogrusLogger{}}
+
+	for _, tcase := range []struct {
+		value interface{}
+		want  logrus.Level
+	}{
+		{"trace", logrus.TraceLevel},
+		{"debug", logrus.DebugLevel},
+		{"DEBUG", logrus.DebugLevel},
+		{"info", logrus.InfoLevel},
+		{"INFO", logrus.InfoLevel},
+		{"notice", logrus.InfoLevel},
+		{"warn", logrus.WarnLevel},
+		{"Warn", logrus.WarnLevel},
+		{"warning", logrus.WarnLevel},
+		{"WARNING", logrus.WarnLevel},
+		{"error", logrus.ErrorLevel},
+		{"ERROR", logrus.ErrorLevel},
+		{"dpanic", logrus.FatalLevel},
+		{"CRITICAL", logrus.FatalLevel},
+		{"fatal", logrus.FatalLevel},
+		{"ALERT", logrus.PanicLevel},
+		{"EMERGENCY", logrus.PanicLevel},
+		{"panic", logrus.PanicLevel},
+		{"0", logrus.PanicLevel},
+		{"3", logrus.WarnLevel},
+		{4, logrus.InfoLevel},
+		{" 6 ", logrus.TraceLevel},
+		{logrus.WarnLevel, logrus.WarnLevel},
+	} {
+		for _, key := range []string{"level", "severity"} {
+			name := fmt.Sprintf("%s=%v", key, tcase.value)
+			t.Run(name, func(t *testing.T) {
+				fields, level, msg := logger.extractLogElements(
+					"msg", "testy mctestface",
+					key, tcase.value,
+				)
+				assert.Equal(t, tcase.want, level)
+				assert.Equal(t, logrus.Fields{}, fields, "no helper keys are added")
+				assert.Equal(t, "testy mctestface", msg)
+			})
+		}
+	}
+}
+
+func TestLogger_extractLogElements_conflicts(t *testing.T) {
+	logger := &Logger{&mockLogrusLogger{}}
+
+	for _, tcase := range []struct {
+		name       string
+		keyVals    []interface{}
+		wantLevel  logrus.Level
+		wantMsg    string
+		wantFields logrus.Fields
+	}{
+		{
+			name:       "explicit level below default",
+			keyVals:    []interface{}{"msg", "m", "level", "warn"},
+			wantLevel:  logrus.WarnLevel,
+			wantMsg:    "m",
+			wantFields: logrus.Fields{},
+		},
+		{
+			name:       "error with less severe level",
+			keyVals:    []interface{}{"msg", "m", "level", "info", "err", "boom"},
+			wantLevel:  logrus.ErrorLevel,
+			wantMsg:    "boom",
+			wantFields: logrus.Fields{"msg": "m"},
+		},
+		{
+			name:       "error with more severe level",
+			keyVals:    []interface{}{"err", "boom", "severity", "CRITICAL", "msg", "m"},
+			wantLevel:  logrus.FatalLevel,
+			wantMsg:    "boom",
+			wantFields: logrus.Fields{"msg": "m"},
+		},
+		{
+			name:       "most severe of several levels",
+			keyVals:    []interface{}{"level", "warn", "severity", "ERROR", "level", "debug"},
+			wantLevel:  logrus.ErrorLevel,
+			wantFields: logrus.Fields{},
+		},
+		{
+			name:       "empty error",
+			keyVals:    []interface{}{"msg", "m", "error", "", "level", "info"},
+			wantLevel:  logrus.InfoLevel,
+			wantMsg:    "m",
+			wantFields: logrus.Fields{},
+		},
+		{
+			name:       "unparseable level",
+			keyVals:    []interface{}{"msg", "m", "level", "loud"},
+			wantLevel:  logrus.ErrorLevel,
+			wantMsg:    "m",
+			wantFields: logrus.Fields{"level": "loud"},
+		},
+		{
+			name:       "unparseable level with error",
+			keyVals:    []interface{}{"err", "boom", "severity", "7"},
+			wantLevel:  logrus.ErrorLevel,
+			wantMsg:    "boom",
+			wantFields: logrus.Fields{"severity": "7"},
+		},
+		{
+			name:       "message key alias",
+			keyVals:    []interface{}{"message", "m", "msg", "other"},
+			wantLevel:  logrus.DebugLevel,
+			wantMsg:    "m",
+			wantFields: logrus.Fields{"msg": "other"},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			fields, level, msg := logger.extractLogElements(tcase.keyVals...)
+			assert.Equal(t, tcase.wantLevel, level)
+			assert.Equal(t, tcase.wantMsg, msg)
+			assert.Equal(t, tcase.wantFields, fields)
+		})
+	}
+}
+
+func TestLogger_LogAlertDoesNotPanic(t *testing.T) {
+	var out bytes.Buffer
+	logrusLogger := logrus.New()
+	logrusLogger.Out = &out
+	logger := NewLogger(logrusLogger)
+
+	assert.NotPanics(t, func() {
+		_ = logger.Log("msg", "disk full", "severity", "ALERT")
+	})
+	assert.Contains(t, out.String(), "disk full", "the entry is still written")
+}
@@ -1,4 +1,4 @@
-package logadapter_test
+package grpcmw_test
 
 import (
 	"context"
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/grpcmw"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/interop"
@@ -76,37 +77,37 @@ func BenchmarkMiddleware(b *testing.B) {
 		{
 			Name: "UnaryLoggingInterceptor",
 			Middlewares: []grpc.ServerOption{
-				grpc.UnaryInterceptor(logadapter.UnaryLoggingInterceptor(logger)),
+				grpc.UnaryInterceptor(grpcmw.UnaryLoggingInterceptor(logger)),
 			},
 		},
 		{
 			Name: "StreamLoggingInterceptor",
 			Middlewares: []grpc.ServerOption{
-				grpc.StreamInterceptor(logadapter.StreamLoggingInterceptor(logger)),
+				grpc.StreamInterceptor(grpcmw.StreamLoggingInterceptor(logger)),
 			},
 		},
 		{
 			Name: "UnaryRecoverInterceptor",
 			Middlewares: []grpc.ServerOption{
-				grpc.UnaryInterceptor(logadapter.UnaryRecoveryInterceptor),
+				grpc.UnaryInterceptor(grpcmw.UnaryRecoveryInterceptor),
 			},
 		},
 		{
 			Name: "StreamRecoverInterceptor",
 			Middlewares: []grpc.ServerOption{
-				grpc.StreamInterceptor(logadapter.StreamRecoveryInterceptor),
+				grpc.StreamInterceptor(grpcmw.StreamRecoveryInterceptor),
 			},
 		},
 		{
 			Name: "LoggingRecoverInterceptor",
 			Middlewares: []grpc.ServerOption{
 				grpc.ChainUnaryInterceptor(
-					logadapter.UnaryLoggingInterceptor(logger),
-					logadapter.UnaryRecoveryInterceptor,
+					grpcmw.UnaryLoggingInterceptor(logger),
+					grpcmw.UnaryRecoveryInterceptor,
 				),
 				grpc.ChainStreamInterceptor(
-					logadapter.StreamLoggingInterceptor(logger),
-					logadapter.StreamRecoveryInterceptor,
+					grpcmw.StreamLoggingInterceptor(logger),
+					grpcmw.StreamRecoveryInterceptor,
 				),
 			},
 		},
@@ -0,0 +1,174 @@
+package grpcmw
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/flushers"
+	"github.com/sirupsen/logrus"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// healthCheckOK is the code recorded for a health check that returned SERVING
+// without an error
+const healthCheckOK = "ok"
+
+// maxHealthCheckKeys bounds the distinct method/code pairs counted in a single
+// interval, anything past it is folded into healthCheckOtherMethod
+const (
+	maxHealthCheckKeys     = 32
+	healthCheckOtherMethod = "other"
+)
+
+type healthCheckKey struct {
+	method string
+	code   string
+}
+
+// healthCheckSummary counts health checks dropped by the RPC filter so they
+// may be reported as a single entry per interval. Summaries are logged on a
+// ticker, so that the last counts are logged once health checks stop, and
+// the ticker stops after an interval without any.
+type healthCheckSummary struct {
+	logger   *logrus.Logger
+	interval time.Duration
+
+	mu      sync.Mutex
+	start   time.Time
+	counts  map[healthCheckKey]int
+	running bool
+}
+
+func newHealthCheckSummary(logger *logrus.Logger, interval time.Duration) *healthCheckSummary {
+	return &healthCheckSummary{
+		logger:   logger,
+		interval: interval,
+		counts:   make(map[healthCheckKey]int),
+	}
+}
+
+// isHealthCheck reports whether the method belongs to the standard gRPC health service
+func isHealthCheck(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/grpc.health")
+}
+
+// healthCheckCode describes the outcome of a health check, preferring the
+// gRPC status code on error and the serving status of the response otherwise
+func healthCheckCode(resp interface{}, err error) string {
+	if err != nil {
+		return status.Code(err).String()
+	}
+
+	if r, ok := resp.(interface {
+		GetStatus() healthpb.HealthCheckResponse_ServingStatus
+	}); ok && r.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return r.GetStatus().String()
+	}
+
+	return healthCheckOK
+}
+
+// observe counts a health check outcome towards the current interval,
+// starting the ticker logging the summaries if need be.
+func (h *healthCheckSummary) observe(method, code string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.running {
+		h.running = true
+		h.start = time.Now()
+		go h.run(flushers.Register(h))
+	}
+
+	key := healthCheckKey{method: method, code: code}
+	if _, ok := h.counts[key]; !ok && len(h.counts) >= maxHealthCheckKeys {
+		key.method = healthCheckOtherMethod
+	}
+	h.counts[key]++
+}
+
+// run logs a summary every interval, until an interval without health checks
+func (h *healthCheckSummary) run(unregister func()) {
+	defer unregister()
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !h.emit(true) {
+			return
+		}
+	}
+}
+
+// Flush logs the summary of the health checks counted so far, such as
+// before the program exits.
+func (h *healthCheckSummary) Flush(context.Context) error {
+	h.emit(false)
+	return nil
+}
+
+// emit logs a summary of the health checks counted since the last one, as a
+// warning if any of them failed, and starts counting anew. It reports whether
+// any were counted, stopping the ticker when idle if stopIdle.
+func (h *healthCheckSummary) emit(stopIdle bool) bool {
+	now := time.Now()
+	h.mu.Lock()
+	counts, start := h.counts, h.start
+	h.counts = make(map[healthCheckKey]int)
+	h.start = now
+	if len(counts) == 0 && stopIdle {
+		h.running = false
+	}
+	h.mu.Unlock()
+	if len(counts) == 0 {
+		return false
+	}
+
+	byCode := map[string]int{}
+	byMethod := map[string]map[string]int{}
+	for k, n := range counts {
+		byCode[k.code] += n
+		if byMethod[k.method] == nil {
+			byMethod[k.method] = map[string]int{}
+		}
+		byMethod[k.method][k.code] += n
+	}
+
+	failed := false
+	codeNames := make([]string, 0, len(byCode))
+	for c := range byCode {
+		if c != healthCheckOK {
+			failed = true
+			codeNames = append(codeNames, c)
+		}
+	}
+	sort.Strings(codeNames)
+
+	parts := []string{fmt.Sprintf("%d %s", byCode[healthCheckOK], healthCheckOK)}
+	for _, c := range codeNames {
+		parts = append(parts, fmt.Sprintf("%d %s", byCode[c], c))
+	}
+
+	entry := h.logger.WithField("healthChecks", byMethod)
+	msg := fmt.Sprintf("health checks: %s in last %gs",
+		strings.Join(parts, ", "), roundWindow(now.Sub(start)).Seconds())
+	if failed {
+		entry.Warn(msg)
+	} else {
+		entry.Info(msg)
+	}
+	return true
+}
+
+// roundWindow rounds the duration of an interval for its summary, to the
+// second, or to the millisecond for intervals shorter than a second
+func roundWindow(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Second)
+}
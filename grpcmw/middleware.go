@@ -0,0 +1,642 @@
+// Package grpcmw provides gRPC interceptors that write request logs, and a
+// request-scoped log entry, formatted for stackdriver.
+package grpcmw
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/requestlog"
+	"github.com/gofrs/uuid"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// UnaryLoggingInterceptor provides a request-scoped log entry into context for
+// Unary gRPC requests, and logs request details on the response.
+// Logging interceptors should be chained at the very top of the request scope.
+func UnaryLoggingInterceptor(
+	logger *logrus.Logger,
+	opts ...MiddlewareOption,
+) grpc.UnaryServerInterceptor {
+	return newLoggingInterceptor(logger, opts).intercept
+}
+
+// StreamLoggingInterceptor provides a request-scoped log entry into context for
+// Streaming gRPC requests, and logs request details at the end of the stream.
+// Logging interceptors should be chained at the very top of the request scope.
+func StreamLoggingInterceptor(
+	logger *logrus.Logger,
+	opts ...MiddlewareOption,
+) grpc.StreamServerInterceptor {
+	return newLoggingInterceptor(logger, opts).interceptStream
+}
+
+type loggingInterceptor struct {
+	logger       *logrus.Logger
+	healthChecks *healthCheckSummary
+	*middleware.Options
+}
+
+func newLoggingInterceptor(logger *logrus.Logger, opts []MiddlewareOption) loggingInterceptor {
+	o := middleware.Evaluate(defaultOptions, opts)
+	l := loggingInterceptor{logger: logger, Options: o}
+	if o.HealthCheckInterval > 0 {
+		l.healthChecks = newHealthCheckSummary(logger, o.HealthCheckInterval)
+	}
+	return l
+}
+
+// withLogger initializes the log entry in context, including any tags set
+// with grpc_ctxtags and the user identified in the entries extracted from it,
+// and the accumulators of request errors, calls to dependencies and the
+// identity of the client
+func (l loggingInterceptor) withLogger(ctx context.Context) context.Context {
+	ctx = middleware.WithLogger(ctx, l.logger)
+	ctx = middleware.WithRequestErrors(ctx, l.RequestErrorLimit)
+	ctx = middleware.WithDependencies(ctx)
+	ctxlogrus.AddFieldsFunc(ctx, func(ctx context.Context) logrus.Fields {
+		return grpc_ctxtags.Extract(ctx).Values()
+	})
+	if l.UserExtractor != nil {
+		middleware.AddUser(ctx, l.UserExtractor)
+	}
+	return middleware.WithIdentity(ctx)
+}
+
+func (l loggingInterceptor) intercept(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	startTime := time.Now()
+	ctx = l.withLogger(ctx)
+	ctx = middleware.WithPhases(ctx, startTime)
+	middleware.MarkPhase(ctx, middleware.PhaseInterceptorStart)
+	if l.ErrorHandlerV2 != nil {
+		ctx = middleware.WithPanicRecord(ctx)
+	}
+
+	request := l.requestFromContext(ctx, info.FullMethod, startTime)
+
+	stopStart := func() {}
+	if l.RequestStartLog && l.FilterRPC(ctx, info.FullMethod, nil) {
+		stopStart = l.logRequestStart(ctx, request)
+		// the start of an RPC panicking is not logged after the panic
+		defer stopStart()
+	}
+
+	resp, err := handler(ctx, req)
+	stopStart()
+	middleware.MarkPhase(ctx, middleware.PhaseHandlerDone)
+
+	elapsed := completeRequest(ctx, request, startTime)
+	request.Phases = phaseDurations(ctx)
+
+	l.log(ctx, resp, err, info.FullMethod, request, elapsed)
+
+	return resp, err
+}
+
+func (l loggingInterceptor) interceptStream(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	startTime := time.Now()
+	ctx := l.withLogger(ss.Context())
+	if l.ErrorHandlerV2 != nil {
+		ctx = middleware.WithPanicRecord(ctx)
+	}
+
+	request := l.requestFromContext(ctx, info.FullMethod, startTime)
+
+	// the wrapped stream only replaces the context, which keeps the transport
+	// stream of ss, and sets headers and trailers through ss
+	wrapped := grpc_middleware.WrapServerStream(ss)
+	wrapped.WrappedContext = ctx
+	var stream grpc.ServerStream = wrapped
+	if l.PerMessageScope {
+		var reset func()
+		// installed before the handler, so that inner interceptors wrap the
+		// scoped context, and opened on the first message, so that the fields
+		// they add to the stream are kept
+		wrapped.WrappedContext, reset = ctxlogrus.WithDeferredScope(ctx)
+		stream = &scopedServerStream{WrappedServerStream: wrapped, reset: reset}
+	}
+
+	err := handler(srv, stream)
+
+	elapsed := completeRequest(ctx, request, startTime)
+
+	l.log(ctx, nil, err, info.FullMethod, request, elapsed)
+
+	return err
+}
+
+// logRequestStart logs the start of an RPC with a copy of its details, and
+// the simulacrum of an HTTPRequest without status and latency
+func (l loggingInterceptor) logRequestStart(
+	ctx context.Context,
+	request *requestlog.GRPCRequest,
+) (stop func()) {
+	started := *request
+	fields := logrus.Fields{
+		requestlog.KeyGRPCRequest: &started,
+		requestlog.KeyHTTPRequest: requestlog.Details{
+			HTTPRequest: &requestlog.HTTPRequest{
+				RequestMethod: http.MethodPost,
+				RequestURL:    request.Method,
+				UserAgent:     request.UserAgent,
+				RemoteIP:      request.PeerAddr,
+				Protocol:      "gRPC",
+			},
+		},
+	}
+	return middleware.LogRequestStart(l.RequestStartThreshold, func() *logrus.Entry {
+		return ctxlogrus.Extract(ctx).WithFields(fields)
+	})
+}
+
+// scopedServerStream discards the fields added to its context as each
+// message is received, keeping those added before the first one
+type scopedServerStream struct {
+	*grpc_middleware.WrappedServerStream
+	reset func()
+}
+
+func (s *scopedServerStream) RecvMsg(m interface{}) error {
+	s.reset()
+	return s.WrappedServerStream.RecvMsg(m)
+}
+
+// requestFromContext creates gRPC request details with information extracted from the request
+// context
+func (l *loggingInterceptor) requestFromContext(
+	ctx context.Context,
+	method string,
+	startTime time.Time,
+) *requestlog.GRPCRequest {
+	request := &requestlog.GRPCRequest{Method: method}
+
+	if d, ok := ctx.Deadline(); ok {
+		request.Deadline = d.UTC().Format(time.RFC3339Nano)
+		request.TimeoutBudget = formatDuration(d.Sub(startTime))
+	}
+
+	if p, ok := peer.FromContext(ctx); ok && p != nil {
+		u := &url.URL{
+			Scheme: p.Addr.Network(),
+			Host:   p.Addr.String(),
+		}
+		request.PeerAddr = u.String()
+		if l.PeerIdentity {
+			peerIdentity(request, p.AuthInfo)
+		}
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok && md != nil {
+		request.UserAgent = strings.Join(md.Get("user-agent"), "")
+		if v := md.Get("grpc-timeout"); len(v) > 0 {
+			if d, ok := decodeTimeout(v[0]); ok {
+				request.Timeout = formatDuration(d)
+			}
+		}
+		if v := md.Get("grpc-previous-rpc-attempts"); len(v) > 0 {
+			if n, err := strconv.Atoi(v[0]); err == nil && n >= 0 {
+				request.Attempt = n + 1
+			}
+		}
+		if len(l.MetadataFields) > 0 {
+			ctxlogrus.AddFields(ctx, middleware.RequestFields(l.MetadataFields, md.Get))
+		}
+	}
+
+	ctxlogrus.AddFields(ctx, logrus.Fields{requestlog.KeyGRPCRequest: request})
+
+	return request
+}
+
+// completeRequest records the duration of the call, and how much of its
+// deadline budget remained when it completed
+func completeRequest(
+	ctx context.Context,
+	request *requestlog.GRPCRequest,
+	startTime time.Time,
+) time.Duration {
+	now := time.Now()
+	elapsed := now.Sub(startTime)
+	request.Duration = formatDuration(elapsed)
+	if d, ok := ctx.Deadline(); ok {
+		request.BudgetRemaining = formatDuration(d.Sub(now))
+	}
+	return elapsed
+}
+
+// phaseDurations formats the durations of the phases of an RPC
+func phaseDurations(ctx context.Context) map[string]string {
+	durations := middleware.PhaseDurations(ctx)
+	if durations == nil {
+		return nil
+	}
+	phases := make(map[string]string, len(durations))
+	for name, d := range durations {
+		phases[name] = formatDuration(d)
+	}
+	return phases
+}
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.5fs", d.Seconds())
+}
+
+// timeoutUnits maps the units of the grpc-timeout header to durations
+var timeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// decodeTimeout parses a grpc-timeout value, an ASCII integer of at most 8
+// digits followed by a unit
+func decodeTimeout(s string) (time.Duration, bool) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, false
+	}
+	unit, ok := timeoutUnits[s[len(s)-1]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// logStatus adds the gRPC Status to the log context.
+// If the response is an internal server error, log that as an Error
+// returns true if the logging was handled (e.g. internal server error)
+func (l *loggingInterceptor) log(
+	ctx context.Context,
+	resp interface{},
+	err error,
+	method string,
+	request *requestlog.GRPCRequest,
+	elapsed time.Duration,
+) {
+	if !l.FilterRPC(ctx, method, err) {
+		l.observeHealthCheck(ctx, resp, err, method)
+		return
+	}
+
+	l.Metrics.IncRequests(middleware.StatusClass(statusRPCToHTTP(err)))
+
+	if isContextCode(status.Code(err)) {
+		ctxlogrus.AddFields(ctx, middleware.ContextFields(ctx))
+	}
+	errs := middleware.RequestErrorFields(ctx)
+	if errs != nil {
+		ctxlogrus.AddFields(ctx, errs)
+	}
+	if deps := middleware.DependencyFields(ctx); deps != nil {
+		ctxlogrus.AddFields(ctx, deps)
+	}
+	if l.RPCSLOClassifier != nil {
+		ctxlogrus.AddFields(ctx, middleware.SLOFields(
+			l.RPCSLOClassifier(method, uint32(status.Code(err)), elapsed)))
+	}
+
+	if handled := l.handleError(ctx, err, method, request, elapsed); handled {
+		return
+	}
+
+	// write a simulacrum of the HTTPRequest as defined on LogEntry spec:
+	// https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#HttpRequest
+	// This allows log lines to be formatted with special little widgets in GCP
+	// logs view just like the Load Balancer logs
+	httpReq := requestlog.Details{
+		HTTPRequest: &requestlog.HTTPRequest{
+			RequestMethod: http.MethodPost,
+			RequestURL:    request.Method,
+			UserAgent:     request.UserAgent,
+			Latency:       request.Duration,
+			RemoteIP:      request.PeerAddr,
+			Protocol:      "gRPC",
+			// TODO:
+			// ResponseSize: "",
+			Status: strconv.Itoa(statusRPCToHTTP(err)),
+		},
+	}
+
+	// if we reach here, the response either wasn't a bad error worth handling (e.g. NotFound and
+	// its ilk)
+	if l.NoSummaryLog {
+		return
+	}
+	entry := ctxlogrus.Extract(ctx).WithField(requestlog.KeyHTTPRequest, httpReq)
+	level := logrus.InfoLevel
+	if errs != nil {
+		failed := statusRPCToHTTP(err) >= http.StatusInternalServerError
+		level = middleware.RequestErrorLevel(level, failed)
+	}
+	level, slow := l.LatencyLevel(level, elapsed)
+	if slow {
+		entry = entry.WithField("slowRequest", true)
+	}
+	entry.Log(level, middleware.DependencyMessage(ctx, l.summaryMessage(method, err, elapsed)))
+}
+
+// summaryMessage composes the message of the entry logged for an RPC
+func (l *loggingInterceptor) summaryMessage(
+	method string,
+	err error,
+	elapsed time.Duration,
+) string {
+	if l.RPCSummaryMessage != nil {
+		return l.RPCSummaryMessage(method, uint32(status.Code(err)), elapsed)
+	}
+	return fmt.Sprintf("served RPC %v", method)
+}
+
+// observeHealthCheck counts a filtered health check towards the periodic
+// summary, if enabled, and logs it individually when it has failed, whether
+// or not the summary is enabled
+func (l *loggingInterceptor) observeHealthCheck(
+	ctx context.Context,
+	resp interface{},
+	err error,
+	method string,
+) {
+	if !isHealthCheck(method) {
+		return
+	}
+
+	code := healthCheckCode(resp, err)
+	if l.healthChecks != nil {
+		l.healthChecks.observe(method, code)
+	}
+
+	if code == healthCheckOK {
+		return
+	}
+
+	entry := ctxlogrus.Extract(ctx)
+	if err != nil {
+		entry = entry.WithError(err)
+	}
+	entry.Warnf("failed health check %v: %v", method, code)
+}
+
+// handleError adds grpcStatus to logentry, and can handle our most egregious errors
+// returns true if the default Info logger should be skipped
+func (l *loggingInterceptor) handleError(
+	ctx context.Context,
+	err error,
+	method string,
+	request *requestlog.GRPCRequest,
+	elapsed time.Duration,
+) (handled bool) {
+	if err == nil {
+		return false
+	}
+	st := status.Convert(err)
+
+	fields := logrus.Fields{}
+	if l.StructuredGRPCStatus {
+		structured := structuredStatus(st)
+		if !l.DecodedStatusDetails {
+			// retained for pipelines reading the raw status
+			if raw, merr := marshalStatus(st); merr == nil {
+				structured.Raw = raw
+			}
+		}
+		fields[requestlog.KeyGRPCStatus] = structured
+	} else {
+		raw := st
+		if l.DecodedStatusDetails {
+			raw = status.New(st.Code(), st.Message())
+		}
+		// add grpcStatus to log entry, if available
+		jsonStatus, merr := marshalStatus(raw)
+		if merr != nil {
+			// this should never actually happen, so we log it to help identify
+			// why our gRPC status error isn't included in logs
+			ctxlogrus.Extract(ctx).WithError(merr).Warnf("error marshalling error status into log")
+			return false
+		}
+		fields[requestlog.KeyGRPCStatus] = jsonStatus
+		// decode the well-known error details, which are hard to read raw
+		if details := decodeStatusDetails(st); details != nil {
+			fields["grpcStatusDetails"] = details
+		}
+	}
+	ctxlogrus.AddFields(ctx, fields)
+	// if we're about to return an internal server error to the client, always log as Error level.
+	if st.Code() == codes.Internal {
+		msg := fmt.Sprintf("internal error response on RPC %s", method)
+		entry := ctxlogrus.Extract(ctx).WithError(err)
+		entry.Error(msg)
+		if l.ErrorHandlerV2 != nil {
+			l.ErrorHandlerV2(ctx, l.errorReport(ctx, entry, logrus.ErrorLevel, msg, err, request))
+		}
+		return true
+	}
+
+	// opportunity to log or transform the error with a custom error handler
+	// If the error handler indicates logging has been handled already, we
+	// return early and do not log as Info down below
+	handled = l.ErrorHandler(ctx, err, method)
+	if l.ErrorHandlerV2 != nil {
+		entry := ctxlogrus.Extract(ctx).WithError(err)
+		msg := l.summaryMessage(method, err, elapsed)
+		report := l.errorReport(ctx, entry, logrus.InfoLevel, msg, err, request)
+		handled = l.ErrorHandlerV2(ctx, report) || handled
+	}
+	return handled
+}
+
+// marshalStatus marshals a status with protojson. Details of unregistered
+// types can't be marshalled, so the status is then marshalled without them,
+// as they are still listed by type URL in its decoded details.
+func marshalStatus(st *status.Status) (json.RawMessage, error) {
+	marshal := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal
+	jsonStatus, err := marshal(st.Proto())
+	if err != nil {
+		jsonStatus, err = marshal(status.New(st.Code(), st.Message()).Proto())
+	}
+	return jsonStatus, err
+}
+
+// errorReport composes the report of an RPC error for ErrorHandlerV2
+func (l *loggingInterceptor) errorReport(
+	ctx context.Context,
+	entry *logrus.Entry,
+	level logrus.Level,
+	msg string,
+	err error,
+	request *requestlog.GRPCRequest,
+) *middleware.ErrorReport {
+	report := middleware.NewErrorReport(ctx, entry, level, msg)
+	if report.Err == nil {
+		report.Err = err
+	}
+	report.GRPCRequest = request
+	switch st := entry.Data[requestlog.KeyGRPCStatus].(type) {
+	case json.RawMessage:
+		report.GRPCStatus = st
+	case *requestlog.GRPCStatusDetails:
+		report.GRPCStatus = st.Raw
+		report.GRPCStatusDetails = st
+	}
+	return report
+}
+
+// UnaryPhaseInterceptor marks the start of the handler of an RPC as its
+// handler_start phase, so that its summary logs the duration of the handler
+// apart from the interceptors chained before it. It should be chained last.
+func UnaryPhaseInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	middleware.MarkPhase(ctx, middleware.PhaseHandlerStart)
+	return handler(ctx, req)
+}
+
+// UnaryRecoveryInterceptor is an interceptor that recovers panics and turns them
+// into nicer GRPC errors. The error logged has the method and peer of the RPC,
+// even without the logging interceptor.
+func UnaryRecoveryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (resp interface{}, err error) {
+	defer func() {
+		e := recover()
+		if e == nil {
+			return
+		}
+
+		err = middleware.PanicError(e)
+
+		stErr := errWithStack(ctx, err, info.FullMethod)
+		err = stErr.Err()
+		resp = nil
+	}()
+
+	return handler(ctx, req)
+}
+
+// StreamRecoveryInterceptor is an interceptor that recovers panics from
+// Streaming services and turns them into nicer gRPC errors. The error logged
+// has the method and peer of the RPC, even without the logging interceptor.
+func StreamRecoveryInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) (err error) {
+	defer func() {
+		e := recover()
+		if e == nil {
+			return
+		}
+
+		err = middleware.PanicError(e)
+
+		stErr := errWithStack(ss.Context(), err, info.FullMethod)
+		err = stErr.Err()
+	}()
+
+	return handler(srv, ss)
+}
+
+// errWithStack generates a stack trace, logs it, and provides an internal
+// server error response back to return to the client
+func errWithStack(ctx context.Context, err error, method string) *status.Status {
+	request := &requestlog.GRPCRequest{Method: method}
+	if p, ok := peer.FromContext(ctx); ok && p != nil {
+		request.PeerAddr = (&url.URL{Scheme: p.Addr.Network(), Host: p.Addr.String()}).String()
+	}
+	middleware.LogPanic(ctx, err, logrus.Fields{requestlog.KeyGRPCRequest: request})
+
+	serverError := status.New(codes.Internal, "server error")
+	reqID, _ := uuid.NewV4()
+	// generate a shared UUID we can find this log entry from client-provided response body
+	stErr, _ := serverError.WithDetails(&errdetails.RequestInfo{
+		RequestId: reqID.String(),
+	})
+	return stErr
+}
+
+// Convert server-sent RPC status codes to HTTP-equivalent.
+// ONLY FOR USE IN LOG.
+func statusRPCToHTTP(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+
+	st := status.Convert(err)
+	switch st.Code() {
+	case codes.Canceled:
+		return http.StatusRequestTimeout // ESP converts this to nginx status 499, which isn't real
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.Aborted:
+		return http.StatusConflict
+	case codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Internal:
+		return http.StatusInternalServerError
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// isContextCode reports whether an RPC failed with a code that stems from its
+// context ending
+func isContextCode(code codes.Code) bool {
+	return code == codes.DeadlineExceeded || code == codes.Canceled
+}
@@ -0,0 +1,1540 @@
+package grpcmw_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/grpcmw"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	grpc_testing "github.com/grpc-ecosystem/go-grpc-middleware/testing"
+	pb_testproto "github.com/grpc-ecosystem/go-grpc-middleware/testing/testproto"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestServerSuite(t *testing.T) {
+	s := newGRPCTestSuite(t)
+	tenant := grpcmw.WithMetadataFields(map[string]string{"x-tenant-id": "tenantID"})
+	s.InterceptorTestSuite.ServerOpts = []grpc.ServerOption{
+		grpc_middleware.WithStreamServerChain(
+			grpcmw.StreamLoggingInterceptor(s.logger, tenant),
+			grpcmw.StreamRecoveryInterceptor,
+		),
+		grpc_middleware.WithUnaryServerChain(
+			grpcmw.UnaryLoggingInterceptor(s.logger, tenant),
+			grpcmw.UnaryRecoveryInterceptor,
+		),
+	}
+
+	suite.Run(t, &logFormatterSuite{s})
+}
+
+type logFormatterSuite struct {
+	*grpcTestSuite
+}
+
+func (s *logFormatterSuite) TestPanic() {
+	deadline := time.Now().Add(3 * time.Second)
+	panicPing := &pb_testproto.PingRequest{Value: "pls panic", SleepTimeMs: 9999}
+	_, err := s.Client.Ping(s.DeadlineCtx(deadline), panicPing)
+
+	require.Error(s.T(), err, "panic in an RPC returns error to client")
+
+	st := status.Convert(err)
+	reqID := ""
+	for _, detail := range st.Details() {
+		if ri, ok := detail.(*errdetails.RequestInfo); ok {
+			reqID = ri.RequestId
+		}
+	}
+	assert.NotEmpty(
+		s.T(),
+		reqID,
+		"panic in RPC returns a requestID to correlate logs back to client-reported error",
+	)
+
+	var logged map[string]interface{}
+	for _, msg := range s.getOutputJSONs() {
+		if msg["message"] != nil &&
+			strings.HasPrefix(msg["message"].(string), "panic handling request") {
+			logged = msg
+		}
+	}
+	require.NotNil(s.T(), logged, "panic is logged")
+	assert.Equal(s.T(),
+		"panic handling request: test panic RPC",
+		strings.SplitN(logged["message"].(string), "\n", 2)[0],
+		"panic message is the first line")
+
+	stack := logged["stack_trace"].(string)
+	i := strings.Index(stack, "panic: test panic RPC\n\ngoroutine ")
+	require.NotEqual(s.T(), -1, i, "stack trace reads as a runtime panic")
+	frames := strings.SplitN(stack[i:], "\n", 8)[2:7]
+	for _, line := range frames {
+		assert.NotContains(s.T(), line, "runtime/debug")
+		assert.NotContains(s.T(), line, "internal/middleware")
+		assert.NotContains(s.T(), line, "RecoveryInterceptor")
+		assert.NotContains(s.T(), line, "errWithStack")
+	}
+	assert.Contains(s.T(), frames[1], "Ping", "stack starts at the code that panicked")
+}
+
+func (s *logFormatterSuite) TestGood() {
+	deadline := time.Now().Add(3 * time.Second)
+	ctx := s.DeadlineCtx(deadline)
+
+	md := metadata.Pairs("X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1")
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	_, err := s.Client.Ping(ctx, goodPing)
+
+	require.NoError(s.T(), err, "can't error on successful call")
+
+	msgs := s.getOutputJSONs()
+	require.Len(s.T(), msgs, 2, "two messages should be logged")
+}
+
+func (s *logFormatterSuite) TestDeadlineBudget() {
+	deadline := time.Now().Add(3 * time.Second)
+	ctx := s.DeadlineCtx(deadline)
+	ctx = metadata.AppendToOutgoingContext(ctx, "grpc-previous-rpc-attempts", "2")
+
+	_, err := s.Client.Ping(ctx, goodPing)
+	require.NoError(s.T(), err)
+
+	msgs := s.getOutputJSONs()
+	require.Len(s.T(), msgs, 2, "two messages should be logged")
+	logCtx := msgs[1]["context"].(map[string]interface{})
+	request := logCtx["grpcRequest"].(map[string]interface{})
+
+	budget, err := time.ParseDuration(request["timeoutBudget"].(string))
+	require.NoError(s.T(), err)
+	assert.True(s.T(), budget > 2*time.Second && budget <= 3*time.Second,
+		"budget %v is close to the deadline", budget)
+	remaining, err := time.ParseDuration(request["budgetRemaining"].(string))
+	require.NoError(s.T(), err)
+	assert.Positive(s.T(), int64(remaining))
+	assert.LessOrEqual(s.T(), int64(remaining), int64(budget))
+	assert.Equal(s.T(), float64(3), request["attempt"], "third attempt after two previous")
+}
+
+func (s *logFormatterSuite) TestMetadataFields() {
+	for _, tcase := range []struct {
+		name   string
+		values []string
+		want   interface{}
+	}{
+		{"single", []string{"acme"}, "acme"},
+		{"multiple", []string{"acme", "globex"}, "acme,globex"},
+		{"truncated", []string{strings.Repeat("a", 300)}, strings.Repeat("a", 256)},
+		{"empty", []string{""}, nil},
+		{"missing", nil, nil},
+	} {
+		s.Run(tcase.name, func() {
+			s.SetupTest()
+			ctx := s.DeadlineCtx(time.Now().Add(3 * time.Second))
+			for _, v := range tcase.values {
+				ctx = metadata.AppendToOutgoingContext(ctx, "x-tenant-id", v)
+			}
+
+			_, err := s.Client.Ping(ctx, goodPing)
+			require.NoError(s.T(), err)
+
+			msgs := s.getOutputJSONs()
+			require.Len(s.T(), msgs, 2, "two messages should be logged")
+			assert.Equal(s.T(), "some ping", msgs[0]["message"])
+			assert.Equal(s.T(), "served RPC /mwitkow.testproto.TestService/Ping",
+				msgs[1]["message"])
+			for _, msg := range msgs {
+				data, _ := msg["context"].(map[string]interface{})["data"].(map[string]interface{})
+				assert.Equal(s.T(), tcase.want, data["tenantID"])
+			}
+		})
+	}
+}
+
+func (s *logFormatterSuite) TestError() {
+	for _, tcase := range []struct {
+		code     codes.Code
+		level    logrus.Level
+		msg      string
+		logError bool
+	}{
+		{
+			code:     codes.Internal,
+			msg:      "Internal errors returned to client will be logged",
+			logError: true,
+		},
+		{
+			code:     codes.NotFound,
+			logError: false,
+		},
+	} {
+		// TODO: validate Error log format
+		s.buffer.Reset()
+		_, err := s.Client.PingError(s.SimpleCtx(), &pb_testproto.PingRequest{
+			Value:             "anything",
+			ErrorCodeReturned: uint32(tcase.code),
+		})
+		require.Error(s.T(), err, "each call returns an error")
+
+		msgs := s.getOutputJSONs()
+		require.Len(s.T(), msgs, 1, "only logging interceptor printed in PingErr")
+
+		if tcase.logError {
+			assert.Equal(s.T(), "ERROR", msgs[0]["severity"], "error is logged as error")
+			assert.Equal(
+				s.T(),
+				"type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent",
+				msgs[0]["@type"],
+				"errors are typed to force Error Reporting parsing",
+			)
+		}
+	}
+}
+
+func (s *logFormatterSuite) TestWithStack() {
+	_, err := s.Client.PingError(s.SimpleCtx(), &pb_testproto.PingRequest{
+		Value:             "stack",
+		ErrorCodeReturned: uint32(codes.Aborted),
+	})
+
+	require.Error(s.T(), err, "call returns error")
+}
+
+// TODO: X-Cloud-Trace header
+
+func TestHealthCheckSummary(t *testing.T) {
+	out := grpc_testing.NewMutexReadWriter(&bytes.Buffer{})
+	logger := logrus.New()
+	logger.Out = out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithService("logging-test"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	interval := 50 * time.Millisecond
+	intercept := grpcmw.UnaryLoggingInterceptor(
+		logger,
+		grpcmw.WithHealthCheckSummary(interval),
+	)
+	info := &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}
+	check := func(st healthpb.HealthCheckResponse_ServingStatus) {
+		_, _ = intercept(
+			context.Background(),
+			&healthpb.HealthCheckRequest{},
+			info,
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return &healthpb.HealthCheckResponse{Status: st}, nil
+			},
+		)
+	}
+
+	for i := 0; i < 5; i++ {
+		check(healthpb.HealthCheckResponse_SERVING)
+	}
+	for i := 0; i < 2; i++ {
+		check(healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+
+	// health checks stop, and the summary is still logged once the interval
+	// elapsed
+	var logged bytes.Buffer
+	require.Eventually(t, func() bool {
+		_, _ = logged.ReadFrom(out)
+		return bytes.Count(logged.Bytes(), []byte("\n")) >= 3
+	}, time.Second, interval/5)
+
+	var msgs []map[string]interface{}
+	for dec := json.NewDecoder(&logged); dec.More(); {
+		var val map[string]interface{}
+		require.NoError(t, dec.Decode(&val))
+		msgs = append(msgs, val)
+	}
+	require.Len(t, msgs, 3, "two failed health checks and one summary are logged")
+
+	for _, msg := range msgs[:2] {
+		assert.Equal(t, "WARNING", msg["severity"])
+		assert.Equal(t,
+			"failed health check /grpc.health.v1.Health/Check: NOT_SERVING",
+			msg["message"])
+	}
+
+	summary := msgs[2]
+	assert.Equal(t, "WARNING", summary["severity"], "failures escalate the summary")
+	assert.Regexp(t, `^health checks: 5 ok, 2 NOT_SERVING in last 0\.0[5-9]\d*s$`,
+		summary["message"], "the elapsed interval is logged")
+	data := summary["context"].(map[string]interface{})["data"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"/grpc.health.v1.Health/Check": map[string]interface{}{
+			"ok":          float64(5),
+			"NOT_SERVING": float64(2),
+		},
+	}, data["healthChecks"])
+}
+
+func TestHealthCheckFailedWithoutSummary(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithService("logging-test"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	intercept := grpcmw.UnaryLoggingInterceptor(logger)
+	info := &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}
+	for _, st := range []healthpb.HealthCheckResponse_ServingStatus{
+		healthpb.HealthCheckResponse_SERVING,
+		healthpb.HealthCheckResponse_NOT_SERVING,
+	} {
+		_, _ = intercept(
+			context.Background(),
+			&healthpb.HealthCheckRequest{},
+			info,
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return &healthpb.HealthCheckResponse{Status: st}, nil
+			},
+		)
+	}
+
+	var msgs []map[string]interface{}
+	for dec := json.NewDecoder(&out); dec.More(); {
+		var val map[string]interface{}
+		require.NoError(t, dec.Decode(&val))
+		msgs = append(msgs, val)
+	}
+	require.Len(t, msgs, 1, "only the failed health check is logged, despite the filter")
+	assert.Equal(t, "WARNING", msgs[0]["severity"])
+	assert.Equal(t,
+		"failed health check /grpc.health.v1.Health/Check: NOT_SERVING",
+		msgs[0]["message"])
+}
+
+func TestRPCDeadlineExceeded(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	intercept := grpcmw.UnaryLoggingInterceptor(logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := intercept(
+		ctx,
+		&pb_testproto.PingRequest{},
+		&grpc.UnaryServerInfo{FullMethod: "/mwitkow.testproto.TestService/Ping"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			time.Sleep(20 * time.Millisecond)
+			return nil, status.Error(codes.DeadlineExceeded, ctx.Err().Error())
+		},
+	)
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+	assert.Equal(t, context.DeadlineExceeded.Error(), data["contextError"])
+	remaining, err := time.ParseDuration(data["deadlineRemaining"].(string))
+	require.NoError(t, err)
+	assert.Negative(t, int64(remaining), "deadline has been exceeded")
+	assert.NotContains(t, data, "cancelCause", "the deadline has no explicit cause")
+}
+
+func TestRPCTimeoutMetadata(t *testing.T) {
+	for _, tcase := range []struct {
+		header string
+		want   interface{}
+	}{
+		{"1500m", "1.50000s"},
+		{"2S", "2.00000s"},
+		{"1H", "3600.00000s"},
+		{"250000u", "0.25000s"},
+		{"100x", nil},
+		{"123456789S", nil},
+	} {
+		t.Run(tcase.header, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			intercept := grpcmw.UnaryLoggingInterceptor(logger)
+			ctx := metadata.NewIncomingContext(context.Background(),
+				metadata.Pairs("grpc-timeout", tcase.header))
+			_, err := intercept(
+				ctx,
+				&pb_testproto.PingRequest{},
+				&grpc.UnaryServerInfo{FullMethod: "/mwitkow.testproto.TestService/Ping"},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					return &pb_testproto.PingResponse{}, nil
+				},
+			)
+			require.NoError(t, err)
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+			logCtx := got["context"].(map[string]interface{})
+			request := logCtx["grpcRequest"].(map[string]interface{})
+			assert.Equal(t, tcase.want, request["timeout"])
+			assert.NotContains(t, request, "timeoutBudget", "no deadline is set")
+			assert.NotContains(t, request, "attempt")
+		})
+	}
+}
+
+func TestRPCLatencyThresholds(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	intercept := grpcmw.UnaryLoggingInterceptor(
+		logger,
+		grpcmw.WithLatencyThresholds(10*time.Millisecond, time.Second),
+	)
+	_, err := intercept(
+		context.Background(),
+		&pb_testproto.PingRequest{},
+		&grpc.UnaryServerInfo{FullMethod: "/mwitkow.testproto.TestService/Ping"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			time.Sleep(20 * time.Millisecond)
+			return &pb_testproto.PingResponse{}, nil
+		},
+	)
+	require.NoError(t, err)
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	assert.Equal(t, "WARNING", got["severity"])
+	data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+	assert.Equal(t, true, data["slowRequest"])
+	assert.Contains(t, got, "httpRequest", "request details are still promoted")
+}
+
+func TestRPCRequestErrors(t *testing.T) {
+	for _, tcase := range []struct {
+		name     string
+		err      error
+		severity string
+	}{
+		{"succeeded", nil, "WARNING"},
+		{"not found", status.Error(codes.NotFound, "no such order"), "WARNING"},
+		{"unavailable", status.Error(codes.Unavailable, "try again"), "ERROR"},
+		{"internal", status.Error(codes.Internal, "broken"), "ERROR"},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			intercept := grpcmw.UnaryLoggingInterceptor(logger)
+			_, _ = intercept(
+				context.Background(),
+				&pb_testproto.PingRequest{},
+				&grpc.UnaryServerInfo{FullMethod: "/mwitkow.testproto.TestService/Ping"},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					logadapter.AddRequestError(ctx, errors.New("stale cache"))
+					return &pb_testproto.PingResponse{}, tcase.err
+				},
+			)
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+			assert.Equal(t, tcase.severity, got["severity"])
+			data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+			logged := data[logadapter.KeyRequestErrors].([]interface{})
+			require.Len(t, logged, 1)
+			assert.Equal(t, "stale cache", logged[0].(map[string]interface{})["message"])
+		})
+	}
+}
+
+func TestRPCSLOClassifier(t *testing.T) {
+	slos := grpcmw.SLOTable{{Name: "ping", Prefix: "/mwitkow.testproto.TestService/Ping"}}
+	for _, tcase := range []struct {
+		name      string
+		method    string
+		err       error
+		eligible  bool
+		violation bool
+	}{
+		{"eligible", "/mwitkow.testproto.TestService/Ping", nil, true, false},
+		{"client error", "/mwitkow.testproto.TestService/Ping",
+			status.Error(codes.NotFound, "no such order"), true, false},
+		{"server error", "/mwitkow.testproto.TestService/Ping",
+			status.Error(codes.Unavailable, "try again"), true, true},
+		{"ineligible", "/mwitkow.testproto.OtherService/Ping",
+			status.Error(codes.Unavailable, "try again"), false, false},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			intercept := grpcmw.UnaryLoggingInterceptor(logger,
+				grpcmw.WithSLOClassifier(slos.ClassifyRPC))
+			_, _ = intercept(
+				context.Background(),
+				&pb_testproto.PingRequest{},
+				&grpc.UnaryServerInfo{FullMethod: tcase.method},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					return &pb_testproto.PingResponse{}, tcase.err
+				},
+			)
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+			data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+			assert.Equal(t, tcase.eligible, data["sloEligible"])
+			assert.Equal(t, tcase.violation, data["sloViolation"])
+			if !tcase.eligible {
+				assert.NotContains(t, data, "sloName")
+				return
+			}
+			assert.Equal(t, "ping", data["sloName"])
+			assert.Equal(t, map[string]interface{}{"slo": "ping"},
+				got["logging.googleapis.com/labels"])
+		})
+	}
+}
+
+func TestRPCDependencyCalls(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	intercept := grpcmw.UnaryLoggingInterceptor(logger)
+	_, _ = intercept(
+		context.Background(),
+		&pb_testproto.PingRequest{},
+		&grpc.UnaryServerInfo{FullMethod: "/mwitkow.testproto.TestService/Ping"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			logadapter.StartDependencyCall(ctx, "cache").End(nil)
+			call := logadapter.StartDependencyCall(ctx, "orders-db")
+			call.SetDetail("query", "select_order")
+			call.End(errors.New("deadline exceeded"))
+			return nil, status.Error(codes.NotFound, "no such order")
+		},
+	)
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	assert.Equal(t, "served RPC /mwitkow.testproto.TestService/Ping "+
+		"(failed dependencies: orders-db)", got["message"])
+	data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+	calls := data[logadapter.KeyDependencies].([]interface{})
+	require.Len(t, calls, 2)
+	assert.Equal(t, "cache", calls[0].(map[string]interface{})["name"], "calls are in order")
+	db := calls[1].(map[string]interface{})
+	assert.Equal(t, "orders-db", db["name"])
+	assert.Equal(t, "deadline exceeded", db["error"])
+	assert.Equal(t, map[string]interface{}{"query": "select_order"}, db["detail"])
+}
+
+func TestRPCPhases(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	auth := func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		time.Sleep(2 * time.Millisecond)
+		logadapter.MarkPhase(ctx, "auth_done")
+		return handler(ctx, req)
+	}
+	intercept := grpc_middleware.ChainUnaryServer(
+		grpcmw.UnaryLoggingInterceptor(logger),
+		auth,
+		grpcmw.UnaryPhaseInterceptor,
+	)
+	_, err := intercept(
+		context.Background(),
+		&pb_testproto.PingRequest{},
+		&grpc.UnaryServerInfo{FullMethod: "/mwitkow.testproto.TestService/Ping"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				time.Sleep(5 * time.Millisecond)
+				logadapter.MarkPhase(ctx, "db_done")
+			}()
+			<-done
+			return &pb_testproto.PingResponse{}, nil
+		},
+	)
+	require.NoError(t, err)
+
+	var got struct {
+		Context struct {
+			GRPCRequest struct {
+				Phases map[string]string `json:"phases"`
+			} `json:"grpcRequest"`
+		} `json:"context"`
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	phases := map[string]float64{}
+	for name, d := range got.Context.GRPCRequest.Phases {
+		s, err := strconv.ParseFloat(strings.TrimSuffix(d, "s"), 64)
+		require.NoError(t, err, name)
+		phases[name] = s
+	}
+
+	order := []string{"interceptor_start", "auth_done", "handler_start", "db_done", "handler_done"}
+	for i, name := range order {
+		require.Contains(t, phases, name)
+		if i > 0 {
+			assert.LessOrEqual(t, phases[order[i-1]], phases[name],
+				"%s is marked after %s", name, order[i-1])
+		}
+	}
+	assert.GreaterOrEqual(t, phases["auth_done"], 0.002)
+	assert.GreaterOrEqual(t, phases["handler"], 0.005)
+	assert.Less(t, phases["handler"], phases["handler_done"],
+		"the handler excludes the interceptors")
+}
+
+// startedHook signals the entries logged as RPCs start
+type startedHook chan struct{}
+
+func (h startedHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h startedHook) Fire(e *logrus.Entry) error {
+	if e.Message == "request started" {
+		h <- struct{}{}
+	}
+	return nil
+}
+
+func TestRequestStartLog(t *testing.T) {
+	const pingMethod = "/mwitkow.testproto.TestService/Ping"
+	const summary = "served RPC " + pingMethod
+	for _, tcase := range []struct {
+		name      string
+		threshold time.Duration
+		slow      bool
+		want      []string
+	}{
+		{"slow", 10 * time.Millisecond, true, []string{"request started", summary}},
+		{"fast", time.Hour, false, []string{summary}},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+			started := make(startedHook, 1)
+			logger.AddHook(started)
+
+			intercept := grpcmw.UnaryLoggingInterceptor(logger,
+				grpcmw.WithRequestStartLog(tcase.threshold))
+			_, err := intercept(
+				context.Background(),
+				&pb_testproto.PingRequest{},
+				&grpc.UnaryServerInfo{FullMethod: pingMethod},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					if tcase.slow {
+						select {
+						case <-started:
+						case <-time.After(5 * time.Second):
+							t.Error("the start of the RPC was not logged")
+						}
+					}
+					return &pb_testproto.PingResponse{}, nil
+				},
+			)
+			require.NoError(t, err)
+
+			var entries []map[string]interface{}
+			var messages []string
+			dec := json.NewDecoder(&out)
+			for dec.More() {
+				var got map[string]interface{}
+				require.NoError(t, dec.Decode(&got))
+				entries = append(entries, got)
+				messages = append(messages, got["message"].(string))
+			}
+			require.Equal(t, tcase.want, messages)
+			if len(entries) == 1 {
+				return
+			}
+
+			request := entries[0]["httpRequest"].(map[string]interface{})
+			assert.Equal(t, pingMethod, request["requestUrl"])
+			assert.Equal(t, "gRPC", request["protocol"])
+			assert.NotContains(t, request, "status")
+			assert.NotContains(t, request, "latency")
+		})
+	}
+}
+
+// messageStream is a server stream receiving a number of messages
+type messageStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	messages int
+}
+
+func (s *messageStream) Context() context.Context { return s.ctx }
+
+func (s *messageStream) RecvMsg(m interface{}) error {
+	if s.messages == 0 {
+		return io.EOF
+	}
+	s.messages--
+	return nil
+}
+
+func TestPerMessageScope(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	intercept := grpcmw.StreamLoggingInterceptor(logger, grpcmw.WithPerMessageScope())
+	err := intercept(
+		nil,
+		&messageStream{ctx: context.Background(), messages: 1000},
+		&grpc.StreamServerInfo{FullMethod: "/mwitkow.testproto.TestService/PingStream"},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			ctxlogrus.AddFields(stream.Context(), logrus.Fields{"streamField": "before"})
+			for i := 0; ; i++ {
+				if err := stream.RecvMsg(&pb_testproto.PingRequest{}); err == io.EOF {
+					return nil
+				}
+				ctx := stream.Context()
+				ctxlogrus.AddFields(ctx, logrus.Fields{fmt.Sprintf("message%d", i): i})
+				ctxlogrus.Extract(ctx).Info("processed message")
+			}
+		},
+	)
+	require.NoError(t, err)
+
+	var entries []map[string]interface{}
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var got map[string]interface{}
+		require.NoError(t, dec.Decode(&got))
+		entries = append(entries, got)
+	}
+	require.Len(t, entries, 1001, "each message and the stream are logged")
+
+	last := entries[999]["context"].(map[string]interface{})
+	data := last["data"].(map[string]interface{})
+	assert.Contains(t, data, "message999")
+	assert.NotContains(t, data, "message998", "fields of previous messages are discarded")
+	assert.Equal(t, "before", data["streamField"], "fields before the first message are kept")
+	first := entries[0]["context"].(map[string]interface{})["data"].(map[string]interface{})
+	assert.Len(t, data, len(first), "the fields are bounded")
+	assert.Contains(t, last, "grpcRequest", "fields of the stream are kept")
+
+	summary := entries[1000]["context"].(map[string]interface{})
+	assert.Contains(t, summary, "grpcRequest")
+	assert.Equal(t, map[string]interface{}{"streamField": "before"}, summary["data"],
+		"fields of messages are not in the summary")
+}
+
+// userStream is a stream whose context was modified by an interceptor
+type userStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *userStream) Context() context.Context { return s.ctx }
+
+func TestPerMessageScopeInnerInterceptor(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	type userKey struct{}
+	auth := func(
+		srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler,
+	) error {
+		ctx := context.WithValue(ss.Context(), userKey{}, "user-42")
+		ctxlogrus.AddFields(ctx, logrus.Fields{"authUser": "user-42"})
+		return handler(srv, &userStream{ServerStream: ss, ctx: ctx})
+	}
+	chain := grpc_middleware.ChainStreamServer(
+		grpcmw.StreamLoggingInterceptor(logger, grpcmw.WithPerMessageScope()),
+		auth,
+	)
+	err := chain(
+		nil,
+		&messageStream{ctx: context.Background(), messages: 3},
+		&grpc.StreamServerInfo{FullMethod: "/mwitkow.testproto.TestService/PingStream"},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			for i := 0; ; i++ {
+				if err := stream.RecvMsg(&pb_testproto.PingRequest{}); err == io.EOF {
+					return nil
+				}
+				ctx := stream.Context()
+				assert.Equal(t, "user-42", ctx.Value(userKey{}))
+				ctxlogrus.AddFields(ctx, logrus.Fields{"messageIndex": i})
+				ctxlogrus.Extract(ctx).Info("processed message")
+			}
+		},
+	)
+	require.NoError(t, err)
+
+	var entries []map[string]interface{}
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var got map[string]interface{}
+		require.NoError(t, dec.Decode(&got))
+		entries = append(entries, got)
+	}
+	require.Len(t, entries, 4, "each message and the stream are logged")
+	for i, e := range entries[:3] {
+		data := e["context"].(map[string]interface{})["data"].(map[string]interface{})
+		assert.Equal(t, "user-42", data["authUser"], "the field of the interceptor is kept")
+		assert.Equal(t, float64(i), data["messageIndex"])
+	}
+	summary := entries[3]["context"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"authUser": "user-42"}, summary["data"])
+}
+
+func TestRPCUserExtractor(t *testing.T) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-42"}`))
+	for _, tcase := range []struct {
+		name  string
+		token string
+		want  interface{}
+	}{
+		{"bearer token", "Bearer eyJhbGciOiJub25lIn0." + payload + ".c2ln", "user-42"},
+		{"without token", "", nil},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithService("test"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			ctx := context.Background()
+			if tcase.token != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", tcase.token))
+			}
+			intercept := grpcmw.UnaryLoggingInterceptor(logger,
+				grpcmw.WithUserExtractor(grpcmw.UnverifiedBearerSubject))
+			_, err := intercept(
+				ctx,
+				&pb_testproto.PingRequest{},
+				&grpc.UnaryServerInfo{FullMethod: "/mwitkow.testproto.TestService/PingError"},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					ctxlogrus.Extract(ctx).Info("pinging")
+					return nil, status.Error(codes.Internal, "broken")
+				},
+			)
+			require.Error(t, err)
+
+			dec := json.NewDecoder(&out)
+			var entries int
+			for dec.More() {
+				var got map[string]interface{}
+				require.NoError(t, dec.Decode(&got))
+				entries++
+				logCtx := got["context"].(map[string]interface{})
+				assert.Equal(t, tcase.want, logCtx["user"], "%v", got["message"])
+			}
+			assert.Equal(t, 2, entries, "the entry and the error are logged")
+		})
+	}
+}
+
+func TestRPCRequestIdentity(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	// authentication runs within the logging interceptor
+	auth := func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctxlogrus.Extract(ss.Context()).Info("authenticating")
+		logadapter.SetRequestIdentity(ss.Context(), "user-42",
+			map[string]string{"iss": "accounts.example.com", "scope": "orders"})
+		return handler(srv, ss)
+	}
+	info := &grpc.StreamServerInfo{FullMethod: "/mwitkow.testproto.TestService/PingStream"}
+	intercept := grpcmw.StreamLoggingInterceptor(logger)
+	err := intercept(nil, &messageStream{ctx: context.Background(), messages: 1}, info,
+		func(srv interface{}, ss grpc.ServerStream) error {
+			return auth(srv, ss, info, func(srv interface{}, stream grpc.ServerStream) error {
+				ctxlogrus.Extract(stream.Context()).Info("streaming")
+				return nil
+			})
+		})
+	require.NoError(t, err)
+
+	var entries []map[string]interface{}
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var got map[string]interface{}
+		require.NoError(t, dec.Decode(&got))
+		entries = append(entries, got)
+	}
+	require.Len(t, entries, 3)
+	before := entries[0]["context"].(map[string]interface{})
+	assert.NotContains(t, before, "user", "the identity is unknown before authentication")
+
+	claims := map[string]interface{}{"iss": "accounts.example.com", "scope": "orders"}
+	for _, got := range entries[1:] {
+		logCtx := got["context"].(map[string]interface{})
+		assert.Equal(t, "user-42", logCtx["user"], "%v", got["message"])
+		assert.Equal(t, claims, logCtx["data"].(map[string]interface{})["claims"])
+	}
+	assert.Contains(t, entries[2]["context"], "grpcRequest", "the summary has the identity")
+}
+
+func TestRPCSummaryMessage(t *testing.T) {
+	custom := grpcmw.WithRPCSummaryMessage(
+		func(method string, code codes.Code, d time.Duration) string {
+			return fmt.Sprintf("rpc %s finished with %s", method, code)
+		},
+	)
+	for _, tcase := range []struct {
+		name     string
+		opts     []grpcmw.MiddlewareOption
+		err      error
+		messages []string
+	}{
+		{"default", nil, nil, []string{
+			"some ping", "served RPC /mwitkow.testproto.TestService/Ping",
+		}},
+		{"custom", []grpcmw.MiddlewareOption{custom}, status.Error(codes.NotFound, "no order"),
+			[]string{
+				"some ping", "rpc /mwitkow.testproto.TestService/Ping finished with NotFound",
+			}},
+		{"suppressed", []grpcmw.MiddlewareOption{grpcmw.WithoutSummaryLog()}, nil,
+			[]string{"some ping"}},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			intercept := grpcmw.UnaryLoggingInterceptor(logger, tcase.opts...)
+			_, _ = intercept(
+				context.Background(),
+				&pb_testproto.PingRequest{},
+				&grpc.UnaryServerInfo{FullMethod: "/mwitkow.testproto.TestService/Ping"},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					ctxlogrus.Extract(ctx).Info("some ping")
+					return &pb_testproto.PingResponse{}, tcase.err
+				},
+			)
+
+			var messages []string
+			dec := json.NewDecoder(&out)
+			for dec.More() {
+				var got map[string]interface{}
+				require.NoError(t, dec.Decode(&got))
+				messages = append(messages, got["message"].(string))
+				logCtx := got["context"].(map[string]interface{})
+				assert.Contains(t, logCtx, "grpcRequest", "request details are in context")
+			}
+			assert.Equal(t, tcase.messages, messages)
+		})
+	}
+}
+
+func TestStatusDetails(t *testing.T) {
+	st, err := status.New(codes.InvalidArgument, "invalid order").WithDetails(
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "order.quantity", Description: "must be positive"},
+		}},
+		&errdetails.ErrorInfo{
+			Reason:   "INVALID_QUANTITY",
+			Domain:   "orders.example.com",
+			Metadata: map[string]string{"quantity": "-1"},
+		},
+	)
+	require.NoError(t, err)
+	details := []interface{}{
+		map[string]interface{}{
+			"@type": "type.googleapis.com/google.rpc.BadRequest",
+			"fieldViolations": []interface{}{
+				map[string]interface{}{
+					"field":       "order.quantity",
+					"description": "must be positive",
+				},
+			},
+		},
+		map[string]interface{}{
+			"@type":    "type.googleapis.com/google.rpc.ErrorInfo",
+			"reason":   "INVALID_QUANTITY",
+			"domain":   "orders.example.com",
+			"metadata": map[string]interface{}{"quantity": "-1"},
+		},
+	}
+
+	pb := st.Proto()
+	pb.Details = append(pb.Details, &anypb.Any{TypeUrl: "type.googleapis.com/example.Unknown"})
+	withUnknown := status.FromProto(pb)
+
+	for _, tcase := range []struct {
+		name        string
+		st          *status.Status
+		opts        []grpcmw.MiddlewareOption
+		wantDetails []interface{}
+		rawDetails  int
+	}{
+		{"raw status kept", st, nil, details, 2},
+		{
+			"decoded only",
+			st,
+			[]grpcmw.MiddlewareOption{grpcmw.WithDecodedStatusDetails()},
+			details,
+			0,
+		},
+		{
+			"unknown types listed",
+			withUnknown,
+			nil,
+			append(details[:2:2], map[string]interface{}{
+				"@type": "type.googleapis.com/example.Unknown",
+			}),
+			0,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			intercept := grpcmw.UnaryLoggingInterceptor(logger, tcase.opts...)
+			_, err := intercept(
+				context.Background(),
+				&pb_testproto.PingRequest{},
+				&grpc.UnaryServerInfo{FullMethod: "/mwitkow.testproto.TestService/Ping"},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					return nil, tcase.st.Err()
+				},
+			)
+			require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+			logCtx := got["context"].(map[string]interface{})
+			data := logCtx["data"].(map[string]interface{})
+			assert.Equal(t, tcase.wantDetails, data["grpcStatusDetails"])
+
+			raw := logCtx["grpcStatus"].(map[string]interface{})
+			assert.Equal(t, "invalid order", raw["message"])
+			assert.Len(t, raw["details"], tcase.rawDetails)
+		})
+	}
+}
+
+func TestStructuredGRPCStatus(t *testing.T) {
+	st, err := status.New(codes.NotFound, "order 42 not found").WithDetails(
+		&errdetails.ErrorInfo{Reason: "ORDER_NOT_FOUND", Domain: "orders.example.com"},
+	)
+	require.NoError(t, err)
+
+	for _, tcase := range []struct {
+		name    string
+		opts    []grpcmw.MiddlewareOption
+		wantRaw bool
+	}{
+		{"raw status retained", []grpcmw.MiddlewareOption{grpcmw.WithStructuredGRPCStatus()}, true},
+		{"decoded only", []grpcmw.MiddlewareOption{
+			grpcmw.WithStructuredGRPCStatus(),
+			grpcmw.WithDecodedStatusDetails(),
+		}, false},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			var report *grpcmw.ErrorReport
+			opts := append(tcase.opts, grpcmw.WithErrorHandlerV2(
+				func(ctx context.Context, r *grpcmw.ErrorReport) bool {
+					report = r
+					return false
+				}))
+			intercept := grpcmw.UnaryLoggingInterceptor(logger, opts...)
+			_, err := intercept(
+				context.Background(),
+				&pb_testproto.PingRequest{},
+				&grpc.UnaryServerInfo{FullMethod: "/mwitkow.testproto.TestService/Ping"},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					return nil, st.Err()
+				},
+			)
+			require.Equal(t, codes.NotFound, status.Code(err))
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+			logCtx := got["context"].(map[string]interface{})
+			grpcStatus := logCtx["grpcStatus"].(map[string]interface{})
+			assert.Equal(t, "NOT_FOUND", grpcStatus["codeName"])
+			assert.Equal(t, float64(codes.NotFound), grpcStatus["code"])
+			assert.Equal(t, "order 42 not found", grpcStatus["message"])
+			assert.Equal(t, []interface{}{map[string]interface{}{
+				"@type":    "type.googleapis.com/google.rpc.ErrorInfo",
+				"reason":   "ORDER_NOT_FOUND",
+				"domain":   "orders.example.com",
+				"metadata": nil,
+			}}, grpcStatus["details"])
+			if data, ok := logCtx["data"].(map[string]interface{}); ok {
+				assert.NotContains(t, data, "grpcStatusDetails")
+			}
+
+			require.NotNil(t, report)
+			require.NotNil(t, report.GRPCStatusDetails)
+			assert.Equal(t, "NOT_FOUND", report.GRPCStatusDetails.CodeName)
+			if !tcase.wantRaw {
+				assert.NotContains(t, grpcStatus, "raw")
+				assert.Empty(t, report.GRPCStatus)
+				return
+			}
+			raw := grpcStatus["raw"].(map[string]interface{})
+			assert.Equal(t, "order 42 not found", raw["message"])
+			assert.Len(t, raw["details"], 1)
+			assert.JSONEq(t, string(report.GRPCStatus), mustMarshal(t, raw))
+		})
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestErrorHandlerV2(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	reports := make(chan *grpcmw.ErrorReport, 1)
+	intercept := grpc_middleware.ChainUnaryServer(
+		grpcmw.UnaryLoggingInterceptor(logger,
+			grpcmw.WithErrorHandlerV2(func(ctx context.Context, report *grpcmw.ErrorReport) bool {
+				reports <- report
+				return false
+			}),
+		),
+		grpcmw.UnaryRecoveryInterceptor,
+	)
+	info := &grpc.UnaryServerInfo{FullMethod: "/mwitkow.testproto.TestService/Ping"}
+
+	_, err := intercept(context.Background(), &pb_testproto.PingRequest{}, info,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			panic("out of stock")
+		})
+	require.Equal(t, codes.Internal, status.Code(err))
+
+	report := <-reports
+	assert.Equal(t, "ERROR", report.Entry.Severity)
+	assert.True(t, strings.HasPrefix(report.Entry.Message,
+		"internal error response on RPC /mwitkow.testproto.TestService/Ping"))
+	require.NotNil(t, report.GRPCRequest)
+	assert.Equal(t, "/mwitkow.testproto.TestService/Ping", report.GRPCRequest.Method)
+	var st map[string]interface{}
+	require.NoError(t, json.Unmarshal(report.GRPCStatus, &st))
+	assert.Equal(t, float64(codes.Internal), st["code"])
+	assert.EqualError(t, report.Err, "out of stock", "the recovered panic is reported")
+	assert.True(t, strings.HasPrefix(report.StackTrace, "panic: out of stock\n\ngoroutine "))
+
+	_, err = intercept(context.Background(), &pb_testproto.PingRequest{}, info,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, status.Error(codes.NotFound, "no such order")
+		})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	report = <-reports
+	assert.Equal(t, "INFO", report.Entry.Severity)
+	assert.Equal(t, codes.NotFound, status.Code(report.Err))
+	assert.Empty(t, report.StackTrace)
+}
+
+func TestRecoveryRPCContext(t *testing.T) {
+	var out bytes.Buffer
+	formatter := logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithService("test"),
+		logadapter.WithSkipTimestamp(),
+	)
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = formatter
+
+	// panics without a request-scoped logger use the standard logger
+	std := logrus.StandardLogger()
+	stdOut, stdFormatter := std.Out, std.Formatter
+	defer func() { std.Out, std.Formatter = stdOut, stdFormatter }()
+	std.Out, std.Formatter = &out, formatter
+
+	for _, tcase := range []struct {
+		name      string
+		intercept grpc.UnaryServerInterceptor
+	}{
+		{
+			name: "recovery inside logging",
+			intercept: grpc_middleware.ChainUnaryServer(
+				grpcmw.UnaryLoggingInterceptor(logger),
+				grpcmw.UnaryRecoveryInterceptor,
+			),
+		},
+		{
+			name: "logging inside recovery",
+			intercept: grpc_middleware.ChainUnaryServer(
+				grpcmw.UnaryRecoveryInterceptor,
+				grpcmw.UnaryLoggingInterceptor(logger),
+			),
+		},
+		{
+			name:      "recovery alone",
+			intercept: grpcmw.UnaryRecoveryInterceptor,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			out.Reset()
+			addr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5000}
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+			_, err := tcase.intercept(
+				ctx,
+				&pb_testproto.PingRequest{},
+				&grpc.UnaryServerInfo{FullMethod: "/mwitkow.testproto.TestService/Ping"},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					panic("out of stock")
+				},
+			)
+			require.Equal(t, codes.Internal, status.Code(err))
+
+			var logged map[string]interface{}
+			dec := json.NewDecoder(&out)
+			for dec.More() {
+				var got map[string]interface{}
+				require.NoError(t, dec.Decode(&got), "entries are valid JSON")
+				if msg, _ := got["message"].(string); strings.HasPrefix(msg, "panic handling") {
+					logged = got
+				}
+			}
+			require.NotNil(t, logged, "the panic is logged")
+
+			logCtx := logged["context"].(map[string]interface{})
+			request := logCtx["grpcRequest"].(map[string]interface{})
+			assert.Equal(t, "/mwitkow.testproto.TestService/Ping", request["method"])
+			assert.Equal(t, "tcp://192.0.2.1:5000", request["peer"])
+		})
+	}
+}
+
+func TestCtxTags(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	intercept := grpc_middleware.ChainUnaryServer(
+		grpcmw.UnaryLoggingInterceptor(logger),
+		grpc_ctxtags.UnaryServerInterceptor(),
+	)
+	_, err := intercept(
+		context.Background(),
+		&pb_testproto.PingRequest{},
+		&grpc.UnaryServerInfo{FullMethod: "/mwitkow.testproto.TestService/Ping"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			grpc_ctxtags.Extract(ctx).Set("custom_tags.string", "something")
+			ctxlogrus.Extract(ctx).Info("some ping")
+			return &pb_testproto.PingResponse{}, nil
+		},
+	)
+	require.NoError(t, err)
+
+	var got map[string]interface{}
+	require.NoError(t, json.NewDecoder(&out).Decode(&got))
+	assert.Equal(t, "some ping", got["message"])
+	data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+	assert.Equal(t, "something", data["custom_tags.string"], "grpc_ctxtags are logged")
+}
+
+// altsInfo stands in for the auth info of ALTS and other credentials
+type altsInfo struct{ credentials.CommonAuthInfo }
+
+func (altsInfo) AuthType() string { return "alts" }
+
+func TestPeerIdentity(t *testing.T) {
+	spiffeID, err := url.Parse("spiffe://example.org/ns/default/sa/client")
+	require.NoError(t, err)
+	clientCert := &x509.Certificate{
+		Subject: pkix.Name{CommonName: "client.example.org"},
+		URIs:    []*url.URL{spiffeID},
+	}
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4321}
+
+	for _, tcase := range []struct {
+		name     string
+		opts     []grpcmw.MiddlewareOption
+		authInfo credentials.AuthInfo
+		want     map[string]interface{}
+	}{
+		{
+			name: "mTLS",
+			opts: []grpcmw.MiddlewareOption{grpcmw.WithPeerIdentity()},
+			authInfo: credentials.TLSInfo{State: tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{clientCert},
+			}},
+			want: map[string]interface{}{
+				"peerAuthType":      "tls",
+				"peerIdentity":      "spiffe://example.org/ns/default/sa/client",
+				"peerCertificateCN": "client.example.org",
+				"peerMTLS":          true,
+			},
+		},
+		{
+			name:     "server TLS",
+			opts:     []grpcmw.MiddlewareOption{grpcmw.WithPeerIdentity()},
+			authInfo: credentials.TLSInfo{},
+			want:     map[string]interface{}{"peerAuthType": "tls"},
+		},
+		{
+			name:     "ALTS",
+			opts:     []grpcmw.MiddlewareOption{grpcmw.WithPeerIdentity()},
+			authInfo: altsInfo{},
+			want:     map[string]interface{}{"peerAuthType": "alts"},
+		},
+		{
+			name: "plaintext",
+			opts: []grpcmw.MiddlewareOption{grpcmw.WithPeerIdentity()},
+			want: map[string]interface{}{},
+		},
+		{
+			name: "disabled",
+			authInfo: credentials.TLSInfo{State: tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{clientCert},
+			}},
+			want: map[string]interface{}{},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			intercept := grpcmw.UnaryLoggingInterceptor(logger, tcase.opts...)
+			ctx := peer.NewContext(context.Background(),
+				&peer.Peer{Addr: addr, AuthInfo: tcase.authInfo})
+			_, err := intercept(
+				ctx,
+				&pb_testproto.PingRequest{},
+				&grpc.UnaryServerInfo{FullMethod: "/mwitkow.testproto.TestService/Ping"},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					return &pb_testproto.PingResponse{}, nil
+				},
+			)
+			require.NoError(t, err)
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+			assert.Equal(t, "served RPC /mwitkow.testproto.TestService/Ping", got["message"])
+			logCtx := got["context"].(map[string]interface{})
+			request := logCtx["grpcRequest"].(map[string]interface{})
+			assert.Equal(t, "tcp://10.0.0.1:4321", request["peer"])
+			for _, key := range []string{
+				"peerAuthType", "peerIdentity", "peerCertificateCN", "peerMTLS",
+			} {
+				assert.Equal(t, tcase.want[key], request[key], key)
+			}
+		})
+	}
+}
+
+// headerPingService sets the headers and trailers of its streams both
+// through the stream and through the transport stream of its context
+type headerPingService struct {
+	pb_testproto.TestServiceServer
+}
+
+func (s headerPingService) PingList(
+	ping *pb_testproto.PingRequest,
+	stream pb_testproto.TestService_PingListServer,
+) error {
+	ctx := stream.Context()
+	if err := stream.SetHeader(metadata.Pairs("stream-header", "set")); err != nil {
+		return err
+	}
+	if err := grpc.SetHeader(ctx, metadata.Pairs("transport-header", "set")); err != nil {
+		return err
+	}
+	if err := stream.SendHeader(metadata.Pairs("sent-header", "sent")); err != nil {
+		return err
+	}
+	for i := 0; i < 3; i++ {
+		resp := &pb_testproto.PingResponse{Value: ping.Value, Counter: int32(i)}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+	stream.SetTrailer(metadata.Pairs("stream-trailer", "set"))
+	return grpc.SetTrailer(ctx, metadata.Pairs("transport-trailer", "set"))
+}
+
+func TestRPCStreamHeaders(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	for _, tcase := range []struct {
+		name string
+		opts []grpc.ServerOption
+	}{
+		{"without interceptors", nil},
+		{"recovery inside logging", []grpc.ServerOption{
+			grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
+				grpcmw.StreamLoggingInterceptor(logger),
+				grpcmw.StreamRecoveryInterceptor,
+			)),
+		}},
+		{"per message scope", []grpc.ServerOption{
+			grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
+				grpcmw.StreamLoggingInterceptor(logger, grpcmw.WithPerMessageScope()),
+				grpcmw.StreamRecoveryInterceptor,
+			)),
+		}},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			srv := grpc.NewServer(tcase.opts...)
+			pb_testproto.RegisterTestServiceServer(srv, headerPingService{})
+			go func() { _ = srv.Serve(lis) }()
+			defer srv.Stop()
+
+			conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+			require.NoError(t, err)
+			defer conn.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			stream, err := pb_testproto.NewTestServiceClient(conn).
+				PingList(ctx, &pb_testproto.PingRequest{Value: "ping"})
+			require.NoError(t, err)
+			var received int
+			for {
+				_, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				received++
+			}
+			assert.Equal(t, 3, received)
+
+			header, err := stream.Header()
+			require.NoError(t, err)
+			assert.Equal(t, []string{"set"}, header.Get("stream-header"))
+			assert.Equal(t, []string{"set"}, header.Get("transport-header"))
+			assert.Equal(t, []string{"sent"}, header.Get("sent-header"))
+			trailer := stream.Trailer()
+			assert.Equal(t, []string{"set"}, trailer.Get("stream-trailer"))
+			assert.Equal(t, []string{"set"}, trailer.Get("transport-trailer"))
+		})
+	}
+}
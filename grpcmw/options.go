@@ -0,0 +1,249 @@
+package grpcmw
+
+import (
+	"context"
+	"time"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+var defaultOptions = &middleware.Options{
+	FilterRPC:    DefaultFilterRPC,
+	ErrorHandler: DefaultErrorHandler,
+	Metrics:      middleware.NoopMetrics{},
+}
+
+// MiddlewareOption configures the logging interceptors. Options are shared
+// with the httpmw package, and those that do not apply to gRPC are ignored.
+type MiddlewareOption = middleware.Option
+
+type (
+	// UserExtractor identifies the user making an RPC, or returns "" if
+	// unknown.
+	UserExtractor = middleware.UserExtractor
+
+	// FilterRPC determines whether or not to log an RPC.
+	FilterRPC = middleware.FilterRPC
+
+	// ErrorHandler should return true if the error provided has already been logged
+	ErrorHandler = middleware.ErrorHandler
+
+	// ErrorHandlerV2 receives a report of the error of an RPC, and should
+	// return true if it has already been logged
+	ErrorHandlerV2 = middleware.ErrorHandlerV2
+
+	// ErrorReport describes a failed RPC to ErrorHandlerV2
+	ErrorReport = middleware.ErrorReport
+)
+
+// RPCSummaryMessage composes the message of the entry logged for an RPC, from
+// its full method name, status code and how long it took.
+type RPCSummaryMessage func(method string, code codes.Code, d time.Duration) string
+
+// WithRPCSummaryMessage replaces the message of the entry logged for each RPC,
+// "served RPC <method>" by default.
+func WithRPCSummaryMessage(f RPCSummaryMessage) MiddlewareOption {
+	if f == nil {
+		return middleware.WithRPCSummaryMessage(nil)
+	}
+	return middleware.WithRPCSummaryMessage(
+		func(method string, code uint32, d time.Duration) string {
+			return f(method, codes.Code(code), d)
+		})
+}
+
+// WithoutSummaryLog suppresses the entry logged for each RPC. Handlers are
+// still provided with a request-scoped log entry, and internal errors are
+// still logged.
+func WithoutSummaryLog() MiddlewareOption {
+	return middleware.WithoutSummaryLog()
+}
+
+// RequestMetricsRecorder receives counts of the requests logged by the
+// logging interceptors, by the status class of the HTTP-equivalent status.
+type RequestMetricsRecorder = middleware.RequestMetricsRecorder
+
+// WithRPCFilter provides a filter to the logging middleware that determines
+// whether or not to log individual messages
+func WithRPCFilter(f FilterRPC) MiddlewareOption {
+	return middleware.WithRPCFilter(f)
+}
+
+// WithErrorHandler provides an opportunity to log or transform the error of
+// an RPC. If the handler reports the error as handled, the RPC is not logged.
+func WithErrorHandler(h ErrorHandler) MiddlewareOption {
+	return middleware.WithErrorHandler(h)
+}
+
+// WithErrorHandlerV2 provides a report of the error of an RPC, with its log
+// entry, request details, status and the stack of any panic recovered by the
+// recovery interceptors, so that it may be forwarded to other sinks. It is
+// called after any handler of WithErrorHandler, and the RPC is not logged if
+// either reports the error as handled.
+func WithErrorHandlerV2(h ErrorHandlerV2) MiddlewareOption {
+	return middleware.WithErrorHandlerV2(h)
+}
+
+// WithMetadataFields adds the values of incoming metadata keys, such as a
+// tenant ID, to every entry logged for an RPC, mapping metadata keys to field
+// names. Multiple values are joined with "," and limited to 256 bytes.
+func WithMetadataFields(fields map[string]string) MiddlewareOption {
+	return middleware.WithMetadataFields(fields)
+}
+
+// WithHealthCheckSummary counts gRPC health checks dropped by the RPC filter
+// and logs a single summary of them every interval, as a warning if any
+// health check failed, including the last interval once they stop arriving.
+// Failing health checks are logged individually, with or without the
+// summary. Summaries pending are logged by logadapter.FlushAll.
+func WithHealthCheckSummary(interval time.Duration) MiddlewareOption {
+	return middleware.WithHealthCheckSummary(interval)
+}
+
+// WithRequestMetrics records counts of the requests logged by status class.
+func WithRequestMetrics(m RequestMetricsRecorder) MiddlewareOption {
+	return middleware.WithRequestMetrics(m)
+}
+
+// WithLatencyThresholds logs the summary of RPCs slower than warnAfter at
+// WARNING, and slower than errorAfter at ERROR, whatever their status, marking
+// them with "slowRequest". A zero threshold is disabled.
+func WithLatencyThresholds(warnAfter, errorAfter time.Duration) MiddlewareOption {
+	return middleware.WithLatencyThresholds(warnAfter, errorAfter)
+}
+
+// WithDecodedStatusDetails omits the details of a gRPC status from the raw
+// grpcStatus logged, leaving their decoded form in grpcStatusDetails.
+func WithDecodedStatusDetails() MiddlewareOption {
+	return middleware.WithDecodedStatusDetails()
+}
+
+// WithStructuredGRPCStatus logs the status of a failed RPC in grpcStatus as
+// fields, its code, the name of its code, such as "NOT_FOUND", its message and
+// its decoded details, rather than as its raw JSON, so that they may be
+// queried as context.grpcStatus.codeName. The raw JSON is retained in
+// grpcStatus.raw, unless WithDecodedStatusDetails, and grpcStatusDetails is
+// not logged.
+func WithStructuredGRPCStatus() MiddlewareOption {
+	return middleware.WithStructuredGRPCStatus()
+}
+
+// WithPeerIdentity records in grpcRequest the authentication type of the
+// connection of the peer and, over TLS, the URI SANs (such as a SPIFFE ID) and
+// common name of its certificate, and whether it authenticated with mTLS.
+func WithPeerIdentity() MiddlewareOption {
+	return middleware.WithPeerIdentity()
+}
+
+// WithPerMessageScope discards the fields added by the handler of a stream to
+// the request-scoped log entry of the stream context each time it receives a
+// message, so that fields added while processing each message of a long
+// stream don't accumulate. The fields added before the first message is
+// received, such as by interceptors within the logging one, are kept for the
+// whole stream and logged in its summary, but fields added while processing
+// messages are not.
+func WithPerMessageScope() MiddlewareOption {
+	return middleware.WithPerMessageScope()
+}
+
+// WithUserExtractor adds the user identified by f, if any, as the user field
+// of the entries of each request, which the formatter promotes to
+// context.user, so that Error Reporting counts the users affected by errors.
+// It is called with the context of the entries of the request until it
+// identifies a user, so it sees values added by authentication installed
+// within the logging interceptor, and the user is kept for the rest of the
+// request, summary included.
+func WithUserExtractor(f UserExtractor) MiddlewareOption {
+	return middleware.WithUserExtractor(f)
+}
+
+// UnverifiedBearerSubject is a UserExtractor returning the sub claim of a JWT
+// bearer token in the authorization metadata of an RPC, without verifying the token.
+// It is only meant for logging, and not to be trusted for anything else.
+func UnverifiedBearerSubject(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			return middleware.BearerSubject(v[0])
+		}
+	}
+	return middleware.UnverifiedBearerSubject(ctx)
+}
+
+// WithRequestErrorLimit caps the errors recorded with
+// logadapter.AddRequestError that are listed in the summary of a request.
+// Defaults to 20; further errors are only counted.
+func WithRequestErrorLimit(n int) MiddlewareOption {
+	return middleware.WithRequestErrorLimit(n)
+}
+
+// DefaultFilterRPC filters gRPC standard health check and gRPC reflection requests.
+func DefaultFilterRPC(ctx context.Context, fullMethod string, err error) bool {
+	return middleware.DefaultFilterRPC(ctx, fullMethod, err)
+}
+
+// DefaultErrorHandler does nothing.
+func DefaultErrorHandler(ctx context.Context, err error, method string) (handled bool) {
+	return middleware.DefaultErrorHandler(ctx, err, method)
+}
+
+// SLOClassifier decides whether an RPC counts towards an SLO, whether it
+// violated it, and which SLO it counts towards.
+type SLOClassifier func(
+	fullMethod string,
+	code codes.Code,
+	latency time.Duration,
+) (eligible, violated bool, sloName string)
+
+// SLORule is an SLO of the RPCs whose full method starts with its Prefix,
+// which they violate when failing with a server error, such as Internal or
+// Unavailable, or taking longer than its Latency, unless zero.
+type SLORule = middleware.SLORule
+
+// SLOTable classifies RPCs by the first of its rules matching them, and RPCs
+// no rule matches as ineligible. Its ClassifyRPC method is an SLOClassifier:
+//
+//	slos := grpcmw.SLOTable{
+//		{Name: "orders", Prefix: "/shop.Orders/", Latency: 300 * time.Millisecond},
+//	}
+//	grpcmw.UnaryLoggingInterceptor(log, grpcmw.WithSLOClassifier(slos.ClassifyRPC))
+type SLOTable middleware.SLOTable
+
+// ClassifyRPC is an SLOClassifier of RPCs, failing with the status code of a
+// server error.
+func (t SLOTable) ClassifyRPC(
+	fullMethod string,
+	code codes.Code,
+	latency time.Duration,
+) (eligible, violated bool, sloName string) {
+	var failed bool
+	switch code {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented, codes.Internal,
+		codes.Unavailable, codes.DataLoss:
+		failed = true
+	}
+	return middleware.SLOTable(t).ClassifyMethod(fullMethod, failed, latency)
+}
+
+// WithSLOClassifier adds the classification of each RPC by f to its summary,
+// as the sloEligible, sloViolation and sloName fields, and the slo label
+// naming the SLO, so that SLO burn can be computed from logs.
+func WithSLOClassifier(f SLOClassifier) MiddlewareOption {
+	if f == nil {
+		return middleware.WithRPCSLOClassifier(nil)
+	}
+	return middleware.WithRPCSLOClassifier(
+		func(fullMethod string, code uint32, latency time.Duration) (bool, bool, string) {
+			return f(fullMethod, codes.Code(code), latency)
+		})
+}
+
+// WithRequestStartLog logs "request started" with the details of unary RPCs
+// known before their handler runs, so that long-running RPCs show in logs
+// while in flight. With a zero threshold, it is logged at DEBUG for every
+// RPC. Otherwise, it is logged at INFO only for RPCs still running after
+// threshold, so that fast RPCs are still logged once.
+func WithRequestStartLog(threshold time.Duration) MiddlewareOption {
+	return middleware.WithRequestStartLog(threshold)
+}
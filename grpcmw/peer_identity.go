@@ -0,0 +1,42 @@
+package grpcmw
+
+import (
+	"strings"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/requestlog"
+	"google.golang.org/grpc/credentials"
+)
+
+// peerIdentity records how the peer of an RPC authenticated and, over TLS,
+// the identity in the leaf certificate it presented. Nothing is recorded for
+// plaintext connections.
+func peerIdentity(request *requestlog.GRPCRequest, authInfo credentials.AuthInfo) {
+	if authInfo == nil {
+		return
+	}
+	request.PeerAuthType = authInfo.AuthType()
+
+	var state credentials.TLSInfo
+	switch info := authInfo.(type) {
+	case credentials.TLSInfo:
+		state = info
+	case *credentials.TLSInfo:
+		state = *info
+	default:
+		return
+	}
+
+	// servers only see peer certificates of clients authenticating with mTLS
+	certs := state.State.PeerCertificates
+	if len(certs) == 0 {
+		return
+	}
+	leaf := certs[0]
+	request.PeerMTLS = true
+	request.PeerCertificateCN = leaf.Subject.CommonName
+	uris := make([]string, 0, len(leaf.URIs))
+	for _, u := range leaf.URIs {
+		uris = append(uris, u.String())
+	}
+	request.PeerIdentity = strings.Join(uris, ",")
+}
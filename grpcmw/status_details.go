@@ -0,0 +1,91 @@
+package grpcmw
+
+import (
+	"fmt"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/requestlog"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+// decodeStatusDetails renders the well-known google.rpc error details of a
+// status as plain JSON values, so they may be read in the Logs Explorer.
+// Details of other types are listed by type URL only.
+func decodeStatusDetails(st *status.Status) []map[string]interface{} {
+	anys := st.Proto().GetDetails()
+	if len(anys) == 0 {
+		return nil
+	}
+
+	details := make([]map[string]interface{}, 0, len(anys))
+	for _, a := range anys {
+		msg, err := a.UnmarshalNew()
+		if err != nil {
+			details = append(details, map[string]interface{}{"@type": a.GetTypeUrl()})
+			continue
+		}
+
+		var detail map[string]interface{}
+		switch d := msg.(type) {
+		case *errdetails.BadRequest:
+			violations := make([]map[string]string, 0, len(d.GetFieldViolations()))
+			for _, v := range d.GetFieldViolations() {
+				violations = append(violations, map[string]string{
+					"field":       v.GetField(),
+					"description": v.GetDescription(),
+				})
+			}
+			detail = map[string]interface{}{"fieldViolations": violations}
+		case *errdetails.RetryInfo:
+			detail = map[string]interface{}{
+				"retryDelay": fmt.Sprintf("%.5fs", d.GetRetryDelay().AsDuration().Seconds()),
+			}
+		case *errdetails.QuotaFailure:
+			violations := make([]map[string]string, 0, len(d.GetViolations()))
+			for _, v := range d.GetViolations() {
+				violations = append(violations, map[string]string{
+					"subject":     v.GetSubject(),
+					"description": v.GetDescription(),
+				})
+			}
+			detail = map[string]interface{}{"violations": violations}
+		case *errdetails.ErrorInfo:
+			detail = map[string]interface{}{
+				"reason":   d.GetReason(),
+				"domain":   d.GetDomain(),
+				"metadata": d.GetMetadata(),
+			}
+		case *errdetails.RequestInfo:
+			detail = map[string]interface{}{
+				"requestId":   d.GetRequestId(),
+				"servingData": d.GetServingData(),
+			}
+		case *errdetails.PreconditionFailure:
+			violations := make([]map[string]string, 0, len(d.GetViolations()))
+			for _, v := range d.GetViolations() {
+				violations = append(violations, map[string]string{
+					"type":        v.GetType(),
+					"subject":     v.GetSubject(),
+					"description": v.GetDescription(),
+				})
+			}
+			detail = map[string]interface{}{"violations": violations}
+		default:
+			detail = map[string]interface{}{}
+		}
+		detail["@type"] = a.GetTypeUrl()
+		details = append(details, detail)
+	}
+	return details
+}
+
+// structuredStatus describes a status as fields, with its details decoded
+func structuredStatus(st *status.Status) *requestlog.GRPCStatusDetails {
+	return &requestlog.GRPCStatusDetails{
+		Code:     int(st.Code()),
+		CodeName: code.Code(st.Code()).String(),
+		Message:  st.Message(),
+		Details:  decodeStatusDetails(st),
+	}
+}
@@ -1,12 +1,10 @@
-package logadapter_test
+package grpcmw_test
 
 import (
 	"bytes"
 	"context"
 	"encoding/json"
 	"io"
-	"net/http"
-	"net/http/httptest"
 	"os"
 	"testing"
 
@@ -17,7 +15,6 @@ import (
 	pb_testproto "github.com/grpc-ecosystem/go-grpc-middleware/testing/testproto"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	"github.com/stretchr/testify/suite"
 )
 
 type grpcTestSuite struct {
@@ -136,76 +133,3 @@ func (s *grpcTestSuite) getOutputJSONs() []map[string]interface{} {
 
 	return ret
 }
-
-type httpTestSuite struct {
-	suite.Suite
-
-	server *httptest.Server
-	mux    *http.ServeMux
-	Client *http.Client
-
-	mutexBuffer *grpc_testing.MutexReadWriter
-	buffer      *bytes.Buffer
-	logger      *logrus.Logger
-}
-
-func newHTTPTestSuite(t *testing.T) *httpTestSuite {
-	b := &bytes.Buffer{}
-	muB := grpc_testing.NewMutexReadWriter(b)
-	logger := logrus.New()
-	logger.Formatter = logadapter.NewFormatter(
-		logadapter.WithProjectID("test-project"),
-		logadapter.WithService("logging-test"),
-		logadapter.WithVersion("v1.0.0"),
-		logadapter.WithStackTraceStyle(logadapter.TraceInPayload),
-		logadapter.WithSourceReference(
-			"github.com/StevenACoffman/logrus-stackdriver-formatter",
-			"v1.0.0",
-		),
-		logadapter.WithPrettyPrint(),
-	)
-	var out io.Writer
-	out = muB
-	if testing.Verbose() {
-		out = io.MultiWriter(os.Stdout, muB)
-	}
-	logger.Out = out
-
-	return &httpTestSuite{
-		logger:      logger,
-		buffer:      b,
-		mutexBuffer: muB,
-		Suite:       suite.Suite{},
-	}
-}
-
-func (s *httpTestSuite) SetupSuite() {
-	s.mux = http.NewServeMux()
-
-	apiHandler := http.NewServeMux()
-	apiHandler.Handle("/", s.mux)
-
-	recoveryHandler := logadapter.RecoveryMiddleware(apiHandler)
-	loggingHandler := logadapter.LoggingMiddleware(s.logger)(recoveryHandler)
-
-	s.server = httptest.NewTLSServer(loggingHandler)
-	s.Client = s.server.Client()
-
-	s.mux.HandleFunc("/panic", s.ServePanic)
-	s.mux.HandleFunc("/logging", s.ServeLogging)
-}
-
-func (s *httpTestSuite) TearDownSuite() {
-	s.server.Close()
-}
-
-func (s *httpTestSuite) ServePanic(w http.ResponseWriter, r *http.Request) {
-	panic("surprise panic attack!")
-}
-
-func (s *httpTestSuite) ServeLogging(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	ctxlogrus.AddFields(ctx, logrus.Fields{"testField": "testValue"})
-
-	ctxlogrus.Extract(ctx).Info("served from http request")
-}
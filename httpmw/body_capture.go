@@ -0,0 +1,74 @@
+package httpmw
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+)
+
+// bodyCapture passes a request body through to the handler, keeping a copy of
+// at most max bytes of what was read
+type bodyCapture struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (c *bodyCapture) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if n > 0 {
+		room := c.max - c.buf.Len()
+		if n > room {
+			c.truncated = true
+		} else {
+			room = n
+		}
+		if room > 0 {
+			c.buf.Write(p[:room])
+		}
+	}
+	return n, err
+}
+
+// body returns the captured body as text, or false if it is binary
+func (c *bodyCapture) body() (string, bool) {
+	b := c.buf.Bytes()
+	if c.truncated {
+		// the limit may have split the last character
+		for i := 0; i < utf8.UTFMax-1 && len(b) > 0 && !utf8.Valid(b); i++ {
+			b = b[:len(b)-1]
+		}
+	}
+	if !utf8.Valid(b) {
+		return "", false
+	}
+	if c.truncated {
+		return string(b) + middleware.TruncatedMarker, true
+	}
+	return string(b), true
+}
+
+// captureBody tees the body of r into a bodyCapture if its content type is
+// one of contentTypes
+func captureBody(r *http.Request, maxBytes int, contentTypes []string) *bodyCapture {
+	if maxBytes <= 0 || r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil
+	}
+	for _, t := range contentTypes {
+		if mediaType == t {
+			c := &bodyCapture{ReadCloser: r.Body, max: maxBytes}
+			r.Body = c
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package httpmw
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/requestlog"
+	"github.com/felixge/httpsnoop"
+)
+
+// Protocols of RPCs served over HTTP
+const (
+	protocolGRPCWeb = "gRPC-Web"
+	protocolConnect = "Connect"
+)
+
+// Flags of the frames of gRPC-Web and Connect streams that end a response
+const (
+	grpcWebTrailerFlag = 0x80
+	connectEndFlag     = 0x02
+)
+
+// maxTrailerFrame limits the trailers kept from the end of a response
+const maxTrailerFrame = 4 << 10
+
+// Codes of the statuses of RPCs
+const (
+	rpcCodeOK       = 0
+	rpcCodeUnknown  = 2
+	rpcCodeInternal = 13
+)
+
+// rpcStatus is the status of an RPC, encoded as the google.rpc.Status the gRPC
+// interceptors log. It is parsed without the gRPC packages, so that the root
+// package, which imports this one, doesn't depend on gRPC.
+type rpcStatus struct {
+	Code    uint32        `json:"code"`
+	Message string        `json:"message"`
+	Details []interface{} `json:"details"`
+}
+
+// rpcProtocol returns the protocol of an RPC served over HTTP, and whether
+// its response is framed in binary, or "" for other requests
+func rpcProtocol(r *http.Request) (protocol string, framed bool) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return "", false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "application/grpc-web-text"):
+		// base64 encoded frames are not decoded
+		return protocolGRPCWeb, false
+	case strings.HasPrefix(mediaType, "application/grpc-web"):
+		return protocolGRPCWeb, true
+	case strings.HasPrefix(mediaType, "application/connect+"):
+		return protocolConnect, true
+	case r.Header.Get("Connect-Protocol-Version") != "":
+		// unary Connect RPCs are unframed, failing with an HTTP status
+		return protocolConnect, false
+	}
+	return "", false
+}
+
+// rpcMethod parses the full method of an RPC, "/package.Service/Method",
+// from the end of the path of its URL
+func rpcMethod(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 || parts[len(parts)-2] == "" || parts[len(parts)-1] == "" {
+		return ""
+	}
+	return "/" + parts[len(parts)-2] + "/" + parts[len(parts)-1]
+}
+
+// rpcTracker observes the frames of a gRPC-Web or Connect response, to find
+// the status of the RPC in its last frame
+type rpcTracker struct {
+	protocol string
+	framed   bool
+	header   http.Header
+
+	// the frame being read
+	prefix    [5]byte
+	prefixLen int
+	remaining uint32
+	last      bool
+	trailer   bytes.Buffer
+}
+
+// newRPCTracker returns a tracker of the response to r, or nil if r is not
+// an RPC
+func newRPCTracker(r *http.Request) *rpcTracker {
+	protocol, framed := rpcProtocol(r)
+	if protocol == "" {
+		return nil
+	}
+	return &rpcTracker{protocol: protocol, framed: framed}
+}
+
+// wrap observes what is written to w
+func (t *rpcTracker) wrap(w http.ResponseWriter) http.ResponseWriter {
+	t.header = w.Header()
+	if !t.framed {
+		return w
+	}
+	return httpsnoop.Wrap(w, httpsnoop.Hooks{
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(p []byte) (int, error) {
+				n, err := next(p)
+				t.observe(p[:n])
+				return n, err
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				return io.Copy(writerFunc(func(p []byte) (int, error) {
+					n, err := w.Write(p)
+					t.observe(p[:n])
+					return n, err
+				}), src)
+			}
+		},
+	})
+}
+
+// observe follows the frames written, keeping the payload of the last one:
+// a flag byte, a big-endian 32-bit length, then the payload
+func (t *rpcTracker) observe(p []byte) {
+	for len(p) > 0 {
+		if t.prefixLen < len(t.prefix) {
+			n := copy(t.prefix[t.prefixLen:], p)
+			t.prefixLen += n
+			p = p[n:]
+			if t.prefixLen < len(t.prefix) {
+				return
+			}
+			flags := t.prefix[0]
+			t.remaining = binary.BigEndian.Uint32(t.prefix[1:])
+			t.last = (t.protocol == protocolGRPCWeb && flags&grpcWebTrailerFlag != 0) ||
+				(t.protocol == protocolConnect && flags&connectEndFlag != 0)
+			t.trailer.Reset()
+		}
+
+		n := len(p)
+		if uint32(n) > t.remaining {
+			n = int(t.remaining)
+		}
+		if t.last && t.trailer.Len()+n <= maxTrailerFrame {
+			t.trailer.Write(p[:n])
+		}
+		t.remaining -= uint32(n)
+		p = p[n:]
+		if t.remaining == 0 {
+			t.prefixLen = 0
+		}
+	}
+}
+
+// status returns the status of the RPC, from the last frame of the response
+// or from its headers and trailers, or false if none was found
+func (t *rpcTracker) status() (rpcStatus, bool) {
+	if t.last && t.prefixLen == 0 {
+		if t.protocol == protocolConnect {
+			return connectStatus(t.trailer.Bytes())
+		}
+		if st, ok := grpcStatus(parseTrailerFrame(t.trailer.Bytes())); ok {
+			return st, true
+		}
+	}
+	h := http.Header{}
+	for k, v := range t.header {
+		h[strings.TrimPrefix(k, http.TrailerPrefix)] = v
+	}
+	return grpcStatus(h)
+}
+
+// parseTrailerFrame parses the HTTP/1 header block of a gRPC-Web trailer
+func parseTrailerFrame(b []byte) http.Header {
+	h := http.Header{}
+	for _, line := range strings.Split(string(b), "\r\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) == 2 {
+			h.Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+		}
+	}
+	return h
+}
+
+// grpcStatus reads the grpc-status and percent-encoded grpc-message of h
+func grpcStatus(h http.Header) (rpcStatus, bool) {
+	v := h.Get("Grpc-Status")
+	if v == "" {
+		return rpcStatus{}, false
+	}
+	code, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return rpcStatus{}, false
+	}
+	msg := h.Get("Grpc-Message")
+	if decoded, err := url.PathUnescape(msg); err == nil {
+		msg = decoded
+	}
+	return rpcStatus{Code: uint32(code), Message: msg}, true
+}
+
+// connectCodes maps the names of codes in the Connect protocol, such as
+// "invalid_argument", to gRPC codes
+var connectCodes = map[string]uint32{
+	"canceled":            1,
+	"unknown":             2,
+	"invalid_argument":    3,
+	"deadline_exceeded":   4,
+	"not_found":           5,
+	"already_exists":      6,
+	"permission_denied":   7,
+	"resource_exhausted":  8,
+	"failed_precondition": 9,
+	"aborted":             10,
+	"out_of_range":        11,
+	"unimplemented":       12,
+	"internal":            13,
+	"unavailable":         14,
+	"data_loss":           15,
+	"unauthenticated":     16,
+}
+
+// connectStatus reads the error of the end-stream message of a Connect stream
+func connectStatus(b []byte) (rpcStatus, bool) {
+	var end struct {
+		Error *struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(b, &end); err != nil {
+		return rpcStatus{}, false
+	}
+	if end.Error == nil {
+		return rpcStatus{Code: rpcCodeOK}, true
+	}
+	code, ok := connectCodes[end.Error.Code]
+	if !ok {
+		code = rpcCodeUnknown
+	}
+	return rpcStatus{Code: code, Message: end.Error.Message}, true
+}
+
+// rpcStatusJSON marshals a status as the gRPC interceptors log it
+func rpcStatusJSON(st rpcStatus) (json.RawMessage, error) {
+	if st.Details == nil {
+		st.Details = []interface{}{}
+	}
+	b, err := json.Marshal(st)
+	return json.RawMessage(b), err
+}
+
+// grpcRequest describes an RPC served over HTTP
+func grpcRequest(r *http.Request, request *requestlog.HTTPRequest) *requestlog.GRPCRequest {
+	return &requestlog.GRPCRequest{
+		Method:    rpcMethod(r.URL.Path),
+		UserAgent: request.UserAgent,
+		PeerAddr:  request.RemoteIP,
+	}
+}
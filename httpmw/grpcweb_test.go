@@ -0,0 +1,159 @@
+package httpmw_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/httpmw"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// frame encodes a frame of a gRPC-Web or Connect stream
+func frame(flags byte, payload string) []byte {
+	b := make([]byte, 5, 5+len(payload))
+	b[0] = flags
+	binary.BigEndian.PutUint32(b[1:], uint32(len(payload)))
+	return append(b, payload...)
+}
+
+func TestGRPCWeb(t *testing.T) {
+	message := frame(0, "\x0a\x05hello")
+	for _, tcase := range []struct {
+		name        string
+		opts        []httpmw.MiddlewareOption
+		header      map[string]string
+		handler     http.HandlerFunc
+		severity    string
+		protocol    string
+		wantStatus  map[string]interface{}
+		wantRequest bool
+	}{
+		{
+			name:   "trailers",
+			opts:   []httpmw.MiddlewareOption{httpmw.WithGRPCWeb()},
+			header: map[string]string{"Content-Type": "application/grpc-web+proto"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write(message)
+				w.Header().Set(http.TrailerPrefix+"Grpc-Status", "13")
+				w.Header().Set(http.TrailerPrefix+"Grpc-Message", "database%20unavailable")
+			},
+			severity:    "ERROR",
+			protocol:    "gRPC-Web",
+			wantStatus:  map[string]interface{}{"code": 13.0, "message": "database unavailable"},
+			wantRequest: true,
+		},
+		{
+			name:   "trailer frame",
+			opts:   []httpmw.MiddlewareOption{httpmw.WithGRPCWeb()},
+			header: map[string]string{"Content-Type": "application/grpc-web"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				trailer := frame(0x80, "grpc-status: 5\r\ngrpc-message: no order\r\n")
+				b := append(append([]byte(nil), message...), trailer...)
+				// frames may be split across writes
+				for i := range b {
+					_, _ = w.Write(b[i : i+1])
+				}
+			},
+			severity:    "INFO",
+			protocol:    "gRPC-Web",
+			wantStatus:  map[string]interface{}{"code": 5.0, "message": "no order"},
+			wantRequest: true,
+		},
+		{
+			name:   "trailers-only OK",
+			opts:   []httpmw.MiddlewareOption{httpmw.WithGRPCWeb()},
+			header: map[string]string{"Content-Type": "application/grpc-web-text"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Grpc-Status", "0")
+			},
+			severity:    "INFO",
+			protocol:    "gRPC-Web",
+			wantRequest: true,
+		},
+		{
+			name:   "connect stream",
+			opts:   []httpmw.MiddlewareOption{httpmw.WithGRPCWeb()},
+			header: map[string]string{"Content-Type": "application/connect+proto"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write(message)
+				end := `{"error":{"code":"internal","message":"database unavailable"}}`
+				_, _ = w.Write(frame(0x02, end))
+			},
+			severity:    "ERROR",
+			protocol:    "Connect",
+			wantStatus:  map[string]interface{}{"code": 13.0, "message": "database unavailable"},
+			wantRequest: true,
+		},
+		{
+			name: "connect unary",
+			opts: []httpmw.MiddlewareOption{httpmw.WithGRPCWeb()},
+			header: map[string]string{
+				"Content-Type":             "application/json",
+				"Connect-Protocol-Version": "1",
+			},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`{"value":"hello"}`))
+			},
+			severity:    "INFO",
+			protocol:    "Connect",
+			wantRequest: true,
+		},
+		{
+			name:   "disabled",
+			header: map[string]string{"Content-Type": "application/grpc-web+proto"},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(http.TrailerPrefix+"Grpc-Status", "13")
+			},
+			severity: "INFO",
+			protocol: "HTTP/1.1",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			handler := httpmw.LoggingMiddleware(logger, tcase.opts...)(tcase.handler)
+			r := httptest.NewRequest(http.MethodPost, "/api/test.v1.OrderService/GetOrder", nil)
+			for k, v := range tcase.header {
+				r.Header.Set(k, v)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+			assert.Equal(t, tcase.severity, got["severity"])
+			httpRequest := got["httpRequest"].(map[string]interface{})
+			assert.Equal(t, tcase.protocol, httpRequest["protocol"])
+			assert.Equal(t, "200", httpRequest["status"])
+
+			logCtx := got["context"].(map[string]interface{})
+			if !tcase.wantRequest {
+				assert.NotContains(t, logCtx, "grpcRequest")
+				assert.NotContains(t, logCtx, "grpcStatus")
+				return
+			}
+			grpcRequest := logCtx["grpcRequest"].(map[string]interface{})
+			assert.Equal(t, "/test.v1.OrderService/GetOrder", grpcRequest["method"])
+			assert.NotEmpty(t, grpcRequest["duration"])
+			if tcase.wantStatus == nil {
+				assert.NotContains(t, logCtx, "grpcStatus")
+				return
+			}
+			grpcStatus := logCtx["grpcStatus"].(map[string]interface{})
+			assert.Equal(t, tcase.wantStatus["code"], grpcStatus["code"])
+			assert.Equal(t, tcase.wantStatus["message"], grpcStatus["message"])
+		})
+	}
+}
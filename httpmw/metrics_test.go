@@ -0,0 +1,82 @@
+package httpmw_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/httpmw"
+)
+
+type fakeMetrics struct {
+	mu           sync.Mutex
+	entries      map[string]int
+	bytes        map[string]int
+	formatErrors int
+	requests     map[string]int
+}
+
+func newFakeMetrics() *fakeMetrics {
+	return &fakeMetrics{
+		entries:  map[string]int{},
+		bytes:    map[string]int{},
+		requests: map[string]int{},
+	}
+}
+
+func (m *fakeMetrics) IncEntries(severity string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[severity]++
+}
+
+func (m *fakeMetrics) IncFormatErrors() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.formatErrors++
+}
+
+func (m *fakeMetrics) ObserveEntryBytes(severity string, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bytes[severity] += n
+}
+
+func (m *fakeMetrics) IncRequests(statusClass string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[statusClass]++
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := newFakeMetrics()
+
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(logadapter.WithMetrics(metrics))
+
+	handler := httpmw.LoggingMiddleware(
+		logger,
+		httpmw.WithRequestMetrics(metrics),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	logger.Error("failed")
+
+	assert.Equal(t, map[string]int{"2xx": 1, "4xx": 1}, metrics.requests)
+	assert.Equal(t, map[string]int{"INFO": 2, "ERROR": 1}, metrics.entries)
+	assert.Equal(t, out.Len(), metrics.bytes["INFO"]+metrics.bytes["ERROR"])
+	assert.Zero(t, metrics.formatErrors)
+}
@@ -0,0 +1,385 @@
+// Package httpmw provides HTTP middleware that writes request logs, and a
+// request-scoped log entry, formatted for stackdriver.
+package httpmw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/requestlog"
+	"github.com/felixge/httpsnoop"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// LoggingMiddleware proivdes a request-scoped log entry into context for HTTP
+// requests, writes request logs in a structured format to stackdriver.
+func LoggingMiddleware(
+	log *logrus.Logger,
+	opts ...MiddlewareOption,
+) func(http.Handler) http.Handler {
+	o := middleware.Evaluate(defaultOptions, opts)
+	var stats *requestStats
+	if o.AggregationWindow > 0 {
+		stats = newRequestStats(log, o.AggregationWindow)
+	}
+
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := middleware.WithLogger(r.Context(), log)
+			ctx = middleware.WithRequestErrors(ctx, o.RequestErrorLimit)
+			ctx = middleware.WithDependencies(ctx)
+			if o.UserExtractor != nil {
+				ctx = middleware.WithHTTPHeader(ctx, r.Header)
+				middleware.AddUser(ctx, o.UserExtractor)
+			}
+			ctx = middleware.WithIdentity(ctx)
+			if o.HTTPErrorHandler != nil {
+				ctx = middleware.WithPanicRecord(ctx)
+			}
+
+			// the fields of the request are added to a copy of the entry
+			fields := logrus.Fields{
+				"forwardIP": r.Header.Get("X-Forwarded-For"),
+			}
+			if len(o.HeaderFields) > 0 {
+				for k, v := range middleware.RequestFields(o.HeaderFields, r.Header.Values) {
+					fields[k] = v
+				}
+			}
+			if o.TLSDetails && r.TLS != nil {
+				for k, v := range tlsFields(r.TLS) {
+					fields[k] = v
+				}
+			}
+			ctx = ctxlogrus.WithFields(ctx, fields)
+			r = r.WithContext(ctx)
+
+			// https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#HttpRequest
+			request := &requestlog.HTTPRequest{
+				RequestMethod: r.Method,
+				RequestURL:    r.RequestURI,
+				RemoteIP:      getRemoteIP(r, o.RemoteIP),
+				ServerIP:      getServerIP(r),
+				Referer:       r.Referer(),
+				UserAgent:     r.UserAgent(),
+				Protocol:      r.Proto,
+			}
+			ctxlogrus.AddFields(ctx, logrus.Fields{requestlog.KeyHTTPRequest: request})
+
+			var rpc *rpcTracker
+			var rpcRequest *requestlog.GRPCRequest
+			if o.GRPCWeb {
+				if rpc = newRPCTracker(r); rpc != nil {
+					request.Protocol = rpc.protocol
+					rpcRequest = grpcRequest(r, request)
+					ctxlogrus.AddFields(ctx, logrus.Fields{requestlog.KeyGRPCRequest: rpcRequest})
+				}
+			}
+
+			// the size of chunked uploads is only known once they are read
+			var counted *countingReader
+			if r.ContentLength >= 0 {
+				request.RequestSize = strconv.FormatInt(r.ContentLength, 10)
+			} else if r.Body != nil && r.Body != http.NoBody {
+				counted = &countingReader{ReadCloser: r.Body}
+				r.Body = counted
+			}
+
+			capture := captureBody(r, o.BodyCaptureMax, o.BodyCaptureTypes)
+
+			var encoding *encodingCounter
+			if o.ContentEncodingAware {
+				encoding = &encodingCounter{}
+				w = encoding.wrap(w)
+				defer encoding.close()
+			}
+			if rpc != nil {
+				w = rpc.wrap(w)
+			}
+			headers := newHeaderCapture(o)
+			if headers != nil {
+				w = headers.wrap(w)
+			}
+
+			stopStart := func() {}
+			if o.RequestStartLog && o.FilterHTTP(r) {
+				stopStart = logRequestStart(ctx, o.RequestStartThreshold, request, rpcRequest)
+				// the start of a request panicking is not logged after the panic
+				defer stopStart()
+			}
+
+			m := httpsnoop.CaptureMetrics(handler, w, r)
+			stopStart()
+
+			request.Status = strconv.Itoa(m.Code)
+			request.Latency = fmt.Sprintf("%.5fs", m.Duration.Seconds())
+			// handlers may correct the size of streamed responses
+			sizeSet := request.ResponseSize != ""
+			if !sizeSet {
+				request.ResponseSize = strconv.FormatInt(m.Written, 10)
+			}
+			if counted != nil {
+				request.RequestSize = strconv.FormatInt(counted.n, 10)
+			}
+			var responseHeaders map[string]string
+			if headers != nil {
+				responseHeaders = headers.fields(o)
+				headers.cacheStatus(o, request)
+			}
+			// RPCs served over HTTP fail with a status, regardless of the HTTP status
+			failed := m.Code >= http.StatusInternalServerError
+			var rpcCode uint32
+			if rpc != nil {
+				rpcRequest.Duration = request.Latency
+				if st, ok := rpc.status(); ok {
+					rpcCode = st.Code
+					if raw, err := rpcStatusJSON(st); err == nil && rpcCode != rpcCodeOK {
+						ctxlogrus.AddFields(ctx, logrus.Fields{requestlog.KeyGRPCStatus: raw})
+					}
+					failed = failed || rpcCode == rpcCodeInternal
+				}
+			}
+			if encoding != nil {
+				if size, wire, ok := encoding.uncompressed(m.Written); ok {
+					ctxlogrus.AddFields(ctx, logrus.Fields{"responseSizeUncompressed": size})
+					if !wire && !sizeSet {
+						request.ResponseSize = ""
+					}
+				}
+			}
+
+			if o.FilterHTTP(r) {
+				o.Metrics.IncRequests(middleware.StatusClass(m.Code))
+
+				// log the result
+				entry := ctxlogrus.Extract(ctx).
+					WithField(requestlog.KeyHTTPRequest, requestlog.Details{HTTPRequest: request})
+				route := r.URL.String()
+				statsRoute := r.URL.Path
+				if o.RoutePattern != nil {
+					// without a matched route, fall back to the raw path
+					route = r.URL.Path
+					if pattern := o.RoutePattern(r); pattern != "" {
+						route = pattern
+						statsRoute = pattern
+						entry = entry.WithField("routePattern", pattern)
+					}
+				}
+
+				level := logrus.InfoLevel
+				if ctxErr := r.Context().Err(); ctxErr != nil {
+					entry = entry.WithField("contextError", ctxErr.Error())
+					// the client hanging up before we respond is worth a warning
+					if errors.Is(ctxErr, context.Canceled) {
+						entry = entry.WithField("clientDisconnected", true)
+						level = logrus.WarnLevel
+					}
+				}
+				// as the gRPC interceptors log internal errors
+				if rpcCode == rpcCodeInternal {
+					level = logrus.ErrorLevel
+				}
+				if errs := middleware.RequestErrorFields(ctx); errs != nil {
+					entry = entry.WithFields(errs)
+					level = middleware.RequestErrorLevel(level, failed)
+				}
+				if deps := middleware.DependencyFields(ctx); deps != nil {
+					entry = entry.WithFields(deps)
+				}
+				if responseHeaders != nil {
+					entry = entry.WithField("responseHeaders", responseHeaders)
+				}
+				if o.SLOClassifier != nil {
+					entry = entry.WithFields(middleware.SLOFields(
+						o.SLOClassifier(r, m.Code, m.Duration)))
+				}
+				// report each failed request once, unless its handler already did
+				if o.ErrorSummaryStatus > 0 && m.Code >= o.ErrorSummaryStatus {
+					if err, handled := middleware.RequestError(ctx); !handled {
+						level = logrus.ErrorLevel
+						if err != nil {
+							entry = entry.WithError(err)
+						}
+						entry = entry.WithField(requestlog.KeyHTTPRequest, requestlog.Details{
+							HTTPRequest: request,
+							ReportError: true,
+						})
+					}
+				}
+				// bodies of failed requests help to reproduce them
+				if capture != nil && failed {
+					if body, ok := capture.body(); ok {
+						entry = entry.WithField("requestBody", body)
+					}
+				}
+				level, slow := o.LatencyLevel(level, m.Duration)
+				if slow {
+					entry = entry.WithField("slowRequest", true)
+				}
+				msg := fmt.Sprintf("served HTTP %v %v", r.Method, route)
+				if o.SummaryMessage != nil {
+					msg = o.SummaryMessage(r, m.Code, m.Duration)
+				}
+				msg = middleware.DependencyMessage(ctx, msg)
+				aggregated := false
+				if stats != nil {
+					var requestBytes int64
+					if counted != nil {
+						requestBytes = counted.n
+					} else if r.ContentLength > 0 {
+						requestBytes = r.ContentLength
+					}
+					stats.observe(requestStatsKey{
+						method:      r.Method,
+						route:       statsRoute,
+						statusClass: middleware.StatusClass(m.Code),
+					}, m.Duration, requestBytes, m.Written)
+					// only the summaries of errors are logged besides the statistics
+					if failed && level > logrus.ErrorLevel {
+						level = logrus.ErrorLevel
+					}
+					aggregated = level > logrus.ErrorLevel
+				}
+				if !o.NoSummaryLog && !aggregated {
+					entry.Log(level, msg)
+				}
+
+				if o.HTTPErrorHandler != nil && failed {
+					report := middleware.NewErrorReport(ctx, entry, level, msg)
+					report.HTTPRequest = request
+					o.HTTPErrorHandler(ctx, report)
+				}
+			}
+		})
+	}
+}
+
+// logRequestStart logs the start of a request with a copy of its details, as
+// they are completed by its handler meanwhile
+func logRequestStart(
+	ctx context.Context,
+	threshold time.Duration,
+	request *requestlog.HTTPRequest,
+	rpcRequest *requestlog.GRPCRequest,
+) (stop func()) {
+	started := *request
+	fields := logrus.Fields{requestlog.KeyHTTPRequest: requestlog.Details{HTTPRequest: &started}}
+	if rpcRequest != nil {
+		rpcStarted := *rpcRequest
+		fields[requestlog.KeyGRPCRequest] = &rpcStarted
+	}
+	return middleware.LogRequestStart(threshold, func() *logrus.Entry {
+		return ctxlogrus.Extract(ctx).WithFields(fields)
+	})
+}
+
+// RecoveryMiddleware recovers from panics in the HTTP handler chain, logging
+// an error for Error Reporting.
+//
+// The error has the method, path, client IP, user agent and referer of the
+// request, even when the LoggingMiddleware is not installed, or is installed
+// within the RecoveryMiddleware. Panics are then logged with the standard
+// logger.
+//
+// Panics with http.ErrAbortHandler, with which net/http and reverse proxies
+// abort responses, such as when the client disconnects, are logged as
+// "request aborted" at WARNING without a stack trace, and panic again for
+// net/http to abort the response. No response is written to clients that
+// already disconnected.
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return NewRecoveryMiddleware()(next)
+}
+
+// NewRecoveryMiddleware returns the RecoveryMiddleware configured with opts,
+// such as WithAbortPanicsReported and WithRemoteIPStrategy. Other options are
+// ignored.
+func NewRecoveryMiddleware(opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	o := middleware.Evaluate(defaultOptions, opts)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				e := recover()
+				if e == nil {
+					return
+				}
+
+				ctx := r.Context()
+				request := panicRequest(r, o.RemoteIP)
+				fields := logrus.Fields{requestlog.KeyHTTPRequest: request}
+
+				err := middleware.PanicError(e)
+				if !o.ReportAbortPanics && errors.Is(err, http.ErrAbortHandler) {
+					middleware.LogAbort(ctx, fields)
+					panic(e)
+				}
+
+				// the response of a client gone would not be read, while one past
+				// a deadline still is
+				if !errors.Is(ctx.Err(), context.Canceled) {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusInternalServerError)
+					// writing fails when the connection is gone, which isn't worth logging
+					_ = json.NewEncoder(w).Encode(newServerError())
+					request.Status = strconv.Itoa(http.StatusInternalServerError)
+				}
+
+				middleware.LogPanic(ctx, err, fields)
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// panicRequest describes a request that panicked, without its query, which
+// may hold sensitive parameters, with the client IP picked by strategy. Its
+// status is left to be set once a response is written.
+func panicRequest(r *http.Request, strategy RemoteIPStrategy) *requestlog.HTTPRequest {
+	return &requestlog.HTTPRequest{
+		RequestMethod: r.Method,
+		RequestURL:    r.URL.Path,
+		UserAgent:     r.UserAgent(),
+		RemoteIP:      getRemoteIP(r, strategy),
+		Referer:       r.Referer(),
+		Protocol:      r.Proto,
+	}
+}
+
+// serverError is the JSON encoding of a google.rpc.Status with code INTERNAL,
+// as a gRPC service would respond with, carrying a RequestInfo detail
+type serverError struct {
+	Code    int           `json:"code"`
+	Message string        `json:"message"`
+	Details []requestInfo `json:"details"`
+}
+
+type requestInfo struct {
+	Type        string `json:"@type"`
+	RequestID   string `json:"requestId"`
+	ServingData string `json:"servingData"`
+}
+
+// codeInternal is the google.rpc.Code for internal errors
+const codeInternal = 13
+
+func newServerError() serverError {
+	// generate a shared UUID we can find this log entry from client-provided response body
+	reqID, _ := uuid.NewV4()
+	return serverError{
+		Code:    codeInternal,
+		Message: "server error",
+		Details: []requestInfo{{
+			Type:      "type.googleapis.com/google.rpc.RequestInfo",
+			RequestID: reqID.String(),
+		}},
+	}
+}
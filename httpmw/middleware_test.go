@@ -0,0 +1,1076 @@
+package httpmw_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/httpmw"
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/trace"
+	// registers RequestInfo so the status details of a panic response resolve
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
+	pbstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	s := newHTTPTestSuite(t)
+
+	suite.Run(t, &httpMiddlewareSuite{s})
+}
+
+type httpMiddlewareSuite struct {
+	*httpTestSuite
+}
+
+func (s *httpMiddlewareSuite) TestPanic() {
+	t := s.T()
+	s.buffer.Reset()
+
+	req, err := http.NewRequest("GET", s.server.URL+"/panic", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	req.WithContext(ctx)
+
+	res, err := s.Client.Do(req)
+	require.NoError(t, err, "can't error on successful call")
+	defer res.Body.Close()
+
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"), "responds as JSON")
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err, "can read body")
+
+	pbs := &pbstatus.Status{}
+	if err := protojson.Unmarshal(body, pbs); err != nil {
+		t.Fatal(err)
+	}
+	st := status.FromProto(pbs)
+	assert.Equal(t, codes.Internal, st.Code(), "status code is internal server error")
+	assert.Equal(t, "server error", st.Message(), "non-descript server error")
+
+	if got, want := res.StatusCode, http.StatusInternalServerError; got != want {
+		t.Errorf("wrong status recieved; got %d, wanted %d", got, want)
+	}
+
+	var logged map[string]interface{}
+	dec := json.NewDecoder(s.mutexBuffer)
+	for dec.More() {
+		var msg map[string]interface{}
+		require.NoError(t, dec.Decode(&msg))
+		if msg["severity"] == "ERROR" {
+			logged = msg
+		}
+	}
+	require.NotNil(t, logged, "panic is logged")
+	assert.Equal(t,
+		"panic handling request: surprise panic attack!",
+		strings.SplitN(logged["message"].(string), "\n", 2)[0],
+		"panic message is the first line")
+
+	stack := logged["stack_trace"].(string)
+	i := strings.Index(stack, "panic: surprise panic attack!\n\ngoroutine ")
+	require.NotEqual(t, -1, i, "stack trace reads as a runtime panic")
+	frames := strings.SplitN(stack[i:], "\n", 8)[2:7]
+	for _, line := range frames {
+		assert.NotContains(t, line, "runtime/debug")
+		assert.NotContains(t, line, "internal/middleware")
+		assert.NotContains(t, line, "RecoveryMiddleware")
+	}
+	assert.Contains(t, frames[1], "ServePanic", "stack starts at the code that panicked")
+}
+
+func (s *httpMiddlewareSuite) TestLogging() {
+	t := s.T()
+	s.buffer.Reset()
+
+	req, err := http.NewRequest("GET", s.server.URL+"/logging", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	req.WithContext(ctx)
+
+	req.Header.Set("X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1")
+
+	res, err := s.Client.Do(req)
+	require.NoError(t, err, "can't error on successful call")
+
+	if got, want := res.StatusCode, http.StatusOK; got != want {
+		t.Errorf("wrong status recieved; got %d, wanted %d", got, want)
+	}
+	_, _ = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	dec := json.NewDecoder(s.mutexBuffer)
+	var entries int
+	for dec.More() {
+		var msg map[string]interface{}
+		require.NoError(t, dec.Decode(&msg))
+		entries++
+
+		data := msg["context"].(map[string]interface{})["data"].(map[string]interface{})
+		assert.Equal(t, "TLS1.3", data["tlsVersion"], "TLS details are request-scoped")
+		assert.NotEmpty(t, data["tlsCipherSuite"])
+		assert.Contains(t, data, "tlsServerName")
+		assert.Equal(t, "h2", data["alpnProtocol"])
+		assert.Equal(t, false, data["clientCertPresent"])
+	}
+	assert.Equal(t, 2, entries, "the handler entry and summary are logged")
+}
+
+func TestTLSDetailsPlaintext(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	handler := httpmw.LoggingMiddleware(logger, httpmw.WithTLSDetails())(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+	for _, key := range []string{
+		"tlsVersion", "tlsCipherSuite", "tlsServerName", "alpnProtocol", "clientCertPresent",
+	} {
+		assert.NotContains(t, data, key)
+	}
+}
+
+func (s *httpMiddlewareSuite) TestBackground() {
+	t := s.T()
+	s.buffer.Reset()
+
+	res, err := s.Client.Get(s.server.URL + "/background")
+	require.NoError(t, err, "can't error on successful call")
+	_, _ = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	close(s.responded)
+
+	select {
+	case <-s.background:
+	case <-time.After(5 * time.Second):
+		t.Fatal("background work did not finish")
+	}
+
+	var background map[string]interface{}
+	dec := json.NewDecoder(s.mutexBuffer)
+	for dec.More() {
+		var msg map[string]interface{}
+		require.NoError(t, dec.Decode(&msg))
+		if msg["message"] == "background work done" {
+			background = msg
+		}
+	}
+	require.NotNil(t, background, "background work is logged after the response")
+
+	assert.Equal(t,
+		"projects/test-project/traces/105445aa7843bc8bf206b12000100000",
+		background["logging.googleapis.com/trace"])
+	data := background["context"].(map[string]interface{})["data"].(map[string]interface{})
+	assert.Equal(t, "testValue", data["testField"])
+	assert.Nil(t, data["contextErr"], "background context is not cancelled with the request")
+}
+
+func TestChiRoutePattern(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	router := chi.NewRouter()
+	router.Use(httpmw.LoggingMiddleware(
+		logger,
+		httpmw.WithRoutePattern(httpmw.ChiRoutePattern),
+	))
+	router.Get("/users/{id}/orders/{orderID}", func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/12345/orders/987?full=true", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+	assert.Equal(t, "served HTTP GET /users/{id}/orders/{orderID}", got["message"])
+	data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+	assert.Equal(t, "/users/{id}/orders/{orderID}", data["routePattern"])
+	httpRequest := got["httpRequest"].(map[string]interface{})
+	assert.Equal(t, "/users/12345/orders/987?full=true", httpRequest["requestUrl"],
+		"full URL is kept in the request details")
+}
+
+func TestHTTPClientDisconnected(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	started := make(chan struct{})
+	logged := make(chan struct{})
+	handler := httpmw.LoggingMiddleware(logger)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-r.Context().Done()
+		}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(logged)
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/slow", nil)
+	require.NoError(t, err)
+	go func() {
+		<-started
+		cancel()
+	}()
+	_, err = srv.Client().Do(req)
+	require.Error(t, err)
+
+	select {
+	case <-logged:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not logged")
+	}
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	assert.Equal(t, "WARNING", got["severity"])
+	data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+	assert.Equal(t, true, data["clientDisconnected"])
+	assert.Equal(t, context.Canceled.Error(), data["contextError"])
+}
+
+func TestLatencyThresholds(t *testing.T) {
+	for _, tcase := range []struct {
+		name       string
+		warnAfter  time.Duration
+		errorAfter time.Duration
+		severity   string
+		slow       interface{}
+	}{
+		{"disabled", 0, 0, "INFO", nil},
+		{"under thresholds", time.Second, 2 * time.Second, "INFO", nil},
+		{"over warn threshold", 10 * time.Millisecond, time.Second, "WARNING", true},
+		{"over error threshold", 5 * time.Millisecond, 10 * time.Millisecond, "ERROR", true},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			handler := httpmw.LoggingMiddleware(
+				logger,
+				httpmw.WithLatencyThresholds(tcase.warnAfter, tcase.errorAfter),
+			)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(20 * time.Millisecond)
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+			assert.Equal(t, tcase.severity, got["severity"])
+			data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+			assert.Equal(t, tcase.slow, data["slowRequest"])
+			assert.Contains(t, got, "httpRequest", "request details are still promoted")
+		})
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	for _, tcase := range []struct {
+		name     string
+		status   int
+		recorded int
+		listed   int
+		severity string
+		dropped  interface{}
+	}{
+		{"none", http.StatusOK, 0, 0, "INFO", nil},
+		{"succeeded", http.StatusOK, 2, 2, "WARNING", nil},
+		{"failed", http.StatusServiceUnavailable, 2, 2, "ERROR", nil},
+		{"over limit", http.StatusOK, 5, 3, "WARNING", 2.0},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			handler := httpmw.LoggingMiddleware(logger, httpmw.WithRequestErrorLimit(3))(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					for i := 0; i < tcase.recorded; i++ {
+						logadapter.AddRequestError(r.Context(),
+							fmt.Errorf("cache miss %d", i),
+							logrus.Fields{"key": "order-42", "cause": errors.New("timeout")})
+					}
+					w.WriteHeader(tcase.status)
+				}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+			assert.Equal(t, tcase.severity, got["severity"])
+			data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+			assert.Equal(t, tcase.dropped, data["requestErrorsDropped"])
+			if tcase.recorded == 0 {
+				assert.NotContains(t, data, logadapter.KeyRequestErrors)
+				return
+			}
+			logged := data[logadapter.KeyRequestErrors].([]interface{})
+			require.Len(t, logged, tcase.listed)
+			for i, e := range logged {
+				e := e.(map[string]interface{})
+				assert.Equal(t, fmt.Sprintf("cache miss %d", i), e["message"])
+				assert.Equal(t, map[string]interface{}{"key": "order-42", "cause": "timeout"},
+					e["fields"])
+				assert.Contains(t, e, "elapsedAtMs")
+			}
+		})
+	}
+}
+
+func TestErrorSummary(t *testing.T) {
+	errPayment := errors.New("payment gateway unavailable")
+	for _, tcase := range []struct {
+		name    string
+		handled bool
+	}{
+		{"unhandled", false},
+		{"handler logged", true},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithService("checkout"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			handler := httpmw.LoggingMiddleware(logger, httpmw.WithErrorSummary(0))(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					logadapter.SetRequestError(r.Context(), errPayment)
+					if tcase.handled {
+						ctxlogrus.Extract(r.Context()).WithError(errPayment).Error("charge failed")
+						logadapter.MarkRequestErrorHandled(r.Context())
+					}
+					w.WriteHeader(http.StatusBadGateway)
+				}))
+			handler.ServeHTTP(httptest.NewRecorder(),
+				httptest.NewRequest(http.MethodPost, "/orders", nil))
+
+			var reported []map[string]interface{}
+			var summary map[string]interface{}
+			dec := json.NewDecoder(&out)
+			for dec.More() {
+				var got map[string]interface{}
+				require.NoError(t, dec.Decode(&got))
+				if got["@type"] != nil {
+					reported = append(reported, got)
+				}
+				if got["httpRequest"] != nil {
+					summary = got
+				}
+			}
+			require.Len(t, reported, 1, "the failed request is reported once")
+			require.NotNil(t, summary)
+			assert.Contains(t, reported[0]["message"], errPayment.Error())
+
+			context := summary["context"].(map[string]interface{})
+			if tcase.handled {
+				assert.Equal(t, "INFO", summary["severity"])
+				assert.NotContains(t, summary, "@type")
+				assert.NotContains(t, context, "httpRequest")
+				return
+			}
+			assert.Equal(t, "ERROR", summary["severity"])
+			assert.Contains(t, summary["message"], "served HTTP POST /orders")
+			request := summary["httpRequest"].(map[string]interface{})
+			assert.Equal(t, "502", request["status"])
+			assert.Equal(t, map[string]interface{}{
+				"method":             "POST",
+				"url":                "/orders",
+				"responseStatusCode": 502.0,
+				"remoteIp":           "192.0.2.1",
+			}, context["httpRequest"], "Error Reporting reads the request from the error context")
+		})
+	}
+}
+
+func TestRequestFromContext(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	handler := httpmw.LoggingMiddleware(logger)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Nil(t, logadapter.GRPCRequestFromContext(r.Context()))
+			logadapter.SetCacheStatus(r.Context(), true, true)
+			logadapter.HTTPRequestFromContext(r.Context()).ResponseSize = "1048576"
+			_, _ = w.Write([]byte("cached"))
+		}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/report", nil))
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	request := got["httpRequest"].(map[string]interface{})
+	assert.Equal(t, true, request["cacheLookup"])
+	assert.Equal(t, true, request["cacheHit"])
+	assert.Equal(t, "1048576", request["responseSize"], "the size set by the handler is kept")
+
+	assert.Nil(t, logadapter.HTTPRequestFromContext(context.Background()))
+	logadapter.SetCacheStatus(context.Background(), true, false)
+}
+
+func TestSLOClassifier(t *testing.T) {
+	slos := httpmw.SLOTable{
+		{Name: "checkout", Prefix: "/checkout/", Latency: time.Millisecond},
+		{Name: "api", Prefix: "/api/"},
+	}
+	for _, tcase := range []struct {
+		name      string
+		path      string
+		status    int
+		delay     time.Duration
+		eligible  bool
+		violation bool
+		slo       interface{}
+	}{
+		{"eligible", "/api/orders", http.StatusOK, 0, true, false, "api"},
+		{"client error", "/api/orders", http.StatusNotFound, 0, true, false, "api"},
+		{"server error", "/api/orders", http.StatusServiceUnavailable, 0, true, true, "api"},
+		{"slow", "/checkout/cart", http.StatusOK, 5 * time.Millisecond, true, true, "checkout"},
+		{"ineligible", "/static/logo.png", http.StatusServiceUnavailable, 0, false, false, nil},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			handler := httpmw.LoggingMiddleware(logger,
+				httpmw.WithSLOClassifier(slos.Classify))(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					time.Sleep(tcase.delay)
+					w.WriteHeader(tcase.status)
+				}))
+			handler.ServeHTTP(httptest.NewRecorder(),
+				httptest.NewRequest(http.MethodGet, tcase.path, nil))
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+			data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+			assert.Equal(t, tcase.eligible, data["sloEligible"])
+			assert.Equal(t, tcase.violation, data["sloViolation"])
+			assert.Equal(t, tcase.slo, data["sloName"])
+			if tcase.slo == nil {
+				assert.NotContains(t, got, "logging.googleapis.com/labels")
+				return
+			}
+			assert.Equal(t, map[string]interface{}{"slo": tcase.slo},
+				got["logging.googleapis.com/labels"])
+		})
+	}
+}
+
+func TestDependencyCalls(t *testing.T) {
+	for _, tcase := range []struct {
+		name    string
+		calls   int
+		listed  int
+		dropped interface{}
+	}{
+		{"parallel", 20, 20, nil},
+		{"over limit", 55, 50, 5.0},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			handler := httpmw.LoggingMiddleware(logger)(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var wg sync.WaitGroup
+					for i := 0; i < tcase.calls; i++ {
+						wg.Add(1)
+						go func(i int) {
+							defer wg.Done()
+							name := "inventory"
+							var err error
+							if i == 3 {
+								name, err = "payments", errors.New("connection refused")
+							}
+							call := logadapter.StartDependencyCall(r.Context(), name)
+							call.SetDetail("shard", i)
+							call.End(err)
+						}(i)
+					}
+					wg.Wait()
+					w.WriteHeader(http.StatusBadGateway)
+				}))
+			handler.ServeHTTP(httptest.NewRecorder(),
+				httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+			data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+			assert.Equal(t, tcase.dropped, data["dependenciesDropped"])
+			calls := data[logadapter.KeyDependencies].([]interface{})
+			require.Len(t, calls, tcase.listed)
+
+			var failed []interface{}
+			for _, c := range calls {
+				c := c.(map[string]interface{})
+				assert.Contains(t, c, "duration")
+				assert.Contains(t, c["detail"], "shard")
+				if c["error"] != nil {
+					failed = append(failed, c)
+				}
+			}
+			if len(failed) == 0 {
+				assert.Equal(t, "served HTTP GET /orders", got["message"])
+				return
+			}
+			assert.Equal(t, []interface{}{map[string]interface{}{
+				"name":        "payments",
+				"error":       "connection refused",
+				"duration":    failed[0].(map[string]interface{})["duration"],
+				"startedAtMs": failed[0].(map[string]interface{})["startedAtMs"],
+				"detail":      map[string]interface{}{"shard": 3.0},
+			}}, failed)
+			assert.Equal(t, "served HTTP GET /orders (failed dependencies: payments)",
+				got["message"])
+		})
+	}
+}
+
+type claimsKey struct{}
+
+// bearerToken is an unsigned JWT with the sub claim
+func bearerToken(sub string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"` + sub + `"}`))
+	return "Bearer eyJhbGciOiJub25lIn0." + payload + ".c2ln"
+}
+
+func TestUserExtractor(t *testing.T) {
+	// authentication within the logging middleware adds claims to the context
+	authenticate := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if sub := r.Header.Get("X-Test-Subject"); sub != "" {
+				r = r.WithContext(context.WithValue(r.Context(), claimsKey{}, sub))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	fromClaims := func(ctx context.Context) string {
+		sub, _ := ctx.Value(claimsKey{}).(string)
+		return sub
+	}
+
+	for _, tcase := range []struct {
+		name    string
+		extract httpmw.UserExtractor
+		header  string
+		value   string
+		want    interface{}
+	}{
+		{"claims", fromClaims, "X-Test-Subject", "user-42", "user-42"},
+		{"bearer token", httpmw.UnverifiedBearerSubject,
+			"Authorization", bearerToken("user-42"), "user-42"},
+		{"anonymous", httpmw.UnverifiedBearerSubject, "Authorization", "Basic dXNlcg==", nil},
+		{"malformed token", httpmw.UnverifiedBearerSubject,
+			"Authorization", "Bearer not.a-jwt", nil},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithService("test"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			handler := httpmw.LoggingMiddleware(logger, httpmw.WithUserExtractor(tcase.extract))(
+				authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					ctxlogrus.Extract(r.Context()).Error("payment failed")
+				})))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(tcase.header, tcase.value)
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			dec := json.NewDecoder(&out)
+			var entries int
+			for dec.More() {
+				var got map[string]interface{}
+				require.NoError(t, dec.Decode(&got))
+				entries++
+				logCtx := got["context"].(map[string]interface{})
+				assert.Equal(t, tcase.want, logCtx["user"], "%v", got["message"])
+				data, _ := logCtx["data"].(map[string]interface{})
+				assert.NotContains(t, data, "user")
+			}
+			assert.Equal(t, 2, entries, "the error and summary are logged")
+		})
+	}
+}
+
+func TestRequestIdentity(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+		logadapter.WithEntryMutator(func(_ *logrus.Entry, e *logadapter.Entry) error {
+			if claims, ok := e.Context.Data[logadapter.KeyClaims].(map[string]interface{}); ok {
+				claims["email"] = "[REDACTED]"
+			}
+			return nil
+		}),
+	)
+
+	authenticate := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logadapter.SetRequestIdentity(r.Context(), "user-42",
+				map[string]string{"email": "jane@example.com", "scope": "orders"})
+			next.ServeHTTP(w, r)
+		})
+	}
+	anonymous := func(context.Context) string { return "anonymous" }
+	handler := httpmw.LoggingMiddleware(logger, httpmw.WithUserExtractor(anonymous))(
+		authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctxlogrus.Extract(r.Context()).Info("looking up order")
+		})))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	dec := json.NewDecoder(&out)
+	for _, msg := range []string{"looking up order", "served HTTP GET /"} {
+		var got map[string]interface{}
+		require.NoError(t, dec.Decode(&got))
+		assert.Equal(t, msg, got["message"])
+		logCtx := got["context"].(map[string]interface{})
+		assert.Equal(t, "user-42", logCtx["user"], "the identity takes precedence")
+		claims := logCtx["data"].(map[string]interface{})["claims"]
+		assert.Equal(t, map[string]interface{}{"email": "[REDACTED]", "scope": "orders"}, claims,
+			"claims are redacted by entry mutators")
+	}
+}
+
+func TestHTTPErrorHandler(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	reports := make(chan *httpmw.ErrorReport, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("out of stock")
+	})
+	mux.HandleFunc("/unavailable", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	handler := httpmw.LoggingMiddleware(logger,
+		httpmw.WithHTTPErrorHandler(func(ctx context.Context, report *httpmw.ErrorReport) {
+			reports <- report
+		}),
+	)(httpmw.RecoveryMiddleware(mux))
+
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x10, 0x54, 0x45, 0xaa, 0x78, 0x43, 0xbc, 0x8b},
+		SpanID:  trace.SpanID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+	})
+	serve := func(path string) {
+		ctx := trace.ContextWithSpanContext(context.Background(), spanCtx)
+		req := httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	serve("/panic")
+	report := <-reports
+	assert.Equal(t, "served HTTP GET /panic", report.Entry.Message)
+	assert.Equal(t, "INFO", report.Entry.Severity)
+	assert.Equal(t, "projects/test-project/traces/105445aa7843bc8b0000000000000000",
+		report.Entry.Trace)
+	assert.Equal(t, "0102030405060708", report.Entry.SpanID)
+	require.NotNil(t, report.HTTPRequest)
+	assert.Equal(t, "500", report.HTTPRequest.Status)
+	assert.EqualError(t, report.Err, "out of stock")
+	assert.True(t, strings.HasPrefix(report.StackTrace, "panic: out of stock\n\ngoroutine "),
+		"stack of the recovered panic is reported")
+
+	serve("/unavailable")
+	report = <-reports
+	assert.Equal(t, "503", report.HTTPRequest.Status)
+	assert.NoError(t, report.Err)
+	assert.Empty(t, report.StackTrace)
+
+	serve("/ok")
+	select {
+	case report := <-reports:
+		t.Errorf("successful request was reported: %+v", report)
+	default:
+	}
+}
+
+func TestBodyCaptureOnError(t *testing.T) {
+	large := `{"items":"` + strings.Repeat("x", 10<<20) + `"}`
+	for _, tcase := range []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		want        interface{}
+	}{
+		{"failed json", http.StatusInternalServerError, "application/json", `{"sku":1}`,
+			`{"sku":1}`},
+		{"succeeded json", http.StatusOK, "application/json", `{"sku":1}`, nil},
+		{"client error", http.StatusBadRequest, "application/json", `{"sku":1}`, nil},
+		{"truncated", http.StatusBadGateway, "application/json; charset=utf-8", large,
+			`{"items":"xxxxxx...[truncated]`},
+		{"other content type", http.StatusInternalServerError, "text/plain", "sku=1", nil},
+		{"binary", http.StatusInternalServerError, "application/json", "\xff\xfe\x00", nil},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			var read int
+			handler := httpmw.LoggingMiddleware(
+				logger,
+				httpmw.WithBodyCaptureOnError(16),
+			)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+				read = len(b)
+				w.WriteHeader(tcase.status)
+			}))
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tcase.body))
+			r.Header.Set("Content-Type", tcase.contentType)
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			assert.Equal(t, len(tcase.body), read, "the handler reads the whole body")
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+			data, _ := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+			assert.Equal(t, tcase.want, data["requestBody"])
+		})
+	}
+}
+
+func TestHeaderFields(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	handler := httpmw.LoggingMiddleware(
+		logger,
+		httpmw.WithHeaderFields(map[string]string{
+			"X-Tenant-ID": "tenantID",
+			"X-Region":    "region",
+		}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctxlogrus.Extract(r.Context()).Info("looking up order")
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Add("x-tenant-id", "acme")
+	r.Header.Add("x-tenant-id", "globex")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	dec := json.NewDecoder(&out)
+	for _, msg := range []string{"looking up order", "served HTTP GET /"} {
+		var got map[string]interface{}
+		require.NoError(t, dec.Decode(&got))
+		assert.Equal(t, msg, got["message"])
+		data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+		assert.Equal(t, "acme,globex", data["tenantID"])
+		assert.NotContains(t, data, "region", "missing headers produce no field")
+	}
+}
+
+func TestResponseHeaderFields(t *testing.T) {
+	long := strings.Repeat("a", 600)
+	for _, tcase := range []struct {
+		name      string
+		xCache    string
+		cacheHit  interface{}
+		extraHead string
+	}{
+		{"hit", "HIT, MISS", true, ""},
+		{"miss", "MISS", nil, long},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			handler := httpmw.LoggingMiddleware(
+				logger,
+				httpmw.WithResponseHeaderFields("content-type", "Cache-Control", "X-Debug"),
+				httpmw.WithCacheHeaderDetection("X-Cache", "hit"),
+			)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Add("Cache-Control", "public")
+				w.Header().Add("Cache-Control", "max-age=60")
+				w.Header().Set("X-Cache", tcase.xCache)
+				if tcase.extraHead != "" {
+					w.Header().Set("X-Debug", tcase.extraHead)
+				}
+				_, _ = w.Write([]byte("{}"))
+				w.Header().Set("Content-Type", "text/plain")
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+			var got map[string]interface{}
+			require.NoError(t, json.NewDecoder(&out).Decode(&got))
+			data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+			headers := data["responseHeaders"].(map[string]interface{})
+			assert.Equal(t, "application/json", headers["Content-Type"],
+				"headers are captured as sent, not as modified afterwards")
+			assert.Equal(t, "public, max-age=60", headers["Cache-Control"])
+			if tcase.extraHead != "" {
+				assert.Len(t, headers["X-Debug"], 512)
+			} else {
+				assert.NotContains(t, headers, "X-Debug")
+			}
+
+			request := got["httpRequest"].(map[string]interface{})
+			assert.Equal(t, true, request["cacheLookup"])
+			assert.Equal(t, tcase.cacheHit, request["cacheHit"])
+		})
+	}
+}
+
+func TestSummaryMessage(t *testing.T) {
+	custom := httpmw.WithSummaryMessage(func(r *http.Request, status int, d time.Duration) string {
+		return fmt.Sprintf("request %s %s completed with %d", r.Method, r.URL.Path, status)
+	})
+	for _, tcase := range []struct {
+		name     string
+		opts     []httpmw.MiddlewareOption
+		messages []string
+	}{
+		{"default", nil, []string{"looking up order", "served HTTP GET /orders/1"}},
+		{"custom", []httpmw.MiddlewareOption{custom},
+			[]string{"looking up order", "request GET /orders/1 completed with 404"}},
+		{"suppressed", []httpmw.MiddlewareOption{httpmw.WithoutSummaryLog()},
+			[]string{"looking up order"}},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			handler := httpmw.LoggingMiddleware(logger, tcase.opts...)(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					ctxlogrus.Extract(r.Context()).Info("looking up order")
+					w.WriteHeader(http.StatusNotFound)
+				}),
+			)
+			handler.ServeHTTP(httptest.NewRecorder(),
+				httptest.NewRequest(http.MethodGet, "/orders/1", nil))
+
+			var messages []string
+			dec := json.NewDecoder(&out)
+			for dec.More() {
+				var got map[string]interface{}
+				require.NoError(t, dec.Decode(&got))
+				messages = append(messages, got["message"].(string))
+				if len(messages) == 1 {
+					logCtx := got["context"].(map[string]interface{})
+					assert.Contains(t, logCtx, "httpRequest", "handlers have request details")
+				}
+			}
+			assert.Equal(t, tcase.messages, messages)
+		})
+	}
+}
+
+// startedHook signals the entries logged as requests start
+type startedHook chan struct{}
+
+func (h startedHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h startedHook) Fire(e *logrus.Entry) error {
+	if e.Message == "request started" {
+		h <- struct{}{}
+	}
+	return nil
+}
+
+func TestRequestStartLog(t *testing.T) {
+	for _, tcase := range []struct {
+		name      string
+		threshold time.Duration
+		slow      bool
+		want      []string
+	}{
+		{"slow", 10 * time.Millisecond, true, []string{"INFO", "INFO"}},
+		{"fast", time.Hour, false, []string{"INFO"}},
+		{"every request", 0, false, []string{"DEBUG", "INFO"}},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Level = logrus.DebugLevel
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+			started := make(startedHook, 1)
+			logger.AddHook(started)
+
+			mw := httpmw.LoggingMiddleware(logger, httpmw.WithRequestStartLog(tcase.threshold))
+			handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tcase.slow {
+					select {
+					case <-started:
+					case <-time.After(5 * time.Second):
+						t.Error("the start of the request was not logged")
+					}
+				}
+				logadapter.SetCacheStatus(r.Context(), true, true)
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(),
+				httptest.NewRequest(http.MethodPost, "/reports", nil))
+
+			var severities []string
+			var entries []map[string]interface{}
+			dec := json.NewDecoder(&out)
+			for dec.More() {
+				var got map[string]interface{}
+				require.NoError(t, dec.Decode(&got))
+				severities = append(severities, got["severity"].(string))
+				entries = append(entries, got)
+			}
+			require.Equal(t, tcase.want, severities)
+			if len(entries) == 1 {
+				return
+			}
+
+			start := entries[0]
+			assert.Equal(t, "request started", start["message"])
+			request := start["httpRequest"].(map[string]interface{})
+			assert.Equal(t, "POST", request["requestMethod"])
+			assert.Equal(t, "/reports", request["requestUrl"])
+			assert.Equal(t, "192.0.2.1", request["remoteIp"])
+			assert.NotContains(t, request, "status")
+			assert.NotContains(t, request, "latency")
+			assert.NotContains(t, request, "cacheHit", "the handler completes a copy")
+			assert.Equal(t, "served HTTP POST /reports", entries[1]["message"])
+		})
+	}
+}
+
+func TestErrorRequestContext(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithService("checkout"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	handler := httpmw.LoggingMiddleware(logger)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctxlogrus.Extract(r.Context()).WithError(errors.New("card declined")).
+				Error("charge failed")
+			w.WriteHeader(http.StatusPaymentRequired)
+		}))
+	r := httptest.NewRequest(http.MethodPost, "/orders?retry=1", nil)
+	r.Header.Set("User-Agent", "checkout/1.0")
+	r.Header.Set("Referer", "https://shop.example.com/cart")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	var logged map[string]interface{}
+	require.NoError(t, json.NewDecoder(&out).Decode(&logged))
+	assert.Equal(t, "ERROR", logged["severity"])
+	require.NotNil(t, logged["@type"], "the error is reported")
+	assert.Equal(t, map[string]interface{}{
+		"method":    "POST",
+		"url":       "/orders?retry=1",
+		"userAgent": "checkout/1.0",
+		"referrer":  "https://shop.example.com/cart",
+		"remoteIp":  "192.0.2.1",
+	}, logged["context"].(map[string]interface{})["httpRequest"],
+		"the request has the fields of Error Reporting, without a status until served")
+}
@@ -0,0 +1,263 @@
+package httpmw
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+)
+
+var defaultOptions = &middleware.Options{
+	FilterHTTP: DefaultFilterHTTP,
+	RemoteIP:   GCPLoadBalancer,
+	Metrics:    middleware.NoopMetrics{},
+}
+
+// MiddlewareOption configures the logging middleware. Options are shared with
+// the grpcmw package, and those that do not apply to HTTP are ignored.
+type MiddlewareOption = middleware.Option
+
+// UserExtractor identifies the user making a request, or returns "" if
+// unknown.
+type UserExtractor = middleware.UserExtractor
+
+// FilterHTTP determines whether or not to log a request.
+type FilterHTTP = middleware.FilterHTTP
+
+// RequestMetricsRecorder receives counts of the requests logged by the
+// logging middleware, by status class (e.g. "2xx").
+type RequestMetricsRecorder = middleware.RequestMetricsRecorder
+
+// HTTPErrorHandler receives a report of a 5xx response or recovered panic.
+type HTTPErrorHandler = middleware.HTTPErrorHandler
+
+// ErrorReport describes a failed request to an HTTPErrorHandler.
+type ErrorReport = middleware.ErrorReport
+
+// SummaryMessage composes the message of the entry logged for a request, from
+// the request, its response status and how long it took.
+type SummaryMessage = middleware.SummaryMessage
+
+// WithSummaryMessage replaces the message of the entry logged for each
+// request, "served HTTP <method> <route>" by default.
+func WithSummaryMessage(f SummaryMessage) MiddlewareOption {
+	return middleware.WithSummaryMessage(f)
+}
+
+// WithoutSummaryLog suppresses the entry logged for each request, such as when
+// relying on load balancer logs instead. Handlers are still provided with a
+// request-scoped log entry, and 5xx responses are still reported to any
+// HTTPErrorHandler.
+func WithoutSummaryLog() MiddlewareOption {
+	return middleware.WithoutSummaryLog()
+}
+
+// WithContentEncodingAwareness logs the uncompressed size of gzip encoded
+// responses as "responseSizeUncompressed", so it may be compared with the
+// uncompressed requestSize.
+//
+// If the response is compressed inside LoggingMiddleware, the responseSize is
+// the compressed size written, and what was written is decoded to count its
+// uncompressed size. If it is compressed outside, what was written is the
+// uncompressed size, and the responseSize is omitted as it is not known.
+func WithContentEncodingAwareness() MiddlewareOption {
+	return middleware.WithContentEncodingAwareness()
+}
+
+// WithGRPCWeb logs gRPC-Web and Connect requests as RPCs. Their protocol is
+// logged as "gRPC-Web" or "Connect", with their method in grpcRequest, and
+// the status found in the last frame of the response, or in its headers and
+// trailers, in grpcStatus. As with the gRPC interceptors, the summary of an
+// RPC failing with an internal error is logged as ERROR, and reported to the
+// HTTPErrorHandler.
+func WithGRPCWeb() MiddlewareOption {
+	return middleware.WithGRPCWeb()
+}
+
+// WithHTTPErrorHandler provides a report of each 5xx response, with its log
+// entry, request details and the stack of any panic recovered by
+// RecoveryMiddleware, so that it may be forwarded to other sinks.
+func WithHTTPErrorHandler(h HTTPErrorHandler) MiddlewareOption {
+	return middleware.WithHTTPErrorHandler(h)
+}
+
+// WithBodyCaptureOnError logs the body of requests failing with a 5xx status
+// as "requestBody", truncated to maxBytes. Only bodies of the given content
+// types, or else of application/json, are captured, and binary bodies are
+// skipped. The body is passed through to the handler unchanged.
+func WithBodyCaptureOnError(maxBytes int, contentTypes ...string) MiddlewareOption {
+	return middleware.WithBodyCaptureOnError(maxBytes, contentTypes...)
+}
+
+// WithHeaderFields adds the values of request headers, such as a tenant ID, to
+// every entry logged for a request, mapping header names to field names.
+// Multiple values are joined with "," and limited to 256 bytes.
+func WithHeaderFields(fields map[string]string) MiddlewareOption {
+	return middleware.WithHeaderFields(fields)
+}
+
+// WithHTTPFilter provides a filter to the logging middleware that determines
+// whether or not to log individual messages
+func WithHTTPFilter(f FilterHTTP) MiddlewareOption {
+	return middleware.WithHTTPFilter(f)
+}
+
+// DefaultFilterHTTP filters health checks and monitoring canaries from some well known user agents
+// or URL paths.
+func DefaultFilterHTTP(r *http.Request) bool {
+	return middleware.DefaultFilterHTTP(r)
+}
+
+// WithRoutePattern records the route template matched for an HTTP request as
+// "routePattern", and uses it in place of the request URL in the summary
+// message, so that log entries may be grouped by endpoint. See
+// ChiRoutePattern, GorillaMuxRoutePattern and ServeMuxRoutePattern.
+func WithRoutePattern(f RoutePattern) MiddlewareOption {
+	return middleware.WithRoutePattern(f)
+}
+
+// WithRemoteIPStrategy configures how the client IP of an HTTP request is
+// determined. Defaults to GCPLoadBalancer.
+func WithRemoteIPStrategy(strategy RemoteIPStrategy) MiddlewareOption {
+	return middleware.WithRemoteIPStrategy(strategy)
+}
+
+// WithRequestMetrics records counts of the requests logged by status class.
+func WithRequestMetrics(m RequestMetricsRecorder) MiddlewareOption {
+	return middleware.WithRequestMetrics(m)
+}
+
+// WithTLSDetails adds the TLS connection of a request to the request-scoped
+// fields: tlsVersion (such as "TLS1.3"), tlsCipherSuite, tlsServerName,
+// alpnProtocol (such as "h2" or "http/1.1") and clientCertPresent. Plaintext
+// requests have none of them.
+func WithTLSDetails() MiddlewareOption {
+	return middleware.WithTLSDetails()
+}
+
+// WithUserExtractor adds the user identified by f, if any, as the user field
+// of the entries of each request, which the formatter promotes to
+// context.user, so that Error Reporting counts the users affected by errors.
+// It is called with the context of the entries of the request until it
+// identifies a user, so it sees values added by authentication installed
+// within the logging middleware, and the user is kept for the rest of the
+// request, summary included.
+func WithUserExtractor(f UserExtractor) MiddlewareOption {
+	return middleware.WithUserExtractor(f)
+}
+
+// UnverifiedBearerSubject is a UserExtractor returning the sub claim of a JWT
+// bearer token in the Authorization header of a request, without verifying the token.
+// It is only meant for logging, and not to be trusted for anything else.
+func UnverifiedBearerSubject(ctx context.Context) string {
+	return middleware.UnverifiedBearerSubject(ctx)
+}
+
+// WithRequestErrorLimit caps the errors recorded with
+// logadapter.AddRequestError that are listed in the summary of a request.
+// Defaults to 20; further errors are only counted.
+func WithRequestErrorLimit(n int) MiddlewareOption {
+	return middleware.WithRequestErrorLimit(n)
+}
+
+// WithLatencyThresholds logs the summary of requests slower than warnAfter at
+// WARNING, and slower than errorAfter at ERROR, whatever their status, marking
+// them with "slowRequest". A zero threshold is disabled.
+func WithLatencyThresholds(warnAfter, errorAfter time.Duration) MiddlewareOption {
+	return middleware.WithLatencyThresholds(warnAfter, errorAfter)
+}
+
+// WithErrorSummary logs the summary of requests failing with a status of at
+// least minStatus (500 if minStatus is not positive) at ERROR, as the error
+// event of the request: it carries the error recorded with
+// logadapter.SetRequestError, and the request both as httpRequest and in the
+// error context. Requests whose handler already logged the error, marked with
+// logadapter.MarkRequestErrorHandled, and recovered panics keep their summary,
+// so that each failed request is reported once.
+func WithErrorSummary(minStatus int) MiddlewareOption {
+	return middleware.WithErrorSummary(minStatus)
+}
+
+// SLOClassifier decides whether a request counts towards an SLO, whether it
+// violated it, and which SLO it counts towards.
+type SLOClassifier = middleware.SLOClassifier
+
+// SLORule is an SLO of the requests whose path starts with its Prefix, which
+// they violate when failing with a 5xx status or taking longer than its
+// Latency, unless zero.
+type SLORule = middleware.SLORule
+
+// SLOTable classifies requests by the first of its rules matching them, and
+// requests no rule matches as ineligible. Its Classify method is an
+// SLOClassifier:
+//
+//	slos := httpmw.SLOTable{
+//		{Name: "checkout", Prefix: "/checkout/", Latency: 300 * time.Millisecond},
+//		{Name: "api", Prefix: "/api/", Latency: time.Second},
+//	}
+//	httpmw.LoggingMiddleware(log, httpmw.WithSLOClassifier(slos.Classify))
+type SLOTable = middleware.SLOTable
+
+// WithSLOClassifier adds the classification of each request by f to its
+// summary, as the sloEligible, sloViolation and sloName fields, and the slo
+// label naming the SLO, so that SLO burn can be computed from logs.
+func WithSLOClassifier(f SLOClassifier) MiddlewareOption {
+	return middleware.WithSLOClassifier(f)
+}
+
+// WithRequestStartLog logs "request started" with the details of the request
+// known before its handler runs, so that long-running requests show in logs
+// while in flight. With a zero threshold, it is logged at DEBUG for every
+// request. Otherwise, it is logged at INFO only for requests still running
+// after threshold, so that fast requests are still logged once.
+func WithRequestStartLog(threshold time.Duration) MiddlewareOption {
+	return middleware.WithRequestStartLog(threshold)
+}
+
+// WithAbortPanicsReported configures NewRecoveryMiddleware to recover panics
+// with http.ErrAbortHandler, and log them as errors with their stack trace,
+// as any other panic, rather than as aborted requests.
+func WithAbortPanicsReported() MiddlewareOption {
+	return middleware.WithAbortPanicsReported()
+}
+
+// WithTimeoutResponse configures TimeoutMiddleware to write the response of
+// requests whose handler exceeded the timeout with h, rather than a JSON
+// google.rpc.Status with code DEADLINE_EXCEEDED. Other middleware ignore it.
+func WithTimeoutResponse(h http.Handler) MiddlewareOption {
+	return middleware.WithTimeoutResponse(h)
+}
+
+// WithResponseHeaderFields logs the values of the named response headers, such
+// as Content-Type and Cache-Control, as sent with the response, in the
+// "responseHeaders" field of the summary of each request, keyed by their
+// canonical name. Multiple values are joined with ", " and limited to 512
+// bytes.
+func WithResponseHeaderFields(names ...string) MiddlewareOption {
+	return middleware.WithResponseHeaderFields(names...)
+}
+
+// WithCacheHeaderDetection records responses sent with the header, such as
+// X-Cache, as cache lookups in the cacheLookup field of their httpRequest, and
+// those whose first value of the header is hitValue, such as "HIT", compared
+// case-insensitively, as cache hits in cacheHit, unless their handler set the
+// cache status with logadapter.SetCacheStatus.
+func WithCacheHeaderDetection(header, hitValue string) MiddlewareOption {
+	return middleware.WithCacheHeaderDetection(header, hitValue)
+}
+
+// WithAggregatedLogging logs, for each window, such as a minute, an INFO entry
+// per method, route and status class of the requests served in it, with their
+// count, latency percentiles and sizes in the "requestStats" field, rather
+// than the summary of each request. The summaries of failed requests, with a
+// 5xx status, are still logged, at ERROR, as are those escalated to ERROR.
+//
+// Routes are those matched WithRoutePattern, or else the paths of requests.
+// Past 100 distinct method, route and status classes in a window, requests are
+// counted under the method and route "other". The statistics of a window are
+// logged once it ends, or when flushed with logadapter.FlushAll, such as on
+// shutdown.
+func WithAggregatedLogging(window time.Duration) MiddlewareOption {
+	return middleware.WithAggregatedLogging(window)
+}
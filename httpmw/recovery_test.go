@@ -0,0 +1,297 @@
+package httpmw_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/httpmw"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoveryRequestContext(t *testing.T) {
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("out of stock")
+	})
+	for _, tcase := range []struct {
+		name       string
+		handler    func(logger *logrus.Logger) http.Handler
+		wantURL    string
+		wantStatus interface{}
+	}{
+		{
+			name: "recovery inside logging",
+			handler: func(logger *logrus.Logger) http.Handler {
+				return httpmw.LoggingMiddleware(logger)(httpmw.RecoveryMiddleware(panicking))
+			},
+			wantURL: "/orders/42?token=secret",
+		},
+		{
+			name: "logging inside recovery",
+			handler: func(logger *logrus.Logger) http.Handler {
+				return httpmw.RecoveryMiddleware(httpmw.LoggingMiddleware(logger)(panicking))
+			},
+			wantURL:    "/orders/42",
+			wantStatus: 500.0,
+		},
+		{
+			name: "recovery alone",
+			handler: func(logger *logrus.Logger) http.Handler {
+				return httpmw.RecoveryMiddleware(panicking)
+			},
+			wantURL:    "/orders/42",
+			wantStatus: 500.0,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			formatter := logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithService("test"),
+				logadapter.WithSkipTimestamp(),
+			)
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = formatter
+
+			// panics without a request-scoped logger use the standard logger
+			std := logrus.StandardLogger()
+			stdOut, stdFormatter := std.Out, std.Formatter
+			defer func() { std.Out, std.Formatter = stdOut, stdFormatter }()
+			std.Out, std.Formatter = &out, formatter
+
+			r := httptest.NewRequest(http.MethodGet, "/orders/42?token=secret", nil)
+			r.Header.Set("User-Agent", "checkout/1.0")
+			r.Header.Set("X-Forwarded-For", "203.0.113.195, 192.0.2.1")
+			w := httptest.NewRecorder()
+			tcase.handler(logger).ServeHTTP(w, r)
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+			var logged map[string]interface{}
+			dec := json.NewDecoder(&out)
+			for dec.More() {
+				var got map[string]interface{}
+				require.NoError(t, dec.Decode(&got), "entries are valid JSON")
+				if msg, _ := got["message"].(string); strings.HasPrefix(msg, "panic handling") {
+					logged = got
+				}
+			}
+			require.NotNil(t, logged, "the panic is logged")
+
+			assert.Equal(t, "ERROR", logged["severity"])
+			logCtx := logged["context"].(map[string]interface{})
+			request := logCtx["httpRequest"].(map[string]interface{})
+			assert.Equal(t, "GET", request["method"])
+			assert.Equal(t, tcase.wantURL, request["url"])
+			assert.Equal(t, "203.0.113.195", request["remoteIp"])
+			assert.Equal(t, "checkout/1.0", request["userAgent"])
+			assert.Equal(t, tcase.wantStatus, request["responseStatusCode"])
+		})
+	}
+}
+
+func TestRecoveryRemoteIPStrategy(t *testing.T) {
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("out of stock")
+	})
+	sleeping := newSleepingHandler(false)
+	defer close(sleeping.wake)
+	for _, tcase := range []struct {
+		name    string
+		handler http.Handler
+	}{
+		{
+			name: "recovery",
+			handler: httpmw.NewRecoveryMiddleware(
+				httpmw.WithRemoteIPStrategy(httpmw.PeerOnly))(panicking),
+		},
+		{
+			name: "timeout",
+			handler: httpmw.TimeoutMiddleware(20*time.Millisecond,
+				httpmw.WithRemoteIPStrategy(httpmw.PeerOnly))(sleeping),
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			// without a request-scoped logger, the request is described by
+			// the recovery itself
+			var out bytes.Buffer
+			std := logrus.StandardLogger()
+			stdOut, stdFormatter := std.Out, std.Formatter
+			defer func() { std.Out, std.Formatter = stdOut, stdFormatter }()
+			std.Out = &out
+			std.Formatter = logadapter.NewFormatter(logadapter.WithProjectID("test-project"))
+
+			r := httptest.NewRequest(http.MethodGet, "/orders/42", nil)
+			r.Header.Set("X-Forwarded-For", "203.0.113.195, 192.0.2.1")
+			tcase.handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			var logged map[string]interface{}
+			require.NoError(t, json.NewDecoder(&out).Decode(&logged))
+			assert.Equal(t, "ERROR", logged["severity"])
+			request := logged["context"].(map[string]interface{})["httpRequest"]
+			assert.Equal(t, "192.0.2.1", request.(map[string]interface{})["remoteIp"],
+				"the client IP is picked with the configured strategy")
+		})
+	}
+}
+
+func TestRecoveryAbortHandler(t *testing.T) {
+	aborting := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	for _, tcase := range []struct {
+		name      string
+		recovery  func(http.Handler) http.Handler
+		reported  bool
+		wantLevel string
+	}{
+		{"aborted", httpmw.RecoveryMiddleware, false, "WARNING"},
+		{"reported", httpmw.NewRecoveryMiddleware(httpmw.WithAbortPanicsReported()), true, "ERROR"},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithService("test"),
+				logadapter.WithSkipTimestamp(),
+			)
+			handler := httpmw.LoggingMiddleware(logger)(tcase.recovery(aborting))
+
+			w := httptest.NewRecorder()
+			serve := func() {
+				handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+			}
+			if tcase.reported {
+				serve()
+				assert.Equal(t, http.StatusInternalServerError, w.Code)
+			} else {
+				assert.PanicsWithValue(t, http.ErrAbortHandler, serve,
+					"net/http aborts the response")
+			}
+
+			var entries []map[string]interface{}
+			dec := json.NewDecoder(&out)
+			for dec.More() {
+				var got map[string]interface{}
+				require.NoError(t, dec.Decode(&got))
+				entries = append(entries, got)
+			}
+			require.NotEmpty(t, entries)
+			logged := entries[0]
+			assert.Equal(t, tcase.wantLevel, logged["severity"])
+			if tcase.reported {
+				assert.NotNil(t, logged["@type"])
+				return
+			}
+			require.Len(t, entries, 1, "aborted requests have no summary")
+			assert.Equal(t, "request aborted", logged["message"])
+			assert.Nil(t, logged["@type"], "aborted requests are not reported as errors")
+			assert.Nil(t, logged["stack_trace"])
+			request := logged["context"].(map[string]interface{})["httpRequest"]
+			assert.Equal(t, "/stream", request.(map[string]interface{})["url"])
+		})
+	}
+}
+
+func TestRecoveryClientGone(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithService("test"),
+		logadapter.WithSkipTimestamp(),
+	)
+	handler := httpmw.LoggingMiddleware(logger)(httpmw.RecoveryMiddleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("out of stock")
+		})))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil).WithContext(ctx))
+	assert.Empty(t, w.Body.String(), "no response is written to a client gone")
+
+	var messages []string
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var got map[string]interface{}
+		require.NoError(t, dec.Decode(&got))
+		messages = append(messages, got["message"].(string))
+	}
+	require.Len(t, messages, 2, "the panic and the summary are logged, without write errors")
+	assert.True(t, strings.HasPrefix(messages[0], "panic handling request: out of stock"))
+}
+
+func TestRecoveryDeadlineExceeded(t *testing.T) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	handler := httpmw.LoggingMiddleware(logger)(httpmw.RecoveryMiddleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("out of stock")
+		})))
+
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil).WithContext(ctx))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":13`,
+		"the client is still connected past the deadline")
+}
+
+func TestRecoveryStatus(t *testing.T) {
+	gone, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, tcase := range []struct {
+		name       string
+		panicValue interface{}
+		ctx        context.Context
+		wantStatus interface{}
+	}{
+		{"written", "out of stock", context.Background(), 500.0},
+		{"client gone", "out of stock", gone, nil},
+		{"aborted", http.ErrAbortHandler, context.Background(), nil},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			// without a request-scoped logger, the request is described by
+			// the recovery itself
+			var out bytes.Buffer
+			std := logrus.StandardLogger()
+			stdOut, stdFormatter := std.Out, std.Formatter
+			defer func() { std.Out, std.Formatter = stdOut, stdFormatter }()
+			std.Out = &out
+			std.Formatter = logadapter.NewFormatter(logadapter.WithProjectID("test-project"))
+
+			handler := httpmw.RecoveryMiddleware(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					panic(tcase.panicValue)
+				}))
+			r := httptest.NewRequest(http.MethodGet, "/orders", nil).WithContext(tcase.ctx)
+			func() {
+				defer func() { _ = recover() }()
+				handler.ServeHTTP(httptest.NewRecorder(), r)
+			}()
+
+			var logged map[string]interface{}
+			require.NoError(t, json.NewDecoder(&out).Decode(&logged))
+			request := logged["context"].(map[string]interface{})["httpRequest"]
+			require.NotNil(t, request)
+			assert.Equal(t, tcase.wantStatus,
+				request.(map[string]interface{})["responseStatusCode"])
+			assert.NotContains(t, request, "status")
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package httpmw
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+)
+
+// RemoteIPStrategy determines the client IP of an HTTP request. The result is
+// only logged when it parses as an IP address, otherwise the peer address of
+// the connection is used.
+type RemoteIPStrategy = middleware.RemoteIPStrategy
+
+// GCPLoadBalancer picks the client IP as appended to X-Forwarded-For by a GCP
+// HTTP(S) load balancer, falling back to the peer IP.
+// https://cloud.google.com/load-balancing/docs/https#x-forwarded-for_header
+func GCPLoadBalancer(r *http.Request) string {
+	// x-Forwarded-For directly from GCP LB is assumed to be sanitized
+	// format: `<unverified IP(s)>, <client IP>, <global fw rule ext. IP>, <other proxies IP>`
+	// only second and third entries are added for requests through GCP
+	forwarded := forwardedFor(r)
+	if len(forwarded) >= 2 {
+		return forwarded[len(forwarded)-2]
+	}
+	return PeerOnly(r)
+}
+
+// PeerOnly ignores X-Forwarded-For, and uses the peer IP of the connection.
+func PeerOnly(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RightmostTrusted walks X-Forwarded-For from the right, skipping addresses
+// within the trusted proxy ranges, and picks the first untrusted address.
+// X-Forwarded-For is only considered when the peer itself is trusted.
+func RightmostTrusted(trustedCIDRs []netip.Prefix) RemoteIPStrategy {
+	trusted := func(addr netip.Addr) bool {
+		for _, p := range trustedCIDRs {
+			if p.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(r *http.Request) string {
+		peer, ok := parseIP(PeerOnly(r))
+		if !ok || !trusted(peer) {
+			return PeerOnly(r)
+		}
+
+		client := peer
+		forwarded := forwardedFor(r)
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			addr, ok := parseIP(forwarded[i])
+			if !ok {
+				// a malformed hop can't be trusted to have been added by our proxies
+				break
+			}
+			client = addr
+			if !trusted(addr) {
+				break
+			}
+		}
+		return client.String()
+	}
+}
+
+// forwardedFor splits the X-Forwarded-For header into its hops
+func forwardedFor(r *http.Request) []string {
+	fwdHeader := r.Header.Get("X-Forwarded-For")
+	if fwdHeader == "" {
+		return nil
+	}
+
+	forwarded := strings.Split(fwdHeader, ",")
+	for i := range forwarded {
+		forwarded[i] = strings.TrimSpace(forwarded[i])
+	}
+	return forwarded
+}
+
+// parseIP parses an IP address, optionally with a port, as found in
+// X-Forwarded-For or a listener address
+func parseIP(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	addr, err := netip.ParseAddr(strings.Trim(s, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// getRemoteIP extracts the remote IP with the configured strategy, validating
+// it parses as an IP and falling back to the peer IP otherwise
+func getRemoteIP(r *http.Request, strategy RemoteIPStrategy) string {
+	if addr, ok := parseIP(strategy(r)); ok {
+		return addr.String()
+	}
+
+	if addr, ok := parseIP(PeerOnly(r)); ok {
+		return addr.String()
+	}
+	return "0.0.0.0"
+}
+
+// getServerIP extracts the IP of the listener that accepted the request
+func getServerIP(r *http.Request) string {
+	local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok || local == nil {
+		return ""
+	}
+
+	addr, ok := parseIP(local.String())
+	if !ok {
+		return ""
+	}
+	return addr.String()
+}
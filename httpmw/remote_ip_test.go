@@ -0,0 +1,146 @@
+package httpmw_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/httpmw"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteIPStrategy(t *testing.T) {
+	trusted := httpmw.RightmostTrusted([]netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	})
+	custom := func(r *http.Request) string {
+		return r.Header.Get("X-Client-IP")
+	}
+
+	for _, tcase := range []struct {
+		name       string
+		strategy   logadapter.RemoteIPStrategy
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "gcp load balancer",
+			strategy:   httpmw.GCPLoadBalancer,
+			remoteAddr: "10.0.0.1:3456",
+			headers:    map[string]string{"X-Forwarded-For": "1.1.1.1, 203.0.113.7, 35.1.1.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "gcp load balancer without header",
+			strategy:   httpmw.GCPLoadBalancer,
+			remoteAddr: "192.0.2.10:3456",
+			want:       "192.0.2.10",
+		},
+		{
+			name:       "gcp load balancer spoofed garbage",
+			strategy:   httpmw.GCPLoadBalancer,
+			remoteAddr: "192.0.2.10:3456",
+			headers:    map[string]string{"X-Forwarded-For": "<script>, 35.1.1.1"},
+			want:       "192.0.2.10",
+		},
+		{
+			name:       "peer only ignores header",
+			strategy:   httpmw.PeerOnly,
+			remoteAddr: "192.0.2.10:3456",
+			headers:    map[string]string{"X-Forwarded-For": "1.1.1.1, 203.0.113.7"},
+			want:       "192.0.2.10",
+		},
+		{
+			name:       "peer only ipv6",
+			strategy:   httpmw.PeerOnly,
+			remoteAddr: "[2001:db8::1]:3456",
+			want:       "2001:db8::1",
+		},
+		{
+			name:       "rightmost trusted skips proxies",
+			strategy:   trusted,
+			remoteAddr: "10.0.0.1:3456",
+			headers: map[string]string{
+				"X-Forwarded-For": "6.6.6.6, 203.0.113.7, 10.1.1.1, 10.2.2.2",
+			},
+			want: "203.0.113.7",
+		},
+		{
+			name:       "rightmost trusted ignores spoofed header from untrusted peer",
+			strategy:   trusted,
+			remoteAddr: "198.51.100.4:3456",
+			headers:    map[string]string{"X-Forwarded-For": "6.6.6.6, 10.2.2.2"},
+			want:       "198.51.100.4",
+		},
+		{
+			name:       "rightmost trusted ipv6 with ports",
+			strategy:   trusted,
+			remoteAddr: "[2001:db8::2]:443",
+			headers: map[string]string{
+				"X-Forwarded-For": "[2001:db9::5]:1234, [2001:db8::3]:80",
+			},
+			want: "2001:db9::5",
+		},
+		{
+			name:       "rightmost trusted without header",
+			strategy:   trusted,
+			remoteAddr: "10.0.0.1:3456",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "custom",
+			strategy:   custom,
+			remoteAddr: "10.0.0.1:3456",
+			headers:    map[string]string{"X-Client-IP": "203.0.113.9"},
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "custom invalid falls back to peer",
+			strategy:   custom,
+			remoteAddr: "10.0.0.1:3456",
+			headers:    map[string]string{"X-Client-IP": "not an ip"},
+			want:       "10.0.0.1",
+		},
+	} {
+		tcase := tcase
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			handler := httpmw.LoggingMiddleware(
+				logger,
+				httpmw.WithRemoteIPStrategy(tcase.strategy),
+			)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tcase.remoteAddr
+			for k, v := range tcase.headers {
+				req.Header.Set(k, v)
+			}
+			local := &net.TCPAddr{IP: net.ParseIP("192.0.2.200"), Port: 8080}
+			req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, local))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+			httpRequest := got["httpRequest"].(map[string]interface{})
+			assert.Equal(t, tcase.want, httpRequest["remoteIp"])
+			assert.Equal(t, "192.0.2.200", httpRequest["serverIp"])
+		})
+	}
+}
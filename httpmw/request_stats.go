@@ -0,0 +1,215 @@
+package httpmw
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/flushers"
+	"github.com/sirupsen/logrus"
+)
+
+// maxRequestStatsKeys bounds the distinct method, route and status classes
+// counted in a single window, anything past it is folded into
+// requestStatsOther
+const (
+	maxRequestStatsKeys = 100
+	requestStatsOther   = "other"
+)
+
+// latencyBuckets are the upper bounds of the buckets of the latency
+// histograms, doubling from 1ms to about a minute
+var latencyBuckets = func() []time.Duration {
+	b := make([]time.Duration, 17)
+	for i := range b {
+		b[i] = time.Millisecond << i
+	}
+	return b
+}()
+
+type requestStatsKey struct {
+	method      string
+	route       string
+	statusClass string
+}
+
+// requestCounts aggregates the requests of a key in a window
+type requestCounts struct {
+	count         int
+	requestBytes  int64
+	responseBytes int64
+	maxLatency    time.Duration
+	// the last bucket counts the requests slower than latencyBuckets
+	buckets [18]int
+}
+
+func (c *requestCounts) add(latency time.Duration, requestBytes, responseBytes int64) {
+	c.count++
+	c.requestBytes += requestBytes
+	c.responseBytes += responseBytes
+	if latency > c.maxLatency {
+		c.maxLatency = latency
+	}
+	i := sort.Search(len(latencyBuckets), func(i int) bool {
+		return latency <= latencyBuckets[i]
+	})
+	c.buckets[i]++
+}
+
+// percentile estimates the latency under which p of the requests were
+// served, as the upper bound of its bucket, up to the slowest request
+func (c *requestCounts) percentile(p float64) time.Duration {
+	rank := int(p*float64(c.count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	seen := 0
+	for i, n := range c.buckets {
+		if seen += n; seen < rank {
+			continue
+		}
+		if i < len(latencyBuckets) && latencyBuckets[i] < c.maxLatency {
+			return latencyBuckets[i]
+		}
+		break
+	}
+	return c.maxLatency
+}
+
+// requestStatsField is the requestStats field of the entries of
+// WithAggregatedLogging
+type requestStatsField struct {
+	Method        string  `json:"method"`
+	Route         string  `json:"route"`
+	StatusClass   string  `json:"statusClass"`
+	Count         int     `json:"count"`
+	LatencyP50Ms  float64 `json:"latencyP50Ms"`
+	LatencyP95Ms  float64 `json:"latencyP95Ms"`
+	LatencyP99Ms  float64 `json:"latencyP99Ms"`
+	LatencyMaxMs  float64 `json:"latencyMaxMs"`
+	RequestBytes  int64   `json:"requestBytes"`
+	ResponseBytes int64   `json:"responseBytes"`
+	WindowSeconds float64 `json:"windowSeconds"`
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// requestStats aggregates the requests served so they may be logged as a
+// single entry per key and window. It logs them from a goroutine running
+// while requests are served, which is registered to be flushed on shutdown.
+type requestStats struct {
+	logger *logrus.Logger
+	window time.Duration
+
+	mu      sync.Mutex
+	start   time.Time
+	counts  map[requestStatsKey]*requestCounts
+	running bool
+}
+
+func newRequestStats(logger *logrus.Logger, window time.Duration) *requestStats {
+	return &requestStats{
+		logger: logger,
+		window: window,
+		counts: make(map[requestStatsKey]*requestCounts),
+	}
+}
+
+// observe counts a request in the current window, starting to log the
+// windows if they were idle
+func (s *requestStats) observe(
+	key requestStatsKey,
+	latency time.Duration,
+	requestBytes, responseBytes int64,
+) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		s.running = true
+		s.start = time.Now()
+		go s.run(flushers.Register(s))
+	}
+
+	c, ok := s.counts[key]
+	if !ok && len(s.counts) >= maxRequestStatsKeys {
+		key.method, key.route = requestStatsOther, requestStatsOther
+		c, ok = s.counts[key]
+	}
+	if !ok {
+		c = &requestCounts{}
+		s.counts[key] = c
+	}
+	c.add(latency, requestBytes, responseBytes)
+}
+
+// run logs the statistics of each window, until one is idle
+func (s *requestStats) run(unregister func()) {
+	defer unregister()
+
+	ticker := time.NewTicker(s.window)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !s.emit(true) {
+			return
+		}
+	}
+}
+
+// Flush logs the statistics of the current window, as it ends early
+func (s *requestStats) Flush(context.Context) error {
+	s.emit(false)
+	return nil
+}
+
+// emit logs the statistics of the current window and starts another,
+// reporting whether any request was served in it. An idle window stops the
+// logging of windows if stopIdle.
+func (s *requestStats) emit(stopIdle bool) bool {
+	now := time.Now()
+	s.mu.Lock()
+	counts, start := s.counts, s.start
+	s.counts = make(map[requestStatsKey]*requestCounts)
+	s.start = now
+	if len(counts) == 0 && stopIdle {
+		s.running = false
+	}
+	s.mu.Unlock()
+
+	keys := make([]requestStatsKey, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.statusClass < b.statusClass
+	})
+
+	elapsed := now.Sub(start)
+	for _, k := range keys {
+		c := counts[k]
+		s.logger.WithField("requestStats", requestStatsField{
+			Method:        k.method,
+			Route:         k.route,
+			StatusClass:   k.statusClass,
+			Count:         c.count,
+			LatencyP50Ms:  milliseconds(c.percentile(0.50)),
+			LatencyP95Ms:  milliseconds(c.percentile(0.95)),
+			LatencyP99Ms:  milliseconds(c.percentile(0.99)),
+			LatencyMaxMs:  milliseconds(c.maxLatency),
+			RequestBytes:  c.requestBytes,
+			ResponseBytes: c.responseBytes,
+			WindowSeconds: elapsed.Seconds(),
+		}).Infof("served %d HTTP %s %s %s in last %gs",
+			c.count, k.method, k.route, k.statusClass, elapsed.Round(time.Second).Seconds())
+	}
+	return len(counts) > 0
+}
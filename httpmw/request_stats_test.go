@@ -0,0 +1,119 @@
+package httpmw_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/httpmw"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+)
+
+// requestStats returns the requestStats field of the entries logged, keyed by
+// their method, route and status class
+func requestStats(t *testing.T, rec *logtest.Recorder) map[string]map[string]interface{} {
+	stats := map[string]map[string]interface{}{}
+	for _, e := range rec.Entries() {
+		v, ok := logtest.Field(e, "context.data.requestStats")
+		if !ok {
+			continue
+		}
+		s := v.(map[string]interface{})
+		assert.Equal(t, logadapter.SeverityInfo, e.Severity)
+		stats[fmt.Sprintf("%v %v %v", s["method"], s["route"], s["statusClass"])] = s
+	}
+	return stats
+}
+
+func TestAggregatedLogging(t *testing.T) {
+	logger, rec := logtest.NewRecorder()
+	handler := httpmw.LoggingMiddleware(logger,
+		httpmw.WithAggregatedLogging(time.Hour),
+		httpmw.WithRoutePattern(func(r *http.Request) string {
+			return path.Dir(r.URL.Path) + "/{id}"
+		}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/500") {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	routes := []string{"/orders", "/carts", "/users"}
+	for i := 0; i < 1000; i++ {
+		method, body := http.MethodGet, ""
+		if i%3 == 0 {
+			method, body = http.MethodPost, "item"
+		}
+		r := httptest.NewRequest(method, fmt.Sprintf("%s/%d", routes[i%3], i),
+			strings.NewReader(body))
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	errs := rec.FilterBySeverity("ERROR")
+	require.Len(t, errs, 1, "the failed request is logged")
+	logtest.AssertField(t, errs[0], "httpRequest.status", "500")
+	assert.Len(t, rec.Entries(), 1, "the summaries of other requests are not logged")
+
+	require.NoError(t, logadapter.FlushAll(context.Background()))
+	stats := requestStats(t, rec)
+	require.Len(t, stats, 4)
+	for key, want := range map[string]struct {
+		count, requestBytes, responseBytes float64
+	}{
+		"POST /orders/{id} 2xx": {334, 334 * 4, 334 * 2},
+		"GET /carts/{id} 2xx":   {333, 0, 333 * 2},
+		"GET /users/{id} 2xx":   {332, 0, 332 * 2},
+		"GET /users/{id} 5xx":   {1, 0, 2},
+	} {
+		s := stats[key]
+		require.NotNil(t, s, key)
+		assert.Equal(t, want.count, s["count"], key)
+		assert.Equal(t, want.requestBytes, s["requestBytes"], key)
+		assert.Equal(t, want.responseBytes, s["responseBytes"], key)
+		assert.LessOrEqual(t, s["latencyP50Ms"], s["latencyP95Ms"], key)
+		assert.LessOrEqual(t, s["latencyP95Ms"], s["latencyP99Ms"], key)
+		assert.LessOrEqual(t, s["latencyP99Ms"], s["latencyMaxMs"], key)
+	}
+
+	rec.Reset()
+	require.NoError(t, logadapter.FlushAll(context.Background()))
+	assert.Empty(t, requestStats(t, rec), "the flushed window is logged once")
+}
+
+func TestAggregatedLoggingCardinality(t *testing.T) {
+	logger, rec := logtest.NewRecorder()
+	handler := httpmw.LoggingMiddleware(logger, httpmw.WithAggregatedLogging(time.Hour))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 150; i++ {
+		r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/orders/%d", i), nil)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	require.NoError(t, logadapter.FlushAll(context.Background()))
+
+	stats := requestStats(t, rec)
+	assert.Len(t, stats, 101)
+	require.Contains(t, stats, "other other 2xx")
+	assert.Equal(t, float64(50), stats["other other 2xx"]["count"])
+}
+
+func TestAggregatedLoggingWindow(t *testing.T) {
+	logger, rec := logtest.NewRecorder()
+	handler := httpmw.LoggingMiddleware(logger, httpmw.WithAggregatedLogging(10*time.Millisecond))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+	require.Eventually(t, func() bool {
+		return len(requestStats(t, rec)) == 1
+	}, time.Second, 5*time.Millisecond, "the window is logged once it ends")
+}
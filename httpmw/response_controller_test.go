@@ -0,0 +1,130 @@
+//go:build go1.21
+// +build go1.21
+
+package httpmw_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/httpmw"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+)
+
+// middlewareChains wrap handlers as servers compose the middleware, the
+// RecoveryMiddleware inside the LoggingMiddleware, with every option
+// wrapping the ResponseWriter
+func middlewareChains(t *testing.T) map[string]func(http.Handler) http.Handler {
+	logger, _ := logtest.NewRecorder()
+	logging := httpmw.LoggingMiddleware(logger,
+		httpmw.WithContentEncodingAwareness(),
+		httpmw.WithGRPCWeb(),
+		httpmw.WithResponseHeaderFields("Content-Type"),
+	)
+	return map[string]func(http.Handler) http.Handler{
+		"without middleware": func(h http.Handler) http.Handler { return h },
+		"recovery inside logging": func(h http.Handler) http.Handler {
+			return logging(httpmw.RecoveryMiddleware(h))
+		},
+		"timeout inside logging": func(h http.Handler) http.Handler {
+			return logging(httpmw.RecoveryMiddleware(httpmw.TimeoutMiddleware(time.Minute)(h)))
+		},
+	}
+}
+
+// serve responds to a request to the handler over a connection
+func serve(t *testing.T, h http.Handler, body io.Reader) (*http.Response, string) {
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/orders/42", "text/plain", body)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(b)
+}
+
+func TestResponseController(t *testing.T) {
+	// the handler reports what the ResponseController did, and streams its
+	// response with a trailer
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		deadline := time.Now().Add(time.Minute)
+		results := []error{
+			rc.SetReadDeadline(deadline),
+			rc.SetWriteDeadline(deadline),
+			rc.EnableFullDuplex(),
+		}
+
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusAccepted)
+		for _, err := range results {
+			fmt.Fprintf(w, "%v\n", err)
+		}
+		// full duplex responses are written while reading the request
+		in := bufio.NewScanner(r.Body)
+		for in.Scan() {
+			fmt.Fprintf(w, "read %s\n", in.Text())
+			results = append(results, rc.Flush())
+		}
+		_, _ = io.Copy(w, strings.NewReader("done\n"))
+		fmt.Fprintf(w, "flushed %v\n", results[3:])
+		w.Header().Set("X-Checksum", "42")
+	})
+
+	var want string
+	for name, chain := range middlewareChains(t) {
+		t.Run(name, func(t *testing.T) {
+			resp, body := serve(t, chain(handler), strings.NewReader("item 1\nitem 2\n"))
+			assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+			assert.Equal(t, "42", resp.Trailer.Get("X-Checksum"))
+			assert.Equal(t,
+				"<nil>\n<nil>\n<nil>\nread item 1\nread item 2\ndone\nflushed [<nil> <nil>]\n",
+				body)
+			if want == "" {
+				want = body
+			}
+			assert.Equal(t, want, body, "differs from the other chains")
+		})
+	}
+}
+
+func TestResponseControllerHijack(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+		_, _ = buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\n" +
+			"Connection: close\r\n\r\nhijacked")
+		_ = buf.Flush()
+	})
+
+	for name, chain := range middlewareChains(t) {
+		t.Run(name, func(t *testing.T) {
+			resp, body := serve(t, chain(handler), nil)
+			// TimeoutMiddleware guards the response, which it can't once hijacked
+			if strings.HasPrefix(name, "timeout") {
+				assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+				assert.Contains(t, body, http.ErrNotSupported.Error())
+				return
+			}
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "hijacked", body)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package httpmw
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/felixge/httpsnoop"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/requestlog"
+)
+
+// maxResponseHeaderLength limits the values of response headers logged
+const maxResponseHeaderLength = 512
+
+// headerCapture copies the response headers of interest as they are sent,
+// with the status or the first write, as handlers may still modify the
+// header map afterwards without effect
+type headerCapture struct {
+	header http.Header
+	names  []string
+	sent   http.Header
+}
+
+func newHeaderCapture(o *middleware.Options) *headerCapture {
+	names := make([]string, 0, len(o.ResponseHeaders)+1)
+	for _, name := range o.ResponseHeaders {
+		names = append(names, http.CanonicalHeaderKey(name))
+	}
+	if o.CacheHeader != "" {
+		names = append(names, http.CanonicalHeaderKey(o.CacheHeader))
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return &headerCapture{names: names}
+}
+
+func (c *headerCapture) wrap(w http.ResponseWriter) http.ResponseWriter {
+	c.header = w.Header()
+	return httpsnoop.Wrap(w, httpsnoop.Hooks{
+		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return func(code int) {
+				// informational responses precede the headers of the response
+				if code >= http.StatusOK || code == http.StatusSwitchingProtocols {
+					c.capture()
+				}
+				next(code)
+			}
+		},
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(p []byte) (int, error) {
+				c.capture()
+				return next(p)
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				c.capture()
+				return next(src)
+			}
+		},
+		Flush: func(next httpsnoop.FlushFunc) httpsnoop.FlushFunc {
+			return func() {
+				c.capture()
+				next()
+			}
+		},
+	})
+}
+
+// capture copies the headers of interest, unless already sent
+func (c *headerCapture) capture() {
+	if c.sent != nil {
+		return
+	}
+	c.sent = make(http.Header, len(c.names))
+	for _, name := range c.names {
+		if values := c.header.Values(name); len(values) > 0 {
+			c.sent[name] = values
+		}
+	}
+}
+
+// fields returns the values of the response headers of interest, joined and
+// truncated, or nil if none was sent
+func (c *headerCapture) fields(o *middleware.Options) map[string]string {
+	// headers are sent once the handler returns if not before
+	c.capture()
+	var fields map[string]string
+	for _, name := range o.ResponseHeaders {
+		name = http.CanonicalHeaderKey(name)
+		if values, ok := c.sent[name]; ok {
+			if fields == nil {
+				fields = make(map[string]string, len(o.ResponseHeaders))
+			}
+			fields[name] = middleware.Truncate(strings.Join(values, ", "),
+				maxResponseHeaderLength)
+		}
+	}
+	return fields
+}
+
+// cacheStatus records the response as a cache lookup if it was sent with the
+// cache header, and as a hit if its first value is the hit value, unless the
+// handler recorded its cache status
+func (c *headerCapture) cacheStatus(o *middleware.Options, request *requestlog.HTTPRequest) {
+	if o.CacheHeader == "" || request.CacheLookup {
+		return
+	}
+	values, ok := c.sent[http.CanonicalHeaderKey(o.CacheHeader)]
+	if !ok {
+		return
+	}
+	first := strings.TrimSpace(strings.SplitN(values[0], ",", 2)[0])
+	request.CacheLookup = true
+	request.CacheHit = strings.EqualFold(first, o.CacheHitValue)
+}
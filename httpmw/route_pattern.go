@@ -0,0 +1,39 @@
+package httpmw
+
+import (
+	"net/http"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/mux"
+)
+
+// RoutePattern extracts the route template matched for a request, such as
+// "/users/{id}", or returns an empty string when no route was matched.
+type RoutePattern = middleware.RoutePattern
+
+// ChiRoutePattern extracts the route pattern matched by a chi router.
+// The logging middleware must be installed within the router (e.g. with
+// Router.Use) for the routing context to be visible.
+func ChiRoutePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return ""
+	}
+	return rctx.RoutePattern()
+}
+
+// GorillaMuxRoutePattern extracts the path template matched by a gorilla/mux
+// router. The logging middleware must be installed within the router (e.g.
+// with Router.Use) for the current route to be visible.
+func GorillaMuxRoutePattern(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+	tmpl, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return tmpl
+}
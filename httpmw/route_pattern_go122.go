@@ -0,0 +1,21 @@
+//go:build go1.22
+// +build go1.22
+
+package httpmw
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ServeMuxRoutePattern extracts the path of the pattern matched by a Go 1.22+
+// http.ServeMux, dropping any method or host from it. Patterns are only
+// matched when the main module declares go 1.22 or later, or runs with
+// GODEBUG=httpmuxgo121=0.
+func ServeMuxRoutePattern(r *http.Request) string {
+	pattern := r.Pattern
+	if i := strings.Index(pattern, "/"); i > 0 {
+		pattern = pattern[i:]
+	}
+	return pattern
+}
@@ -0,0 +1,64 @@
+//go:build go1.22
+// +build go1.22
+
+//go:debug httpmuxgo121=0
+
+package httpmw_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/httpmw"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeMuxRoutePattern(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}/orders/{orderID}", func(w http.ResponseWriter, r *http.Request) {})
+	handler := httpmw.LoggingMiddleware(
+		logger,
+		httpmw.WithRoutePattern(httpmw.ServeMuxRoutePattern),
+	)(mux)
+
+	for _, tcase := range []struct {
+		url     string
+		message string
+		pattern interface{}
+	}{
+		{
+			url:     "/users/12345/orders/987",
+			message: "served HTTP GET /users/{id}/orders/{orderID}",
+			pattern: "/users/{id}/orders/{orderID}",
+		},
+		{
+			url:     "/unknown/12345?secret=1",
+			message: "served HTTP GET /unknown/12345",
+			pattern: nil,
+		},
+	} {
+		out.Reset()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tcase.url, nil))
+
+		var got map[string]interface{}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+		assert.Equal(t, tcase.message, got["message"])
+		data, _ := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+		assert.Equal(t, tcase.pattern, data["routePattern"])
+	}
+}
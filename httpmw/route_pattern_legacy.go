@@ -0,0 +1,12 @@
+//go:build !go1.22
+// +build !go1.22
+
+package httpmw
+
+import "net/http"
+
+// ServeMuxRoutePattern extracts the path of the pattern matched by a Go 1.22+
+// http.ServeMux. Earlier versions do not record the matched pattern.
+func ServeMuxRoutePattern(r *http.Request) string {
+	return ""
+}
@@ -0,0 +1,136 @@
+package httpmw
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/felixge/httpsnoop"
+)
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// encodingCounter finds the uncompressed size of a gzip encoded response. If
+// the response is compressed inside the logging middleware, it decodes what
+// was written to count it. Otherwise, what was written is uncompressed.
+type encodingCounter struct {
+	header  http.Header
+	started bool
+	// encoded is whether the response was written compressed
+	encoded bool
+	gzipped bool
+
+	pw   *io.PipeWriter
+	done chan int64
+}
+
+// wrap counts what is written to w
+func (c *encodingCounter) wrap(w http.ResponseWriter) http.ResponseWriter {
+	c.header = w.Header()
+	return httpsnoop.Wrap(w, httpsnoop.Hooks{
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(p []byte) (int, error) {
+				n, err := next(p)
+				c.observe(p[:n])
+				return n, err
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				if c.started && !c.encoded {
+					return next(src)
+				}
+				// copy through Write to decode what is written
+				return io.Copy(writerFunc(func(p []byte) (int, error) {
+					n, err := w.Write(p)
+					c.observe(p[:n])
+					return n, err
+				}), src)
+			}
+		},
+	})
+}
+
+// observe records bytes written, once they are written, so that a compressor
+// outside of the middleware has set the Content-Encoding
+func (c *encodingCounter) observe(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	if !c.started {
+		c.started = true
+		c.gzipped = isGzip(c.header.Get("Content-Encoding"))
+		c.encoded = c.gzipped && len(p) >= 2 && p[0] == 0x1f && p[1] == 0x8b
+		if c.encoded {
+			c.decode()
+		}
+	}
+	if c.pw != nil {
+		_, _ = c.pw.Write(p)
+	}
+}
+
+// decode counts the decompressed size of what is written in the background
+func (c *encodingCounter) decode() {
+	pr, pw := io.Pipe()
+	c.pw, c.done = pw, make(chan int64, 1)
+	go func() {
+		n := int64(-1)
+		if zr, err := gzip.NewReader(pr); err == nil {
+			if decoded, err := io.Copy(ioutil.Discard, zr); err == nil {
+				n = decoded
+			}
+		}
+		// never block the response on a stream that failed to decode
+		_, _ = io.Copy(ioutil.Discard, pr)
+		c.done <- n
+	}()
+}
+
+// close stops decoding, if the response was not completed
+func (c *encodingCounter) close() {
+	if c.pw != nil {
+		_ = c.pw.Close()
+	}
+}
+
+// uncompressed returns the uncompressed size of a gzip encoded response, of
+// which written bytes were written through the middleware, and whether the
+// written bytes were compressed. It returns false for other responses.
+func (c *encodingCounter) uncompressed(written int64) (size int64, wire bool, ok bool) {
+	if !c.gzipped {
+		return 0, false, false
+	}
+	if !c.encoded {
+		return written, false, true
+	}
+	c.close()
+	if n := <-c.done; n >= 0 {
+		return n, true, true
+	}
+	return 0, true, false
+}
+
+// isGzip reports whether a Content-Encoding is gzip
+func isGzip(encoding string) bool {
+	encoding = strings.TrimSpace(strings.ToLower(encoding))
+	return encoding == "gzip" || encoding == "x-gzip"
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
@@ -0,0 +1,129 @@
+package httpmw_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/httpmw"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gzipWriter compresses what is written to a response
+type gzipWriter struct {
+	http.ResponseWriter
+	zw *gzip.Writer
+}
+
+func (g gzipWriter) Write(p []byte) (int, error) {
+	return g.zw.Write(p)
+}
+
+// gzipMiddleware compresses every response with gzip
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		defer zw.Close()
+		next.ServeHTTP(gzipWriter{ResponseWriter: w, zw: zw}, r)
+	})
+}
+
+func TestContentEncodingAwareness(t *testing.T) {
+	payload := strings.Repeat(`{"sku":"abc-123","quantity":1}`, 1000)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(w, strings.NewReader(payload))
+	})
+
+	for _, tcase := range []struct {
+		name         string
+		wrap         func(logging func(http.Handler) http.Handler) http.Handler
+		wire         bool
+		uncompressed interface{}
+	}{
+		{
+			name: "compressed inside",
+			wrap: func(logging func(http.Handler) http.Handler) http.Handler {
+				return logging(gzipMiddleware(handler))
+			},
+			wire:         true,
+			uncompressed: float64(len(payload)),
+		},
+		{
+			name: "compressed outside",
+			wrap: func(logging func(http.Handler) http.Handler) http.Handler {
+				return gzipMiddleware(logging(handler))
+			},
+			uncompressed: float64(len(payload)),
+		},
+		{
+			name: "uncompressed",
+			wrap: func(logging func(http.Handler) http.Handler) http.Handler {
+				return logging(handler)
+			},
+			wire: true,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithSkipTimestamp(),
+			)
+
+			rec := httptest.NewRecorder()
+			tcase.wrap(httpmw.LoggingMiddleware(logger, httpmw.WithContentEncodingAwareness())).
+				ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+			request := got["httpRequest"].(map[string]interface{})
+			if tcase.wire {
+				assert.Equal(t, strconv.Itoa(rec.Body.Len()), request["responseSize"],
+					"the responseSize is what was sent")
+			} else {
+				assert.NotContains(t, request, "responseSize", "the size sent is unknown")
+			}
+			data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+			assert.Equal(t, tcase.uncompressed, data["responseSizeUncompressed"])
+		})
+	}
+}
+
+func TestChunkedRequestSize(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	handler := httpmw.LoggingMiddleware(logger)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(ioutil.Discard, r.Body)
+		}),
+	)
+	// a reader of unknown length is sent chunked
+	body := io.MultiReader(strings.NewReader("chunk one,"), strings.NewReader("chunk two"))
+	r := httptest.NewRequest(http.MethodPost, "/uploads", body)
+	require.Equal(t, int64(-1), r.ContentLength)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	request := got["httpRequest"].(map[string]interface{})
+	assert.Equal(t, "19", request["requestSize"])
+}
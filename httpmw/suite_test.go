@@ -0,0 +1,120 @@
+package httpmw_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/httpmw"
+	grpc_testing "github.com/grpc-ecosystem/go-grpc-middleware/testing"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type httpTestSuite struct {
+	suite.Suite
+
+	server *httptest.Server
+	mux    *http.ServeMux
+	Client *http.Client
+
+	mutexBuffer *grpc_testing.MutexReadWriter
+	buffer      *bytes.Buffer
+	logger      *logrus.Logger
+
+	// responded is closed once the client has read the response, and
+	// background once work spawned from the request has finished
+	responded  chan struct{}
+	background chan struct{}
+}
+
+func newHTTPTestSuite(t *testing.T) *httpTestSuite {
+	b := &bytes.Buffer{}
+	muB := grpc_testing.NewMutexReadWriter(b)
+	logger := logrus.New()
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithService("logging-test"),
+		logadapter.WithVersion("v1.0.0"),
+		logadapter.WithStackTraceStyle(logadapter.TraceInPayload),
+		logadapter.WithSourceReference(
+			"github.com/StevenACoffman/logrus-stackdriver-formatter",
+			"v1.0.0",
+		),
+		logadapter.WithPrettyPrint(),
+	)
+	var out io.Writer
+	out = muB
+	if testing.Verbose() {
+		out = io.MultiWriter(os.Stdout, muB)
+	}
+	logger.Out = out
+	logger.AddHook(&logadapter.SpanHook{})
+
+	return &httpTestSuite{
+		logger:      logger,
+		buffer:      b,
+		mutexBuffer: muB,
+		Suite:       suite.Suite{},
+	}
+}
+
+func (s *httpTestSuite) SetupSuite() {
+	s.mux = http.NewServeMux()
+
+	apiHandler := http.NewServeMux()
+	apiHandler.Handle("/", s.mux)
+
+	recoveryHandler := httpmw.RecoveryMiddleware(apiHandler)
+	loggingHandler := httpmw.LoggingMiddleware(s.logger, httpmw.WithTLSDetails())(recoveryHandler)
+
+	s.server = httptest.NewUnstartedServer(loggingHandler)
+	s.server.EnableHTTP2 = true
+	s.server.StartTLS()
+	s.Client = s.server.Client()
+
+	s.mux.HandleFunc("/panic", s.ServePanic)
+	s.mux.HandleFunc("/logging", s.ServeLogging)
+	s.mux.HandleFunc("/background", s.ServeBackground)
+
+	s.responded = make(chan struct{})
+	s.background = make(chan struct{})
+}
+
+func (s *httpTestSuite) TearDownSuite() {
+	s.server.Close()
+}
+
+func (s *httpTestSuite) ServePanic(w http.ResponseWriter, r *http.Request) {
+	panic("surprise panic attack!")
+}
+
+func (s *httpTestSuite) ServeLogging(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctxlogrus.AddFields(ctx, logrus.Fields{"testField": "testValue"})
+
+	ctxlogrus.Extract(ctx).Info("served from http request")
+}
+
+var backgroundTraceID, _ = trace.TraceIDFromHex("105445aa7843bc8bf206b12000100000")
+
+func (s *httpTestSuite) ServeBackground(w http.ResponseWriter, r *http.Request) {
+	ctx := trace.ContextWithSpanContext(r.Context(), trace.SpanContext{}.
+		WithTraceID(backgroundTraceID).
+		WithSpanID(trace.SpanID{0, 0, 0, 0, 0, 0, 0, 1}))
+	ctxlogrus.AddFields(ctx, logrus.Fields{"testField": "testValue"})
+
+	logadapter.Go(ctx, func(ctx context.Context) {
+		defer close(s.background)
+		<-s.responded
+
+		ctxlogrus.Extract(ctx).WithField("contextErr", ctx.Err()).Info("background work done")
+	})
+}
@@ -0,0 +1,221 @@
+package httpmw
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/requestlog"
+	"github.com/sirupsen/logrus"
+)
+
+// codeDeadlineExceeded is the google.rpc.Code for expired deadlines
+const codeDeadlineExceeded = 4
+
+// TimeoutMiddleware serves each request with a context expiring after d.
+// When the handler has not written a response by then, it responds 504 with
+// a JSON google.rpc.Status with code DEADLINE_EXCEEDED, or as configured
+// WithTimeoutResponse, and logs "request timed out" at ERROR, with the
+// request, the time elapsed and the stack of the handler still running.
+//
+// Unlike http.TimeoutHandler, the response is written as the handler writes
+// it, so a handler that started writing its response before d is waited for.
+// Once timed out, the writes of the handler are discarded, failing with
+// http.ErrHandlerTimeout, so that it may keep running without corrupting the
+// response. A panic in the handler is panicked again for RecoveryMiddleware.
+// An http.ResponseController of the handler sets the deadlines of the
+// connection, but hijacking it fails with http.ErrNotSupported.
+//
+// The stack of the handler is found in a dump of all goroutines, which is
+// bounded to 1 MiB, so it may be missing on servers with many goroutines.
+func TimeoutMiddleware(d time.Duration, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	o := middleware.Evaluate(defaultOptions, opts)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{w: w, h: w.Header().Clone()}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if e := recover(); e != nil {
+						panicked <- e
+					}
+				}()
+				tw.setGoroutine(middleware.GoroutineID())
+				next.ServeHTTP(tw, r)
+				tw.finish()
+				close(done)
+			}()
+
+			select {
+			case <-done:
+				return
+			case e := <-panicked:
+				panic(e)
+			case <-ctx.Done():
+			}
+
+			tw.mu.Lock()
+			if tw.wroteHeader {
+				// the response is under way, and can't be replaced
+				tw.mu.Unlock()
+				select {
+				case <-done:
+				case e := <-panicked:
+					panic(e)
+				}
+				return
+			}
+			tw.timedOut = true
+			tw.mu.Unlock()
+
+			elapsed := time.Since(start)
+			err := fmt.Errorf("handler timed out after %s: %w", d, ctx.Err())
+			request := panicRequest(r, o.RemoteIP)
+			request.Status = strconv.Itoa(http.StatusGatewayTimeout)
+			request.Latency = fmt.Sprintf("%.5fs", elapsed.Seconds())
+			middleware.LogTimeout(r.Context(), err, middleware.GoroutineStack(tw.goroutine()),
+				logrus.Fields{
+					requestlog.KeyHTTPRequest: request,
+					"elapsed":                 elapsed,
+				})
+
+			if o.TimeoutResponse != nil {
+				o.TimeoutResponse.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusGatewayTimeout)
+			// writing fails when the connection is gone, which isn't worth logging
+			_ = json.NewEncoder(w).Encode(newTimeoutError())
+		})
+	}
+}
+
+// timeoutWriter guards the ResponseWriter of a request from its handler
+// once it timed out. The handler has its own headers, written along with its
+// status.
+type timeoutWriter struct {
+	w http.ResponseWriter
+	h http.Header
+
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+	id          []byte
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeader(code)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+	}
+	return tw.w.Write(b)
+}
+
+// Flush flushes the response written so far, unless timed out
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+	}
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish writes the headers of a handler returning without writing its
+// response, or the trailers it set after writing it, unless timed out
+func (tw *timeoutWriter) finish() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+		return
+	}
+	dst := tw.w.Header()
+	for k, v := range tw.h {
+		dst[k] = v
+	}
+}
+
+// Hijack fails, as the response of a hijacked connection can't be guarded
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, fmt.Errorf("hijacking within TimeoutMiddleware: %w", http.ErrNotSupported)
+}
+
+// Unwrap returns the ResponseWriter of the request, for http.ResponseController
+// to set the deadlines of its connection. The response is only written
+// through the timeoutWriter, which can't be hijacked.
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
+
+// writeHeader writes the headers of the handler with its status. It must be
+// called with the lock held.
+func (tw *timeoutWriter) writeHeader(code int) {
+	dst := tw.w.Header()
+	for k, v := range tw.h {
+		dst[k] = v
+	}
+	tw.wroteHeader = true
+	tw.w.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) setGoroutine(id []byte) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.id = id
+}
+
+func (tw *timeoutWriter) goroutine() []byte {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.id
+}
+
+// newTimeoutError is the JSON encoding of a google.rpc.Status with code
+// DEADLINE_EXCEEDED, as a gRPC service would respond with
+func newTimeoutError() serverError {
+	e := newServerError()
+	e.Code = codeDeadlineExceeded
+	e.Message = "deadline exceeded"
+	return e
+}
@@ -0,0 +1,149 @@
+package httpmw_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/httpmw"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+)
+
+// sleepingHandler ignores the context of its request, and writes its
+// response once woken up
+type sleepingHandler struct {
+	writeFirst bool
+	wake       chan struct{}
+	done       chan error
+}
+
+func newSleepingHandler(writeFirst bool) *sleepingHandler {
+	return &sleepingHandler{
+		writeFirst: writeFirst,
+		wake:       make(chan struct{}),
+		done:       make(chan error, 1),
+	}
+}
+
+func (h *sleepingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.writeFirst {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	<-h.wake
+	w.Header().Set("X-Late", "true")
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write([]byte("late"))
+	h.done <- err
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	logger, rec := logtest.NewRecorder()
+	h := newSleepingHandler(false)
+	handler := httpmw.LoggingMiddleware(logger)(
+		httpmw.TimeoutMiddleware(20 * time.Millisecond)(h))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders/42", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var status struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, 4, status.Code, "DEADLINE_EXCEEDED")
+
+	errors := rec.FilterBySeverity("ERROR")
+	require.NotEmpty(t, errors)
+	entry := errors[0]
+	assert.True(t, strings.HasPrefix(entry.Message, "request timed out"))
+	logtest.AssertField(t, entry, "context.httpRequest.url", "/orders/42")
+	_, ok := logtest.Field(entry, "context.data.elapsed")
+	assert.True(t, ok, "the time elapsed is logged")
+	assert.Contains(t, entry.StackTrace+entry.Message, "sleepingHandler",
+		"the stack of the handler still running is logged")
+
+	summary, ok := rec.LastEntry()
+	require.True(t, ok)
+	logtest.AssertField(t, summary, "httpRequest.status", "504")
+
+	// the handler keeps running, and its writes are discarded
+	close(h.wake)
+	select {
+	case err := <-h.done:
+		assert.Equal(t, http.ErrHandlerTimeout, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler not done")
+	}
+	assert.Empty(t, w.Header().Get("X-Late"))
+	assert.False(t, strings.Contains(w.Body.String(), "late"))
+}
+
+func TestTimeoutMiddlewareResponseStarted(t *testing.T) {
+	logger, rec := logtest.NewRecorder()
+	h := newSleepingHandler(true)
+	handler := httpmw.LoggingMiddleware(logger)(
+		httpmw.TimeoutMiddleware(20 * time.Millisecond)(h))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(h.wake)
+	}()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders/42", nil))
+	assert.Equal(t, http.StatusAccepted, w.Code, "a response under way is waited for")
+	assert.Equal(t, "late", w.Body.String())
+	assert.NoError(t, <-h.done)
+	assert.Empty(t, rec.FilterBySeverity("ERROR"))
+}
+
+func TestTimeoutMiddlewareFast(t *testing.T) {
+	handler := httpmw.TimeoutMiddleware(time.Second)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, ok := r.Context().Deadline()
+			assert.True(t, ok, "the context of the request has a deadline")
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("ok"))
+		}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+	assert.Equal(t, "ok", w.Body.String())
+}
+
+func TestTimeoutMiddlewareResponse(t *testing.T) {
+	logger, _ := logtest.NewRecorder()
+	h := newSleepingHandler(false)
+	defer close(h.wake)
+	handler := httpmw.LoggingMiddleware(logger)(httpmw.TimeoutMiddleware(
+		20*time.Millisecond,
+		httpmw.WithTimeoutResponse(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "too slow", http.StatusServiceUnavailable)
+			})),
+	)(h))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "too slow\n", w.Body.String())
+}
+
+func TestTimeoutMiddlewarePanic(t *testing.T) {
+	handler := httpmw.TimeoutMiddleware(time.Second)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("out of stock")
+		}))
+
+	assert.PanicsWithValue(t, "out of stock", func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}, "the panic of the handler is panicked again")
+}
@@ -0,0 +1,37 @@
+package httpmw
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// tlsVersions names the versions of TLS
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS1.0",
+	tls.VersionTLS11: "TLS1.1",
+	tls.VersionTLS12: "TLS1.2",
+	tls.VersionTLS13: "TLS1.3",
+}
+
+// tlsFields describes the TLS connection a request was received on: the
+// version and cipher suite negotiated, the server name requested with SNI,
+// the protocol negotiated with ALPN, such as "h2", and whether the client
+// presented a certificate. Plaintext requests have none.
+func tlsFields(state *tls.ConnectionState) logrus.Fields {
+	if state == nil {
+		return nil
+	}
+	version, ok := tlsVersions[state.Version]
+	if !ok {
+		version = fmt.Sprintf("0x%04x", state.Version)
+	}
+	return logrus.Fields{
+		"tlsVersion":        version,
+		"tlsCipherSuite":    tls.CipherSuiteName(state.CipherSuite),
+		"tlsServerName":     state.ServerName,
+		"alpnProtocol":      state.NegotiatedProtocol,
+		"clientCertPresent": len(state.PeerCertificates) > 0,
+	}
+}
@@ -1,8 +1,11 @@
 package logadapter
 
 import (
+	"context"
 	"io"
 
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
 	"github.com/sirupsen/logrus"
 )
 
@@ -18,8 +21,26 @@ func InitLogging(w io.Writer, opts ...Option) *logrus.Logger {
 	return log
 }
 
-// InitLogrusGoKitLogger initializes a go kit logger to send things to stackdriver.
-func InitLogrusGoKitLogger(w io.Writer, opts ...Option) *LogrusGoKitLogger {
-	logger := InitLogging(w, opts...)
-	return NewLogrusGoKitLogger(logger)
+// WithLogger initializes the log entry in context
+func WithLogger(ctx context.Context, logger *logrus.Logger) context.Context {
+	return middleware.WithLogger(ctx, logger)
+}
+
+// ScopedFields returns a child context whose request-scoped log entry has the
+// fields, and any fields added to it with ctxlogrus.AddFields, on top of those
+// of ctx. They are discarded when release is called, or along with the child
+// context, so that fields added while processing each message of a long
+// stream don't accumulate on the entry of the stream:
+//
+//	for {
+//		msg, err := stream.Recv()
+//		// ...
+//		msgCtx, release := logadapter.ScopedFields(ctx, logrus.Fields{"orderID": msg.Id})
+//		process(msgCtx, msg)
+//		release()
+//	}
+func ScopedFields(ctx context.Context, fields logrus.Fields) (context.Context, func()) {
+	scoped, release := ctxlogrus.WithScope(ctx)
+	ctxlogrus.AddFields(scoped, fields)
+	return scoped, release
 }
@@ -0,0 +1,38 @@
+package logadapter_test
+
+import (
+	"context"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopedFields(t *testing.T) {
+	ctx := logadapter.WithLogger(context.Background(), logrus.New())
+	ctxlogrus.AddFields(ctx, logrus.Fields{"streamID": "s-1", "attempt": 1})
+
+	scoped, release := logadapter.ScopedFields(ctx, logrus.Fields{"orderID": "ord-42"})
+	ctxlogrus.AddFields(scoped, logrus.Fields{"attempt": 2})
+	assert.Equal(t, logrus.Fields{"streamID": "s-1", "orderID": "ord-42", "attempt": 2},
+		ctxlogrus.Extract(scoped).Data, "scoped fields are layered on the fields of ctx")
+	assert.Equal(t, logrus.Fields{"streamID": "s-1", "attempt": 1},
+		ctxlogrus.Extract(ctx).Data, "ctx is unchanged")
+
+	ctxlogrus.AddFields(ctx, logrus.Fields{"region": "eu"})
+	assert.Equal(t, "eu", ctxlogrus.Extract(scoped).Data["region"],
+		"fields added to ctx are seen in scope")
+
+	release()
+	assert.Equal(t, logrus.Fields{"streamID": "s-1", "attempt": 1, "region": "eu"},
+		ctxlogrus.Extract(scoped).Data, "released fields are discarded")
+
+	for i := 0; i < 1000; i++ {
+		msgCtx, release := logadapter.ScopedFields(ctx, logrus.Fields{"message": i})
+		ctxlogrus.AddFields(msgCtx, logrus.Fields{"step": "done"})
+		release()
+	}
+	assert.Len(t, ctxlogrus.Extract(ctx).Data, 3, "fields don't accumulate")
+}
@@ -0,0 +1,45 @@
+// Package flushers holds the registry of the flushers of logadapter.FlushAll,
+// for the packages it imports, such as httpmw, to register theirs.
+package flushers
+
+import (
+	"context"
+	"sync"
+)
+
+// Flusher writes the entries it buffers.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+var registry = struct {
+	sync.Mutex
+	next int
+	m    map[int]Flusher
+}{m: map[int]Flusher{}}
+
+// Register adds f to the registered flushers, until unregistered.
+func Register(f Flusher) (unregister func()) {
+	registry.Lock()
+	defer registry.Unlock()
+	id := registry.next
+	registry.next++
+	registry.m[id] = f
+
+	return func() {
+		registry.Lock()
+		defer registry.Unlock()
+		delete(registry.m, id)
+	}
+}
+
+// Registered returns the flushers registered.
+func Registered() []Flusher {
+	registry.Lock()
+	defer registry.Unlock()
+	fs := make([]Flusher, 0, len(registry.m))
+	for _, f := range registry.m {
+		fs = append(fs, f)
+	}
+	return fs
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/sirupsen/logrus"
+)
+
+// WithLogger initializes the log entry in context
+func WithLogger(ctx context.Context, logger *logrus.Logger) context.Context {
+	// we pack the initial context into the log entry so that hooks
+	// needing a request-scoped context may have it.
+
+	entry := logrus.NewEntry(logger).WithContext(ctx)
+	return ctxlogrus.ToContext(ctx, entry)
+}
+
+// ContextFields describes why the context of a request has ended, so that a
+// client hanging up can be told apart from our own or an upstream timeout
+func ContextFields(ctx context.Context) logrus.Fields {
+	fields := logrus.Fields{}
+
+	if d, ok := ctx.Deadline(); ok {
+		fields["deadlineRemaining"] = fmt.Sprintf("%.5fs", time.Until(d).Seconds())
+	}
+
+	ctxErr := ctx.Err()
+	if ctxErr == nil {
+		return fields
+	}
+	fields["contextError"] = ctxErr.Error()
+
+	// without an explicit cause, the cause is the context error itself
+	if cause := contextCause(ctx); cause != nil && cause != ctxErr {
+		fields["cancelCause"] = cause.Error()
+	}
+
+	return fields
+}
+
+// StatusClass groups an HTTP status code by its first digit
+func StatusClass(code int) string {
+	switch {
+	case code >= 100 && code < 600:
+		return string(rune('0'+code/100)) + "xx"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !go1.20
+// +build !go1.20
+
+package middleware
+
+import "context"
+
+// context.Cause is unavailable before go1.20
+func contextCause(ctx context.Context) error {
+	return ctx.Err()
+}
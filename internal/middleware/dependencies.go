@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DependencyCallLimit is the number of calls to dependencies listed in the
+// summary of a request
+const DependencyCallLimit = 50
+
+// Fields of the request summary listing the calls to dependencies made for
+// the request
+const (
+	KeyDependencies        = "dependencies"
+	KeyDependenciesDropped = "dependenciesDropped"
+)
+
+type dependenciesKey struct{}
+
+// dependencies accumulates the calls to dependencies made while handling a
+// request, in the order they started
+type dependencies struct {
+	start time.Time
+
+	mu      sync.Mutex
+	calls   []*DepCall
+	dropped int
+}
+
+// DepCall is a call to a dependency of a request, started with
+// StartDependencyCall. Its methods do nothing on a nil DepCall.
+type DepCall struct {
+	deps    *dependencies
+	name    string
+	start   time.Time
+	ended   bool
+	elapsed time.Duration
+	err     error
+	detail  logrus.Fields
+}
+
+// WithDependencies installs an accumulator of the calls to dependencies
+// started with StartDependencyCall
+func WithDependencies(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dependenciesKey{}, &dependencies{start: time.Now()})
+}
+
+// StartDependencyCall records the start of a call to the dependency name. It
+// returns nil outside of the middleware, and once DependencyCallLimit calls
+// were recorded for the request, which are then only counted.
+func StartDependencyCall(ctx context.Context, name string) *DepCall {
+	deps, ok := ctx.Value(dependenciesKey{}).(*dependencies)
+	if !ok {
+		return nil
+	}
+	deps.mu.Lock()
+	defer deps.mu.Unlock()
+	if len(deps.calls) >= DependencyCallLimit {
+		deps.dropped++
+		return nil
+	}
+	c := &DepCall{deps: deps, name: name, start: time.Now()}
+	deps.calls = append(deps.calls, c)
+	return c
+}
+
+// SetDetail adds a detail of the call, such as the status of its response
+func (c *DepCall) SetDetail(k string, v interface{}) {
+	if c == nil {
+		return
+	}
+	// otherwise nested errors are encoded as empty objects
+	if err, ok := v.(error); ok {
+		v = err.Error()
+	}
+	c.deps.mu.Lock()
+	defer c.deps.mu.Unlock()
+	if c.detail == nil {
+		c.detail = logrus.Fields{}
+	}
+	c.detail[k] = v
+}
+
+// End records the end of the call, and its error, if any. Only the first
+// call to End is recorded.
+func (c *DepCall) End(err error) {
+	if c == nil {
+		return
+	}
+	c.deps.mu.Lock()
+	defer c.deps.mu.Unlock()
+	if c.ended {
+		return
+	}
+	c.ended = true
+	c.elapsed = time.Since(c.start)
+	c.err = err
+}
+
+// DependencyFields returns the fields listing the calls to dependencies of the
+// request, or nil if there are none
+func DependencyFields(ctx context.Context) logrus.Fields {
+	deps, ok := ctx.Value(dependenciesKey{}).(*dependencies)
+	if !ok {
+		return nil
+	}
+
+	deps.mu.Lock()
+	defer deps.mu.Unlock()
+	if len(deps.calls) == 0 && deps.dropped == 0 {
+		return nil
+	}
+	calls := make([]interface{}, 0, len(deps.calls))
+	for _, c := range deps.calls {
+		call := map[string]interface{}{
+			"name":        c.name,
+			"startedAtMs": c.start.Sub(deps.start).Milliseconds(),
+		}
+		if c.ended {
+			call["duration"] = c.elapsed
+		} else {
+			call["unfinished"] = true
+		}
+		if c.err != nil {
+			call["error"] = c.err.Error()
+		}
+		if len(c.detail) > 0 {
+			detail := make(logrus.Fields, len(c.detail))
+			for k, v := range c.detail {
+				detail[k] = v
+			}
+			call["detail"] = detail
+		}
+		calls = append(calls, call)
+	}
+	fields := logrus.Fields{KeyDependencies: calls}
+	if deps.dropped > 0 {
+		fields[KeyDependenciesDropped] = deps.dropped
+	}
+	return fields
+}
+
+// DependencyMessage appends the names of the dependencies whose calls failed
+// to the message of the summary of a request
+func DependencyMessage(ctx context.Context, msg string) string {
+	deps, ok := ctx.Value(dependenciesKey{}).(*dependencies)
+	if !ok {
+		return msg
+	}
+
+	deps.mu.Lock()
+	defer deps.mu.Unlock()
+	var failed []string
+	seen := map[string]bool{}
+	for _, c := range deps.calls {
+		if c.err != nil && !seen[c.name] {
+			seen[c.name] = true
+			failed = append(failed, c.name)
+		}
+	}
+	if len(failed) == 0 {
+		return msg
+	}
+	return msg + " (failed dependencies: " + strings.Join(failed, ", ") + ")"
+}
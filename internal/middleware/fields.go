@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxFieldValueLength limits values copied from request metadata or headers
+const maxFieldValueLength = 256
+
+// RequestFields maps the keys of request metadata or headers to log fields,
+// reading values with get. Multiple values of a key are joined with ",", and
+// keys without a value produce no field.
+func RequestFields(mapping map[string]string, get func(key string) []string) logrus.Fields {
+	fields := logrus.Fields{}
+	for key, field := range mapping {
+		values := get(key)
+		if v := strings.Join(values, ","); v != "" {
+			fields[field] = Truncate(v, maxFieldValueLength)
+		}
+	}
+	return fields
+}
+
+// TruncatedMarker is appended to values cut short of a size limit
+const TruncatedMarker = "...[truncated]"
+
+// Truncate limits s to n bytes without splitting a character
+func Truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
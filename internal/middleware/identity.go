@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/requestlog"
+	"github.com/sirupsen/logrus"
+)
+
+// KeyClaims is the field of the claims of the identity of a request, set with
+// SetRequestIdentity
+const KeyClaims = "claims"
+
+type identityKey struct{}
+
+// identity accumulates the identity of the client of a request, once
+// authenticated
+type identity struct {
+	mu     sync.Mutex
+	user   string
+	claims map[string]string
+}
+
+// WithIdentity installs an accumulator of the identity set with
+// SetRequestIdentity, adding it to the entries of the request-scoped log
+// entry once set. It takes precedence over the user of a UserExtractor added
+// before it.
+func WithIdentity(ctx context.Context) context.Context {
+	id := &identity{}
+	ctxlogrus.AddFieldsFunc(ctx, func(context.Context) logrus.Fields {
+		id.mu.Lock()
+		defer id.mu.Unlock()
+		if id.user == "" && id.claims == nil {
+			return nil
+		}
+		fields := make(logrus.Fields, 2)
+		if id.user != "" {
+			fields[requestlog.KeyUser] = id.user
+		}
+		if id.claims != nil {
+			// copied for entry mutators to redact them
+			claims := make(map[string]interface{}, len(id.claims))
+			for k, v := range id.claims {
+				claims[k] = v
+			}
+			fields[KeyClaims] = claims
+		}
+		return fields
+	})
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// SetRequestIdentity records the identity of the client of the request of
+// ctx, and the claims it was authenticated with, if any. It does nothing
+// outside of the middleware.
+func SetRequestIdentity(ctx context.Context, user string, claims map[string]string) {
+	id, ok := ctx.Value(identityKey{}).(*identity)
+	if !ok {
+		return
+	}
+	var c map[string]string
+	if len(claims) > 0 {
+		c = make(map[string]string, len(claims))
+		for k, v := range claims {
+			c[k] = v
+		}
+	}
+	id.mu.Lock()
+	defer id.mu.Unlock()
+	id.user, id.claims = user, c
+}
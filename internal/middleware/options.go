@@ -0,0 +1,469 @@
+// Package middleware holds the options and helpers shared by the HTTP and gRPC
+// logging middleware.
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Option configures the logging middleware
+type Option func(*Options)
+
+// Options of the logging middleware
+type Options struct {
+	FilterRPC           FilterRPC
+	FilterHTTP          FilterHTTP
+	ErrorHandler        ErrorHandler
+	HealthCheckInterval time.Duration
+	RoutePattern        RoutePattern
+	RemoteIP            RemoteIPStrategy
+	Metrics             RequestMetricsRecorder
+	LatencyWarn         time.Duration
+	LatencyError        time.Duration
+	// DecodedStatusDetails omits the raw details of a gRPC status from logs,
+	// leaving only their decoded form
+	DecodedStatusDetails bool
+	// StructuredGRPCStatus logs the status of a failed RPC as fields, rather
+	// than as its raw JSON
+	StructuredGRPCStatus bool
+	ErrorHandlerV2       ErrorHandlerV2
+	HTTPErrorHandler     HTTPErrorHandler
+	BodyCaptureMax       int
+	BodyCaptureTypes     []string
+	// MetadataFields and HeaderFields map the keys of gRPC metadata and HTTP
+	// headers to fields of the request-scoped log entry
+	MetadataFields map[string]string
+	HeaderFields   map[string]string
+	// SummaryMessage and RPCSummaryMessage replace the message of the entry
+	// logged for each request, which NoSummaryLog suppresses
+	SummaryMessage    SummaryMessage
+	RPCSummaryMessage RPCSummaryMessage
+	NoSummaryLog      bool
+	// ContentEncodingAware logs the uncompressed size of gzip responses
+	ContentEncodingAware bool
+	// PeerIdentity logs the authentication of the peer of an RPC
+	PeerIdentity bool
+	// GRPCWeb logs gRPC-Web and Connect requests served over HTTP as RPCs
+	GRPCWeb bool
+	// UserExtractor identifies the user of each request
+	UserExtractor UserExtractor
+	// PerMessageScope discards the fields added to the context of a stream
+	// as each message is received
+	PerMessageScope bool
+	// TLSDetails logs the TLS connection of HTTP requests
+	TLSDetails bool
+	// RequestErrorLimit caps the errors recorded with AddRequestError that
+	// are listed in the summary of a request
+	RequestErrorLimit int
+	// ErrorSummaryStatus is the least HTTP status of the requests whose
+	// summary is logged as their error event, or 0 to disable
+	ErrorSummaryStatus int
+	// SLOClassifier and RPCSLOClassifier annotate the summary of each
+	// request with the SLO it counts towards
+	SLOClassifier    SLOClassifier
+	RPCSLOClassifier RPCSLOClassifier
+	// RequestStartLog logs the start of requests still running after
+	// RequestStartThreshold, or of every request if it is zero
+	RequestStartLog       bool
+	RequestStartThreshold time.Duration
+	// ReportAbortPanics logs panics with http.ErrAbortHandler as errors,
+	// rather than as aborted requests
+	ReportAbortPanics bool
+	// TimeoutResponse writes the response of HTTP requests whose handler
+	// exceeded the timeout of the TimeoutMiddleware
+	TimeoutResponse http.Handler
+	// ResponseHeaders are the HTTP response headers logged in the summary
+	ResponseHeaders []string
+	// CacheHeader is the HTTP response header telling whether the response
+	// was served from a cache, which it was when its value is CacheHitValue
+	CacheHeader   string
+	CacheHitValue string
+	// AggregationWindow logs statistics of the requests served in each
+	// window rather than their summaries, or 0 to disable
+	AggregationWindow time.Duration
+}
+
+// Evaluate applies opts to a copy of defaults
+func Evaluate(defaults *Options, opts []Option) *Options {
+	optCopy := &Options{}
+	*optCopy = *defaults
+	for _, o := range opts {
+		o(optCopy)
+	}
+	return optCopy
+}
+
+// Logging filters
+type (
+	FilterRPC  func(ctx context.Context, fullMethod string, err error) bool
+	FilterHTTP func(r *http.Request) bool
+
+	// ErrorHandler should return true if the error provided has already been logged
+	ErrorHandler func(ctx context.Context, err error, method string) (handled bool)
+)
+
+// Summary messages. RPCSummaryMessage takes the gRPC status code as a plain
+// integer, for the root package, which imports this one, not to depend on gRPC.
+type (
+	SummaryMessage    func(r *http.Request, status int, d time.Duration) string
+	RPCSummaryMessage func(method string, code uint32, d time.Duration) string
+)
+
+// RoutePattern extracts the route template matched for an HTTP request, such
+// as "/users/{id}", or returns "" when no route matched.
+type RoutePattern func(r *http.Request) string
+
+// RemoteIPStrategy determines the client IP of an HTTP request. It may return
+// an address with or without a port; invalid results are replaced by the peer
+// address of the request.
+type RemoteIPStrategy func(r *http.Request) string
+
+// RequestMetricsRecorder receives counts of the requests logged by the
+// logging middleware, by status class (e.g. "2xx").
+type RequestMetricsRecorder interface {
+	IncRequests(statusClass string)
+}
+
+// NoopMetrics discards request counts
+type NoopMetrics struct{}
+
+// IncRequests does nothing
+func (NoopMetrics) IncRequests(string) {}
+
+// WithRPCFilter provides a filter to the logging middleware that determines
+// whether or not to log individual messages
+func WithRPCFilter(f FilterRPC) Option {
+	return func(o *Options) {
+		o.FilterRPC = f
+	}
+}
+
+// WithHTTPFilter provides a filter to the logging middleware that determines
+// whether or not to log individual messages
+func WithHTTPFilter(f FilterHTTP) Option {
+	return func(o *Options) {
+		o.FilterHTTP = f
+	}
+}
+
+// WithErrorHandler provides an opportunity to log or transform RPC errors
+func WithErrorHandler(h ErrorHandler) Option {
+	return func(o *Options) {
+		o.ErrorHandler = h
+	}
+}
+
+// WithErrorHandlerV2 provides a report of RPC errors, to forward them to other
+// sinks
+func WithErrorHandlerV2(h ErrorHandlerV2) Option {
+	return func(o *Options) {
+		o.ErrorHandlerV2 = h
+	}
+}
+
+// WithHTTPErrorHandler provides a report of 5xx responses and recovered
+// panics, to forward them to other sinks
+func WithHTTPErrorHandler(h HTTPErrorHandler) Option {
+	return func(o *Options) {
+		o.HTTPErrorHandler = h
+	}
+}
+
+// WithBodyCaptureOnError logs up to maxBytes of the body of HTTP requests
+// failing with a 5xx status, for the given content types or else JSON
+func WithBodyCaptureOnError(maxBytes int, contentTypes ...string) Option {
+	return func(o *Options) {
+		o.BodyCaptureMax = maxBytes
+		o.BodyCaptureTypes = contentTypes
+		if len(contentTypes) == 0 {
+			o.BodyCaptureTypes = []string{"application/json"}
+		}
+	}
+}
+
+// WithMetadataFields adds the values of incoming gRPC metadata keys to every
+// entry logged for a request, mapping metadata keys to field names
+func WithMetadataFields(fields map[string]string) Option {
+	return func(o *Options) {
+		o.MetadataFields = fields
+	}
+}
+
+// WithHeaderFields adds the values of HTTP request headers to every entry
+// logged for a request, mapping header names to field names
+func WithHeaderFields(fields map[string]string) Option {
+	return func(o *Options) {
+		o.HeaderFields = fields
+	}
+}
+
+// WithSummaryMessage composes the message of the entry logged for each HTTP
+// request
+func WithSummaryMessage(f SummaryMessage) Option {
+	return func(o *Options) {
+		o.SummaryMessage = f
+	}
+}
+
+// WithRPCSummaryMessage composes the message of the entry logged for each RPC
+func WithRPCSummaryMessage(f RPCSummaryMessage) Option {
+	return func(o *Options) {
+		o.RPCSummaryMessage = f
+	}
+}
+
+// WithoutSummaryLog suppresses the entry logged for each request, keeping the
+// request-scoped log entry for handlers
+func WithoutSummaryLog() Option {
+	return func(o *Options) {
+		o.NoSummaryLog = true
+	}
+}
+
+// WithContentEncodingAwareness logs the uncompressed size of gzip encoded
+// HTTP responses
+func WithContentEncodingAwareness() Option {
+	return func(o *Options) {
+		o.ContentEncodingAware = true
+	}
+}
+
+// WithPeerIdentity logs how the peer of an RPC authenticated, and the
+// identity in its TLS certificate
+func WithPeerIdentity() Option {
+	return func(o *Options) {
+		o.PeerIdentity = true
+	}
+}
+
+// WithGRPCWeb logs the method and status of gRPC-Web and Connect RPCs served
+// over HTTP
+func WithGRPCWeb() Option {
+	return func(o *Options) {
+		o.GRPCWeb = true
+	}
+}
+
+// WithHealthCheckSummary counts gRPC health checks dropped by the RPC filter
+// and logs a single summary of them every interval
+func WithHealthCheckSummary(interval time.Duration) Option {
+	return func(o *Options) {
+		o.HealthCheckInterval = interval
+	}
+}
+
+// WithRoutePattern records the route template matched for an HTTP request
+func WithRoutePattern(f RoutePattern) Option {
+	return func(o *Options) {
+		o.RoutePattern = f
+	}
+}
+
+// WithRemoteIPStrategy configures how the client IP of an HTTP request is
+// determined
+func WithRemoteIPStrategy(strategy RemoteIPStrategy) Option {
+	return func(o *Options) {
+		o.RemoteIP = strategy
+	}
+}
+
+// WithRequestMetrics records counts of the requests logged by status class
+func WithRequestMetrics(m RequestMetricsRecorder) Option {
+	return func(o *Options) {
+		o.Metrics = m
+	}
+}
+
+// WithLatencyThresholds escalates the summary of requests slower than
+// warnAfter to WARNING, and slower than errorAfter to ERROR
+func WithLatencyThresholds(warnAfter, errorAfter time.Duration) Option {
+	return func(o *Options) {
+		o.LatencyWarn = warnAfter
+		o.LatencyError = errorAfter
+	}
+}
+
+// WithUserExtractor adds the user identified by f to the entries of each
+// request
+func WithUserExtractor(f UserExtractor) Option {
+	return func(o *Options) {
+		o.UserExtractor = f
+	}
+}
+
+// WithPerMessageScope discards the fields added to the context of a gRPC
+// stream by its handler as each message is received
+func WithPerMessageScope() Option {
+	return func(o *Options) {
+		o.PerMessageScope = true
+	}
+}
+
+// WithTLSDetails logs the version, cipher suite, server name and ALPN
+// protocol of the TLS connection of HTTP requests
+func WithTLSDetails() Option {
+	return func(o *Options) {
+		o.TLSDetails = true
+	}
+}
+
+// WithRequestErrorLimit caps the errors recorded for a request that are
+// listed in its summary
+func WithRequestErrorLimit(n int) Option {
+	return func(o *Options) {
+		o.RequestErrorLimit = n
+	}
+}
+
+// WithErrorSummary logs the summary of HTTP requests failing with at least
+// minStatus, or 500 if minStatus is not positive, at ERROR as their error
+// event, unless their error was already logged
+func WithErrorSummary(minStatus int) Option {
+	return func(o *Options) {
+		if minStatus <= 0 {
+			minStatus = http.StatusInternalServerError
+		}
+		o.ErrorSummaryStatus = minStatus
+	}
+}
+
+// WithSLOClassifier annotates the summary of each HTTP request with its SLO
+// classification
+func WithSLOClassifier(f SLOClassifier) Option {
+	return func(o *Options) {
+		o.SLOClassifier = f
+	}
+}
+
+// WithRPCSLOClassifier annotates the summary of each RPC with its SLO
+// classification
+func WithRPCSLOClassifier(f RPCSLOClassifier) Option {
+	return func(o *Options) {
+		o.RPCSLOClassifier = f
+	}
+}
+
+// WithRequestStartLog logs the start of requests still running after
+// threshold, or of every request if it is not positive
+func WithRequestStartLog(threshold time.Duration) Option {
+	return func(o *Options) {
+		if threshold < 0 {
+			threshold = 0
+		}
+		o.RequestStartLog = true
+		o.RequestStartThreshold = threshold
+	}
+}
+
+// WithAbortPanicsReported recovers and logs panics with http.ErrAbortHandler
+// as any other panic
+func WithAbortPanicsReported() Option {
+	return func(o *Options) {
+		o.ReportAbortPanics = true
+	}
+}
+
+// WithTimeoutResponse writes the response of HTTP requests whose handler
+// exceeded its timeout with h
+func WithTimeoutResponse(h http.Handler) Option {
+	return func(o *Options) {
+		o.TimeoutResponse = h
+	}
+}
+
+// WithResponseHeaderFields logs the values of HTTP response headers in the
+// summary of each request
+func WithResponseHeaderFields(names ...string) Option {
+	return func(o *Options) {
+		o.ResponseHeaders = append(o.ResponseHeaders, names...)
+	}
+}
+
+// WithCacheHeaderDetection records HTTP responses with the header as cache
+// lookups, and as cache hits when its value is hitValue
+func WithCacheHeaderDetection(header, hitValue string) Option {
+	return func(o *Options) {
+		o.CacheHeader = header
+		o.CacheHitValue = hitValue
+	}
+}
+
+// WithAggregatedLogging logs statistics of the HTTP requests served in each
+// window rather than the summary of each request, but of failed ones
+func WithAggregatedLogging(window time.Duration) Option {
+	return func(o *Options) {
+		o.AggregationWindow = window
+	}
+}
+
+// WithDecodedStatusDetails logs only the decoded details of a gRPC status
+func WithDecodedStatusDetails() Option {
+	return func(o *Options) {
+		o.DecodedStatusDetails = true
+	}
+}
+
+// WithStructuredGRPCStatus logs the status of a failed RPC as fields
+func WithStructuredGRPCStatus() Option {
+	return func(o *Options) {
+		o.StructuredGRPCStatus = true
+	}
+}
+
+// LatencyLevel escalates the level of a request summary by the latency
+// thresholds, reporting whether the request was slow. Zero thresholds are
+// disabled, and the level is never lowered.
+func (o *Options) LatencyLevel(level logrus.Level, latency time.Duration) (logrus.Level, bool) {
+	slow := false
+	if o.LatencyWarn > 0 && latency > o.LatencyWarn {
+		slow = true
+		if level > logrus.WarnLevel {
+			level = logrus.WarnLevel
+		}
+	}
+	if o.LatencyError > 0 && latency > o.LatencyError {
+		slow = true
+		if level > logrus.ErrorLevel {
+			level = logrus.ErrorLevel
+		}
+	}
+	return level, slow
+}
+
+// DefaultFilterRPC filters gRPC standard health check and gRPC reflection requests.
+func DefaultFilterRPC(_ context.Context, fullMethod string, _ error) bool {
+	switch {
+	case strings.HasPrefix(fullMethod, "/grpc.health"):
+		return false
+	case strings.HasPrefix(fullMethod, "/grpc.reflection"):
+		return false
+	default:
+		return true
+	}
+}
+
+// DefaultFilterHTTP filters health checks and monitoring canaries from some well known user agents
+// or URL paths.
+func DefaultFilterHTTP(r *http.Request) bool {
+	userAgent := r.Header.Get("User-Agent")
+	switch {
+	case userAgent == "Envoy/HC", // Envoy Proxy healthchecker
+		strings.HasPrefix(userAgent, "kube-probe/"),                 // kubernetes probes
+		strings.HasPrefix(userAgent, "GoogleHC/"),                   // GCP load balancer
+		strings.HasPrefix(userAgent, "GoogleStackdriverMonitoring"), // GCP Operations Monitoring
+		strings.HasPrefix(r.URL.Path, "/health"):
+		return false
+	default:
+		return true
+	}
+}
+
+// DefaultErrorHandler does nothing.
+func DefaultErrorHandler(ctx context.Context, err error, method string) (handled bool) {
+	return false
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/requestlog"
+	"github.com/sirupsen/logrus"
+)
+
+// PanicError converts a recovered panic value to an error
+func PanicError(e interface{}) error {
+	switch t := e.(type) {
+	case string:
+		return errors.New(t)
+	case error:
+		return t
+	default:
+		return fmt.Errorf("unknown panic value: (%T) %v", t, t)
+	}
+}
+
+// LogPanic logs a recovered panic with the stack trace of the goroutine.
+//
+// The stack trace is formatted as the runtime would print it on a crash, so
+// that Error Reporting groups panics by their message and the code that
+// panicked, rather than by the frames recovering it.
+//
+// The fields describe the request, and are only added when the logging
+// middleware has not already added them to the request-scoped log entry.
+// Without a request-scoped log entry, the panic is logged with the standard
+// logger.
+func LogPanic(ctx context.Context, err error, fields logrus.Fields) {
+	stack := panicStack(err, debug.Stack())
+	recordPanic(ctx, err, stack)
+	// the panic is the error event of the request
+	SetRequestError(ctx, err)
+	MarkRequestErrorHandled(ctx)
+	entry := ctxlogrus.ExtractOr(ctx, logrus.StandardLogger())
+	for k, v := range fields {
+		if _, ok := entry.Data[k]; !ok {
+			entry = entry.WithField(k, v)
+		}
+	}
+	entry.
+		WithError(err).
+		WithField(requestlog.KeyStackTrace, stack).
+		Errorf("panic handling request: %v", err)
+}
+
+// AbortMessage is the message of the entry logged for a request aborted with
+// http.ErrAbortHandler
+const AbortMessage = "request aborted"
+
+// LogAbort logs a request aborted by panicking with http.ErrAbortHandler, as
+// reverse proxies do when the client disconnects, at WARNING without a stack
+// trace, as it is how net/http aborts a response rather than an error. The
+// fields are added as by LogPanic.
+func LogAbort(ctx context.Context, fields logrus.Fields) {
+	entry := ctxlogrus.ExtractOr(ctx, logrus.StandardLogger())
+	for k, v := range fields {
+		if _, ok := entry.Data[k]; !ok {
+			entry = entry.WithField(k, v)
+		}
+	}
+	entry.Warn(AbortMessage)
+}
+
+// PanicStack returns the stack of a panic being recovered, formatted as
+// LogPanic logs it. It must be called by the deferred function recovering it.
+func PanicStack(err error) string {
+	return panicStack(err, debug.Stack())
+}
+
+// panicStack prefixes a stack captured by debug.Stack with the panic message,
+// and trims the frames above the call to panic, which belong to the recovery
+// handler rather than the code that panicked
+func panicStack(err error, stack []byte) string {
+	lines := strings.Split(string(stack), "\n")
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "goroutine ") {
+		// each frame is a function line followed by an indented file line
+		for i := 1; i+1 < len(lines); i += 2 {
+			if strings.HasPrefix(lines[i], "panic(") {
+				lines = append(lines[:1], lines[i+2:]...)
+				break
+			}
+		}
+	}
+	return fmt.Sprintf("panic: %s\n\n%s", err.Error(), strings.Join(lines, "\n"))
+}
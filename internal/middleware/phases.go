@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Phases of an RPC marked by the logging interceptor, and the duration of its
+// handler, when PhaseHandlerStart is marked
+const (
+	PhaseInterceptorStart = "interceptor_start"
+	PhaseHandlerStart     = "handler_start"
+	PhaseHandlerDone      = "handler_done"
+	PhaseHandler          = "handler"
+)
+
+// PhaseLimit is the number of phases recorded for a request
+const PhaseLimit = 32
+
+type phasesKey struct{}
+
+// phases accumulates the phases of a request marked with MarkPhase
+type phases struct {
+	start time.Time
+
+	mu    sync.Mutex
+	marks map[string]time.Time
+}
+
+// WithPhases installs an accumulator of the phases of a request started at
+// start
+func WithPhases(ctx context.Context, start time.Time) context.Context {
+	return context.WithValue(ctx, phasesKey{}, &phases{start: start, marks: map[string]time.Time{}})
+}
+
+// MarkPhase records the time the phase name of the request ended. Only the
+// first mark of a phase, and the first PhaseLimit phases, are recorded.
+func MarkPhase(ctx context.Context, name string) {
+	p, ok := ctx.Value(phasesKey{}).(*phases)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, marked := p.marks[name]; marked || len(p.marks) >= PhaseLimit {
+		return
+	}
+	p.marks[name] = now
+}
+
+// PhaseDurations returns the time elapsed from the start of the request to
+// each phase, and the duration of the handler as PhaseHandler if its start
+// and end were marked, or nil if no phase was marked
+func PhaseDurations(ctx context.Context) map[string]time.Duration {
+	p, ok := ctx.Value(phasesKey{}).(*phases)
+	if !ok {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.marks) == 0 {
+		return nil
+	}
+	durations := make(map[string]time.Duration, len(p.marks)+1)
+	for name, t := range p.marks {
+		durations[name] = t.Sub(p.start)
+	}
+	start, started := p.marks[PhaseHandlerStart]
+	done, ended := p.marks[PhaseHandlerDone]
+	if started && ended {
+		durations[PhaseHandler] = done.Sub(start)
+	}
+	return durations
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/requestlog"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrorReport describes a failed request to error handlers, so that it may be
+// forwarded to other sinks without rebuilding the context already logged.
+type ErrorReport struct {
+	// Entry is the log entry of the failure, as formatted
+	Entry ReportEntry
+	// Err is the error returned by the request, or the panic recovered
+	Err error
+	// GRPCRequest describes a failed RPC
+	GRPCRequest *requestlog.GRPCRequest
+	// HTTPRequest describes a failed HTTP request
+	HTTPRequest *requestlog.HTTPRequest
+	// GRPCStatus is the status of a failed RPC, marshalled with protojson
+	GRPCStatus json.RawMessage
+	// GRPCStatusDetails is the status of a failed RPC as logged with
+	// StructuredGRPCStatus
+	GRPCStatusDetails *requestlog.GRPCStatusDetails
+	// StackTrace is the stack of a recovered panic, if any
+	StackTrace string
+}
+
+// ReportEntry holds the fields of a formatted log entry needed to correlate
+// an error report with logs and traces.
+type ReportEntry struct {
+	Message  string
+	Severity string
+	Trace    string
+	SpanID   string
+}
+
+// ReportEntryComposer formats the log entry of an error report. The
+// formatter of the logger implements it to compose reports as it would log
+// them.
+type ReportEntryComposer interface {
+	ReportEntry(e *logrus.Entry) (ReportEntry, error)
+}
+
+type (
+	// ErrorHandlerV2 receives a report of the error of an RPC, and should
+	// return true if it has already been logged
+	ErrorHandlerV2 func(ctx context.Context, report *ErrorReport) (handled bool)
+
+	// HTTPErrorHandler receives a report of a 5xx response or recovered panic
+	HTTPErrorHandler func(ctx context.Context, report *ErrorReport)
+)
+
+// NewErrorReport composes the report of entry, logged at level with msg. The
+// report carries the stack of any panic recorded in context.
+func NewErrorReport(
+	ctx context.Context,
+	entry *logrus.Entry,
+	level logrus.Level,
+	msg string,
+) *ErrorReport {
+	e := entry.Dup()
+	e.Level = level
+	e.Message = msg
+	e.Time = time.Now()
+	// correlate the report to the trace even without the span hook installed
+	if _, ok := e.Data[requestlog.KeySpanContext]; !ok && e.Context != nil {
+		if spanCtx := trace.SpanContextFromContext(e.Context); spanCtx.IsValid() {
+			e.Data[requestlog.KeySpanContext] = spanCtx
+		}
+	}
+
+	report := &ErrorReport{
+		Entry: ReportEntry{Message: msg, Severity: level.String()},
+	}
+	if c, ok := e.Logger.Formatter.(ReportEntryComposer); ok {
+		if re, err := c.ReportEntry(e); err == nil {
+			report.Entry = re
+		}
+	}
+	if p, ok := ctx.Value(panicRecordKey{}).(*panicRecord); ok && p != nil {
+		p.mu.Lock()
+		report.Err, report.StackTrace = p.err, p.stack
+		p.mu.Unlock()
+	}
+	return report
+}
+
+type panicRecordKey struct{}
+
+// panicRecord holds a panic recovered while handling a request
+type panicRecord struct {
+	mu    sync.Mutex
+	err   error
+	stack string
+}
+
+// WithPanicRecord lets panics recovered while handling a request be included
+// in its error report
+func WithPanicRecord(ctx context.Context) context.Context {
+	return context.WithValue(ctx, panicRecordKey{}, &panicRecord{})
+}
+
+// WithoutPanicRecord keeps panics in work detached from a request out of its
+// error report
+func WithoutPanicRecord(ctx context.Context) context.Context {
+	return context.WithValue(ctx, panicRecordKey{}, (*panicRecord)(nil))
+}
+
+// recordPanic records a panic in the panic record of the context, if any
+func recordPanic(ctx context.Context, err error, stack string) {
+	p, ok := ctx.Value(panicRecordKey{}).(*panicRecord)
+	if !ok || p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err, p.stack = err, stack
+	}
+}
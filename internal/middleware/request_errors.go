@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultRequestErrorLimit is the number of errors kept for a request when
+// no limit is configured
+const DefaultRequestErrorLimit = 20
+
+// Fields of the request summary listing the errors recorded for the request
+const (
+	KeyRequestErrors        = "requestErrors"
+	KeyRequestErrorsDropped = "requestErrorsDropped"
+)
+
+type requestErrorsKey struct{}
+
+// requestErrors accumulates the errors recorded while handling a request
+type requestErrors struct {
+	start time.Time
+	limit int
+
+	mu      sync.Mutex
+	errs    []interface{}
+	dropped int
+	// last is the error of a failed request, and handled whether it was
+	// already logged
+	last    error
+	handled bool
+}
+
+// WithRequestErrors installs an accumulator of the errors recorded with
+// AddRequestError, keeping up to limit errors and counting the others
+func WithRequestErrors(ctx context.Context, limit int) context.Context {
+	if limit <= 0 {
+		limit = DefaultRequestErrorLimit
+	}
+	return context.WithValue(ctx, requestErrorsKey{}, &requestErrors{
+		start: time.Now(),
+		limit: limit,
+	})
+}
+
+// AddRequestError records a non-fatal error of the request, with the time
+// elapsed since it started. It does nothing outside of the middleware.
+func AddRequestError(ctx context.Context, err error, fields logrus.Fields) {
+	acc, ok := ctx.Value(requestErrorsKey{}).(*requestErrors)
+	if !ok || err == nil {
+		return
+	}
+
+	e := map[string]interface{}{
+		"message":     err.Error(),
+		"elapsedAtMs": time.Since(acc.start).Milliseconds(),
+	}
+	if len(fields) > 0 {
+		f := make(logrus.Fields, len(fields))
+		for k, v := range fields {
+			// otherwise nested errors are encoded as empty objects
+			if err, ok := v.(error); ok {
+				v = err.Error()
+			}
+			f[k] = v
+		}
+		e["fields"] = f
+	}
+
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	if len(acc.errs) >= acc.limit {
+		acc.dropped++
+		return
+	}
+	acc.errs = append(acc.errs, e)
+}
+
+// RequestErrorFields returns the fields listing the errors recorded for the
+// request, or nil if there are none
+func RequestErrorFields(ctx context.Context) logrus.Fields {
+	acc, ok := ctx.Value(requestErrorsKey{}).(*requestErrors)
+	if !ok {
+		return nil
+	}
+
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	if len(acc.errs) == 0 && acc.dropped == 0 {
+		return nil
+	}
+	errs := make([]interface{}, len(acc.errs))
+	copy(errs, acc.errs)
+	fields := logrus.Fields{KeyRequestErrors: errs}
+	if acc.dropped > 0 {
+		fields[KeyRequestErrorsDropped] = acc.dropped
+	}
+	return fields
+}
+
+// RequestErrorLevel escalates the level of the summary of a request that
+// recorded errors to WARNING, or to ERROR if the request also failed. The
+// level is never lowered.
+func RequestErrorLevel(level logrus.Level, failed bool) logrus.Level {
+	escalated := logrus.WarnLevel
+	if failed {
+		escalated = logrus.ErrorLevel
+	}
+	if level > escalated {
+		level = escalated
+	}
+	return level
+}
+
+// SetRequestError records the error that failed the request, replacing any
+// recorded before. It does nothing outside of the middleware.
+func SetRequestError(ctx context.Context, err error) {
+	acc, ok := ctx.Value(requestErrorsKey{}).(*requestErrors)
+	if !ok || err == nil {
+		return
+	}
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	acc.last = err
+}
+
+// MarkRequestErrorHandled records that the error of the request was already
+// logged, so that the summary of the request doesn't report it again
+func MarkRequestErrorHandled(ctx context.Context) {
+	acc, ok := ctx.Value(requestErrorsKey{}).(*requestErrors)
+	if !ok {
+		return
+	}
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	acc.handled = true
+}
+
+// RequestError returns the error recorded with SetRequestError, if any, and
+// whether it was already logged
+func RequestError(ctx context.Context) (err error, handled bool) {
+	acc, ok := ctx.Value(requestErrorsKey{}).(*requestErrors)
+	if !ok {
+		return nil, false
+	}
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	return acc.last, acc.handled
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RequestStartMessage is the message of the entry logged as a request starts
+const RequestStartMessage = "request started"
+
+// LogRequestStart logs the start of a request with the entry returned by
+// entry: at DEBUG right away if threshold is zero, or at INFO once the request
+// has run for threshold, so that requests in flight show in logs. The returned
+// func cancels the entry of a request finished before the threshold, or waits
+// for it to be logged, so that it always precedes the summary. It may be
+// called more than once.
+func LogRequestStart(threshold time.Duration, entry func() *logrus.Entry) (stop func()) {
+	if threshold <= 0 {
+		entry().Debug(RequestStartMessage)
+		return func() {}
+	}
+
+	logged := make(chan struct{})
+	timer := time.AfterFunc(threshold, func() {
+		defer close(logged)
+		entry().Info(RequestStartMessage)
+	})
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if !timer.Stop() {
+				<-logged
+			}
+		})
+	}
+}
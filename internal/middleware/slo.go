@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/requestlog"
+	"github.com/sirupsen/logrus"
+)
+
+// Fields of the summary of a request classified by an SLO classifier, and the
+// label naming its SLO
+const (
+	KeySLOEligible  = "sloEligible"
+	KeySLOViolation = "sloViolation"
+	KeySLOName      = "sloName"
+	LabelSLO        = "slo"
+)
+
+// SLO classifiers decide whether a request counts towards an SLO, whether it
+// violated it, and which SLO it counts towards. RPCSLOClassifier takes the
+// gRPC status code as a plain integer, for this package not to depend on gRPC.
+type (
+	SLOClassifier func(
+		r *http.Request,
+		status int,
+		latency time.Duration,
+	) (eligible, violated bool, sloName string)
+	RPCSLOClassifier func(
+		fullMethod string,
+		code uint32,
+		latency time.Duration,
+	) (eligible, violated bool, sloName string)
+)
+
+// SLOFields are the fields of the summary of a request classified by an SLO
+// classifier. Ineligible requests never violate an SLO.
+func SLOFields(eligible, violated bool, sloName string) logrus.Fields {
+	fields := logrus.Fields{
+		KeySLOEligible:  eligible,
+		KeySLOViolation: eligible && violated,
+	}
+	if sloName != "" {
+		fields[KeySLOName] = sloName
+		fields[requestlog.KeyLabels] = map[string]string{LabelSLO: sloName}
+	}
+	return fields
+}
+
+// SLORule is an SLO of the requests whose path, or full method for RPCs,
+// starts with Prefix. They violate it when they fail with a server error, or
+// take longer than Latency, unless it is zero.
+type SLORule struct {
+	Name    string
+	Prefix  string
+	Latency time.Duration
+}
+
+// SLOTable classifies requests by the first of its rules matching them.
+// Requests no rule matches are ineligible.
+type SLOTable []SLORule
+
+func (t SLOTable) match(path string) (SLORule, bool) {
+	for _, rule := range t {
+		if strings.HasPrefix(path, rule.Prefix) {
+			return rule, true
+		}
+	}
+	return SLORule{}, false
+}
+
+// Classify is an SLOClassifier of HTTP requests, failing with a 5xx status
+func (t SLOTable) Classify(
+	r *http.Request,
+	status int,
+	latency time.Duration,
+) (eligible, violated bool, sloName string) {
+	rule, ok := t.match(r.URL.Path)
+	if !ok {
+		return false, false, ""
+	}
+	failed := status >= http.StatusInternalServerError
+	return true, failed || rule.slow(latency), rule.Name
+}
+
+// ClassifyMethod classifies an RPC by its full method, whether it failed with
+// the status code of a server error, and its latency
+func (t SLOTable) ClassifyMethod(
+	fullMethod string,
+	failed bool,
+	latency time.Duration,
+) (eligible, violated bool, sloName string) {
+	rule, ok := t.match(fullMethod)
+	if !ok {
+		return false, false, ""
+	}
+	return true, failed || rule.slow(latency), rule.Name
+}
+
+func (r SLORule) slow(latency time.Duration) bool {
+	return r.Latency > 0 && latency > r.Latency
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/requestlog"
+	"github.com/sirupsen/logrus"
+)
+
+// TimeoutMessage is the message of the entry logged for a request whose
+// handler exceeded its timeout
+const TimeoutMessage = "request timed out"
+
+// maxStackDump bounds the dump of all goroutines the stack of a handler
+// still running is found in
+const maxStackDump = 1 << 20
+
+// GoroutineID returns the ID of the calling goroutine, as runtime.Stack
+// prints it, to find its stack in a dump of all goroutines later
+func GoroutineID() []byte {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	// "goroutine 18 [running]:"
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		return append([]byte(nil), b[:i]...)
+	}
+	return nil
+}
+
+// GoroutineStack returns the stack of the goroutine of the given ID, found in
+// a dump of all goroutines, or "" if it ended, or its stack was truncated
+// from the dump, which is bounded to 1 MiB.
+func GoroutineStack(id []byte) string {
+	if len(id) == 0 {
+		return ""
+	}
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxStackDump {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	header := append(append([]byte("goroutine "), id...), " ["...)
+	start := bytes.Index(buf, header)
+	if start < 0 || (start > 0 && buf[start-1] != '\n') {
+		return ""
+	}
+	stack := buf[start:]
+	if end := bytes.Index(stack, []byte("\n\n")); end >= 0 {
+		stack = stack[:end]
+	}
+	return string(stack)
+}
+
+// LogTimeout logs the error of a request whose handler exceeded its timeout,
+// with the stack of the handler still running, if known, as its error
+// event. The fields are added as by LogPanic.
+func LogTimeout(ctx context.Context, err error, stack string, fields logrus.Fields) {
+	SetRequestError(ctx, err)
+	MarkRequestErrorHandled(ctx)
+	entry := ctxlogrus.ExtractOr(ctx, logrus.StandardLogger())
+	for k, v := range fields {
+		if _, ok := entry.Data[k]; !ok {
+			entry = entry.WithField(k, v)
+		}
+	}
+	if stack != "" {
+		entry = entry.WithField(requestlog.KeyStackTrace, stack)
+	}
+	entry.WithError(err).Error(TimeoutMessage)
+}
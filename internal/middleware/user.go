@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/requestlog"
+	"github.com/sirupsen/logrus"
+)
+
+// UserExtractor identifies the user making a request, or returns "" if
+// unknown.
+type UserExtractor func(ctx context.Context) string
+
+type httpHeaderKey struct{}
+
+// WithHTTPHeader keeps the headers of an HTTP request in context for
+// UserExtractors
+func WithHTTPHeader(ctx context.Context, h http.Header) context.Context {
+	return context.WithValue(ctx, httpHeaderKey{}, h)
+}
+
+// AddUser adds the user identified by extract to the entries of the
+// request-scoped log entry. It is called with the context of the entries
+// until it identifies a user, so that it sees values added to the context by
+// authentication within the logging middleware, and the user is then kept
+// for the rest of the request.
+func AddUser(ctx context.Context, extract UserExtractor) {
+	var mu sync.Mutex
+	var user string
+	ctxlogrus.AddFieldsFunc(ctx, func(ctx context.Context) logrus.Fields {
+		mu.Lock()
+		defer mu.Unlock()
+		if user == "" {
+			user = extract(ctx)
+		}
+		if user == "" {
+			return nil
+		}
+		return logrus.Fields{requestlog.KeyUser: user}
+	})
+}
+
+// UnverifiedBearerSubject returns the sub claim of the JWT bearer token in
+// the Authorization header of an HTTP request, without verifying the token
+func UnverifiedBearerSubject(ctx context.Context) string {
+	if h, ok := ctx.Value(httpHeaderKey{}).(http.Header); ok {
+		return BearerSubject(h.Get("Authorization"))
+	}
+	return ""
+}
+
+// BearerSubject returns the sub claim of the JWT bearer token of an
+// authorization header or metadata value, without verifying the token
+func BearerSubject(authorization string) string {
+	const prefix = "bearer "
+	if len(authorization) <= len(prefix) ||
+		!strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return ""
+	}
+	parts := strings.Split(strings.TrimSpace(authorization[len(prefix):]), ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return ""
+	}
+	var claims struct {
+		Sub string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+	return claims.Sub
+}
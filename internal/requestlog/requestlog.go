@@ -0,0 +1,102 @@
+// Package requestlog holds the request details shared by the formatter and the
+// logging middleware.
+package requestlog
+
+import "encoding/json"
+
+// Keys of the request details added to entries by the logging middleware.
+// They are reserved, so that fields with the plain names added by handlers
+// can't clobber the details.
+const (
+	KeyHTTPRequest = "__logadapter_httpRequest"
+	KeyGRPCRequest = "__logadapter_grpcRequest"
+	KeyGRPCStatus  = "__logadapter_grpcStatus"
+	// KeyLabels holds labels, a map[string]string, added to the entry
+	KeyLabels = "__logadapter_labels"
+)
+
+// Keys of fields the formatter promotes to fields of the entry, which are
+// also set by the logging middleware
+const (
+	KeySpanContext = "span_context"
+	KeyStackTrace  = "stackTrace"
+	KeyUser        = "user"
+)
+
+// HTTPRequest defines details of a request and response to append to a log.
+// https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#httprequest
+type HTTPRequest struct {
+	RequestMethod                  string `json:"requestMethod,omitempty"`
+	RequestURL                     string `json:"requestUrl,omitempty"`
+	RequestSize                    string `json:"requestSize,omitempty"`
+	Status                         string `json:"status,omitempty"`
+	ResponseSize                   string `json:"responseSize,omitempty"`
+	UserAgent                      string `json:"userAgent,omitempty"`
+	RemoteIP                       string `json:"remoteIp,omitempty"`
+	ServerIP                       string `json:"serverIp,omitempty"`
+	Referer                        string `json:"referer,omitempty"`
+	Latency                        string `json:"latency,omitempty"`
+	CacheLookup                    bool   `json:"cacheLookup,omitempty"`
+	CacheHit                       bool   `json:"cacheHit,omitempty"`
+	CacheValidatedWithOriginServer bool   `json:"cacheValidatedWithOriginServer,omitempty"`
+	CacheFillBytes                 string `json:"cacheFillBytes,omitempty"`
+	Protocol                       string `json:"protocol,omitempty"`
+}
+
+// GRPCRequest represents details of a gRPC request and response appended to a log.
+type GRPCRequest struct {
+	Method    string `json:"method,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+	PeerAddr  string `json:"peer,omitempty"`
+	Deadline  string `json:"deadline,omitempty"`
+	Duration  string `json:"duration,omitempty"`
+
+	// Timeout is the timeout requested by the client in grpc-timeout, when
+	// the transport exposes it in metadata.
+	Timeout string `json:"timeout,omitempty"`
+	// TimeoutBudget is the time between the start of the call and its
+	// deadline.
+	TimeoutBudget string `json:"timeoutBudget,omitempty"`
+	// BudgetRemaining is the time left before the deadline when the call
+	// completed, negative if the deadline was exceeded.
+	BudgetRemaining string `json:"budgetRemaining,omitempty"`
+	// Attempt is the 1-based attempt number of a retried call, derived from
+	// grpc-previous-rpc-attempts.
+	Attempt int `json:"attempt,omitempty"`
+	// PeerAuthType is the type of authentication of the connection of the
+	// peer, such as "tls" or "alts", absent on plaintext connections.
+	PeerAuthType string `json:"peerAuthType,omitempty"`
+	// PeerIdentity lists the URI SANs of the leaf certificate of the peer,
+	// such as its SPIFFE ID, comma separated.
+	PeerIdentity string `json:"peerIdentity,omitempty"`
+	// PeerCertificateCN is the common name of the leaf certificate of the
+	// peer.
+	PeerCertificateCN string `json:"peerCertificateCN,omitempty"`
+	// PeerMTLS is whether the peer authenticated with a client certificate.
+	PeerMTLS bool `json:"peerMTLS,omitempty"`
+	// Phases maps the phases of the call marked with MarkPhase to the time
+	// elapsed since it started, and "handler" to the duration of its handler.
+	Phases map[string]string `json:"phases,omitempty"`
+}
+
+// GRPCStatusDetails is the status of a failed RPC, with its code and the name
+// of its code, such as "NOT_FOUND", as fields to query, and its well-known
+// error details decoded.
+type GRPCStatusDetails struct {
+	Code     int                      `json:"code"`
+	CodeName string                   `json:"codeName"`
+	Message  string                   `json:"message,omitempty"`
+	Details  []map[string]interface{} `json:"details,omitempty"`
+	// Raw is the status marshalled with protojson, when retained
+	Raw json.RawMessage `json:"raw,omitempty"`
+}
+
+// Details wraps an HTTPRequest to always be logged in the log entry root
+// object, so that GCP will format it with latency, status, etc. in the summary
+// field
+type Details struct {
+	*HTTPRequest
+	// ReportError marks the summary of a failed request reported as its error
+	// event, which also carries the request in its error context
+	ReportError bool
+}
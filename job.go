@@ -0,0 +1,190 @@
+package logadapter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Environment variables identifying the execution of a job, set by Cloud Run
+// Jobs, or with the downward API for Kubernetes Jobs
+const (
+	EnvCloudRunExecution = "CLOUD_RUN_EXECUTION"
+	EnvJobName           = "JOB_NAME"
+)
+
+// Fields of the entries of a job run with RunJob
+const (
+	KeyJobName      = "jobName"
+	KeyJobExecution = "jobExecution"
+	KeyJobStatus    = "jobStatus"
+	KeyExitCode     = "exitCode"
+)
+
+// Statuses of a job finished
+const (
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobPanicked  = "panicked"
+	JobExited    = "exited"
+)
+
+// RunJob runs fn as an execution of a batch job, such as a Kubernetes CronJob
+// or a Cloud Run Job, so that the logs of each execution are grouped.
+//
+// The execution is identified by CLOUD_RUN_EXECUTION, JOB_NAME, or otherwise
+// a random ID. The request-scoped log entry of the context of fn carries the
+// job name and execution, a trace derived from the execution, and an
+// operation spanning the execution. RunJob logs "job started" as the first
+// entry of the operation, and "job finished" as its last, with the status,
+// exit code and duration of the job.
+//
+// A panic in fn is recovered and returned as an error. When fn fails, the
+// finish entry is logged at ERROR with the error, and the stack trace of a
+// panic, as the error event of the execution. When a logger exits, such as
+// once fn logs at FATAL, the finish entry is logged by a logrus exit handler
+// before the process exits, without the exit code, which it isn't told.
+func RunJob(
+	ctx context.Context,
+	logger *logrus.Logger,
+	name string,
+	fn func(ctx context.Context) error,
+) error {
+	execution := jobExecution()
+	op := Operation{ID: execution, Producer: name}
+	ctx = WithLogger(ctx, logger)
+	ctxlogrus.AddFields(ctx, logrus.Fields{
+		KeyJobName:      name,
+		KeyJobExecution: execution,
+		KeyTrace:        jobTraceID(execution),
+		KeyOperation:    &op,
+	})
+
+	first := op
+	first.First = true
+	ctxlogrus.Extract(ctx).WithField(KeyOperation, &first).Info("job started")
+
+	start := time.Now()
+	var once sync.Once
+	finish := func(status string, exitCode int, err error, stack string) {
+		once.Do(func() {
+			last := op
+			last.Last = true
+			fields := logrus.Fields{
+				KeyOperation: &last,
+				KeyJobStatus: status,
+				KeyDuration:  time.Since(start),
+			}
+			if status != JobExited {
+				fields[KeyExitCode] = exitCode
+			}
+			entry := ctxlogrus.Extract(ctx).WithFields(fields)
+			if err == nil {
+				entry.Info("job finished")
+				return
+			}
+			if stack != "" {
+				entry = entry.WithField(KeyStackTrace, stack)
+			}
+			entry.WithError(err).Error("job finished")
+		})
+	}
+
+	// the logger exits after logging at FATAL, which is reported on its own
+	done := startJob(func() {
+		finish(JobExited, 0, NoStack(errors.New("the logger exited")), "")
+	})
+	defer done()
+
+	stack, err := runJob(ctx, fn)
+	switch {
+	case err == nil:
+		finish(JobSucceeded, 0, nil, "")
+	case stack != "":
+		finish(JobPanicked, 1, err, stack)
+	default:
+		finish(JobFailed, 1, err, "")
+	}
+	return err
+}
+
+// runningJobs are the exit steps of the jobs running, run by a logrus exit
+// handler, rather than by the ExitFunc of their logger, which is left to its
+// owner
+var runningJobs struct {
+	sync.Mutex
+	registered bool
+	next       uint64
+	exits      map[uint64]func()
+}
+
+// startJob registers the exit step of a job until done is called
+func startJob(exit func()) (done func()) {
+	runningJobs.Lock()
+	defer runningJobs.Unlock()
+	if !runningJobs.registered {
+		// run before the handlers registered by the program, which may close
+		// the output of the logger
+		logrus.DeferExitHandler(exitJobs)
+		runningJobs.registered = true
+		runningJobs.exits = map[uint64]func(){}
+	}
+	id := runningJobs.next
+	runningJobs.next++
+	runningJobs.exits[id] = exit
+	return func() {
+		runningJobs.Lock()
+		defer runningJobs.Unlock()
+		delete(runningJobs.exits, id)
+	}
+}
+
+// exitJobs runs the exit steps of the jobs running
+func exitJobs() {
+	runningJobs.Lock()
+	exits := make([]func(), 0, len(runningJobs.exits))
+	for _, exit := range runningJobs.exits {
+		exits = append(exits, exit)
+	}
+	runningJobs.Unlock()
+	for _, exit := range exits {
+		exit()
+	}
+}
+
+// runJob runs fn, recovering a panic as an error with its stack
+func runJob(ctx context.Context, fn func(ctx context.Context) error) (stack string, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = middleware.PanicError(e)
+			stack = middleware.PanicStack(err)
+		}
+	}()
+	return "", fn(ctx)
+}
+
+// jobExecution identifies the execution of a job
+func jobExecution() string {
+	if id := getenv(EnvCloudRunExecution); id != "" {
+		return id
+	}
+	if id := getenv(EnvJobName); id != "" {
+		return id
+	}
+	return uuid.Must(uuid.NewV4()).String()
+}
+
+// jobTraceID derives a trace ID from the execution of a job, so that all the
+// tasks of the execution share it
+func jobTraceID(execution string) string {
+	sum := sha256.Sum256([]byte(execution))
+	return hex.EncodeToString(sum[:16])
+}
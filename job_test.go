@@ -0,0 +1,177 @@
+package logadapter_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunJob(t *testing.T) {
+	errExport := errors.New("bucket not found")
+	for _, tcase := range []struct {
+		name     string
+		fn       func(ctx context.Context) error
+		status   string
+		severity logadapter.Severity
+		err      error
+		message  string
+	}{
+		{
+			name: "succeeded",
+			fn: func(ctx context.Context) error {
+				ctxlogrus.Extract(ctx).Info("exported 42 orders")
+				return nil
+			},
+			status:   logadapter.JobSucceeded,
+			severity: logadapter.SeverityInfo,
+		},
+		{
+			name: "failed",
+			fn: func(ctx context.Context) error {
+				ctxlogrus.Extract(ctx).Info("exported 42 orders")
+				return errExport
+			},
+			status:   logadapter.JobFailed,
+			severity: logadapter.SeverityError,
+			err:      errExport,
+			message:  "bucket not found",
+		},
+		{
+			name: "panicked",
+			fn: func(ctx context.Context) error {
+				ctxlogrus.Extract(ctx).Info("exported 42 orders")
+				panic("nil bucket")
+			},
+			status:   logadapter.JobPanicked,
+			severity: logadapter.SeverityError,
+			err:      errors.New("nil bucket"),
+			message:  "nil bucket",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			defer logadapter.SetGetenv(func(k string) string {
+				return map[string]string{"CLOUD_RUN_EXECUTION": "nightly-export-x2k8p"}[k]
+			})()
+			logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+				logadapter.WithService("nightly-export"),
+			))
+
+			err := logadapter.RunJob(context.Background(), logger, "nightly-export", tcase.fn)
+			assert.Equal(t, tcase.err, err)
+
+			entries := rec.Entries()
+			require.Len(t, entries, 3, "two boundary entries and the job's own")
+			started, logged, finished := entries[0], entries[1], entries[2]
+			for _, e := range entries {
+				assert.Equal(t, entries[0].Trace, e.Trace, "the execution is a trace")
+				assert.Equal(t, "nightly-export-x2k8p", e.Operation.ID)
+				assert.Equal(t, "nightly-export", e.Operation.Producer)
+				logtest.AssertField(t, e, "context.data.jobExecution", "nightly-export-x2k8p")
+			}
+
+			assert.Equal(t, "job started", started.Message)
+			assert.Equal(t, &logadapter.Operation{
+				ID: "nightly-export-x2k8p", Producer: "nightly-export", First: true,
+			}, started.Operation)
+			assert.False(t, logged.Operation.First || logged.Operation.Last)
+
+			assert.Contains(t, finished.Message, "job finished")
+			assert.True(t, finished.Operation.Last)
+			assert.Equal(t, tcase.severity, finished.Severity)
+			logtest.AssertField(t, finished, "context.data.jobStatus", tcase.status)
+			_, ok := logtest.Field(finished, "context.data.duration")
+			assert.True(t, ok, "the duration is logged")
+			if tcase.err == nil {
+				logtest.AssertField(t, finished, "context.data.exitCode", 0)
+				return
+			}
+			logtest.AssertField(t, finished, "context.data.exitCode", 1)
+			assert.Contains(t, finished.Message, tcase.message)
+			assert.NotEmpty(t, finished.Type, "the failure is reported as an error event")
+		})
+	}
+}
+
+func TestRunJobPanicStack(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithService("nightly-export"),
+		logadapter.WithStackTraceStyle(logadapter.TraceInPayload),
+	))
+	_ = logadapter.RunJob(context.Background(), logger, "nightly-export", exportOrders)
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Contains(t, e.StackTrace, "panic: nil bucket")
+	assert.Contains(t, e.StackTrace, "formatter_test.exportOrders",
+		"the stack starts at the code that panicked")
+}
+
+func exportOrders(context.Context) error {
+	panic("nil bucket")
+}
+
+func TestRunJobFatal(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithService("nightly-export"),
+	))
+	var exitCode int
+	logger.ExitFunc = func(code int) { exitCode = code }
+
+	err := logadapter.RunJob(context.Background(), logger, "nightly-export",
+		func(ctx context.Context) error {
+			ctxlogrus.Extract(ctx).Fatal("config missing")
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, 1, exitCode, "the logger still exits")
+
+	entries := rec.Entries()
+	require.Len(t, entries, 3, "two boundary entries and the fatal entry")
+	assert.Equal(t, logadapter.SeverityCritical, entries[1].Severity)
+	finished := entries[2]
+	assert.True(t, finished.Operation.Last)
+	assert.Equal(t, logadapter.SeverityError, finished.Severity)
+	assert.Empty(t, finished.Type, "the fatal entry is the error event")
+	logtest.AssertField(t, finished, "context.data.jobStatus", logadapter.JobExited)
+	_, ok := logtest.Field(finished, "context.data.exitCode")
+	assert.False(t, ok, "the exit code isn't known")
+
+	rec.Reset()
+	logger.Fatal("shutting down")
+	assert.Equal(t, 1, exitCode)
+	assert.Len(t, rec.Entries(), 1, "a job finished isn't logged again")
+}
+
+func TestRunJobConcurrent(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithService("nightly-export"),
+	))
+	logger.ExitFunc = func(int) {}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = logadapter.RunJob(context.Background(), logger, "nightly-export",
+				func(ctx context.Context) error {
+					ctxlogrus.Extract(ctx).Info("exported 42 orders")
+					return nil
+				})
+		}()
+		logger.Info("scheduled")
+	}
+	wg.Wait()
+	require.Len(t, rec.Entries(), 16)
+
+	rec.Reset()
+	logger.Fatal("shutting down")
+	assert.Len(t, rec.Entries(), 1, "no job is running")
+}
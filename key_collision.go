@@ -0,0 +1,27 @@
+package logadapter
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// keyCollisionMessage is logged once by formatters of entries with fields
+// named like the request details added by the logging middleware
+const keyCollisionMessage = "logadapter: fields named like request details added by the " +
+	"logging middleware are logged in context.data, rename them: "
+
+// requestField returns the request details of an entry under the reserved
+// key the logging middleware adds them with, and otherwise under the plain
+// key. Details under the reserved key take precedence, and a field under
+// the plain key is then kept in data and recorded as a collision.
+func (ee *Entry) requestField(
+	data logrus.Fields, reserved, plain string,
+) (v interface{}, isReserved bool) {
+	if v, ok := data[reserved]; ok {
+		delete(data, reserved)
+		if _, ok := data[plain]; ok {
+			ee.collisions = append(ee.collisions, plain)
+		}
+		return v, true
+	}
+	return data[plain], false
+}
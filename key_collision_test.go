@@ -0,0 +1,75 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/httpmw"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyCollision(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	handler := httpmw.LoggingMiddleware(logger, httpmw.WithGRPCWeb())(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctxlogrus.AddFields(r.Context(), logrus.Fields{
+				logadapter.KeyHTTPRequest: "user request",
+				logadapter.KeyGRPCRequest: "user rpc",
+				logadapter.KeyGRPCStatus:  "user status",
+			})
+			ctxlogrus.Extract(r.Context()).Info("looking up order")
+			w.Header().Set("Grpc-Status", "5")
+		}))
+	r := httptest.NewRequest(http.MethodPost, "/api/test.v1.OrderService/GetOrder", nil)
+	r.Header.Set("Content-Type", "application/grpc-web+proto")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	var entries []map[string]interface{}
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var got map[string]interface{}
+		require.NoError(t, dec.Decode(&got), "entries are valid JSON")
+		entries = append(entries, got)
+	}
+	require.Len(t, entries, 3, "the warning is logged once")
+
+	assert.Equal(t, "WARNING", entries[0]["severity"])
+	assert.Contains(t, entries[0]["message"], "httpRequest, grpcRequest")
+
+	logged := entries[1]["context"].(map[string]interface{})
+	assert.Contains(t, logged, "httpRequest", "request details are in context")
+	assert.Contains(t, logged, "grpcRequest", "request details are in context")
+	data := logged["data"].(map[string]interface{})
+	assert.Equal(t, "user request", data["data_httpRequest"])
+	assert.Equal(t, "user rpc", data["grpcRequest"])
+
+	summary := entries[2]
+	httpRequest := summary["httpRequest"].(map[string]interface{})
+	assert.Equal(t, "POST", httpRequest["requestMethod"])
+	logCtx := summary["context"].(map[string]interface{})
+	grpcRequest := logCtx["grpcRequest"].(map[string]interface{})
+	assert.Equal(t, "/test.v1.OrderService/GetOrder", grpcRequest["method"])
+	grpcStatus := logCtx["grpcStatus"].(map[string]interface{})
+	assert.Equal(t, 5.0, grpcStatus["code"])
+	data = logCtx["data"].(map[string]interface{})
+	assert.Equal(t, "user request", data["data_httpRequest"])
+	assert.Equal(t, "user rpc", data["grpcRequest"])
+	assert.Equal(t, "user status", data["grpcStatus"])
+	for key := range data {
+		assert.NotContains(t, key, "__logadapter", "reserved keys are not logged")
+	}
+}
@@ -0,0 +1,90 @@
+package logadapter
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Labels of entries identifying the Kubernetes pod logging them, added
+// WithKubernetesMetadata. The labels of the pod are added as k8s-pod/ followed
+// by their key, as the GKE logging agent adds them.
+const (
+	LabelPodName      = "k8s-pod/name"
+	LabelPodNamespace = "k8s-pod/namespace"
+	LabelNodeName     = "k8s-node/name"
+	labelPodPrefix    = "k8s-pod/"
+)
+
+// DefaultPodInfoDir is where the downward API volume describing the pod is
+// conventionally mounted
+const DefaultPodInfoDir = "/etc/podinfo"
+
+// podInfoDir and getenv locate the metadata of the pod, and are replaced in
+// tests
+var (
+	podInfoDir = DefaultPodInfoDir
+	getenv     = os.Getenv
+)
+
+// kubernetesLabels reads the metadata of the pod from the environment and the
+// downward API volume, either of which may be absent. POD_NAME, POD_NAMESPACE
+// and NODE_NAME take precedence over the name, namespace and nodename files,
+// and the pod name falls back to HOSTNAME.
+func kubernetesLabels() map[string]string {
+	labels := make(map[string]string)
+	if b, err := ioutil.ReadFile(filepath.Join(podInfoDir, "labels")); err == nil {
+		for k, v := range parseDownwardAPIMap(b) {
+			labels[labelPodPrefix+k] = v
+		}
+	}
+
+	for _, m := range []struct {
+		label, env, file string
+	}{
+		{LabelPodName, "POD_NAME", "name"},
+		{LabelPodNamespace, "POD_NAMESPACE", "namespace"},
+		{LabelNodeName, "NODE_NAME", "nodename"},
+	} {
+		v := getenv(m.env)
+		if v == "" {
+			if b, err := ioutil.ReadFile(filepath.Join(podInfoDir, m.file)); err == nil {
+				v = strings.TrimSpace(string(b))
+			}
+		}
+		if v == "" && m.label == LabelPodName {
+			v = getenv("HOSTNAME")
+		}
+		if v != "" {
+			labels[m.label] = v
+		}
+	}
+
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
+// parseDownwardAPIMap parses the labels or annotations of a pod written by the
+// downward API, one key="value" per line with the value quoted as by Go
+func parseDownwardAPIMap(b []byte) map[string]string {
+	m := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		kv := strings.SplitN(s.Text(), "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			continue
+		}
+		v, err := strconv.Unquote(kv[1])
+		if err != nil {
+			v = kv[1]
+		}
+		m[kv[0]] = v
+	}
+	return m
+}
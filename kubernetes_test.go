@@ -0,0 +1,86 @@
+package logadapter_test
+
+import (
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKubernetesMetadata(t *testing.T) {
+	for _, tcase := range []struct {
+		name string
+		dir  string
+		env  map[string]string
+		want map[string]string
+	}{
+		{
+			name: "podinfo",
+			dir:  "testdata/podinfo",
+			env:  map[string]string{"HOSTNAME": "checkout-7d4b9c-x2k8p"},
+			want: map[string]string{
+				"k8s-pod/name":              "checkout-7d4b9c-x2k8p",
+				"k8s-pod/namespace":         "shop",
+				"k8s-node/name":             "gke-prod-pool-1-abcd",
+				"k8s-pod/app":               "checkout",
+				"k8s-pod/pod-template-hash": "7d4b9c",
+				"k8s-pod/tier":              `backend "api"`,
+			},
+		},
+		{
+			name: "environment",
+			dir:  "testdata/podinfo",
+			env: map[string]string{
+				"HOSTNAME":      "checkout-7d4b9c-x2k8p",
+				"POD_NAME":      "checkout-0",
+				"POD_NAMESPACE": "shop-staging",
+			},
+			want: map[string]string{
+				"k8s-pod/name":              "checkout-0",
+				"k8s-pod/namespace":         "shop-staging",
+				"k8s-node/name":             "gke-prod-pool-1-abcd",
+				"k8s-pod/app":               "checkout",
+				"k8s-pod/pod-template-hash": "7d4b9c",
+				"k8s-pod/tier":              `backend "api"`,
+			},
+		},
+		{
+			name: "hostname only",
+			dir:  "testdata/missing",
+			env:  map[string]string{"HOSTNAME": "checkout-7d4b9c-x2k8p"},
+			want: map[string]string{"k8s-pod/name": "checkout-7d4b9c-x2k8p"},
+		},
+		{
+			name: "absent",
+			dir:  "testdata/missing",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			defer logadapter.SetPodInfo(tcase.dir, func(k string) string {
+				return tcase.env[k]
+			})()
+			logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+				logadapter.WithKubernetesMetadata(),
+			))
+
+			logger.Info("order placed")
+			logadapter.Alert(logrus.NewEntry(logger), "payments-down", "").Error("charge failed")
+
+			entries := rec.Entries()
+			require.Len(t, entries, 2)
+			for _, e := range entries {
+				for k, v := range tcase.want {
+					assert.Equal(t, v, e.Labels[k], "label %v", k)
+				}
+			}
+			assert.Equal(t, "payments-down", entries[1].Labels["alert_name"],
+				"the labels of the entry are kept")
+			if tcase.want == nil {
+				assert.Nil(t, entries[0].Labels)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package logadapter_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLegacyFieldNames(t *testing.T) {
+	location := map[string]interface{}{
+		"file":     logtest.StableFile,
+		"function": logtest.StableFunction,
+		"line":     logtest.StableLine,
+	}
+	reportLocation := map[string]interface{}{
+		"filePath":     logtest.StableFile,
+		"functionName": logtest.StableFunction,
+		"lineNumber":   logtest.StableLine,
+	}
+	for _, tcase := range []struct {
+		name string
+		opts []logadapter.Option
+		want map[string]interface{}
+	}{
+		{
+			name: "duplicated",
+			opts: []logadapter.Option{logadapter.WithLegacyFieldNames()},
+			want: map[string]interface{}{
+				"@type":    "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent",
+				"severity": "ERROR",
+				"message":  "payment failed",
+				"msg":      "payment failed",
+				"logName":  "projects/test-project/logs/test",
+
+				"logging.googleapis.com/trace": "projects/test-project/traces/" +
+					"105445aa7843bc8bf206b12000100000",
+				"serviceContext": map[string]interface{}{"service": "test"},
+				"context": map[string]interface{}{
+					"reportLocation": reportLocation,
+				},
+				"logging.googleapis.com/sourceLocation": location,
+				"sourceLocation":                        location,
+			},
+		},
+		{
+			name: "without duplicates",
+			opts: []logadapter.Option{
+				logadapter.WithLegacyFieldNames(),
+				logadapter.WithoutLegacyDuplicates(),
+			},
+			want: map[string]interface{}{
+				"@type":    "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent",
+				"severity": "ERROR",
+				"message":  "payment failed",
+				"logName":  "projects/test-project/logs/test",
+
+				"logging.googleapis.com/trace": "projects/test-project/traces/" +
+					"105445aa7843bc8bf206b12000100000",
+				"serviceContext": map[string]interface{}{"service": "test"},
+				"context": map[string]interface{}{
+					"reportLocation": reportLocation,
+				},
+				"logging.googleapis.com/sourceLocation": location,
+			},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			logger, rec := logtest.NewRecorder(
+				logtest.WithFormatterOptions(tcase.opts...),
+				logtest.WithStableSourceLocation(),
+			)
+			logger.Error("payment failed")
+
+			entry, ok := rec.LastEntry()
+			require.True(t, ok)
+			got, err := json.Marshal(entry)
+			require.NoError(t, err)
+			want, err := json.Marshal(tcase.want)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(want), string(got))
+		})
+	}
+}
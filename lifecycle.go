@@ -0,0 +1,103 @@
+package logadapter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Phases of the lifecycle of an instance, logged as the phase field of the
+// entries logged with the contexts of a LifecycleLogger
+const (
+	KeyPhase       = "phase"
+	PhaseStartup   = "startup"
+	PhaseRunning   = "running"
+	PhaseShutdown  = "shutdown"
+	KeyUptime      = "uptime"
+	KeyEntryCounts = "entryCounts"
+)
+
+// EntryCounter is implemented by MetricsRecorders which can report the
+// entries they counted by severity, such as the promadapter Recorder.
+type EntryCounter interface {
+	EntryCounts() map[string]int64
+}
+
+// LifecycleLogger groups the entries an instance logs outside of requests by
+// the phase of its lifecycle, so that everything it logged while starting or
+// shutting down can be found.
+type LifecycleLogger struct {
+	logger  *logrus.Logger
+	start   time.Time
+	traceID string
+}
+
+// Lifecycle returns a LifecycleLogger of the entries of logger. Its contexts
+// carry a request-scoped log entry with the phase field, and the ID of a span
+// of the phase within the global trace, so that the entries of each phase
+// share the trace of the instance, but may be told apart.
+//
+//	lc := logadapter.Lifecycle(log)
+//	ctxlogrus.Extract(lc.StartupCtx()).Info("connecting to the database")
+//	...
+//	defer lc.Shutdown()
+func Lifecycle(logger *logrus.Logger) *LifecycleLogger {
+	traceID := ""
+	if f := loggerFormatter(logger); f != nil {
+		traceID = f.GlobalTraceID
+	}
+	if traceID == "" {
+		traceID = uuid.Must(uuid.NewV4()).String()
+	}
+	return &LifecycleLogger{logger: logger, start: time.Now(), traceID: traceID}
+}
+
+// StartupCtx returns a context for the entries logged while starting.
+func (l *LifecycleLogger) StartupCtx() context.Context {
+	return l.phaseCtx(PhaseStartup)
+}
+
+// RunningCtx returns a context for the entries of background work logged
+// while running, such as by periodic jobs.
+func (l *LifecycleLogger) RunningCtx() context.Context {
+	return l.phaseCtx(PhaseRunning)
+}
+
+// ShutdownCtx returns a context for the entries logged while shutting down.
+func (l *LifecycleLogger) ShutdownCtx() context.Context {
+	return l.phaseCtx(PhaseShutdown)
+}
+
+// Shutdown logs "instance shut down" as the last entry of the shutdown phase,
+// with the uptime of the instance and, if the MetricsRecorder of the
+// formatter is an EntryCounter, the entries logged by severity.
+func (l *LifecycleLogger) Shutdown() {
+	entry := ctxlogrus.Extract(l.ShutdownCtx()).WithField(KeyUptime, time.Since(l.start))
+	if f := loggerFormatter(l.logger); f != nil {
+		if counter, ok := f.Metrics.(EntryCounter); ok {
+			entry = entry.WithField(KeyEntryCounts, counter.EntryCounts())
+		}
+	}
+	entry.Info("instance shut down")
+}
+
+func (l *LifecycleLogger) phaseCtx(phase string) context.Context {
+	ctx := WithLogger(context.Background(), l.logger)
+	ctxlogrus.AddFields(ctx, logrus.Fields{
+		KeyPhase:  phase,
+		KeySpanID: phaseSpanID(l.traceID, phase),
+	})
+	return ctx
+}
+
+// phaseSpanID derives the ID of the span of a phase from the trace of the
+// instance
+func phaseSpanID(traceID, phase string) string {
+	sum := sha256.Sum256([]byte(traceID + "/" + phase))
+	return hex.EncodeToString(sum[:8])
+}
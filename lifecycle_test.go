@@ -0,0 +1,79 @@
+package logadapter_test
+
+import (
+	"sync"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// entryCounter counts entries by severity
+type entryCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (c *entryCounter) IncEntries(severity string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[severity]++
+}
+
+func (c *entryCounter) IncFormatErrors()              {}
+func (c *entryCounter) ObserveEntryBytes(string, int) {}
+
+func (c *entryCounter) EntryCounts() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[string]int64, len(c.counts))
+	for k, v := range c.counts {
+		counts[k] = v
+	}
+	return counts
+}
+
+func TestLifecycle(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithMetrics(&entryCounter{counts: map[string]int64{}}),
+	))
+
+	lc := logadapter.Lifecycle(logger)
+	ctxlogrus.Extract(lc.StartupCtx()).Info("connecting to the database")
+	ctxlogrus.Extract(lc.StartupCtx()).Info("listening")
+	ctxlogrus.Extract(lc.RunningCtx()).Warn("cache refresh failed")
+	ctxlogrus.Extract(lc.ShutdownCtx()).Info("draining connections")
+	lc.Shutdown()
+
+	entries := rec.Entries()
+	require.Len(t, entries, 5)
+	spans := map[string]string{}
+	for _, e := range entries {
+		assert.Equal(t, "projects/test-project/traces/105445aa7843bc8bf206b12000100000", e.Trace,
+			"the phases share the global trace")
+		phase, ok := logtest.Field(e, "context.data.phase")
+		require.True(t, ok)
+		if span, seen := spans[phase.(string)]; seen {
+			assert.Equal(t, span, e.SpanID, "the entries of a phase share its span")
+		}
+		spans[phase.(string)] = e.SpanID
+	}
+	require.Len(t, spans, 3)
+	assert.Len(t, map[string]bool{
+		spans[logadapter.PhaseStartup]:  true,
+		spans[logadapter.PhaseRunning]:  true,
+		spans[logadapter.PhaseShutdown]: true,
+	}, 3, "each phase has its own span")
+	assert.Regexp(t, "^[0-9a-f]{16}$", spans[logadapter.PhaseStartup])
+
+	last := entries[4]
+	assert.Equal(t, "instance shut down", last.Message)
+	logtest.AssertField(t, last, "context.data.phase", logadapter.PhaseShutdown)
+	_, ok := logtest.Field(last, "context.data.uptime")
+	assert.True(t, ok)
+	logtest.AssertField(t, last, "context.data.entryCounts",
+		map[string]int64{"INFO": 3, "WARNING": 1})
+}
@@ -0,0 +1,49 @@
+package logadapter
+
+import (
+	"errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+// KeyLocals is added to the context data of ERROR and more severe entries
+// when WithCapturedLocals is enabled and the logged error provides locals
+const KeyLocals = "locals"
+
+// maxLocalsChain bounds the errors searched for locals, in case of cycles
+const maxLocalsChain = 20
+
+// LocalsProvider is implemented by errors carrying the values of variables
+// at the site of the error, such as those wrapped with errlocal.Wrap.
+type LocalsProvider interface {
+	Locals() map[string]interface{}
+}
+
+// errorLocals merges the locals of the errors wrapped by err, those of the
+// innermost errors, closest to the site of the error, taking precedence. It
+// returns nil if no error provides locals.
+func (f *Formatter) errorLocals(err error) logrus.Fields {
+	var locals logrus.Fields
+	for i := 0; err != nil && i < maxLocalsChain; i, err = i+1, errors.Unwrap(err) {
+		p, ok := err.(LocalsProvider)
+		if !ok {
+			continue
+		}
+		if locals == nil {
+			locals = make(logrus.Fields)
+		}
+		for k, v := range p.Locals() {
+			locals[k] = v
+		}
+	}
+	if locals == nil {
+		return nil
+	}
+
+	// locals are formatted as any other data
+	locals = replaceErrors(locals)
+	f.formatDurations(locals)
+	f.formatProtos(locals)
+	f.sanitizeData(locals)
+	return locals
+}
@@ -0,0 +1,126 @@
+package logadapter
+
+import (
+	"container/list"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// KeySuppressedCount is the number of calls to Every not logged since the
+// previous entry logged for the key
+const KeySuppressedCount = "suppressedCount"
+
+// maxLogOnceKeys bounds the keys remembered by Once and Every. The least
+// recently used keys are forgotten, so they may be logged again.
+const maxLogOnceKeys = 4096
+
+var (
+	onceKeys  = newKeyCache(maxLogOnceKeys)
+	everyKeys = newKeyCache(maxLogOnceKeys)
+
+	// logOnceClock is the clock of Every, replaced in tests
+	logOnceClock = time.Now
+
+	discardLogger = &logrus.Logger{
+		Out:       ioutil.Discard,
+		Formatter: new(logrus.JSONFormatter),
+		Hooks:     make(logrus.LevelHooks),
+		Level:     logrus.PanicLevel,
+	}
+)
+
+// Once returns the entry the first time it is called with key, and
+// otherwise an entry logging nothing, so that an error in a hot loop is
+// logged once:
+//
+//	logadapter.Once(entry, "cache-unavailable").Error("cache unavailable")
+func Once(entry *logrus.Entry, key string) *logrus.Entry {
+	first := false
+	onceKeys.do(key, func(v interface{}) interface{} {
+		first = v == nil
+		return true
+	})
+	if !first {
+		return logrus.NewEntry(discardLogger)
+	}
+	return entry
+}
+
+// everyState holds when an entry was last logged for a key of Every, and the
+// number of calls since
+type everyState struct {
+	logged     time.Time
+	suppressed int
+}
+
+// Every returns the entry at most once per interval for each key, with the
+// number of calls since the previous entry returned as the suppressedCount
+// field, and otherwise an entry logging nothing:
+//
+//	logadapter.Every(entry, "queue-full", time.Minute).Warn("queue full")
+func Every(entry *logrus.Entry, key string, interval time.Duration) *logrus.Entry {
+	t := logOnceClock()
+	log, suppressed := false, 0
+	everyKeys.do(key, func(v interface{}) interface{} {
+		s, _ := v.(*everyState)
+		if s == nil {
+			s = &everyState{}
+		} else if t.Sub(s.logged) < interval {
+			s.suppressed++
+			return s
+		}
+		log, suppressed = true, s.suppressed
+		s.logged, s.suppressed = t, 0
+		return s
+	})
+	if !log {
+		return logrus.NewEntry(discardLogger)
+	}
+	return entry.WithField(KeySuppressedCount, suppressed)
+}
+
+// keyCache is a concurrent map of a bounded number of keys, forgetting the
+// least recently used keys
+type keyCache struct {
+	limit int
+
+	mu    sync.Mutex
+	keys  map[string]*list.Element
+	order *list.List
+}
+
+type keyCacheEntry struct {
+	key   string
+	value interface{}
+}
+
+func newKeyCache(limit int) *keyCache {
+	return &keyCache{
+		limit: limit,
+		keys:  make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+// do replaces the value of key, nil if unknown, by the result of f, which
+// is called with the cache locked
+func (c *keyCache) do(key string, f func(v interface{}) interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.keys[key]; ok {
+		c.order.MoveToFront(el)
+		e := el.Value.(*keyCacheEntry)
+		e.value = f(e.value)
+		return
+	}
+	c.keys[key] = c.order.PushFront(&keyCacheEntry{key: key, value: f(nil)})
+	if c.order.Len() > c.limit {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.keys, oldest.Value.(*keyCacheEntry).key)
+	}
+}
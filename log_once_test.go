@@ -0,0 +1,102 @@
+package logadapter_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a clock advanced by tests
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// hammer calls f from 100 goroutines, 10 times each
+func hammer(f func()) {
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				f()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestOnce(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 6, 1, 14, 0, 0, 0, time.UTC)}
+	defer logadapter.SetLogOnceClock(clock.Now, 2)()
+	logger, rec := logtest.NewRecorder()
+
+	hammer(func() {
+		logadapter.Once(logger.WithField("shard", 1), "cache-unavailable").
+			Error("cache unavailable")
+	})
+	entries := rec.Entries()
+	require.Len(t, entries, 1, "logged once")
+	assert.Equal(t, "cache unavailable", entries[0].Message)
+	logtest.AssertField(t, entries[0], "context.data.shard", 1.0)
+
+	logadapter.Once(logger.WithField("shard", 2), "queue-full").Warn("queue full")
+	logadapter.Once(logger.WithField("shard", 2), "queue-full").Warn("queue full")
+	assert.Len(t, rec.Entries(), 2, "keys are logged once each")
+
+	// the least recently used key is forgotten beyond the limit of keys
+	logadapter.Once(logger.WithField("shard", 3), "disk-full").Warn("disk full")
+	logadapter.Once(logger.WithField("shard", 1), "cache-unavailable").Error("cache unavailable")
+	assert.Len(t, rec.Entries(), 4)
+}
+
+func TestEvery(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2021, 6, 1, 14, 0, 0, 0, time.UTC)}
+	defer logadapter.SetLogOnceClock(clock.Now, 16)()
+	logger, rec := logtest.NewRecorder()
+
+	for minute := 0; minute < 3; minute++ {
+		hammer(func() {
+			for key := 0; key < 2; key++ {
+				logadapter.Every(logger.WithField("key", key), fmt.Sprint("queue-full", key),
+					time.Minute).Warn("queue full")
+			}
+		})
+		clock.Advance(time.Minute)
+	}
+	logadapter.Every(logger.WithField("key", 0), "queue-full0", time.Minute).Warn("queue full")
+
+	entries := rec.Entries()
+	require.Len(t, entries, 7, "logged once per minute for each key")
+	total := map[interface{}]float64{}
+	for _, e := range entries {
+		key, ok := logtest.Field(e, "context.data.key")
+		require.True(t, ok)
+		suppressed, ok := logtest.Field(e, "context.data.suppressedCount")
+		require.True(t, ok)
+		total[key] += suppressed.(float64)
+	}
+	assert.Equal(t, map[interface{}]float64{0.0: 3 * 999, 1.0: 2 * 999}, total,
+		"every call is either logged or counted")
+	first, _ := logtest.Field(entries[0], "context.data.suppressedCount")
+	assert.Equal(t, 0.0, first)
+}
@@ -0,0 +1,143 @@
+// Package logradapter provides a logr.LogSink backed by a logrus logger, so
+// that dependencies logging through logr or klog, such as controller-runtime
+// and client-go, write entries formatted like the others.
+package logradapter
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/sirupsen/logrus"
+	"k8s.io/klog/v2"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+)
+
+// KeyLogger is the field of the name of a logr.Logger, its names joined by
+// "/"
+const KeyLogger = "logger"
+
+// noValue is logged as the value of a key without a value
+const noValue = "<no-value>"
+
+var _ logr.LogSink = (*Sink)(nil)
+
+// Sink is a logr.LogSink writing entries with a logrus logger. V-levels 0
+// are logged at INFO, and greater V-levels at DEBUG. Errors are logged at
+// ERROR with the error as the logrus.ErrorKey field, so that the formatter
+// reports them to Error Reporting. Keys and values are logged as fields, so
+// that the fields the formatter promotes, such as an "httpRequest", still
+// are.
+type Sink struct {
+	logger *logrus.Logger
+	name   string
+	fields logrus.Fields
+}
+
+// NewSink returns a Sink writing entries with logger.
+func NewSink(logger *logrus.Logger) *Sink {
+	return &Sink{logger: logger}
+}
+
+// New returns a logr.Logger writing entries with logger.
+func New(logger *logrus.Logger) logr.Logger {
+	return logr.New(NewSink(logger))
+}
+
+// SetKlogLogger writes the entries of klog, and of the packages logging
+// through it such as client-go, with logger.
+func SetKlogLogger(logger *logrus.Logger) {
+	klog.SetLogger(New(logger))
+}
+
+// WithStackSkip skips logr and klog when the formatter locates where entries
+// were logged, so that their source location is the code calling them.
+func WithStackSkip() logadapter.Option {
+	return func(f *logadapter.Formatter) {
+		f.StackSkip = append(f.StackSkip, "github.com/go-logr/logr", "k8s.io/klog")
+	}
+}
+
+// Init does nothing, as the formatter locates callers by walking the stack.
+func (s *Sink) Init(logr.RuntimeInfo) {}
+
+// Enabled reports whether the logger logs entries of the V-level.
+func (s *Sink) Enabled(level int) bool {
+	return s.logger.IsLevelEnabled(logrusLevel(level))
+}
+
+// Info logs a message at the V-level.
+func (s *Sink) Info(level int, msg string, keysAndValues ...interface{}) {
+	s.entry(keysAndValues).Log(logrusLevel(level), msg)
+}
+
+// Error logs an error at ERROR.
+func (s *Sink) Error(err error, msg string, keysAndValues ...interface{}) {
+	entry := s.entry(keysAndValues)
+	if err != nil {
+		entry = entry.WithError(err)
+	}
+	entry.Error(msg)
+}
+
+// WithValues returns a Sink logging the keys and values with each entry.
+func (s *Sink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	c := *s
+	c.fields = make(logrus.Fields, len(s.fields)+len(keysAndValues)/2)
+	for k, v := range s.fields {
+		c.fields[k] = v
+	}
+	addFields(c.fields, keysAndValues)
+	return &c
+}
+
+// WithName returns a Sink logging name, appended to the name of s, as the
+// logger field.
+func (s *Sink) WithName(name string) logr.LogSink {
+	c := *s
+	if c.name != "" {
+		name = c.name + "/" + name
+	}
+	c.name = name
+	return &c
+}
+
+// entry returns an entry with the fields of the sink and keysAndValues
+func (s *Sink) entry(keysAndValues []interface{}) *logrus.Entry {
+	fields := make(logrus.Fields, len(s.fields)+len(keysAndValues)/2+1)
+	for k, v := range s.fields {
+		fields[k] = v
+	}
+	addFields(fields, keysAndValues)
+	if s.name != "" {
+		fields[KeyLogger] = s.name
+	}
+	return s.logger.WithFields(fields)
+}
+
+// addFields adds keys and values to fields, replacing the values of
+// logr.Marshalers by what they marshal to
+func addFields(fields logrus.Fields, keysAndValues []interface{}) {
+	for i := 0; i < len(keysAndValues); i += 2 {
+		k, ok := keysAndValues[i].(string)
+		if !ok {
+			k = fmt.Sprint(keysAndValues[i])
+		}
+		var v interface{} = noValue
+		if i+1 < len(keysAndValues) {
+			v = keysAndValues[i+1]
+		}
+		if m, ok := v.(logr.Marshaler); ok {
+			v = m.MarshalLog()
+		}
+		fields[k] = v
+	}
+}
+
+// logrusLevel returns the logrus level of a V-level
+func logrusLevel(level int) logrus.Level {
+	if level > 0 {
+		return logrus.DebugLevel
+	}
+	return logrus.InfoLevel
+}
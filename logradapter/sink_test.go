@@ -0,0 +1,118 @@
+package logradapter_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/klog/v2"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logradapter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+)
+
+const reportedErrorEvent = "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1." +
+	"ReportedErrorEvent"
+
+func TestSinkInfo(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(logradapter.WithStackSkip()))
+	log := logradapter.New(logger)
+
+	log.Info("reconciling", "namespace", "default", "replicas", 3)
+	entry, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, logadapter.SeverityInfo, entry.Severity)
+	assert.Equal(t, "reconciling", entry.Message)
+	logtest.AssertField(t, entry, "context.data.namespace", "default")
+	logtest.AssertField(t, entry, "context.data.replicas", float64(3))
+
+	rec.Reset()
+	log.V(1).Info("cache miss")
+	assert.Empty(t, rec.Entries(), "V-levels above 0 are logged at DEBUG")
+	assert.False(t, log.V(1).Enabled())
+
+	logger.SetLevel(logrus.DebugLevel)
+	log.V(2).Info("cache miss", "key")
+	entry, ok = rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, logadapter.SeverityDebug, entry.Severity)
+	logtest.AssertField(t, entry, "context.data.key", "<no-value>")
+}
+
+func TestSinkError(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(logradapter.WithStackSkip()))
+	log := logradapter.New(logger).WithName("controller").WithName("pods")
+
+	// as controller-runtime reports reconciliation failures
+	log.Error(errors.New("pod not found"), "Reconciler error",
+		"controller", "pods", "reconcileID", "r-1")
+	entry, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, logadapter.SeverityError, entry.Severity)
+	assert.Equal(t, reportedErrorEvent, entry.Type, "errors are reported to Error Reporting")
+	assert.Contains(t, entry.Message, "Reconciler error")
+	assert.Contains(t, entry.Message, "pod not found")
+	logtest.AssertField(t, entry, "context.data.logger", "controller/pods")
+	logtest.AssertField(t, entry, "context.data.reconcileID", "r-1")
+
+	log.Error(nil, "no error")
+	entry, ok = rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, logadapter.SeverityError, entry.Severity)
+	assert.Equal(t, "no error", entry.Message)
+}
+
+func TestSinkWithValues(t *testing.T) {
+	logger, rec := logtest.NewRecorder()
+	base := logradapter.New(logger)
+	log := base.WithValues("controller", "pods")
+
+	log.Info("started", "worker", 1)
+	entry, ok := rec.LastEntry()
+	require.True(t, ok)
+	logtest.AssertField(t, entry, "context.data.controller", "pods")
+	logtest.AssertField(t, entry, "context.data.worker", float64(1))
+
+	base.Info("unchanged")
+	entry, ok = rec.LastEntry()
+	require.True(t, ok)
+	assert.Nil(t, entry.Context, "the values are only logged by the derived logger")
+}
+
+func TestSinkPromotedFields(t *testing.T) {
+	logger, rec := logtest.NewRecorder()
+	log := logradapter.New(logger)
+
+	log.Info("served", "httpRequest", &logadapter.HTTPRequest{
+		RequestMethod: "GET",
+		RequestURL:    "/healthz",
+		Status:        "200",
+	})
+	entry, ok := rec.LastEntry()
+	require.True(t, ok)
+	logtest.AssertField(t, entry, "context.httpRequest.url", "/healthz")
+	_, ok = logtest.Field(entry, "context.data.httpRequest")
+	assert.False(t, ok, "the httpRequest is promoted as with logrus fields")
+}
+
+func TestSetKlogLogger(t *testing.T) {
+	logger, rec := logtest.NewRecorder()
+	logradapter.SetKlogLogger(logger)
+	defer klog.ClearLogger()
+
+	klog.InfoS("watching", "resource", "pods")
+	entry, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, "watching", entry.Message)
+	// resource is renamed, as it is named like the resource of entries
+	logtest.AssertField(t, entry, "context.data.data_resource", "pods")
+
+	klog.ErrorS(errors.New("connection refused"), "watch failed")
+	entry, ok = rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, logadapter.SeverityError, entry.Severity)
+	assert.Equal(t, reportedErrorEvent, entry.Type)
+}
@@ -0,0 +1,89 @@
+package logtest
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestingT is the subset of testing.TB used by assertions.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+	Helper()
+}
+
+// Field returns the value at a dotted path of the JSON encoding of an entry,
+// such as "context.data.foo", or false if there is none. Path segments may
+// contain dots themselves, as in "logging.googleapis.com/trace", and index
+// arrays by number.
+func Field(entry logadapter.Entry, path string) (interface{}, bool) {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return nil, false
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, false
+	}
+	return lookup(v, path)
+}
+
+// AssertField asserts that the value at a dotted path of an entry, as by
+// Field, equals want once encoded as JSON.
+func AssertField(t TestingT, entry logadapter.Entry, path string, want interface{}) bool {
+	t.Helper()
+	got, ok := Field(entry, path)
+	if !ok {
+		t.Errorf("entry has no field %q", path)
+		return false
+	}
+	// compare as JSON, so that numbers of any type match
+	b, err := json.Marshal(want)
+	if err != nil {
+		t.Errorf("encoding %#v: %v", want, err)
+		return false
+	}
+	var wantJSON interface{}
+	if err := json.Unmarshal(b, &wantJSON); err != nil {
+		t.Errorf("decoding %#v: %v", want, err)
+		return false
+	}
+	return assert.Equal(t, wantJSON, got, "field %q", path)
+}
+
+// lookup resolves path within v, trying the shortest keys first, so that keys
+// containing dots are found when no shorter key matches
+func lookup(v interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return v, true
+	}
+	for i := 0; i <= len(path); i++ {
+		if i < len(path) && path[i] != '.' {
+			continue
+		}
+		key, rest := path[:i], strings.TrimPrefix(path[i:], ".")
+		var next interface{}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if next, ok = v[key]; !ok {
+				continue
+			}
+		case []interface{}:
+			n, err := strconv.Atoi(key)
+			if err != nil || n < 0 || n >= len(v) {
+				return nil, false
+			}
+			next = v[n]
+		default:
+			return nil, false
+		}
+		if got, ok := lookup(next, rest); ok {
+			return got, true
+		}
+	}
+	return nil, false
+}
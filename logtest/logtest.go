@@ -0,0 +1,183 @@
+// Package logtest records the entries written by a logger with the
+// stackdriver formatter, so that tests may assert on structured logs.
+package logtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Defaults of the formatter of a recorded logger, and the placeholders of
+// source locations recorded WithStableSourceLocation.
+const (
+	ProjectID      = "test-project"
+	Service        = "test"
+	StableFile     = "source.go"
+	StableLine     = 1
+	StableFunction = "source"
+)
+
+// GlobalTraceID is the trace ID of entries logged outside of a span
+var GlobalTraceID = uuid.Must(uuid.FromString("105445aa7843bc8bf206b12000100000"))
+
+// Option configures a Recorder.
+type Option func(*Recorder)
+
+// WithFormatterOptions configures the formatter of the logger, after the
+// defaults of the Recorder.
+func WithFormatterOptions(opts ...logadapter.Option) Option {
+	return func(r *Recorder) {
+		r.formatterOpts = append(r.formatterOpts, opts...)
+	}
+}
+
+// WithStableSourceLocation replaces the file, line and function of recorded
+// entries and their report location with fixed placeholders, so that golden
+// tests don't depend on where, or with which Go version, they were logged.
+func WithStableSourceLocation() Option {
+	return func(r *Recorder) {
+		r.stableSourceLocation = true
+	}
+}
+
+// Recorder records the formatted entries written to it.
+type Recorder struct {
+	formatterOpts        []logadapter.Option
+	stableSourceLocation bool
+
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	invalid []error
+}
+
+var _ io.Writer = (*Recorder)(nil)
+
+// NewRecorder returns a logger writing to a Recorder. Its formatter writes no
+// timestamp, has the ProjectID, Service and GlobalTraceID of this package,
+// unless configured otherwise WithFormatterOptions, and validates entries for
+// ValidationErrors.
+func NewRecorder(opts ...Option) (*logrus.Logger, *Recorder) {
+	r := &Recorder{}
+	r.formatterOpts = []logadapter.Option{
+		logadapter.WithProjectID(ProjectID),
+		logadapter.WithService(Service),
+		logadapter.WithSkipTimestamp(),
+		logadapter.WithGlobalTraceID(GlobalTraceID),
+		logadapter.WithValidation(r.recordInvalid),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	logger := logrus.New()
+	logger.Out = r
+	logger.Formatter = logadapter.NewFormatter(r.formatterOpts...)
+	return logger, r
+}
+
+// Write records formatted entries.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.buf.Write(p)
+}
+
+// recordInvalid records the violations of an entry found by validation
+func (r *Recorder) recordInvalid(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.invalid = append(r.invalid, err)
+}
+
+// ValidationErrors returns the violations of the entries recorded so far
+// found by logadapter.ValidateEntry, one error per invalid entry.
+func (r *Recorder) ValidationErrors() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]error(nil), r.invalid...)
+}
+
+// Reset discards the entries recorded so far.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf.Reset()
+	r.invalid = nil
+}
+
+// String returns the output recorded so far.
+func (r *Recorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.buf.String()
+}
+
+// Entries decodes the entries recorded so far, stopping at any output that
+// is not a JSON entry.
+func (r *Recorder) Entries() []logadapter.Entry {
+	r.mu.Lock()
+	out := append([]byte(nil), r.buf.Bytes()...)
+	r.mu.Unlock()
+
+	var entries []logadapter.Entry
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for dec.More() {
+		var e logadapter.Entry
+		if err := dec.Decode(&e); err != nil {
+			break
+		}
+		if r.stableSourceLocation {
+			stabilize(&e)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// LastEntry returns the entry recorded last, or false if none was recorded.
+func (r *Recorder) LastEntry() (logadapter.Entry, bool) {
+	entries := r.Entries()
+	if len(entries) == 0 {
+		return logadapter.Entry{}, false
+	}
+	return entries[len(entries)-1], true
+}
+
+// FilterBySeverity returns the entries recorded with a severity, such as
+// "ERROR".
+func (r *Recorder) FilterBySeverity(severity string) []logadapter.Entry {
+	var entries []logadapter.Entry
+	for _, e := range r.Entries() {
+		if string(e.Severity) == severity {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// stabilize replaces the source locations of an entry with placeholders
+func stabilize(e *logadapter.Entry) {
+	if e.SourceLocation != nil {
+		e.SourceLocation = &logadapter.SourceLocation{
+			FilePath:     StableFile,
+			LineNumber:   StableLine,
+			FunctionName: StableFunction,
+		}
+	}
+	if e.LegacySourceLocation != nil {
+		e.LegacySourceLocation = e.SourceLocation
+	}
+	if e.Context != nil && e.Context.ReportLocation != nil {
+		e.Context.ReportLocation = &logadapter.ReportLocation{
+			FilePath:     StableFile,
+			LineNumber:   StableLine,
+			FunctionName: StableFunction,
+		}
+	}
+}
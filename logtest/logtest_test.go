@@ -0,0 +1,92 @@
+package logtest_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithStableSourceLocation())
+
+	logger.WithField("orderID", "o-1").Info("order placed")
+	logger.WithError(errors.New("card declined")).Error("payment failed")
+	logger.WithField("attempt", 2).Warn("retrying payment")
+
+	entries := rec.Entries()
+	require.Len(t, entries, 3)
+	assert.Equal(t, "order placed", entries[0].Message)
+
+	errs := rec.FilterBySeverity("ERROR")
+	require.Len(t, errs, 1)
+	assert.Equal(t, "payment failed\ncard declined", errs[0].Message)
+	logtest.AssertField(t, errs[0], "context.reportLocation", map[string]interface{}{
+		"filePath":     logtest.StableFile,
+		"lineNumber":   logtest.StableLine,
+		"functionName": logtest.StableFunction,
+	})
+	logtest.AssertField(t, errs[0], "logging.googleapis.com/trace",
+		"projects/test-project/traces/105445aa7843bc8bf206b12000100000")
+
+	last, ok := rec.LastEntry()
+	require.True(t, ok)
+	logtest.AssertField(t, last, "context.data.attempt", 2)
+	logtest.AssertField(t, last, "logging.googleapis.com/sourceLocation.line", logtest.StableLine)
+
+	rec.Reset()
+	_, ok = rec.LastEntry()
+	assert.False(t, ok)
+}
+
+func TestRecorderConcurrentLogging(t *testing.T) {
+	logger, rec := logtest.NewRecorder()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			logger.WithField("worker", i).Info("working")
+		}(i)
+		go func() {
+			defer wg.Done()
+			_ = rec.Entries()
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, rec.Entries(), 10)
+}
+
+func TestField(t *testing.T) {
+	entry := logadapter.Entry{
+		Trace: "projects/test-project/traces/1",
+		Context: &logadapter.Context{
+			Data: map[string]interface{}{
+				"order": map[string]interface{}{"items": []interface{}{"a", "b"}},
+			},
+			SourceReferences: []logadapter.SourceReference{{Repository: "repo"}},
+		},
+	}
+
+	for _, tcase := range []struct {
+		path string
+		want interface{}
+		ok   bool
+	}{
+		{"logging.googleapis.com/trace", "projects/test-project/traces/1", true},
+		{"context.data.order.items.1", "b", true},
+		{"context.sourceReferences.0.repository", "repo", true},
+		{"context.data.order.items.2", nil, false},
+		{"context.data.missing", nil, false},
+		{"message", nil, false},
+	} {
+		got, ok := logtest.Field(entry, tcase.path)
+		assert.Equal(t, tcase.ok, ok, tcase.path)
+		assert.Equal(t, tcase.want, got, tcase.path)
+	}
+}
@@ -0,0 +1,99 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageComposition(t *testing.T) {
+	const stack = "goroutine 1 [running]:\nmain.main()\n\t/src/main.go:12 +0x1d"
+
+	errorFirst := func(msg string, err error, stack string) string {
+		message := msg
+		if err != nil {
+			message = fmt.Sprintf("%v (%s)", err, msg)
+		}
+		if stack != "" {
+			message += "\n" + stack
+		}
+		return message
+	}
+
+	for _, tcase := range []struct {
+		name           string
+		opts           []logadapter.Option
+		wantMessage    string
+		wantStackTrace interface{}
+		wantReported   bool
+	}{
+		{
+			name:         "default",
+			wantMessage:  "request failed\nboom\n" + stack,
+			wantReported: true,
+		},
+		{
+			name: "message and error on one line",
+			opts: []logadapter.Option{
+				logadapter.WithMessageSeparator(": "),
+				logadapter.WithStackTraceStyle(logadapter.TraceInPayload),
+			},
+			wantMessage:    "request failed: boom",
+			wantStackTrace: "request failed: boom\n" + stack,
+			wantReported:   true,
+		},
+		{
+			name: "error first",
+			opts: []logadapter.Option{
+				logadapter.WithMessageComposer(errorFirst),
+				logadapter.WithStackTraceStyle(logadapter.TraceInBoth),
+			},
+			wantMessage:    "boom (request failed)\n" + stack,
+			wantStackTrace: "boom (request failed)\n" + stack,
+			wantReported:   true,
+		},
+		{
+			name: "empty composition is not reported",
+			opts: []logadapter.Option{
+				logadapter.WithMessageComposer(func(string, error, string) string { return "" }),
+			},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(append([]logadapter.Option{
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithService("test"),
+				logadapter.WithSkipTimestamp(),
+			}, tcase.opts...)...)
+
+			logger.WithError(errors.New("boom")).
+				WithField(logadapter.KeyStackTrace, stack).
+				Error("request failed")
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+			if tcase.wantMessage == "" {
+				assert.NotContains(t, got, "message")
+			} else {
+				assert.Equal(t, tcase.wantMessage, got["message"])
+			}
+			assert.Equal(t, tcase.wantStackTrace, got["stack_trace"])
+			if tcase.wantReported {
+				assert.Contains(t, got, "@type", "reported to Error Reporting")
+			} else {
+				assert.NotContains(t, got, "@type", "reported to Error Reporting")
+			}
+		})
+	}
+}
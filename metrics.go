@@ -0,0 +1,21 @@
+package logadapter
+
+import "github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+
+// MetricsRecorder receives counts of the entries written by the Formatter, so
+// that bursts of errors, or the formatter failing, may be alerted upon.
+type MetricsRecorder interface {
+	IncEntries(severity string)
+	IncFormatErrors()
+	ObserveEntryBytes(severity string, n int)
+}
+
+// RequestMetricsRecorder receives counts of the requests logged by the
+// logging middleware, by status class (e.g. "2xx").
+type RequestMetricsRecorder = middleware.RequestMetricsRecorder
+
+type noopMetrics struct{}
+
+func (noopMetrics) IncEntries(string)             {}
+func (noopMetrics) IncFormatErrors()              {}
+func (noopMetrics) ObserveEntryBytes(string, int) {}
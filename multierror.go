@@ -0,0 +1,55 @@
+package logadapter
+
+import "errors"
+
+// KeyAdditionalErrors and KeyErrorCount are added to the context data of a
+// multi-error entry when WithExpandedMultiErrors is enabled
+const (
+	KeyAdditionalErrors = "additionalErrors"
+	KeyErrorCount       = "errorCount"
+)
+
+// unwrapMultiError returns the constituent errors of an error produced by
+// errors.Join, hashicorp/go-multierror or uber-go/multierr, or nil if err
+// does not hold multiple errors
+func unwrapMultiError(err error) []error {
+	var errs []error
+	switch v := err.(type) {
+	case interface{ Unwrap() []error }:
+		errs = v.Unwrap()
+	case interface{ WrappedErrors() []error }:
+		errs = v.WrappedErrors()
+	case interface{ Errors() []error }:
+		errs = v.Errors()
+	}
+
+	nonNil := make([]error, 0, len(errs))
+	for _, e := range errs {
+		if e != nil {
+			nonNil = append(nonNil, e)
+		}
+	}
+	if len(nonNil) < 2 {
+		return nil
+	}
+	return nonNil
+}
+
+// expandMultiError picks the primary error to report from a multi-error,
+// preferring the first that carries a stack trace, and returns it with the
+// remaining errors
+func expandMultiError(errs []error) (error, []error) {
+	primary := 0
+	for i, e := range errs {
+		var st stackTracer
+		if errors.As(e, &st) {
+			primary = i
+			break
+		}
+	}
+
+	rest := make([]error, 0, len(errs)-1)
+	rest = append(rest, errs[:primary]...)
+	rest = append(rest, errs[primary+1:]...)
+	return errs[primary], rest
+}
@@ -0,0 +1,83 @@
+//go:build go1.20
+// +build go1.20
+
+package logadapter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandedMultiErrors(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithService("test"),
+		logadapter.WithSkipTimestamp(),
+		logadapter.WithStackTraceStyle(logadapter.TraceInPayload),
+		logadapter.WithExpandedMultiErrors(5),
+	)
+
+	err := errors.Join(
+		errors.New("cache miss"),
+		pkgerrors.New("database unavailable"),
+		errors.New("fallback exhausted"),
+	)
+	logger.WithError(err).Error("my log entry")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+	assert.Equal(t, "my log entry\ndatabase unavailable", got["message"],
+		"the error with a stack is reported as primary")
+	assert.True(t,
+		strings.HasPrefix(got["stack_trace"].(string), "my log entry\ndatabase unavailable\n"),
+		"the stack of the primary error is reported")
+
+	data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"cache miss", "fallback exhausted"}, data["additionalErrors"])
+	assert.Equal(t, float64(3), data["errorCount"])
+}
+
+type wrappedErrors []error
+
+func (w wrappedErrors) Error() string          { return "multiple errors" }
+func (w wrappedErrors) WrappedErrors() []error { return w }
+
+func TestExpandedMultiErrorsLimit(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithService("test"),
+		logadapter.WithSkipTimestamp(),
+		logadapter.WithExpandedMultiErrors(1),
+	)
+
+	logger.WithError(wrappedErrors{
+		errors.New("first"),
+		errors.New("second"),
+		errors.New("third"),
+	}).Error("my log entry")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+
+	assert.Equal(t, "my log entry\nfirst", got["message"],
+		"without a stack, the first error is primary")
+	data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"second"}, data["additionalErrors"])
+	assert.Equal(t, float64(3), data["errorCount"])
+}
@@ -0,0 +1,19 @@
+package logadapter
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// prependNotice prepends an entry about the formatter itself to the first
+// entry formatted with once, so it is written to the same output.
+func prependNotice(once *sync.Once, b []byte, severity Severity, msg string) []byte {
+	once.Do(func() {
+		notice, err := json.Marshal(Entry{Severity: severity, Message: msg})
+		if err != nil {
+			return
+		}
+		b = append(append(notice, '\n'), b...)
+	})
+	return b
+}
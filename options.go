@@ -2,8 +2,13 @@ package logadapter
 
 import (
 	"encoding/hex"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/gofrs/uuid"
+	"github.com/sirupsen/logrus"
 )
 
 type StackTraceStyle int
@@ -12,6 +17,8 @@ const (
 	TraceInMessage StackTraceStyle = iota
 	TraceInPayload
 	TraceInBoth
+	// TraceNone omits stack traces, and entries are not reported as errors
+	TraceNone
 )
 
 // Option lets you configure the Formatter.
@@ -48,6 +55,15 @@ func WithProjectID(i string) Option {
 	}
 }
 
+// WithProjectResolver selects the project of each entry, such as from a
+// tenant field, to compose its trace and logName. A gcpProject field of the
+// entry takes precedence, and the ProjectID is used when neither yields one.
+func WithProjectResolver(resolve func(e *logrus.Entry) string) Option {
+	return func(f *Formatter) {
+		f.ProjectResolver = resolve
+	}
+}
+
 // WithStackSkip lets you configure which packages should be skipped for locating the error.
 func WithStackSkip(v string) Option {
 	return func(f *Formatter) {
@@ -55,6 +71,25 @@ func WithStackSkip(v string) Option {
 	}
 }
 
+// WithStackSkipPrefix skips the package pkgPrefix, and the packages under it,
+// for locating the error. Unlike WithStackSkip, "github.com/foo" doesn't skip
+// "github.com/foobar".
+func WithStackSkipPrefix(pkgPrefix string) Option {
+	return func(f *Formatter) {
+		f.StackSkipPrefixes = append(f.StackSkipPrefixes, pkgPrefix)
+	}
+}
+
+// WithStackSkipFunction skips a function, by its full name such as
+// "mycorp/pkg/log.Errorf" or "mycorp/pkg/log.(*Logger).Errorf", and its
+// closures, for locating the error, such as a logging helper of a package
+// that is otherwise attributed errors.
+func WithStackSkipFunction(fullFuncName string) Option {
+	return func(f *Formatter) {
+		f.StackSkipFunctions = append(f.StackSkipFunctions, fullFuncName)
+	}
+}
+
 // WithRegexSkip lets you configure
 // which functions or packages should be skipped for locating the error.
 func WithRegexSkip(v string) Option {
@@ -95,3 +130,412 @@ func WithGlobalTraceID(id uuid.UUID) Option {
 		f.GlobalTraceID = string(buf)
 	}
 }
+
+// WithExpandedMultiErrors reports only the primary error of a multi-error
+// (errors.Join, go-multierror) in the message and stack trace, preferring the
+// first with a stack trace, and lists up to max of the others in context.
+func WithExpandedMultiErrors(max int) Option {
+	return func(f *Formatter) {
+		f.MaxAdditionalErrors = max
+	}
+}
+
+// WithMetrics records counts and sizes of the entries written, and of
+// formatting errors.
+func WithMetrics(m MetricsRecorder) Option {
+	return func(f *Formatter) {
+		f.Metrics = m
+	}
+}
+
+// WithErrorChain lists each error wrapped by the logged error in context, with
+// its type and whether it carries a stack trace.
+func WithErrorChain() Option {
+	return func(f *Formatter) {
+		f.ErrorChain = true
+	}
+}
+
+// WithAlertDefaults adds labels, such as the owning team or oncall rotation,
+// to every ALERT and CRITICAL entry. See Alert.
+func WithAlertDefaults(labels map[string]string) Option {
+	return func(f *Formatter) {
+		f.AlertLabels = labels
+	}
+}
+
+// WithMessageSeparator lets you configure how the message and error of an
+// entry are joined, such as ": " to keep them on one line.
+func WithMessageSeparator(sep string) Option {
+	return func(f *Formatter) {
+		f.MessageSeparator = sep
+	}
+}
+
+// WithMessageComposer lets you configure how the message of an entry is built
+// from the logged message, error and stack trace.
+func WithMessageComposer(c MessageComposer) Option {
+	return func(f *Formatter) {
+		f.MessageComposer = c
+	}
+}
+
+// WithErrorTitleFromError composes the message of ERROR and more severe
+// entries with the first line of the logged error first, followed by the
+// logged message, so that Error Reporting groups errors by what failed rather
+// than by the message they were logged with.
+func WithErrorTitleFromError() Option {
+	return func(f *Formatter) {
+		f.ErrorTitleFromError = true
+	}
+}
+
+// WithTargetPlatform formats entries for the logging agent of a platform.
+// Cloud Run is detected from the environment when no platform is configured.
+func WithTargetPlatform(p Platform) Option {
+	return func(f *Formatter) {
+		f.Platform = p
+	}
+}
+
+// WithResource sets the monitored resource of entries, which is only written
+// on PlatformAgentless, as logging agents provide it otherwise.
+func WithResource(resourceType string, labels map[string]string) Option {
+	return func(f *Formatter) {
+		f.Resource = &MonitoredResource{Type: resourceType, Labels: labels}
+	}
+}
+
+// WithEncoder replaces encoding/json to encode entries, such as with the
+// encoder of the fastjson package. PrettyPrint only applies to the default
+// encoder.
+func WithEncoder(enc EntryEncoder) Option {
+	return func(f *Formatter) {
+		f.Encoder = enc
+	}
+}
+
+// WithDurationFormat lets you configure how durations in the data of entries
+// are rendered, in seconds strings by default.
+func WithDurationFormat(d DurationFormat) Option {
+	return func(f *Formatter) {
+		f.DurationFormat = d
+	}
+}
+
+// WithDurationMillis adds the duration field of entries in milliseconds, as
+// the number log-based metrics need to build distributions of latency.
+func WithDurationMillis() Option {
+	return func(f *Formatter) {
+		f.DurationMillis = true
+	}
+}
+
+// WithStackPolicy selects the StackTraceStyle of each ERROR or more severe
+// entry, in place of the style configured WithStackTraceStyle, such as to
+// omit the stack traces of expected errors.
+func WithStackPolicy(p StackPolicy) Option {
+	return func(f *Formatter) {
+		f.StackPolicy = p
+	}
+}
+
+// WithoutProtoJSON marshals proto messages logged as fields with
+// encoding/json, as their Go structs, rather than with protojson.
+func WithoutProtoJSON() Option {
+	return func(f *Formatter) {
+		f.NoProtoJSON = true
+	}
+}
+
+// WithProtoJSONMaxBytes limits the protojson of proto messages logged as
+// fields, 16 KiB by default. Longer messages are logged as a truncated string.
+func WithProtoJSONMaxBytes(n int) Option {
+	return func(f *Formatter) {
+		f.ProtoJSONMaxBytes = n
+	}
+}
+
+// WithAutoSourceReference adds the VCS revision embedded in the binary by
+// go1.18 and later, suffixed with "-dirty" when modified, to the source
+// references of the main module. It is also the Version, unless configured
+// WithVersion. Nothing is added when the binary has no build information.
+func WithAutoSourceReference() Option {
+	return func(f *Formatter) {
+		f.AutoSourceReference = true
+	}
+}
+
+// WithBuildInfoInErrors adds the Go version and the VCS and platform build
+// settings embedded in the binary to the context of ERROR and more severe
+// entries, as goVersion and buildSettings.
+func WithBuildInfoInErrors() Option {
+	return func(f *Formatter) {
+		f.BuildInfoInErrors = true
+	}
+}
+
+// WithLegacyFieldNames duplicates fields under the keys of earlier forks of
+// this formatter, the source location as sourceLocation and the message as
+// msg, for a transition period of log-based metrics and views reading them.
+// Error Reporting only reads the current keys.
+func WithLegacyFieldNames() Option {
+	return func(f *Formatter) {
+		f.LegacyFieldNames = true
+	}
+}
+
+// WithoutLegacyDuplicates omits the duplicates of fields under their legacy
+// keys added WithLegacyFieldNames. It is the default, and will be the only
+// behavior once the legacy keys are removed.
+func WithoutLegacyDuplicates() Option {
+	return func(f *Formatter) {
+		f.LegacyFieldNames = false
+	}
+}
+
+// WithANSIStripping removes ANSI escape sequences, such as the colors of
+// wrapped CLI output, from the message, stack trace and data of entries.
+// Otherwise only their escape characters are removed, as other control
+// characters are.
+func WithANSIStripping() Option {
+	return func(f *Formatter) {
+		f.StripANSI = true
+	}
+}
+
+// WithErrorFingerprint adds a fingerprint of the call path of ERROR and more
+// severe entries with a stack trace, from the logged error or the stackTrace
+// field, as the error_fingerprint label and errorFingerprint field. It hashes
+// the functions of the stack trace, other than those of the StackSkip
+// packages, ignoring files and lines, so that an error keeps its fingerprint
+// across releases as long as its call path is unchanged.
+func WithErrorFingerprint() Option {
+	return func(f *Formatter) {
+		f.ErrorFingerprint = true
+	}
+}
+
+// WithEntryMutator transforms each entry composed by the Formatter before it
+// is encoded, after any mutators configured before it. Should a mutator
+// fail, the entry is logged as it was before the mutators ran, with the
+// error as the mutatorError field, and ToEntry returns the error.
+func WithEntryMutator(m EntryMutator) Option {
+	return func(f *Formatter) {
+		f.EntryMutators = append(f.EntryMutators, m)
+	}
+}
+
+// WithValidation checks every entry formatted with ValidateEntry, calling
+// onError with the violations found. It decodes each entry once more, so it
+// is meant for tests and development rather than production.
+func WithValidation(onError func(error)) Option {
+	return func(f *Formatter) {
+		f.ValidationHandler = onError
+	}
+}
+
+// WithSizeAttribution measures the encoded size of each field of a sample of
+// the entries, a sampleRate between 0 and 1, DefaultSizeSampleRate if out of
+// range, and calls report with it, such as the Report method of a
+// SizeAggregator. Measuring an entry decodes it, so the rate bounds the
+// overhead.
+func WithSizeAttribution(sampleRate float64, report func(SizeReport)) Option {
+	return func(f *Formatter) {
+		f.SizeSampleRate = sampleRate
+		f.SizeReporter = report
+	}
+}
+
+// WithKubernetesMetadata labels every entry with the pod, namespace and node
+// logging it, and with the labels of the pod, for entries shipped without the
+// GKE logging agent, which otherwise adds them. They are read once, from the
+// POD_NAME, POD_NAMESPACE and NODE_NAME environment variables set with the
+// downward API, or HOSTNAME for the pod name, and from the files of a downward
+// API volume mounted at /etc/podinfo, when present.
+func WithKubernetesMetadata() Option {
+	return func(f *Formatter) {
+		f.KubernetesLabels = kubernetesLabels()
+	}
+}
+
+// WithMonotonicTimestamps keeps the timestamps of entries strictly
+// increasing, so that Cloud Logging shows them in the order they were
+// formatted even when the clock is coarse. An entry whose time isn't after
+// the previous timestamp is moved just after it, by the timestamp precision,
+// unless that would be more than 10 microseconds, or a thousand times the
+// precision, ahead of the wall clock, in which case it shares the previous
+// timestamp.
+func WithMonotonicTimestamps() Option {
+	return func(f *Formatter) {
+		f.MonotonicTimestamps = true
+	}
+}
+
+// WithTimestampPrecision truncates the timestamps of entries to a multiple of
+// precision, such as time.Microsecond for pipelines not handling nanoseconds.
+func WithTimestampPrecision(precision time.Duration) Option {
+	return func(f *Formatter) {
+		f.TimestampPrecision = precision
+	}
+}
+
+// WithGlobalTraceIDString sets the trace of entries logged outside of a span,
+// like WithGlobalTraceID, from 32 hexadecimal characters, such as the trace ID
+// of a span or the ID of a CI run. The dashes of a UUID are stripped. It
+// panics on any other input.
+func WithGlobalTraceIDString(id string) Option {
+	traceID, err := parseTraceID(id)
+	if err != nil {
+		panic(err)
+	}
+	return func(f *Formatter) {
+		f.GlobalTraceID = traceID
+	}
+}
+
+// WithGlobalTraceIDFromEnv sets the trace of entries logged outside of a
+// span, like WithGlobalTraceIDString, from the environment variable env, read
+// when the formatter is created. A random trace is used when it is unset.
+func WithGlobalTraceIDFromEnv(env string) Option {
+	return func(f *Formatter) {
+		id := getenv(env)
+		if id == "" {
+			return
+		}
+		traceID, err := parseTraceID(id)
+		if err != nil {
+			panic(fmt.Errorf("%s: %w", env, err))
+		}
+		f.GlobalTraceID = traceID
+	}
+}
+
+// WithFieldTypes coerces the fields of the data of entries to the types of
+// their keys, so that sinks to BigQuery, which infers the type of a column
+// from the first value it ingests, don't drop entries logging a field with
+// another type. Numbers and booleans are formatted as strings, numeric strings
+// parsed as numbers, and any value encoded as JSON for FieldJSONString. A
+// value that cannot be coerced is logged as a string under its key with the
+// suffix __invalid instead, such as retries__invalid.
+func WithFieldTypes(types map[string]FieldType) Option {
+	return func(f *Formatter) {
+		if f.FieldTypes == nil {
+			f.FieldTypes = make(map[string]FieldType, len(types))
+		}
+		for k, t := range types {
+			f.FieldTypes[k] = t
+		}
+	}
+}
+
+// WithStringifyAll formats every number and boolean in the data of entries as
+// a string, including those nested in maps and slices, except for the fields
+// typed WithFieldTypes.
+func WithStringifyAll() Option {
+	return func(f *Formatter) {
+		f.StringifyAll = true
+	}
+}
+
+// WithErrorKey reads the error of entries from the field key, such as "err",
+// instead of logrus.ErrorKey.
+func WithErrorKey(key string) Option {
+	return func(f *Formatter) {
+		f.ErrorKey = key
+	}
+}
+
+// WithForceTraceSampledOnError marks the trace of entries of ERROR or above
+// with a span or a trace field as sampled, so that Cloud Logging correlates
+// them with their trace even when the span wasn't sampled.
+func WithForceTraceSampledOnError() Option {
+	return func(f *Formatter) {
+		f.ForceTraceSampledOnError = true
+	}
+}
+
+// WithSamplingEscalation calls escalate with the unsampled span of each entry
+// of ERROR or above, such as to have the span processor of the application
+// export its trace anyway. It is called as entries are formatted, so must be
+// safe for concurrent use, and may be called more than once for a span.
+func WithSamplingEscalation(escalate func(sc trace.SpanContext)) Option {
+	return func(f *Formatter) {
+		f.SamplingEscalation = escalate
+	}
+}
+
+// WithSourceLocationStrategy selects how the source location of entries is
+// resolved when logrus reports their caller, with SetReportCaller. Defaults to
+// PreferCaller.
+func WithSourceLocationStrategy(s SourceLocationStrategy) Option {
+	return func(f *Formatter) {
+		f.SourceLocationStrategy = s
+	}
+}
+
+// WithSourceLocationDebug logs how the source location of each entry was
+// resolved, "caller" or "stackwalk", as the sourceLocationOrigin field of its
+// data, to audit a SourceLocationStrategy.
+func WithSourceLocationDebug() Option {
+	return func(f *Formatter) {
+		f.SourceLocationDebug = true
+	}
+}
+
+// WithStackTraceFrameLimit keeps at most n frames of the stack traces of
+// entries, the top-most ones, after dropping the frames of the packages
+// configured WithStackTraceTrimPackages, DefaultStackTrimPackages by default.
+// A last line notes how many frames were elided.
+func WithStackTraceFrameLimit(n int) Option {
+	return func(f *Formatter) {
+		f.StackFrameLimit = n
+	}
+}
+
+// WithStackTraceTrimPackages drops the frames of the packages, and of their
+// subpackages, from the stack traces of entries, in place of
+// DefaultStackTrimPackages. Without packages, no frame is dropped but those
+// beyond the limit configured WithStackTraceFrameLimit.
+func WithStackTraceTrimPackages(pkgs ...string) Option {
+	return func(f *Formatter) {
+		f.StackTrimPackages = append([]string{}, pkgs...)
+	}
+}
+
+// WithCapturedLocals adds the values of variables at the site of the errors
+// of ERROR and more severe entries, provided by errors implementing
+// LocalsProvider such as with errlocal.Wrap, to their context as locals. It is
+// meant for debug builds, as locals may be large or hold personal data, which
+// EntryMutators may redact.
+func WithCapturedLocals() Option {
+	return func(f *Formatter) {
+		f.CapturedLocals = true
+	}
+}
+
+// WithReservedKeyPolicy selects how fields named like the ReservedKeys, such
+// as message or severity, are logged in the context data of entries:
+// RenameReservedKeys, the default, DropReservedKeys or AllowReservedKeys.
+func WithReservedKeyPolicy(p ReservedKeyPolicy) Option {
+	return func(f *Formatter) {
+		f.ReservedKeyPolicy = p
+	}
+}
+
+// WithReservedKeyPrefix renames fields named like the ReservedKeys with
+// prefix, rather than DefaultReservedKeyPrefix.
+func WithReservedKeyPrefix(prefix string) Option {
+	return func(f *Formatter) {
+		f.ReservedKeyPrefix = prefix
+	}
+}
+
+// WithSchemaVersion logs v as the logSchema of every entry, such as
+// CurrentSchemaVersion, for pipelines to tell the shape of entries of services
+// logging with different versions of this package, and UpgradeEntry them.
+func WithSchemaVersion(v string) Option {
+	return func(f *Formatter) {
+		f.SchemaVersion = v
+	}
+}
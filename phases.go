@@ -0,0 +1,22 @@
+package logadapter
+
+import (
+	"context"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+)
+
+// MarkPhase records the end of the phase name of the RPC of ctx, such as
+// "auth_done" in an interceptor chained after the logging interceptor, so that
+// the summary of the RPC shows where its time was spent. The phases field of
+// its grpcRequest maps each phase to the time elapsed since the RPC started,
+// along with "interceptor_start" and "handler_done", marked by the logging
+// interceptor, and the duration of the "handler" if "handler_start" was
+// marked, such as by grpcmw.UnaryPhaseInterceptor chained last.
+//
+// It is safe to call from the goroutines of a request. Only the first mark
+// of a phase, and the first 32 phases, are recorded. Outside of the unary
+// logging interceptor, it does nothing.
+func MarkPhase(ctx context.Context, name string) {
+	middleware.MarkPhase(ctx, name)
+}
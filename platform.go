@@ -0,0 +1,49 @@
+package logadapter
+
+import "os"
+
+// Platform is the runtime environment whose logging agent reads the
+// formatted entries, which determines the fields the agent expects.
+type Platform int
+
+const (
+	// PlatformGKE formats entries for the GKE logging agent. It is assumed
+	// unless another platform is configured or detected.
+	PlatformGKE Platform = iota + 1
+	// PlatformCloudRun formats entries for the logging agent of Cloud Run and
+	// Cloud Functions, which ignores logName and reads the timestamp as time.
+	PlatformCloudRun
+	// PlatformGCE formats entries for the Ops Agent on Compute Engine.
+	PlatformGCE
+	// PlatformAgentless formats entries with every field, including the
+	// monitored resource, for shipping without a Google logging agent.
+	PlatformAgentless
+)
+
+// MonitoredResource is the resource producing the log entries.
+// https://cloud.google.com/logging/docs/reference/v2/rest/v2/MonitoredResource
+type MonitoredResource struct {
+	Type   string            `json:"type,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// detectPlatform identifies Cloud Run and Cloud Functions by the environment
+// their runtime provides.
+func detectPlatform() Platform {
+	if os.Getenv("K_SERVICE") != "" {
+		return PlatformCloudRun
+	}
+	return PlatformGKE
+}
+
+// adjustForPlatform removes or renames the fields of an entry as the logging
+// agent of the platform expects.
+func (f *Formatter) adjustForPlatform(ee *Entry) {
+	switch f.Platform {
+	case PlatformCloudRun:
+		ee.LogName = ""
+		ee.Time, ee.Timestamp = ee.Timestamp, ""
+	case PlatformAgentless:
+		ee.Resource = f.Resource
+	}
+}
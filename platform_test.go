@@ -0,0 +1,91 @@
+package logadapter_test
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetPlatform(t *testing.T) {
+	const (
+		common = `
+			"logging.googleapis.com/trace":
+				"projects/test-project/traces/105445aa7843bc8bf206b12000100000",
+			"logging.googleapis.com/sourceLocation": {
+				"file": "/src/main.go", "line": 12, "function": "main.main"
+			},
+			"message": "order placed",
+			"severity": "INFO",
+			"context": {"data": {"orderID": "o-1"}}`
+		logName   = `"logName": "projects/test-project/logs/checkout",`
+		timestamp = `"timestamp": "2021-06-01T12:00:00.5Z",`
+	)
+	for _, tcase := range []struct {
+		name     string
+		platform logadapter.Platform
+		want     string
+	}{
+		{"gke", logadapter.PlatformGKE, `{` + logName + timestamp + common + `}`},
+		{"gce", logadapter.PlatformGCE, `{` + logName + timestamp + common + `}`},
+		{"cloud run", logadapter.PlatformCloudRun,
+			`{"time": "2021-06-01T12:00:00.5Z",` + common + `}`},
+		{"agentless", logadapter.PlatformAgentless, `{` + logName + timestamp + `
+			"resource": {
+				"type": "k8s_container",
+				"labels": {"cluster_name": "prod", "namespace_name": "shop"}
+			},` + common + `}`},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			f := logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithService("checkout"),
+				logadapter.WithGlobalTraceID(TraceID),
+				logadapter.WithResource("k8s_container", map[string]string{
+					"cluster_name":   "prod",
+					"namespace_name": "shop",
+				}),
+				logadapter.WithTargetPlatform(tcase.platform),
+			)
+
+			b, err := f.Format(platformEntry())
+			require.NoError(t, err)
+			assert.JSONEq(t, tcase.want, string(b))
+		})
+	}
+}
+
+func TestDetectCloudRun(t *testing.T) {
+	prev, set := os.LookupEnv("K_SERVICE")
+	defer func() {
+		if set {
+			os.Setenv("K_SERVICE", prev)
+		} else {
+			os.Unsetenv("K_SERVICE")
+		}
+	}()
+
+	os.Unsetenv("K_SERVICE")
+	assert.Equal(t, logadapter.PlatformGKE, logadapter.NewFormatter().Platform)
+
+	os.Setenv("K_SERVICE", "checkout")
+	assert.Equal(t, logadapter.PlatformCloudRun, logadapter.NewFormatter().Platform)
+	assert.Equal(t, logadapter.PlatformGKE, logadapter.NewFormatter(
+		logadapter.WithTargetPlatform(logadapter.PlatformGKE),
+	).Platform, "a configured platform is not overridden")
+}
+
+// platformEntry is the same logical entry formatted for every platform
+func platformEntry() *logrus.Entry {
+	e := logrus.NewEntry(logrus.New()).WithField("orderID", "o-1")
+	e.Level = logrus.InfoLevel
+	e.Message = "order placed"
+	e.Time = time.Date(2021, 6, 1, 12, 0, 0, 500000000, time.UTC)
+	e.Caller = &runtime.Frame{File: "/src/main.go", Line: 12, Function: "main.main"}
+	return e
+}
@@ -0,0 +1,40 @@
+package logadapter
+
+import (
+	"errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrProjectIDUnset is returned by NewFormatterStrict when no ProjectID is
+// configured.
+var ErrProjectIDUnset = errors.New(
+	"logadapter: ProjectID is unset, configure it WithProjectID")
+
+// projectIDUnsetMessage is logged once by formatters without a ProjectID
+const projectIDUnsetMessage = "logadapter: ProjectID is unset, so entries omit " +
+	"logName and trace, and are not correlated with traces; configure it WithProjectID"
+
+// NewFormatterStrict returns a new Formatter, or an error if a required
+// option, such as the ProjectID, is not configured.
+func NewFormatterStrict(options ...Option) (*Formatter, error) {
+	f := NewFormatter(options...)
+	if f.ProjectID == "" && f.ProjectResolver == nil {
+		return nil, ErrProjectIDUnset
+	}
+	return f, nil
+}
+
+// projectID returns the ID of the project of an entry, from its gcpProject
+// field, the ProjectResolver, or else the ProjectID of the formatter
+func (f *Formatter) projectID(e *logrus.Entry) string {
+	if project, ok := e.Data[KeyGCPProject].(string); ok && project != "" {
+		return project
+	}
+	if f.ProjectResolver != nil {
+		if project := f.ProjectResolver(e); project != "" {
+			return project
+		}
+	}
+	return f.ProjectID
+}
@@ -0,0 +1,123 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectIDUnset(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithService("checkout"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	logger.WithField(logadapter.KeySpanContext, SpanContext).Info("order placed")
+	logger.Info("order shipped")
+
+	var entries []map[string]interface{}
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var got map[string]interface{}
+		require.NoError(t, dec.Decode(&got), "entries are valid JSON")
+		entries = append(entries, got)
+	}
+	require.Len(t, entries, 3, "the warning is logged once")
+
+	assert.Equal(t, "WARNING", entries[0]["severity"])
+	assert.Contains(t, entries[0]["message"], "ProjectID is unset")
+	for _, got := range entries {
+		assert.NotContains(t, got, "logName")
+		assert.NotContains(t, got, "logging.googleapis.com/trace")
+	}
+	assert.Equal(t, "order placed", entries[1]["message"])
+	assert.Equal(t, "0000000000000001", entries[1]["logging.googleapis.com/spanId"])
+	assert.Equal(t, "order shipped", entries[2]["message"])
+}
+
+func TestNewFormatterStrict(t *testing.T) {
+	f, err := logadapter.NewFormatterStrict(logadapter.WithService("checkout"))
+	assert.Nil(t, f)
+	assert.ErrorIs(t, err, logadapter.ErrProjectIDUnset)
+
+	f, err = logadapter.NewFormatterStrict(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithService("checkout"),
+	)
+	require.NoError(t, err)
+
+	b, err := f.Format(logrus.NewEntry(logrus.New()))
+	require.NoError(t, err)
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &got), "no warning is prepended")
+	assert.Equal(t, "projects/test-project/logs/checkout", got["logName"])
+}
+
+func TestProjectPerEntry(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithService("checkout"),
+		logadapter.WithSkipTimestamp(),
+		logadapter.WithProjectResolver(func(e *logrus.Entry) string {
+			tenant, _ := e.Data["tenant"].(string)
+			return map[string]string{"acme": "acme-prod"}[tenant]
+		}),
+	)
+
+	logger.WithField("tenant", "acme").
+		WithField(logadapter.KeySpanContext, SpanContext).
+		Info("order placed")
+	logger.WithField("tenant", "acme").
+		WithField(logadapter.KeyGCPProject, "globex-prod").
+		WithField(logadapter.KeyTrace, "105445aa7843bc8bf206b12000100000").
+		Info("order placed")
+	logger.WithField("tenant", "initech").Info("order placed")
+
+	var entries []map[string]interface{}
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var got map[string]interface{}
+		require.NoError(t, dec.Decode(&got), "entries are valid JSON")
+		entries = append(entries, got)
+	}
+	require.Len(t, entries, 4, "the warning is logged for the entry without a project")
+
+	assert.Equal(t, "projects/acme-prod/logs/checkout", entries[0]["logName"])
+	assert.Equal(t,
+		"projects/acme-prod/traces/105445aa7843bc8bf206b12000100000",
+		entries[0]["logging.googleapis.com/trace"])
+
+	assert.Equal(t, "projects/globex-prod/logs/checkout", entries[1]["logName"])
+	assert.Equal(t,
+		"projects/globex-prod/traces/105445aa7843bc8bf206b12000100000",
+		entries[1]["logging.googleapis.com/trace"])
+	data := entries[1]["context"].(map[string]interface{})["data"].(map[string]interface{})
+	assert.NotContains(t, data, logadapter.KeyGCPProject)
+
+	assert.Equal(t, "WARNING", entries[2]["severity"])
+	assert.Contains(t, entries[2]["message"], "ProjectID is unset")
+	assert.NotContains(t, entries[3], "logName")
+	assert.NotContains(t, entries[3], "logging.googleapis.com/trace")
+}
+
+func TestProjectResolverFallback(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithProjectResolver(func(e *logrus.Entry) string { return "" }),
+	))
+	logger.Info("order placed")
+
+	entry, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, "projects/"+logtest.ProjectID+"/logs/"+logtest.Service, entry.LogName)
+}
@@ -0,0 +1,108 @@
+// Package promadapter exports the metrics of a logadapter Formatter and
+// logging middleware to Prometheus.
+package promadapter
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "logadapter"
+
+// Recorder implements both logadapter.MetricsRecorder and
+// logadapter.RequestMetricsRecorder.
+type Recorder struct {
+	entries      *prometheus.CounterVec
+	formatErrors prometheus.Counter
+	entryBytes   *prometheus.HistogramVec
+	requests     *prometheus.CounterVec
+	webhook      prometheus.Counter
+
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// NewRecorder returns a Recorder with its collectors registered with reg,
+// or with the default registerer if reg is nil.
+func NewRecorder(reg prometheus.Registerer) *Recorder {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	r := &Recorder{
+		entries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "entries_total",
+			Help:      "Log entries written, by severity.",
+		}, []string{"severity"}),
+		formatErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "format_errors_total",
+			Help:      "Log entries that could not be formatted.",
+		}),
+		entryBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "entry_bytes",
+			Help:      "Size of the log entries written, by severity.",
+			Buckets:   prometheus.ExponentialBuckets(128, 4, 7),
+		}, []string{"severity"}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "Requests logged by the middleware, by status class.",
+		}, []string{"status_class"}),
+		webhook: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhook_failures_total",
+			Help:      "Log entries a webhook hook failed to deliver.",
+		}),
+		counts: make(map[string]int64),
+	}
+
+	reg.MustRegister(r.entries, r.formatErrors, r.entryBytes, r.requests, r.webhook)
+
+	return r
+}
+
+// IncEntries counts an entry written with the given severity.
+func (r *Recorder) IncEntries(severity string) {
+	r.entries.WithLabelValues(severity).Inc()
+
+	r.mu.Lock()
+	r.counts[severity]++
+	r.mu.Unlock()
+}
+
+// EntryCounts returns the entries counted by severity, so that
+// logadapter.LifecycleLogger reports them as the instance shuts down.
+func (r *Recorder) EntryCounts() map[string]int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[string]int64, len(r.counts))
+	for severity, n := range r.counts {
+		counts[severity] = n
+	}
+	return counts
+}
+
+// IncFormatErrors counts an entry that failed to format.
+func (r *Recorder) IncFormatErrors() {
+	r.formatErrors.Inc()
+}
+
+// ObserveEntryBytes records the size of an entry written with the given severity.
+func (r *Recorder) ObserveEntryBytes(severity string, n int) {
+	r.entryBytes.WithLabelValues(severity).Observe(float64(n))
+}
+
+// IncRequests counts a request logged with the given status class.
+func (r *Recorder) IncRequests(statusClass string) {
+	r.requests.WithLabelValues(statusClass).Inc()
+}
+
+// IncWebhookFailures counts an entry a logadapter.WebhookHook failed to
+// deliver.
+func (r *Recorder) IncWebhookFailures() {
+	r.webhook.Inc()
+}
@@ -0,0 +1,60 @@
+package promadapter_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/promadapter"
+)
+
+func TestRecorder(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	rec := promadapter.NewRecorder(reg)
+
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(logadapter.WithMetrics(rec))
+
+	logger.Info("one")
+	logger.Info("two")
+	logger.Error("three")
+	rec.IncRequests("5xx")
+	rec.IncWebhookFailures()
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+
+	got := map[string]float64{}
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			name := mf.GetName()
+			for _, l := range m.GetLabel() {
+				name += "/" + l.GetValue()
+			}
+			switch {
+			case m.GetCounter() != nil:
+				got[name] = m.GetCounter().GetValue()
+			case m.GetHistogram() != nil:
+				got[name] = m.GetHistogram().GetSampleSum()
+				got[name+"/count"] = float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+
+	assert.Equal(t, 2.0, got["logadapter_entries_total/INFO"])
+	assert.Equal(t, 1.0, got["logadapter_entries_total/ERROR"])
+	assert.Equal(t, 0.0, got["logadapter_format_errors_total"])
+	assert.Equal(t, 2.0, got["logadapter_entry_bytes/INFO/count"])
+	assert.Equal(t, float64(out.Len()),
+		got["logadapter_entry_bytes/INFO"]+got["logadapter_entry_bytes/ERROR"])
+	assert.Equal(t, 1.0, got["logadapter_requests_total/5xx"])
+	assert.Equal(t, 1.0, got["logadapter_webhook_failures_total"])
+	assert.Equal(t, map[string]int64{"INFO": 2, "ERROR": 1}, rec.EntryCounts())
+}
@@ -0,0 +1,116 @@
+package logadapter
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/runtime/protoimpl"
+)
+
+// defaultProtoJSONMaxBytes limits the JSON of a proto message in the data of
+// an entry, when no limit is configured
+const defaultProtoJSONMaxBytes = 16 << 10
+
+// formatProtos replaces the proto messages of data, which must already be
+// copied from the entry, and those of its slices and maps, with their protojson
+// encoding, unless disabled.
+func (f *Formatter) formatProtos(data logrus.Fields) {
+	if f.NoProtoJSON {
+		return
+	}
+	for k, v := range data {
+		data[k] = f.formatProto(v, true)
+	}
+}
+
+// formatProto encodes v if it is a proto message or, when nested, the
+// messages of a slice or map of them
+func (f *Formatter) formatProto(v interface{}, nested bool) interface{} {
+	if m, ok := protoMessage(v); ok {
+		return f.protoJSON(m, v)
+	}
+	if !nested {
+		return v
+	}
+
+	switch v := v.(type) {
+	case []proto.Message:
+		c := make([]interface{}, len(v))
+		for i, m := range v {
+			c[i] = f.formatProto(m, false)
+		}
+		return c
+	case []protoiface.MessageV1:
+		c := make([]interface{}, len(v))
+		for i, m := range v {
+			c[i] = f.formatProto(m, false)
+		}
+		return c
+	case map[string]proto.Message:
+		c := make(map[string]interface{}, len(v))
+		for k, m := range v {
+			c[k] = f.formatProto(m, false)
+		}
+		return c
+	case map[string]protoiface.MessageV1:
+		c := make(map[string]interface{}, len(v))
+		for k, m := range v {
+			c[k] = f.formatProto(m, false)
+		}
+		return c
+	case []interface{}:
+		for i, e := range v {
+			v[i] = f.formatProto(e, false)
+		}
+	case logrus.Fields:
+		for k, e := range v {
+			v[k] = f.formatProto(e, false)
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = f.formatProto(e, false)
+		}
+	}
+	return v
+}
+
+// protoMessage provides v as a proto message, including messages generated
+// for the legacy github.com/golang/protobuf API
+func protoMessage(v interface{}) (proto.Message, bool) {
+	switch m := v.(type) {
+	case proto.Message:
+		return m, true
+	case protoiface.MessageV1:
+		return protoimpl.X.ProtoMessageV2Of(m), true
+	}
+	return nil, false
+}
+
+// protoJSON encodes m with protojson, with enums as strings and without
+// unpopulated fields. Encodings longer than the limit are truncated to a
+// string, and v is returned as is if m can't be encoded.
+func (f *Formatter) protoJSON(m proto.Message, v interface{}) interface{} {
+	b, err := protojson.Marshal(m)
+	if err != nil {
+		return v
+	}
+	// protojson varies its whitespace to prevent relying on its output
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return v
+	}
+
+	max := f.ProtoJSONMaxBytes
+	if max <= 0 {
+		max = defaultProtoJSONMaxBytes
+	}
+	if buf.Len() > max {
+		return middleware.Truncate(buf.String(), max) + middleware.TruncatedMarker
+	}
+	return json.RawMessage(buf.Bytes())
+}
@@ -0,0 +1,83 @@
+package logadapter_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	pb_testproto "github.com/grpc-ecosystem/go-grpc-middleware/testing/testproto"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/runtime/protoimpl"
+	"google.golang.org/protobuf/types/known/typepb"
+)
+
+func TestProtoFields(t *testing.T) {
+	ping := &pb_testproto.PingRequest{Value: "hello", SleepTimeMs: 10}
+	field := &typepb.Field{Kind: typepb.Field_TYPE_STRING, Name: "email", Number: 3}
+	pingJSON := protoJSONValue(t, protoimpl.X.ProtoMessageV2Of(ping))
+	fieldJSON := protoJSONValue(t, field)
+	require.Equal(t, map[string]interface{}{"value": "hello", "sleepTimeMs": float64(10)}, pingJSON)
+	require.Equal(t, "TYPE_STRING", fieldJSON.(map[string]interface{})["kind"])
+
+	logger, rec := logtest.NewRecorder()
+	logger.WithFields(logrus.Fields{
+		"request": ping,
+		"field":   field,
+		"fields":  []proto.Message{field},
+		"legacy":  []protoiface.MessageV1{ping},
+		"byName":  map[string]protoiface.MessageV1{"ping": ping},
+		"nested":  map[string]interface{}{"field": field},
+		"list":    []interface{}{ping, "text"},
+	}).Info("received")
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	logtest.AssertField(t, e, "context.data.request", pingJSON)
+	logtest.AssertField(t, e, "context.data.field", fieldJSON)
+	logtest.AssertField(t, e, "context.data.fields.0", fieldJSON)
+	logtest.AssertField(t, e, "context.data.legacy.0", pingJSON)
+	logtest.AssertField(t, e, "context.data.byName.ping", pingJSON)
+	logtest.AssertField(t, e, "context.data.nested.field", fieldJSON)
+	logtest.AssertField(t, e, "context.data.list.0", pingJSON)
+	logtest.AssertField(t, e, "context.data.list.1", "text")
+}
+
+func TestProtoFieldsTruncated(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithProtoJSONMaxBytes(16),
+	))
+	logger.WithField("request", &pb_testproto.PingRequest{
+		Value: strings.Repeat("x", 100),
+	}).Info("received")
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	logtest.AssertField(t, e, "context.data.request", `{"value":"xxxxxx...[truncated]`)
+}
+
+func TestWithoutProtoJSON(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithoutProtoJSON(),
+	))
+	logger.WithField("field", &typepb.Field{Kind: typepb.Field_TYPE_STRING}).Info("received")
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	logtest.AssertField(t, e, "context.data.field.kind", float64(typepb.Field_TYPE_STRING))
+}
+
+// protoJSONValue decodes the protojson of m to compare with recorded fields
+func protoJSONValue(t *testing.T, m proto.Message) interface{} {
+	t.Helper()
+	b, err := protojson.Marshal(m)
+	require.NoError(t, err)
+	var v interface{}
+	require.NoError(t, json.Unmarshal(b, &v))
+	return v
+}
@@ -0,0 +1,57 @@
+package logadapter
+
+import (
+	"context"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/requestlog"
+)
+
+// HTTPRequestFromContext returns the HTTPRequest the httpmw logging middleware
+// logs in the summary of the request of ctx, or nil outside of the
+// middleware. Handlers may amend it, such as to set CacheHit, or to correct the
+// ResponseSize of a streamed download, which the middleware then keeps.
+//
+// The HTTPRequest is not synchronized: it must only be modified by the
+// goroutine of the handler, or before the handler returns otherwise, and not
+// after, as the middleware then logs it.
+func HTTPRequestFromContext(ctx context.Context) *HTTPRequest {
+	req, _ := ctxlogrus.Extract(ctx).Data[requestlog.KeyHTTPRequest].(*HTTPRequest)
+	return req
+}
+
+// GRPCRequestFromContext returns the GRPCRequest the grpcmw logging
+// middleware, or the httpmw middleware serving gRPC-Web, logs for the RPC of
+// ctx, or nil outside of the middleware. It may be amended as the
+// HTTPRequest of HTTPRequestFromContext.
+func GRPCRequestFromContext(ctx context.Context) *GRPCRequest {
+	req, _ := ctxlogrus.Extract(ctx).Data[requestlog.KeyGRPCRequest].(*GRPCRequest)
+	return req
+}
+
+// KeyClaims is the field of the claims of the client of a request, set with
+// SetRequestIdentity
+const KeyClaims = middleware.KeyClaims
+
+// SetRequestIdentity records the identity of the client of the request of
+// ctx, once authenticated, logged as the user of the entries of the request
+// from then on, including the summary of the request logged by the httpmw or
+// grpcmw logging middleware, along with the claims it was authenticated with
+// as a claims field. It lets authentication run within the logging middleware,
+// such as an interceptor validating per-RPC credentials, and takes precedence
+// over the user of a UserExtractor. It does nothing outside of the middleware.
+func SetRequestIdentity(ctx context.Context, identity string, claims map[string]string) {
+	middleware.SetRequestIdentity(ctx, identity, claims)
+}
+
+// SetCacheStatus records whether the response to the HTTP request of ctx was
+// looked up in a cache, and whether it was served from it, in the httpRequest
+// logged by the httpmw logging middleware. It does nothing outside of the
+// middleware.
+func SetCacheStatus(ctx context.Context, lookup, hit bool) {
+	if req := HTTPRequestFromContext(ctx); req != nil {
+		req.CacheLookup = lookup
+		req.CacheHit = hit
+	}
+}
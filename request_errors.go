@@ -0,0 +1,51 @@
+package logadapter
+
+import (
+	"context"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/internal/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// KeyRequestErrors lists the errors recorded with AddRequestError in the
+// summary of a request, as objects with a message, fields and elapsedAtMs
+const KeyRequestErrors = middleware.KeyRequestErrors
+
+// AddRequestError records a non-fatal error met while handling a request, to
+// be listed in the summary logged by the logging middleware at the end of the
+// request, rather than logged on its own. The summary is logged at WARNING
+// when errors were recorded, or at ERROR when the request also failed.
+//
+// It is safe to call from the goroutines of a request. Only the first 20
+// errors are listed by default, and the others counted as
+// requestErrorsDropped. Outside of the middleware, errors are ignored.
+func AddRequestError(ctx context.Context, err error, fields ...logrus.Fields) {
+	var data logrus.Fields
+	if len(fields) == 1 {
+		data = fields[0]
+	} else if len(fields) > 1 {
+		data = logrus.Fields{}
+		for _, f := range fields {
+			for k, v := range f {
+				data[k] = v
+			}
+		}
+	}
+	middleware.AddRequestError(ctx, err, data)
+}
+
+// SetRequestError records the error that failed a request, replacing any
+// recorded before. When the logging middleware is configured WithErrorSummary,
+// the summary of the failed request is logged at ERROR with the error, as the
+// single error event of the request. Outside of the middleware, the error is
+// ignored.
+func SetRequestError(ctx context.Context, err error) {
+	middleware.SetRequestError(ctx, err)
+}
+
+// MarkRequestErrorHandled records that the handler already logged the error
+// of a request, so that the logging middleware doesn't report it again in the
+// summary of the request.
+func MarkRequestErrorHandled(ctx context.Context) {
+	middleware.MarkRequestErrorHandled(ctx)
+}
@@ -0,0 +1,113 @@
+package logadapter
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ReservedKeyPolicy selects how fields named like the keys of entries, such as
+// message or severity, are logged in their context data, where log viewers and
+// pipelines may mistake them for those of the entry.
+type ReservedKeyPolicy int
+
+const (
+	// RenameReservedKeys logs the fields under their name with a prefix,
+	// "data_" unless configured WithReservedKeyPrefix, such as data_message
+	RenameReservedKeys ReservedKeyPolicy = iota
+	// DropReservedKeys drops the fields
+	DropReservedKeys
+	// AllowReservedKeys logs the fields under their name
+	AllowReservedKeys
+)
+
+// DefaultReservedKeyPrefix is prepended to the fields named like the keys of
+// entries, WithReservedKeyPolicy(RenameReservedKeys)
+const DefaultReservedKeyPrefix = "data_"
+
+// ReservedKeys are the keys of entries, including the short names of the
+// logging.googleapis.com keys, which fields left in the data of entries are
+// renamed from, unless handled by the formatter, such as httpRequest fields.
+var ReservedKeys = []string{
+	"@type",
+	"logName",
+	"timestamp",
+	"time",
+	"resource",
+	"serviceContext",
+	"message",
+	"msg",
+	"severity",
+	"context",
+	"stack_trace",
+	"httpRequest",
+	"sourceLocation",
+	"trace",
+	"spanId",
+	"trace_sampled",
+	"labels",
+	"operation",
+	"logSchema",
+	"logging.googleapis.com/sourceLocation",
+	"logging.googleapis.com/trace",
+	"logging.googleapis.com/spanId",
+	"logging.googleapis.com/trace_sampled",
+	"logging.googleapis.com/labels",
+	"logging.googleapis.com/operation",
+}
+
+var reservedKeys = func() map[string]bool {
+	keys := make(map[string]bool, len(ReservedKeys))
+	for _, k := range ReservedKeys {
+		keys[k] = true
+	}
+	return keys
+}()
+
+// reserveKeys applies the ReservedKeyPolicy to the fields of data named like
+// the keys of entries
+func (f *Formatter) reserveKeys(data map[string]interface{}) {
+	if f.ReservedKeyPolicy == AllowReservedKeys {
+		return
+	}
+	var reserved []string
+	for k := range data {
+		if reservedKeys[k] {
+			reserved = append(reserved, k)
+		}
+	}
+	// renamed in order, for the same fields to be renamed the same way
+	sort.Strings(reserved)
+	for _, k := range reserved {
+		v := data[k]
+		delete(data, k)
+		if f.ReservedKeyPolicy != RenameReservedKeys {
+			continue
+		}
+		// a field may already have the renamed name
+		renamed := f.reservedKeyPrefix() + k
+		for _, ok := data[renamed]; ok; _, ok = data[renamed] {
+			renamed = f.reservedKeyPrefix() + renamed
+		}
+		data[renamed] = v
+	}
+}
+
+func (f *Formatter) reservedKeyPrefix() string {
+	if f.ReservedKeyPrefix == "" {
+		return DefaultReservedKeyPrefix
+	}
+	return f.ReservedKeyPrefix
+}
+
+func reservedKeyPolicyName(p ReservedKeyPolicy) string {
+	switch p {
+	case RenameReservedKeys:
+		return "rename"
+	case DropReservedKeys:
+		return "drop"
+	case AllowReservedKeys:
+		return "allow"
+	default:
+		return fmt.Sprintf("ReservedKeyPolicy(%d)", int(p))
+	}
+}
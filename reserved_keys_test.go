@@ -0,0 +1,91 @@
+package logadapter_test
+
+import (
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reservedFields are fields named like each of the keys of entries
+func reservedFields() logrus.Fields {
+	fields := logrus.Fields{"orderID": "ord-42"}
+	for _, k := range logadapter.ReservedKeys {
+		fields[k] = "shadow " + k
+	}
+	return fields
+}
+
+func TestReservedKeyPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []logadapter.Option
+		rename func(k string) string
+	}{
+		{"default", nil, func(k string) string { return "data_" + k }},
+		{"rename", []logadapter.Option{
+			logadapter.WithReservedKeyPolicy(logadapter.RenameReservedKeys),
+			logadapter.WithReservedKeyPrefix("user."),
+		}, func(k string) string { return "user." + k }},
+		{"drop", []logadapter.Option{
+			logadapter.WithReservedKeyPolicy(logadapter.DropReservedKeys),
+		}, nil},
+		{"allow", []logadapter.Option{
+			logadapter.WithReservedKeyPolicy(logadapter.AllowReservedKeys),
+		}, func(k string) string { return k }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(tt.opts...))
+			logger.WithFields(reservedFields()).Info("order placed")
+
+			e, ok := rec.LastEntry()
+			require.True(t, ok)
+			assert.Equal(t, "order placed", e.Message)
+			assert.Equal(t, logadapter.SeverityInfo, e.Severity)
+			require.NotNil(t, e.Context)
+
+			want := map[string]interface{}{"orderID": "ord-42"}
+			if tt.rename != nil {
+				for _, k := range logadapter.ReservedKeys {
+					want[tt.rename(k)] = "shadow " + k
+				}
+			}
+			assert.Equal(t, want, e.Context.Data)
+		})
+	}
+}
+
+func TestReservedKeyRenameCollision(t *testing.T) {
+	logger, rec := logtest.NewRecorder()
+	logger.WithFields(logrus.Fields{
+		"message":      "structured",
+		"data_message": "already renamed",
+	}).Info("order placed")
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, "order placed", e.Message)
+	assert.Equal(t, map[string]interface{}{
+		"data_message":      "already renamed",
+		"data_data_message": "structured",
+	}, e.Context.Data, "renamed fields don't replace others")
+}
+
+func TestReservedKeysHandled(t *testing.T) {
+	logger, rec := logtest.NewRecorder()
+	logger.WithFields(logrus.Fields{
+		logadapter.KeyTrace:       "4bf92f3577b34da6a3ce929d0e0e4736",
+		logadapter.KeyHTTPRequest: &logadapter.HTTPRequest{RequestMethod: "GET"},
+	}).Info("order placed")
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, "projects/test-project/traces/4bf92f3577b34da6a3ce929d0e0e4736", e.Trace)
+	require.NotNil(t, e.Context)
+	assert.Empty(t, e.Context.Data, "fields handled by the formatter aren't renamed")
+	assert.NotNil(t, e.Context.HTTPRequest)
+}
@@ -0,0 +1,312 @@
+package logadapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// KeyWriteErrors is the number of writes to the primary of a ResilientWriter
+// that failed, in the context of its notices.
+const KeyWriteErrors = "writeErrors"
+
+// rotationCheckInterval is how often a ResilientWriter with a reopen path
+// checks whether the file at the path is still the one it writes to
+const rotationCheckInterval = time.Second
+
+// WriteErrorRecorder receives counts of the writes to the primary of a
+// ResilientWriter that failed. A MetricsRecorder may implement it too.
+type WriteErrorRecorder interface {
+	IncWriteErrors()
+}
+
+// ResilientWriter writes formatted entries to a primary writer, such as a log
+// file or the pipe of a logging agent, and to a fallback writer while the
+// primary fails, so that logrus doesn't print "Failed to write to log" to
+// stderr for every entry.
+//
+// Once consecutive writes to the primary fail, it writes a single entry
+// explaining why to the fallback, then probes the primary with the entries
+// written after exponentially increasing delays, reminding that the primary
+// is still failing at most once per delay. Once a probe succeeds, it writes
+// an entry telling so to the primary, and writes to it again. Entries written
+// while the primary fails are written to the fallback instead.
+type ResilientWriter struct {
+	// counters are accessed atomically, first for 64-bit alignment
+	errors         uint64
+	fallbackWrites uint64
+
+	primary    io.Writer
+	fallback   io.Writer
+	threshold  int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	reopenPath string
+	metrics    WriteErrorRecorder
+	now        func() time.Time
+
+	mu          sync.Mutex
+	consecutive int
+	failedOver  bool
+	failedAt    time.Time
+	backoff     time.Duration
+	nextProbe   time.Time
+	lastNotice  time.Time
+	reopened    *os.File
+	nextCheck   time.Time
+}
+
+// ResilientWriterOption lets you configure the ResilientWriter.
+type ResilientWriterOption func(*ResilientWriter)
+
+// WithFailoverThreshold switches to the fallback after n consecutive writes
+// to the primary failed. Defaults to 3.
+func WithFailoverThreshold(n int) ResilientWriterOption {
+	return func(w *ResilientWriter) {
+		if n < 1 {
+			n = 1
+		}
+		w.threshold = n
+	}
+}
+
+// WithProbeBackoff probes the primary minDelay after switching to the
+// fallback, doubling the delay after each failed probe up to maxDelay.
+// Defaults to 1 second and 1 minute.
+func WithProbeBackoff(minDelay, maxDelay time.Duration) ResilientWriterOption {
+	return func(w *ResilientWriter) {
+		if maxDelay < minDelay {
+			maxDelay = minDelay
+		}
+		w.minBackoff, w.maxBackoff = minDelay, maxDelay
+	}
+}
+
+// WithReopenPath reopens the file at path, creating it if need be, as the
+// primary when writing to it fails because it was removed or its pipe is
+// broken, or when the primary file is no longer the file at path, checked at
+// most once per second, such as once renamed by logrotate.
+func WithReopenPath(path string) ResilientWriterOption {
+	return func(w *ResilientWriter) {
+		w.reopenPath = path
+	}
+}
+
+// WithWriteErrorMetrics counts the writes to the primary that failed.
+func WithWriteErrorMetrics(m WriteErrorRecorder) ResilientWriterOption {
+	return func(w *ResilientWriter) {
+		w.metrics = m
+	}
+}
+
+// NewResilientWriter returns a ResilientWriter writing to primary, and to
+// fallback while primary fails. A nil fallback is os.Stderr.
+func NewResilientWriter(
+	primary, fallback io.Writer,
+	opts ...ResilientWriterOption,
+) *ResilientWriter {
+	if fallback == nil {
+		fallback = os.Stderr
+	}
+	w := &ResilientWriter{
+		primary:    primary,
+		fallback:   fallback,
+		threshold:  3,
+		minBackoff: time.Second,
+		maxBackoff: time.Minute,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Write writes p to the primary, or to the fallback while the primary fails.
+func (w *ResilientWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.now()
+	if w.reopenPath != "" && !now.Before(w.nextCheck) {
+		w.nextCheck = now.Add(rotationCheckInterval)
+		w.reopenRotated()
+	}
+
+	if w.failedOver {
+		if now.Before(w.nextProbe) {
+			return w.writeFallback(p)
+		}
+		n, err := w.writePrimary(p)
+		if err == nil {
+			w.recovered(now)
+			return n, nil
+		}
+		// remind once per delay elapsed, before backing off further
+		delay := w.backoff
+		w.backoff *= 2
+		if w.backoff > w.maxBackoff {
+			w.backoff = w.maxBackoff
+		}
+		w.nextProbe = now.Add(w.backoff)
+		if now.Sub(w.lastNotice) >= delay {
+			w.notice(w.fallback, now, SeverityWarning,
+				fmt.Sprintf("log output still failing after %s: %v",
+					now.Sub(w.failedAt).Round(time.Second), err))
+		}
+		return w.writeFallback(p)
+	}
+
+	n, err := w.writePrimary(p)
+	if err == nil {
+		w.consecutive = 0
+		return n, nil
+	}
+	w.consecutive++
+	if w.consecutive >= w.threshold {
+		w.failedOver = true
+		w.failedAt = now
+		w.backoff = w.minBackoff
+		w.nextProbe = now.Add(w.backoff)
+		w.notice(w.fallback, now, SeverityWarning,
+			fmt.Sprintf("log output failing, writing logs here until it recovers: %v", err))
+	}
+	// the entry isn't lost, whether or not switched to the fallback yet
+	return w.writeFallback(p)
+}
+
+// writePrimary writes p to the primary, counting failures. The primary is
+// reopened, if configured to, and written once more.
+func (w *ResilientWriter) writePrimary(p []byte) (int, error) {
+	n, err := w.primary.Write(p)
+	if err == nil {
+		return n, nil
+	}
+	w.countError()
+	if w.reopenPath == "" || !isReopenable(err) {
+		return n, err
+	}
+	if rerr := w.reopen(); rerr != nil {
+		return n, err
+	}
+	n, err = w.primary.Write(p)
+	if err != nil {
+		w.countError()
+	}
+	return n, err
+}
+
+func (w *ResilientWriter) countError() {
+	atomic.AddUint64(&w.errors, 1)
+	if w.metrics != nil {
+		w.metrics.IncWriteErrors()
+	}
+}
+
+// isReopenable reports whether writing to a file failed because it was
+// removed or closed, or its pipe is broken
+func isReopenable(err error) bool {
+	return errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, os.ErrClosed)
+}
+
+// reopen opens the file at the reopen path as the primary, closing the file
+// it previously reopened
+func (w *ResilientWriter) reopen() error {
+	f, err := os.OpenFile(w.reopenPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if w.reopened != nil {
+		_ = w.reopened.Close()
+	}
+	w.primary, w.reopened = f, f
+	return nil
+}
+
+// reopenRotated reopens the file at the reopen path as the primary if the
+// primary is a file that was renamed or removed since, as writing to it
+// would keep succeeding
+func (w *ResilientWriter) reopenRotated() {
+	f, ok := w.primary.(*os.File)
+	if !ok {
+		return
+	}
+	open, err := f.Stat()
+	if err != nil {
+		return
+	}
+	current, err := os.Stat(w.reopenPath)
+	if err == nil && os.SameFile(open, current) {
+		return
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	_ = w.reopen()
+}
+
+func (w *ResilientWriter) writeFallback(p []byte) (int, error) {
+	atomic.AddUint64(&w.fallbackWrites, 1)
+	return w.fallback.Write(p)
+}
+
+// recovered writes to the primary again, telling so in it
+func (w *ResilientWriter) recovered(now time.Time) {
+	w.notice(w.primary, now, SeverityNotice,
+		fmt.Sprintf("log output recovered after %s, some logs were written to the fallback",
+			now.Sub(w.failedAt).Round(time.Second)))
+	w.failedOver = false
+	w.consecutive = 0
+}
+
+// notice writes an entry about the writer itself to out
+func (w *ResilientWriter) notice(out io.Writer, now time.Time, severity Severity, msg string) {
+	w.lastNotice = now
+	b, err := json.Marshal(Entry{
+		Timestamp: now.UTC().Format(time.RFC3339Nano),
+		Severity:  severity,
+		Message:   msg,
+		Context: &Context{
+			Data: map[string]interface{}{KeyWriteErrors: atomic.LoadUint64(&w.errors)},
+		},
+	})
+	if err != nil {
+		return
+	}
+	_, _ = out.Write(append(b, '\n'))
+}
+
+// Flush flushes the primary, if it is a Flusher such as an AsyncWriter.
+func (w *ResilientWriter) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	primary := w.primary
+	w.mu.Unlock()
+	if f, ok := primary.(Flusher); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
+// Errors returns the number of writes to the primary that failed.
+func (w *ResilientWriter) Errors() uint64 {
+	return atomic.LoadUint64(&w.errors)
+}
+
+// FallbackWrites returns the number of entries written to the fallback.
+func (w *ResilientWriter) FallbackWrites() uint64 {
+	return atomic.LoadUint64(&w.fallbackWrites)
+}
+
+// FailedOver reports whether the writer is writing to the fallback.
+func (w *ResilientWriter) FailedOver() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.failedOver
+}
@@ -0,0 +1,230 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedWriter fails its first failures writes, then recovers
+type scriptedWriter struct {
+	bytes.Buffer
+	failures int
+	err      error
+}
+
+func (w *scriptedWriter) Write(p []byte) (int, error) {
+	if w.failures > 0 {
+		w.failures--
+		return 0, w.err
+	}
+	return w.Buffer.Write(p)
+}
+
+type writeErrorCounter struct {
+	mu     sync.Mutex
+	errors int
+}
+
+func (c *writeErrorCounter) IncWriteErrors() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errors++
+}
+
+// messages returns the messages of the entries written to b
+func messages(t *testing.T, b *bytes.Buffer) []string {
+	var msgs []string
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var e logadapter.Entry
+		require.NoError(t, json.Unmarshal([]byte(line), &e), line)
+		msgs = append(msgs, e.Message)
+	}
+	return msgs
+}
+
+func TestResilientWriter(t *testing.T) {
+	primary := &scriptedWriter{failures: 6, err: syscall.EPIPE}
+	var fallback bytes.Buffer
+	metrics := &writeErrorCounter{}
+	w := logadapter.NewResilientWriter(primary, &fallback,
+		logadapter.WithFailoverThreshold(3),
+		logadapter.WithProbeBackoff(time.Second, 4*time.Second),
+		logadapter.WithWriteErrorMetrics(metrics),
+	)
+	start := time.Date(2021, 6, 1, 14, 3, 7, 0, time.UTC)
+	now := start
+	w.SetClock(func() time.Time { return now })
+
+	logger := logrus.New()
+	logger.Out = w
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+
+	// consecutive failures switch to the fallback
+	logger.Info("e1")
+	logger.Info("e2")
+	assert.False(t, w.FailedOver())
+	logger.Info("e3")
+	assert.True(t, w.FailedOver())
+	logger.Info("e4")
+	assert.Equal(t, 3, metrics.errors, "the primary isn't written before the probe")
+
+	// probes back off, reminding at most once per delay
+	for _, after := range []time.Duration{time.Second, 3 * time.Second, 7 * time.Second} {
+		now = start.Add(after)
+		logger.Info("probe at " + after.String())
+	}
+	assert.True(t, w.FailedOver())
+
+	now = start.Add(11 * time.Second)
+	logger.Info("recovered")
+	assert.False(t, w.FailedOver())
+	logger.Info("e5")
+
+	assert.Equal(t, []string{
+		"e1",
+		"e2",
+		"log output failing, writing logs here until it recovers: broken pipe",
+		"e3",
+		"e4",
+		"log output still failing after 1s: broken pipe",
+		"probe at 1s",
+		"log output still failing after 3s: broken pipe",
+		"probe at 3s",
+		"log output still failing after 7s: broken pipe",
+		"probe at 7s",
+	}, messages(t, &fallback))
+	assert.Equal(t, []string{
+		"recovered",
+		"log output recovered after 11s, some logs were written to the fallback",
+		"e5",
+	}, messages(t, &primary.Buffer))
+
+	assert.Equal(t, uint64(6), w.Errors())
+	assert.Equal(t, 6, metrics.errors)
+	assert.Equal(t, uint64(7), w.FallbackWrites())
+}
+
+func TestResilientWriterDefaultBackoff(t *testing.T) {
+	primary := &scriptedWriter{failures: 100, err: syscall.EPIPE}
+	var fallback bytes.Buffer
+	w := logadapter.NewResilientWriter(primary, &fallback, logadapter.WithFailoverThreshold(1))
+	start := time.Date(2021, 6, 1, 14, 3, 7, 0, time.UTC)
+	now := start
+	w.SetClock(func() time.Time { return now })
+
+	_, err := w.Write([]byte(`{"message":"e1"}` + "\n"))
+	require.NoError(t, err)
+	// probes at 1s, 3s, 7s, 15s, 31s, 63s, then every minute, with writes in
+	// between that don't probe
+	want := []string{
+		"log output failing, writing logs here until it recovers: broken pipe",
+		"e1",
+	}
+	for _, after := range []time.Duration{
+		time.Second, 2 * time.Second, 3 * time.Second, 7 * time.Second, 15 * time.Second,
+		31 * time.Second, 40 * time.Second, 63 * time.Second, 123 * time.Second,
+	} {
+		now = start.Add(after)
+		msg := "at " + after.String()
+		_, err := w.Write([]byte(`{"message":"` + msg + `"}` + "\n"))
+		require.NoError(t, err)
+		if after != 2*time.Second && after != 40*time.Second {
+			want = append(want, "log output still failing after "+after.String()+": broken pipe")
+		}
+		want = append(want, msg)
+	}
+	assert.Equal(t, want, messages(t, &fallback))
+	assert.Equal(t, uint64(8), w.Errors(), "only the first write and the probes fail")
+}
+
+func TestResilientWriterRecoversBeforeThreshold(t *testing.T) {
+	primary := &scriptedWriter{failures: 2, err: syscall.ENOSPC}
+	var fallback bytes.Buffer
+	w := logadapter.NewResilientWriter(primary, &fallback)
+
+	for _, msg := range []string{"e1", "e2", "e3", "e4"} {
+		_, err := w.Write([]byte(`{"message":"` + msg + `"}` + "\n"))
+		require.NoError(t, err)
+	}
+	assert.False(t, w.FailedOver())
+	assert.Equal(t, []string{"e1", "e2"}, messages(t, &fallback), "no entry is lost")
+	assert.Equal(t, []string{"e3", "e4"}, messages(t, &primary.Buffer))
+}
+
+func TestResilientWriterReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	require.NoError(t, err)
+
+	var fallback bytes.Buffer
+	w := logadapter.NewResilientWriter(f, &fallback, logadapter.WithReopenPath(path))
+	_, err = w.Write([]byte(`{"message":"before"}` + "\n"))
+	require.NoError(t, err)
+
+	// rotated, with the file of the writer closed
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, f.Close())
+	_, err = w.Write([]byte(`{"message":"after"}` + "\n"))
+	require.NoError(t, err)
+
+	rotated, err := ioutil.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"before"}, messages(t, bytes.NewBuffer(rotated)))
+	reopened, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"after"}, messages(t, bytes.NewBuffer(reopened)))
+	assert.Equal(t, uint64(1), w.Errors())
+	assert.Empty(t, fallback.String())
+}
+
+func TestResilientWriterReopenRenamed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var fallback bytes.Buffer
+	w := logadapter.NewResilientWriter(f, &fallback, logadapter.WithReopenPath(path))
+	now := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+	w.SetClock(func() time.Time { return now })
+	_, err = w.Write([]byte(`{"message":"before"}` + "\n"))
+	require.NoError(t, err)
+
+	// rotated by renaming, the file of the writer still open
+	require.NoError(t, os.Rename(path, path+".1"))
+	now = now.Add(500 * time.Millisecond)
+	_, err = w.Write([]byte(`{"message":"unchecked"}` + "\n"))
+	require.NoError(t, err)
+	now = now.Add(500 * time.Millisecond)
+	_, err = w.Write([]byte(`{"message":"after"}` + "\n"))
+	require.NoError(t, err)
+
+	rotated, err := ioutil.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"before", "unchecked"}, messages(t, bytes.NewBuffer(rotated)),
+		"checked at most once per second")
+	reopened, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"after"}, messages(t, bytes.NewBuffer(reopened)))
+	assert.Zero(t, w.Errors())
+	assert.Empty(t, fallback.String())
+}
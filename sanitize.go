@@ -0,0 +1,137 @@
+package logadapter
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxConsecutiveNewlines caps runs of newlines in sanitized strings, leaving
+// at most one blank line
+const maxConsecutiveNewlines = 2
+
+// sanitizeData sanitizes the strings in the data of an entry, which has been
+// copied by replaceErrors, so that nested maps and slices may be modified
+func (f *Formatter) sanitizeData(data logrus.Fields) {
+	for k, v := range data {
+		data[k] = f.sanitizeValue(v)
+	}
+}
+
+func (f *Formatter) sanitizeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return sanitize(v, f.StripANSI)
+	case logrus.Fields:
+		f.sanitizeData(v)
+	case map[string]interface{}:
+		f.sanitizeData(v)
+	case []interface{}:
+		for i, e := range v {
+			v[i] = f.sanitizeValue(e)
+		}
+	case []string:
+		// not copied by replaceErrors, so only replaced if unclean
+		for i, s := range v {
+			if clean := sanitize(s, f.StripANSI); clean != s {
+				c := make([]string, len(v))
+				copy(c, v[:i])
+				for j := i; j < len(v); j++ {
+					c[j] = sanitize(v[j], f.StripANSI)
+				}
+				return c
+			}
+		}
+	}
+	return v
+}
+
+// sanitize removes the C0 control characters of s, other than newlines and
+// tabs, caps runs of newlines, and, if stripANSI, removes ANSI escape
+// sequences. Clean strings are returned without allocating.
+func sanitize(s string, stripANSI bool) string {
+	if isSanitized(s) {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	newlines := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\n' {
+			newlines++
+			if newlines <= maxConsecutiveNewlines {
+				b.WriteByte(c)
+			}
+			continue
+		}
+		if c == '\x1b' && stripANSI {
+			i += ansiSequenceLen(s[i:]) - 1
+			continue
+		}
+		if c < 0x20 && c != '\t' {
+			continue
+		}
+		newlines = 0
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// isSanitized reports whether s has no control characters to remove nor
+// runs of newlines to cap
+func isSanitized(s string) bool {
+	newlines := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\n':
+			newlines++
+			if newlines > maxConsecutiveNewlines {
+				return false
+			}
+		case c < 0x20 && c != '\t':
+			return false
+		default:
+			newlines = 0
+		}
+	}
+	return true
+}
+
+// ansiSequenceLen returns the length of the ANSI escape sequence s starts
+// with, or 1 for a lone escape
+func ansiSequenceLen(s string) int {
+	if len(s) < 2 {
+		return len(s)
+	}
+	switch s[1] {
+	case '[':
+		// CSI: parameter and intermediate bytes, then a final byte
+		for i := 2; i < len(s); i++ {
+			if s[i] >= 0x40 && s[i] <= 0x7e {
+				return i + 1
+			}
+			if s[i] < 0x20 || s[i] > 0x7e {
+				return i
+			}
+		}
+		return len(s)
+	case ']':
+		// OSC: terminated by BEL or ST
+		for i := 2; i < len(s); i++ {
+			if s[i] == '\a' {
+				return i + 1
+			}
+			if s[i] == '\x1b' && i+1 < len(s) && s[i+1] == '\\' {
+				return i + 2
+			}
+		}
+		return len(s)
+	default:
+		if s[1] >= 0x40 && s[1] <= 0x5f {
+			return 2
+		}
+		return 1
+	}
+}
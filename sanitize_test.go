@@ -0,0 +1,85 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"unicode/utf8"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitize(t *testing.T) {
+	for _, tcase := range []struct {
+		name      string
+		in        string
+		stripANSI bool
+		want      string
+	}{
+		{name: "clean", in: "order placed\n\tby u-42", want: "order placed\n\tby u-42"},
+		{name: "NUL", in: "order\x00 placed\r\n", want: "order placed\n"},
+		{name: "newlines", in: "order\n\n\n\n\r\nplaced", want: "order\n\nplaced"},
+		{name: "ANSI", in: "\x1b[1;31mfailed\x1b[0m", want: "[1;31mfailed[0m"},
+		{
+			name:      "ANSI stripped",
+			in:        "\x1b[1;31mfailed\x1b[0m \x1b]0;title\a\x1b(B\x1b",
+			stripANSI: true,
+			want:      "failed (B",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			assert.Equal(t, tcase.want, logadapter.Sanitize(tcase.in, tcase.stripANSI))
+		})
+	}
+}
+
+func TestSanitizeClean(t *testing.T) {
+	clean := "panic: out of stock\n\ngoroutine 1 [running]:\n\tmain.go:12"
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = logadapter.Sanitize(clean, true)
+	})
+	assert.Zero(t, allocs, "clean strings are not copied")
+}
+
+func TestSanitizeEntry(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithANSIStripping(),
+	))
+	tags := []string{"gift\x00", "express"}
+	logger.
+		WithField("output", "\x1b[32mok\x1b[0m\x07").
+		WithField("payload", "caf\xe2\x82").
+		WithField("nested", map[string]interface{}{"line": "a\x00b"}).
+		WithField("tags", tags).
+		WithField(logadapter.KeyStackTrace, "goroutine 1\x00 [running]:\n\n\n\nmain.main()").
+		Error("payment\x00 failed")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(bytes.TrimSpace([]byte(rec.String())), &got))
+	assert.Equal(t, "payment failed\ngoroutine 1 [running]:\n\nmain.main()", got["message"])
+	data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+	assert.Equal(t, "ok", data["output"])
+	payload := data["payload"].(string)
+	assert.True(t, utf8.ValidString(payload))
+	assert.Equal(t, "caf\ufffd\ufffd", payload, "invalid UTF-8 is replaced")
+	assert.Equal(t, map[string]interface{}{"line": "ab"}, data["nested"])
+	assert.Equal(t, []interface{}{"gift", "express"}, data["tags"])
+	assert.Equal(t, "gift\x00", tags[0], "fields are not modified")
+}
+
+func TestSanitizeStackTrace(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithStackTraceStyle(logadapter.TraceInPayload),
+	))
+	logger.WithFields(logrus.Fields{
+		logadapter.KeyStackTrace: "goroutine 1 [running]:\x1b\nmain.main()",
+	}).Error("payment failed")
+
+	entry, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, "payment failed\ngoroutine 1 [running]:\nmain.main()", entry.StackTrace)
+}
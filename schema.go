@@ -0,0 +1,83 @@
+package logadapter
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// CurrentSchemaVersion is the version of the shape of the entries formatted,
+// logged as their logSchema WithSchemaVersion. It is bumped when the shape of
+// entries changes, such as when fields are renamed or change type, and
+// UpgradeEntry then upgrades entries of earlier versions.
+//
+//   - v1 is the shape of earlier forks: the source location under
+//     sourceLocation, the message under msg, the httpRequest status as a
+//     number, and fields named like the keys of entries in context.data
+//   - v2 is the current shape
+const CurrentSchemaVersion = "v2"
+
+// KeyLogSchema is the key of the schema version of entries
+const KeyLogSchema = "logSchema"
+
+// schemaUpgrades upgrade entries of each version to the next one, in order
+var schemaUpgrades = []struct {
+	from    string
+	upgrade func(e map[string]interface{})
+}{
+	{"v1", upgradeV1},
+}
+
+// UpgradeEntry converts an entry decoded from JSON, formatted in the shape of
+// the schema version fromVersion, to the shape of CurrentSchemaVersion, for
+// pipelines to read entries of services logging with different versions of
+// this package alike. The entry is copied rather than modified, and its
+// logSchema set to CurrentSchemaVersion. Entries logged without a logSchema
+// are of v1 if logged by earlier forks.
+func UpgradeEntry(raw map[string]interface{}, fromVersion string) (map[string]interface{}, error) {
+	start := len(schemaUpgrades)
+	for i, u := range schemaUpgrades {
+		if u.from == fromVersion {
+			start = i
+			break
+		}
+	}
+	if start == len(schemaUpgrades) && fromVersion != CurrentSchemaVersion {
+		return nil, fmt.Errorf("logadapter: unknown log schema version %q", fromVersion)
+	}
+
+	e := copyValue(raw).(map[string]interface{})
+	for _, u := range schemaUpgrades[start:] {
+		u.upgrade(e)
+	}
+	e[KeyLogSchema] = CurrentSchemaVersion
+	return e, nil
+}
+
+// upgradeV1 moves the legacy source location and message to their keys,
+// unless also logged under them WithLegacyFieldNames, writes the status of
+// requests as a string, and renames fields named like the keys of entries
+func upgradeV1(e map[string]interface{}) {
+	for legacy, key := range map[string]string{
+		"sourceLocation": "logging.googleapis.com/sourceLocation",
+		"msg":            "message",
+	} {
+		if v, ok := e[legacy]; ok {
+			if _, ok := e[key]; !ok {
+				e[key] = v
+			}
+			delete(e, legacy)
+		}
+	}
+
+	if req, ok := e["httpRequest"].(map[string]interface{}); ok {
+		if status, ok := req["status"].(float64); ok {
+			req["status"] = strconv.FormatFloat(status, 'f', -1, 64)
+		}
+	}
+
+	if c, ok := e["context"].(map[string]interface{}); ok {
+		if data, ok := c["data"].(map[string]interface{}); ok {
+			(&Formatter{}).reserveKeys(data)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package logadapter_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaVersion(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithSchemaVersion(logadapter.CurrentSchemaVersion),
+	))
+	logger.Info("order placed")
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, logadapter.CurrentSchemaVersion, e.LogSchema)
+
+	logger, rec = logtest.NewRecorder()
+	logger.Info("order placed")
+	e, ok = rec.LastEntry()
+	require.True(t, ok)
+	assert.Empty(t, e.LogSchema)
+}
+
+func TestUpgradeEntry(t *testing.T) {
+	location := map[string]interface{}{
+		"file":     "orders/handler.go",
+		"line":     float64(42),
+		"function": "orders.Place",
+	}
+	tests := []struct {
+		name    string
+		version string
+		entry   string
+		want    map[string]interface{}
+	}{
+		{
+			name:    "v1",
+			version: "v1",
+			entry: `{
+				"severity": "INFO",
+				"msg": "served HTTP GET /orders/42",
+				"sourceLocation": {
+					"file": "orders/handler.go", "line": 42, "function": "orders.Place"
+				},
+				"httpRequest": {"requestMethod": "GET", "status": 200},
+				"context": {"data": {"orderID": "ord-42", "severity": "shadow"}}
+			}`,
+			want: map[string]interface{}{
+				"severity":                              "INFO",
+				"message":                               "served HTTP GET /orders/42",
+				"logging.googleapis.com/sourceLocation": location,
+				"httpRequest": map[string]interface{}{
+					"requestMethod": "GET",
+					"status":        "200",
+				},
+				"context": map[string]interface{}{"data": map[string]interface{}{
+					"orderID":       "ord-42",
+					"data_severity": "shadow",
+				}},
+				"logSchema": logadapter.CurrentSchemaVersion,
+			},
+		},
+		{
+			name:    "v1 with legacy duplicates",
+			version: "v1",
+			entry: `{
+				"severity": "INFO",
+				"message": "order placed",
+				"msg": "order placed",
+				"logging.googleapis.com/sourceLocation": {
+					"file": "orders/handler.go", "line": 42, "function": "orders.Place"
+				},
+				"sourceLocation": {
+					"file": "orders/handler.go", "line": 42, "function": "orders.Place"
+				}
+			}`,
+			want: map[string]interface{}{
+				"severity":                              "INFO",
+				"message":                               "order placed",
+				"logging.googleapis.com/sourceLocation": location,
+				"logSchema":                             logadapter.CurrentSchemaVersion,
+			},
+		},
+		{
+			name:    "current",
+			version: logadapter.CurrentSchemaVersion,
+			entry: `{
+				"severity": "INFO",
+				"message": "order placed",
+				"httpRequest": {"status": "200"},
+				"logSchema": "v2"
+			}`,
+			want: map[string]interface{}{
+				"severity":    "INFO",
+				"message":     "order placed",
+				"httpRequest": map[string]interface{}{"status": "200"},
+				"logSchema":   logadapter.CurrentSchemaVersion,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var raw map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(tt.entry), &raw))
+			before, err := json.Marshal(raw)
+			require.NoError(t, err)
+
+			got, err := logadapter.UpgradeEntry(raw, tt.version)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			b, err := json.Marshal(got)
+			require.NoError(t, err)
+			assert.NoError(t, logadapter.ValidateEntry(b))
+
+			after, err := json.Marshal(raw)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(before), string(after), "raw entry modified")
+		})
+	}
+}
+
+func TestUpgradeEntryUnknownVersion(t *testing.T) {
+	_, err := logadapter.UpgradeEntry(map[string]interface{}{}, "v0")
+	assert.EqualError(t, err, `logadapter: unknown log schema version "v0"`)
+}
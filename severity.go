@@ -0,0 +1,87 @@
+package logadapter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Severity is the LogSeverity of an entry as understood by GCP
+// https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#logseverity
+type Severity string
+
+// LogSeverity as understood by GCP, from the lowest to the highest
+const (
+	SeverityDefault   Severity = "DEFAULT"
+	SeverityDebug     Severity = "DEBUG"
+	SeverityInfo      Severity = "INFO"
+	SeverityNotice    Severity = "NOTICE"
+	SeverityWarning   Severity = "WARNING"
+	SeverityError     Severity = "ERROR"
+	SeverityCritical  Severity = "CRITICAL"
+	SeverityAlert     Severity = "ALERT"
+	SeverityEmergency Severity = "EMERGENCY"
+)
+
+// severityOrdinals are the numeric values of severities defined by GCP
+var severityOrdinals = map[Severity]int{
+	SeverityDefault:   0,
+	SeverityDebug:     100,
+	SeverityInfo:      200,
+	SeverityNotice:    300,
+	SeverityWarning:   400,
+	SeverityError:     500,
+	SeverityCritical:  600,
+	SeverityAlert:     700,
+	SeverityEmergency: 800,
+}
+
+var levelsToSeverity = map[logrus.Level]Severity{
+	logrus.DebugLevel: SeverityDebug,
+	logrus.InfoLevel:  SeverityInfo,
+	logrus.WarnLevel:  SeverityWarning,
+	logrus.ErrorLevel: SeverityError,
+	logrus.FatalLevel: SeverityCritical,
+	logrus.PanicLevel: SeverityAlert,
+	logrus.TraceLevel: SeverityDebug,
+}
+
+// SeverityFromLevel returns the severity entries logged at a logrus level are
+// written with, or SeverityDefault for unknown levels.
+func SeverityFromLevel(level logrus.Level) Severity {
+	s, ok := levelsToSeverity[level]
+	if !ok {
+		return SeverityDefault
+	}
+	return s
+}
+
+// ParseSeverity parses the name of a severity, in any case.
+func ParseSeverity(s string) (Severity, error) {
+	severity := Severity(strings.ToUpper(strings.TrimSpace(s)))
+	if _, ok := severityOrdinals[severity]; !ok {
+		return "", fmt.Errorf("logadapter: unknown severity %q", s)
+	}
+	return severity, nil
+}
+
+// String returns the name of the severity.
+func (s Severity) String() string {
+	return string(s)
+}
+
+// Ordinal returns the numeric value of the severity defined by GCP, from 0 for
+// DEFAULT to 800 for EMERGENCY, or -1 for unknown severities.
+func (s Severity) Ordinal() int {
+	n, ok := severityOrdinals[s]
+	if !ok {
+		return -1
+	}
+	return n
+}
+
+// AtLeast reports whether the severity is as high as other.
+func (s Severity) AtLeast(other Severity) bool {
+	return s.Ordinal() >= other.Ordinal()
+}
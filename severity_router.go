@@ -0,0 +1,98 @@
+package logadapter
+
+import (
+	"io"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var _ logrus.Hook = (*LevelWriterHook)(nil)
+
+// LevelWriterHook writes each entry to a writer chosen by its level, such as
+// errors to stderr and the rest to stdout. Entries are formatted with the
+// formatter of WithRouterFormatter, or else with the Formatter of their logger.
+//
+// The hook writes entries in place of the logger, so the output of the logger
+// must be discarded for each entry to be written exactly once. As logrus still
+// formats entries before discarding them, give the logger a DiscardFormatter
+// and the hook the formatter, so that each entry is formatted once, and counted
+// once by the Metrics of the formatter. Add it after any hooks adding fields to
+// entries, as hooks are fired in order:
+//
+//	logger.Out = ioutil.Discard
+//	logger.Formatter = logadapter.DiscardFormatter{}
+//	logger.AddHook(logadapter.NewSeverityRouter(map[logrus.Level]io.Writer{
+//		logrus.PanicLevel: os.Stderr,
+//		logrus.FatalLevel: os.Stderr,
+//		logrus.ErrorLevel: os.Stderr,
+//	}, os.Stdout, logadapter.WithRouterFormatter(formatter)))
+type LevelWriterHook struct {
+	mu        sync.Mutex
+	writers   map[logrus.Level]io.Writer
+	fallback  io.Writer
+	formatter logrus.Formatter
+}
+
+// SeverityRouterOption lets you configure the LevelWriterHook.
+type SeverityRouterOption func(*LevelWriterHook)
+
+// WithRouterFormatter formats entries with f rather than with the Formatter of
+// their logger.
+func WithRouterFormatter(f logrus.Formatter) SeverityRouterOption {
+	return func(h *LevelWriterHook) {
+		h.formatter = f
+	}
+}
+
+// DiscardFormatter formats entries as nothing, for a logger whose entries are
+// all written by hooks with their own formatters, such as a LevelWriterHook.
+type DiscardFormatter struct{}
+
+// Format returns no bytes.
+func (DiscardFormatter) Format(*logrus.Entry) ([]byte, error) {
+	return nil, nil
+}
+
+// NewSeverityRouter returns a LevelWriterHook writing entries to the writer
+// of their level in rules, or else to fallback.
+func NewSeverityRouter(
+	rules map[logrus.Level]io.Writer,
+	fallback io.Writer,
+	opts ...SeverityRouterOption,
+) *LevelWriterHook {
+	writers := make(map[logrus.Level]io.Writer, len(rules))
+	for level, w := range rules {
+		writers[level] = w
+	}
+	h := &LevelWriterHook{writers: writers, fallback: fallback}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *LevelWriterHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *LevelWriterHook) Fire(e *logrus.Entry) error {
+	formatter := h.formatter
+	if formatter == nil {
+		formatter = e.Logger.Formatter
+	}
+	b, err := formatter.Format(e)
+	if err != nil {
+		return err
+	}
+
+	w, ok := h.writers[e.Level]
+	if !ok {
+		w = h.fallback
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err = w.Write(b)
+	return err
+}
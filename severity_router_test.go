@@ -0,0 +1,79 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeverityRouter(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.Level = logrus.DebugLevel
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+	logger.AddHook(logadapter.NewSeverityRouter(map[logrus.Level]io.Writer{
+		logrus.PanicLevel: &stderr,
+		logrus.FatalLevel: &stderr,
+		logrus.ErrorLevel: &stderr,
+	}, &stdout))
+
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Warn("warning")
+	logger.Error("error")
+	assert.Panics(t, func() { logger.Panic("panic") })
+
+	messages := func(b *bytes.Buffer) map[string]string {
+		got := map[string]string{}
+		dec := json.NewDecoder(b)
+		for dec.More() {
+			var msg map[string]interface{}
+			require.NoError(t, dec.Decode(&msg))
+			got[msg["message"].(string)] = msg["severity"].(string)
+		}
+		return got
+	}
+
+	assert.Equal(t, map[string]string{
+		"debug":   "DEBUG",
+		"info":    "INFO",
+		"warning": "WARNING",
+	}, messages(&stdout))
+	assert.Equal(t, map[string]string{
+		"error": "ERROR",
+		"panic": "ALERT",
+	}, messages(&stderr), "each entry is written once, to the writer of its level")
+}
+
+func TestSeverityRouterFormatsOnce(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	metrics := &entryCounter{counts: map[string]int64{}}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.Formatter = logadapter.DiscardFormatter{}
+	logger.AddHook(logadapter.NewSeverityRouter(map[logrus.Level]io.Writer{
+		logrus.ErrorLevel: &stderr,
+	}, &stdout, logadapter.WithRouterFormatter(logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithMetrics(metrics),
+	))))
+
+	logger.Info("order placed")
+	logger.Error("payment failed")
+
+	assert.Equal(t, map[string]int64{"INFO": 1, "ERROR": 1}, metrics.EntryCounts(),
+		"each entry is formatted once")
+	assert.Contains(t, stdout.String(), `"message":"order placed"`)
+	assert.Contains(t, stderr.String(), `"message":"payment failed"`)
+}
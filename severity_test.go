@@ -0,0 +1,79 @@
+package logadapter_test
+
+import (
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ladder lists the severities from the lowest to the highest
+var ladder = []logadapter.Severity{
+	logadapter.SeverityDefault,
+	logadapter.SeverityDebug,
+	logadapter.SeverityInfo,
+	logadapter.SeverityNotice,
+	logadapter.SeverityWarning,
+	logadapter.SeverityError,
+	logadapter.SeverityCritical,
+	logadapter.SeverityAlert,
+	logadapter.SeverityEmergency,
+}
+
+func TestParseSeverity(t *testing.T) {
+	for input, want := range map[string]logadapter.Severity{
+		"DEFAULT":     logadapter.SeverityDefault,
+		"debug":       logadapter.SeverityDebug,
+		"Info":        logadapter.SeverityInfo,
+		"nOtIcE":      logadapter.SeverityNotice,
+		" warning\n":  logadapter.SeverityWarning,
+		"Error":       logadapter.SeverityError,
+		"critical":    logadapter.SeverityCritical,
+		"ALERT":       logadapter.SeverityAlert,
+		"Emergency":   logadapter.SeverityEmergency,
+		"EMERGENCY  ": logadapter.SeverityEmergency,
+	} {
+		got, err := logadapter.ParseSeverity(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+
+	for _, input := range []string{"", "warn", "fatal", "500"} {
+		_, err := logadapter.ParseSeverity(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestSeverityOrdering(t *testing.T) {
+	for i, s := range ladder {
+		assert.Equal(t, i*100, s.Ordinal(), s)
+		for j, other := range ladder {
+			assert.Equal(t, i >= j, s.AtLeast(other), "%v at least %v", s, other)
+		}
+	}
+	assert.Equal(t, -1, logadapter.Severity("VERBOSE").Ordinal())
+	assert.False(t, logadapter.Severity("VERBOSE").AtLeast(logadapter.SeverityDefault))
+}
+
+func TestSeverityFromLevel(t *testing.T) {
+	for level, want := range map[logrus.Level]logadapter.Severity{
+		logrus.TraceLevel: logadapter.SeverityDebug,
+		logrus.DebugLevel: logadapter.SeverityDebug,
+		logrus.InfoLevel:  logadapter.SeverityInfo,
+		logrus.WarnLevel:  logadapter.SeverityWarning,
+		logrus.ErrorLevel: logadapter.SeverityError,
+		logrus.FatalLevel: logadapter.SeverityCritical,
+		logrus.PanicLevel: logadapter.SeverityAlert,
+	} {
+		assert.Equal(t, want, logadapter.SeverityFromLevel(level), level)
+
+		e := logrus.NewEntry(logrus.New())
+		e.Level = level
+		ee, err := logadapter.NewFormatter().ToEntry(e)
+		require.NoError(t, err)
+		assert.Equal(t, want, ee.Severity, "entries use the mapping")
+	}
+	assert.Equal(t, logadapter.SeverityDefault, logadapter.SeverityFromLevel(logrus.Level(42)))
+}
@@ -0,0 +1,173 @@
+package logadapter
+
+import (
+	"encoding/json"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultSizeSampleRate is the share of entries measured WithSizeAttribution
+// when no valid rate is configured
+const DefaultSizeSampleRate = 0.01
+
+// maxSizeSummaryFields is the number of fields listed by a SizeAggregator
+const maxSizeSummaryFields = 10
+
+// SizeReport attributes the encoded size of an entry to its fields.
+type SizeReport struct {
+	// Total is the size of the entry in bytes
+	Total int
+	// PerField is the size of the value of each field, keyed by top-level
+	// field, such as "message", context field, such as "context.httpRequest",
+	// or context data key, such as "context.data.orderID"
+	PerField map[string]int
+	Severity string
+}
+
+// sampleSize reports whether the size of an entry is to be measured
+func (f *Formatter) sampleSize() bool {
+	rate := f.SizeSampleRate
+	if rate <= 0 || rate > 1 {
+		rate = DefaultSizeSampleRate
+	}
+	return rand.Float64() < rate
+}
+
+// reportSize measures the fields of an encoded entry for the SizeReporter
+func (f *Formatter) reportSize(b []byte, severity Severity) {
+	r := SizeReport{
+		Total:    len(b),
+		PerField: make(map[string]int),
+		Severity: string(severity),
+	}
+	attributeSize(r.PerField, "", b, map[string]bool{"context": true, "context.data": true})
+	f.SizeReporter(r)
+}
+
+// attributeSize records the size of the fields of a JSON object, recursing
+// into the objects to expand
+func attributeSize(sizes map[string]int, prefix string, b []byte, expand map[string]bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return
+	}
+	for k, v := range fields {
+		name := prefix + k
+		if expand[name] && len(v) > 0 && v[0] == '{' {
+			attributeSize(sizes, name+".", v, expand)
+			continue
+		}
+		sizes[name] = len(v)
+	}
+}
+
+// SizeAggregator sums SizeReports by field, and logs the costliest fields
+// once per window.
+type SizeAggregator struct {
+	logger *logrus.Logger
+	stop   chan struct{}
+	done   chan struct{}
+
+	mu      sync.Mutex
+	entries int
+	total   int
+	fields  map[string]int
+}
+
+// NewSizeAggregator returns a SizeAggregator logging the 10 fields with the
+// most bytes reported in each window with the logger, as long as any entries
+// were reported. Its Report method is the report callback of
+// WithSizeAttribution:
+//
+//	sizes := logadapter.NewSizeAggregator(time.Hour, log)
+//	defer sizes.Close()
+//	log.Formatter = logadapter.NewFormatter(
+//		logadapter.WithSizeAttribution(logadapter.DefaultSizeSampleRate, sizes.Report),
+//	)
+func NewSizeAggregator(window time.Duration, logger *logrus.Logger) *SizeAggregator {
+	a := &SizeAggregator{
+		logger: logger,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		fields: make(map[string]int),
+	}
+	go a.run(window)
+	return a
+}
+
+func (a *SizeAggregator) run(window time.Duration) {
+	defer close(a.done)
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.Flush()
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// Report adds the sizes of an entry to the current window. Summaries are
+// logged separately, as it is called while entries are formatted.
+func (a *SizeAggregator) Report(r SizeReport) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries++
+	a.total += r.Total
+	for k, n := range r.PerField {
+		a.fields[k] += n
+	}
+}
+
+// SizeFieldTotal is the number of bytes reported for a field.
+type SizeFieldTotal struct {
+	Field string `json:"field"`
+	Bytes int    `json:"bytes"`
+}
+
+// Flush logs the summary of the current window, if any entries were
+// reported, and starts a new window.
+func (a *SizeAggregator) Flush() {
+	a.mu.Lock()
+	entries, total, fields := a.entries, a.total, a.fields
+	a.entries, a.total, a.fields = 0, 0, make(map[string]int)
+	a.mu.Unlock()
+
+	if entries == 0 {
+		return
+	}
+
+	top := make([]SizeFieldTotal, 0, len(fields))
+	for k, n := range fields {
+		top = append(top, SizeFieldTotal{Field: k, Bytes: n})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Bytes != top[j].Bytes {
+			return top[i].Bytes > top[j].Bytes
+		}
+		return top[i].Field < top[j].Field
+	})
+	if len(top) > maxSizeSummaryFields {
+		top = top[:maxSizeSummaryFields]
+	}
+
+	a.logger.WithFields(logrus.Fields{
+		"sampledEntries":  entries,
+		"sampledBytes":    total,
+		"costliestFields": top,
+	}).Info("log entry size attribution")
+}
+
+// Close stops the periodic summaries, logging the summary of the current
+// window.
+func (a *SizeAggregator) Close() {
+	close(a.stop)
+	<-a.done
+	a.Flush()
+}
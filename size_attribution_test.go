@@ -0,0 +1,103 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizeAttribution(t *testing.T) {
+	var reports []logadapter.SizeReport
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+		logadapter.WithSizeAttribution(1, func(r logadapter.SizeReport) {
+			reports = append(reports, r)
+		}),
+	)
+
+	logger.WithFields(logrus.Fields{
+		"orderID": "ord-42",
+		"cart":    strings.Repeat("x", 10000),
+	}).Warn("order placed")
+
+	require.Len(t, reports, 1)
+	r := reports[0]
+	assert.Equal(t, "WARNING", r.Severity)
+	assert.Equal(t, out.Len()-1, r.Total, "the size of the entry written")
+	assert.Equal(t, len(`"order placed"`), r.PerField["message"])
+	assert.Equal(t, len(`"ord-42"`), r.PerField["context.data.orderID"])
+	assert.Contains(t, r.PerField, "logging.googleapis.com/sourceLocation")
+
+	cart := r.PerField["context.data.cart"]
+	for field, n := range r.PerField {
+		assert.LessOrEqual(t, n, cart, "%v is smaller than the huge field", field)
+	}
+	assert.Greater(t, cart, r.Total*9/10, "the huge field dominates")
+}
+
+func TestSizeAttributionSampling(t *testing.T) {
+	var reports int
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSizeAttribution(0.5, func(logadapter.SizeReport) { reports++ }),
+	)
+	for i := 0; i < 1000; i++ {
+		logger.Info("order placed")
+	}
+	assert.InDelta(t, 500, reports, 150)
+}
+
+func TestSizeAggregator(t *testing.T) {
+	logger, rec := logtest.NewRecorder()
+	sizes := logadapter.NewSizeAggregator(time.Hour, logger)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			perField := map[string]int{"message": 20, "context.data.cart": 10000}
+			for j := 0; j < 12; j++ {
+				perField[fmt.Sprintf("context.data.key%02d", j)] = j
+			}
+			sizes.Report(logadapter.SizeReport{Total: 10100, PerField: perField})
+		}()
+	}
+	wg.Wait()
+	sizes.Close()
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, "log entry size attribution", e.Message)
+	logtest.AssertField(t, e, "context.data.sampledEntries", 4.0)
+	logtest.AssertField(t, e, "context.data.sampledBytes", 40400.0)
+
+	top, _ := logtest.Field(e, "context.data.costliestFields")
+	require.Len(t, top, 10, "the costliest fields are listed")
+	assert.Equal(t, map[string]interface{}{"field": "context.data.cart", "bytes": 40000.0},
+		top.([]interface{})[0])
+	assert.Equal(t, map[string]interface{}{"field": "message", "bytes": 80.0},
+		top.([]interface{})[1])
+	assert.Equal(t, map[string]interface{}{"field": "context.data.key11", "bytes": 44.0},
+		top.([]interface{})[2])
+
+	rec.Reset()
+	sizes.Flush()
+	assert.Empty(t, rec.String(), "nothing is logged for empty windows")
+}
@@ -0,0 +1,74 @@
+package logadapter
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SourceLocationStrategy selects how the source location of entries is
+// resolved, from the caller reported by logrus with SetReportCaller, or by
+// walking the stack, skipping the packages and functions configured with
+// WithStackSkip and the like.
+type SourceLocationStrategy int
+
+const (
+	// PreferCaller uses the caller reported by logrus if any, and otherwise
+	// walks the stack
+	PreferCaller SourceLocationStrategy = iota
+	// PreferStackWalk always walks the stack, ignoring the caller reported by
+	// logrus
+	PreferStackWalk
+	// CallerThenWalk uses the caller reported by logrus unless it is skipped,
+	// such as a logging helper, and otherwise walks the stack
+	CallerThenWalk
+)
+
+// KeySourceLocationOrigin is the field of the data of entries telling how
+// their source location was resolved, WithSourceLocationDebug
+const KeySourceLocationOrigin = "sourceLocationOrigin"
+
+// Origins of the source location of entries
+const (
+	SourceLocationCaller    = "caller"
+	SourceLocationStackWalk = "stackwalk"
+)
+
+// sourceLocation returns where the entry was logged, and how it was resolved
+func (f *Formatter) sourceLocation(e *logrus.Entry) (*SourceLocation, string) {
+	useCaller := e.Caller != nil
+	switch f.SourceLocationStrategy {
+	case PreferStackWalk:
+		useCaller = false
+	case CallerThenWalk:
+		useCaller = useCaller && !f.skipCaller(e.Caller.Function)
+	}
+	if useCaller {
+		return extractFromCaller(e), SourceLocationCaller
+	}
+	return extractFromCallStack(f.errorOrigin()), SourceLocationStackWalk
+}
+
+// skipCaller reports whether the function fn, as reported by logrus, is
+// skipped when walking the stack
+func (f *Formatter) skipCaller(fn string) bool {
+	fn = unvendor(fn)
+	if f.skipFunction(fn) {
+		return true
+	}
+	return f.RegexSkip != "" && regexp.MustCompile(f.RegexSkip).MatchString(fn)
+}
+
+func sourceLocationStrategyName(s SourceLocationStrategy) string {
+	switch s {
+	case PreferCaller:
+		return "caller"
+	case PreferStackWalk:
+		return "stackwalk"
+	case CallerThenWalk:
+		return "callerThenWalk"
+	default:
+		return fmt.Sprintf("SourceLocationStrategy(%d)", int(s))
+	}
+}
@@ -0,0 +1,131 @@
+package logadapter_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/test"
+	"github.com/go-stack/stack"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractFromCallStack(t *testing.T) {
+	c := stack.Caller(0)
+
+	got := logadapter.ExtractFromCallStack(c)
+	require.NotNil(t, got)
+	assert.Equal(t, &logadapter.SourceLocation{
+		FilePath:     fmt.Sprintf("%+s", c),
+		LineNumber:   c.Frame().Line,
+		FunctionName: "TestExtractFromCallStack",
+	}, got, "the location is formatted as by go-stack")
+}
+
+func TestExtractFromCallStackZero(t *testing.T) {
+	assert.Nil(t, logadapter.ExtractFromCallStack(stack.Call{}),
+		"an unknown frame has no source location")
+}
+
+func BenchmarkExtractFromCallStack(b *testing.B) {
+	c := stack.Caller(0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = logadapter.ExtractFromCallStack(c)
+	}
+}
+
+func TestSourceLocationStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy logadapter.SourceLocationStrategy
+		function string
+		origin   string
+	}{
+		{
+			name:     "caller",
+			strategy: logadapter.PreferCaller,
+			function: "github.com/StevenACoffman/logrus-stackdriver-formatter/test." +
+				"(*LogWrapper).Error",
+			origin: "caller",
+		},
+		{
+			name:     "stack walk",
+			strategy: logadapter.PreferStackWalk,
+			function: "tRunner",
+			origin:   "stackwalk",
+		},
+		{
+			// the helper is in this package, which is skipped
+			name:     "skipped caller",
+			strategy: logadapter.CallerThenWalk,
+			function: "tRunner",
+			origin:   "stackwalk",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+				logadapter.WithSourceLocationStrategy(tt.strategy),
+				logadapter.WithSourceLocationDebug(),
+			))
+			logger.SetReportCaller(true)
+			mylog := test.LogWrapper{Logger: logger}
+			mylog.Error("my log entry")
+
+			entry, ok := rec.LastEntry()
+			require.True(t, ok)
+			logtest.AssertField(t, entry, "logging.googleapis.com/sourceLocation.function",
+				tt.function)
+			logtest.AssertField(t, entry, "context.data.sourceLocationOrigin", tt.origin)
+		})
+	}
+}
+
+func TestSourceLocationCallerThenWalk(t *testing.T) {
+	f := logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSourceLocationStrategy(logadapter.CallerThenWalk),
+		logadapter.WithSourceLocationDebug(),
+	)
+	e := logrus.NewEntry(logrus.New())
+	e.Level = logrus.InfoLevel
+	e.Message = "handled"
+	e.Caller = &runtime.Frame{
+		Function: "example.com/app.handle",
+		File:     "/src/app/handler.go",
+		Line:     42,
+	}
+
+	b, err := f.Format(e)
+	require.NoError(t, err)
+	var got struct {
+		SourceLocation logadapter.SourceLocation `json:"logging.googleapis.com/sourceLocation"`
+		Context        struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"context"`
+	}
+	require.NoError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, logadapter.SourceLocation{
+		FilePath:     "/src/app/handler.go",
+		LineNumber:   42,
+		FunctionName: "example.com/app.handle",
+	}, got.SourceLocation, "a caller outside of skipped packages is kept")
+	assert.Equal(t, "caller", got.Context.Data["sourceLocationOrigin"])
+}
+
+func TestSourceLocationDebugOff(t *testing.T) {
+	logger, rec := logtest.NewRecorder()
+	logger.Info("no origin")
+
+	entry, ok := rec.LastEntry()
+	require.True(t, ok)
+	if entry.Context != nil {
+		assert.NotContains(t, entry.Context.Data, "sourceLocationOrigin")
+	}
+}
@@ -0,0 +1,130 @@
+package logadapter
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// foreignSpanContextMessage is logged once at DEBUG, if enabled, by formatters
+// of entries whose span_context is not a trace.SpanContext, but is converted
+// by reflection
+const foreignSpanContextMessage = "logadapter: span_context of type %s is not the " +
+	"go.opentelemetry.io/otel/trace.SpanContext of the version this package uses, and " +
+	"was converted by reflection; align the versions of otel in your dependencies"
+
+// spanContextOf returns the span context of the span_context field of an
+// entry. Besides a trace.SpanContext, it accepts the span context of any
+// other version of otel, with TraceID and SpanID methods, and that of
+// OpenCensus, with TraceID and SpanID fields, for when several versions
+// coexist in a dependency graph. foreign reports whether v was converted.
+func spanContextOf(v interface{}) (sc trace.SpanContext, foreign bool) {
+	if sc, ok := v.(trace.SpanContext); ok {
+		return sc, false
+	}
+	defer func() {
+		// the methods of a foreign type may panic
+		if r := recover(); r != nil {
+			sc, foreign = trace.SpanContext{}, false
+		}
+	}()
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return trace.SpanContext{}, false
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return trace.SpanContext{}, false
+	}
+	if valid, ok := member(rv, "IsValid"); ok && valid.Kind() == reflect.Bool && !valid.Bool() {
+		return trace.SpanContext{}, false
+	}
+	traceID, ok := member(rv, "TraceID")
+	if !ok {
+		return trace.SpanContext{}, false
+	}
+	spanID, ok := member(rv, "SpanID")
+	if !ok {
+		return trace.SpanContext{}, false
+	}
+	tid, err := trace.TraceIDFromHex(idString(traceID))
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	sid, err := trace.SpanIDFromHex(idString(spanID))
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	var flags trace.TraceFlags
+	if isSampled(rv) {
+		flags = trace.FlagsSampled
+	}
+	sc = trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    tid,
+		SpanID:     sid,
+		TraceFlags: flags,
+	})
+	return sc, sc.IsValid()
+}
+
+// member returns the result of the method of v without arguments and with a
+// single result of this name, or else the value of its exported field
+func member(v reflect.Value, name string) (reflect.Value, bool) {
+	m := v.MethodByName(name)
+	if !m.IsValid() && v.CanAddr() {
+		m = v.Addr().MethodByName(name)
+	}
+	if m.IsValid() && m.Type().NumIn() == 0 && m.Type().NumOut() == 1 {
+		return m.Call(nil)[0], true
+	}
+	if v.Kind() == reflect.Struct {
+		if field := v.FieldByName(name); field.IsValid() && field.CanInterface() {
+			return field, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// isSampled reports whether the span context v is sampled, from its IsSampled
+// method, or the IsSampled method or first bit of its TraceOptions, as in
+// OpenCensus
+func isSampled(v reflect.Value) bool {
+	if sampled, ok := member(v, "IsSampled"); ok && sampled.Kind() == reflect.Bool {
+		return sampled.Bool()
+	}
+	options, ok := member(v, "TraceOptions")
+	if !ok {
+		return false
+	}
+	if sampled, ok := member(options, "IsSampled"); ok && sampled.Kind() == reflect.Bool {
+		return sampled.Bool()
+	}
+	switch options.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return options.Uint()&1 == 1
+	}
+	return false
+}
+
+// idString returns the hex form of a trace or span ID, from its String
+// method, or its bytes
+func idString(v reflect.Value) string {
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+	switch {
+	case v.Kind() == reflect.String:
+		return v.String()
+	case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+		b := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(b), v)
+		return hex.EncodeToString(b)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return hex.EncodeToString(v.Bytes())
+	}
+	return ""
+}
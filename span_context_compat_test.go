@@ -0,0 +1,173 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+)
+
+// fakeID mimics the IDs of another version of otel, formatted in hex
+type fakeID []byte
+
+func (id fakeID) String() string {
+	const digits = "0123456789abcdef"
+	s := make([]byte, 0, 2*len(id))
+	for _, b := range id {
+		s = append(s, digits[b>>4], digits[b&0xf])
+	}
+	return string(s)
+}
+
+// fakeSpanContext has the method set of the span context of another version
+// of otel, without being a trace.SpanContext
+type fakeSpanContext struct {
+	traceID, spanID fakeID
+	sampled         bool
+}
+
+func (sc fakeSpanContext) TraceID() fakeID { return sc.traceID }
+func (sc fakeSpanContext) SpanID() fakeID  { return sc.spanID }
+func (sc fakeSpanContext) IsSampled() bool { return sc.sampled }
+func (sc fakeSpanContext) IsValid() bool   { return len(sc.traceID) > 0 }
+
+// censusSpanContext mimics the span context of OpenCensus, with fields
+type censusSpanContext struct {
+	TraceID      [16]byte
+	SpanID       [8]byte
+	TraceOptions uint32
+}
+
+func formatLines(
+	t *testing.T, f *logadapter.Formatter, spanCtx interface{},
+) []map[string]interface{} {
+	t.Helper()
+	return formatLinesAt(t, f, logrus.DebugLevel, spanCtx)
+}
+
+// formatLinesAt formats an entry with a logger enabling the level
+func formatLinesAt(
+	t *testing.T, f *logadapter.Formatter, level logrus.Level, spanCtx interface{},
+) []map[string]interface{} {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetLevel(level)
+	e := logrus.NewEntry(logger)
+	e.Level = logrus.InfoLevel
+	e.Message = "correlated"
+	e.Data = logrus.Fields{"span_context": spanCtx}
+	b, err := f.Format(e)
+	require.NoError(t, err)
+
+	var lines []map[string]interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace(b), []byte("\n")) {
+		var got map[string]interface{}
+		require.NoError(t, json.Unmarshal(line, &got))
+		lines = append(lines, got)
+	}
+	return lines
+}
+
+func TestForeignSpanContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		spanCtx interface{}
+		sampled bool
+	}{
+		{
+			name: "otel methods",
+			spanCtx: fakeSpanContext{
+				traceID: fakeID(TraceID[:]),
+				spanID:  fakeID(SpanID[:]),
+				sampled: true,
+			},
+			sampled: true,
+		},
+		{
+			name: "otel methods pointer",
+			spanCtx: &fakeSpanContext{
+				traceID: fakeID(TraceID[:]),
+				spanID:  fakeID(SpanID[:]),
+			},
+		},
+		{
+			name: "opencensus fields",
+			spanCtx: censusSpanContext{
+				TraceID:      TraceID,
+				SpanID:       SpanID,
+				TraceOptions: 1,
+			},
+			sampled: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := logadapter.NewFormatter(logadapter.WithProjectID("test-project"))
+
+			lines := formatLines(t, f, tt.spanCtx)
+			require.Len(t, lines, 2, "a note precedes the first entry")
+			assert.Equal(t, "DEBUG", lines[0]["severity"])
+			assert.Contains(t, lines[0]["message"], "converted by reflection")
+			got := lines[1]
+			assert.Equal(t, "projects/test-project/traces/105445aa7843bc8bf206b12000100000",
+				got["logging.googleapis.com/trace"])
+			assert.Equal(t, "0000000000000001", got["logging.googleapis.com/spanId"])
+			if tt.sampled {
+				assert.Equal(t, true, got["logging.googleapis.com/trace_sampled"])
+			} else {
+				assert.NotContains(t, got, "logging.googleapis.com/trace_sampled")
+			}
+			assert.NotContains(t, got, "context", "the span context is not kept in data")
+
+			lines = formatLines(t, f, tt.spanCtx)
+			assert.Len(t, lines, 1, "the note is logged once")
+		})
+	}
+}
+
+func TestForeignSpanContextDebugDisabled(t *testing.T) {
+	f := logadapter.NewFormatter(logadapter.WithProjectID("test-project"))
+	spanCtx := fakeSpanContext{traceID: fakeID(TraceID[:]), spanID: fakeID(SpanID[:])}
+
+	lines := formatLinesAt(t, f, logrus.InfoLevel, spanCtx)
+	require.Len(t, lines, 1, "no note is logged at INFO")
+	assert.Equal(t, "0000000000000001", lines[0]["logging.googleapis.com/spanId"])
+
+	lines = formatLinesAt(t, f, logrus.DebugLevel, spanCtx)
+	require.Len(t, lines, 2, "the note is logged once DEBUG is enabled")
+	assert.Equal(t, "DEBUG", lines[0]["severity"])
+}
+
+func TestForeignSpanContextInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		spanCtx interface{}
+	}{
+		{name: "invalid", spanCtx: fakeSpanContext{}},
+		{name: "nil pointer", spanCtx: (*fakeSpanContext)(nil)},
+		{name: "unrelated", spanCtx: "105445aa7843bc8bf206b12000100000"},
+		{name: "zero opencensus", spanCtx: censusSpanContext{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := logadapter.NewFormatter(logadapter.WithProjectID("test-project"))
+
+			lines := formatLines(t, f, tt.spanCtx)
+			require.Len(t, lines, 1, "no note is logged")
+			assert.NotContains(t, lines[0], "logging.googleapis.com/spanId")
+		})
+	}
+}
+
+func TestSpanContextNoNote(t *testing.T) {
+	f := logadapter.NewFormatter(logadapter.WithProjectID("test-project"))
+
+	lines := formatLines(t, f, SpanContext)
+	require.Len(t, lines, 1, "a trace.SpanContext is not converted")
+	assert.Equal(t, "0000000000000001", lines[0]["logging.googleapis.com/spanId"])
+}
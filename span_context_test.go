@@ -0,0 +1,55 @@
+package logadapter_test
+
+import (
+	"context"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSpanFromEntryContext(t *testing.T) {
+	ctxSpan := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89, 1},
+		SpanID:     trace.SpanID{0, 0, 0, 0, 0, 0, 0, 0x4a},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), ctxSpan)
+
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithGlobalTraceID(TraceID),
+	))
+
+	t.Run("context", func(t *testing.T) {
+		logger.WithContext(ctx).Info("order placed")
+		e, ok := rec.LastEntry()
+		require.True(t, ok)
+		assert.Equal(t, "projects/test-project/traces/"+ctxSpan.TraceID().String(), e.Trace)
+		assert.Equal(t, "000000000000004a", e.SpanID)
+		assert.True(t, e.TraceSampled)
+	})
+
+	t.Run("span_context field", func(t *testing.T) {
+		logger.WithContext(ctx).WithField(logadapter.KeySpanContext, SpanContext).
+			Info("order placed")
+		e, ok := rec.LastEntry()
+		require.True(t, ok)
+		assert.Equal(t, "projects/test-project/traces/"+SpanContext.TraceID().String(), e.Trace,
+			"the explicit span context takes precedence")
+		assert.Equal(t, SpanContext.SpanID().String(), e.SpanID)
+		assert.Nil(t, e.Context, "the span context is not logged as data")
+	})
+
+	t.Run("neither", func(t *testing.T) {
+		logger.WithContext(context.Background()).Info("order placed")
+		e, ok := rec.LastEntry()
+		require.True(t, ok)
+		assert.Equal(t, "projects/test-project/traces/105445aa7843bc8bf206b12000100000", e.Trace,
+			"entries without a span fall back to the global trace")
+		assert.Empty(t, e.SpanID)
+		assert.False(t, e.TraceSampled)
+	})
+}
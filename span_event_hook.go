@@ -0,0 +1,70 @@
+package logadapter
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ logrus.Hook = (*SpanEventHook)(nil)
+
+// SpanEventHook records entries as exception events on the span active in the
+// context of the entry, so that traces show failures inline. Entries at ERROR
+// and above also set the status of the span to Error.
+type SpanEventHook struct {
+	levels []logrus.Level
+}
+
+// NewSpanEventHook returns a SpanEventHook for entries at the given levels,
+// or at ERROR and above if none are given.
+func NewSpanEventHook(levels ...logrus.Level) *SpanEventHook {
+	if len(levels) == 0 {
+		levels = []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel}
+	}
+	return &SpanEventHook{levels: levels}
+}
+
+func (s *SpanEventHook) Levels() []logrus.Level {
+	return s.levels
+}
+
+func (s *SpanEventHook) Fire(e *logrus.Entry) error {
+	if e.Context == nil {
+		return nil
+	}
+	span := trace.SpanFromContext(e.Context)
+	if !span.IsRecording() {
+		return nil
+	}
+
+	var err error
+	if v, ok := e.Data[logrus.ErrorKey]; ok {
+		err = asError(v)
+	}
+
+	attrs := []attribute.KeyValue{semconv.ExceptionMessageKey.String(e.Message)}
+	if err != nil {
+		attrs = []attribute.KeyValue{
+			semconv.ExceptionTypeKey.String(fmt.Sprintf("%T", err)),
+			semconv.ExceptionMessageKey.String(err.Error()),
+		}
+	}
+
+	stack, ok := stackField(e.Data)
+	if !ok {
+		stack = string(extractStackFromError(err))
+	}
+	if stack != "" {
+		attrs = append(attrs, semconv.ExceptionStacktraceKey.String(stack))
+	}
+
+	span.AddEvent(semconv.ExceptionEventName, trace.WithAttributes(attrs...))
+	if e.Level <= logrus.ErrorLevel {
+		span.SetStatus(codes.Error, e.Message)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package logadapter_test
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	pkgErrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type spanEvent struct {
+	name  string
+	attrs map[attribute.Key]string
+}
+
+// recordingSpan records the events and status set on a span
+type recordingSpan struct {
+	trace.Span
+	recording bool
+
+	events     []spanEvent
+	statusCode codes.Code
+	statusMsg  string
+}
+
+func (s *recordingSpan) IsRecording() bool {
+	return s.recording
+}
+
+func (s *recordingSpan) AddEvent(name string, options ...trace.EventOption) {
+	attrs := map[attribute.Key]string{}
+	for _, kv := range trace.NewEventConfig(options...).Attributes {
+		attrs[kv.Key] = kv.Value.AsString()
+	}
+	s.events = append(s.events, spanEvent{name: name, attrs: attrs})
+}
+
+func (s *recordingSpan) SetStatus(code codes.Code, msg string) {
+	s.statusCode = code
+	s.statusMsg = msg
+}
+
+func newSpanEventLogger(levels ...logrus.Level) *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.Formatter = logadapter.NewFormatter(logadapter.WithProjectID("test-project"))
+	logger.AddHook(logadapter.NewSpanEventHook(levels...))
+	return logger
+}
+
+func TestSpanEventHook(t *testing.T) {
+	span := &recordingSpan{Span: trace.SpanFromContext(context.Background()), recording: true}
+	ctx := trace.ContextWithSpan(context.Background(), span)
+
+	logger := newSpanEventLogger()
+	logger.WithContext(ctx).WithError(pkgErrors.New("boom")).Error("checkout failed")
+	logger.WithContext(ctx).Warn("not an error")
+
+	require.Len(t, span.events, 1, "only errors are recorded by default")
+	event := span.events[0]
+	assert.Equal(t, "exception", event.name)
+	assert.Equal(t, "*errors.fundamental", event.attrs["exception.type"])
+	assert.Equal(t, "boom", event.attrs["exception.message"])
+	assert.Contains(t, event.attrs["exception.stacktrace"], "boom\ngoroutine 1 [running]:\n",
+		"stack of the error is recorded as it is reported")
+	assert.Equal(t, codes.Error, span.statusCode)
+	assert.Equal(t, "checkout failed", span.statusMsg)
+}
+
+func TestSpanEventHookStackTraceField(t *testing.T) {
+	span := &recordingSpan{Span: trace.SpanFromContext(context.Background()), recording: true}
+	ctx := trace.ContextWithSpan(context.Background(), span)
+
+	logger := newSpanEventLogger(logrus.WarnLevel)
+	logger.WithContext(ctx).
+		WithField(logadapter.KeyStackTrace, "goroutine 7 [running]:\nmain.main()").
+		Warn("retrying")
+
+	require.Len(t, span.events, 1)
+	assert.Equal(t, map[attribute.Key]string{
+		"exception.message":    "retrying",
+		"exception.stacktrace": "goroutine 7 [running]:\nmain.main()",
+	}, span.events[0].attrs)
+	assert.Equal(t, codes.Unset, span.statusCode, "warnings do not fail the span")
+}
+
+func TestSpanEventHookNotRecording(t *testing.T) {
+	span := &recordingSpan{Span: trace.SpanFromContext(context.Background())}
+	ctx := trace.ContextWithSpan(context.Background(), span)
+
+	logger := newSpanEventLogger()
+	logger.WithContext(ctx).WithError(pkgErrors.New("boom")).Error("checkout failed")
+	logger.WithError(pkgErrors.New("boom")).Error("no context")
+
+	assert.Empty(t, span.events)
+	assert.Equal(t, codes.Unset, span.statusCode)
+}
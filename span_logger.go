@@ -0,0 +1,69 @@
+package logadapter
+
+import (
+	"context"
+
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanLogger returns an entry of logger correlated with the span in ctx, with
+// the fields of the request-scoped entry in ctx, such as a requestId. Entries
+// logged from it need neither WithContext nor the SpanHook to be correlated.
+func SpanLogger(ctx context.Context, logger *logrus.Logger) *logrus.Entry {
+	entry := logger.WithFields(ctxlogrus.Extract(ctx).Data).WithContext(ctx)
+	if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.IsValid() {
+		entry = entry.WithField(KeySpanContext, spanCtx)
+	}
+	return entry
+}
+
+// tracerName names the tracers of the TracerProvider of WithTracerProvider
+const tracerName = "github.com/StevenACoffman/logrus-stackdriver-formatter"
+
+// SpanLogOption lets you configure StartSpanLog.
+type SpanLogOption func(*spanLog)
+
+type spanLog struct {
+	provider trace.TracerProvider
+}
+
+// WithTracerProvider starts the span with a tracer of tp, rather than with the
+// tracer that created the span in the context, so that a span is started even
+// if the context has no span, or only a span context propagated from a
+// client.
+func WithTracerProvider(tp trace.TracerProvider) SpanLogOption {
+	return func(s *spanLog) {
+		s.provider = tp
+	}
+}
+
+// StartSpanLog starts a child span of the span in ctx, with the tracer that
+// created it, and returns its context with an entry of logger correlated with
+// it, as by SpanLogger. The returned func ends the span.
+//
+// Without WithTracerProvider, if the span in ctx was not created by a tracer,
+// such as a span context propagated from a client, no span is started, and
+// the entry is correlated with the span of ctx.
+func StartSpanLog(
+	ctx context.Context,
+	logger *logrus.Logger,
+	name string,
+	opts ...SpanLogOption,
+) (context.Context, *logrus.Entry, func()) {
+	var s spanLog
+	for _, opt := range opts {
+		opt(&s)
+	}
+	tracer := trace.SpanFromContext(ctx).Tracer()
+	if s.provider != nil {
+		tracer = s.provider.Tracer(tracerName)
+	}
+	spanCtx, span := tracer.Start(ctx, name)
+	// the no-op tracer would hide the span of ctx
+	if span.SpanContext().IsValid() {
+		ctx = spanCtx
+	}
+	return ctx, SpanLogger(ctx, logger), func() { span.End() }
+}
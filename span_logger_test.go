@@ -0,0 +1,186 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/ctxlogrus"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// testTracer starts child spans in the trace of their parent, or in a new
+// trace without one, numbering their span IDs
+type testTracer struct {
+	started []*testSpan
+}
+
+func (t *testTracer) Start(
+	ctx context.Context,
+	name string,
+	_ ...trace.SpanOption,
+) (context.Context, trace.Span) {
+	parent := trace.SpanContextFromContext(ctx)
+	if !parent.TraceID().IsValid() {
+		parent = parent.WithTraceID(trace.TraceID{0: 2, 15: 2})
+	}
+	span := &testSpan{
+		Span:   trace.SpanFromContext(ctx),
+		tracer: t,
+		name:   name,
+		spanCtx: parent.WithSpanID(trace.SpanID{0, 0, 0, 0, 0, 0, 0, byte(len(t.started) + 2)}).
+			WithTraceFlags(trace.FlagsSampled),
+	}
+	t.started = append(t.started, span)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+// testTracerProvider provides its tracer whatever the name
+type testTracerProvider struct {
+	tracer *testTracer
+}
+
+func (p testTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return p.tracer
+}
+
+// testSpan records whether it has ended
+type testSpan struct {
+	trace.Span
+	tracer  *testTracer
+	name    string
+	spanCtx trace.SpanContext
+	ended   bool
+}
+
+func (s *testSpan) Tracer() trace.Tracer {
+	return s.tracer
+}
+
+func (s *testSpan) SpanContext() trace.SpanContext {
+	return s.spanCtx
+}
+
+func (s *testSpan) End(...trace.SpanOption) {
+	s.ended = true
+}
+
+func newSpanLogger() (*logrus.Logger, *bytes.Buffer) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter(
+		logadapter.WithProjectID("test-project"),
+		logadapter.WithSkipTimestamp(),
+	)
+	return logger, &out
+}
+
+func TestSpanLogger(t *testing.T) {
+	logger, out := newSpanLogger()
+
+	ctx := trace.ContextWithSpanContext(context.Background(), SpanContext)
+	ctx = ctxlogrus.ToContext(ctx, logrus.NewEntry(logger))
+	ctxlogrus.AddFields(ctx, logrus.Fields{"requestId": "req-1"})
+
+	logadapter.SpanLogger(ctx, logger).Info("order placed")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	assert.Equal(t, "projects/test-project/traces/105445aa7843bc8bf206b12000100000",
+		got["logging.googleapis.com/trace"])
+	assert.Equal(t, "0000000000000001", got["logging.googleapis.com/spanId"])
+	data := got["context"].(map[string]interface{})["data"].(map[string]interface{})
+	assert.Equal(t, "req-1", data["requestId"])
+}
+
+func TestStartSpanLog(t *testing.T) {
+	tracer := &testTracer{}
+	parent := &testSpan{tracer: tracer, spanCtx: SpanContext}
+
+	logger, out := newSpanLogger()
+	ctx := trace.ContextWithSpan(context.Background(), parent)
+
+	ctx, entry, end := logadapter.StartSpanLog(ctx, logger, "reserve stock")
+	entry.Info("reserving")
+	logadapter.SpanLogger(ctx, logger).Info("reserved")
+	end()
+
+	require.Len(t, tracer.started, 1)
+	span := tracer.started[0]
+	assert.Equal(t, SpanContext.TraceID(), span.spanCtx.TraceID(), "a child span is started")
+	assert.NotEqual(t, SpanContext.SpanID(), span.spanCtx.SpanID())
+	assert.Equal(t, "reserve stock", span.name)
+	assert.True(t, span.ended, "the closer ends the span")
+
+	dec := json.NewDecoder(out)
+	for _, msg := range []string{"reserving", "reserved"} {
+		var got map[string]interface{}
+		require.NoError(t, dec.Decode(&got))
+		assert.Equal(t, msg, got["message"])
+		assert.Equal(t, "projects/test-project/traces/"+span.spanCtx.TraceID().String(),
+			got["logging.googleapis.com/trace"])
+		assert.Equal(t, span.spanCtx.SpanID().String(), got["logging.googleapis.com/spanId"])
+	}
+}
+
+func TestStartSpanLogTracerProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		traceID trace.TraceID
+	}{
+		{
+			name:    "no parent",
+			ctx:     context.Background(),
+			traceID: trace.TraceID{0: 2, 15: 2},
+		},
+		{
+			name:    "propagated parent",
+			ctx:     trace.ContextWithRemoteSpanContext(context.Background(), SpanContext),
+			traceID: SpanContext.TraceID(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer := &testTracer{}
+			logger, out := newSpanLogger()
+
+			_, entry, end := logadapter.StartSpanLog(tt.ctx, logger, "reserve stock",
+				logadapter.WithTracerProvider(testTracerProvider{tracer: tracer}))
+			entry.Info("reserving")
+			end()
+
+			require.Len(t, tracer.started, 1, "a span is started")
+			span := tracer.started[0]
+			assert.Equal(t, tt.traceID, span.spanCtx.TraceID())
+			assert.Equal(t, "reserve stock", span.name)
+			assert.True(t, span.ended)
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+			assert.Equal(t, "projects/test-project/traces/"+tt.traceID.String(),
+				got["logging.googleapis.com/trace"])
+			assert.Equal(t, span.spanCtx.SpanID().String(), got["logging.googleapis.com/spanId"])
+		})
+	}
+}
+
+func TestStartSpanLogWithoutTracer(t *testing.T) {
+	logger, out := newSpanLogger()
+	ctx := trace.ContextWithSpanContext(context.Background(), SpanContext)
+
+	_, entry, end := logadapter.StartSpanLog(ctx, logger, "reserve stock")
+	entry.Info("reserving")
+	end()
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	assert.Equal(t, "0000000000000001", got["logging.googleapis.com/spanId"],
+		"still correlated with the parent span")
+}
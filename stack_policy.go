@@ -0,0 +1,44 @@
+package logadapter
+
+import (
+	"errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrNoStack matches errors wrapped with NoStack, with errors.Is
+var ErrNoStack = errors.New("logadapter: logged without stack trace")
+
+// StackPolicy selects the StackTraceStyle of an ERROR or more severe entry,
+// given the error logged with it, if any. TraceNone reports the entry
+// without a stack trace, and not as an error event.
+type StackPolicy func(e *logrus.Entry, err error) StackTraceStyle
+
+// NoStack wraps an expected error, such as a validation failure, so that it
+// is logged without a stack trace and not reported to Error Reporting. The
+// error is otherwise unchanged.
+func NoStack(err error) error {
+	if err == nil {
+		return nil
+	}
+	return noStack{err}
+}
+
+type noStack struct {
+	error
+}
+
+func (n noStack) Unwrap() error { return n.error }
+
+func (noStack) Is(target error) bool { return target == ErrNoStack }
+
+// stackStyle provides the style of the stack trace of an entry logged with err
+func (f *Formatter) stackStyle(e *logrus.Entry, err error) StackTraceStyle {
+	if err != nil && errors.Is(err, ErrNoStack) {
+		return TraceNone
+	}
+	if f.StackPolicy != nil {
+		return f.StackPolicy(e, err)
+	}
+	return f.StackStyle
+}
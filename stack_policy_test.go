@@ -0,0 +1,83 @@
+package logadapter_test
+
+import (
+	"errors"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	pkgErrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const reportedErrorEvent = "type.googleapis.com/" +
+	"google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+
+func TestNoStack(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithStackTraceStyle(logadapter.TraceInBoth),
+	))
+	err := pkgErrors.New("invalid email")
+
+	logger.WithError(err).Error("signup failed")
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, reportedErrorEvent, e.Type)
+	assert.NotEmpty(t, e.StackTrace)
+
+	logger.WithError(logadapter.NoStack(err)).
+		WithField(logadapter.KeyStackTrace, "goroutine 1 [running]:").
+		Error("signup failed")
+	e, ok = rec.LastEntry()
+	require.True(t, ok)
+	assert.Empty(t, e.Type)
+	assert.Empty(t, e.StackTrace)
+	assert.Equal(t, "signup failed\ninvalid email", e.Message)
+	assert.Equal(t, "ERROR", string(e.Severity))
+	_, ok = logtest.Field(e, "context.data.stackTrace")
+	assert.False(t, ok)
+
+	wrapped := logadapter.NoStack(err)
+	assert.True(t, errors.Is(wrapped, logadapter.ErrNoStack))
+	assert.True(t, errors.Is(wrapped, err))
+	assert.False(t, errors.Is(err, logadapter.ErrNoStack))
+	assert.Equal(t, err.Error(), wrapped.Error())
+	assert.Nil(t, logadapter.NoStack(nil))
+}
+
+func TestStackPolicy(t *testing.T) {
+	errValidation := errors.New("validation failed")
+	var policyErrs []error
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithStackPolicy(func(e *logrus.Entry, err error) logadapter.StackTraceStyle {
+			policyErrs = append(policyErrs, err)
+			if errors.Is(err, errValidation) {
+				return logadapter.TraceNone
+			}
+			return logadapter.TraceInPayload
+		}),
+	))
+	stack := "goroutine 1 [running]:\nmain.main()"
+
+	logger.WithError(errValidation).WithField(logadapter.KeyStackTrace, stack).Error("bad input")
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Empty(t, e.Type)
+	assert.Empty(t, e.StackTrace)
+	assert.Equal(t, "bad input\nvalidation failed", e.Message)
+
+	logger.WithError(errors.New("disk full")).WithField(logadapter.KeyStackTrace, stack).
+		Error("write failed")
+	e, ok = rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, reportedErrorEvent, e.Type)
+	assert.Equal(t, "write failed\ndisk full\n"+stack, e.StackTrace)
+	assert.Equal(t, "write failed\ndisk full", e.Message)
+
+	logger.Info("not evaluated below ERROR")
+	logger.Error("no error")
+	require.Len(t, policyErrs, 3)
+	assert.Nil(t, policyErrs[2])
+}
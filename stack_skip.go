@@ -0,0 +1,56 @@
+package logadapter
+
+import (
+	"reflect"
+	"strings"
+)
+
+// selfPackage is the import path of this package, skipped when locating
+// errors, which differs from its upstream path when vendored or forked
+var selfPackage = reflect.TypeOf((*Formatter)(nil)).Elem().PkgPath()
+
+// skipFrame reports whether a frame of the function fn of the package pkg is
+// skipped when locating errors. The StackSkip entries match any package
+// containing them, StackSkipPrefixes whole segments of package paths, and
+// StackSkipFunctions functions by their full name, along with their closures.
+func (f *Formatter) skipFrame(pkg, fn string) bool {
+	for _, skip := range f.StackSkip {
+		if strings.Contains(pkg, skip) {
+			return true
+		}
+	}
+	for _, prefix := range f.StackSkipPrefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if pkg == prefix || strings.HasPrefix(pkg, prefix+"/") {
+			return true
+		}
+	}
+	for _, name := range f.StackSkipFunctions {
+		if fn == name || strings.HasPrefix(fn, name+".func") {
+			return true
+		}
+	}
+	return false
+}
+
+// skipFunction reports whether the function fn, as named in stack traces, is
+// skipped when locating errors
+func (f *Formatter) skipFunction(fn string) bool {
+	return f.skipFrame(funcPackage(fn), fn)
+}
+
+// funcPackage returns the package of a function name, such as
+// "github.com/a/b" for "github.com/a/b.(*T).M"
+func funcPackage(fn string) string {
+	slash := strings.LastIndex(fn, "/")
+	if dot := strings.Index(fn[slash+1:], "."); dot >= 0 {
+		return fn[:slash+1+dot]
+	}
+	return fn
+}
+
+// unvendor removes the vendor directory from a package or function path
+func unvendor(path string) string {
+	parts := strings.SplitN(path, "/vendor/", 2)
+	return parts[len(parts)-1]
+}
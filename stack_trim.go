@@ -0,0 +1,118 @@
+package logadapter
+
+import (
+	"strconv"
+	"strings"
+)
+
+// DefaultStackTrimPackages are the packages whose frames are dropped from
+// stack traces trimmed WithStackTraceFrameLimit, unless configured
+// WithStackTraceTrimPackages: those serving HTTP and gRPC requests, the
+// runtime, including the frames of panics, and testing.
+var DefaultStackTrimPackages = []string{
+	"net/http",
+	"google.golang.org/grpc",
+	"runtime",
+	"testing",
+}
+
+// trimStack drops the frames of the trimmed packages from a stack trace
+// formatted as by debug.Stack, then keeps at most StackFrameLimit frames,
+// the top-most ones, noting how many were dropped on a last line. The lines
+// before the first frame, such as the message and the goroutine header, are
+// kept so that Error Reporting still parses the stack trace. Stack traces are
+// returned unchanged unless trimming is configured.
+func (f *Formatter) trimStack(stack string) string {
+	if f.StackFrameLimit <= 0 && f.StackTrimPackages == nil {
+		return stack
+	}
+	trimmed := f.StackTrimPackages
+	if trimmed == nil {
+		trimmed = DefaultStackTrimPackages
+	}
+
+	lines := strings.Split(strings.TrimRight(stack, "\n"), "\n")
+	header := 0
+	for header < len(lines) && !isGoroutineHeader(lines[header]) {
+		header++
+	}
+	if header == len(lines) {
+		return stack
+	}
+
+	kept := append([]string(nil), lines[:header+1]...)
+	frames, elided := 0, 0
+	for i := header + 1; i < len(lines); {
+		// a frame is a line naming its function followed by indented lines
+		end := i + 1
+		for end < len(lines) && strings.HasPrefix(lines[end], "\t") {
+			end++
+		}
+		frame := lines[i:end]
+		i = end
+
+		if first := frame[0]; first == "" || isGoroutineHeader(first) {
+			kept = append(kept, frame...)
+			continue
+		}
+		if trimPackage(frameFunction(frame[0]), trimmed) ||
+			(f.StackFrameLimit > 0 && frames >= f.StackFrameLimit) {
+			elided++
+			continue
+		}
+		frames++
+		kept = append(kept, frame...)
+	}
+	if elided == 0 {
+		return stack
+	}
+	kept = append(kept, "... "+strconv.Itoa(elided)+" frames elided")
+	return strings.Join(kept, "\n")
+}
+
+// stackTrimPackages returns the packages whose frames are dropped from stack
+// traces, if trimmed
+func (f *Formatter) stackTrimPackages() []string {
+	if f.StackTrimPackages == nil && f.StackFrameLimit > 0 {
+		return append([]string(nil), DefaultStackTrimPackages...)
+	}
+	return append([]string(nil), f.StackTrimPackages...)
+}
+
+// isGoroutineHeader reports whether a line of a stack trace starts the frames
+// of a goroutine, such as "goroutine 1 [running]:"
+func isGoroutineHeader(line string) bool {
+	return strings.HasPrefix(line, "goroutine ") && strings.HasSuffix(line, ":")
+}
+
+// frameFunction returns the function of a line of a stack trace naming it,
+// without its arguments, such as "net/http.(*Server).Serve" for
+// "created by net/http.(*Server).Serve in goroutine 1"
+func frameFunction(line string) string {
+	fn := strings.TrimPrefix(line, "created by ")
+	if j := strings.Index(fn, " in goroutine "); j >= 0 {
+		fn = fn[:j]
+	}
+	if strings.HasSuffix(fn, ")") {
+		if j := strings.LastIndex(fn, "("); j > 0 {
+			fn = fn[:j]
+		}
+	}
+	return fn
+}
+
+// trimPackage reports whether the function fn belongs to one of the packages
+// or their subpackages
+func trimPackage(fn string, packages []string) bool {
+	pkg := unvendor(funcPackage(fn))
+	if fn == "panic" {
+		// the panic call itself is named without its package
+		pkg = "runtime"
+	}
+	for _, p := range packages {
+		if pkg == p || strings.HasPrefix(pkg, strings.TrimSuffix(p, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
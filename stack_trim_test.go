@@ -0,0 +1,122 @@
+package logadapter_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deepStack is a stack trace of 200 frames, of a panic recovered by the
+// runtime below 100 frames of the application and 98 of net/http
+func deepStack() string {
+	var b strings.Builder
+	b.WriteString("goroutine 42 [running]:\n")
+	b.WriteString("runtime/debug.Stack()\n\t/usr/local/go/src/runtime/debug/stack.go:24 +0x5e\n")
+	b.WriteString("panic({0x6b1c40?, 0x7d2f70?})\n")
+	b.WriteString("\t/usr/local/go/src/runtime/panic.go:770 +0x132\n")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&b, "example.com/shop/handlers.step%d(...)\n", i)
+		fmt.Fprintf(&b, "\t/src/shop/handlers/steps.go:%d +0x1f\n", i+10)
+	}
+	for i := 0; i < 97; i++ {
+		fmt.Fprintf(&b, "net/http.HandlerFunc.ServeHTTP(0xc000a8e000, {0x8a1f30, 0xc0001c2000})\n")
+		fmt.Fprintf(&b, "\t/usr/local/go/src/net/http/server.go:%d +0x29\n", 2100+i)
+	}
+	b.WriteString("created by net/http.(*Server).Serve in goroutine 1\n")
+	b.WriteString("\t/usr/local/go/src/net/http/server.go:3285 +0x4b4\n")
+	return b.String()
+}
+
+func trimmedStack(t *testing.T, opts []logadapter.Option, data logrus.Fields) string {
+	t.Helper()
+	opts = append(opts, logadapter.WithStackTraceStyle(logadapter.TraceInPayload))
+	f := logadapter.NewFormatter(opts...)
+	e := logrus.NewEntry(logrus.New()).WithFields(data)
+	e.Level = logrus.ErrorLevel
+	e.Message = "placing order"
+	ee, err := f.ToEntry(e)
+	require.NoError(t, err)
+	return ee.StackTrace
+}
+
+// stackFrames checks that a stack trace is parsed by Error Reporting, a first
+// line, a goroutine header, then frames of a function and its file, and
+// returns its functions along with its last line
+func stackFrames(t *testing.T, stack string) (funcs []string, last string) {
+	t.Helper()
+	lines := strings.Split(stack, "\n")
+	require.Greater(t, len(lines), 2)
+	assert.Equal(t, "placing order", lines[0])
+	assert.Equal(t, "goroutine 42 [running]:", lines[1])
+	last = lines[len(lines)-1]
+	frames := lines[2 : len(lines)-1]
+	require.Zero(t, len(frames)%2, "frames have a function and a file line")
+	for i := 0; i < len(frames); i += 2 {
+		assert.False(t, strings.HasPrefix(frames[i], "\t"), frames[i])
+		assert.True(t, strings.HasPrefix(frames[i+1], "\t/"), frames[i+1])
+		funcs = append(funcs, frames[i])
+	}
+	return funcs, last
+}
+
+func TestStackTraceFrameLimit(t *testing.T) {
+	stack := logrus.Fields{logadapter.KeyStackTrace: deepStack()}
+
+	funcs, last := stackFrames(t, trimmedStack(t,
+		[]logadapter.Option{logadapter.WithStackTraceFrameLimit(20)}, stack))
+	assert.Equal(t, "... 180 frames elided", last)
+	require.Len(t, funcs, 20)
+	assert.Equal(t, "example.com/shop/handlers.step0(...)", funcs[0],
+		"the runtime frames of the panic are dropped")
+	assert.Equal(t, "example.com/shop/handlers.step19(...)", funcs[19],
+		"the top-most frames are kept")
+
+	funcs, last = stackFrames(t, trimmedStack(t, []logadapter.Option{
+		logadapter.WithStackTraceFrameLimit(150),
+		logadapter.WithStackTraceTrimPackages(),
+	}, stack))
+	assert.Equal(t, "... 50 frames elided", last)
+	require.Len(t, funcs, 150)
+	assert.Equal(t, "runtime/debug.Stack()", funcs[0], "no package is trimmed")
+
+	funcs, last = stackFrames(t, trimmedStack(t, []logadapter.Option{
+		logadapter.WithStackTraceTrimPackages("net/http", "runtime/debug"),
+	}, stack))
+	assert.Equal(t, "... 99 frames elided", last, "the packages are trimmed without a limit")
+	assert.Len(t, funcs, 101)
+	assert.Equal(t, "panic({0x6b1c40?, 0x7d2f70?})", funcs[0],
+		"the panic call belongs to the runtime, not its subpackages")
+}
+
+func TestStackTraceUntrimmed(t *testing.T) {
+	stack := deepStack()
+	assert.Equal(t, "placing order\n"+stack, trimmedStack(t, nil,
+		logrus.Fields{logadapter.KeyStackTrace: stack}), "stack traces are kept whole by default")
+	assert.Equal(t, "placing order\n"+stack, trimmedStack(t,
+		[]logadapter.Option{
+			logadapter.WithStackTraceFrameLimit(200),
+			logadapter.WithStackTraceTrimPackages(),
+		}, logrus.Fields{logadapter.KeyStackTrace: stack}),
+		"stack traces within the limit are kept")
+}
+
+func TestStackTraceFrameLimitError(t *testing.T) {
+	got := trimmedStack(t, []logadapter.Option{logadapter.WithStackTraceFrameLimit(1)},
+		logrus.Fields{logrus.ErrorKey: pkgerrors.New("out of stock")})
+
+	lines := strings.Split(got, "\n")
+	require.Len(t, lines, 6)
+	assert.Equal(t, "placing order", lines[0])
+	assert.Equal(t, "out of stock", lines[1])
+	assert.Equal(t, "goroutine 1 [running]:", lines[2])
+	assert.Contains(t, lines[3], "TestStackTraceFrameLimitError")
+	assert.True(t, strings.HasPrefix(lines[4], "\t"), lines[4])
+	assert.Equal(t, "... 2 frames elided", lines[5],
+		"the frames of testing and the runtime are dropped")
+}
@@ -1,42 +1,22 @@
-package logadapter
+package logadapter_test
 
 import (
-	"bytes"
 	"encoding/json"
-	"runtime"
 	"testing"
 
-	"github.com/gofrs/uuid"
-	"go.opentelemetry.io/otel/trace"
-
-	"github.com/StevenACoffman/logrus-stackdriver-formatter/test"
 	"github.com/google/go-cmp/cmp"
-	"github.com/sirupsen/logrus"
-)
+	"github.com/stretchr/testify/require"
 
-var (
-	TraceFlags  = trace.FlagsSampled
-	TraceID     = uuid.Must(uuid.FromString("105445aa7843bc8bf206b12000100000"))
-	SpanID      = [8]byte{0, 0, 0, 0, 0, 0, 0, 1}
-	SpanContext = trace.SpanContext{}.WithSpanID(SpanID).
-		WithTraceID(trace.TraceID(TraceID)).
-		WithTraceFlags(TraceFlags)
-	LineNumber = platformLine()
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/test"
 )
 
 func TestStackSkip(t *testing.T) {
-	var out bytes.Buffer
-
-	logger := logrus.New()
-	logger.Out = &out
-	logger.Formatter = NewFormatter(
-		WithProjectID("test-project"),
-		WithService("test"),
-		WithVersion("0.1"),
-		WithStackSkip("github.com/StevenACoffman/logrus-stackdriver-formatter"),
-		WithSkipTimestamp(),
-		WithGlobalTraceID(TraceID),
-	)
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithVersion("0.1"),
+		logadapter.WithStackSkip("github.com/StevenACoffman/logrus-stackdriver-formatter"),
+	))
 
 	mylog := test.LogWrapper{
 		Logger: logger,
@@ -45,8 +25,21 @@ func TestStackSkip(t *testing.T) {
 		WithField("span_context", SpanContext).
 		Error("my log entry")
 
+	entry, ok := rec.LastEntry()
+	require.True(t, ok)
+
+	// the line within the testing package depends on the Go version
+	logtest.AssertField(t, entry, "logging.googleapis.com/sourceLocation.file",
+		"testing/testing.go")
+	logtest.AssertField(t, entry, "logging.googleapis.com/sourceLocation.function", "tRunner")
+	require.NotNil(t, entry.Context)
+	require.NotNil(t, entry.Context.ReportLocation)
+	require.NotZero(t, entry.SourceLocation.LineNumber)
+	entry.SourceLocation.LineNumber = 0
+	entry.Context.ReportLocation.LineNumber = 0
+
 	want := map[string]interface{}{
-		"@type":                                reportedErrorEventType,
+		"@type":                                "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent",
 		"severity":                             "ERROR",
 		"message":                              "my log entry",
 		"logName":                              "projects/test-project/logs/test",
@@ -60,34 +53,68 @@ func TestStackSkip(t *testing.T) {
 		"context": map[string]interface{}{
 			"reportLocation": map[string]interface{}{
 				"filePath":     "testing/testing.go",
-				"lineNumber":   LineNumber,
 				"functionName": "tRunner",
 			},
 		},
 		"logging.googleapis.com/sourceLocation": map[string]interface{}{
 			"file":     "testing/testing.go",
-			"line":     LineNumber,
 			"function": "tRunner",
 		},
 	}
+	b, err := json.Marshal(entry)
+	require.NoError(t, err)
 	var got map[string]interface{}
-	err := json.Unmarshal(out.Bytes(), &got)
-	if err != nil {
-		t.Error(err)
-	}
+	require.NoError(t, json.Unmarshal(b, &got))
 
 	if diff := cmp.Diff(want, got); diff != "" {
 		t.Errorf("Unexpected output (-want +got):\n%s", diff)
 	}
 }
 
-func platformLine() float64 {
-	switch runtime.GOOS {
-	case "darwin":
-		return 1193.0
-	case "linux":
-		return 1439.0
-	default: // does anyone really use windows?
-		return 0.0
+func TestStackSkipMatching(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  logadapter.Option
+		pkg  string
+		fn   string
+		want bool
+	}{
+		{"contains", logadapter.WithStackSkip("github.com/foo"),
+			"github.com/foo/log", "github.com/foo/log.Errorf", true},
+		{"contains other package", logadapter.WithStackSkip("github.com/foo"),
+			"github.com/foobar", "github.com/foobar.Run", true},
+		{"prefix", logadapter.WithStackSkipPrefix("github.com/foo"),
+			"github.com/foo", "github.com/foo.Run", true},
+		{"prefix subpackage", logadapter.WithStackSkipPrefix("github.com/foo"),
+			"github.com/foo/log", "github.com/foo/log.Errorf", true},
+		{"prefix trailing slash", logadapter.WithStackSkipPrefix("github.com/foo/"),
+			"github.com/foo/log", "github.com/foo/log.Errorf", true},
+		{"prefix trailing slash package", logadapter.WithStackSkipPrefix("github.com/foo/"),
+			"github.com/foo", "github.com/foo.Run", true},
+		{"prefix other package", logadapter.WithStackSkipPrefix("github.com/foo"),
+			"github.com/foobar", "github.com/foobar.Run", false},
+		{"function", logadapter.WithStackSkipFunction("mycorp/pkg/log.Errorf"),
+			"mycorp/pkg/log", "mycorp/pkg/log.Errorf", true},
+		{"function closure", logadapter.WithStackSkipFunction("mycorp/pkg/log.Errorf"),
+			"mycorp/pkg/log", "mycorp/pkg/log.Errorf.func1", true},
+		{"method", logadapter.WithStackSkipFunction("mycorp/pkg/log.(*Logger).Errorf"),
+			"mycorp/pkg/log", "mycorp/pkg/log.(*Logger).Errorf", true},
+		{"other function", logadapter.WithStackSkipFunction("mycorp/pkg/log.Errorf"),
+			"mycorp/pkg/log", "mycorp/pkg/log.Errorf2", false},
+		{"other function of package", logadapter.WithStackSkipFunction("mycorp/pkg/log.Errorf"),
+			"mycorp/pkg/log", "mycorp/pkg/log.Infof", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := logadapter.NewFormatter(tt.opt)
+			require.Equal(t, tt.want, f.SkipFrame(tt.pkg, tt.fn))
+		})
 	}
 }
+
+func TestStackSkipSelf(t *testing.T) {
+	require.Equal(t, "github.com/StevenACoffman/logrus-stackdriver-formatter",
+		logadapter.SelfPackage)
+	f := logadapter.NewFormatter()
+	require.Contains(t, f.StackSkip, logadapter.SelfPackage)
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	pkgErrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 type stackTracer interface {
@@ -46,3 +47,21 @@ func extractStackFromError(err error) []byte {
 
 	return buf.Bytes()
 }
+
+// stackField provides the stack trace supplied in the stackTrace field of an
+// entry, assumed to be formatted by debug.Stack()
+func stackField(data logrus.Fields) (string, bool) {
+	st, ok := data[KeyStackTrace]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%+v", st), true
+}
+
+// asError converts the value logged as the error of an entry to an error
+func asError(v interface{}) error {
+	if err, ok := v.(error); ok {
+		return err
+	}
+	return fmt.Errorf("%v", v)
+}
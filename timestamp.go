@@ -0,0 +1,64 @@
+package logadapter
+
+import (
+	"sync"
+	"time"
+)
+
+// maxMonotonicDrift and maxMonotonicSteps bound how far ahead of the wall
+// clock WithMonotonicTimestamps moves timestamps to keep them increasing: by
+// the larger of the drift and of the steps of the timestamp precision, so
+// that coarse precisions still keep bursts of entries apart
+const (
+	maxMonotonicDrift = 10 * time.Microsecond
+	maxMonotonicSteps = 1000
+)
+
+// monotonicClock keeps the last timestamp emitted by a formatter
+type monotonicClock struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// next returns t, or just after the last timestamp if t isn't after it and
+// that is within the drift bound of the wall clock, or else the last one, so
+// that timestamps never go backwards. Timestamps are moved by step, so that
+// they stay distinct once truncated to it. Entries timed ahead of the wall
+// clock by more than the drift bound keep their time, without holding back
+// the following ones.
+func (c *monotonicClock) next(t time.Time, step time.Duration) time.Time {
+	drift := maxMonotonicDrift
+	if d := maxMonotonicSteps * step; d > drift {
+		drift = d
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if t.After(c.last) {
+		if t.Sub(now) <= drift {
+			c.last = t
+		}
+		return t
+	}
+	if bumped := c.last.Add(step); bumped.Sub(now) <= drift {
+		c.last = bumped
+	}
+	return c.last
+}
+
+// timestamp formats the time of an entry, at the configured precision, and
+// strictly after the previous one WithMonotonicTimestamps
+func (f *Formatter) timestamp(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	step := time.Nanosecond
+	if f.TimestampPrecision > 0 {
+		t = t.Truncate(f.TimestampPrecision)
+		step = f.TimestampPrecision
+	}
+	if f.MonotonicTimestamps {
+		t = f.clock.next(t, step)
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
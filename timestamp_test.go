@@ -0,0 +1,127 @@
+package logadapter_test
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func timestampLogger(opts ...logadapter.Option) (*logrus.Logger, *logtest.Recorder) {
+	rec := &logtest.Recorder{}
+	logger := logrus.New()
+	logger.Out = rec
+	logger.Formatter = logadapter.NewFormatter(
+		append([]logadapter.Option{logadapter.WithProjectID("test-project")}, opts...)...)
+	return logger, rec
+}
+
+func timestamps(t *testing.T, rec *logtest.Recorder) []time.Time {
+	var ts []time.Time
+	for _, e := range rec.Entries() {
+		parsed, err := time.Parse(time.RFC3339Nano, e.Timestamp)
+		require.NoError(t, err)
+		ts = append(ts, parsed)
+	}
+	return ts
+}
+
+func TestMonotonicTimestamps(t *testing.T) {
+	for _, tcase := range []struct {
+		name      string
+		precision time.Duration
+	}{
+		{"nanoseconds", 0},
+		{"microseconds", time.Microsecond},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			logger, rec := timestampLogger(
+				logadapter.WithMonotonicTimestamps(),
+				logadapter.WithTimestampPrecision(tcase.precision),
+			)
+
+			// a coarse clock gives the entries the same time
+			coarse := time.Now().Add(-time.Second).Truncate(time.Millisecond)
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(worker int) {
+					defer wg.Done()
+					for j := 0; j < 1000; j++ {
+						logger.WithTime(coarse).WithField("worker", worker).Info("order placed")
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			// logrus writes entries formatted concurrently in any order, but
+			// Cloud Logging orders them by timestamp
+			entries := rec.Entries()
+			require.Len(t, entries, 10000)
+			ts := timestamps(t, rec)
+			last := map[interface{}]time.Time{}
+			for i, e := range entries {
+				worker := e.Context.Data["worker"]
+				require.True(t, ts[i].After(last[worker]),
+					"the entries of a goroutine are in order: %v after %v", ts[i], last[worker])
+				last[worker] = ts[i]
+			}
+			sort.Slice(ts, func(i, j int) bool { return ts[i].Before(ts[j]) })
+			for i := 1; i < len(ts); i++ {
+				require.True(t, ts[i].After(ts[i-1]), "timestamps are distinct: %v", ts[i])
+			}
+		})
+	}
+}
+
+func TestMonotonicTimestampsDrift(t *testing.T) {
+	logger, rec := timestampLogger(logadapter.WithMonotonicTimestamps())
+
+	now := time.Now()
+	logger.WithTime(now.Add(time.Hour)).Info("clock jumped forward")
+	logger.WithTime(now).Info("clock corrected")
+	logger.WithTime(now).Info("same time")
+
+	ts := timestamps(t, rec)
+	require.Len(t, ts, 3)
+	assert.True(t, ts[1].Equal(now), "timestamps are not moved far ahead of the wall clock")
+	assert.True(t, ts[2].After(ts[1]), "ordering resumes once resynced")
+}
+
+func TestMonotonicTimestampsMilliseconds(t *testing.T) {
+	logger, rec := timestampLogger(
+		logadapter.WithMonotonicTimestamps(),
+		logadapter.WithTimestampPrecision(time.Millisecond),
+	)
+
+	// entries logged with the wall clock, many within the same millisecond
+	for i := 0; i < 200; i++ {
+		logger.Info("order placed")
+	}
+	ts := timestamps(t, rec)
+	require.Len(t, ts, 200)
+	for i := 1; i < len(ts); i++ {
+		require.True(t, ts[i].After(ts[i-1]), "%v is after %v", ts[i], ts[i-1])
+		require.Equal(t, ts[i], ts[i].Truncate(time.Millisecond))
+	}
+	assert.WithinDuration(t, time.Now(), ts[len(ts)-1], time.Second,
+		"timestamps are kept close to the wall clock")
+}
+
+func TestTimestampPrecision(t *testing.T) {
+	logger, rec := timestampLogger(logadapter.WithTimestampPrecision(time.Microsecond))
+	at := time.Date(2021, 6, 1, 14, 3, 7, 123456789, time.UTC)
+	logger.WithTime(at).Info("order placed")
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, "2021-06-01T14:03:07.123456Z", e.Timestamp)
+	assert.False(t, strings.Contains(e.Timestamp, "789"))
+}
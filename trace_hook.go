@@ -7,6 +7,9 @@ import (
 
 var _ logrus.Hook = (*SpanHook)(nil)
 
+// SpanHook adds the span of the context of entries as their span_context
+// field. The Formatter reads the span of the context of entries itself, so
+// the hook is only needed to override it, or by other formatters.
 type SpanHook struct{}
 
 func (s *SpanHook) Levels() []logrus.Level {
@@ -14,7 +17,7 @@ func (s *SpanHook) Levels() []logrus.Level {
 }
 
 func (s *SpanHook) Fire(e *logrus.Entry) error {
-	e.Data["span_context"] = trace.SpanContextFromContext(e.Context)
+	e.Data[KeySpanContext] = trace.SpanContextFromContext(e.Context)
 
 	return nil
 }
@@ -0,0 +1,106 @@
+package logadapter
+
+import (
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// qualifiedTracePattern is a trace resource name, of any project
+var qualifiedTracePattern = regexp.MustCompile(`^projects/[^/]+/traces/[^/]+$`)
+
+// parseTraceID normalizes a trace ID to the 32 lowercase hexadecimal
+// characters of Cloud Trace, stripping the dashes of a UUID.
+func parseTraceID(s string) (string, error) {
+	id := strings.ToLower(strings.ReplaceAll(s, "-", ""))
+	if len(id) != 32 {
+		return "", fmt.Errorf("logadapter: trace ID %q is not 32 hexadecimal characters", s)
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", fmt.Errorf("logadapter: trace ID %q is not 32 hexadecimal characters", s)
+	}
+	return id, nil
+}
+
+// parseSpanID normalizes a span ID to the 16 lowercase hexadecimal
+// characters of Cloud Trace.
+func parseSpanID(s string) (string, error) {
+	id := strings.ToLower(s)
+	if len(id) != 16 {
+		return "", fmt.Errorf("logadapter: span ID %q is not 16 hexadecimal characters", s)
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", fmt.Errorf("logadapter: span ID %q is not 16 hexadecimal characters", s)
+	}
+	return id, nil
+}
+
+// traceFields sets the trace of an entry from the trace, spanId and
+// traceSampled fields of its data, taking precedence over its span and the
+// global trace. A trace already naming its project is used verbatim, while a
+// trace ID is normalized and named in project, or omitted without a project.
+// Fields with invalid values are left in the data. The spanID field is used
+// verbatim, as it always was. It reports whether the trace field was valid.
+func traceFields(ee *Entry, data logrus.Fields, project string) (traced bool) {
+	if str, ok := data[KeyTrace].(string); ok {
+		if qualifiedTracePattern.MatchString(str) {
+			ee.Trace = str
+			traced = true
+			delete(data, KeyTrace)
+		} else if id, err := parseTraceID(str); err == nil {
+			// resource names without a project are dropped by GCP
+			if project != "" {
+				ee.Trace = newTraceName(project, id).name
+			}
+			traced = true
+			delete(data, KeyTrace)
+		}
+	}
+
+	if str, ok := data[KeySpanID].(string); ok {
+		ee.SpanID = str
+		delete(data, KeySpanID)
+	}
+	if str, ok := data[KeyBareSpanID].(string); ok {
+		if id, err := parseSpanID(str); err == nil {
+			ee.SpanID = id
+			delete(data, KeyBareSpanID)
+		}
+	}
+
+	switch sampled := data[KeyTraceSampled].(type) {
+	case bool:
+		ee.TraceSampled = sampled
+		delete(data, KeyTraceSampled)
+	case string:
+		if b, err := strconv.ParseBool(sampled); err == nil {
+			ee.TraceSampled = b
+			delete(data, KeyTraceSampled)
+		}
+	}
+	return traced
+}
+
+// traceName is the resource name of the global trace in a project, computed
+// once since nearly every entry logged outside of a span refers to it
+type traceName struct {
+	project, id, name string
+}
+
+func newTraceName(project, id string) traceName {
+	return traceName{project: project, id: id, name: "projects/" + project + "/traces/" + id}
+}
+
+// globalTraceName returns the resource name of the global trace in project,
+// which is precomputed for the ProjectID unless the formatter was modified
+// since.
+func (f *Formatter) globalTraceName(project string) string {
+	if t := f.globalTrace; t.project == project && t.id == f.GlobalTraceID {
+		return t.name
+	}
+	return newTraceName(project, f.GlobalTraceID).name
+}
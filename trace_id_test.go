@@ -0,0 +1,186 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobalTraceIDString(t *testing.T) {
+	tests := []struct {
+		name, id, want string
+	}{
+		{"hex", "4bf92f3577b34da6a3ce929d0e0e4736", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"uppercase", "4BF92F3577B34DA6A3CE929D0E0E4736", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"uuid", "105445aa-7843-bc8b-f206-b12000100000", "105445aa7843bc8bf206b12000100000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+				logadapter.WithGlobalTraceIDString(tt.id),
+			))
+			logger.Info("order placed")
+			e, ok := rec.LastEntry()
+			require.True(t, ok)
+			assert.Equal(t, "projects/test-project/traces/"+tt.want, e.Trace)
+		})
+	}
+
+	for _, id := range []string{"", "4bf92f3577b34da6", "4bf92f3577b34da6a3ce929d0e0e473z", "trace"} {
+		assert.Panics(t, func() { logadapter.WithGlobalTraceIDString(id) }, id)
+	}
+}
+
+func TestGlobalTraceIDFromEnv(t *testing.T) {
+	env := map[string]string{
+		"CI_TRACE_ID":  "4BF92F3577B34DA6A3CE929D0E0E4736",
+		"BAD_TRACE_ID": "build-1234",
+	}
+	defer logadapter.SetGetenv(func(k string) string { return env[k] })()
+
+	f := logadapter.NewFormatter(logadapter.WithGlobalTraceIDFromEnv("CI_TRACE_ID"))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", f.GlobalTraceID)
+
+	f = logadapter.NewFormatter(logadapter.WithGlobalTraceIDFromEnv("UNSET_TRACE_ID"))
+	assert.Regexp(t, "^[0-9a-f]{32}$", f.GlobalTraceID, "a random trace is used when unset")
+
+	assert.Panics(t, func() {
+		logadapter.NewFormatter(logadapter.WithGlobalTraceIDFromEnv("BAD_TRACE_ID"))
+	})
+}
+
+func TestGlobalTraceProject(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithGlobalTraceIDString("4bf92f3577b34da6a3ce929d0e0e4736"),
+	))
+	logger.WithField(logadapter.KeyGCPProject, "other-project").Info("order placed")
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, "projects/other-project/traces/4bf92f3577b34da6a3ce929d0e0e4736", e.Trace,
+		"the global trace is named in the project of the entry")
+}
+
+func TestTraceFields(t *testing.T) {
+	const id = "4bf92f3577b34da6a3ce929d0e0e4736"
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithGlobalTraceIDString("105445aa7843bc8bf206b12000100000"),
+	))
+	tests := []struct {
+		name    string
+		fields  logrus.Fields
+		trace   string
+		spanID  string
+		sampled bool
+		data    map[string]interface{}
+	}{
+		{
+			name:   "verbatim",
+			fields: logrus.Fields{logadapter.KeyTrace: "projects/other-project/traces/" + id},
+			trace:  "projects/other-project/traces/" + id,
+		},
+		{
+			name: "bare",
+			fields: logrus.Fields{
+				logadapter.KeyTrace:        strings.ToUpper(id),
+				logadapter.KeyBareSpanID:   "00F067AA0BA902B7",
+				logadapter.KeyTraceSampled: true,
+			},
+			trace:   "projects/test-project/traces/" + id,
+			spanID:  "00f067aa0ba902b7",
+			sampled: true,
+		},
+		{
+			name:    "sampled string",
+			fields:  logrus.Fields{logadapter.KeyTrace: id, logadapter.KeyTraceSampled: "true"},
+			trace:   "projects/test-project/traces/" + id,
+			sampled: true,
+		},
+		{
+			name: "invalid",
+			fields: logrus.Fields{
+				logadapter.KeyTrace:        "abc",
+				logadapter.KeyBareSpanID:   "4a",
+				logadapter.KeyTraceSampled: "maybe",
+			},
+			trace: "projects/test-project/traces/105445aa7843bc8bf206b12000100000",
+			data: map[string]interface{}{
+				"data_trace":               "abc",
+				"data_spanId":              "4a",
+				logadapter.KeyTraceSampled: "maybe",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger.WithFields(tt.fields).Info("order placed")
+			e, ok := rec.LastEntry()
+			require.True(t, ok)
+			assert.Equal(t, tt.trace, e.Trace)
+			assert.Equal(t, tt.spanID, e.SpanID)
+			assert.Equal(t, tt.sampled, e.TraceSampled)
+			if tt.data == nil {
+				assert.Nil(t, e.Context, "the trace fields are not logged as data")
+			} else {
+				require.NotNil(t, e.Context)
+				assert.Equal(t, tt.data, e.Context.Data, "invalid values are kept as data")
+			}
+		})
+	}
+}
+
+func TestTraceFieldsWithoutProject(t *testing.T) {
+	const id = "4bf92f3577b34da6a3ce929d0e0e4736"
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = logadapter.NewFormatter()
+	logger.WithFields(logrus.Fields{
+		logadapter.KeyTrace:      id,
+		logadapter.KeyBareSpanID: "00f067aa0ba902b7",
+	}).Info("order placed")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &got))
+	assert.Equal(t, "order placed", got["message"])
+	assert.NotContains(t, got, "logging.googleapis.com/trace",
+		"the trace isn't named without a project")
+	assert.Equal(t, "00f067aa0ba902b7", got["logging.googleapis.com/spanId"])
+	assert.NotContains(t, got, "context", "the trace field is not logged as data")
+}
+
+func TestTraceFieldsPrecedence(t *testing.T) {
+	const id = "4bf92f3577b34da6a3ce929d0e0e4736"
+	logger, rec := logtest.NewRecorder()
+	logger.WithField(logadapter.KeySpanContext, SpanContext).
+		WithFields(logrus.Fields{
+			logadapter.KeyTrace:        "projects/other-project/traces/" + id,
+			logadapter.KeyBareSpanID:   "00f067aa0ba902b7",
+			logadapter.KeyTraceSampled: false,
+		}).
+		Info("order placed")
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, "projects/other-project/traces/"+id, e.Trace,
+		"the trace field takes precedence over the span context")
+	assert.Equal(t, "00f067aa0ba902b7", e.SpanID)
+	assert.False(t, e.TraceSampled)
+
+	logger.WithField(logadapter.KeySpanContext, SpanContext).
+		WithField(logadapter.KeyTrace, id).
+		Info("order placed")
+	e, ok = rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, "projects/test-project/traces/"+id, e.Trace)
+	assert.Equal(t, SpanContext.SpanID().String(), e.SpanID,
+		"the span of the span context is kept without a span field")
+	assert.Equal(t, SpanContext.IsSampled(), e.TraceSampled)
+}
@@ -0,0 +1,20 @@
+package logadapter
+
+import "go.opentelemetry.io/otel/trace"
+
+// sampleErrorTrace marks the trace of an entry of ERROR or above as sampled
+// if configured, and escalates its sampling to the application if it wasn't
+// sampled
+func (f *Formatter) sampleErrorTrace(ee *Entry, spanCtx trace.SpanContext) {
+	switch ee.Severity {
+	case SeverityError, SeverityCritical, SeverityAlert:
+	default:
+		return
+	}
+	if f.ForceTraceSampledOnError {
+		ee.TraceSampled = true
+	}
+	if f.SamplingEscalation != nil && spanCtx.IsValid() && !spanCtx.IsSampled() {
+		f.SamplingEscalation(spanCtx)
+	}
+}
@@ -0,0 +1,96 @@
+package logadapter_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestForceTraceSampledOnError(t *testing.T) {
+	unsampled := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89, 1},
+		SpanID:  trace.SpanID{0, 0, 0, 0, 0, 0, 0, 0x4a},
+	})
+	sampled := unsampled.WithTraceFlags(trace.FlagsSampled)
+
+	var mu sync.Mutex
+	var escalated []trace.SpanContext
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithForceTraceSampledOnError(),
+		logadapter.WithSamplingEscalation(func(sc trace.SpanContext) {
+			mu.Lock()
+			defer mu.Unlock()
+			escalated = append(escalated, sc)
+		}),
+	))
+
+	tests := []struct {
+		name      string
+		span      trace.SpanContext
+		level     logrus.Level
+		sampled   bool
+		escalated bool
+	}{
+		{"error", unsampled, logrus.ErrorLevel, true, true},
+		{"fatal", unsampled, logrus.FatalLevel, true, true},
+		{"warning", unsampled, logrus.WarnLevel, false, false},
+		{"sampled error", sampled, logrus.ErrorLevel, true, false},
+		{"error without span", trace.SpanContext{}, logrus.ErrorLevel, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			escalated = nil
+			ctx := trace.ContextWithSpanContext(context.Background(), tt.span)
+			// logged without exiting on FATAL
+			logger.WithContext(ctx).Log(tt.level, "payment failed")
+			e, ok := rec.LastEntry()
+			require.True(t, ok)
+			assert.Equal(t, tt.sampled, e.TraceSampled)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if tt.escalated {
+				assert.Equal(t, []trace.SpanContext{tt.span}, escalated)
+			} else {
+				assert.Empty(t, escalated)
+			}
+		})
+	}
+}
+
+func TestForceTraceSampledOnErrorTraceField(t *testing.T) {
+	const id = "4bf92f3577b34da6a3ce929d0e0e4736"
+	var escalated int
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithForceTraceSampledOnError(),
+		logadapter.WithSamplingEscalation(func(trace.SpanContext) { escalated++ }),
+	))
+
+	logger.WithFields(logrus.Fields{
+		logadapter.KeyTrace:        id,
+		logadapter.KeyTraceSampled: false,
+	}).Error("payment failed")
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, "projects/test-project/traces/"+id, e.Trace)
+	assert.True(t, e.TraceSampled, "the traceSampled field doesn't unmark errors")
+	assert.Zero(t, escalated, "no span to escalate")
+
+	ctx := trace.ContextWithSpanContext(context.Background(), SpanContext)
+	logger.WithContext(ctx).WithField(logadapter.KeyTraceSampled, false).Error("payment failed")
+	e, ok = rec.LastEntry()
+	require.True(t, ok)
+	assert.True(t, e.TraceSampled)
+
+	logger.WithField(logadapter.KeyTraceSampled, false).Warn("payment slow")
+	e, ok = rec.LastEntry()
+	require.True(t, ok)
+	assert.False(t, e.TraceSampled)
+}
@@ -0,0 +1,141 @@
+package logadapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// traceNamePattern is a trace resource name, of a project in lower case
+	traceNamePattern = regexp.MustCompile(`^projects/[a-z0-9][-a-z0-9.:]*/traces/[0-9a-f]{32}$`)
+	spanIDPattern    = regexp.MustCompile(`^[0-9a-f]{16}$`)
+	// durationPattern is the JSON encoding of a google.protobuf.Duration
+	durationPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]{1,9})?s$`)
+	digitsPattern   = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// ValidationErrors lists the violations of an entry found by ValidateEntry.
+type ValidationErrors []error
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return "logadapter: invalid entry: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the violations, for errors.Is and errors.As.
+func (errs ValidationErrors) Unwrap() []error {
+	return errs
+}
+
+// ValidateEntry checks a formatted entry against the structural rules of the
+// special fields documented by GCP, which the logging agent otherwise
+// silently drops or mis-parses, returning ValidationErrors listing the
+// violations found:
+//
+//   - timestamp and time are RFC3339 timestamps
+//   - severity is a known Severity
+//   - httpRequest.status is a number, or a string of digits
+//   - httpRequest.latency is a duration such as "0.250s"
+//   - trace is a trace name, projects/[PROJECT_ID]/traces/[TRACE_ID], of a
+//     lower case project and a 32 hex digit trace ID
+//   - spanId is 16 hex digits
+//   - labels are strings
+func ValidateEntry(b []byte) error {
+	var e map[string]interface{}
+	if err := json.Unmarshal(b, &e); err != nil {
+		return ValidationErrors{fmt.Errorf("not a JSON object: %w", err)}
+	}
+
+	var errs ValidationErrors
+	invalid := func(field string, v interface{}, rule string) {
+		errs = append(errs, fmt.Errorf("%s %s: %v", field, rule, v))
+	}
+	asString := func(field string, v interface{}) (string, bool) {
+		s, ok := v.(string)
+		if !ok {
+			invalid(field, v, "is not a string")
+		}
+		return s, ok
+	}
+
+	for _, field := range []string{"timestamp", "time"} {
+		v, ok := e[field]
+		if !ok {
+			continue
+		}
+		if s, ok := asString(field, v); ok {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				invalid(field, v, "is not an RFC3339 timestamp")
+			}
+		}
+	}
+
+	if v, ok := e["severity"]; ok {
+		if s, ok := asString("severity", v); ok && Severity(s).Ordinal() < 0 {
+			invalid("severity", v, "is not a known severity")
+		}
+	}
+
+	if v, ok := e["httpRequest"]; ok {
+		req, _ := v.(map[string]interface{})
+		if req == nil {
+			invalid("httpRequest", v, "is not an object")
+		}
+		if status, ok := req["status"]; ok {
+			switch s := status.(type) {
+			case float64:
+			case string:
+				if !digitsPattern.MatchString(s) {
+					invalid("httpRequest.status", status, "is not a number")
+				}
+			default:
+				invalid("httpRequest.status", status, "is not a number")
+			}
+		}
+		if latency, ok := req["latency"]; ok {
+			if s, ok := asString("httpRequest.latency", latency); ok &&
+				!durationPattern.MatchString(s) {
+				invalid("httpRequest.latency", latency, "is not a duration")
+			}
+		}
+	}
+
+	if v, ok := e["logging.googleapis.com/trace"]; ok {
+		if s, ok := asString("trace", v); ok && !traceNamePattern.MatchString(s) {
+			invalid("trace", v, "is not projects/[PROJECT_ID]/traces/[TRACE_ID]")
+		}
+	}
+
+	if v, ok := e["logging.googleapis.com/spanId"]; ok {
+		if s, ok := asString("spanId", v); ok && !spanIDPattern.MatchString(s) {
+			invalid("spanId", v, "is not 16 hex digits")
+		}
+	}
+
+	if v, ok := e["logging.googleapis.com/labels"]; ok {
+		labels, ok := v.(map[string]interface{})
+		if !ok {
+			invalid("labels", v, "is not an object")
+		}
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			asString("labels."+k, labels[k])
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
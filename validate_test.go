@@ -0,0 +1,95 @@
+package logadapter_test
+
+import (
+	"errors"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateEntry(t *testing.T) {
+	const traceID = "105445aa7843bc8bf206b12000100000"
+	valid := `{
+		"timestamp": "2021-06-01T14:03:07.25Z",
+		"severity": "NOTICE",
+		"message": "served HTTP GET /orders/42",
+		"httpRequest": {"requestMethod": "GET", "status": "200", "latency": "0.01234s"},
+		"logging.googleapis.com/trace": "projects/test-project/traces/` + traceID + `",
+		"logging.googleapis.com/spanId": "000000000000004a",
+		"logging.googleapis.com/labels": {"env": "prod"}
+	}`
+	assert.NoError(t, logadapter.ValidateEntry([]byte(valid)))
+
+	for _, tcase := range []struct {
+		name  string
+		entry string
+		want  []string
+	}{
+		{
+			name: "trace",
+			entry: `{
+				"logging.googleapis.com/trace": "projects/Test-Project/traces/` + traceID + `",
+				"logging.googleapis.com/spanId": "4a"
+			}`,
+			want: []string{
+				"trace is not projects/[PROJECT_ID]/traces/[TRACE_ID]: " +
+					"projects/Test-Project/traces/" + traceID,
+				"spanId is not 16 hex digits: 4a",
+			},
+		},
+		{
+			name:  "timestamp",
+			entry: `{"timestamp": "2021-06-01 14:03:07", "time": 1622556187}`,
+			want: []string{
+				"timestamp is not an RFC3339 timestamp: 2021-06-01 14:03:07",
+				"time is not a string: 1.622556187e+09",
+			},
+		},
+		{
+			name:  "severity",
+			entry: `{"severity": "warn"}`,
+			want:  []string{"severity is not a known severity: warn"},
+		},
+		{
+			name:  "httpRequest",
+			entry: `{"httpRequest": {"status": "OK", "latency": "12ms"}}`,
+			want: []string{
+				"httpRequest.status is not a number: OK",
+				"httpRequest.latency is not a duration: 12ms",
+			},
+		},
+		{
+			name:  "labels",
+			entry: `{"logging.googleapis.com/labels": {"retries": 3, "env": "prod"}}`,
+			want:  []string{"labels.retries is not a string: 3"},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			err := logadapter.ValidateEntry([]byte(tcase.entry))
+			var verrs logadapter.ValidationErrors
+			require.True(t, errors.As(err, &verrs), "error: %v", err)
+			var got []string
+			for _, verr := range verrs {
+				got = append(got, verr.Error())
+			}
+			assert.Equal(t, tcase.want, got)
+		})
+	}
+}
+
+func TestWithValidation(t *testing.T) {
+	logger, rec := logtest.NewRecorder()
+	logger.WithField(logadapter.KeyTrace, "projects/Test-Project/traces/105445aa").
+		WithField(logadapter.KeySpanID, "4a").
+		Info("order placed")
+
+	_, ok := rec.LastEntry()
+	require.True(t, ok, "invalid entries are still logged")
+	errs := rec.ValidationErrors()
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "trace is not projects/[PROJECT_ID]/traces/[TRACE_ID]")
+	assert.Contains(t, errs[0].Error(), "spanId is not 16 hex digits")
+}
@@ -0,0 +1,89 @@
+package logadapter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// errEncodePanic is returned when an entry cannot be encoded even once the
+// values of its data whose MarshalJSON panics were replaced
+var errEncodePanic = errors.New("logadapter: panic encoding entry")
+
+// panicPlaceholder is logged instead of a value whose method panicked while
+// it was formatted, so that the log call doesn't crash the process
+func panicPlaceholder(method string, r interface{}) string {
+	return fmt.Sprintf("<panic in %s: %v>", method, r)
+}
+
+// safeString returns the String of v, or a placeholder if it panics
+func safeString(v fmt.Stringer) (s string) {
+	defer func() {
+		if r := recover(); r != nil {
+			s = panicPlaceholder("String", r)
+		}
+	}()
+	return v.String()
+}
+
+// safeError returns the Error of err, or a placeholder and false if it panics
+func safeError(err error) (s string, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			s, ok = panicPlaceholder("Error", r), false
+		}
+	}()
+	return err.Error(), true
+}
+
+// safeMarshal encodes v with encoding/json, returning the panic of its
+// MarshalJSON, if any, as an error
+func safeMarshal(v interface{}) (b []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(panicPlaceholder("MarshalJSON", r))
+		}
+	}()
+	return json.Marshal(v)
+}
+
+// marshalPanic returns a placeholder for v if its MarshalJSON panics
+func marshalPanic(v interface{}) (placeholder string, panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			placeholder, panicked = panicPlaceholder("MarshalJSON", r), true
+		}
+	}()
+	_, _ = json.Marshal(v)
+	return "", false
+}
+
+// encode encodes the entry, replacing the values of its data whose
+// MarshalJSON panics with a placeholder and counting a format error
+func (f *Formatter) encode(enc EntryEncoder, ee *Entry, buf []byte) ([]byte, error) {
+	b, err := tryEncode(enc, ee, buf)
+	if err != errEncodePanic {
+		return b, err
+	}
+	if f.Metrics != nil {
+		f.Metrics.IncFormatErrors()
+	}
+	if ee.Context != nil {
+		for k, v := range ee.Context.Data {
+			if placeholder, panicked := marshalPanic(v); panicked {
+				ee.Context.Data[k] = placeholder
+			}
+		}
+	}
+	return tryEncode(enc, ee, buf)
+}
+
+// tryEncode encodes the entry, returning errEncodePanic if the encoder panics
+func tryEncode(enc EntryEncoder, ee *Entry, buf []byte) (b []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			b, err = buf, errEncodePanic
+		}
+	}()
+	return enc.Encode(ee, buf)
+}
@@ -0,0 +1,128 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/fastjson"
+	"github.com/StevenACoffman/logrus-stackdriver-formatter/logtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lazyUser dereferences its name, which is set lazily
+type lazyUser struct {
+	name *string
+}
+
+func (u *lazyUser) String() string {
+	return *u.name
+}
+
+// brokenJSON panics when encoded
+type brokenJSON struct{}
+
+func (brokenJSON) MarshalJSON() ([]byte, error) {
+	panic("not initialized")
+}
+
+// brokenError panics when formatted
+type brokenError struct{}
+
+func (brokenError) Error() string {
+	panic("not initialized")
+}
+
+// formatErrorCounter counts the entries that failed to format
+type formatErrorCounter struct {
+	n int64
+}
+
+func (c *formatErrorCounter) IncEntries(string)             {}
+func (c *formatErrorCounter) ObserveEntryBytes(string, int) {}
+
+func (c *formatErrorCounter) IncFormatErrors() {
+	atomic.AddInt64(&c.n, 1)
+}
+
+const nilDereference = "runtime error: invalid memory address or nil pointer dereference"
+
+func TestPanickingStringer(t *testing.T) {
+	logger, rec := logtest.NewRecorder(logtest.WithFormatterOptions(
+		logadapter.WithFieldTypes(map[string]logadapter.FieldType{
+			"owner": logadapter.FieldString,
+		}),
+	))
+
+	require.NotPanics(t, func() {
+		logger.WithFields(logrus.Fields{
+			logadapter.KeyUser: &lazyUser{},
+			"owner":            &lazyUser{},
+			"orderId":          "A-1234",
+		}).Error("payment failed")
+	})
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, "<panic in String: "+nilDereference+">", e.Context.User)
+	logtest.AssertField(t, e, "context.data.owner", "<panic in String: "+nilDereference+">")
+	logtest.AssertField(t, e, "context.data.orderId", "A-1234")
+}
+
+func TestPanickingError(t *testing.T) {
+	logger, rec := logtest.NewRecorder()
+
+	require.NotPanics(t, func() {
+		logger.WithError(brokenError{}).Error("payment failed")
+	})
+
+	e, ok := rec.LastEntry()
+	require.True(t, ok)
+	assert.Equal(t, "payment failed\n<panic in Error: not initialized>", e.Message)
+	logtest.AssertField(t, e, "context.data.error", "<panic in Error: not initialized>")
+}
+
+func TestPanickingMarshalJSON(t *testing.T) {
+	encoders := map[string]logadapter.EntryEncoder{
+		"encoding/json": nil,
+		"fastjson":      fastjson.New(),
+	}
+	for name, enc := range encoders {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			metrics := &formatErrorCounter{}
+			logger := logrus.New()
+			logger.Out = &out
+			logger.Formatter = logadapter.NewFormatter(
+				logadapter.WithProjectID("test-project"),
+				logadapter.WithEncoder(enc),
+				logadapter.WithMetrics(metrics),
+			)
+
+			require.NotPanics(t, func() {
+				logger.WithFields(logrus.Fields{
+					"order":   brokenJSON{},
+					"orderId": "A-1234",
+				}).Info("order placed")
+			})
+
+			var e logadapter.Entry
+			require.NoError(t, json.Unmarshal(out.Bytes(), &e))
+			assert.Equal(t, "order placed", e.Message, "the rest of the entry is logged")
+			assert.Equal(t, "<panic in MarshalJSON: not initialized>", e.Context.Data["order"])
+			assert.Equal(t, "A-1234", e.Context.Data["orderId"])
+			assert.Equal(t, int64(1), atomic.LoadInt64(&metrics.n))
+		})
+	}
+}
+
+func TestApplicationPanics(t *testing.T) {
+	logger, _ := logtest.NewRecorder()
+	assert.Panics(t, func() {
+		logger.WithField("order", brokenJSON{}).Panic("payment failed")
+	}, "the panics of the application are not recovered")
+}
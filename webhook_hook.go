@@ -0,0 +1,320 @@
+package logadapter
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WebhookSignatureHeader is the header of the HMAC-SHA256 signature of the
+// body of the requests of a WebhookHook configured WithWebhookSignature, as
+// "sha256=" followed by its hexadecimal encoding.
+const WebhookSignatureHeader = "X-Logadapter-Signature-256"
+
+// ErrWebhookHookClosed is returned when flushing a closed WebhookHook
+var ErrWebhookHookClosed = errors.New("logadapter: flush of closed WebhookHook")
+
+// WebhookFailureRecorder is implemented by MetricsRecorders counting the
+// entries a WebhookHook failed to deliver, such as the promadapter Recorder.
+type WebhookFailureRecorder interface {
+	IncWebhookFailures()
+}
+
+var _ logrus.Hook = (*WebhookHook)(nil)
+
+// WebhookHook POSTs the entries of the given levels, formatted as JSON by
+// its Formatter, to a webhook, so that critical entries are notified without
+// the latency of log-based alerts.
+//
+// Entries are posted from a background goroutine, so that a slow endpoint
+// can't slow logging: when its queue is full, entries are dropped. Each post
+// is retried once. After consecutive failures, the circuit breaker drops
+// entries for a cooldown, rather than waiting on a dead endpoint. Failures
+// are counted by the MetricsRecorder of the formatter if it is a
+// WebhookFailureRecorder, and never logged, so as not to trigger the hook.
+//
+// Entries at FATAL are posted before the logger exits, waiting up to the
+// timeout of the requests.
+//
+// WebhookHooks register themselves to be flushed by FlushAll until closed.
+type WebhookHook struct {
+	// counted atomically, first for 64-bit alignment
+	failures uint64
+
+	url       string
+	levels    []logrus.Level
+	formatter *Formatter
+	client    *http.Client
+	secret    []byte
+	queueSize int
+
+	breakerFailures int
+	breakerCooldown time.Duration
+	// consecutive failures and the end of the cooldown, used by run only
+	failed    int
+	openUntil time.Time
+
+	entries    chan webhookEntry
+	mu         sync.RWMutex
+	closed     bool
+	done       chan struct{}
+	unregister func()
+}
+
+// webhookEntry is an entry queued to be posted, or a flush request to be
+// acknowledged once the entries queued before it are posted
+type webhookEntry struct {
+	b       []byte
+	flushed chan struct{}
+}
+
+// WebhookOption lets you configure the WebhookHook.
+type WebhookOption func(*WebhookHook)
+
+// WithWebhookFormatter formats the entries posted with f, instead of a
+// Formatter with the default options.
+func WithWebhookFormatter(f *Formatter) WebhookOption {
+	return func(h *WebhookHook) {
+		h.formatter = f
+	}
+}
+
+// WithWebhookTimeout limits each request to the webhook. Defaults to 5
+// seconds.
+func WithWebhookTimeout(d time.Duration) WebhookOption {
+	return func(h *WebhookHook) {
+		h.client.Timeout = d
+	}
+}
+
+// WithWebhookSignature signs the body of each request with HMAC-SHA256 and
+// secret, in the WebhookSignatureHeader, so that the webhook may authenticate
+// it.
+func WithWebhookSignature(secret []byte) WebhookOption {
+	return func(h *WebhookHook) {
+		h.secret = secret
+	}
+}
+
+// WithWebhookQueueSize queues up to n entries to be posted, at least 1.
+// Defaults to 64.
+func WithWebhookQueueSize(n int) WebhookOption {
+	return func(h *WebhookHook) {
+		if n < 1 {
+			n = 1
+		}
+		h.queueSize = n
+	}
+}
+
+// WithWebhookCircuitBreaker drops entries for cooldown after failures
+// consecutive entries failed to be delivered. Defaults to 3 failures and 30
+// seconds.
+func WithWebhookCircuitBreaker(failures int, cooldown time.Duration) WebhookOption {
+	return func(h *WebhookHook) {
+		h.breakerFailures = failures
+		h.breakerCooldown = cooldown
+	}
+}
+
+// NewWebhookHook returns a WebhookHook posting the entries of levels to url.
+// It must be closed to deliver the queued entries.
+func NewWebhookHook(url string, levels []logrus.Level, opts ...WebhookOption) *WebhookHook {
+	h := &WebhookHook{
+		url:             url,
+		levels:          levels,
+		client:          &http.Client{Timeout: 5 * time.Second},
+		queueSize:       64,
+		breakerFailures: 3,
+		breakerCooldown: 30 * time.Second,
+		done:            make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.formatter == nil {
+		h.formatter = NewFormatter()
+	}
+	h.entries = make(chan webhookEntry, h.queueSize)
+
+	go h.run()
+	h.unregister = RegisterFlusher(h)
+	return h
+}
+
+func (h *WebhookHook) Levels() []logrus.Level {
+	return h.levels
+}
+
+// Fire queues the formatted entry to be posted, dropping it if the queue is
+// full.
+func (h *WebhookHook) Fire(e *logrus.Entry) error {
+	// formatted now, as the fields of the entry may be modified once logged
+	b, err := h.payload(e)
+	if err != nil {
+		return err
+	}
+
+	h.mu.RLock()
+	if h.closed {
+		h.mu.RUnlock()
+		return nil
+	}
+	select {
+	case h.entries <- webhookEntry{b: b}:
+	default:
+		h.recordFailure()
+	}
+	h.mu.RUnlock()
+
+	// the logger exits once the entry is written
+	if e.Level == logrus.FatalLevel {
+		ctx, cancel := context.WithTimeout(context.Background(), h.client.Timeout)
+		defer cancel()
+		_ = h.Flush(ctx)
+	}
+	return nil
+}
+
+// payload encodes the entry alone, without the notices that Format prepends
+// to the first entries, so that each body is a single JSON object
+func (h *WebhookHook) payload(e *logrus.Entry) ([]byte, error) {
+	ee, _ := h.formatter.ToEntry(e)
+	enc := h.formatter.Encoder
+	if enc == nil {
+		enc = JSONEncoder{PrettyPrint: h.formatter.PrettyPrint}
+	}
+	return h.formatter.encode(enc, &ee, nil)
+}
+
+// Flush waits until the entries queued before it are posted, or until ctx is
+// done.
+func (h *WebhookHook) Flush(ctx context.Context) error {
+	h.mu.RLock()
+	if h.closed {
+		h.mu.RUnlock()
+		return ErrWebhookHookClosed
+	}
+	flushed := make(chan struct{})
+	select {
+	case h.entries <- webhookEntry{flushed: flushed}:
+		h.mu.RUnlock()
+	case <-ctx.Done():
+		h.mu.RUnlock()
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Failures returns the number of entries the hook failed to deliver, or
+// dropped, since it was created.
+func (h *WebhookHook) Failures() uint64 {
+	return atomic.LoadUint64(&h.failures)
+}
+
+// Close stops accepting entries, and waits for those queued to be posted
+// until the timeout of a request.
+func (h *WebhookHook) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	close(h.entries)
+	h.mu.Unlock()
+	h.unregister()
+
+	select {
+	case <-h.done:
+		return nil
+	case <-time.After(h.client.Timeout):
+		return fmt.Errorf("logadapter: timed out closing WebhookHook, %d entries queued",
+			len(h.entries))
+	}
+}
+
+// run posts the queued entries
+func (h *WebhookHook) run() {
+	defer close(h.done)
+	for entry := range h.entries {
+		if entry.flushed != nil {
+			close(entry.flushed)
+			continue
+		}
+		h.deliver(entry.b)
+	}
+}
+
+// deliver posts an entry, retrying once, unless the circuit breaker is open
+func (h *WebhookHook) deliver(b []byte) {
+	if time.Now().Before(h.openUntil) {
+		h.recordFailure()
+		return
+	}
+	err := h.post(b)
+	if err != nil {
+		err = h.post(b)
+	}
+	if err == nil {
+		h.failed = 0
+		return
+	}
+
+	h.recordFailure()
+	h.failed++
+	if h.breakerFailures > 0 && h.failed >= h.breakerFailures {
+		h.openUntil = time.Now().Add(h.breakerCooldown)
+		h.failed = 0
+	}
+}
+
+func (h *WebhookHook) post(b []byte) error {
+	req, err := http.NewRequest(http.MethodPost, h.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.secret != nil {
+		mac := hmac.New(sha256.New, h.secret)
+		mac.Write(b)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	// drained so that the connection is reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("logadapter: webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+func (h *WebhookHook) recordFailure() {
+	atomic.AddUint64(&h.failures, 1)
+	if r, ok := h.formatter.Metrics.(WebhookFailureRecorder); ok {
+		r.IncWebhookFailures()
+	}
+}
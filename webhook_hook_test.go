@@ -0,0 +1,201 @@
+package logadapter_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	logadapter "github.com/StevenACoffman/logrus-stackdriver-formatter"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookFailures counts the entries a webhook failed to deliver
+type webhookFailures struct {
+	n int64
+}
+
+func (c *webhookFailures) IncEntries(string)             {}
+func (c *webhookFailures) IncFormatErrors()              {}
+func (c *webhookFailures) ObserveEntryBytes(string, int) {}
+
+func (c *webhookFailures) IncWebhookFailures() {
+	atomic.AddInt64(&c.n, 1)
+}
+
+type webhookRequest struct {
+	body      []byte
+	signature string
+	header    http.Header
+}
+
+// webhookReceiver records the requests it receives
+type webhookReceiver struct {
+	mu       sync.Mutex
+	requests []webhookRequest
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, webhookRequest{
+		body:      body,
+		signature: req.Header.Get(logadapter.WebhookSignatureHeader),
+		header:    req.Header,
+	})
+}
+
+func (r *webhookReceiver) received() []webhookRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]webhookRequest(nil), r.requests...)
+}
+
+func TestWebhookHook(t *testing.T) {
+	receiver := &webhookReceiver{}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	secret := []byte("webhook-secret")
+	hook := logadapter.NewWebhookHook(srv.URL, []logrus.Level{logrus.ErrorLevel},
+		logadapter.WithWebhookSignature(secret),
+		logadapter.WithWebhookFormatter(logadapter.NewFormatter(
+			logadapter.WithProjectID("test-project"),
+		)),
+	)
+	defer hook.Close()
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.Formatter = logadapter.NewFormatter()
+	logger.AddHook(hook)
+
+	logger.Info("order placed")
+	logger.Warn("payment retried")
+	logger.WithField("orderId", "A-1234").Error("payment failed")
+	require.NoError(t, hook.Flush(context.Background()))
+
+	requests := receiver.received()
+	require.Len(t, requests, 1, "lower levels are not posted")
+	req := requests[0]
+	assert.Equal(t, "application/json", req.header.Get("Content-Type"))
+
+	var entry logadapter.Entry
+	require.NoError(t, json.Unmarshal(req.body, &entry))
+	assert.Equal(t, logadapter.Severity("ERROR"), entry.Severity)
+	assert.Equal(t, "payment failed", entry.Message)
+	assert.Equal(t, "A-1234", entry.Context.Data["orderId"])
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(req.body)
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), req.signature)
+	assert.Zero(t, hook.Failures())
+}
+
+func TestWebhookHookSingleObject(t *testing.T) {
+	receiver := &webhookReceiver{}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	// without a ProjectID, Format prepends a warning to the first entry
+	hook := logadapter.NewWebhookHook(srv.URL, []logrus.Level{logrus.ErrorLevel})
+	defer hook.Close()
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+
+	logger.Error("payment failed")
+	logger.Error("order failed")
+	require.NoError(t, hook.Flush(context.Background()))
+
+	requests := receiver.received()
+	require.Len(t, requests, 2)
+	for _, req := range requests {
+		dec := json.NewDecoder(bytes.NewReader(req.body))
+		var entry map[string]interface{}
+		require.NoError(t, dec.Decode(&entry))
+		assert.Equal(t, "ERROR", entry["severity"])
+		assert.Equal(t, io.EOF, dec.Decode(&entry), "the body is a single object: %s", req.body)
+	}
+}
+
+func TestWebhookHookFailures(t *testing.T) {
+	var attempts int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	metrics := &webhookFailures{}
+	hook := logadapter.NewWebhookHook(srv.URL, []logrus.Level{logrus.ErrorLevel},
+		logadapter.WithWebhookFormatter(logadapter.NewFormatter(logadapter.WithMetrics(metrics))),
+		logadapter.WithWebhookCircuitBreaker(2, time.Hour),
+	)
+	defer hook.Close()
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+
+	for i := 0; i < 4; i++ {
+		logger.Error("payment failed")
+	}
+	require.NoError(t, hook.Flush(context.Background()))
+
+	assert.Equal(t, int64(4), atomic.LoadInt64(&attempts),
+		"each entry is retried once until the breaker opens")
+	assert.Equal(t, uint64(4), hook.Failures())
+	assert.Equal(t, int64(4), atomic.LoadInt64(&metrics.n))
+}
+
+func TestWebhookHookClose(t *testing.T) {
+	receiver := &webhookReceiver{}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	hook := logadapter.NewWebhookHook(srv.URL, []logrus.Level{logrus.ErrorLevel})
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+
+	logger.Error("payment failed")
+	require.NoError(t, hook.Close())
+	assert.Len(t, receiver.received(), 1, "queued entries are posted when closed")
+
+	logger.Error("payment failed")
+	assert.Equal(t, logadapter.ErrWebhookHookClosed, hook.Flush(context.Background()))
+	assert.Len(t, receiver.received(), 1)
+}
+
+func TestWebhookHookQueueSize(t *testing.T) {
+	receiver := &webhookReceiver{}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	for _, size := range []int{0, -1} {
+		hook := logadapter.NewWebhookHook(srv.URL, []logrus.Level{logrus.ErrorLevel},
+			logadapter.WithWebhookQueueSize(size))
+		logger := logrus.New()
+		logger.Out = ioutil.Discard
+		logger.AddHook(hook)
+
+		logger.Error("payment failed")
+		require.NoError(t, hook.Close())
+	}
+	assert.Len(t, receiver.received(), 2, "at least one entry is queued")
+}